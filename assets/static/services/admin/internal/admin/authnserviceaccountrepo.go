@@ -0,0 +1,185 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/pkg/client"
+	authnclient "github.com/adrianpk/hatmax-ref/pkg/client/authn"
+	"github.com/adrianpk/hatmax-ref/services/admin/internal/config"
+)
+
+// callerTokenKey is the context key of the bearer token admin was called with
+type callerTokenKey struct{}
+
+// WithCallerToken keeps the bearer token of the request in its context. Calls
+// to authn are made with it, so they are authorized as the admin using the
+// screens and authn records that admin as the actor.
+func WithCallerToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "bearer") && token != "" {
+			r = r.WithContext(context.WithValue(r.Context(), callerTokenKey{}, token))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// callerToken returns the token stored by WithCallerToken
+func callerToken(ctx context.Context) (string, error) {
+	token, _ := ctx.Value(callerTokenKey{}).(string)
+	return token, nil
+}
+
+// AuthnServiceAccountRepo manages service accounts and their keys in authn
+type AuthnServiceAccountRepo struct {
+	authn *authnclient.Client
+}
+
+// NewAuthnServiceAccountRepo creates a repository for the authn service at
+// services.authn_url
+func NewAuthnServiceAccountRepo(xparams config.XParams) *AuthnServiceAccountRepo {
+	return &AuthnServiceAccountRepo{
+		authn: authnclient.New(xparams.Cfg.Services.AuthnURL, client.WithTokenSource(callerToken)),
+	}
+}
+
+func (r *AuthnServiceAccountRepo) Create(ctx context.Context, req *CreateServiceAccountRequest) (*ServiceAccount, error) {
+	account, err := r.authn.CreateServiceAccount(ctx, authnclient.ServiceAccountInput{
+		Name:        req.Name,
+		Description: req.Description,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toServiceAccount(account)
+}
+
+func (r *AuthnServiceAccountRepo) Get(ctx context.Context, id uuid.UUID) (*ServiceAccount, error) {
+	account, err := r.authn.GetServiceAccount(ctx, id.String())
+	if err != nil {
+		return nil, err
+	}
+	return toServiceAccount(account)
+}
+
+func (r *AuthnServiceAccountRepo) List(ctx context.Context) ([]*ServiceAccount, error) {
+	accounts, err := r.authn.ListServiceAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*ServiceAccount, 0, len(accounts))
+	for i := range accounts {
+		account, err := toServiceAccount(&accounts[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, account)
+	}
+	return result, nil
+}
+
+func (r *AuthnServiceAccountRepo) Disable(ctx context.Context, id uuid.UUID) error {
+	return r.authn.DisableServiceAccount(ctx, id.String())
+}
+
+func (r *AuthnServiceAccountRepo) ListKeys(ctx context.Context, accountID uuid.UUID) ([]*APIKey, error) {
+	keys, err := r.authn.ListAPIKeys(ctx, accountID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*APIKey, 0, len(keys))
+	for i := range keys {
+		key, err := toAPIKey(&keys[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+func (r *AuthnServiceAccountRepo) CreateKey(ctx context.Context, accountID uuid.UUID, req *CreateAPIKeyRequest) (*APIKey, string, error) {
+	created, err := r.authn.CreateAPIKey(ctx, accountID.String(), authnclient.APIKeyInput{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, err := toAPIKey(created)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, created.Key, nil
+}
+
+func (r *AuthnServiceAccountRepo) RevokeKey(ctx context.Context, accountID, keyID uuid.UUID) error {
+	return r.authn.RevokeAPIKey(ctx, accountID.String(), keyID.String())
+}
+
+func toServiceAccount(account *authnclient.ServiceAccount) (*ServiceAccount, error) {
+	id, err := uuid.Parse(account.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account id %q: %w", account.ID, err)
+	}
+
+	return &ServiceAccount{
+		ID:          id,
+		Name:        account.Name,
+		Description: account.Description,
+		Status:      account.Status,
+		CreatedAt:   account.CreatedAt,
+		CreatedBy:   account.CreatedBy,
+		UpdatedAt:   account.UpdatedAt,
+		UpdatedBy:   account.UpdatedBy,
+	}, nil
+}
+
+func toAPIKey(key *authnclient.APIKey) (*APIKey, error) {
+	id, err := uuid.Parse(key.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api key id %q: %w", key.ID, err)
+	}
+	accountID, err := uuid.Parse(key.ServiceAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account id %q: %w", key.ServiceAccountID, err)
+	}
+
+	return &APIKey{
+		ID:               id,
+		ServiceAccountID: accountID,
+		Name:             key.Name,
+		Prefix:           key.Prefix,
+		Scopes:           key.Scopes,
+		ExpiresAt:        key.ExpiresAt,
+		LastUsedAt:       key.LastUsedAt,
+		RevokedAt:        key.RevokedAt,
+		CreatedAt:        key.CreatedAt,
+	}, nil
+}
+
+// authnStatus returns the status the screens answer for an authn error:
+// authn's own for missing or insufficient credentials and unknown accounts,
+// fallback otherwise.
+func authnStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, client.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, client.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, client.ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return fallback
+	}
+}
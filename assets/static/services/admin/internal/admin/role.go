@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
 )
 
 // Role represents a role in the admin interface (simplified view)
@@ -33,3 +35,12 @@ type UpdateRoleRequest struct {
 	Permissions []string `json:"permissions"`
 	Status      string   `json:"status"`
 }
+
+// authRole converts the role to the auth library type
+func (r *Role) authRole() authpkg.Role {
+	return authpkg.Role{
+		ID:          r.ID,
+		Name:        r.Name,
+		Permissions: r.Permissions,
+	}
+}
@@ -39,7 +39,13 @@ func main() {
 		Cfg: cfg,
 	}
 
+	middlewares, err := core.NewMiddlewareStack(core.DefaultMiddlewareOptions())
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+
 	router := chi.NewRouter()
+	router.Use(middlewares.Handler)
 
 	var deps []any
 
@@ -52,10 +58,20 @@ func main() {
 	userRepo := admin.NewFakeUserRepo()
 	roleRepo := admin.NewFakeRoleRepo()
 	grantRepo := admin.NewFakeGrantRepo(userRepo, roleRepo)
+	serviceAccountRepo := admin.NewAuthnServiceAccountRepo(xparams)
 
-	adminHandler := admin.NewAdminHandler(tmplMgr, userRepo, roleRepo, grantRepo, xparams)
+	adminHandler := admin.NewAdminHandler(tmplMgr, userRepo, roleRepo, grantRepo, serviceAccountRepo, xparams)
 	deps = append(deps, adminHandler)
 
+	routeCatalog, err := core.NewRouteCatalog(nil)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+	deps = append(deps, routeCatalog)
+
+	health := core.NewHealth()
+	deps = append(deps, health)
+
 	starts, stops := core.Setup(ctx, router, deps...)
 
 	if err := core.Start(ctx, starts, stops); err != nil {
@@ -66,7 +82,7 @@ func main() {
 	logger.Infof("%s(%s) started successfully", name, version)
 
 	go func() {
-		core.Serve(router, core.ServerOpts{Port: cfg.Server.Port}, stops, logger)
+		core.Serve(router, core.ServerOpts{Port: cfg.Server.Port, Health: health}, stops, logger)
 	}()
 
 	stop := make(chan os.Signal, 1)
@@ -0,0 +1,124 @@
+package authn
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/pkg/lib/core"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+// AdminGuard protects the authn endpoints that read or change other users.
+// Callers present an authn access token and need a permission granted in
+// authz.
+type AdminGuard struct {
+	authn   core.Authenticator
+	authz   authpkg.AuthzClient
+	xparams config.XParams
+}
+
+// NewAdminGuard creates a guard authenticating callers with authn and
+// checking their permissions with authz. Without an authz client every
+// permission is denied, so the guarded endpoints stay closed.
+func NewAdminGuard(authn core.Authenticator, authz authpkg.AuthzClient, xparams config.XParams) *AdminGuard {
+	return &AdminGuard{
+		authn:   authn,
+		authz:   authz,
+		xparams: xparams,
+	}
+}
+
+// NewAuthzPermissions creates a permission client for services.authz_url.
+// It returns nil when that is unset.
+func NewAuthzPermissions(xparams config.XParams) authpkg.AuthzClient {
+	url := strings.TrimRight(strings.TrimSpace(xparams.Cfg.Services.AuthzURL), "/")
+	if url == "" {
+		return nil
+	}
+	return core.NewHTTPAuthzClient(url, 0)
+}
+
+// NewAuthzPolicyVersion creates a source of the authz policy version for
+// services.authz_url. It returns nil when that is unset.
+func NewAuthzPolicyVersion(xparams config.XParams) core.PolicyVersionSource {
+	url := strings.TrimRight(strings.TrimSpace(xparams.Cfg.Services.AuthzURL), "/")
+	if url == "" {
+		return nil
+	}
+	return core.NewHTTPAuthzClient(url, 0)
+}
+
+// Require admits authenticated callers holding permission.
+func (g *AdminGuard) Require(permission string) func(http.Handler) http.Handler {
+	authenticate := core.AuthMiddleware(g.authn, g.xparams.Log)
+
+	return func(next http.Handler) http.Handler {
+		return authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if g.permitted(w, r, permission) {
+				next.ServeHTTP(w, r)
+			}
+		}))
+	}
+}
+
+// RequireSelfOr admits the user named by the param URL parameter, and
+// authenticated callers holding permission.
+func (g *AdminGuard) RequireSelfOr(param, permission string) func(http.Handler) http.Handler {
+	authenticate := core.AuthMiddleware(g.authn, g.xparams.Log)
+
+	return func(next http.Handler) http.Handler {
+		return authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isSelf(r, param) || g.permitted(w, r, permission) {
+				next.ServeHTTP(w, r)
+			}
+		}))
+	}
+}
+
+// isSelf reports whether the param URL parameter names the authenticated user
+func isSelf(r *http.Request, param string) bool {
+	claims, ok := core.ClaimsFromContext(r.Context())
+	if !ok {
+		return false
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, param))
+	return err == nil && id.String() == claims.Subject
+}
+
+// permitted checks that the authenticated caller holds permission, and
+// writes the error response when it does not.
+func (g *AdminGuard) permitted(w http.ResponseWriter, r *http.Request, permission string) bool {
+	log := g.xparams.Log.With("request_id", middleware.GetReqID(r.Context()), "path", r.URL.Path)
+
+	claims, ok := core.ClaimsFromContext(r.Context())
+	if !ok || claims.Subject == "" {
+		core.Error(w, http.StatusUnauthorized, core.ReasonUnauthenticated, "No authenticated user")
+		return false
+	}
+
+	if g.authz == nil {
+		log.Debug("no authz service configured, permission denied", "user_id", claims.Subject, "permission", permission)
+		core.Error(w, http.StatusForbidden, core.ReasonPermissionDenied, "Missing permission "+permission)
+		return false
+	}
+
+	allowed, err := g.authz.CheckPermission(r.Context(), claims.Subject, permission, "")
+	if err != nil {
+		log.Error("cannot check permission", "error", err, "user_id", claims.Subject, "permission", permission)
+		core.Error(w, http.StatusForbidden, core.ReasonAuthzUnavailable, "Cannot check permissions")
+		return false
+	}
+	if !allowed {
+		log.Debug("permission denied", "user_id", claims.Subject, "permission", permission)
+		core.Error(w, http.StatusForbidden, core.ReasonPermissionDenied, "Missing permission "+permission)
+		return false
+	}
+
+	return true
+}
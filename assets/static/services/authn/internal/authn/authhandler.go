@@ -1,19 +1,16 @@
 package authn
 
 import (
-	"context"
-	"crypto/ed25519"
-	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/google/uuid"
 
 	"github.com/username/repo/pkg/lib/core"
 	authpkg "github.com/username/repo/pkg/lib/auth"
@@ -36,28 +33,52 @@ type SignInRequest struct {
 
 // AuthResponse represents successful authentication response
 type AuthResponse struct {
-	User  *User  `json:"user"`
-	Token string `json:"token,omitempty"`
+	User         *User      `json:"user,omitempty"`
+	Token        string     `json:"token,omitempty"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MFARequired  bool       `json:"mfa_required,omitempty"`
+	MFAToken     string     `json:"mfa_token,omitempty"`
 }
 
 // NewAuthHandler creates a new AuthHandler for authentication operations.
-func NewAuthHandler(repo UserRepo, xparams config.XParams) *AuthHandler {
+func NewAuthHandler(repo UserRepo, pii *PIIKeyring, sessions *SessionManager, mfa *MFAManager, emails *EmailManager, limiter *LoginLimiter, xparams config.XParams) *AuthHandler {
 	return &AuthHandler{
-		repo:    repo,
-		xparams: xparams,
+		repo:     repo,
+		pii:      pii,
+		sessions: sessions,
+		mfa:      mfa,
+		emails:   emails,
+		limiter:  limiter,
+		xparams:  xparams,
 	}
 }
 
 type AuthHandler struct {
-	repo    UserRepo
-	xparams config.XParams
+	repo     UserRepo
+	pii      *PIIKeyring
+	sessions *SessionManager
+	mfa      *MFAManager
+	emails   *EmailManager
+	limiter  *LoginLimiter
+	xparams  config.XParams
 }
 
 func (h *AuthHandler) RegisterRoutes(r chi.Router) {
 	r.Route("/authn", func(r chi.Router) {
 		r.Post("/signup", h.SignUp)
 		r.Post("/signin", h.SignIn)
+		r.Post("/signin/mfa", h.SignInMFA)
 		r.Post("/signout", h.SignOut)
+		r.Post("/refresh", h.Refresh)
+		r.Get("/sessions", h.ListSessions)
+		r.Delete("/sessions/{id}", h.RevokeSession)
+		r.Get("/revocations", h.GetRevocations)
+		r.Post("/mfa/enroll", h.EnrollMFA)
+		r.Post("/mfa/confirm", h.ConfirmMFA)
+		r.Post("/password/forgot", h.ForgotPassword)
+		r.Post("/password/reset", h.ResetPassword)
+		r.Post("/verify", h.VerifyEmail)
 	})
 }
 
@@ -80,27 +101,9 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 
 	// Create domain user using pure functions
 	normalizedEmail := authpkg.NormalizeEmail(req.Email)
-	
-	// Use encryption keys from config
-	encryptionKey := []byte(h.xparams.Cfg.Auth.EncryptionKey)
-	signingKey := []byte(h.xparams.Cfg.Auth.SigningKey)
-	
-	// Debug: Check key lengths
-	log.Info("encryption key configured", "length", len(encryptionKey))
-	log.Info("signing key configured", "length", len(signingKey))
-	
-	// Encrypt email for storage
-	encryptedEmail, err := authpkg.EncryptEmail(normalizedEmail, encryptionKey)
-	if err != nil {
-		log.Error("error encrypting email", "error", err)
-		core.RespondError(w, http.StatusInternalServerError, "Could not create account")
-		return
-	}
-	
-	emailLookup := authpkg.ComputeLookupHash(normalizedEmail, signingKey)
-	
-	// Check if user already exists
-	existingUser, err := h.repo.GetByEmailLookup(ctx, emailLookup)
+
+	// Check if user already exists, under any PII key version
+	existingUser, err := h.pii.FindUser(ctx, h.repo, normalizedEmail)
 	if err != nil {
 		log.Error("error checking existing user", "error", err)
 		core.RespondError(w, http.StatusInternalServerError, "Could not create account")
@@ -112,21 +115,18 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate salt and hash password
-	salt := authpkg.GeneratePasswordSalt()
-	passwordHash := authpkg.HashPassword([]byte(req.Password), salt)
-
-	// TODO: Encrypt email (needs AES-GCM implementation in authpkg)
-	// For now, store plaintext (will be encrypted once crypto functions are complete)
-	
-	// Create service user
+	// Create service user with the email encrypted under its own data key
 	user := NewUser()
-	user.EmailCT = encryptedEmail.Ciphertext
-	user.EmailIV = encryptedEmail.IV
-	user.EmailTag = encryptedEmail.Tag
-	user.EmailLookup = emailLookup
-	user.PasswordHash = passwordHash
-	user.PasswordSalt = salt
+	if err := h.pii.SealEmail(ctx, user, normalizedEmail); err != nil {
+		log.Error("error encrypting email", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not create account")
+		return
+	}
+	if err := user.SetPassword(req.Password, passwordPolicy(h.xparams.Cfg.Auth)); err != nil {
+		log.Error("cannot hash password", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not create account")
+		return
+	}
 	user.BeforeCreate()
 
 	if err := h.repo.Create(ctx, user); err != nil {
@@ -135,6 +135,11 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A failed verification mail is logged but does not fail the signup
+	if err := h.emails.SendVerification(ctx, user); err != nil {
+		log.Error("cannot send verification email", "error", err)
+	}
+
 	// Return success (no token in signup, user needs to signin)
 	w.WriteHeader(http.StatusCreated)
 	core.RespondSuccess(w, AuthResponse{User: user})
@@ -142,7 +147,6 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 
 func (h *AuthHandler) SignIn(w http.ResponseWriter, r *http.Request) {
 	log := h.logForRequest(r)
-	ctx := r.Context()
 
 	req, ok := h.decodeSignInPayload(w, r, log)
 	if !ok {
@@ -157,66 +161,170 @@ func (h *AuthHandler) SignIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Normalize email and compute lookup hash
-	normalizedEmail := authpkg.NormalizeEmail(req.Email)
-	signingKey := []byte(h.xparams.Cfg.Auth.SigningKey)
-	emailLookup := authpkg.ComputeLookupHash(normalizedEmail, signingKey)
+	ip := clientIP(r)
+	user, failure := h.checkPassword(r, log, req.Email, req.Password, ip)
+	if failure != nil {
+		failure.respond(w)
+		return
+	}
+
+	h.completeSignIn(w, r, log, user, ip)
+}
+
+// completeSignIn answers a sign in whose first factor passed, by password or
+// through a federated provider.
+func (h *AuthHandler) completeSignIn(w http.ResponseWriter, r *http.Request, log core.Logger, user *User, ip string) {
+	ctx := r.Context()
+
+	// With MFA enabled the first factor only earns a short lived mfa_pending
+	// token, exchanged for a session at /authn/signin/mfa. Login attempts are
+	// reset only then, so wrong codes keep counting against the account.
+	if h.mfa.Enabled(user) {
+		mfaToken, expiresAt, err := h.mfa.IssuePendingToken(user)
+		if err != nil {
+			log.Error("error issuing mfa token", "error", err)
+			core.RespondError(w, http.StatusInternalServerError, "Authentication failed")
+			return
+		}
+
+		core.RespondSuccess(w, AuthResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			ExpiresAt:   &expiresAt,
+		})
+		return
+	}
 
-	// Find user by email lookup
-	user, err := h.repo.GetByEmailLookup(ctx, emailLookup)
+	// Start a session
+	tokens, err := h.sessions.Start(ctx, user.ID, ip, r.UserAgent())
 	if err != nil {
-		log.Error("error finding user", "error", err)
+		log.Error("error starting session", "error", err)
 		core.RespondError(w, http.StatusInternalServerError, "Authentication failed")
 		return
 	}
+
+	h.resetLoginAttempts(r, log, user)
+
+	core.RespondSuccess(w, AuthResponse{
+		User:         user,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    &tokens.ExpiresAt,
+	})
+}
+
+// Helper methods
+
+func (h *AuthHandler) logForRequest(r *http.Request) core.Logger {
+	return h.xparams.Log.With(
+		"request_id", middleware.GetReqID(r.Context()),
+		"method", r.Method,
+		"path", r.URL.Path,
+	)
+}
+
+// signInFailure is a sign in turned away, answered with Status and Message.
+// RetryAfter is set for lockouts.
+type signInFailure struct {
+	Status     int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (f *signInFailure) respond(w http.ResponseWriter) {
+	if f.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(f.RetryAfter.Seconds()))))
+	}
+	core.RespondError(w, f.Status, f.Message)
+}
+
+var errSignInFailed = &signInFailure{Status: http.StatusInternalServerError, Message: "Authentication failed"}
+
+// checkPassword runs the password step of a sign in, shared by the JSON API
+// and the OIDC sign in page: login limits, the user lookup, the password and
+// the account status. Failures are counted against the account and the IP.
+func (h *AuthHandler) checkPassword(r *http.Request, log core.Logger, email, password, ip string) (*User, *signInFailure) {
+	ctx := r.Context()
+
+	// Normalize email and compute lookup hash
+	normalizedEmail := authpkg.NormalizeEmail(email)
+	emailLookup := h.pii.Lookup(normalizedEmail)
+
+	// Locked out accounts and IPs are turned away before any hashing
+	if failure := h.checkLoginLimit(r, log, emailLookup, ip); failure != nil {
+		return nil, failure
+	}
+
+	// Find user by email lookup, under any PII key version
+	user, err := h.pii.FindUser(ctx, h.repo, normalizedEmail)
+	if err != nil {
+		log.Error("error finding user", "error", err)
+		return nil, errSignInFailed
+	}
+	policy := passwordPolicy(h.xparams.Cfg.Auth)
 	if user == nil {
+		verifyDummyPassword(password, policy)
 		log.Debug("user not found")
-		core.RespondError(w, http.StatusUnauthorized, "Invalid credentials")
-		return
+		h.recordLoginFailure(r, log, nil, emailLookup, ip)
+		return nil, &signInFailure{Status: http.StatusUnauthorized, Message: "Invalid credentials"}
 	}
 
-	// Verify password using pure function
-	if !authpkg.VerifyPasswordHash([]byte(req.Password), user.PasswordHash, user.PasswordSalt) {
+	// Verify the password; outdated hashes are upgraded to the current policy
+	ok, err := user.CheckPassword(ctx, h.repo, password, policy)
+	if err != nil {
+		log.Error("cannot rehash password", "error", err)
+	}
+	if !ok {
 		log.Debug("invalid password")
-		core.RespondError(w, http.StatusUnauthorized, "Invalid credentials")
-		return
+		h.recordLoginFailure(r, log, user, emailLookup, ip)
+		return nil, &signInFailure{Status: http.StatusUnauthorized, Message: "Invalid credentials"}
 	}
 
 	// Check user status
 	if user.Status != authpkg.UserStatusActive {
 		log.Debug("user not active", "status", user.Status)
-		core.RespondError(w, http.StatusForbidden, "Account is not active")
-		return
+		return nil, &signInFailure{Status: http.StatusForbidden, Message: "Account is not active"}
 	}
 
-	// Generate session token
-	token, err := h.generateSessionToken(user.ID.String())
-	if err != nil {
-		log.Error("error generating session token", "error", err)
-		core.RespondError(w, http.StatusInternalServerError, "Authentication failed")
-		return
+	// Users still on an old PII key move to the active one as they sign in,
+	// ahead of the re-encryption job
+	if _, err := h.pii.Rekey(ctx, h.repo, user); err != nil {
+		log.Error("cannot re-encrypt user email", "error", err)
 	}
-	
-	core.RespondSuccess(w, AuthResponse{User: user, Token: token})
+
+	return user, nil
 }
 
-func (h *AuthHandler) SignOut(w http.ResponseWriter, r *http.Request) {
-	log := h.logForRequest(r)
-	
-	// TODO: Invalidate session token
-	
-	log.Debug("user signed out")
-	w.WriteHeader(http.StatusNoContent)
+// checkLoginLimit turns the sign in away with 429 and Retry-After when the
+// account or the IP is locked out. Locked out unknown emails get the same
+// answer.
+func (h *AuthHandler) checkLoginLimit(r *http.Request, log core.Logger, lookup []byte, ip string) *signInFailure {
+	wait, err := h.limiter.Check(r.Context(), lookup, ip)
+	if err != nil {
+		log.Error("error checking login attempts", "error", err)
+		return errSignInFailed
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	log.Info("sign in locked out", "ip", ip, "retry_after", wait)
+	return &signInFailure{Status: http.StatusTooManyRequests, Message: "Too many sign in attempts", RetryAfter: wait}
 }
 
-// Helper methods
+// resetLoginAttempts clears the failed sign ins of a user that signed in.
+func (h *AuthHandler) resetLoginAttempts(r *http.Request, log core.Logger, user *User) {
+	if err := h.limiter.Succeed(r.Context(), user.EmailLookup); err != nil {
+		log.Error("error resetting login attempts", "error", err)
+	}
+}
 
-func (h *AuthHandler) logForRequest(r *http.Request) core.Logger {
-	return h.xparams.Log.With(
-		"request_id", middleware.GetReqID(r.Context()),
-		"method", r.Method,
-		"path", r.URL.Path,
-	)
+// recordLoginFailure counts a failed sign in. Errors are logged; the caller
+// still answers with its own failure.
+func (h *AuthHandler) recordLoginFailure(r *http.Request, log core.Logger, user *User, lookup []byte, ip string) {
+	if err := h.limiter.Fail(r.Context(), user, lookup, ip); err != nil {
+		log.Error("error recording login failure", "error", err)
+	}
 }
 
 func (h *AuthHandler) decodeSignUpPayload(w http.ResponseWriter, r *http.Request, log core.Logger) (SignUpRequest, bool) {
@@ -247,48 +355,6 @@ func (h *AuthHandler) decodeSignUpPayload(w http.ResponseWriter, r *http.Request
 	return req, true
 }
 
-// generateSessionToken creates a session token for the user
-func (h *AuthHandler) generateSessionToken(userID string) (string, error) {
-	// Parse session TTL
-	ttl, err := time.ParseDuration(h.xparams.Cfg.Auth.SessionTTL)
-	if err != nil {
-		return "", fmt.Errorf("invalid session TTL: %w", err)
-	}
-
-	// Get or generate Ed25519 private key
-	privateKey, err := h.getTokenPrivateKey()
-	if err != nil {
-		return "", fmt.Errorf("could not get private key: %w", err)
-	}
-
-	// Generate session ID
-	sessionID := uuid.New().String()
-
-	// Generate token
-	return authpkg.GenerateSessionToken(userID, sessionID, privateKey, ttl)
-}
-
-// getTokenPrivateKey gets or generates the Ed25519 private key for tokens
-func (h *AuthHandler) getTokenPrivateKey() (ed25519.PrivateKey, error) {
-	// Try to get from config first
-	if h.xparams.Cfg.Auth.TokenPrivateKey != "" {
-		keyBytes, err := base64.StdEncoding.DecodeString(h.xparams.Cfg.Auth.TokenPrivateKey)
-		if err != nil {
-			return nil, fmt.Errorf("error decode private key: %w", err)
-		}
-		return ed25519.PrivateKey(keyBytes), nil
-	}
-
-	// Generate new key pair if not configured
-	// In production, this should be persistent
-	_, privateKey, err := authpkg.GenerateKeyPair()
-	if err != nil {
-		return nil, fmt.Errorf("error generate key pair: %w", err)
-	}
-
-	return privateKey, nil
-}
-
 func (h *AuthHandler) decodeSignInPayload(w http.ResponseWriter, r *http.Request, log core.Logger) (SignInRequest, bool) {
 	var req SignInRequest
 
@@ -315,4 +381,25 @@ func (h *AuthHandler) decodeSignInPayload(w http.ResponseWriter, r *http.Request
 	}
 
 	return req, true
-}
\ No newline at end of file
+}
+
+// decodePayload reads a JSON request body into req.
+func (h *AuthHandler) decodePayload(w http.ResponseWriter, r *http.Request, log core.Logger, req any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, AuthMaxBodyBytes)
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Debug("cannot read request body", "error", err)
+		core.RespondError(w, http.StatusBadRequest, "Could not read request body")
+		return false
+	}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		log.Debug("cannot decode JSON", "error", err)
+		core.RespondError(w, http.StatusBadRequest, "Could not parse JSON")
+		return false
+	}
+
+	return true
+}
@@ -2,10 +2,14 @@ package authn
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
@@ -29,14 +33,49 @@ func setupAuthHandler() (*AuthHandler, *mockUserRepo) {
 			TokenPrivateKey:   "",
 			TokenPublicKey:    "",
 		},
+		Mail: config.MailConfig{
+			From:    "no-reply@example.com",
+			LinkURL: "https://app.example.com/",
+		},
 	}
 	
 	xparams := config.XParams{
 		Log: log,
 		Cfg: cfg,
 	}
-	
-	handler := NewAuthHandler(repo, xparams)
+
+	keys, err := NewKeyring(newMockSigningKeyRepo(), xparams)
+	if err != nil {
+		panic(err)
+	}
+	if err := keys.ensureKeys(context.Background()); err != nil {
+		panic(err)
+	}
+
+	sessions, err := NewSessionManager(newMockSessionRepo(), keys, nil, xparams)
+	if err != nil {
+		panic(err)
+	}
+
+	pii, err := NewPIIKeyring(newMockDataKeyRepo(), xparams)
+	if err != nil {
+		panic(err)
+	}
+
+	mfa := NewMFAManager(repo, newMockMFARepo(), keys, pii, xparams)
+
+	templates := core.NewTemplateManager(os.DirFS("../.."), log)
+	if err := templates.Start(context.Background()); err != nil {
+		panic(err)
+	}
+	emails := NewEmailManager(repo, newMockEmailTokenRepo(), keys, pii, core.NewMemoryMailer(), templates, xparams)
+
+	limiter, err := NewLoginLimiter(newMockLoginAttemptRepo(), repo, xparams)
+	if err != nil {
+		panic(err)
+	}
+
+	handler := NewAuthHandler(repo, pii, sessions, mfa, emails, limiter, xparams)
 	return handler, repo
 }
 
@@ -65,6 +104,10 @@ func TestAuthHandler_RegisterRoutes(t *testing.T) {
 		{http.MethodPost, "/authn/signup"},
 		{http.MethodPost, "/authn/signin"},
 		{http.MethodPost, "/authn/signout"},
+		{http.MethodPost, "/authn/refresh"},
+		{http.MethodGet, "/authn/sessions"},
+		{http.MethodDelete, "/authn/sessions/" + uuid.New().String()},
+		{http.MethodGet, "/authn/revocations"},
 	}
 
 	for _, tt := range tests {
@@ -289,14 +332,36 @@ func TestAuthHandler_SignIn(t *testing.T) {
 
 func TestAuthHandler_SignOut(t *testing.T) {
 	handler, _ := setupAuthHandler()
+	tokens, err := handler.sessions.Start(context.Background(), uuid.New(), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
 
-	req := httptest.NewRequest(http.MethodPost, "/authn/signout", nil)
-	rr := httptest.NewRecorder()
-	
-	handler.SignOut(rr, req)
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"invalid token", "Bearer invalid", http.StatusUnauthorized},
+		{"valid token", "Bearer " + tokens.AccessToken, http.StatusNoContent},
+		{"signed out token", "Bearer " + tokens.AccessToken, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/authn/signout", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.SignOut(rr, req)
 
-	if rr.Code != http.StatusNoContent {
-		t.Errorf("SignOut() status = %d, want %d", rr.Code, http.StatusNoContent)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("SignOut() status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+		})
 	}
 }
 
@@ -441,110 +506,57 @@ func TestAuthHandler_decodeSignInPayload(t *testing.T) {
 	}
 }
 
-func TestAuthHandler_generateSessionToken(t *testing.T) {
-	handler, _ := setupAuthHandler()
+func TestAuthHandler_SignInIssuesSessionTokens(t *testing.T) {
+	handler, repo := setupAuthHandler()
 
-	tests := []struct {
-		name          string
-		userID        string
-		sessionTTL    string
-		tokenKey      string
-		expectError   bool
-	}{
-		{
-			name:        "valid token generation",
-			userID:      uuid.New().String(),
-			sessionTTL:  "24h",
-			expectError: false,
-		},
-		{
-			name:          "invalid session TTL",
-			userID:        uuid.New().String(),
-			sessionTTL:    "invalid-duration",
-			expectError:   true,
-		},
-		{
-			name:        "with configured private key",
-			userID:      uuid.New().String(),
-			sessionTTL:  "1h",
-			tokenKey:    generateBase64Ed25519Key(),
-			expectError: false,
-		},
+	normalizedEmail := authpkg.NormalizeEmail("test@example.com")
+	salt := authpkg.GeneratePasswordSalt()
+	user := &User{
+		ID:           uuid.New(),
+		EmailLookup:  authpkg.ComputeLookupHash(normalizedEmail, []byte(handler.xparams.Cfg.Auth.SigningKey)),
+		PasswordHash: authpkg.HashPassword([]byte("ValidPassword123!"), salt),
+		PasswordSalt: salt,
+		Status:       authpkg.UserStatusActive,
 	}
+	repo.users[user.ID] = user
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Setup config for this test
-			handler.xparams.Cfg.Auth.SessionTTL = tt.sessionTTL
-			handler.xparams.Cfg.Auth.TokenPrivateKey = tt.tokenKey
-
-			token, err := handler.generateSessionToken(tt.userID)
+	req := httptest.NewRequest(http.MethodPost, "/authn/signin", strings.NewReader(`{"email":"test@example.com","password":"ValidPassword123!"}`))
+	req.Header.Set("User-Agent", "test-agent")
+	rr := httptest.NewRecorder()
+	handler.SignIn(rr, req)
 
-			if tt.expectError {
-				if err == nil {
-					t.Error("generateSessionToken() expected error but got none")
-				}
-			} else {
-				if err != nil {
-					t.Errorf("generateSessionToken() unexpected error: %v", err)
-				}
-				if token == "" {
-					t.Error("generateSessionToken() returned empty token")
-				}
-			}
-		})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("SignIn() status = %d, want %d", rr.Code, http.StatusOK)
 	}
-}
-
-func TestAuthHandler_getTokenPrivateKey(t *testing.T) {
-	handler, _ := setupAuthHandler()
 
-	tests := []struct {
-		name              string
-		configuredKey     string
-		expectError       bool
-		expectKeyGeneration bool
-	}{
-		{
-			name:          "valid configured key",
-			configuredKey: generateBase64Ed25519Key(),
-			expectError:   false,
-		},
-		{
-			name:          "invalid configured key",
-			configuredKey: "invalid-key",
-			expectError:   true,
-		},
-		{
-			name:                "no configured key - generate new",
-			configuredKey:       "",
-			expectError:         false,
-			expectKeyGeneration: true,
-		},
+	var resp struct {
+		Data AuthResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("cannot decode response: %v", err)
+	}
+	if resp.Data.RefreshToken == "" || resp.Data.ExpiresAt == nil {
+		t.Fatalf("SignIn() response = %+v, want refresh token and expiry", resp.Data)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			handler.xparams.Cfg.Auth.TokenPrivateKey = tt.configuredKey
+	kid, privateKey, _ := handler.sessions.keys.SigningKey()
+	footer, err := authpkg.ParseTokenFooter(resp.Data.Token)
+	if err != nil || footer.KeyID != kid {
+		t.Errorf("token kid = %q, %v, want %q", footer.KeyID, err, kid)
+	}
 
-			privateKey, err := handler.getTokenPrivateKey()
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	claims, err := authpkg.VerifyPASETOTokenWithOptions(resp.Data.Token, publicKey, authpkg.TokenOptions{KeyID: kid})
+	if err != nil || claims.Subject != user.ID.String() {
+		t.Fatalf("VerifyPASETOTokenWithOptions() = %+v, %v", claims, err)
+	}
+	if ttl := claims.ExpiresAt - claims.IssuedAt; ttl != int64(defaultAccessTTL.Seconds()) {
+		t.Errorf("access token TTL = %ds, want %s", ttl, defaultAccessTTL)
+	}
 
-			if tt.expectError {
-				if err == nil {
-					t.Error("getTokenPrivateKey() expected error but got none")
-				}
-			} else {
-				if err != nil {
-					t.Errorf("getTokenPrivateKey() unexpected error: %v", err)
-				}
-				if privateKey == nil {
-					t.Error("getTokenPrivateKey() returned nil private key")
-				}
-				if len(privateKey) == 0 {
-					t.Error("getTokenPrivateKey() returned empty private key")
-				}
-			}
-		})
+	session, _ := handler.sessions.Get(context.Background(), uuid.MustParse(claims.SessionID))
+	if session == nil || session.UserID != user.ID || session.UserAgent != "test-agent" || session.IP == "" {
+		t.Errorf("session = %+v, want one recording the user, IP and user agent", session)
 	}
 }
 
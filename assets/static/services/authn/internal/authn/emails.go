@@ -0,0 +1,275 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/pkg/lib/core"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+const (
+	emailVerifyTTL   = 24 * time.Hour
+	passwordResetTTL = time.Hour
+
+	// passwordResetSendTimeout bounds the background send of a reset mail.
+	passwordResetSendTimeout = time.Minute
+	// passwordResetMaxPending caps the reset mails sent at once; requests
+	// past it are dropped.
+	passwordResetMaxPending = 16
+
+	verifyEmailTemplate   = "verify-email"
+	passwordResetTemplate = "password-reset"
+)
+
+// ErrInvalidEmailToken is returned for invalid, expired or already used
+// email verification and password reset tokens.
+var ErrInvalidEmailToken = errors.New("invalid email token")
+
+// EmailLink is the data the verification and password reset mail templates
+// are rendered with.
+type EmailLink struct {
+	URL       string
+	ExpiresAt time.Time
+}
+
+// EmailManager sends email verification and password reset links and
+// consumes their tokens. Tokens are signed by the keyring with the purpose as
+// audience and carry the ID of an EmailToken record, which makes them single use.
+type EmailManager struct {
+	users     UserRepo
+	tokens    EmailTokenRepo
+	keys      *Keyring
+	mailer    core.Mailer
+	composer  *core.MailComposer
+	pii       *PIIKeyring
+	linkURL   string
+	passwords authpkg.PasswordParams
+	log       core.Logger
+	now       func() time.Time
+
+	pending sync.WaitGroup
+	slots   chan struct{}
+}
+
+// NewEmailManager creates an email manager. Messages are rendered from the
+// mail templates loaded by templates and sent with mailer to the addresses
+// pii decrypts.
+func NewEmailManager(users UserRepo, tokens EmailTokenRepo, keys *Keyring, pii *PIIKeyring, mailer core.Mailer, templates *core.TemplateManager, xparams config.XParams) *EmailManager {
+	cfg := xparams.Cfg
+
+	return &EmailManager{
+		users:     users,
+		tokens:    tokens,
+		keys:      keys,
+		mailer:    mailer,
+		composer:  core.NewMailComposer(templates, cfg.Mail.From),
+		pii:       pii,
+		linkURL:   strings.TrimSuffix(cfg.Mail.LinkURL, "/"),
+		passwords: passwordPolicy(cfg.Auth),
+		log:       xparams.Log,
+		now:       time.Now,
+		slots:     make(chan struct{}, passwordResetMaxPending),
+	}
+}
+
+// SendVerification mails the user a link to verify their email address.
+func (m *EmailManager) SendVerification(ctx context.Context, user *User) error {
+	token, expiresAt, err := m.issue(ctx, user.ID, EmailTokenVerify, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	link := EmailLink{URL: m.linkURL + "/verify-email?token=" + url.QueryEscape(token), ExpiresAt: expiresAt}
+	return m.send(ctx, user, verifyEmailTemplate, link)
+}
+
+// VerifyEmail consumes a verification token and marks the email of its user
+// as verified.
+func (m *EmailManager) VerifyEmail(ctx context.Context, token string) (*User, error) {
+	user, err := m.consume(ctx, token, EmailTokenVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		now := m.now()
+		user.EmailVerifiedAt = &now
+		user.BeforeUpdate()
+		if err := m.users.Save(ctx, user); err != nil {
+			return nil, fmt.Errorf("cannot verify email: %w", err)
+		}
+	}
+	return user, nil
+}
+
+// Stop waits for the password reset mails still being sent.
+func (m *EmailManager) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// SendPasswordReset mails a password reset link to the active user with the
+// given email. The user is looked up and mailed in the background, so callers
+// can tell neither from the result nor from the time taken which addresses
+// have accounts. Failures are logged. When passwordResetMaxPending mails are
+// already being sent the request is dropped.
+func (m *EmailManager) SendPasswordReset(ctx context.Context, email string) {
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		m.log.Error("too many password resets pending, request dropped")
+		return
+	}
+
+	m.pending.Add(1)
+	go func() {
+		defer m.pending.Done()
+		defer func() { <-m.slots }()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), passwordResetSendTimeout)
+		defer cancel()
+
+		if err := m.sendPasswordReset(ctx, email); err != nil {
+			m.log.Error("cannot send password reset", "error", err)
+		}
+	}()
+}
+
+// sendPasswordReset mails the reset link when email belongs to an active user.
+func (m *EmailManager) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := m.pii.FindUser(ctx, m.users, authpkg.NormalizeEmail(email))
+	if err != nil {
+		return fmt.Errorf("cannot find user: %w", err)
+	}
+	if user == nil || user.Status != authpkg.UserStatusActive {
+		return nil
+	}
+
+	token, expiresAt, err := m.issue(ctx, user.ID, EmailTokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := EmailLink{URL: m.linkURL + "/reset-password?token=" + url.QueryEscape(token), ExpiresAt: expiresAt}
+	return m.send(ctx, user, passwordResetTemplate, link)
+}
+
+// ResetPassword consumes a password reset token and sets the new password.
+// Other reset tokens of the user stop working. Callers are expected to have
+// validated the password and to revoke the user's sessions.
+func (m *EmailManager) ResetPassword(ctx context.Context, token, password string) (*User, error) {
+	user, err := m.consume(ctx, token, EmailTokenPasswordReset)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := user.SetPassword(password, m.passwords); err != nil {
+		return nil, err
+	}
+	user.BeforeUpdate()
+	if err := m.users.Save(ctx, user); err != nil {
+		return nil, fmt.Errorf("cannot reset password: %w", err)
+	}
+
+	if err := m.tokens.UseAll(ctx, user.ID, EmailTokenPasswordReset, m.now()); err != nil {
+		return nil, fmt.Errorf("cannot invalidate reset tokens: %w", err)
+	}
+	return user, nil
+}
+
+// issue records an EmailToken and returns the signed token naming it.
+func (m *EmailManager) issue(ctx context.Context, userID uuid.UUID, purpose string, ttl time.Duration) (string, time.Time, error) {
+	now := m.now()
+	record := &EmailToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	token, err := m.keys.Sign(claimsAt(userID.String(), record.ID.String(), purpose, ttl, now))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("could not sign email token: %w", err)
+	}
+
+	if err := m.tokens.Create(ctx, record); err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot save email token: %w", err)
+	}
+	return token, record.ExpiresAt, nil
+}
+
+// consume verifies a token for purpose, marks its record used and returns its user.
+func (m *EmailManager) consume(ctx context.Context, token, purpose string) (*User, error) {
+	now := m.now()
+
+	claims, err := m.keys.Verify(ctx, token, purpose, now)
+	if errors.Is(err, authpkg.ErrInvalidToken) {
+		return nil, ErrInvalidEmailToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify email token: %w", err)
+	}
+
+	id, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, ErrInvalidEmailToken
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, ErrInvalidEmailToken
+	}
+
+	used, err := m.tokens.Use(ctx, id, now)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use email token: %w", err)
+	}
+	if !used {
+		return nil, ErrInvalidEmailToken
+	}
+
+	user, err := m.users.Get(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find user: %w", err)
+	}
+	if user == nil {
+		return nil, ErrInvalidEmailToken
+	}
+	return user, nil
+}
+
+// send renders the named mail template for the user and sends it.
+func (m *EmailManager) send(ctx context.Context, user *User, name string, data any) error {
+	email, err := m.pii.OpenEmail(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	msg, err := m.composer.Compose(name, email, data)
+	if err != nil {
+		return fmt.Errorf("cannot compose %s mail: %w", name, err)
+	}
+
+	if err := m.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("cannot send %s mail: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Email token purposes. They are also the audience of the signed token, so a
+// token issued for one flow is rejected by the other.
+const (
+	EmailTokenVerify        = "email_verify"
+	EmailTokenPasswordReset = "password_reset"
+)
+
+// EmailToken records a token sent by email so it can be used only once.
+// The token itself is signed and never stored.
+type EmailToken struct {
+	ID        uuid.UUID  `json:"id" db:"id" bson:"_id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id" bson:"user_id"`
+	Purpose   string     `json:"purpose" db:"purpose" bson:"purpose"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at" bson:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at" bson:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at" bson:"used_at,omitempty"`
+}
+
+// EmailTokenRepo persists email tokens.
+type EmailTokenRepo interface {
+	// Create stores a new EmailToken.
+	Create(ctx context.Context, token *EmailToken) error
+
+	// Use marks an unused token that has not expired at at as used, and
+	// reports whether it did.
+	Use(ctx context.Context, id uuid.UUID, at time.Time) (bool, error)
+
+	// UseAll marks every unused token of a user for purpose as used.
+	UseAll(ctx context.Context, userID uuid.UUID, purpose string, at time.Time) error
+}
@@ -0,0 +1,635 @@
+package authn
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/pkg/lib/core"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+// FederationStateAudience is the audience of the tokens that carry the
+// state of a federated sign in while the user is at the provider.
+const FederationStateAudience = "federation_state"
+
+const (
+	defaultFederationStateTTL = 10 * time.Minute
+	// federationNonceSize is the size in bytes of the state and nonce values.
+	federationNonceSize = 24
+	// idTokenLeeway tolerates clock skew with providers.
+	idTokenLeeway = time.Minute
+	// providerKeysTTL is how long a provider key set is used before it is
+	// fetched again.
+	providerKeysTTL = time.Hour
+	// minProviderKeysRefetch limits refetches triggered by unknown kids.
+	minProviderKeysRefetch = 10 * time.Second
+	// maxProviderResponseBytes bounds the documents read from providers.
+	maxProviderResponseBytes = 1 << 20
+)
+
+var (
+	// ErrUnknownProvider is returned for provider IDs that are not configured.
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	// ErrInvalidFederationState is returned for callbacks whose state is
+	// missing, expired, or not the one the sign in started with.
+	ErrInvalidFederationState = errors.New("invalid federation state")
+	// ErrProviderUnavailable is returned when a provider cannot be reached or
+	// answers with an error.
+	ErrProviderUnavailable = errors.New("identity provider unavailable")
+	// ErrInvalidIDToken is returned for provider ID tokens that fail
+	// verification.
+	ErrInvalidIDToken = errors.New("invalid id token")
+	// ErrFederatedEmailUnverified is returned when a provider signs in a
+	// subject that is not linked yet without vouching for its email.
+	ErrFederatedEmailUnverified = errors.New("email not verified by identity provider")
+	// ErrFederatedUserNotFound is returned when no user has the email of a
+	// new subject and the provider does not provision users.
+	ErrFederatedUserNotFound = errors.New("no user for federated identity")
+)
+
+var providerIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// FederatedClaims are the ID token claims authn reads from upstream
+// providers.
+type FederatedClaims struct {
+	Issuer          string      `json:"iss"`
+	Subject         string      `json:"sub"`
+	Audience        jwtAudience `json:"aud"`
+	AuthorizedParty string      `json:"azp,omitempty"`
+	ExpiresAt       int64       `json:"exp"`
+	IssuedAt        int64       `json:"iat"`
+	Nonce           string      `json:"nonce"`
+	Email           string      `json:"email"`
+	EmailVerified   jwtBool     `json:"email_verified"`
+	Name            string      `json:"name,omitempty"`
+}
+
+// jwtAudience is an aud claim, a single string or a list of them.
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("invalid audience: %w", err)
+	}
+	*a = list
+	return nil
+}
+
+// jwtBool is a boolean claim. Some providers send email_verified as the
+// string "true".
+type jwtBool bool
+
+func (b *jwtBool) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		*b = jwtBool(v)
+	case string:
+		*b = jwtBool(v == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// providerMetadata is the part of a provider discovery document authn uses.
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// FederatedProvider is an upstream OpenID Connect provider users sign in
+// with through the authorization code flow with PKCE. Its discovery document
+// is fetched on first use and its keys are cached, refetched when an ID
+// token names an unknown kid.
+type FederatedProvider struct {
+	cfg         config.FederatedProviderConfig
+	issuer      string
+	scopes      []string
+	redirectURI string
+	client      *http.Client
+	now         func() time.Time
+
+	mu            sync.Mutex
+	metadata      *providerMetadata
+	keys          authpkg.JWKSet
+	keysFetchedAt time.Time
+}
+
+// ID returns the provider ID used in federation URLs and identity links.
+func (p *FederatedProvider) ID() string {
+	return p.cfg.ID
+}
+
+// Name returns the provider name shown to users.
+func (p *FederatedProvider) Name() string {
+	if p.cfg.Name == "" {
+		return p.cfg.ID
+	}
+	return p.cfg.Name
+}
+
+// RedirectURI returns the callback URL registered with the provider.
+func (p *FederatedProvider) RedirectURI() string {
+	return p.redirectURI
+}
+
+// AuthURL returns the authorization endpoint URL the user is sent to.
+func (p *FederatedProvider) AuthURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.redirectURI)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", authpkg.PKCEMethodS256)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code at the provider and returns the
+// verified claims of its ID token, which must carry nonce.
+func (p *FederatedProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*FederatedClaims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURI)
+	form.Set("code_verifier", codeVerifier)
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot redeem code: %v", ErrProviderUnavailable, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: cannot redeem code: status %d: %s %s", ErrProviderUnavailable, status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response without id_token", ErrInvalidIDToken)
+	}
+
+	return p.verifyIDToken(ctx, metadata, tokens.IDToken, nonce)
+}
+
+// verifyIDToken checks the signature and claims of an ID token issued to
+// authn for the sign in that sent nonce.
+func (p *FederatedProvider) verifyIDToken(ctx context.Context, metadata *providerMetadata, token, nonce string) (*FederatedClaims, error) {
+	header, err := authpkg.ParseJWTHeader(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	key, err := p.key(ctx, metadata, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims FederatedClaims
+	if err := authpkg.VerifyJWTWithJWK(token, key, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	now := p.now()
+	switch {
+	case claims.Issuer != metadata.Issuer:
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidIDToken, claims.Issuer)
+	case !slices.Contains(claims.Audience, p.cfg.ClientID):
+		return nil, fmt.Errorf("%w: audience %v", ErrInvalidIDToken, claims.Audience)
+	case claims.AuthorizedParty != "" && claims.AuthorizedParty != p.cfg.ClientID,
+		len(claims.Audience) > 1 && claims.AuthorizedParty == "":
+		return nil, fmt.Errorf("%w: authorized party %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(idTokenLeeway)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(idTokenLeeway)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// discover returns the provider metadata, fetching it on first use. A
+// document for another issuer is rejected, as OpenID Connect Discovery
+// requires.
+func (p *FederatedProvider) discover(ctx context.Context) (*providerMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create discovery request: %w", err)
+	}
+
+	var metadata providerMetadata
+	status, err := p.doJSON(req, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot fetch discovery document: %v", ErrProviderUnavailable, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: cannot fetch discovery document: status %d", ErrProviderUnavailable, status)
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("%w: discovery document of issuer %q, want %q", ErrProviderUnavailable, metadata.Issuer, p.issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document without authorization, token or jwks endpoint", ErrProviderUnavailable)
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// key returns the provider key named kid. Tokens without a kid are accepted
+// when the provider publishes a single key.
+func (p *FederatedProvider) key(ctx context.Context, metadata *providerMetadata, kid string) (authpkg.JWK, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	fresh := p.keys.Keys != nil && now.Sub(p.keysFetchedAt) < providerKeysTTL
+	if key, ok := p.lookupKey(kid); ok && fresh {
+		return key, nil
+	}
+
+	if !fresh || now.Sub(p.keysFetchedAt) >= minProviderKeysRefetch {
+		if err := p.fetchKeys(ctx, metadata); err != nil && p.keys.Keys == nil {
+			return authpkg.JWK{}, err
+		}
+	}
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return authpkg.JWK{}, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, kid)
+}
+
+// lookupKey finds kid in the cached key set. The caller holds the lock.
+func (p *FederatedProvider) lookupKey(kid string) (authpkg.JWK, bool) {
+	if kid == "" {
+		if len(p.keys.Keys) == 1 {
+			return p.keys.Keys[0], true
+		}
+		return authpkg.JWK{}, false
+	}
+	return p.keys.Key(kid)
+}
+
+// fetchKeys replaces the cached key set. The caller holds the lock.
+func (p *FederatedProvider) fetchKeys(ctx context.Context, metadata *providerMetadata) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create keys request: %w", err)
+	}
+
+	var keys authpkg.JWKSet
+	status, err := p.doJSON(req, &keys)
+	if err != nil {
+		return fmt.Errorf("%w: cannot fetch provider keys: %v", ErrProviderUnavailable, err)
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: cannot fetch provider keys: status %d", ErrProviderUnavailable, status)
+	}
+
+	p.keys = keys
+	p.keysFetchedAt = p.now()
+	return nil
+}
+
+// doJSON sends req and decodes the JSON body of the response into out,
+// whatever its status.
+func (p *FederatedProvider) doJSON(req *http.Request, out any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponseBytes))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, out); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("cannot decode response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// Federation signs users in with upstream OpenID Connect providers and links
+// them to local users: by the provider subject once linked, and the first
+// time by the verified email, through its lookup hash. Providers with
+// provision enabled create the users authn does not know.
+type Federation struct {
+	providers  map[string]*FederatedProvider
+	ordered    []*FederatedProvider
+	identities FederatedIdentityRepo
+	users      UserRepo
+	pii        *PIIKeyring
+	keys       *Keyring
+	stateTTL   time.Duration
+	log        core.Logger
+	now        func() time.Time
+}
+
+// NewFederation creates a Federation for the providers of the federation
+// config section.
+func NewFederation(identities FederatedIdentityRepo, users UserRepo, pii *PIIKeyring, keys *Keyring, xparams config.XParams) (*Federation, error) {
+	cfg := xparams.Cfg.Federation
+
+	callbackURL := strings.TrimSuffix(cfg.CallbackURL, "/")
+	if u, err := url.Parse(callbackURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid federation callback URL %q", cfg.CallbackURL)
+	}
+
+	stateTTL, err := parseKeyDuration(cfg.StateTTL, defaultFederationStateTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid federation state TTL: %w", err)
+	}
+
+	f := &Federation{
+		providers:  make(map[string]*FederatedProvider, len(cfg.Providers)),
+		identities: identities,
+		users:      users,
+		pii:        pii,
+		keys:       keys,
+		stateTTL:   stateTTL,
+		log:        xparams.Log,
+		now:        time.Now,
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, pc := range cfg.Providers {
+		provider, err := newFederatedProvider(pc, callbackURL, client)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := f.providers[provider.ID()]; ok {
+			return nil, fmt.Errorf("duplicate federated provider %q", provider.ID())
+		}
+		provider.now = func() time.Time { return f.now() }
+		f.providers[provider.ID()] = provider
+		f.ordered = append(f.ordered, provider)
+	}
+
+	return f, nil
+}
+
+func newFederatedProvider(cfg config.FederatedProviderConfig, callbackURL string, client *http.Client) (*FederatedProvider, error) {
+	if !providerIDPattern.MatchString(cfg.ID) {
+		return nil, fmt.Errorf("invalid federated provider id %q", cfg.ID)
+	}
+
+	issuer := strings.TrimSuffix(cfg.Issuer, "/")
+	if u, err := url.Parse(issuer); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid issuer %q of federated provider %s", cfg.Issuer, cfg.ID)
+	}
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("federated provider %s has no client id", cfg.ID)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{ScopeOpenID, ScopeEmail, "profile"}
+	}
+	if !slices.Contains(scopes, ScopeOpenID) {
+		scopes = append([]string{ScopeOpenID}, scopes...)
+	}
+
+	return &FederatedProvider{
+		cfg:         cfg,
+		issuer:      issuer,
+		scopes:      scopes,
+		redirectURI: callbackURL + "/authn/federation/" + cfg.ID + "/callback",
+		client:      client,
+		now:         time.Now,
+	}, nil
+}
+
+// Providers returns the configured providers in config order.
+func (f *Federation) Providers() []*FederatedProvider {
+	return f.ordered
+}
+
+// Provider returns the provider with the given ID.
+func (f *Federation) Provider(id string) (*FederatedProvider, error) {
+	provider, ok := f.providers[id]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// Begin starts a sign in with a provider. It returns the URL to send the
+// user to and a signed state token, kept by the user agent until the
+// callback, that holds the state, nonce and PKCE verifier of the sign in.
+func (f *Federation) Begin(ctx context.Context, providerID string) (authURL, stateToken string, expiresAt time.Time, err error) {
+	provider, err := f.Provider(providerID)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	state := randomFederationValue()
+	nonce := randomFederationValue()
+	verifier := authpkg.GeneratePKCEVerifier()
+
+	authURL, err = provider.AuthURL(ctx, state, nonce, authpkg.PKCEChallenge(verifier))
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	claims := claimsAt(provider.ID(), state, FederationStateAudience, f.stateTTL, f.now())
+	claims.Context = map[string]string{"nonce": nonce, "code_verifier": verifier}
+
+	stateToken, err = f.keys.Sign(claims)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("could not sign federation state: %w", err)
+	}
+	return authURL, stateToken, time.Unix(claims.ExpiresAt, 0), nil
+}
+
+// Complete finishes a sign in at the callback of a provider: it checks the
+// returned state against the state token, redeems the code and returns the
+// linked user. Errors other than the federation ones are unexpected.
+func (f *Federation) Complete(ctx context.Context, providerID, stateToken, state, code string) (*User, error) {
+	provider, err := f.Provider(providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := f.keys.Verify(ctx, stateToken, FederationStateAudience, f.now())
+	if errors.Is(err, authpkg.ErrInvalidToken) {
+		return nil, ErrInvalidFederationState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify federation state: %w", err)
+	}
+	if claims.Subject != provider.ID() || state == "" || subtle.ConstantTimeCompare([]byte(claims.SessionID), []byte(state)) != 1 {
+		return nil, ErrInvalidFederationState
+	}
+
+	federated, err := provider.Exchange(ctx, code, claims.Context["code_verifier"], claims.Context["nonce"])
+	if err != nil {
+		return nil, err
+	}
+
+	return f.link(ctx, provider, federated)
+}
+
+// link returns the user of a provider subject, linking the subject on its
+// first sign in to the user with its verified email, or to a new user when
+// the provider provisions them.
+func (f *Federation) link(ctx context.Context, provider *FederatedProvider, claims *FederatedClaims) (*User, error) {
+	now := f.now()
+
+	identity, err := f.identities.Find(ctx, provider.ID(), claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find federated identity: %w", err)
+	}
+	if identity != nil {
+		user, err := f.users.Get(ctx, identity.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get user: %w", err)
+		}
+		if user == nil {
+			return nil, ErrFederatedUserNotFound
+		}
+		if err := f.identities.Touch(ctx, identity.ID, now); err != nil {
+			f.log.Error("cannot record federated identity use", "error", err, "identity_id", identity.ID)
+		}
+		return user, nil
+	}
+
+	// Linking by email trusts the provider for it, so only emails it
+	// verified are considered
+	email := authpkg.NormalizeEmail(claims.Email)
+	if email == "" || !bool(claims.EmailVerified) {
+		return nil, ErrFederatedEmailUnverified
+	}
+
+	user, err := f.pii.FindUser(ctx, f.users, email)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find user: %w", err)
+	}
+
+	switch {
+	case user != nil:
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &now
+			user.BeforeUpdate()
+			if err := f.users.Save(ctx, user); err != nil {
+				return nil, fmt.Errorf("cannot save user: %w", err)
+			}
+		}
+
+	case provider.cfg.Provision:
+		user, err = f.provision(ctx, email, now)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, ErrFederatedUserNotFound
+	}
+
+	identity = &FederatedIdentity{
+		ID:         core.GenerateNewID(),
+		ProviderID: provider.ID(),
+		Subject:    claims.Subject,
+		UserID:     user.ID,
+		CreatedAt:  now,
+		LastUsedAt: &now,
+	}
+	if err := f.identities.Create(ctx, identity); err != nil {
+		return nil, fmt.Errorf("cannot link federated identity: %w", err)
+	}
+
+	f.log.Info("federated identity linked", "provider", provider.ID(), "user_id", user.ID)
+	return user, nil
+}
+
+// provision creates a user for a provider email. It has no password, so it
+// signs in through providers or after a password reset.
+func (f *Federation) provision(ctx context.Context, email string, now time.Time) (*User, error) {
+	user := NewUser()
+	if err := f.pii.SealEmail(ctx, user, email); err != nil {
+		return nil, fmt.Errorf("cannot encrypt email: %w", err)
+	}
+	user.PasswordHash, user.PasswordSalt = []byte{}, []byte{}
+	user.EmailVerifiedAt = &now
+	user.BeforeCreate()
+
+	if err := f.users.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("cannot create user: %w", err)
+	}
+	return user, nil
+}
+
+func randomFederationValue() string {
+	return base64.RawURLEncoding.EncodeToString(authpkg.GenerateRandomBytes(federationNonceSize))
+}
@@ -0,0 +1,696 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+type mockFederatedIdentityRepo struct {
+	mu         sync.Mutex
+	identities map[uuid.UUID]FederatedIdentity
+}
+
+func newMockFederatedIdentityRepo() *mockFederatedIdentityRepo {
+	return &mockFederatedIdentityRepo{identities: make(map[uuid.UUID]FederatedIdentity)}
+}
+
+func (m *mockFederatedIdentityRepo) Create(ctx context.Context, identity *FederatedIdentity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.identities {
+		if existing.ProviderID == identity.ProviderID && existing.Subject == identity.Subject {
+			return fmt.Errorf("duplicate federated identity")
+		}
+	}
+	m.identities[identity.ID] = *identity
+	return nil
+}
+
+func (m *mockFederatedIdentityRepo) Find(ctx context.Context, providerID, subject string) (*FederatedIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, identity := range m.identities {
+		if identity.ProviderID == providerID && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockFederatedIdentityRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]*FederatedIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var identities []*FederatedIdentity
+	for _, identity := range m.identities {
+		if identity.UserID == userID {
+			identity := identity
+			identities = append(identities, &identity)
+		}
+	}
+	return identities, nil
+}
+
+func (m *mockFederatedIdentityRepo) Touch(ctx context.Context, id uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if identity, ok := m.identities[id]; ok {
+		identity.LastUsedAt = &at
+		m.identities[id] = identity
+	}
+	return nil
+}
+
+func (m *mockFederatedIdentityRepo) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, identity := range m.identities {
+		if identity.UserID == userID {
+			delete(m.identities, id)
+		}
+	}
+	return nil
+}
+
+const (
+	testIdPClientID     = "hatmax-test"
+	testIdPClientSecret = "idp-secret"
+)
+
+// idpUser is the account a user signs in with at the mock provider.
+type idpUser struct {
+	Subject       string
+	Email         string
+	EmailVerified any
+}
+
+// idpGrant is an authorization code issued by the mock provider.
+type idpGrant struct {
+	redirectURI string
+	challenge   string
+	nonce       string
+	user        idpUser
+}
+
+// mockIdP is an upstream OpenID provider on httptest. It signs ID tokens
+// with RS256, checks PKCE and client credentials at its token endpoint and
+// lets tests override the claims of the next ID token.
+type mockIdP struct {
+	t   *testing.T
+	srv *httptest.Server
+	now func() time.Time
+
+	mu         sync.Mutex
+	key        *rsa.PrivateKey
+	kid        string
+	codes      map[string]idpGrant
+	overrides  map[string]any
+	keyFetches int
+	down       bool
+}
+
+func newMockIdP(t *testing.T, now func() time.Time) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+
+	idp := &mockIdP{t: t, now: now, key: key, kid: "idp-key-1", codes: make(map[string]idpGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+
+	return idp
+}
+
+func (p *mockIdP) available(w http.ResponseWriter) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+func (p *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	if !p.available(w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                 p.srv.URL,
+		"authorization_endpoint": p.srv.URL + "/authorize",
+		"token_endpoint":         p.srv.URL + "/token",
+		"jwks_uri":               p.srv.URL + "/jwks",
+	})
+}
+
+func (p *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	if !p.available(w) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keyFetches++
+	writeJSON(w, http.StatusOK, authpkg.JWKSet{Keys: []authpkg.JWK{{
+		KeyType:   "RSA",
+		N:         base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		KeyID:     p.kid,
+		Use:       "sig",
+		Algorithm: authpkg.JWTAlgorithmRS256,
+	}}})
+}
+
+// authorize plays the user signing in at the provider: it checks the
+// authorization request and returns the redirect back to authn.
+func (p *mockIdP) authorize(authURL string, user idpUser) string {
+	p.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil || u.Host != strings.TrimPrefix(p.srv.URL, "http://") || u.Path != "/authorize" {
+		p.t.Fatalf("redirect to %q, want the provider authorization endpoint", authURL)
+	}
+
+	query := u.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != testIdPClientID ||
+		query.Get("code_challenge_method") != authpkg.PKCEMethodS256 || query.Get("code_challenge") == "" ||
+		query.Get("nonce") == "" || query.Get("state") == "" || !strings.Contains(query.Get("scope"), "openid") {
+		p.t.Fatalf("authorization request = %v", query)
+	}
+
+	code := uuid.NewString()
+	p.mu.Lock()
+	p.codes[code] = idpGrant{
+		redirectURI: query.Get("redirect_uri"),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		user:        user,
+	}
+	p.mu.Unlock()
+
+	callback, _ := url.Parse(query.Get("redirect_uri"))
+	callback.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	return callback.String()
+}
+
+func (p *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if !p.available(w) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad form", http.StatusBadRequest)
+		return
+	}
+
+	// Confidential clients authenticate with basic auth, public ones send
+	// their client_id
+	id, secret, ok := r.BasicAuth()
+	if ok && (id != testIdPClientID || secret != testIdPClientSecret) || !ok && r.PostForm.Get("client_id") != testIdPClientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	grant, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	overrides := p.overrides
+	p.overrides = nil
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+
+	if r.PostForm.Get("grant_type") != "authorization_code" || !found ||
+		grant.redirectURI != r.PostForm.Get("redirect_uri") ||
+		!authpkg.VerifyPKCE(r.PostForm.Get("code_verifier"), grant.challenge, authpkg.PKCEMethodS256) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := p.now()
+	claims := map[string]any{
+		"iss":            p.srv.URL,
+		"sub":            grant.user.Subject,
+		"aud":            testIdPClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          grant.nonce,
+		"email":          grant.user.Email,
+		"email_verified": grant.user.EmailVerified,
+	}
+	for name, value := range overrides {
+		claims[name] = value
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "upstream-access-token",
+		"token_type":   "Bearer",
+		"id_token":     signRS256(p.t, claims, key, kid),
+	})
+}
+
+// override sets claims of the next ID token.
+func (p *mockIdP) override(claims map[string]any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.overrides = claims
+}
+
+// rotate replaces the signing key with a new one under a new kid.
+func (p *mockIdP) rotate() {
+	p.t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		p.t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key, p.kid = key, p.kid+"-next"
+}
+
+func signRS256(t *testing.T, claims any, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+	header, _ := json.Marshal(authpkg.JWTHeader{Algorithm: authpkg.JWTAlgorithmRS256, Type: "JWT", KeyID: kid})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("rsa.SignPKCS1v15() error = %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// federationTest signs users in through authn and the mock provider as
+// their browser would, following redirects by hand.
+type federationTest struct {
+	t          *testing.T
+	srv        *httptest.Server
+	http       *http.Client
+	idp        *mockIdP
+	handler    *AuthHandler
+	repo       *mockUserRepo
+	identities *mockFederatedIdentityRepo
+	clock      *fixedClock
+	user       *User
+}
+
+func setupFederation(t *testing.T) *federationTest {
+	t.Helper()
+	handler, repo, clock, user := setupMFA(t)
+	idp := newMockIdP(t, clock.now)
+
+	router := chi.NewRouter()
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	xparams := handler.xparams
+	xparams.Cfg.Federation = config.FederationConfig{
+		CallbackURL: srv.URL,
+		Providers: []config.FederatedProviderConfig{
+			{ID: "corp", Name: "Corporate SSO", Issuer: idp.srv.URL, ClientID: testIdPClientID, ClientSecret: testIdPClientSecret},
+			{ID: "jit", Issuer: idp.srv.URL + "/", ClientID: testIdPClientID, Provision: true},
+		},
+	}
+
+	identities := newMockFederatedIdentityRepo()
+	federation, err := NewFederation(identities, repo, handler.pii, handler.sessions.keys, xparams)
+	if err != nil {
+		t.Fatalf("NewFederation() error = %v", err)
+	}
+	federation.now = clock.now
+
+	handler.RegisterRoutes(router)
+	NewFederationHandler(federation, handler, xparams).RegisterRoutes(router)
+
+	return &federationTest{
+		t:          t,
+		srv:        srv,
+		http:       &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }},
+		idp:        idp,
+		handler:    handler,
+		repo:       repo,
+		identities: identities,
+		clock:      clock,
+		user:       user,
+	}
+}
+
+func (f *federationTest) get(rawURL string, cookies ...*http.Cookie) (*http.Response, []byte) {
+	f.t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, rawURL, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	resp, err := f.http.Do(req)
+	if err != nil {
+		f.t.Fatalf("GET %s error = %v", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		f.t.Fatalf("cannot read response: %v", err)
+	}
+	return resp, body
+}
+
+// begin starts a sign in with a provider and returns the provider URL and
+// the state cookie.
+func (f *federationTest) begin(providerID string) (string, *http.Cookie) {
+	f.t.Helper()
+	resp, body := f.get(f.srv.URL + "/authn/federation/" + providerID)
+	if resp.StatusCode != http.StatusFound {
+		f.t.Fatalf("begin status = %d, body = %s", resp.StatusCode, body)
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == FederationStateCookie {
+			if !cookie.HttpOnly || cookie.Path != "/authn/federation/"+providerID {
+				f.t.Errorf("state cookie = %+v, want HttpOnly on the provider path", cookie)
+			}
+			return resp.Header.Get("Location"), cookie
+		}
+	}
+	f.t.Fatal("begin did not set the state cookie")
+	return "", nil
+}
+
+// signIn runs a whole federated sign in and returns the callback response.
+func (f *federationTest) signIn(providerID string, user idpUser) (int, AuthResponse, []byte) {
+	f.t.Helper()
+	authURL, cookie := f.begin(providerID)
+	resp, body := f.get(f.idp.authorize(authURL, user), cookie)
+
+	var out struct {
+		Data AuthResponse `json:"data"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(body, &out); err != nil {
+			f.t.Fatalf("cannot decode sign in: %v", err)
+		}
+	}
+	return resp.StatusCode, out.Data, body
+}
+
+func TestFederatedSignInLinksByEmail(t *testing.T) {
+	f := setupFederation(t)
+
+	code, auth, body := f.signIn("corp", idpUser{Subject: "corp-123", Email: "Test@Example.com", EmailVerified: true})
+	if code != http.StatusOK || auth.Token == "" || auth.RefreshToken == "" {
+		t.Fatalf("sign in = %d %s, want a session", code, body)
+	}
+	if auth.User == nil || auth.User.ID != f.user.ID {
+		t.Errorf("signed in user = %+v, want the user with the email", auth.User)
+	}
+	if _, _, err := f.handler.sessions.Authenticate(context.Background(), auth.Token); err != nil {
+		t.Errorf("access token does not authenticate: %v", err)
+	}
+
+	identity, _ := f.identities.Find(context.Background(), "corp", "corp-123")
+	if identity == nil || identity.UserID != f.user.ID {
+		t.Fatalf("identity = %+v, want a link to the user", identity)
+	}
+	if f.repo.users[f.user.ID].EmailVerifiedAt == nil {
+		t.Error("linking did not mark the email verified")
+	}
+
+	// Once linked, the subject signs in whatever its email at the provider
+	code, auth, body = f.signIn("corp", idpUser{Subject: "corp-123", Email: "renamed@example.com"})
+	if code != http.StatusOK || auth.User == nil || auth.User.ID != f.user.ID {
+		t.Errorf("linked sign in = %d %s, want the linked user", code, body)
+	}
+	if len(f.identities.identities) != 1 {
+		t.Errorf("identities = %d, want 1", len(f.identities.identities))
+	}
+
+	// Providers are linked separately
+	if code, _, body := f.signIn("jit", idpUser{Subject: "corp-123", Email: "test@example.com", EmailVerified: "true"}); code != http.StatusOK {
+		t.Errorf("sign in with a second provider = %d %s", code, body)
+	}
+	if identities, _ := f.identities.ListByUser(context.Background(), f.user.ID); len(identities) != 2 {
+		t.Errorf("identities of user = %d, want 2", len(identities))
+	}
+}
+
+func TestFederatedSignInProvisioning(t *testing.T) {
+	f := setupFederation(t)
+
+	if code, _, _ := f.signIn("corp", idpUser{Subject: "corp-new", Email: "new@example.com", EmailVerified: true}); code != http.StatusForbidden {
+		t.Errorf("unknown user without provisioning = %d, want %d", code, http.StatusForbidden)
+	}
+
+	code, auth, body := f.signIn("jit", idpUser{Subject: "jit-new", Email: "New@Example.com", EmailVerified: true})
+	if code != http.StatusOK || auth.User == nil {
+		t.Fatalf("provisioning sign in = %d %s", code, body)
+	}
+
+	created := f.repo.users[auth.User.ID]
+	if created == nil || created.EmailVerifiedAt == nil || created.Status != authpkg.UserStatusActive {
+		t.Fatalf("provisioned user = %+v, want an active user with a verified email", created)
+	}
+	if email, err := f.handler.pii.OpenEmail(context.Background(), created); err != nil || email != "new@example.com" {
+		t.Errorf("provisioned email = %q, %v", email, err)
+	}
+
+	// The provisioned user has no password to sign in with
+	req := httptest.NewRequest(http.MethodPost, "/authn/signin", strings.NewReader(`{"email":"new@example.com","password":"ValidPassword123!"}`))
+	rr := httptest.NewRecorder()
+	f.handler.SignIn(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("password sign in of a provisioned user = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	// An email the provider did not verify is neither linked nor provisioned
+	for _, verified := range []any{false, "false", nil} {
+		if code, _, _ := f.signIn("jit", idpUser{Subject: "jit-unverified", Email: "test@example.com", EmailVerified: verified}); code != http.StatusForbidden {
+			t.Errorf("email_verified %v = %d, want %d", verified, code, http.StatusForbidden)
+		}
+	}
+	if identity, _ := f.identities.Find(context.Background(), "jit", "jit-unverified"); identity != nil {
+		t.Error("unverified email was linked")
+	}
+}
+
+func TestFederatedSignInWithMFA(t *testing.T) {
+	f := setupFederation(t)
+	secret, _ := enableMFA(t, f.handler.mfa, f.user, f.clock.now())
+
+	code, auth, body := f.signIn("corp", idpUser{Subject: "corp-123", Email: "test@example.com", EmailVerified: true})
+	if code != http.StatusOK || !auth.MFARequired || auth.MFAToken == "" || auth.Token != "" {
+		t.Fatalf("sign in with MFA = %d %s, want an mfa_pending token", code, body)
+	}
+
+	f.clock.advance(30 * time.Second)
+	payload, _ := json.Marshal(SignInMFARequest{MFAToken: auth.MFAToken, Code: authpkg.TOTPCode(secret, f.clock.now())})
+	req := httptest.NewRequest(http.MethodPost, "/authn/signin/mfa", strings.NewReader(string(payload)))
+	rr := httptest.NewRecorder()
+	f.handler.SignInMFA(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("SignInMFA() status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestFederatedSignInRejects(t *testing.T) {
+	f := setupFederation(t)
+	user := idpUser{Subject: "corp-123", Email: "test@example.com", EmailVerified: true}
+
+	t.Run("unknown provider", func(t *testing.T) {
+		if resp, _ := f.get(f.srv.URL + "/authn/federation/other"); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+		}
+	})
+
+	t.Run("tampered state", func(t *testing.T) {
+		authURL, cookie := f.begin("corp")
+		callback, _ := url.Parse(f.idp.authorize(authURL, user))
+		query := callback.Query()
+		query.Set("state", "forged")
+		callback.RawQuery = query.Encode()
+
+		if resp, _ := f.get(callback.String(), cookie); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("missing state cookie", func(t *testing.T) {
+		authURL, _ := f.begin("corp")
+		if resp, _ := f.get(f.idp.authorize(authURL, user)); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("state of another provider", func(t *testing.T) {
+		authURL, cookie := f.begin("jit")
+		callback := strings.Replace(f.idp.authorize(authURL, user), "/jit/", "/corp/", 1)
+		if resp, _ := f.get(callback, cookie); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("expired state", func(t *testing.T) {
+		authURL, cookie := f.begin("corp")
+		f.clock.advance(11 * time.Minute)
+		defer f.clock.advance(-11 * time.Minute)
+		if resp, _ := f.get(f.idp.authorize(authURL, user), cookie); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("error from provider", func(t *testing.T) {
+		_, cookie := f.begin("corp")
+		if resp, _ := f.get(f.srv.URL+"/authn/federation/corp/callback?error=access_denied", cookie); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+	})
+
+	claims := []struct {
+		name   string
+		claims map[string]any
+	}{
+		{"other nonce", map[string]any{"nonce": "other"}},
+		{"other audience", map[string]any{"aud": "other-client"}},
+		{"other issuer", map[string]any{"iss": "https://evil.example.com"}},
+		{"expired", map[string]any{"exp": f.clock.now().Add(-2 * time.Minute).Unix()}},
+		{"multiple audiences without azp", map[string]any{"aud": []string{testIdPClientID, "other-client"}}},
+		{"no subject", map[string]any{"sub": ""}},
+	}
+	for _, tt := range claims {
+		t.Run(tt.name, func(t *testing.T) {
+			f.idp.override(tt.claims)
+			if code, _, body := f.signIn("corp", user); code != http.StatusUnauthorized {
+				t.Errorf("status = %d, body = %s, want %d", code, body, http.StatusUnauthorized)
+			}
+		})
+	}
+
+	t.Run("suspended user", func(t *testing.T) {
+		f.repo.users[f.user.ID].Status = authpkg.UserStatusSuspended
+		defer func() { f.repo.users[f.user.ID].Status = authpkg.UserStatusActive }()
+		if code, _, _ := f.signIn("corp", user); code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("provider down", func(t *testing.T) {
+		authURL, cookie := f.begin("corp")
+		callback := f.idp.authorize(authURL, user)
+		f.idp.mu.Lock()
+		f.idp.down = true
+		f.idp.mu.Unlock()
+		defer func() {
+			f.idp.mu.Lock()
+			f.idp.down = false
+			f.idp.mu.Unlock()
+		}()
+
+		if resp, _ := f.get(callback, cookie); resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+		}
+	})
+
+	if code, _, body := f.signIn("corp", user); code != http.StatusOK {
+		t.Errorf("sign in after the rejections = %d %s", code, body)
+	}
+}
+
+func TestFederatedProviderKeyRotation(t *testing.T) {
+	f := setupFederation(t)
+	user := idpUser{Subject: "corp-123", Email: "test@example.com", EmailVerified: true}
+
+	if code, _, body := f.signIn("corp", user); code != http.StatusOK {
+		t.Fatalf("sign in = %d %s", code, body)
+	}
+
+	// A token under a new kid refetches the keys, but not more often than
+	// minProviderKeysRefetch
+	f.idp.rotate()
+	if code, _, _ := f.signIn("corp", user); code != http.StatusUnauthorized {
+		t.Errorf("sign in right after rotation = %d, want %d", code, http.StatusUnauthorized)
+	}
+	f.clock.advance(minProviderKeysRefetch)
+	if code, _, body := f.signIn("corp", user); code != http.StatusOK {
+		t.Errorf("sign in after rotation = %d %s", code, body)
+	}
+	if f.idp.keyFetches != 2 {
+		t.Errorf("key fetches = %d, want 2", f.idp.keyFetches)
+	}
+}
+
+func TestFederationHandler_ListProviders(t *testing.T) {
+	f := setupFederation(t)
+
+	resp, body := f.get(f.srv.URL + "/authn/federation")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	var out struct {
+		Data []FederatedProviderInfo `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatalf("cannot decode providers: %v", err)
+	}
+	want := []FederatedProviderInfo{
+		{ID: "corp", Name: "Corporate SSO", SignInURL: "/authn/federation/corp"},
+		{ID: "jit", Name: "jit", SignInURL: "/authn/federation/jit"},
+	}
+	if fmt.Sprint(out.Data) != fmt.Sprint(want) {
+		t.Errorf("providers = %+v, want %+v", out.Data, want)
+	}
+}
+
+func TestNewFederationValidatesProviders(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.FederationConfig
+	}{
+		{"invalid callback url", config.FederationConfig{CallbackURL: "localhost"}},
+		{"invalid provider id", config.FederationConfig{CallbackURL: "https://auth.example.com", Providers: []config.FederatedProviderConfig{
+			{ID: "Corp SSO", Issuer: "https://sso.example.com", ClientID: "c"},
+		}}},
+		{"invalid issuer", config.FederationConfig{CallbackURL: "https://auth.example.com", Providers: []config.FederatedProviderConfig{
+			{ID: "corp", Issuer: "sso.example.com", ClientID: "c"},
+		}}},
+		{"no client id", config.FederationConfig{CallbackURL: "https://auth.example.com", Providers: []config.FederatedProviderConfig{
+			{ID: "corp", Issuer: "https://sso.example.com"},
+		}}},
+		{"duplicate id", config.FederationConfig{CallbackURL: "https://auth.example.com", Providers: []config.FederatedProviderConfig{
+			{ID: "corp", Issuer: "https://sso.example.com", ClientID: "c"},
+			{ID: "corp", Issuer: "https://other.example.com", ClientID: "c"},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xparams := config.XParams{Cfg: &config.Config{Federation: tt.cfg}}
+			if _, err := NewFederation(newMockFederatedIdentityRepo(), newMockUserRepo(), nil, nil, xparams); err == nil {
+				t.Error("NewFederation() error = nil")
+			}
+		})
+	}
+}
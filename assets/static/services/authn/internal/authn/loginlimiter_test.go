@@ -0,0 +1,243 @@
+package authn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/pkg/lib/core"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+type mockLoginAttemptRepo struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempt
+}
+
+func newMockLoginAttemptRepo() *mockLoginAttemptRepo {
+	return &mockLoginAttemptRepo{attempts: make(map[string]LoginAttempt)}
+}
+
+func (m *mockLoginAttemptRepo) Get(ctx context.Context, key string) (*LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempt, ok := m.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+func (m *mockLoginAttemptRepo) RecordFailure(ctx context.Context, key string, at, since time.Time) (*LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempt := m.attempts[key]
+	attempt.Key = key
+	if attempt.LastFailureAt.Before(since) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = at
+	m.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (m *mockLoginAttemptRepo) Lock(ctx context.Context, key string, limit int, until time.Time) (int, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempt, ok := m.attempts[key]
+	if !ok || attempt.Failures < limit {
+		return 0, false, nil
+	}
+	attempt.Failures = 0
+	attempt.Lockouts++
+	attempt.LockedUntil = until
+	m.attempts[key] = attempt
+	return attempt.Lockouts, true, nil
+}
+
+func (m *mockLoginAttemptRepo) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+func newTestLoginLimiter(t *testing.T, users UserRepo, auth config.AuthConfig) (*LoginLimiter, *fixedClock) {
+	t.Helper()
+	xparams := config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{Auth: auth}}
+
+	limiter, err := NewLoginLimiter(newMockLoginAttemptRepo(), users, xparams)
+	if err != nil {
+		t.Fatalf("NewLoginLimiter() error = %v", err)
+	}
+
+	clock := &fixedClock{t: time.Unix(1700000000, 0)}
+	limiter.now = clock.now
+	return limiter, clock
+}
+
+func TestNewLoginLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    config.AuthConfig
+		wantErr bool
+	}{
+		{"defaults", config.AuthConfig{}, false},
+		{"custom", config.AuthConfig{LoginMaxAttempts: 3, LoginWindow: "5m", LoginLockout: "30s", LoginMaxLockout: "10m"}, false},
+		{"invalid window", config.AuthConfig{LoginWindow: "soon"}, true},
+		{"invalid lockout", config.AuthConfig{LoginLockout: "-1m"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xparams := config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{Auth: tt.auth}}
+			_, err := NewLoginLimiter(newMockLoginAttemptRepo(), newMockUserRepo(), xparams)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLoginLimiter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoginLimiterLockoutBackoff(t *testing.T) {
+	limiter, clock := newTestLoginLimiter(t, newMockUserRepo(), config.AuthConfig{
+		LoginMaxAttempts:  3,
+		LoginLockout:      "1m",
+		LoginMaxLockout:   "3m",
+		LoginSuspendAfter: -1,
+	})
+	ctx := context.Background()
+	lookup := []byte("lookup")
+
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		for i := 0; i < 3; i++ {
+			if wait, _ := limiter.Check(ctx, lookup, "10.0.0.1"); wait != 0 {
+				t.Fatalf("Check() before the limit wait = %s, want 0", wait)
+			}
+			if err := limiter.Fail(ctx, nil, lookup, "10.0.0.1"); err != nil {
+				t.Fatalf("Fail() error = %v", err)
+			}
+		}
+
+		wait, err := limiter.Check(ctx, lookup, "10.0.0.2")
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		if wait != want {
+			t.Errorf("Check() wait = %s, want %s", wait, want)
+		}
+		clock.advance(wait)
+	}
+
+	if err := limiter.Succeed(ctx, lookup); err != nil {
+		t.Fatalf("Succeed() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		limiter.Fail(ctx, nil, lookup, "10.0.0.1")
+	}
+	if wait, _ := limiter.Check(ctx, lookup, "10.0.0.1"); wait != time.Minute {
+		t.Errorf("Check() after Succeed wait = %s, want the first lockout", wait)
+	}
+}
+
+func TestLoginLimiterWindow(t *testing.T) {
+	limiter, clock := newTestLoginLimiter(t, newMockUserRepo(), config.AuthConfig{
+		LoginMaxAttempts: 2,
+		LoginWindow:      "10m",
+	})
+	ctx := context.Background()
+	lookup := []byte("lookup")
+
+	limiter.Fail(ctx, nil, lookup, "10.0.0.1")
+	clock.advance(11 * time.Minute)
+	limiter.Fail(ctx, nil, lookup, "10.0.0.1")
+
+	if wait, _ := limiter.Check(ctx, lookup, "10.0.0.1"); wait != 0 {
+		t.Errorf("Check() wait = %s, want failures outside the window forgotten", wait)
+	}
+}
+
+func TestLoginLimiterIP(t *testing.T) {
+	limiter, _ := newTestLoginLimiter(t, newMockUserRepo(), config.AuthConfig{
+		LoginMaxAttempts:   10,
+		LoginIPMaxAttempts: 3,
+	})
+	ctx := context.Background()
+
+	for _, lookup := range []string{"a", "b", "c"} {
+		limiter.Fail(ctx, nil, []byte(lookup), "10.0.0.1")
+	}
+
+	if wait, _ := limiter.Check(ctx, []byte("d"), "10.0.0.1"); wait == 0 {
+		t.Error("Check() from a locked out IP wait = 0")
+	}
+	if wait, _ := limiter.Check(ctx, []byte("d"), "10.0.0.2"); wait != 0 {
+		t.Errorf("Check() from another IP wait = %s, want 0", wait)
+	}
+}
+
+func TestLoginLimiterSuspends(t *testing.T) {
+	users := newMockUserRepo()
+	user := NewUser()
+	user.Status = authpkg.UserStatusActive
+	users.users[user.ID] = user
+
+	limiter, clock := newTestLoginLimiter(t, users, config.AuthConfig{
+		LoginMaxAttempts:  1,
+		LoginSuspendAfter: 2,
+	})
+	ctx := context.Background()
+
+	limiter.Fail(ctx, user, []byte("lookup"), "10.0.0.1")
+	if user.Status != authpkg.UserStatusActive {
+		t.Fatalf("Status after one lockout = %s, want active", user.Status)
+	}
+
+	clock.advance(time.Hour)
+	limiter.Fail(ctx, user, []byte("lookup"), "10.0.0.1")
+
+	saved, _ := users.Get(ctx, user.ID)
+	if saved.Status != authpkg.UserStatusSuspended {
+		t.Errorf("Status after two lockouts = %s, want suspended", saved.Status)
+	}
+}
+
+func TestAuthHandler_SignInLockout(t *testing.T) {
+	handler, _, _, _ := setupMFA(t)
+
+	signIn := func(email, password string) *httptest.ResponseRecorder {
+		body := `{"email":"` + email + `","password":"` + password + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/authn/signin", strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.1:1234"
+		rr := httptest.NewRecorder()
+		handler.SignIn(rr, req)
+		return rr
+	}
+
+	for _, email := range []string{"test@example.com", "nobody@example.com"} {
+		for i := 0; i < defaultLoginMaxAttempts; i++ {
+			if rr := signIn(email, "WrongPassword123!"); rr.Code != http.StatusUnauthorized {
+				t.Fatalf("SignIn(%s) attempt %d status = %d, want %d", email, i+1, rr.Code, http.StatusUnauthorized)
+			}
+		}
+
+		rr := signIn(email, "ValidPassword123!")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("SignIn(%s) locked out status = %d, want %d", email, rr.Code, http.StatusTooManyRequests)
+		}
+		if rr.Header().Get("Retry-After") != "60" {
+			t.Errorf("SignIn(%s) Retry-After = %q, want 60", email, rr.Header().Get("Retry-After"))
+		}
+	}
+
+	handler.limiter.now = func() time.Time { return time.Now().Add(defaultLoginLockout) }
+	if rr := signIn("test@example.com", "ValidPassword123!"); rr.Code != http.StatusOK {
+		t.Errorf("SignIn() after the lockout status = %d, want %d", rr.Code, http.StatusOK)
+	}
+}
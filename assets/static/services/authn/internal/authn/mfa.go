@@ -0,0 +1,44 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MFARecord holds the TOTP state of a user besides the confirmed secret,
+// which lives encrypted in User.MFASecretCT. PendingDataKey, as
+// User.MFADataKey, tells whether the secret is sealed with the user data key.
+type MFARecord struct {
+	UserID           uuid.UUID `json:"user_id" db:"user_id" bson:"_id"`
+	PendingSecretCT  []byte    `json:"-" db:"pending_secret_ct" bson:"pending_secret_ct,omitempty"`
+	PendingDataKey   bool      `json:"-" db:"pending_data_key" bson:"pending_data_key,omitempty"`
+	PendingExpiresAt time.Time `json:"-" db:"pending_expires_at" bson:"pending_expires_at,omitempty"`
+	LastStep         int64     `json:"-" db:"last_step" bson:"last_step"`
+	RecoveryHashes   [][]byte  `json:"-" db:"-" bson:"recovery_hashes"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at" bson:"updated_at"`
+}
+
+// MFARepo persists MFA records.
+type MFARepo interface {
+	// Get retrieves the MFARecord of a user, or nil if there is none.
+	Get(ctx context.Context, userID uuid.UUID) (*MFARecord, error)
+
+	// Save creates or replaces the MFARecord of a user, recovery codes included.
+	Save(ctx context.Context, record *MFARecord) error
+
+	// SavePendingSecret updates the pending secret of an MFARecord whose
+	// pending secret is still previous. It reports whether it was updated.
+	SavePendingSecret(ctx context.Context, record *MFARecord, previous []byte) (bool, error)
+
+	// Delete removes the MFARecord of a user.
+	Delete(ctx context.Context, userID uuid.UUID) error
+
+	// UseStep records step as the last accepted TOTP step if it is newer than
+	// the stored one. It reports whether it was, so a code cannot be used twice.
+	UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+
+	// UseRecoveryCode removes a recovery code hash and reports whether it existed.
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash []byte) (bool, error)
+}
@@ -0,0 +1,574 @@
+package authn
+
+import (
+	"bytes"
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+)
+
+type mockMFARepo struct {
+	mu      sync.Mutex
+	records map[uuid.UUID]MFARecord
+}
+
+func newMockMFARepo() *mockMFARepo {
+	return &mockMFARepo{records: make(map[uuid.UUID]MFARecord)}
+}
+
+func (m *mockMFARepo) Get(ctx context.Context, userID uuid.UUID) (*MFARecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[userID]
+	if !ok {
+		return nil, nil
+	}
+	record.RecoveryHashes = append([][]byte(nil), record.RecoveryHashes...)
+	return &record, nil
+}
+
+func (m *mockMFARepo) Save(ctx context.Context, record *MFARecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[record.UserID] = *record
+	return nil
+}
+
+func (m *mockMFARepo) SavePendingSecret(ctx context.Context, record *MFARecord, previous []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.records[record.UserID]
+	if !ok || !bytes.Equal(stored.PendingSecretCT, previous) {
+		return false, nil
+	}
+	stored.PendingSecretCT, stored.PendingDataKey = record.PendingSecretCT, record.PendingDataKey
+	m.records[record.UserID] = stored
+	return true, nil
+}
+
+func (m *mockMFARepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, userID)
+	return nil
+}
+
+func (m *mockMFARepo) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[userID]
+	if !ok || record.LastStep >= step {
+		return false, nil
+	}
+	record.LastStep = step
+	m.records[userID] = record
+	return true, nil
+}
+
+func (m *mockMFARepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[userID]
+	if !ok {
+		return false, nil
+	}
+	for i, stored := range record.RecoveryHashes {
+		if bytes.Equal(stored, hash) {
+			record.RecoveryHashes = append(record.RecoveryHashes[:i:i], record.RecoveryHashes[i+1:]...)
+			m.records[userID] = record
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fixedClock is a settable clock for MFA tests.
+type fixedClock struct {
+	t time.Time
+}
+
+func (c *fixedClock) now() time.Time { return c.t }
+
+func (c *fixedClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// setupMFA returns a handler whose MFA manager runs on a fixed clock and an
+// active user with a known password.
+func setupMFA(t *testing.T) (*AuthHandler, *mockUserRepo, *fixedClock, *User) {
+	t.Helper()
+	handler, repo := setupAuthHandler()
+
+	clock := &fixedClock{t: time.Unix(1700000000, 0)}
+	handler.mfa.now = clock.now
+
+	normalizedEmail := authpkg.NormalizeEmail("test@example.com")
+	encrypted, err := authpkg.EncryptEmail(normalizedEmail, []byte(handler.xparams.Cfg.Auth.EncryptionKey))
+	if err != nil {
+		t.Fatalf("EncryptEmail() error = %v", err)
+	}
+
+	salt := authpkg.GeneratePasswordSalt()
+	user := &User{
+		ID:           uuid.New(),
+		EmailCT:      encrypted.Ciphertext,
+		EmailIV:      encrypted.IV,
+		EmailTag:     encrypted.Tag,
+		EmailLookup:  authpkg.ComputeLookupHash(normalizedEmail, []byte(handler.xparams.Cfg.Auth.SigningKey)),
+		PasswordHash: authpkg.HashPassword([]byte("ValidPassword123!"), salt),
+		PasswordSalt: salt,
+		Status:       authpkg.UserStatusActive,
+	}
+	repo.users[user.ID] = user
+
+	return handler, repo, clock, user
+}
+
+// enableMFA enrolls and confirms an authenticator, returning its secret and
+// the recovery codes.
+func enableMFA(t *testing.T, mfa *MFAManager, user *User, at time.Time) ([]byte, []string) {
+	t.Helper()
+	enrollment, err := mfa.Enroll(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+
+	secret := decodeTOTPSecret(t, enrollment.Secret)
+	codes, err := mfa.Confirm(context.Background(), user, authpkg.TOTPCode(secret, at))
+	if err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	return secret, codes
+}
+
+func decodeTOTPSecret(t *testing.T, encoded string) []byte {
+	t.Helper()
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("cannot decode secret: %v", err)
+	}
+	return secret
+}
+
+func TestMFAManagerEnrollAndConfirm(t *testing.T) {
+	handler, _, clock, user := setupMFA(t)
+	mfa := handler.mfa
+	ctx := context.Background()
+
+	if _, err := mfa.Confirm(ctx, user, "123456"); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Errorf("Confirm() before enrolling error = %v, want %v", err, ErrMFANotEnrolled)
+	}
+
+	enrollment, err := mfa.Enroll(ctx, user)
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/hatmax:test@example.com?") {
+		t.Errorf("URI = %s, want issuer and email label", enrollment.URI)
+	}
+	if mfa.Enabled(user) {
+		t.Fatal("Enabled() = true before confirming")
+	}
+
+	secret := decodeTOTPSecret(t, enrollment.Secret)
+	if _, err := mfa.Confirm(ctx, user, "abcdef"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Confirm() with wrong code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+
+	codes, err := mfa.Confirm(ctx, user, authpkg.TOTPCode(secret, clock.now()))
+	if err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	if len(codes) != authpkg.RecoveryCodeCount {
+		t.Errorf("recovery codes = %d, want %d", len(codes), authpkg.RecoveryCodeCount)
+	}
+	if !mfa.Enabled(user) {
+		t.Fatal("Enabled() = false after confirming")
+	}
+
+	if !user.MFADataKey {
+		t.Error("MFADataKey = false, want the secret sealed with the user data key")
+	}
+	stored, err := mfa.pii.OpenData(ctx, user.ID, user.MFASecretCT)
+	if err != nil || !bytes.Equal(stored, secret) {
+		t.Errorf("MFASecretCT decrypts to %x, %v, want the enrolled secret", stored, err)
+	}
+	if _, err := authpkg.DecryptTOTPSecret(user.MFASecretCT, mfa.encryptionKey); err == nil {
+		t.Error("MFASecretCT decrypts with the encryption key, want only the data key")
+	}
+
+	record, _ := mfa.repo.Get(ctx, user.ID)
+	if len(record.PendingSecretCT) != 0 || len(record.RecoveryHashes) != len(codes) {
+		t.Errorf("record = %+v, want no pending secret and hashed recovery codes", record)
+	}
+	for _, hash := range record.RecoveryHashes {
+		for _, code := range codes {
+			if bytes.Contains(hash, []byte(code)) {
+				t.Fatal("recovery codes stored in plain text")
+			}
+		}
+	}
+
+	if _, err := mfa.Enroll(ctx, user); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("Enroll() when enabled error = %v, want %v", err, ErrMFAAlreadyEnabled)
+	}
+}
+
+func TestMFAManagerEnrollmentExpires(t *testing.T) {
+	handler, _, clock, user := setupMFA(t)
+	mfa := handler.mfa
+
+	enrollment, err := mfa.Enroll(context.Background(), user)
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+
+	clock.advance(mfaEnrollmentTTL)
+	code := authpkg.TOTPCode(decodeTOTPSecret(t, enrollment.Secret), clock.now())
+	if _, err := mfa.Confirm(context.Background(), user, code); !errors.Is(err, ErrMFANotEnrolled) {
+		t.Errorf("Confirm() after expiry error = %v, want %v", err, ErrMFANotEnrolled)
+	}
+}
+
+func TestMFAManagerVerify(t *testing.T) {
+	handler, _, clock, user := setupMFA(t)
+	mfa := handler.mfa
+	ctx := context.Background()
+
+	secret, codes := enableMFA(t, mfa, user, clock.now())
+	confirmed := authpkg.TOTPCode(secret, clock.now())
+
+	if err := mfa.Verify(ctx, user, confirmed); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Verify() with the confirmation code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+
+	clock.advance(authpkg.TOTPPeriod)
+	next := authpkg.TOTPCode(secret, clock.now())
+
+	tests := []struct {
+		name    string
+		code    string
+		wantErr error
+	}{
+		{"next step", next, nil},
+		{"replayed step", next, ErrInvalidMFACode},
+		{"recovery code", codes[0], nil},
+		{"recovery code reused", codes[0], ErrInvalidMFACode},
+		{"recovery code typed differently", strings.ToUpper(codes[1]), nil},
+		{"wrong code", "not-a-code", ErrInvalidMFACode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := mfa.Verify(ctx, user, tt.code); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPIIRekeyerMovesLegacyMFASecrets(t *testing.T) {
+	handler, repo, clock, user := setupMFA(t)
+	mfa := handler.mfa
+	ctx := context.Background()
+
+	// Secrets sealed with the encryption key, before data keys
+	legacy := func(secret []byte) []byte {
+		t.Helper()
+		sealed, err := authpkg.EncryptTOTPSecret(secret, mfa.encryptionKey)
+		if err != nil {
+			t.Fatalf("EncryptTOTPSecret() error = %v", err)
+		}
+		return sealed
+	}
+
+	secret := authpkg.GenerateTOTPSecret()
+	user.MFASecretCT = legacy(secret)
+	mfa.repo.Save(ctx, &MFARecord{UserID: user.ID, UpdatedAt: clock.now()})
+
+	if err := mfa.Verify(ctx, user, authpkg.TOTPCode(secret, clock.now())); err != nil {
+		t.Fatalf("Verify() with a legacy secret error = %v", err)
+	}
+
+	pending := &User{ID: uuid.New(), Status: authpkg.UserStatusActive}
+	if err := handler.pii.SealEmail(ctx, pending, "pending@example.com"); err != nil {
+		t.Fatalf("SealEmail() error = %v", err)
+	}
+	repo.users[pending.ID] = pending
+	pendingSecret := authpkg.GenerateTOTPSecret()
+	mfa.repo.Save(ctx, &MFARecord{UserID: pending.ID, PendingSecretCT: legacy(pendingSecret), PendingExpiresAt: clock.now().Add(mfaEnrollmentTTL)})
+
+	rekeyer, err := NewPIIRekeyer(repo, handler.pii, mfa, handler.xparams)
+	if err != nil {
+		t.Fatalf("NewPIIRekeyer() error = %v", err)
+	}
+	if result, err := rekeyer.Run(ctx); err != nil || result.Failed != 0 {
+		t.Fatalf("Run() = %+v, %v, want no failures", result, err)
+	}
+
+	// The pending user has nothing else to move, so it is not listed
+	if moved, err := mfa.Rekey(ctx, pending); err != nil || !moved {
+		t.Fatalf("Rekey() of a pending secret = %v, %v, want moved", moved, err)
+	}
+
+	stored := repo.users[user.ID]
+	if !stored.MFADataKey {
+		t.Fatal("MFADataKey after Run = false, want the secret moved to the data key")
+	}
+	if opened, err := mfa.pii.OpenData(ctx, user.ID, stored.MFASecretCT); err != nil || !bytes.Equal(opened, secret) {
+		t.Errorf("moved secret opens to %x, %v, want the original secret", opened, err)
+	}
+
+	clock.advance(authpkg.TOTPPeriod)
+	if err := mfa.Verify(ctx, stored, authpkg.TOTPCode(secret, clock.now())); err != nil {
+		t.Errorf("Verify() after Run error = %v", err)
+	}
+
+	record, _ := mfa.repo.Get(ctx, pending.ID)
+	if !record.PendingDataKey {
+		t.Fatal("PendingDataKey after Rekey = false, want the pending secret moved")
+	}
+	if _, err := mfa.Confirm(ctx, pending, authpkg.TOTPCode(pendingSecret, clock.now())); err != nil {
+		t.Errorf("Confirm() of a moved pending secret error = %v", err)
+	}
+	if !pending.MFADataKey {
+		t.Error("MFADataKey after Confirm = false, want it carried from the pending secret")
+	}
+
+	// Erasing the user shreds the data key and the secret with it
+	if err := mfa.pii.Shred(ctx, user.ID); err != nil {
+		t.Fatalf("Shred() error = %v", err)
+	}
+	clock.advance(authpkg.TOTPPeriod)
+	if err := mfa.Verify(ctx, stored, authpkg.TOTPCode(secret, clock.now())); !errors.Is(err, ErrDataShredded) {
+		t.Errorf("Verify() after Shred error = %v, want %v", err, ErrDataShredded)
+	}
+}
+
+func TestMFAManagerPendingToken(t *testing.T) {
+	handler, _, clock, user := setupMFA(t)
+	mfa := handler.mfa
+	ctx := context.Background()
+
+	token, expiresAt, err := mfa.IssuePendingToken(user)
+	if err != nil {
+		t.Fatalf("IssuePendingToken() error = %v", err)
+	}
+	if !expiresAt.Equal(clock.now().Add(mfaPendingTTL)) {
+		t.Errorf("expiresAt = %s, want %s", expiresAt, clock.now().Add(mfaPendingTTL))
+	}
+
+	userID, err := mfa.VerifyPendingToken(ctx, token)
+	if err != nil || userID != user.ID {
+		t.Fatalf("VerifyPendingToken() = %s, %v, want %s", userID, err, user.ID)
+	}
+
+	session, err := handler.sessions.Start(ctx, user.ID, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if _, _, err := handler.sessions.Authenticate(ctx, token); err == nil {
+		t.Error("Authenticate() accepted an mfa_pending token")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		after time.Duration
+	}{
+		{"access token", session.AccessToken, 0},
+		{"garbage", "v4.public.garbage", 0},
+		{"expired", token, mfaPendingTTL + time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.advance(tt.after)
+			if _, err := mfa.VerifyPendingToken(ctx, tt.token); !errors.Is(err, ErrInvalidMFAToken) {
+				t.Errorf("VerifyPendingToken() error = %v, want %v", err, ErrInvalidMFAToken)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_SignInWithMFA(t *testing.T) {
+	handler, _, clock, user := setupMFA(t)
+	secret, codes := enableMFA(t, handler.mfa, user, clock.now())
+
+	req := httptest.NewRequest(http.MethodPost, "/authn/signin", strings.NewReader(`{"email":"test@example.com","password":"ValidPassword123!"}`))
+	rr := httptest.NewRecorder()
+	handler.SignIn(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("SignIn() status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var signIn struct {
+		Data AuthResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&signIn); err != nil {
+		t.Fatalf("cannot decode response: %v", err)
+	}
+	if !signIn.Data.MFARequired || signIn.Data.MFAToken == "" || signIn.Data.Token != "" || signIn.Data.RefreshToken != "" {
+		t.Fatalf("SignIn() response = %+v, want only an mfa token", signIn.Data)
+	}
+
+	clock.advance(authpkg.TOTPPeriod)
+	mfaToken := signIn.Data.MFAToken
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"missing code", `{"mfa_token":"` + mfaToken + `"}`, http.StatusBadRequest},
+		{"invalid JSON", `mfa`, http.StatusBadRequest},
+		{"invalid token", `{"mfa_token":"invalid","code":"123456"}`, http.StatusUnauthorized},
+		{"wrong code", `{"mfa_token":"` + mfaToken + `","code":"abc"}`, http.StatusUnauthorized},
+		{"totp code", `{"mfa_token":"` + mfaToken + `","code":"` + authpkg.TOTPCode(secret, clock.now()) + `"}`, http.StatusOK},
+		{"replayed totp code", `{"mfa_token":"` + mfaToken + `","code":"` + authpkg.TOTPCode(secret, clock.now()) + `"}`, http.StatusUnauthorized},
+		{"recovery code", `{"mfa_token":"` + mfaToken + `","code":"` + codes[0] + `"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/authn/signin/mfa", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			handler.SignInMFA(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("SignInMFA() status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data AuthResponse `json:"data"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("cannot decode response: %v", err)
+			}
+			if _, _, err := handler.sessions.Authenticate(context.Background(), resp.Data.Token); err != nil {
+				t.Errorf("SignInMFA() token not accepted: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_EnrollAndConfirmMFA(t *testing.T) {
+	handler, _, clock, user := setupMFA(t)
+	tokens, err := handler.sessions.Start(context.Background(), user.ID, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	router := chi.NewRouter()
+	handler.RegisterRoutes(router)
+
+	do := func(path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("/authn/mfa/enroll", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("EnrollMFA() without token status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	rr := do("/authn/mfa/enroll", tokens.AccessToken, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("EnrollMFA() status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var enrollment struct {
+		Data MFAEnrollment `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&enrollment); err != nil {
+		t.Fatalf("cannot decode response: %v", err)
+	}
+
+	if rr := do("/authn/mfa/confirm", tokens.AccessToken, `{"code":"abc"}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("ConfirmMFA() with wrong code status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	code := authpkg.TOTPCode(decodeTOTPSecret(t, enrollment.Data.Secret), clock.now())
+	rr = do("/authn/mfa/confirm", tokens.AccessToken, `{"code":"`+code+`"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("ConfirmMFA() status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var confirmed struct {
+		Data MFARecoveryCodes `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&confirmed); err != nil {
+		t.Fatalf("cannot decode response: %v", err)
+	}
+	if len(confirmed.Data.RecoveryCodes) != authpkg.RecoveryCodeCount {
+		t.Errorf("recovery codes = %d, want %d", len(confirmed.Data.RecoveryCodes), authpkg.RecoveryCodeCount)
+	}
+
+	if rr := do("/authn/mfa/enroll", tokens.AccessToken, ""); rr.Code != http.StatusConflict {
+		t.Errorf("EnrollMFA() when enabled status = %d, want %d", rr.Code, http.StatusConflict)
+	}
+}
+
+func TestUserHandler_ResetMFA(t *testing.T) {
+	handler, repo, clock, user := setupMFA(t)
+	enableMFA(t, handler.mfa, user, clock.now())
+
+	router := chi.NewRouter()
+	guard := newTestAdminGuard(handler.xparams, map[string]string{"user-token": user.ID.String()})
+	NewUserHandler(repo, handler.mfa, newTestPrivacy(handler, nil), guard, handler.xparams).RegisterRoutes(router)
+
+	tests := []struct {
+		name           string
+		id             string
+		token          string
+		expectedStatus int
+	}{
+		{"unauthenticated", user.ID.String(), "", http.StatusUnauthorized},
+		{"not an admin", user.ID.String(), "user-token", http.StatusForbidden},
+		{"invalid id", "invalid", testAdminToken, http.StatusBadRequest},
+		{"unknown user", uuid.New().String(), testAdminToken, http.StatusNotFound},
+		{"reset", user.ID.String(), testAdminToken, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/users/"+tt.id+"/mfa", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("ResetMFA() status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+
+	if handler.mfa.Enabled(user) {
+		t.Error("Enabled() = true after reset")
+	}
+	if record, _ := handler.mfa.repo.Get(context.Background(), user.ID); record != nil {
+		t.Errorf("record = %+v, want none after reset", record)
+	}
+	if _, err := handler.mfa.Enroll(context.Background(), user); err != nil {
+		t.Errorf("Enroll() after reset error = %v", err)
+	}
+}
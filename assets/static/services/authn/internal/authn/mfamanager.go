@@ -0,0 +1,335 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+// MFAPendingAudience is the audience of the token returned by a sign in
+// that still needs a second factor. Services never accept it.
+const MFAPendingAudience = "mfa_pending"
+
+const (
+	mfaPendingTTL    = 5 * time.Minute
+	mfaEnrollmentTTL = 10 * time.Minute
+	defaultMFAIssuer = "hatmax"
+)
+
+var (
+	// ErrMFAAlreadyEnabled is returned when enrolling a user that has MFA.
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	// ErrMFANotEnrolled is returned when confirming without a pending enrollment.
+	ErrMFANotEnrolled = errors.New("no pending mfa enrollment")
+	// ErrInvalidMFACode is returned for wrong, expired or reused codes.
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+	// ErrInvalidMFAToken is returned for invalid or expired mfa_pending tokens.
+	ErrInvalidMFAToken = errors.New("invalid mfa token")
+)
+
+// MFAEnrollment is returned when a user starts enrolling a TOTP authenticator.
+type MFAEnrollment struct {
+	Secret    string    `json:"secret"`
+	URI       string    `json:"uri"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MFAManager enrolls TOTP authenticators and checks second factors.
+// Enrollment stores a pending secret that becomes the user's MFASecretCT once
+// confirmed with a first code; the confirmation returns one-time recovery codes,
+// of which only hashes are kept.
+// Secrets are sealed with the user data key of the PII keyring, so erasing a
+// user shreds them as well. Secrets sealed before, with the encryption key,
+// are still read until the PII rekeyer moves them.
+type MFAManager struct {
+	users         UserRepo
+	repo          MFARepo
+	keys          *Keyring
+	pii           *PIIKeyring
+	encryptionKey []byte
+	issuer        string
+	now           func() time.Time
+}
+
+// NewMFAManager creates an MFA manager. Pending sign in tokens are signed with
+// keys; secrets are sealed and user emails, shown by authenticator apps, read
+// with pii.
+func NewMFAManager(users UserRepo, repo MFARepo, keys *Keyring, pii *PIIKeyring, xparams config.XParams) *MFAManager {
+	issuer := xparams.Cfg.Auth.MFAIssuer
+	if issuer == "" {
+		issuer = defaultMFAIssuer
+	}
+
+	return &MFAManager{
+		users:         users,
+		repo:          repo,
+		keys:          keys,
+		pii:           pii,
+		encryptionKey: []byte(xparams.Cfg.Auth.EncryptionKey),
+		issuer:        issuer,
+		now:           time.Now,
+	}
+}
+
+// Enabled reports whether the user has a confirmed TOTP authenticator.
+func (m *MFAManager) Enabled(user *User) bool {
+	return len(user.MFASecretCT) > 0
+}
+
+// Enroll generates a TOTP secret for the user and keeps it pending until
+// confirmed. Enrolling again replaces a pending secret.
+func (m *MFAManager) Enroll(ctx context.Context, user *User) (*MFAEnrollment, error) {
+	if m.Enabled(user) {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret := authpkg.GenerateTOTPSecret()
+	sealed, err := m.pii.SealData(ctx, user.ID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt mfa secret: %w", err)
+	}
+
+	record, err := m.record(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	record.PendingSecretCT = sealed
+	record.PendingDataKey = true
+	record.PendingExpiresAt = now.Add(mfaEnrollmentTTL)
+	record.UpdatedAt = now
+
+	if err := m.repo.Save(ctx, record); err != nil {
+		return nil, fmt.Errorf("cannot save mfa enrollment: %w", err)
+	}
+
+	return &MFAEnrollment{
+		Secret:    authpkg.EncodeTOTPSecret(secret),
+		URI:       authpkg.TOTPURI(m.issuer, m.accountName(ctx, user), secret),
+		ExpiresAt: record.PendingExpiresAt,
+	}, nil
+}
+
+// Confirm enables MFA if code matches the pending secret and returns the
+// recovery codes. They are shown once; only their hashes are stored.
+func (m *MFAManager) Confirm(ctx context.Context, user *User, code string) ([]string, error) {
+	if m.Enabled(user) {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	record, err := m.repo.Get(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get mfa record: %w", err)
+	}
+
+	now := m.now()
+	if record == nil || len(record.PendingSecretCT) == 0 || !now.Before(record.PendingExpiresAt) {
+		return nil, ErrMFANotEnrolled
+	}
+
+	secret, err := m.open(ctx, user.ID, record.PendingSecretCT, record.PendingDataKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt mfa secret: %w", err)
+	}
+
+	step, ok := authpkg.ValidateTOTP(secret, code, now)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes := authpkg.GenerateRecoveryCodes(authpkg.RecoveryCodeCount)
+	hashes := make([][]byte, len(codes))
+	for i, c := range codes {
+		hashes[i] = authpkg.HashRecoveryCode(c)
+	}
+
+	user.MFASecretCT, user.MFADataKey = record.PendingSecretCT, record.PendingDataKey
+	if err := m.users.Save(ctx, user); err != nil {
+		return nil, fmt.Errorf("cannot enable mfa: %w", err)
+	}
+
+	record.PendingSecretCT, record.PendingDataKey = nil, false
+	record.PendingExpiresAt = time.Time{}
+	record.LastStep = step
+	record.RecoveryHashes = hashes
+	record.UpdatedAt = now
+	if err := m.repo.Save(ctx, record); err != nil {
+		return nil, fmt.Errorf("cannot save mfa record: %w", err)
+	}
+
+	return codes, nil
+}
+
+// Verify checks a TOTP code, or failing that a recovery code, for a user with
+// MFA enabled. Each TOTP step and each recovery code is accepted only once.
+func (m *MFAManager) Verify(ctx context.Context, user *User, code string) error {
+	if !m.Enabled(user) {
+		return ErrMFANotEnrolled
+	}
+
+	secret, err := m.open(ctx, user.ID, user.MFASecretCT, user.MFADataKey)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt mfa secret: %w", err)
+	}
+
+	if step, ok := authpkg.ValidateTOTP(secret, code, m.now()); ok {
+		fresh, err := m.repo.UseStep(ctx, user.ID, step)
+		if err != nil {
+			return fmt.Errorf("cannot record mfa step: %w", err)
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := m.repo.UseRecoveryCode(ctx, user.ID, authpkg.HashRecoveryCode(code))
+	if err != nil {
+		return fmt.Errorf("cannot use recovery code: %w", err)
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// Reset disables MFA for the user and drops its recovery codes, so the user
+// can enroll again. It is meant for admins helping users who lost their device.
+func (m *MFAManager) Reset(ctx context.Context, user *User) error {
+	user.MFASecretCT, user.MFADataKey = nil, false
+	if err := m.users.Save(ctx, user); err != nil {
+		return fmt.Errorf("cannot disable mfa: %w", err)
+	}
+
+	if err := m.repo.Delete(ctx, user.ID); err != nil {
+		return fmt.Errorf("cannot delete mfa record: %w", err)
+	}
+	return nil
+}
+
+// Rekey seals the secrets of a user still under the encryption key with the
+// user data key: the confirmed one and a pending one. Secrets changed by
+// another writer meanwhile are left alone. It reports whether any moved.
+func (m *MFAManager) Rekey(ctx context.Context, user *User) (bool, error) {
+	moved := false
+
+	if len(user.MFASecretCT) > 0 && !user.MFADataKey {
+		sealed, err := m.reseal(ctx, user.ID, user.MFASecretCT)
+		if err != nil {
+			return false, err
+		}
+
+		rekeyed := *user
+		rekeyed.MFASecretCT, rekeyed.MFADataKey = sealed, true
+		saved, err := m.users.SaveMFASecret(ctx, &rekeyed, user.MFASecretCT)
+		if err != nil {
+			return false, fmt.Errorf("cannot save re-encrypted mfa secret: %w", err)
+		}
+		if saved {
+			*user = rekeyed
+			moved = true
+		}
+	}
+
+	record, err := m.repo.Get(ctx, user.ID)
+	if err != nil {
+		return moved, fmt.Errorf("cannot get mfa record: %w", err)
+	}
+	if record == nil || len(record.PendingSecretCT) == 0 || record.PendingDataKey {
+		return moved, nil
+	}
+
+	sealed, err := m.reseal(ctx, user.ID, record.PendingSecretCT)
+	if err != nil {
+		return moved, err
+	}
+
+	previous := record.PendingSecretCT
+	record.PendingSecretCT, record.PendingDataKey = sealed, true
+	saved, err := m.repo.SavePendingSecret(ctx, record, previous)
+	if err != nil {
+		return moved, fmt.Errorf("cannot save re-encrypted pending mfa secret: %w", err)
+	}
+	return moved || saved, nil
+}
+
+// IssuePendingToken returns the mfa_pending token a sign in with a correct
+// password gets when the user has MFA enabled.
+func (m *MFAManager) IssuePendingToken(user *User) (string, time.Time, error) {
+	claims := claimsAt(user.ID.String(), uuid.New().String(), MFAPendingAudience, mfaPendingTTL, m.now())
+
+	token, err := m.keys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("could not sign mfa token: %w", err)
+	}
+	return token, time.Unix(claims.ExpiresAt, 0), nil
+}
+
+// VerifyPendingToken validates an mfa_pending token and returns its user ID.
+func (m *MFAManager) VerifyPendingToken(ctx context.Context, token string) (uuid.UUID, error) {
+	claims, err := m.keys.Verify(ctx, token, MFAPendingAudience, m.now())
+	if errors.Is(err, authpkg.ErrInvalidToken) {
+		return uuid.Nil, ErrInvalidMFAToken
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("cannot verify mfa token: %w", err)
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, ErrInvalidMFAToken
+	}
+	return userID, nil
+}
+
+// record returns the MFA record of a user, or a new one.
+func (m *MFAManager) record(ctx context.Context, userID uuid.UUID) (*MFARecord, error) {
+	record, err := m.repo.Get(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get mfa record: %w", err)
+	}
+	if record == nil {
+		record = &MFARecord{UserID: userID}
+	}
+	return record, nil
+}
+
+// open decrypts a secret sealed with the user data key or, before data keys,
+// the encryption key.
+func (m *MFAManager) open(ctx context.Context, userID uuid.UUID, sealed []byte, dataKey bool) ([]byte, error) {
+	if !dataKey {
+		return authpkg.DecryptTOTPSecret(sealed, m.encryptionKey)
+	}
+	return m.pii.OpenData(ctx, userID, sealed)
+}
+
+// reseal moves a secret sealed with the encryption key to the user data key.
+func (m *MFAManager) reseal(ctx context.Context, userID uuid.UUID, sealed []byte) ([]byte, error) {
+	secret, err := authpkg.DecryptTOTPSecret(sealed, m.encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt mfa secret: %w", err)
+	}
+
+	resealed, err := m.pii.SealData(ctx, userID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt mfa secret: %w", err)
+	}
+	return resealed, nil
+}
+
+// accountName labels the authenticator entry with the user email when it
+// can be decrypted, and the user ID otherwise.
+func (m *MFAManager) accountName(ctx context.Context, user *User) string {
+	email, err := m.pii.OpenEmail(ctx, user)
+	if err != nil || email == "" {
+		return user.ID.String()
+	}
+	return email
+}
@@ -0,0 +1,53 @@
+package authn
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OIDCClient is an application registered to sign users in through authn
+// acting as OpenID Connect provider. Its ID is the client_id. Public clients,
+// SPAs and mobile apps, have no secret and rely on PKCE alone; confidential
+// clients also authenticate with the secret shown once at registration.
+type OIDCClient struct {
+	ID           uuid.UUID `json:"id" db:"id" bson:"_id"`
+	Name         string    `json:"name" db:"name" bson:"name"`
+	RedirectURIs []string  `json:"redirect_uris" db:"redirect_uris" bson:"redirect_uris"`
+	Public       bool      `json:"public" db:"public" bson:"public"`
+	SecretHash   []byte    `json:"-" db:"secret_hash" bson:"secret_hash,omitempty"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at" bson:"created_at"`
+}
+
+// GetID returns the ID of the OIDCClient (implements Identifiable interface).
+func (c *OIDCClient) GetID() uuid.UUID {
+	return c.ID
+}
+
+// ResourceType returns the resource type for URL generation.
+func (c *OIDCClient) ResourceType() string {
+	return "oidc-client"
+}
+
+// AllowsRedirect reports whether uri is one of the registered redirect URIs.
+// Matching is exact, as OAuth 2.1 requires.
+func (c *OIDCClient) AllowsRedirect(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// OIDCClientRepo persists OIDC clients.
+type OIDCClientRepo interface {
+	// Create stores a new OIDCClient.
+	Create(ctx context.Context, client *OIDCClient) error
+
+	// Get retrieves an OIDCClient by ID, or nil if there is none.
+	Get(ctx context.Context, id uuid.UUID) (*OIDCClient, error)
+
+	// List retrieves all OIDC clients.
+	List(ctx context.Context) ([]*OIDCClient, error)
+
+	// Delete removes an OIDCClient. Codes already issued to it fail to redeem.
+	Delete(ctx context.Context, id uuid.UUID) error
+}
@@ -0,0 +1,336 @@
+package authn
+
+import (
+	"context"
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+// legacyPIIKeyID names the keys of users stored before PII keys were
+// versioned, whose PIIKeyID is empty. Without auth.pii.keys it is the only
+// version, made of the encryption and signing keys.
+const legacyPIIKeyID = "1"
+
+// ErrUnknownPIIKey is returned for a user whose PII was encrypted under a key
+// version the keyring no longer holds.
+var ErrUnknownPIIKey = errors.New("unknown pii key")
+
+// ErrDataShredded is returned for PII sealed with a user data key that was
+// deleted when the user was erased.
+var ErrDataShredded = errors.New("user data key shredded")
+
+const dataKeySize = 32
+
+// PIIKey is one version of the keys protecting user emails: an AES-GCM key
+// for the encrypted email and an HMAC key for the lookup hash.
+type PIIKey struct {
+	ID            string
+	EncryptionKey []byte
+	LookupKey     []byte
+}
+
+// PIIKeyring holds the versions of the PII keys. The active version hashes
+// new emails and wraps the per-user data keys PII is encrypted with; the
+// others only read users not yet re-encrypted. Each user records the version
+// of its lookup hash in PIIKeyID, and each data key the version wrapping it.
+// Users stored before data keys existed have their email encrypted with the
+// version key directly, until re-encryption gives them a data key; the user
+// EmailDataKey flag tells which key sealed the email.
+type PIIKeyring struct {
+	keys     []*PIIKey
+	byID     map[string]*PIIKey
+	dataKeys DataKeyRepo
+	now      func() time.Time
+}
+
+// NewPIIKeyring creates a keyring from auth.pii.keys, a comma separated list
+// of id:encryption_key:lookup_key entries, the first one active. When unset
+// the encryption and signing keys form the single legacy version.
+// User data keys are stored in dataKeys.
+func NewPIIKeyring(dataKeys DataKeyRepo, xparams config.XParams) (*PIIKeyring, error) {
+	keys, err := parsePIIKeys(xparams.Cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring, err := newPIIKeyring(keys)
+	if err != nil {
+		return nil, err
+	}
+	keyring.dataKeys = dataKeys
+	return keyring, nil
+}
+
+func parsePIIKeys(cfg config.AuthConfig) ([]*PIIKey, error) {
+	if strings.TrimSpace(cfg.PIIKeys) == "" {
+		return []*PIIKey{{
+			ID:            legacyPIIKeyID,
+			EncryptionKey: []byte(cfg.EncryptionKey),
+			LookupKey:     []byte(cfg.SigningKey),
+		}}, nil
+	}
+
+	var keys []*PIIKey
+	for _, entry := range strings.Split(cfg.PIIKeys, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid pii key entry %q: want id:encryption_key:lookup_key", entry)
+		}
+		if _, err := aes.NewCipher([]byte(parts[1])); err != nil {
+			return nil, fmt.Errorf("invalid pii encryption key %s: %w", parts[0], err)
+		}
+		keys = append(keys, &PIIKey{ID: parts[0], EncryptionKey: []byte(parts[1]), LookupKey: []byte(parts[2])})
+	}
+	return keys, nil
+}
+
+func newPIIKeyring(keys []*PIIKey) (*PIIKeyring, error) {
+	byID := make(map[string]*PIIKey, len(keys))
+	for _, key := range keys {
+		if _, ok := byID[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate pii key %s", key.ID)
+		}
+		byID[key.ID] = key
+	}
+	return &PIIKeyring{keys: keys, byID: byID, now: time.Now}, nil
+}
+
+// ActiveID returns the version new emails are encrypted under.
+func (k *PIIKeyring) ActiveID() string {
+	return k.keys[0].ID
+}
+
+// Lookup returns the lookup hash of a normalized email under the active key.
+func (k *PIIKeyring) Lookup(email string) []byte {
+	return authpkg.ComputeLookupHash(email, k.keys[0].LookupKey)
+}
+
+// SealEmail encrypts a normalized email with the user data key, created on
+// first use, computes its lookup hash with the active key and records its
+// version on the user.
+func (k *PIIKeyring) SealEmail(ctx context.Context, user *User, email string) error {
+	active := k.keys[0]
+
+	key, err := k.dataKey(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := authpkg.EncryptEmail(email, key)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt email: %w", err)
+	}
+
+	user.EmailCT = encrypted.Ciphertext
+	user.EmailIV = encrypted.IV
+	user.EmailTag = encrypted.Tag
+	user.EmailLookup = authpkg.ComputeLookupHash(email, active.LookupKey)
+	user.PIIKeyID = active.ID
+	user.EmailDataKey = true
+	return nil
+}
+
+// OpenEmail decrypts the email of a user with its data key or, for emails
+// sealed before the user had one, the version they were sealed under.
+func (k *PIIKeyring) OpenEmail(ctx context.Context, user *User) (string, error) {
+	if user.ErasedAt != nil {
+		return "", ErrDataShredded
+	}
+
+	key, err := k.emailKey(ctx, user)
+	if err != nil {
+		return "", err
+	}
+
+	email, err := authpkg.DecryptEmail(&authpkg.EncryptedData{
+		Ciphertext: user.EmailCT,
+		IV:         user.EmailIV,
+		Tag:        user.EmailTag,
+	}, key)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt email: %w", err)
+	}
+	return email, nil
+}
+
+// FindUser returns the user with a normalized email, or nil. The lookup hash
+// of every version is tried, active first, so users not yet re-encrypted
+// still sign in while a rotation is under way.
+func (k *PIIKeyring) FindUser(ctx context.Context, users UserRepo, email string) (*User, error) {
+	for _, key := range k.keys {
+		user, err := users.GetByEmailLookup(ctx, authpkg.ComputeLookupHash(email, key.LookupKey))
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+// Rekey moves a user's email and lookup hash to the active key and saves
+// them, unless another writer moved the user first. Users without a data key
+// get one. It reports whether the user was updated; users already on the
+// active key are left alone.
+func (k *PIIKeyring) Rekey(ctx context.Context, users UserRepo, user *User) (bool, error) {
+	if user.PIIKeyID == k.ActiveID() && user.EmailDataKey {
+		return false, nil
+	}
+
+	email, err := k.OpenEmail(ctx, user)
+	if err != nil {
+		return false, err
+	}
+
+	rekeyed := *user
+	if err := k.SealEmail(ctx, &rekeyed, email); err != nil {
+		return false, err
+	}
+
+	saved, err := users.SavePII(ctx, &rekeyed, user.PIIKeyID)
+	if err != nil {
+		return false, fmt.Errorf("cannot save re-encrypted email: %w", err)
+	}
+	if saved {
+		*user = rekeyed
+	}
+	return saved, nil
+}
+
+// SealData encrypts PII of a user other than the email with the user data
+// key, into a single value holding IV, ciphertext and tag.
+func (k *PIIKeyring) SealData(ctx context.Context, userID uuid.UUID, data []byte) ([]byte, error) {
+	key, err := k.dataKey(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return authpkg.SealData(data, key)
+}
+
+// OpenData decrypts a value sealed with SealData. It returns ErrDataShredded
+// once the user data key is gone.
+func (k *PIIKeyring) OpenData(ctx context.Context, userID uuid.UUID, sealed []byte) ([]byte, error) {
+	stored, err := k.dataKeys.Get(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get data key: %w", err)
+	}
+	if stored == nil {
+		return nil, ErrDataShredded
+	}
+
+	key, err := k.unwrap(stored)
+	if err != nil {
+		return nil, err
+	}
+	return authpkg.OpenData(sealed, key)
+}
+
+// Shred deletes the data key of a user, leaving everything sealed with it
+// unreadable.
+func (k *PIIKeyring) Shred(ctx context.Context, userID uuid.UUID) error {
+	if err := k.dataKeys.Delete(ctx, userID); err != nil {
+		return fmt.Errorf("cannot delete data key: %w", err)
+	}
+	return nil
+}
+
+// dataKey returns the data key of a user, creating it on first use and
+// wrapping it again under the active key when another version wraps it.
+func (k *PIIKeyring) dataKey(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	active := k.keys[0]
+
+	stored, err := k.dataKeys.Get(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get data key: %w", err)
+	}
+
+	if stored == nil {
+		key := authpkg.GenerateRandomBytes(dataKeySize)
+		wrapped, err := authpkg.SealData(key, active.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot wrap data key: %w", err)
+		}
+
+		now := k.now()
+		stored = &DataKey{UserID: userID, KeyCT: wrapped, PIIKeyID: active.ID, CreatedAt: now, UpdatedAt: now}
+		if err := k.dataKeys.Create(ctx, stored); err != nil {
+			return nil, fmt.Errorf("cannot create data key: %w", err)
+		}
+		return key, nil
+	}
+
+	key, err := k.unwrap(stored)
+	if err != nil {
+		return nil, err
+	}
+	if stored.PIIKeyID == active.ID {
+		return key, nil
+	}
+
+	wrapped, err := authpkg.SealData(key, active.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot wrap data key: %w", err)
+	}
+	stored.KeyCT, stored.PIIKeyID, stored.UpdatedAt = wrapped, active.ID, k.now()
+	if err := k.dataKeys.Save(ctx, stored); err != nil {
+		return nil, fmt.Errorf("cannot save data key: %w", err)
+	}
+	return key, nil
+}
+
+func (k *PIIKeyring) unwrap(stored *DataKey) ([]byte, error) {
+	version, ok := k.byID[stored.PIIKeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPIIKey, stored.PIIKeyID)
+	}
+
+	key, err := authpkg.OpenData(stored.KeyCT, version.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unwrap data key: %w", err)
+	}
+	return key, nil
+}
+
+// emailKey returns the key the email of a user is encrypted with. A data key
+// created for other PII, as consent records, does not seal an email sealed
+// before it.
+func (k *PIIKeyring) emailKey(ctx context.Context, user *User) ([]byte, error) {
+	if user.EmailDataKey {
+		stored, err := k.dataKeys.Get(ctx, user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get data key: %w", err)
+		}
+		if stored == nil {
+			return nil, ErrDataShredded
+		}
+		return k.unwrap(stored)
+	}
+
+	version, err := k.keyOf(user)
+	if err != nil {
+		return nil, err
+	}
+	return version.EncryptionKey, nil
+}
+
+func (k *PIIKeyring) keyOf(user *User) (*PIIKey, error) {
+	id := user.PIIKeyID
+	if id == "" {
+		id = legacyPIIKeyID
+	}
+
+	key, ok := k.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPIIKey, id)
+	}
+	return key, nil
+}
@@ -0,0 +1,246 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/pkg/lib/core"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+const (
+	oldPIIKey = "1:12345678901234567890123456789012:old-lookup-key"
+	newPIIKey = "2:abcdefghijklmnopqrstuvwxyz012345:new-lookup-key"
+)
+
+type mockDataKeyRepo struct {
+	mu   sync.Mutex
+	keys map[uuid.UUID]DataKey
+}
+
+func newMockDataKeyRepo() *mockDataKeyRepo {
+	return &mockDataKeyRepo{keys: make(map[uuid.UUID]DataKey)}
+}
+
+func (m *mockDataKeyRepo) Create(ctx context.Context, key *DataKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keys[key.UserID]; ok {
+		return errors.New("data key exists")
+	}
+	m.keys[key.UserID] = *key
+	return nil
+}
+
+func (m *mockDataKeyRepo) Get(ctx context.Context, userID uuid.UUID) (*DataKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+func (m *mockDataKeyRepo) Save(ctx context.Context, key *DataKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keys[key.UserID]; ok {
+		m.keys[key.UserID] = *key
+	}
+	return nil
+}
+
+func (m *mockDataKeyRepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, userID)
+	return nil
+}
+
+// newTestPIIKeyring creates a keyring over dataKeys, which keyrings standing
+// for the same service before and after a rotation share.
+func newTestPIIKeyring(t *testing.T, dataKeys DataKeyRepo, keys string) *PIIKeyring {
+	t.Helper()
+	xparams := config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{Auth: config.AuthConfig{PIIKeys: keys}}}
+
+	pii, err := NewPIIKeyring(dataKeys, xparams)
+	if err != nil {
+		t.Fatalf("NewPIIKeyring() error = %v", err)
+	}
+	return pii
+}
+
+// addPIIUser stores a user with email sealed by pii.
+func addPIIUser(t *testing.T, repo *mockUserRepo, pii *PIIKeyring, email string) *User {
+	t.Helper()
+	user := NewUser()
+	if err := pii.SealEmail(context.Background(), user, email); err != nil {
+		t.Fatalf("SealEmail() error = %v", err)
+	}
+	repo.users[user.ID] = user
+	return user
+}
+
+func TestNewPIIKeyring(t *testing.T) {
+	tests := []struct {
+		name       string
+		auth       config.AuthConfig
+		wantActive string
+		wantErr    bool
+	}{
+		{"legacy", config.AuthConfig{EncryptionKey: "12345678901234567890123456789012", SigningKey: "signing"}, "1", false},
+		{"versioned", config.AuthConfig{PIIKeys: newPIIKey + ", " + oldPIIKey}, "2", false},
+		{"malformed entry", config.AuthConfig{PIIKeys: "2:abcdefghijklmnopqrstuvwxyz012345"}, "", true},
+		{"short encryption key", config.AuthConfig{PIIKeys: "2:short:lookup"}, "", true},
+		{"duplicate id", config.AuthConfig{PIIKeys: oldPIIKey + "," + oldPIIKey}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pii, err := NewPIIKeyring(newMockDataKeyRepo(), config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{Auth: tt.auth}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewPIIKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && pii.ActiveID() != tt.wantActive {
+				t.Errorf("ActiveID() = %s, want %s", pii.ActiveID(), tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestPIIKeyringRotation(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockUserRepo()
+	dataKeys := newMockDataKeyRepo()
+	old := newTestPIIKeyring(t, dataKeys, oldPIIKey)
+	rotated := newTestPIIKeyring(t, dataKeys, newPIIKey+","+oldPIIKey)
+
+	user := addPIIUser(t, repo, old, "test@example.com")
+
+	found, err := rotated.FindUser(ctx, repo, "test@example.com")
+	if err != nil || found == nil || found.ID != user.ID {
+		t.Fatalf("FindUser() during rotation = %v, %v, want the user", found, err)
+	}
+	if email, err := rotated.OpenEmail(ctx, found); err != nil || email != "test@example.com" {
+		t.Fatalf("OpenEmail() old version = %q, %v", email, err)
+	}
+
+	saved, err := rotated.Rekey(ctx, repo, found)
+	if err != nil || !saved {
+		t.Fatalf("Rekey() = %v, %v, want saved", saved, err)
+	}
+	if repo.users[user.ID].PIIKeyID != "2" {
+		t.Errorf("PIIKeyID after Rekey = %q, want 2", repo.users[user.ID].PIIKeyID)
+	}
+	if found, _ := repo.GetByEmailLookup(ctx, rotated.Lookup("test@example.com")); found == nil {
+		t.Error("GetByEmailLookup() with the active lookup hash found no user after Rekey")
+	}
+	if email, err := rotated.OpenEmail(ctx, repo.users[user.ID]); err != nil || email != "test@example.com" {
+		t.Errorf("OpenEmail() new version = %q, %v", email, err)
+	}
+	if key := dataKeys.keys[user.ID]; key.PIIKeyID != "2" {
+		t.Errorf("data key PIIKeyID after Rekey = %q, want 2", key.PIIKeyID)
+	}
+
+	if saved, err := rotated.Rekey(ctx, repo, found); err != nil || saved {
+		t.Errorf("Rekey() on the active key = %v, %v, want no change", saved, err)
+	}
+
+	if _, err := old.OpenEmail(ctx, repo.users[user.ID]); !errors.Is(err, ErrUnknownPIIKey) {
+		t.Errorf("OpenEmail() with a retired keyring error = %v, want %v", err, ErrUnknownPIIKey)
+	}
+}
+
+func TestPIIKeyringRekeyLosesRace(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockUserRepo()
+	dataKeys := newMockDataKeyRepo()
+	rotated := newTestPIIKeyring(t, dataKeys, newPIIKey+","+oldPIIKey)
+
+	user := addPIIUser(t, repo, newTestPIIKeyring(t, dataKeys, oldPIIKey), "test@example.com")
+	stale := *user
+	if _, err := rotated.Rekey(ctx, repo, user); err != nil {
+		t.Fatalf("Rekey() error = %v", err)
+	}
+
+	if saved, err := rotated.Rekey(ctx, repo, &stale); err != nil || saved {
+		t.Errorf("Rekey() of a stale copy = %v, %v, want not saved", saved, err)
+	}
+	if stale.PIIKeyID != "1" {
+		t.Errorf("stale copy PIIKeyID = %q, want it untouched", stale.PIIKeyID)
+	}
+}
+
+func TestPIIRekeyerRun(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockUserRepo()
+	dataKeys := newMockDataKeyRepo()
+	old := newTestPIIKeyring(t, dataKeys, oldPIIKey)
+	rotated := newTestPIIKeyring(t, dataKeys, newPIIKey+","+oldPIIKey)
+
+	for i := 0; i < 5; i++ {
+		addPIIUser(t, repo, old, "user"+string(rune('a'+i))+"@example.com")
+	}
+	legacy := addPIIUser(t, repo, old, "legacy@example.com")
+	legacy.PIIKeyID = ""
+	lost := &User{ID: uuid.New(), EmailCT: []byte("x"), PIIKeyID: "0", Status: authpkg.UserStatusActive}
+	repo.users[lost.ID] = lost
+
+	xparams := config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{Auth: config.AuthConfig{PIIRekeyBatch: 2}}}
+	mfa := NewMFAManager(repo, newMockMFARepo(), nil, rotated, xparams)
+	rekeyer, err := NewPIIRekeyer(repo, rotated, mfa, xparams)
+	if err != nil {
+		t.Fatalf("NewPIIRekeyer() error = %v", err)
+	}
+
+	result, err := rekeyer.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Rekeyed != 6 || result.Failed != 1 {
+		t.Errorf("Run() = %+v, want 6 rekeyed and 1 failed", result)
+	}
+	for _, user := range repo.users {
+		if user.ID != lost.ID && user.PIIKeyID != "2" {
+			t.Errorf("user %s PIIKeyID = %q, want 2", user.ID, user.PIIKeyID)
+		}
+	}
+
+	result, err = rekeyer.Run(ctx)
+	if err != nil || result.Rekeyed != 0 || result.Failed != 1 {
+		t.Errorf("second Run() = %+v, %v, want only the unreadable user", result, err)
+	}
+}
+
+func TestAuthHandler_SignInDuringPIIRotation(t *testing.T) {
+	handler, repo, _, user := setupMFA(t)
+	auth := handler.xparams.Cfg.Auth
+	handler.pii = newTestPIIKeyring(t, handler.pii.dataKeys, newPIIKey+",1:"+auth.EncryptionKey+":"+auth.SigningKey)
+
+	req := httptest.NewRequest(http.MethodPost, "/authn/signup", strings.NewReader(`{"email":"test@example.com","password":"ValidPassword123!"}`))
+	rr := httptest.NewRecorder()
+	handler.SignUp(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("SignUp() with an email under the old key status = %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/authn/signin", strings.NewReader(`{"email":"test@example.com","password":"ValidPassword123!"}`))
+	rr = httptest.NewRecorder()
+	handler.SignIn(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("SignIn() under the old key status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	if saved := repo.users[user.ID]; saved.PIIKeyID != "2" {
+		t.Errorf("PIIKeyID after sign in = %q, want the active key", saved.PIIKeyID)
+	}
+}
@@ -0,0 +1,161 @@
+package authn
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/username/repo/pkg/lib/core"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+const (
+	defaultPIIRekeyInterval = time.Hour
+	defaultPIIRekeyBatch    = 100
+)
+
+// RekeyResult counts the users a re-encryption run moved to the active key
+// and those it could not, which stay readable under their old key.
+type RekeyResult struct {
+	Rekeyed int
+	Failed  int
+}
+
+// PIIRekeyer re-encrypts user emails under the active PII key, and MFA
+// secrets still under the encryption key with user data keys, in the
+// background. It walks the users not on the active key in ID order, a batch
+// at a time; progress lives in the rows themselves, so a run that is stopped
+// resumes where it left off on the next one. Users the job cannot read are
+// logged and skipped.
+type PIIRekeyer struct {
+	users    UserRepo
+	keys     *PIIKeyring
+	mfa      *MFAManager
+	interval time.Duration
+	batch    int
+	log      core.Logger
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewPIIRekeyer creates a re-encryption job that runs every
+// auth.pii.rekey.interval.
+func NewPIIRekeyer(users UserRepo, keys *PIIKeyring, mfa *MFAManager, xparams config.XParams) (*PIIRekeyer, error) {
+	cfg := xparams.Cfg.Auth
+
+	interval, err := parseKeyDuration(cfg.PIIRekeyInterval, defaultPIIRekeyInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pii rekey interval: %w", err)
+	}
+
+	batch := cfg.PIIRekeyBatch
+	if batch <= 0 {
+		batch = defaultPIIRekeyBatch
+	}
+
+	return &PIIRekeyer{
+		users:    users,
+		keys:     keys,
+		mfa:      mfa,
+		interval: interval,
+		batch:    batch,
+		log:      xparams.Log,
+	}, nil
+}
+
+// Start runs the job once and then on its interval.
+func (r *PIIRekeyer) Start(ctx context.Context) error {
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.schedule()
+
+	return nil
+}
+
+// Stop ends the schedule, interrupting a run in progress between batches.
+func (r *PIIRekeyer) Stop(ctx context.Context) error {
+	if r.stop == nil {
+		return nil
+	}
+
+	close(r.stop)
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// Run re-encrypts every user not on the active key or with MFA secrets
+// not sealed with their data key.
+func (r *PIIRekeyer) Run(ctx context.Context) (RekeyResult, error) {
+	var result RekeyResult
+	active := r.keys.ActiveID()
+
+	after := uuid.Nil
+	for {
+		users, err := r.users.ListForRekey(ctx, active, after, r.batch)
+		if err != nil {
+			return result, fmt.Errorf("cannot list users to re-encrypt: %w", err)
+		}
+
+		for _, user := range users {
+			if _, err := r.keys.Rekey(ctx, r.users, user); err != nil {
+				r.log.Error("cannot re-encrypt user email", "user_id", user.ID, "key", user.PIIKeyID, "error", err)
+				result.Failed++
+				continue
+			}
+			if _, err := r.mfa.Rekey(ctx, user); err != nil {
+				r.log.Error("cannot re-encrypt user mfa secrets", "user_id", user.ID, "error", err)
+				result.Failed++
+				continue
+			}
+			result.Rekeyed++
+		}
+
+		if len(users) < r.batch {
+			return result, nil
+		}
+		after = users[len(users)-1].ID
+
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+	}
+}
+
+func (r *PIIRekeyer) schedule() {
+	defer close(r.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := r.Run(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.log.Error("cannot re-encrypt user emails", "error", err)
+		}
+		if result.Rekeyed > 0 || result.Failed > 0 {
+			r.log.Info("user emails re-encrypted", "key", r.keys.ActiveID(), "rekeyed", result.Rekeyed, "failed", result.Failed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/pkg/lib/core"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+type mockConsentRepo struct {
+	mu       sync.Mutex
+	consents []Consent
+}
+
+func newMockConsentRepo() *mockConsentRepo {
+	return &mockConsentRepo{}
+}
+
+func (m *mockConsentRepo) Create(ctx context.Context, consent *Consent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.consents = append(m.consents, *consent)
+	return nil
+}
+
+func (m *mockConsentRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]*Consent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var consents []*Consent
+	for _, consent := range m.consents {
+		if consent.UserID == userID {
+			consent := consent
+			consents = append(consents, &consent)
+		}
+	}
+	sort.SliceStable(consents, func(i, j int) bool { return consents[i].Timestamp.Before(consents[j].Timestamp) })
+	return consents, nil
+}
+
+// newTestPrivacy creates a PrivacyManager over the repositories of handler.
+func newTestPrivacy(handler *AuthHandler, grants GrantSource) *PrivacyManager {
+	return NewPrivacyManager(handler.repo, handler.sessions.repo, handler.mfa.repo, newMockConsentRepo(), newMockFederatedIdentityRepo(), handler.pii, grants, handler.xparams)
+}
+
+// newFakeAuthz serves the grants of every user as authz does.
+func newFakeAuthz(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/authz/grants/users/") {
+			http.NotFound(w, r)
+			return
+		}
+		core.RespondSuccess(w, []map[string]string{{"ID": "grant-1", "GrantType": "role", "Value": "editor"}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNewAuthzGrants(t *testing.T) {
+	if grants := NewAuthzGrants(config.XParams{Cfg: &config.Config{}}); grants != nil {
+		t.Errorf("NewAuthzGrants() without a URL = %v, want nil", grants)
+	}
+
+	srv := newFakeAuthz(t)
+	grants := NewAuthzGrants(config.XParams{Cfg: &config.Config{Services: config.ServicesConfig{AuthzURL: srv.URL + "/"}}})
+	raw, err := grants.ListByUser(context.Background(), uuid.New())
+	if err != nil {
+		t.Fatalf("ListByUser() error = %v", err)
+	}
+	if !strings.Contains(string(raw), "grant-1") {
+		t.Errorf("ListByUser() = %s, want the authz grants", raw)
+	}
+}
+
+func TestUserHandler_ExportAndErase(t *testing.T) {
+	handler, repo, clock, user := setupMFA(t)
+	authz := newFakeAuthz(t)
+	privacy := newTestPrivacy(handler, NewAuthzGrants(config.XParams{Cfg: &config.Config{Services: config.ServicesConfig{AuthzURL: authz.URL}}}))
+	privacy.now = clock.now
+
+	router := chi.NewRouter()
+	NewUserHandler(repo, handler.mfa, privacy, newTestAdminGuard(handler.xparams, nil), handler.xparams).RegisterRoutes(router)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.10:4321"
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	signIn := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/authn/signin", strings.NewReader(`{"email":"test@example.com","password":"ValidPassword123!"}`))
+		req.RemoteAddr = "192.0.2.10:4321"
+		rr := httptest.NewRecorder()
+		handler.SignIn(rr, req)
+		return rr.Code
+	}
+	export := func() UserExport {
+		rr := do(http.MethodGet, "/users/"+user.ID.String()+"/export", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("ExportUser() status = %d, want %d", rr.Code, http.StatusOK)
+		}
+		var resp struct {
+			Data UserExport `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("cannot decode response: %v", err)
+		}
+		return resp.Data
+	}
+
+	if code := signIn(); code != http.StatusOK {
+		t.Fatalf("SignIn() status = %d, want %d", code, http.StatusOK)
+	}
+	if _, ok := handler.pii.dataKeys.(*mockDataKeyRepo).keys[user.ID]; !ok {
+		t.Fatal("sign in did not give the legacy user a data key")
+	}
+
+	if rr := do(http.MethodPost, "/users/"+user.ID.String()+"/consents", `{"type":"email_marketing","scope":"newsletter","granted":true}`); rr.Code != http.StatusCreated {
+		t.Fatalf("RecordConsent() status = %d, want %d", rr.Code, http.StatusCreated)
+	}
+	if rr := do(http.MethodPost, "/users/"+user.ID.String()+"/consents", `{"scope":"newsletter"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("RecordConsent() without a type status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	identity := &FederatedIdentity{ID: uuid.New(), ProviderID: "corp", Subject: "corp-123", UserID: user.ID, CreatedAt: clock.now()}
+	if err := privacy.identities.Create(context.Background(), identity); err != nil {
+		t.Fatalf("cannot link federated identity: %v", err)
+	}
+
+	exported := export()
+	if exported.Email != "test@example.com" || exported.User == nil || exported.User.ID != user.ID {
+		t.Errorf("export user = %+v, email %q", exported.User, exported.Email)
+	}
+	if len(exported.Sessions) != 1 || exported.Sessions[0].IP != "192.0.2.10" {
+		t.Errorf("export sessions = %+v, want the sign in session", exported.Sessions)
+	}
+	want := authpkg.ConsentRecord{Type: "email_marketing", Scope: "newsletter", Granted: true, Timestamp: clock.now(), SourceIP: "192.0.2.10"}
+	if len(exported.Consents) != 1 || !exported.Consents[0].Timestamp.Equal(want.Timestamp) || exported.Consents[0].SourceIP != want.SourceIP || exported.Consents[0].Type != want.Type {
+		t.Errorf("export consents = %+v, want [%+v]", exported.Consents, want)
+	}
+	if !strings.Contains(string(exported.Grants), "grant-1") {
+		t.Errorf("export grants = %s, want the authz grants", exported.Grants)
+	}
+	if len(exported.FederatedIdentities) != 1 || exported.FederatedIdentities[0].Subject != "corp-123" {
+		t.Errorf("export federated identities = %+v, want the linked identity", exported.FederatedIdentities)
+	}
+
+	if rr := do(http.MethodDelete, "/users/"+user.ID.String(), ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("DeleteUser() status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+
+	erased := repo.users[user.ID]
+	if erased.Status != authpkg.UserStatusDeleted || erased.ErasedAt == nil || erased.EmailCT != nil || len(erased.PasswordHash) != 0 {
+		t.Errorf("erased user = %+v, want a tombstone", erased)
+	}
+	if _, ok := handler.pii.dataKeys.(*mockDataKeyRepo).keys[user.ID]; ok {
+		t.Error("erasure kept the data key")
+	}
+	if code := signIn(); code != http.StatusUnauthorized {
+		t.Errorf("SignIn() after erasure status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	exported = export()
+	if exported.Email != "" || exported.User.ErasedAt == nil {
+		t.Errorf("export after erasure = %+v, email %q, want the tombstone", exported.User, exported.Email)
+	}
+	if len(exported.Sessions) != 1 || exported.Sessions[0].IP != "" || exported.Sessions[0].RevokeReason != RevokeReasonErased {
+		t.Errorf("sessions after erasure = %+v, want revoked and stripped", exported.Sessions)
+	}
+	if len(exported.Consents) != 1 || exported.Consents[0].SourceIP != "" || !exported.Consents[0].Granted {
+		t.Errorf("consents after erasure = %+v, want the record without its source ip", exported.Consents)
+	}
+	if len(exported.FederatedIdentities) != 0 {
+		t.Errorf("federated identities after erasure = %+v, want none", exported.FederatedIdentities)
+	}
+
+	if rr := do(http.MethodDelete, "/users/"+user.ID.String(), ""); rr.Code != http.StatusNoContent {
+		t.Errorf("DeleteUser() of an erased user status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+	if rr := do(http.MethodPost, "/users/"+user.ID.String()+"/consents", `{"type":"email_marketing","granted":true}`); rr.Code != http.StatusConflict {
+		t.Errorf("RecordConsent() for an erased user status = %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	authz.Close()
+	if rr := do(http.MethodGet, "/users/"+user.ID.String()+"/export", ""); rr.Code != http.StatusBadGateway {
+		t.Errorf("ExportUser() with authz down status = %d, want %d", rr.Code, http.StatusBadGateway)
+	}
+	if rr := do(http.MethodGet, "/users/"+uuid.New().String()+"/export", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("ExportUser() of an unknown user status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestUserHandler_PrivacyAccess(t *testing.T) {
+	handler, repo, _, user := setupMFA(t)
+	guard := newTestAdminGuard(handler.xparams, map[string]string{
+		"self-token":  user.ID.String(),
+		"other-token": uuid.New().String(),
+	})
+
+	router := chi.NewRouter()
+	NewUserHandler(repo, handler.mfa, newTestPrivacy(handler, nil), guard, handler.xparams).RegisterRoutes(router)
+
+	export := "/users/" + user.ID.String() + "/export"
+	consents := "/users/" + user.ID.String() + "/consents"
+	consent := `{"type":"email_marketing","granted":true}`
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		token          string
+		expectedStatus int
+	}{
+		{"export unauthenticated", http.MethodGet, export, "", "", http.StatusUnauthorized},
+		{"export by another user", http.MethodGet, export, "", "other-token", http.StatusForbidden},
+		{"export by the user", http.MethodGet, export, "", "self-token", http.StatusOK},
+		{"export by an admin", http.MethodGet, export, "", testAdminToken, http.StatusOK},
+		{"consents unauthenticated", http.MethodGet, consents, "", "", http.StatusUnauthorized},
+		{"consents by another user", http.MethodGet, consents, "", "other-token", http.StatusForbidden},
+		{"consents by the user", http.MethodGet, consents, "", "self-token", http.StatusOK},
+		{"consent recorded by another user", http.MethodPost, consents, consent, "other-token", http.StatusForbidden},
+		{"consent recorded by the user", http.MethodPost, consents, consent, "self-token", http.StatusCreated},
+		{"consent recorded by an admin", http.MethodPost, consents, consent, testAdminToken, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestPrivacyManager_ConsentKeepsLegacyEmailReadable(t *testing.T) {
+	handler, repo, _, user := setupMFA(t)
+	privacy := newTestPrivacy(handler, nil)
+	ctx := context.Background()
+
+	// The first consent of a user whose email predates data keys creates
+	// the data key; the email stays sealed with the version key.
+	record := authpkg.ConsentRecord{Type: "email_marketing", Granted: true, SourceIP: "192.0.2.10"}
+	if _, err := privacy.RecordConsent(ctx, user, record); err != nil {
+		t.Fatalf("RecordConsent() error = %v", err)
+	}
+	if _, ok := handler.pii.dataKeys.(*mockDataKeyRepo).keys[user.ID]; !ok {
+		t.Fatal("RecordConsent() did not create a data key")
+	}
+
+	if email, err := handler.pii.OpenEmail(ctx, repo.users[user.ID]); err != nil || email != "test@example.com" {
+		t.Fatalf("OpenEmail() after the first consent = %q, %v", email, err)
+	}
+
+	// Re-encryption then moves the email onto the data key, though its
+	// version is the active one already.
+	if users, _ := repo.ListForRekey(ctx, handler.pii.ActiveID(), uuid.Nil, 10); len(users) != 1 {
+		t.Fatalf("ListForRekey() = %d users, want the legacy user", len(users))
+	}
+	if saved, err := handler.pii.Rekey(ctx, repo, repo.users[user.ID]); err != nil || !saved {
+		t.Fatalf("Rekey() = %v, %v, want saved", saved, err)
+	}
+	if !repo.users[user.ID].EmailDataKey {
+		t.Error("EmailDataKey = false after Rekey")
+	}
+	if email, err := handler.pii.OpenEmail(ctx, repo.users[user.ID]); err != nil || email != "test@example.com" {
+		t.Errorf("OpenEmail() after Rekey = %q, %v", email, err)
+	}
+
+	consents, err := privacy.Consents(ctx, user.ID)
+	if err != nil || len(consents) != 1 || consents[0].SourceIP != "192.0.2.10" {
+		t.Errorf("Consents() after Rekey = %+v, %v, want the recorded consent", consents, err)
+	}
+}
+
+func TestPrivacyManager_EraseLegacyUser(t *testing.T) {
+	handler, repo, _, user := setupMFA(t)
+	privacy := newTestPrivacy(handler, nil)
+	ctx := context.Background()
+
+	if err := privacy.Erase(ctx, user); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+
+	if found, _ := handler.pii.FindUser(ctx, repo, "test@example.com"); found != nil {
+		t.Error("FindUser() found the erased user by email")
+	}
+	if _, err := handler.pii.OpenEmail(ctx, repo.users[user.ID]); err != ErrDataShredded {
+		t.Errorf("OpenEmail() of an erased user error = %v, want %v", err, ErrDataShredded)
+	}
+	if users, _ := repo.ListForRekey(ctx, "2", uuid.Nil, 10); len(users) != 0 {
+		t.Errorf("ListForRekey() = %d users, want erased users left out", len(users))
+	}
+}
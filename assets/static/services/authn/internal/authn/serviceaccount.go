@@ -0,0 +1,64 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/pkg/lib/core"
+)
+
+// ServiceAccount is a machine principal. It has no password and authenticates
+// with API keys; authz grants apply to its ID as they do to user IDs.
+type ServiceAccount struct {
+	ID          uuid.UUID          `json:"id" db:"id" bson:"_id"`
+	Name        string             `json:"name" db:"name" bson:"name"`
+	Description string             `json:"description" db:"description" bson:"description"`
+	Status      authpkg.UserStatus `json:"status" db:"status" bson:"status"`
+	CreatedAt   time.Time          `json:"created_at" db:"created_at" bson:"created_at"`
+	CreatedBy   string             `json:"created_by" db:"created_by" bson:"created_by"`
+	UpdatedAt   time.Time          `json:"updated_at" db:"updated_at" bson:"updated_at"`
+	UpdatedBy   string             `json:"updated_by" db:"updated_by" bson:"updated_by"`
+}
+
+// NewServiceAccount creates an active ServiceAccount with a generated ID.
+func NewServiceAccount(name, description string) *ServiceAccount {
+	return &ServiceAccount{
+		ID:          core.GenerateNewID(),
+		Name:        name,
+		Description: description,
+		Status:      authpkg.UserStatusActive,
+	}
+}
+
+// GetID returns the ID of the ServiceAccount (implements Identifiable interface).
+func (a *ServiceAccount) GetID() uuid.UUID {
+	return a.ID
+}
+
+// ResourceType returns the resource type for URL generation.
+func (a *ServiceAccount) ResourceType() string {
+	return "service-account"
+}
+
+// Active reports whether the account can authenticate.
+func (a *ServiceAccount) Active() bool {
+	return a.Status == authpkg.UserStatusActive
+}
+
+// ServiceAccountRepo persists service accounts.
+type ServiceAccountRepo interface {
+	// Create stores a new ServiceAccount.
+	Create(ctx context.Context, account *ServiceAccount) error
+
+	// Get retrieves a ServiceAccount by ID, or nil if there is none.
+	Get(ctx context.Context, id uuid.UUID) (*ServiceAccount, error)
+
+	// List retrieves all service accounts.
+	List(ctx context.Context) ([]*ServiceAccount, error)
+
+	// Save updates the name, description and status of a ServiceAccount.
+	Save(ctx context.Context, account *ServiceAccount) error
+}
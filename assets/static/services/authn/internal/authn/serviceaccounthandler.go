@@ -0,0 +1,331 @@
+package authn
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/pkg/lib/core"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+// IntrospectPath is where services check the API keys presented to them.
+const IntrospectPath = "/authn/apikeys/introspect"
+
+const ServiceAccountMaxBodyBytes = 1 << 16
+
+// ServiceAccountHandler manages service accounts and their API keys.
+type ServiceAccountHandler struct {
+	accounts ServiceAccountRepo
+	keys     APIKeyRepo
+	manager  *APIKeyManager
+	guard    *AdminGuard
+	xparams  config.XParams
+}
+
+// NewServiceAccountHandler creates a new ServiceAccountHandler. Accounts and
+// keys are managed by admins admitted by guard; introspection stays open to
+// services.
+func NewServiceAccountHandler(accounts ServiceAccountRepo, keys APIKeyRepo, manager *APIKeyManager, guard *AdminGuard, xparams config.XParams) *ServiceAccountHandler {
+	return &ServiceAccountHandler{
+		accounts: accounts,
+		keys:     keys,
+		manager:  manager,
+		guard:    guard,
+		xparams:  xparams,
+	}
+}
+
+// ServiceAccountRequest is the payload of POST /service-accounts.
+type ServiceAccountRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// APIKeyRequest is the payload of POST /service-accounts/{id}/keys. A key
+// without scopes has every permission granted to its account.
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// IssuedAPIKey is returned once, when a key is created. Key is not stored.
+type IssuedAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+func (h *ServiceAccountHandler) RegisterRoutes(r chi.Router) {
+	read := h.guard.Require(string(authpkg.PermUsersRead))
+	write := h.guard.Require(string(authpkg.PermUsersWrite))
+
+	r.Route("/service-accounts", func(r chi.Router) {
+		r.With(write).Post("/", h.CreateServiceAccount)
+		r.With(read).Get("/", h.ListServiceAccounts)
+		r.With(read).Get("/{id}", h.GetServiceAccount)
+		r.With(write).Delete("/{id}", h.DisableServiceAccount)
+		r.With(read).Get("/{id}/keys", h.ListAPIKeys)
+		r.With(write).Post("/{id}/keys", h.CreateAPIKey)
+		r.With(write).Delete("/{id}/keys/{key_id}", h.RevokeAPIKey)
+	})
+	r.Post(IntrospectPath, h.IntrospectAPIKey)
+}
+
+// CreateServiceAccount handles POST /service-accounts.
+func (h *ServiceAccountHandler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	var req ServiceAccountRequest
+	if !h.decodePayload(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		core.RespondError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	account := NewServiceAccount(strings.TrimSpace(req.Name), req.Description)
+	account.CreatedAt = h.manager.now()
+	account.UpdatedAt = account.CreatedAt
+	account.CreatedBy = actor(r)
+	account.UpdatedBy = account.CreatedBy
+
+	if err := h.accounts.Create(ctx, account); err != nil {
+		log.Error("cannot create service account", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not create service account")
+		return
+	}
+
+	log.Info("service account created", "id", account.ID.String())
+	w.WriteHeader(http.StatusCreated)
+	core.RespondSuccess(w, account, core.RESTfulLinksFor(account)...)
+}
+
+// ListServiceAccounts handles GET /service-accounts.
+func (h *ServiceAccountHandler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	accounts, err := h.accounts.List(r.Context())
+	if err != nil {
+		log.Error("error listing service accounts", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not list service accounts")
+		return
+	}
+
+	core.RespondCollection(w, accounts, "service-account")
+}
+
+// GetServiceAccount handles GET /service-accounts/{id}.
+func (h *ServiceAccountHandler) GetServiceAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.loadAccount(w, r, "Could not retrieve service account")
+	if !ok {
+		return
+	}
+
+	core.RespondSuccess(w, account, core.RESTfulLinksFor(account)...)
+}
+
+// DisableServiceAccount handles DELETE /service-accounts/{id}. The account
+// is suspended rather than removed, so its ID is never reused by grants, and
+// its keys are revoked.
+func (h *ServiceAccountHandler) DisableServiceAccount(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	account, ok := h.loadAccount(w, r, "Could not disable service account")
+	if !ok {
+		return
+	}
+
+	account.UpdatedBy = actor(r)
+	if err := h.manager.Disable(r.Context(), account); err != nil {
+		log.Error("error disabling service account", "error", err, "id", account.ID.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not disable service account")
+		return
+	}
+
+	log.Info("service account disabled", "id", account.ID.String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAPIKeys handles GET /service-accounts/{id}/keys.
+func (h *ServiceAccountHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	account, ok := h.loadAccount(w, r, "Could not list API keys")
+	if !ok {
+		return
+	}
+
+	keys, err := h.keys.ListByServiceAccount(r.Context(), account.ID)
+	if err != nil {
+		log.Error("error listing api keys", "error", err, "id", account.ID.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not list API keys")
+		return
+	}
+
+	core.RespondSuccess(w, keys)
+}
+
+// CreateAPIKey handles POST /service-accounts/{id}/keys. The response holds
+// the key, which is shown only this once.
+func (h *ServiceAccountHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	account, ok := h.loadAccount(w, r, "Could not create API key")
+	if !ok {
+		return
+	}
+
+	var req APIKeyRequest
+	if !h.decodePayload(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		core.RespondError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(h.manager.now()) {
+		core.RespondError(w, http.StatusBadRequest, "Expiration must be in the future")
+		return
+	}
+
+	key, raw, err := h.manager.Issue(r.Context(), account, strings.TrimSpace(req.Name), req.Scopes, req.ExpiresAt)
+	if errors.Is(err, ErrServiceAccountDisabled) {
+		core.RespondError(w, http.StatusConflict, "Service account is disabled")
+		return
+	}
+	if err != nil {
+		log.Error("error creating api key", "error", err, "id", account.ID.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not create API key")
+		return
+	}
+
+	log.Info("api key created", "id", account.ID.String(), "api_key_id", key.ID.String())
+	w.WriteHeader(http.StatusCreated)
+	core.RespondSuccess(w, IssuedAPIKey{APIKey: key, Key: raw})
+}
+
+// RevokeAPIKey handles DELETE /service-accounts/{id}/keys/{key_id}. Keys of
+// other accounts are reported as not found.
+func (h *ServiceAccountHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	account, ok := h.loadAccount(w, r, "Could not revoke API key")
+	if !ok {
+		return
+	}
+
+	keyID, err := uuid.Parse(chi.URLParam(r, "key_id"))
+	if err != nil {
+		core.RespondError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	key, err := h.keys.Get(ctx, keyID)
+	if err != nil {
+		log.Error("error getting api key", "error", err, "api_key_id", keyID.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not revoke API key")
+		return
+	}
+	if key == nil || key.ServiceAccountID != account.ID {
+		core.RespondError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	if err := h.manager.Revoke(ctx, key); err != nil {
+		log.Error("error revoking api key", "error", err, "api_key_id", keyID.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not revoke API key")
+		return
+	}
+
+	log.Info("api key revoked", "id", account.ID.String(), "api_key_id", keyID.String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// IntrospectAPIKey handles POST /authn/apikeys/introspect. Services post the
+// key presented to them and get back the claims to authorize it with, or 401.
+func (h *ServiceAccountHandler) IntrospectAPIKey(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	var req core.APIKeyIntrospection
+	if !h.decodePayload(w, r, &req) {
+		return
+	}
+
+	key, account, err := h.manager.Authenticate(r.Context(), req.Key)
+	if errors.Is(err, ErrInvalidAPIKey) {
+		log.Debug("api key rejected")
+		core.RespondError(w, http.StatusUnauthorized, "Invalid API key")
+		return
+	}
+	if err != nil {
+		log.Error("error authenticating api key", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not check API key")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	core.RespondSuccess(w, h.manager.Claims(key, account))
+}
+
+// loadAccount reads the service account named by the id URL parameter,
+// responding with failure as the message of unexpected errors.
+func (h *ServiceAccountHandler) loadAccount(w http.ResponseWriter, r *http.Request, failure string) (*ServiceAccount, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		core.RespondError(w, http.StatusBadRequest, "Invalid id format")
+		return nil, false
+	}
+
+	account, err := h.accounts.Get(r.Context(), id)
+	if err != nil {
+		h.logForRequest(r).Error("error loading service account", "error", err, "id", id.String())
+		core.RespondError(w, http.StatusInternalServerError, failure)
+		return nil, false
+	}
+	if account == nil {
+		core.RespondError(w, http.StatusNotFound, "Service account not found")
+		return nil, false
+	}
+
+	return account, true
+}
+
+// decodePayload reads a JSON request body into req.
+func (h *ServiceAccountHandler) decodePayload(w http.ResponseWriter, r *http.Request, req any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, ServiceAccountMaxBodyBytes)
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		h.logForRequest(r).Debug("cannot decode JSON", "error", err)
+		core.RespondError(w, http.StatusBadRequest, "Could not parse JSON")
+		return false
+	}
+
+	return true
+}
+
+// actor returns the subject of the caller, recorded as created_by and
+// updated_by.
+func actor(r *http.Request) string {
+	subject, _ := core.GetUserIDFromContext(r.Context())
+	return subject
+}
+
+func (h *ServiceAccountHandler) logForRequest(r *http.Request) core.Logger {
+	return h.xparams.Log.With(
+		"request_id", middleware.GetReqID(r.Context()),
+		"method", r.Method,
+		"path", r.URL.Path,
+	)
+}
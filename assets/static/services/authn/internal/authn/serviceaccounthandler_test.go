@@ -0,0 +1,427 @@
+package authn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/pkg/lib/core"
+	"github.com/username/repo/services/authn/internal/config"
+)
+
+type mockServiceAccountRepo struct {
+	mu       sync.Mutex
+	accounts map[uuid.UUID]ServiceAccount
+}
+
+func newMockServiceAccountRepo() *mockServiceAccountRepo {
+	return &mockServiceAccountRepo{accounts: make(map[uuid.UUID]ServiceAccount)}
+}
+
+func (m *mockServiceAccountRepo) Create(ctx context.Context, account *ServiceAccount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accounts[account.ID] = *account
+	return nil
+}
+
+func (m *mockServiceAccountRepo) Get(ctx context.Context, id uuid.UUID) (*ServiceAccount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	account, ok := m.accounts[id]
+	if !ok {
+		return nil, nil
+	}
+	return &account, nil
+}
+
+func (m *mockServiceAccountRepo) List(ctx context.Context) ([]*ServiceAccount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var accounts []*ServiceAccount
+	for _, account := range m.accounts {
+		account := account
+		accounts = append(accounts, &account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+	return accounts, nil
+}
+
+func (m *mockServiceAccountRepo) Save(ctx context.Context, account *ServiceAccount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accounts[account.ID] = *account
+	return nil
+}
+
+type mockAPIKeyRepo struct {
+	mu   sync.Mutex
+	keys map[uuid.UUID]APIKey
+}
+
+func newMockAPIKeyRepo() *mockAPIKeyRepo {
+	return &mockAPIKeyRepo{keys: make(map[uuid.UUID]APIKey)}
+}
+
+func (m *mockAPIKeyRepo) Create(ctx context.Context, key *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key.ID] = *key
+	return nil
+}
+
+func (m *mockAPIKeyRepo) Get(ctx context.Context, id uuid.UUID) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+func (m *mockAPIKeyRepo) GetByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.keys {
+		if key.Prefix == prefix {
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockAPIKeyRepo) ListByServiceAccount(ctx context.Context, accountID uuid.UUID) ([]*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []*APIKey
+	for _, key := range m.keys {
+		if key.ServiceAccountID == accountID {
+			key := key
+			keys = append(keys, &key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (m *mockAPIKeyRepo) Revoke(ctx context.Context, id uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if ok && key.RevokedAt == nil {
+		key.RevokedAt = &at
+		m.keys[id] = key
+	}
+	return nil
+}
+
+func (m *mockAPIKeyRepo) RevokeByServiceAccount(ctx context.Context, accountID uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, key := range m.keys {
+		if key.ServiceAccountID == accountID && key.RevokedAt == nil {
+			key.RevokedAt = &at
+			m.keys[id] = key
+		}
+	}
+	return nil
+}
+
+func (m *mockAPIKeyRepo) Touch(ctx context.Context, id uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if ok {
+		key.LastUsedAt = &at
+		m.keys[id] = key
+	}
+	return nil
+}
+
+// setupServiceAccounts returns a router serving a ServiceAccountHandler on a
+// fixed clock, and its repositories.
+func setupServiceAccounts() (chi.Router, *mockServiceAccountRepo, *mockAPIKeyRepo, *fixedClock) {
+	accounts := newMockServiceAccountRepo()
+	keys := newMockAPIKeyRepo()
+	xparams := config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{}}
+
+	clock := &fixedClock{t: time.Unix(1700000000, 0)}
+	manager := NewAPIKeyManager(accounts, keys, xparams)
+	manager.now = clock.now
+
+	router := chi.NewRouter()
+	NewServiceAccountHandler(accounts, keys, manager, newTestAdminGuard(xparams, map[string]string{"user-token": uuid.New().String()}), xparams).RegisterRoutes(router)
+	return router, accounts, keys, clock
+}
+
+func serveJSON(t *testing.T, router http.Handler, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("cannot encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func decodeData(t *testing.T, rr *httptest.ResponseRecorder, out any) {
+	t.Helper()
+	resp := struct {
+		Data any `json:"data"`
+	}{Data: out}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("cannot decode response: %v", err)
+	}
+}
+
+// createServiceAccount creates an account through the API and issues it a key.
+func createServiceAccount(t *testing.T, router http.Handler, scopes []string) (ServiceAccount, IssuedAPIKey) {
+	t.Helper()
+	rr := serveJSON(t, router, http.MethodPost, "/service-accounts", ServiceAccountRequest{Name: "billing-worker"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create account status = %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	var account ServiceAccount
+	decodeData(t, rr, &account)
+
+	rr = serveJSON(t, router, http.MethodPost, "/service-accounts/"+account.ID.String()+"/keys", APIKeyRequest{Name: "ci", Scopes: scopes})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create key status = %d, want %d: %s", rr.Code, http.StatusCreated, rr.Body.String())
+	}
+	issued := IssuedAPIKey{APIKey: &APIKey{}}
+	decodeData(t, rr, &issued)
+	return account, issued
+}
+
+func introspect(t *testing.T, router http.Handler, key string) (int, authpkg.TokenClaims) {
+	t.Helper()
+	rr := serveJSON(t, router, http.MethodPost, IntrospectPath, core.APIKeyIntrospection{Key: key})
+	var claims authpkg.TokenClaims
+	if rr.Code == http.StatusOK {
+		decodeData(t, rr, &claims)
+	}
+	return rr.Code, claims
+}
+
+func TestServiceAccountHandlerRequiresAdmin(t *testing.T) {
+	router, _, _, _ := setupServiceAccounts()
+	account, _ := createServiceAccount(t, router, nil)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		expectedStatus int
+	}{
+		{"list unauthenticated", http.MethodGet, "/service-accounts", "", http.StatusUnauthorized},
+		{"list by a user", http.MethodGet, "/service-accounts", "user-token", http.StatusForbidden},
+		{"create unauthenticated", http.MethodPost, "/service-accounts", "", http.StatusUnauthorized},
+		{"create by a user", http.MethodPost, "/service-accounts", "user-token", http.StatusForbidden},
+		{"issue key unauthenticated", http.MethodPost, "/service-accounts/" + account.ID.String() + "/keys", "", http.StatusUnauthorized},
+		{"issue key by a user", http.MethodPost, "/service-accounts/" + account.ID.String() + "/keys", "user-token", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"name":"intruder"}`))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestServiceAccountHandlerCreate(t *testing.T) {
+	router, accounts, _, _ := setupServiceAccounts()
+
+	rr := serveJSON(t, router, http.MethodPost, "/service-accounts", ServiceAccountRequest{Name: "  "})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("create without name status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	account, _ := createServiceAccount(t, router, nil)
+	if account.Name != "billing-worker" || account.Status != authpkg.UserStatusActive {
+		t.Errorf("account = %+v, want an active billing-worker", account)
+	}
+	if account.CreatedBy != testAdminID || account.UpdatedBy != testAdminID {
+		t.Errorf("created_by, updated_by = %q, %q, want the caller %q", account.CreatedBy, account.UpdatedBy, testAdminID)
+	}
+	if stored, _ := accounts.Get(context.Background(), account.ID); stored == nil {
+		t.Fatal("account not stored")
+	}
+
+	rr = serveJSON(t, router, http.MethodGet, "/service-accounts/"+account.ID.String(), nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("get status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	rr = serveJSON(t, router, http.MethodGet, "/service-accounts/"+uuid.New().String(), nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("get unknown status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+
+	rr = serveJSON(t, router, http.MethodGet, "/service-accounts", nil)
+	var listed []ServiceAccount
+	decodeData(t, rr, &listed)
+	if len(listed) != 1 {
+		t.Errorf("listed %d accounts, want 1", len(listed))
+	}
+}
+
+func TestServiceAccountHandlerIssueKey(t *testing.T) {
+	router, _, keys, _ := setupServiceAccounts()
+
+	account, issued := createServiceAccount(t, router, []string{" invoice:read ", "invoice:read", ""})
+	if !strings.HasPrefix(issued.Key, issued.Prefix+"_") || !strings.HasPrefix(issued.Prefix, authpkg.APIKeyPrefix) {
+		t.Errorf("key %q does not start with prefix %q", issued.Key, issued.Prefix)
+	}
+	if len(issued.Scopes) != 1 || issued.Scopes[0] != "invoice:read" {
+		t.Errorf("scopes = %v, want [invoice:read]", issued.Scopes)
+	}
+
+	stored, _ := keys.Get(context.Background(), issued.ID)
+	if stored == nil || bytes.Contains(stored.SecretHash, []byte(issued.Key)) {
+		t.Fatalf("stored key = %+v, want a hashed secret", stored)
+	}
+
+	rr := serveJSON(t, router, http.MethodGet, "/service-accounts/"+account.ID.String()+"/keys", nil)
+	if strings.Contains(rr.Body.String(), issued.Key) {
+		t.Error("key listing exposes the key")
+	}
+	if strings.Contains(rr.Body.String(), "secret_hash") {
+		t.Error("key listing exposes the secret hash")
+	}
+
+	past := time.Unix(1600000000, 0)
+	rr = serveJSON(t, router, http.MethodPost, "/service-accounts/"+account.ID.String()+"/keys", APIKeyRequest{Name: "old", ExpiresAt: &past})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("past expiration status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServiceAccountHandlerIntrospect(t *testing.T) {
+	router, _, keys, clock := setupServiceAccounts()
+	account, issued := createServiceAccount(t, router, []string{"invoice:read"})
+
+	code, claims := introspect(t, router, issued.Key)
+	if code != http.StatusOK {
+		t.Fatalf("introspect status = %d, want %d", code, http.StatusOK)
+	}
+	if claims.Subject != account.ID.String() || claims.SubjectType != authpkg.SubjectTypeServiceAccount {
+		t.Errorf("claims = %+v, want the service account as subject", claims)
+	}
+	if claims.Audience != APIKeyAudience || len(claims.Scopes) != 1 || claims.ExpiresAt != 0 {
+		t.Errorf("claims = %+v, want api_key audience, one scope and no expiry", claims)
+	}
+	if stored, _ := keys.Get(context.Background(), issued.ID); stored.LastUsedAt == nil || !stored.LastUsedAt.Equal(clock.now()) {
+		t.Errorf("LastUsedAt = %v, want %v", stored.LastUsedAt, clock.now())
+	}
+
+	tampered := issued.Key[:len(issued.Key)-1] + "x"
+	if tampered == issued.Key {
+		tampered = issued.Key[:len(issued.Key)-1] + "y"
+	}
+	for _, key := range []string{tampered, "hmk_0011223344556677_secret", "not-a-key", ""} {
+		if code, _ := introspect(t, router, key); code != http.StatusUnauthorized {
+			t.Errorf("introspect(%q) status = %d, want %d", key, code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestServiceAccountHandlerKeyExpiry(t *testing.T) {
+	router, _, _, clock := setupServiceAccounts()
+
+	rr := serveJSON(t, router, http.MethodPost, "/service-accounts", ServiceAccountRequest{Name: "reports"})
+	var account ServiceAccount
+	decodeData(t, rr, &account)
+
+	expiresAt := clock.now().Add(time.Hour)
+	rr = serveJSON(t, router, http.MethodPost, "/service-accounts/"+account.ID.String()+"/keys", APIKeyRequest{Name: "nightly", ExpiresAt: &expiresAt})
+	issued := IssuedAPIKey{APIKey: &APIKey{}}
+	decodeData(t, rr, &issued)
+
+	code, claims := introspect(t, router, issued.Key)
+	if code != http.StatusOK || claims.ExpiresAt != expiresAt.Unix() {
+		t.Errorf("introspect = %d, exp %d, want %d, exp %d", code, claims.ExpiresAt, http.StatusOK, expiresAt.Unix())
+	}
+
+	clock.advance(time.Hour)
+	if code, _ := introspect(t, router, issued.Key); code != http.StatusUnauthorized {
+		t.Errorf("introspect expired key status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestServiceAccountHandlerRevokeKey(t *testing.T) {
+	router, _, _, _ := setupServiceAccounts()
+	account, issued := createServiceAccount(t, router, nil)
+	other, _ := createServiceAccount(t, router, nil)
+
+	rr := serveJSON(t, router, http.MethodDelete, "/service-accounts/"+other.ID.String()+"/keys/"+issued.ID.String(), nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("revoke key of another account status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+	if code, _ := introspect(t, router, issued.Key); code != http.StatusOK {
+		t.Fatalf("introspect status = %d, want %d", code, http.StatusOK)
+	}
+
+	rr = serveJSON(t, router, http.MethodDelete, "/service-accounts/"+account.ID.String()+"/keys/"+issued.ID.String(), nil)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+	if code, _ := introspect(t, router, issued.Key); code != http.StatusUnauthorized {
+		t.Errorf("introspect revoked key status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestServiceAccountHandlerDisable(t *testing.T) {
+	router, accounts, keys, _ := setupServiceAccounts()
+	account, issued := createServiceAccount(t, router, nil)
+
+	rr := serveJSON(t, router, http.MethodDelete, "/service-accounts/"+account.ID.String(), nil)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("disable status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+
+	stored, _ := accounts.Get(context.Background(), account.ID)
+	if stored.Status != authpkg.UserStatusSuspended {
+		t.Errorf("status = %s, want %s", stored.Status, authpkg.UserStatusSuspended)
+	}
+	if stored.UpdatedBy != testAdminID {
+		t.Errorf("updated_by = %q, want the caller %q", stored.UpdatedBy, testAdminID)
+	}
+	if key, _ := keys.Get(context.Background(), issued.ID); key.RevokedAt == nil {
+		t.Error("key not revoked with its account")
+	}
+	if code, _ := introspect(t, router, issued.Key); code != http.StatusUnauthorized {
+		t.Errorf("introspect status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	rr = serveJSON(t, router, http.MethodPost, "/service-accounts/"+account.ID.String()+"/keys", APIKeyRequest{Name: "again"})
+	if rr.Code != http.StatusConflict {
+		t.Errorf("create key for disabled account status = %d, want %d", rr.Code, http.StatusConflict)
+	}
+}
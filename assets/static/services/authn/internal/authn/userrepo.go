@@ -22,6 +22,15 @@ type UserRepo interface {
 	// Save updates an existing User aggregate.
 	Save(ctx context.Context, user *User) error
 
+	// SavePII updates the encrypted email, lookup hash and PII key ID of a
+	// User whose PII key ID is still previousKeyID. It reports whether the
+	// User was updated.
+	SavePII(ctx context.Context, user *User, previousKeyID string) (bool, error)
+
+	// SaveMFASecret updates the MFA secret of a User whose MFA secret is
+	// still previous. It reports whether the User was updated.
+	SaveMFASecret(ctx context.Context, user *User, previous []byte) (bool, error)
+
 	// Delete removes a User (soft delete by changing status).
 	Delete(ctx context.Context, id uuid.UUID) error
 
@@ -30,4 +39,9 @@ type UserRepo interface {
 
 	// ListByStatus retrieves Users filtered by status.
 	ListByStatus(ctx context.Context, status string) ([]*User, error)
+
+	// ListForRekey retrieves up to limit Users whose PII is not under keyID
+	// or whose email or MFA secret is not sealed with their data key, ordered
+	// by ID and starting after the given one.
+	ListForRekey(ctx context.Context, keyID string, after uuid.UUID, limit int) ([]*User, error)
 }
\ No newline at end of file
@@ -41,8 +41,8 @@ func ValidateCreateUser(ctx context.Context, user User) []ValidationError {
 		})
 	}
 
-	// Password salt should be set
-	if len(user.PasswordSalt) == 0 {
+	// Legacy hashes need their salt; PHC encoded hashes carry it inline
+	if len(user.PasswordSalt) == 0 && !authpkg.IsEncodedPasswordHash(user.PasswordHash) {
 		errors = append(errors, ValidationError{
 			Field:   "password",
 			Message: "Password salt is required",
@@ -178,4 +178,24 @@ func ValidateSignInRequest(email, password string) []ValidationError {
 	}
 
 	return errors
-}
\ No newline at end of file
+}
+// ValidatePasswordResetRequest validates the new password of a password reset.
+func ValidatePasswordResetRequest(token, password string) []ValidationError {
+	var errors []ValidationError
+
+	if token == "" {
+		errors = append(errors, ValidationError{
+			Field:   "token",
+			Message: "Token is required",
+		})
+	}
+
+	for _, err := range authpkg.ValidatePassword(password) {
+		errors = append(errors, ValidationError{
+			Field:   "password",
+			Message: err.Message,
+		})
+	}
+
+	return errors
+}
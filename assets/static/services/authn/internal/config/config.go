@@ -5,6 +5,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/knadh/koanf/parsers/yaml"
@@ -16,10 +17,14 @@ import (
 )
 
 type Config struct {
-	Log      LogConfig      `koanf:"log"`
-	Server   ServerConfig   `koanf:"server"`
-	Database DatabaseConfig `koanf:"database"`
-	Auth     AuthConfig     `koanf:"auth"`
+	Log        LogConfig        `koanf:"log"`
+	Server     ServerConfig     `koanf:"server"`
+	Database   DatabaseConfig   `koanf:"database"`
+	Auth       AuthConfig       `koanf:"auth"`
+	Mail       MailConfig       `koanf:"mail"`
+	Services   ServicesConfig   `koanf:"services"`
+	OIDC       OIDCConfig       `koanf:"oidc"`
+	Federation FederationConfig `koanf:"federation"`
 }
 
 type ServerConfig struct {
@@ -40,8 +45,85 @@ type AuthConfig struct {
 	EncryptionKey   string `koanf:"encryption.key"`
 	SigningKey      string `koanf:"signing.key"`
 	SessionTTL      string `koanf:"session.ttl"`
+	AccessTTL       string `koanf:"access.ttl"`
 	TokenPrivateKey string `koanf:"token.private.key"`
 	TokenPublicKey  string `koanf:"token.public.key"`
+	KeyRotation     string `koanf:"key.rotation"`
+	KeyVerifyPeriod string `koanf:"key.verify.period"`
+	MFAIssuer       string `koanf:"mfa.issuer"`
+	// Versioned keys for user emails, as comma separated
+	// id:encryption_key:lookup_key entries with the active one first. When
+	// empty EncryptionKey and SigningKey form the single version "1".
+	PIIKeys          string `koanf:"pii.keys"`
+	PIIRekeyInterval string `koanf:"pii.rekey.interval"`
+	PIIRekeyBatch    int    `koanf:"pii.rekey.batch"`
+	// Sign in limits, per account and per client IP. A negative
+	// LoginSuspendAfter never suspends accounts.
+	LoginMaxAttempts   int    `koanf:"login.max.attempts"`
+	LoginIPMaxAttempts int    `koanf:"login.ip.max.attempts"`
+	LoginWindow        string `koanf:"login.window"`
+	LoginLockout       string `koanf:"login.lockout"`
+	LoginMaxLockout    string `koanf:"login.max.lockout"`
+	LoginSuspendAfter  int    `koanf:"login.suspend.after"`
+	// Argon2id policy for new password hashes. PasswordMemory is in KiB.
+	// Hashes made with other parameters are upgraded on sign in.
+	PasswordMemory  int `koanf:"password.memory"`
+	PasswordTime    int `koanf:"password.time"`
+	PasswordThreads int `koanf:"password.threads"`
+}
+
+// ServicesConfig locates the services authn calls. Without AuthzURL user
+// exports leave grants out.
+type ServicesConfig struct {
+	AuthzURL string `koanf:"authz_url"`
+}
+
+// OIDCConfig turns authn into an OpenID Connect provider for registered
+// clients. Issuer is the public base URL of authn, as seen by clients, and
+// the iss of every access token, OIDC enabled or not.
+// AccessTokenFormat is "paseto", the tokens every hatmax service verifies,
+// or "jwt" for clients that need JWT access tokens.
+type OIDCConfig struct {
+	Enabled           bool   `koanf:"enabled"`
+	Issuer            string `koanf:"issuer"`
+	AccessTokenFormat string `koanf:"access_token_format"`
+	CodeTTL           string `koanf:"code_ttl"`
+}
+
+// FederationConfig lists the upstream OpenID Connect providers users can
+// sign in with. CallbackURL is the public base URL of authn the providers
+// redirect back to; StateTTL bounds the time spent at the provider.
+type FederationConfig struct {
+	CallbackURL string                    `koanf:"callback_url"`
+	StateTTL    string                    `koanf:"state_ttl"`
+	Providers   []FederatedProviderConfig `koanf:"providers"`
+}
+
+// FederatedProviderConfig is an upstream OpenID Connect provider, found
+// through the discovery document of Issuer. With Provision, users unknown to
+// authn are created on their first sign in; otherwise only existing users
+// with the same verified email are linked.
+type FederatedProviderConfig struct {
+	ID           string   `koanf:"id"`
+	Name         string   `koanf:"name"`
+	Issuer       string   `koanf:"issuer"`
+	ClientID     string   `koanf:"client_id"`
+	ClientSecret string   `koanf:"client_secret"`
+	Scopes       []string `koanf:"scopes"`
+	Provision    bool     `koanf:"provision"`
+}
+
+// MailConfig configures the mailer used for verification and password reset
+// emails. LinkURL is the base URL of the pages the emailed links open.
+type MailConfig struct {
+	Driver       string `koanf:"driver"`
+	From         string `koanf:"from"`
+	Dir          string `koanf:"dir"`
+	SMTPHost     string `koanf:"smtp_host"`
+	SMTPPort     int    `koanf:"smtp_port"`
+	SMTPUsername string `koanf:"smtp_username"`
+	SMTPPassword string `koanf:"smtp_password"`
+	LinkURL      string `koanf:"link_url"`
 }
 
 func New() *Config {
@@ -58,11 +140,42 @@ func New() *Config {
 			Level: "info",
 		},
 		Auth: AuthConfig{
-			EncryptionKey:   "change-me-32-byte-key-for-aes-gcm",
-			SigningKey:      "change-me-signing-key-for-hmac",
-			SessionTTL:      "24h",
-			TokenPrivateKey: "",
-			TokenPublicKey:  "",
+			EncryptionKey:      "change-me-32-byte-key-for-aes-gcm",
+			SigningKey:         "change-me-signing-key-for-hmac",
+			SessionTTL:         "24h",
+			AccessTTL:          "15m",
+			TokenPrivateKey:    "",
+			TokenPublicKey:     "",
+			KeyRotation:        "720h",
+			KeyVerifyPeriod:    "48h",
+			MFAIssuer:          "hatmax",
+			PIIRekeyInterval:   "1h",
+			PIIRekeyBatch:      100,
+			LoginMaxAttempts:   5,
+			LoginIPMaxAttempts: 50,
+			LoginWindow:        "15m",
+			LoginLockout:       "1m",
+			LoginMaxLockout:    "1h",
+			LoginSuspendAfter:  5,
+			PasswordMemory:     64 * 1024,
+			PasswordTime:       1,
+			PasswordThreads:    4,
+		},
+		Mail: MailConfig{
+			Driver:   "console",
+			From:     "no-reply@localhost",
+			Dir:      "./mail",
+			SMTPPort: 587,
+			LinkURL:  "http://localhost:8080",
+		},
+		OIDC: OIDCConfig{
+			Issuer:            "http://localhost:8082",
+			AccessTokenFormat: "paseto",
+			CodeTTL:           "1m",
+		},
+		Federation: FederationConfig{
+			CallbackURL: "http://localhost:8082",
+			StateTTL:    "10m",
 		},
 	}
 }
@@ -80,8 +193,37 @@ func LoadConfig(path, envPrefix string, args []string) (*Config, error) {
 	fs.String("auth.encryption_key", "change-me-32-byte-key-for-aes-gcm", "AES-GCM encryption key")
 	fs.String("auth.signing_key", "change-me-signing-key-for-hmac", "HMAC signing key")
 	fs.String("auth.session_ttl", "24h", "Session TTL duration")
+	fs.String("auth.access_ttl", "15m", "Access token TTL duration")
 	fs.String("auth.token_private_key", "", "Ed25519 private key for tokens (base64)")
 	fs.String("auth.token_public_key", "", "Ed25519 public key for tokens (base64)")
+	fs.String("auth.key_rotation", "720h", "Signing key rotation interval")
+	fs.String("auth.key_verify_period", "48h", "How long rotated keys keep verifying tokens")
+	fs.String("auth.mfa_issuer", "hatmax", "Issuer shown by authenticator apps")
+	fs.String("auth.pii_keys", "", "Versioned email keys as id:encryption_key:lookup_key, active first")
+	fs.String("auth.pii_rekey_interval", "1h", "How often users are re-encrypted under the active email key")
+	fs.Int("auth.pii_rekey_batch", 100, "Users re-encrypted per batch")
+	fs.Int("auth.login_max_attempts", 5, "Failed sign ins per account before a lockout")
+	fs.Int("auth.login_ip_max_attempts", 50, "Failed sign ins per client IP before a lockout")
+	fs.String("auth.login_window", "15m", "Window in which failed sign ins are counted")
+	fs.String("auth.login_lockout", "1m", "First lockout duration, doubled on each further lockout")
+	fs.String("auth.login_max_lockout", "1h", "Longest lockout duration")
+	fs.Int("auth.login_suspend_after", 5, "Lockouts before an account is suspended (negative disables)")
+	fs.Int("auth.password_memory", 64*1024, "Argon2id memory for password hashes in KiB")
+	fs.Int("auth.password_time", 1, "Argon2id passes for password hashes")
+	fs.Int("auth.password_threads", 4, "Argon2id parallelism for password hashes")
+	fs.String("mail.driver", "console", "Mailer driver (smtp, file, console)")
+	fs.String("mail.from", "no-reply@localhost", "Sender address of outgoing mail")
+	fs.String("mail.dir", "./mail", "Directory the file mailer writes to")
+	fs.String("mail.smtp_host", "", "SMTP server host")
+	fs.Int("mail.smtp_port", 587, "SMTP server port")
+	fs.String("mail.link_url", "http://localhost:8080", "Base URL of emailed links")
+	fs.String("services.authz_url", "", "Authz service URL, for admin permission checks and the grants in user exports")
+	fs.Bool("oidc.enabled", false, "Serve the OpenID Connect provider endpoints")
+	fs.String("oidc.issuer", "http://localhost:8082", "Public base URL of authn as OIDC issuer")
+	fs.String("oidc.access_token_format", "paseto", "OIDC access token format (paseto, jwt)")
+	fs.String("oidc.code_ttl", "1m", "Authorization code lifetime")
+	fs.String("federation.callback_url", "http://localhost:8082", "Public base URL of authn for upstream OIDC provider callbacks")
+	fs.String("federation.state_ttl", "10m", "How long a federated sign in may take at the provider")
 	fs.Parse(args[1:])
 
 	// Load YAML configuration first
@@ -114,12 +256,109 @@ func LoadConfig(path, envPrefix string, args []string) (*Config, error) {
 	if val := os.Getenv("AUTHN_SESSION_TTL"); val != "" {
 		cfg.Auth.SessionTTL = val
 	}
+	if val := os.Getenv("AUTHN_ACCESS_TTL"); val != "" {
+		cfg.Auth.AccessTTL = val
+	}
 	if val := os.Getenv("AUTHN_TOKEN_PRIVATE_KEY"); val != "" {
 		cfg.Auth.TokenPrivateKey = val
 	}
 	if val := os.Getenv("AUTHN_TOKEN_PUBLIC_KEY"); val != "" {
 		cfg.Auth.TokenPublicKey = val
 	}
+	if val := os.Getenv("AUTHN_KEY_ROTATION"); val != "" {
+		cfg.Auth.KeyRotation = val
+	}
+	if val := os.Getenv("AUTHN_KEY_VERIFY_PERIOD"); val != "" {
+		cfg.Auth.KeyVerifyPeriod = val
+	}
+	if val := os.Getenv("AUTHN_MFA_ISSUER"); val != "" {
+		cfg.Auth.MFAIssuer = val
+	}
+	if val := os.Getenv("AUTHN_PII_KEYS"); val != "" {
+		cfg.Auth.PIIKeys = val
+	}
+	if val := os.Getenv("AUTHN_PII_REKEY_INTERVAL"); val != "" {
+		cfg.Auth.PIIRekeyInterval = val
+	}
+	if val := os.Getenv("AUTHN_PII_REKEY_BATCH"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			cfg.Auth.PIIRekeyBatch = n
+		}
+	}
+	if val := os.Getenv("AUTHN_LOGIN_MAX_ATTEMPTS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			cfg.Auth.LoginMaxAttempts = n
+		}
+	}
+	if val := os.Getenv("AUTHN_LOGIN_IP_MAX_ATTEMPTS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			cfg.Auth.LoginIPMaxAttempts = n
+		}
+	}
+	if val := os.Getenv("AUTHN_LOGIN_WINDOW"); val != "" {
+		cfg.Auth.LoginWindow = val
+	}
+	if val := os.Getenv("AUTHN_LOGIN_LOCKOUT"); val != "" {
+		cfg.Auth.LoginLockout = val
+	}
+	if val := os.Getenv("AUTHN_LOGIN_MAX_LOCKOUT"); val != "" {
+		cfg.Auth.LoginMaxLockout = val
+	}
+	if val := os.Getenv("AUTHN_LOGIN_SUSPEND_AFTER"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			cfg.Auth.LoginSuspendAfter = n
+		}
+	}
+	if val := os.Getenv("AUTHN_PASSWORD_MEMORY"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			cfg.Auth.PasswordMemory = n
+		}
+	}
+	if val := os.Getenv("AUTHN_PASSWORD_TIME"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			cfg.Auth.PasswordTime = n
+		}
+	}
+	if val := os.Getenv("AUTHN_PASSWORD_THREADS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			cfg.Auth.PasswordThreads = n
+		}
+	}
+	if val := os.Getenv("AUTHN_MAIL_DRIVER"); val != "" {
+		cfg.Mail.Driver = val
+	}
+	if val := os.Getenv("AUTHN_MAIL_FROM"); val != "" {
+		cfg.Mail.From = val
+	}
+	if val := os.Getenv("AUTHN_MAIL_SMTP_HOST"); val != "" {
+		cfg.Mail.SMTPHost = val
+	}
+	if val := os.Getenv("AUTHN_MAIL_SMTP_USERNAME"); val != "" {
+		cfg.Mail.SMTPUsername = val
+	}
+	if val := os.Getenv("AUTHN_MAIL_SMTP_PASSWORD"); val != "" {
+		cfg.Mail.SMTPPassword = val
+	}
+	if val := os.Getenv("AUTHN_MAIL_LINK_URL"); val != "" {
+		cfg.Mail.LinkURL = val
+	}
+	if val := os.Getenv("AUTHN_SERVICES_AUTHZ_URL"); val != "" {
+		cfg.Services.AuthzURL = val
+	}
+	if val := os.Getenv("AUTHN_OIDC_ENABLED"); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			cfg.OIDC.Enabled = b
+		}
+	}
+	if val := os.Getenv("AUTHN_OIDC_ISSUER"); val != "" {
+		cfg.OIDC.Issuer = val
+	}
+	if val := os.Getenv("AUTHN_OIDC_ACCESS_TOKEN_FORMAT"); val != "" {
+		cfg.OIDC.AccessTokenFormat = val
+	}
+	if val := os.Getenv("AUTHN_FEDERATION_CALLBACK_URL"); val != "" {
+		cfg.Federation.CallbackURL = val
+	}
 
 	return cfg, nil
 }
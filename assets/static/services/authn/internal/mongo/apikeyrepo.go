@@ -0,0 +1,211 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// APIKeyMongoRepo implements the APIKeyRepo interface using the database
+// connected by the user repository.
+type APIKeyMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewAPIKeyMongoRepo creates a new MongoDB repository for API keys.
+// It must be started after users.
+func NewAPIKeyMongoRepo(users *UserMongoRepo) *APIKeyMongoRepo {
+	return &APIKeyMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the api_keys collection.
+func (r *APIKeyMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("api_keys")
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "prefix", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "service_account_id", Value: 1}}},
+	}
+
+	if _, err := r.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("cannot create indexes: %w", err)
+	}
+
+	return nil
+}
+
+// apiKeyDocument represents the MongoDB document structure.
+type apiKeyDocument struct {
+	ID               string     `bson:"_id"`
+	ServiceAccountID string     `bson:"service_account_id"`
+	Name             string     `bson:"name"`
+	Prefix           string     `bson:"prefix"`
+	SecretHash       []byte     `bson:"secret_hash"`
+	Scopes           []string   `bson:"scopes"`
+	ExpiresAt        *time.Time `bson:"expires_at,omitempty"`
+	LastUsedAt       *time.Time `bson:"last_used_at,omitempty"`
+	RevokedAt        *time.Time `bson:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `bson:"created_at"`
+}
+
+// Create stores a new APIKey in MongoDB.
+func (r *APIKeyMongoRepo) Create(ctx context.Context, key *authn.APIKey) error {
+	if key == nil {
+		return fmt.Errorf("api key cannot be nil")
+	}
+
+	doc := &apiKeyDocument{
+		ID:               key.ID.String(),
+		ServiceAccountID: key.ServiceAccountID.String(),
+		Name:             key.Name,
+		Prefix:           key.Prefix,
+		SecretHash:       key.SecretHash,
+		Scopes:           key.Scopes,
+		ExpiresAt:        key.ExpiresAt,
+		LastUsedAt:       key.LastUsedAt,
+		RevokedAt:        key.RevokedAt,
+		CreatedAt:        key.CreatedAt,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("error create api key: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves an APIKey by ID from MongoDB.
+func (r *APIKeyMongoRepo) Get(ctx context.Context, id uuid.UUID) (*authn.APIKey, error) {
+	return r.get(ctx, bson.M{"_id": id.String()})
+}
+
+// GetByPrefix retrieves an APIKey by prefix from MongoDB.
+func (r *APIKeyMongoRepo) GetByPrefix(ctx context.Context, prefix string) (*authn.APIKey, error) {
+	return r.get(ctx, bson.M{"prefix": prefix})
+}
+
+func (r *APIKeyMongoRepo) get(ctx context.Context, filter bson.M) (*authn.APIKey, error) {
+	var doc apiKeyDocument
+	err := r.collection.FindOne(ctx, filter).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get api key: %w", err)
+	}
+
+	return fromAPIKeyDocument(&doc)
+}
+
+// ListByServiceAccount retrieves every key of a service account, newest first.
+func (r *APIKeyMongoRepo) ListByServiceAccount(ctx context.Context, accountID uuid.UUID) ([]*authn.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"service_account_id": accountID.String()}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error query api keys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var keys []*authn.APIKey
+	for cursor.Next(ctx) {
+		var doc apiKeyDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("error decode api key: %w", err)
+		}
+
+		key, err := fromAPIKeyDocument(&doc)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// Revoke marks an APIKey revoked, keeping the first revocation.
+func (r *APIKeyMongoRepo) Revoke(ctx context.Context, id uuid.UUID, at time.Time) error {
+	filter := bson.M{
+		"_id":        id.String(),
+		"revoked_at": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"revoked_at": at}}
+
+	if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("error revoke api key: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeByServiceAccount revokes the unrevoked keys of a service account.
+func (r *APIKeyMongoRepo) RevokeByServiceAccount(ctx context.Context, accountID uuid.UUID, at time.Time) error {
+	filter := bson.M{
+		"service_account_id": accountID.String(),
+		"revoked_at":         bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"revoked_at": at}}
+
+	if _, err := r.collection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("error revoke api keys: %w", err)
+	}
+
+	return nil
+}
+
+// Touch records the last time a key was used.
+func (r *APIKeyMongoRepo) Touch(ctx context.Context, id uuid.UUID, at time.Time) error {
+	update := bson.M{"$set": bson.M{"last_used_at": at}}
+
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": id.String()}, update); err != nil {
+		return fmt.Errorf("error touch api key: %w", err)
+	}
+
+	return nil
+}
+
+func fromAPIKeyDocument(doc *apiKeyDocument) (*authn.APIKey, error) {
+	id, err := uuid.Parse(doc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api key ID format: %w", err)
+	}
+
+	accountID, err := uuid.Parse(doc.ServiceAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account ID format: %w", err)
+	}
+
+	return &authn.APIKey{
+		ID:               id,
+		ServiceAccountID: accountID,
+		Name:             doc.Name,
+		Prefix:           doc.Prefix,
+		SecretHash:       doc.SecretHash,
+		Scopes:           doc.Scopes,
+		ExpiresAt:        doc.ExpiresAt,
+		LastUsedAt:       doc.LastUsedAt,
+		RevokedAt:        doc.RevokedAt,
+		CreatedAt:        doc.CreatedAt,
+	}, nil
+}
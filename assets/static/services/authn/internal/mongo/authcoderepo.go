@@ -0,0 +1,137 @@
+package mongo
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// AuthorizationCodeMongoRepo implements the AuthorizationCodeRepo interface
+// using the database connected by the user repository.
+type AuthorizationCodeMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewAuthorizationCodeMongoRepo creates a new MongoDB repository for
+// authorization codes. It must be started after users.
+func NewAuthorizationCodeMongoRepo(users *UserMongoRepo) *AuthorizationCodeMongoRepo {
+	return &AuthorizationCodeMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the authorization_codes collection.
+func (r *AuthorizationCodeMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("authorization_codes")
+
+	index := mongo.IndexModel{Keys: bson.D{{Key: "expires_at", Value: 1}}}
+	if _, err := r.collection.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("cannot create indexes: %w", err)
+	}
+
+	return nil
+}
+
+// authorizationCodeDocument represents the MongoDB document structure. The
+// code hash, hex encoded, is the document ID.
+type authorizationCodeDocument struct {
+	ID            string     `bson:"_id"`
+	ClientID      string     `bson:"client_id"`
+	UserID        string     `bson:"user_id"`
+	RedirectURI   string     `bson:"redirect_uri"`
+	Scopes        []string   `bson:"scopes"`
+	Nonce         string     `bson:"nonce,omitempty"`
+	CodeChallenge string     `bson:"code_challenge"`
+	CreatedAt     time.Time  `bson:"created_at"`
+	ExpiresAt     time.Time  `bson:"expires_at"`
+	UsedAt        *time.Time `bson:"used_at,omitempty"`
+}
+
+// Create stores a new AuthorizationCode in MongoDB.
+func (r *AuthorizationCodeMongoRepo) Create(ctx context.Context, code *authn.AuthorizationCode) error {
+	if code == nil {
+		return fmt.Errorf("authorization code cannot be nil")
+	}
+
+	doc := &authorizationCodeDocument{
+		ID:            hex.EncodeToString(code.Hash),
+		ClientID:      code.ClientID.String(),
+		UserID:        code.UserID.String(),
+		RedirectURI:   code.RedirectURI,
+		Scopes:        code.Scopes,
+		Nonce:         code.Nonce,
+		CodeChallenge: code.CodeChallenge,
+		CreatedAt:     code.CreatedAt,
+		ExpiresAt:     code.ExpiresAt,
+		UsedAt:        code.UsedAt,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("error create authorization code: %w", err)
+	}
+
+	return nil
+}
+
+// Consume marks an unused code used and returns it, or nil if there is none.
+func (r *AuthorizationCodeMongoRepo) Consume(ctx context.Context, hash []byte, at time.Time) (*authn.AuthorizationCode, error) {
+	filter := bson.M{
+		"_id":     hex.EncodeToString(hash),
+		"used_at": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"used_at": at}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var doc authorizationCodeDocument
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error consume authorization code: %w", err)
+	}
+
+	return fromAuthorizationCodeDocument(&doc)
+}
+
+func fromAuthorizationCodeDocument(doc *authorizationCodeDocument) (*authn.AuthorizationCode, error) {
+	hash, err := hex.DecodeString(doc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization code hash format: %w", err)
+	}
+
+	clientID, err := uuid.Parse(doc.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client ID format: %w", err)
+	}
+
+	userID, err := uuid.Parse(doc.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	return &authn.AuthorizationCode{
+		Hash:          hash,
+		ClientID:      clientID,
+		UserID:        userID,
+		RedirectURI:   doc.RedirectURI,
+		Scopes:        doc.Scopes,
+		Nonce:         doc.Nonce,
+		CodeChallenge: doc.CodeChallenge,
+		CreatedAt:     doc.CreatedAt,
+		ExpiresAt:     doc.ExpiresAt,
+		UsedAt:        doc.UsedAt,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// DataKeyMongoRepo implements the DataKeyRepo interface using the database
+// connected by the user repository.
+type DataKeyMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewDataKeyMongoRepo creates a new MongoDB repository for user data keys.
+// It must be started after users.
+func NewDataKeyMongoRepo(users *UserMongoRepo) *DataKeyMongoRepo {
+	return &DataKeyMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the data_keys collection.
+func (r *DataKeyMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("data_keys")
+
+	return nil
+}
+
+// dataKeyDocument represents the MongoDB document structure.
+type dataKeyDocument struct {
+	UserID    string    `bson:"_id"`
+	KeyCT     []byte    `bson:"key_ct"`
+	PIIKeyID  string    `bson:"pii_key_id"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// Create stores the first DataKey of a user.
+func (r *DataKeyMongoRepo) Create(ctx context.Context, key *authn.DataKey) error {
+	if key == nil {
+		return fmt.Errorf("data key cannot be nil")
+	}
+
+	doc := &dataKeyDocument{
+		UserID:    key.UserID.String(),
+		KeyCT:     key.KeyCT,
+		PIIKeyID:  key.PIIKeyID,
+		CreatedAt: key.CreatedAt,
+		UpdatedAt: key.UpdatedAt,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("error create data key: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves the DataKey of a user, or nil if there is none.
+func (r *DataKeyMongoRepo) Get(ctx context.Context, userID uuid.UUID) (*authn.DataKey, error) {
+	var doc dataKeyDocument
+	err := r.collection.FindOne(ctx, bson.M{"_id": userID.String()}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get data key: %w", err)
+	}
+
+	return &authn.DataKey{
+		UserID:    userID,
+		KeyCT:     doc.KeyCT,
+		PIIKeyID:  doc.PIIKeyID,
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+	}, nil
+}
+
+// Save replaces the wrapped key and its PII key ID.
+func (r *DataKeyMongoRepo) Save(ctx context.Context, key *authn.DataKey) error {
+	if key == nil {
+		return fmt.Errorf("data key cannot be nil")
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"key_ct":     key.KeyCT,
+			"pii_key_id": key.PIIKeyID,
+			"updated_at": key.UpdatedAt,
+		},
+	}
+
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": key.UserID.String()}, update); err != nil {
+		return fmt.Errorf("error save data key: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the DataKey of a user.
+func (r *DataKeyMongoRepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": userID.String()}); err != nil {
+		return fmt.Errorf("error delete data key: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// EmailTokenMongoRepo implements the EmailTokenRepo interface using the
+// database connected by the user repository.
+type EmailTokenMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewEmailTokenMongoRepo creates a new MongoDB repository for email tokens.
+// It must be started after users.
+func NewEmailTokenMongoRepo(users *UserMongoRepo) *EmailTokenMongoRepo {
+	return &EmailTokenMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the email_tokens collection.
+func (r *EmailTokenMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("email_tokens")
+
+	index := mongo.IndexModel{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}}
+	if _, err := r.collection.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("cannot create indexes: %w", err)
+	}
+
+	return nil
+}
+
+// emailTokenDocument represents the MongoDB document structure.
+type emailTokenDocument struct {
+	ID        string     `bson:"_id"`
+	UserID    string     `bson:"user_id"`
+	Purpose   string     `bson:"purpose"`
+	CreatedAt time.Time  `bson:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty"`
+}
+
+// Create stores a new EmailToken in MongoDB.
+func (r *EmailTokenMongoRepo) Create(ctx context.Context, token *authn.EmailToken) error {
+	if token == nil {
+		return fmt.Errorf("email token cannot be nil")
+	}
+
+	doc := &emailTokenDocument{
+		ID:        token.ID.String(),
+		UserID:    token.UserID.String(),
+		Purpose:   token.Purpose,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+		UsedAt:    token.UsedAt,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("error create email token: %w", err)
+	}
+
+	return nil
+}
+
+// Use marks an unused, unexpired token as used.
+func (r *EmailTokenMongoRepo) Use(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	filter := bson.M{
+		"_id":        id.String(),
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": at},
+	}
+	update := bson.M{"$set": bson.M{"used_at": at}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error use email token: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// UseAll marks every unused token of a user for purpose as used.
+func (r *EmailTokenMongoRepo) UseAll(ctx context.Context, userID uuid.UUID, purpose string, at time.Time) error {
+	filter := bson.M{
+		"user_id": userID.String(),
+		"purpose": purpose,
+		"used_at": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"used_at": at}}
+
+	if _, err := r.collection.UpdateMany(ctx, filter, update); err != nil {
+		return fmt.Errorf("error use email tokens: %w", err)
+	}
+
+	return nil
+}
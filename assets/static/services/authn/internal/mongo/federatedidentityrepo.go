@@ -0,0 +1,169 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// FederatedIdentityMongoRepo implements the FederatedIdentityRepo interface
+// using the database connected by the user repository.
+type FederatedIdentityMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewFederatedIdentityMongoRepo creates a new MongoDB repository for
+// federated identities. It must be started after users.
+func NewFederatedIdentityMongoRepo(users *UserMongoRepo) *FederatedIdentityMongoRepo {
+	return &FederatedIdentityMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the federated_identities collection.
+func (r *FederatedIdentityMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("federated_identities")
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "provider_id", Value: 1}, {Key: "subject", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	}
+
+	if _, err := r.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("cannot create indexes: %w", err)
+	}
+
+	return nil
+}
+
+// federatedIdentityDocument represents the MongoDB document structure.
+type federatedIdentityDocument struct {
+	ID         string     `bson:"_id"`
+	ProviderID string     `bson:"provider_id"`
+	Subject    string     `bson:"subject"`
+	UserID     string     `bson:"user_id"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty"`
+}
+
+// Create stores a new FederatedIdentity in MongoDB.
+func (r *FederatedIdentityMongoRepo) Create(ctx context.Context, identity *authn.FederatedIdentity) error {
+	if identity == nil {
+		return fmt.Errorf("federated identity cannot be nil")
+	}
+
+	doc := &federatedIdentityDocument{
+		ID:         identity.ID.String(),
+		ProviderID: identity.ProviderID,
+		Subject:    identity.Subject,
+		UserID:     identity.UserID.String(),
+		CreatedAt:  identity.CreatedAt,
+		LastUsedAt: identity.LastUsedAt,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("error create federated identity: %w", err)
+	}
+
+	return nil
+}
+
+// Find retrieves the identity of a provider subject, or nil if there is none.
+func (r *FederatedIdentityMongoRepo) Find(ctx context.Context, providerID, subject string) (*authn.FederatedIdentity, error) {
+	var doc federatedIdentityDocument
+	err := r.collection.FindOne(ctx, bson.M{"provider_id": providerID, "subject": subject}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get federated identity: %w", err)
+	}
+
+	return fromFederatedIdentityDocument(&doc)
+}
+
+// ListByUser retrieves the identities linked to a user, oldest first.
+func (r *FederatedIdentityMongoRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]*authn.FederatedIdentity, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID.String()}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error query federated identities: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var identities []*authn.FederatedIdentity
+	for cursor.Next(ctx) {
+		var doc federatedIdentityDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("error decode federated identity: %w", err)
+		}
+
+		identity, err := fromFederatedIdentityDocument(&doc)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating federated identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+// Touch records that an identity was used to sign in.
+func (r *FederatedIdentityMongoRepo) Touch(ctx context.Context, id uuid.UUID, at time.Time) error {
+	update := bson.M{"$set": bson.M{"last_used_at": at}}
+
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": id.String()}, update); err != nil {
+		return fmt.Errorf("error touch federated identity: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteByUser removes the identities linked to a user.
+func (r *FederatedIdentityMongoRepo) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
+	if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID.String()}); err != nil {
+		return fmt.Errorf("error delete federated identities: %w", err)
+	}
+
+	return nil
+}
+
+func fromFederatedIdentityDocument(doc *federatedIdentityDocument) (*authn.FederatedIdentity, error) {
+	id, err := uuid.Parse(doc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid federated identity ID format: %w", err)
+	}
+
+	userID, err := uuid.Parse(doc.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	return &authn.FederatedIdentity{
+		ID:         id,
+		ProviderID: doc.ProviderID,
+		Subject:    doc.Subject,
+		UserID:     userID,
+		CreatedAt:  doc.CreatedAt,
+		LastUsedAt: doc.LastUsedAt,
+	}, nil
+}
@@ -0,0 +1,109 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// LoginAttemptMongoRepo implements the LoginAttemptRepo interface using the
+// database connected by the user repository.
+type LoginAttemptMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewLoginAttemptMongoRepo creates a new MongoDB repository for login attempts.
+// It must be started after users.
+func NewLoginAttemptMongoRepo(users *UserMongoRepo) *LoginAttemptMongoRepo {
+	return &LoginAttemptMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the login_attempts collection.
+func (r *LoginAttemptMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("login_attempts")
+
+	return nil
+}
+
+// Get retrieves the LoginAttempt of a key, or nil if there is none.
+func (r *LoginAttemptMongoRepo) Get(ctx context.Context, key string) (*authn.LoginAttempt, error) {
+	var attempt authn.LoginAttempt
+	err := r.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&attempt)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get login attempt: %w", err)
+	}
+
+	return &attempt, nil
+}
+
+// RecordFailure adds a failure to key with a single pipeline update.
+func (r *LoginAttemptMongoRepo) RecordFailure(ctx context.Context, key string, at, since time.Time) (*authn.LoginAttempt, error) {
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$gte": bson.A{bson.M{"$ifNull": bson.A{"$last_failure_at", since}}, since}},
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+				1,
+			}},
+			"lockouts":        bson.M{"$ifNull": bson.A{"$lockouts", 0}},
+			"locked_until":    bson.M{"$ifNull": bson.A{"$locked_until", time.Time{}}},
+			"last_failure_at": at,
+		}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var attempt authn.LoginAttempt
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&attempt); err != nil {
+		return nil, fmt.Errorf("error record login failure: %w", err)
+	}
+
+	return &attempt, nil
+}
+
+// Lock locks key if it still has at least limit failures.
+func (r *LoginAttemptMongoRepo) Lock(ctx context.Context, key string, limit int, until time.Time) (int, bool, error) {
+	filter := bson.M{
+		"_id":      key,
+		"failures": bson.M{"$gte": limit},
+	}
+	update := bson.M{
+		"$set": bson.M{"failures": 0, "locked_until": until},
+		"$inc": bson.M{"lockouts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var attempt authn.LoginAttempt
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&attempt)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("error lock login: %w", err)
+	}
+
+	return attempt.Lockouts, true, nil
+}
+
+// Reset forgets the failures and lockouts of key.
+func (r *LoginAttemptMongoRepo) Reset(ctx context.Context, key string) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return fmt.Errorf("error reset login attempts: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// SigningKeyMongoRepo implements the SigningKeyRepo interface using the
+// database connected by the user repository.
+type SigningKeyMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewSigningKeyMongoRepo creates a new MongoDB repository for signing keys.
+// It must be started after users.
+func NewSigningKeyMongoRepo(users *UserMongoRepo) *SigningKeyMongoRepo {
+	return &SigningKeyMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the signing_keys collection.
+func (r *SigningKeyMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("signing_keys")
+
+	statusIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}},
+	}
+
+	if _, err := r.collection.Indexes().CreateOne(ctx, statusIndex); err != nil {
+		return fmt.Errorf("cannot create indexes: %w", err)
+	}
+
+	return nil
+}
+
+// signingKeyDocument represents the MongoDB document structure.
+type signingKeyDocument struct {
+	ID            string    `bson:"_id"`
+	PublicKey     []byte    `bson:"public_key"`
+	PrivateKeyCT  []byte    `bson:"private_key_ct"`
+	PrivateKeyIV  []byte    `bson:"private_key_iv"`
+	PrivateKeyTag []byte    `bson:"private_key_tag"`
+	Status        string    `bson:"status"`
+	CreatedAt     time.Time `bson:"created_at"`
+	RotatedAt     time.Time `bson:"rotated_at,omitempty"`
+	RetiredAt     time.Time `bson:"retired_at,omitempty"`
+}
+
+// Create stores a new SigningKey in MongoDB.
+func (r *SigningKeyMongoRepo) Create(ctx context.Context, key *authn.SigningKey) error {
+	if key == nil {
+		return fmt.Errorf("signing key cannot be nil")
+	}
+
+	doc := &signingKeyDocument{
+		ID:            key.ID,
+		PublicKey:     key.PublicKey,
+		PrivateKeyCT:  key.PrivateKeyCT,
+		PrivateKeyIV:  key.PrivateKeyIV,
+		PrivateKeyTag: key.PrivateKeyTag,
+		Status:        string(key.Status),
+		CreatedAt:     key.CreatedAt,
+		RotatedAt:     key.RotatedAt,
+		RetiredAt:     key.RetiredAt,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("error create signing key: %w", err)
+	}
+
+	return nil
+}
+
+// Save updates the status and timestamps of a SigningKey in MongoDB.
+func (r *SigningKeyMongoRepo) Save(ctx context.Context, key *authn.SigningKey) error {
+	if key == nil {
+		return fmt.Errorf("signing key cannot be nil")
+	}
+
+	filter := bson.M{"_id": key.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     string(key.Status),
+			"rotated_at": key.RotatedAt,
+			"retired_at": key.RetiredAt,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error update signing key: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("signing key %s not found for update", key.ID)
+	}
+
+	return nil
+}
+
+// List retrieves all SigningKeys that are not retired from MongoDB.
+func (r *SigningKeyMongoRepo) List(ctx context.Context) ([]*authn.SigningKey, error) {
+	filter := bson.M{"status": bson.M{"$ne": string(authn.KeyStatusRetired)}}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error query signing keys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var keys []*authn.SigningKey
+	for cursor.Next(ctx) {
+		var doc signingKeyDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("error decode signing key: %w", err)
+		}
+
+		keys = append(keys, &authn.SigningKey{
+			ID:            doc.ID,
+			PublicKey:     doc.PublicKey,
+			PrivateKeyCT:  doc.PrivateKeyCT,
+			PrivateKeyIV:  doc.PrivateKeyIV,
+			PrivateKeyTag: doc.PrivateKeyTag,
+			Status:        authn.KeyStatus(doc.Status),
+			CreatedAt:     doc.CreatedAt,
+			RotatedAt:     doc.RotatedAt,
+			RetiredAt:     doc.RetiredAt,
+		})
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating signing keys: %w", err)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,217 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// APIKeySQLiteRepo implements the APIKeyRepo interface using the database
+// opened by the user repository.
+type APIKeySQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewAPIKeySQLiteRepo creates a new SQLite repository for API keys.
+// It must be started after users.
+func NewAPIKeySQLiteRepo(users *UserSQLiteRepo) *APIKeySQLiteRepo {
+	return &APIKeySQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the api_keys table.
+func (r *APIKeySQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		service_account_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		secret_hash BLOB NOT NULL,
+		scopes TEXT NOT NULL DEFAULT '[]',
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		revoked_at DATETIME,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys(prefix);
+	CREATE INDEX IF NOT EXISTS idx_api_keys_service_account_id ON api_keys(service_account_id);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create api_keys table: %w", err)
+	}
+
+	return nil
+}
+
+const apiKeyColumns = `id, service_account_id, name, prefix, secret_hash, scopes,
+	expires_at, last_used_at, revoked_at, created_at`
+
+// Create stores a new APIKey.
+func (r *APIKeySQLiteRepo) Create(ctx context.Context, key *authn.APIKey) error {
+	if key == nil {
+		return fmt.Errorf("api key cannot be nil")
+	}
+
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return fmt.Errorf("error encode api key scopes: %w", err)
+	}
+
+	query := `INSERT INTO api_keys (` + apiKeyColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err = r.db.ExecContext(ctx, query,
+		key.ID.String(),
+		key.ServiceAccountID.String(),
+		key.Name,
+		key.Prefix,
+		key.SecretHash,
+		string(scopes),
+		key.ExpiresAt,
+		key.LastUsedAt,
+		key.RevokedAt,
+		key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error create api key: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves an APIKey by ID.
+func (r *APIKeySQLiteRepo) Get(ctx context.Context, id uuid.UUID) (*authn.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = ?`
+	return r.get(ctx, query, id.String())
+}
+
+// GetByPrefix retrieves an APIKey by prefix.
+func (r *APIKeySQLiteRepo) GetByPrefix(ctx context.Context, prefix string) (*authn.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = ?`
+	return r.get(ctx, query, prefix)
+}
+
+func (r *APIKeySQLiteRepo) get(ctx context.Context, query string, args ...any) (*authn.APIKey, error) {
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get api key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListByServiceAccount retrieves every key of a service account, newest first.
+func (r *APIKeySQLiteRepo) ListByServiceAccount(ctx context.Context, accountID uuid.UUID) ([]*authn.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys
+	WHERE service_account_id = ?
+	ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, accountID.String())
+	if err != nil {
+		return nil, fmt.Errorf("error query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*authn.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// Revoke marks an APIKey revoked, keeping the first revocation.
+func (r *APIKeySQLiteRepo) Revoke(ctx context.Context, id uuid.UUID, at time.Time) error {
+	query := `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, at, id.String()); err != nil {
+		return fmt.Errorf("error revoke api key: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeByServiceAccount revokes the unrevoked keys of a service account.
+func (r *APIKeySQLiteRepo) RevokeByServiceAccount(ctx context.Context, accountID uuid.UUID, at time.Time) error {
+	query := `UPDATE api_keys SET revoked_at = ? WHERE service_account_id = ? AND revoked_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, at, accountID.String()); err != nil {
+		return fmt.Errorf("error revoke api keys: %w", err)
+	}
+
+	return nil
+}
+
+// Touch records the last time a key was used.
+func (r *APIKeySQLiteRepo) Touch(ctx context.Context, id uuid.UUID, at time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = ? WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, at, id.String()); err != nil {
+		return fmt.Errorf("error touch api key: %w", err)
+	}
+
+	return nil
+}
+
+func scanAPIKey(row rowScanner) (*authn.APIKey, error) {
+	key := &authn.APIKey{}
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&key.ID,
+		&key.ServiceAccountID,
+		&key.Name,
+		&key.Prefix,
+		&key.SecretHash,
+		&scopes,
+		&expiresAt,
+		&lastUsedAt,
+		&revokedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return nil, fmt.Errorf("error decode api key scopes: %w", err)
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+
+	return key, nil
+}
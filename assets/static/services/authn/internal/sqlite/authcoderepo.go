@@ -0,0 +1,150 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// AuthorizationCodeSQLiteRepo implements the AuthorizationCodeRepo interface
+// using the database opened by the user repository.
+type AuthorizationCodeSQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewAuthorizationCodeSQLiteRepo creates a new SQLite repository for
+// authorization codes. It must be started after users.
+func NewAuthorizationCodeSQLiteRepo(users *UserSQLiteRepo) *AuthorizationCodeSQLiteRepo {
+	return &AuthorizationCodeSQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the authorization_codes table.
+func (r *AuthorizationCodeSQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS authorization_codes (
+		hash BLOB PRIMARY KEY,
+		client_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		redirect_uri TEXT NOT NULL,
+		scopes TEXT NOT NULL DEFAULT '[]',
+		nonce TEXT NOT NULL DEFAULT '',
+		code_challenge TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_authorization_codes_expires_at ON authorization_codes(expires_at);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create authorization_codes table: %w", err)
+	}
+
+	return nil
+}
+
+const authorizationCodeColumns = `hash, client_id, user_id, redirect_uri, scopes, nonce,
+	code_challenge, created_at, expires_at, used_at`
+
+// Create stores a new AuthorizationCode.
+func (r *AuthorizationCodeSQLiteRepo) Create(ctx context.Context, code *authn.AuthorizationCode) error {
+	if code == nil {
+		return fmt.Errorf("authorization code cannot be nil")
+	}
+
+	scopes, err := json.Marshal(code.Scopes)
+	if err != nil {
+		return fmt.Errorf("error encode authorization code scopes: %w", err)
+	}
+
+	query := `INSERT INTO authorization_codes (` + authorizationCodeColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err = r.db.ExecContext(ctx, query,
+		code.Hash,
+		code.ClientID.String(),
+		code.UserID.String(),
+		code.RedirectURI,
+		string(scopes),
+		code.Nonce,
+		code.CodeChallenge,
+		code.CreatedAt,
+		code.ExpiresAt,
+		code.UsedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error create authorization code: %w", err)
+	}
+
+	return nil
+}
+
+// Consume marks an unused code used and returns it, or nil if there is none.
+func (r *AuthorizationCodeSQLiteRepo) Consume(ctx context.Context, hash []byte, at time.Time) (*authn.AuthorizationCode, error) {
+	query := `UPDATE authorization_codes SET used_at = ? WHERE hash = ? AND used_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, at, hash)
+	if err != nil {
+		return nil, fmt.Errorf("error consume authorization code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error get rows affected: %w", err)
+	}
+	if rowsAffected != 1 {
+		return nil, nil
+	}
+
+	query = `SELECT ` + authorizationCodeColumns + ` FROM authorization_codes WHERE hash = ?`
+
+	code, err := scanAuthorizationCode(r.db.QueryRowContext(ctx, query, hash))
+	if err != nil {
+		return nil, fmt.Errorf("could not get authorization code: %w", err)
+	}
+
+	return code, nil
+}
+
+func scanAuthorizationCode(row rowScanner) (*authn.AuthorizationCode, error) {
+	code := &authn.AuthorizationCode{}
+	var scopes string
+	var usedAt sql.NullTime
+
+	err := row.Scan(
+		&code.Hash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&scopes,
+		&code.Nonce,
+		&code.CodeChallenge,
+		&code.CreatedAt,
+		&code.ExpiresAt,
+		&usedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(scopes), &code.Scopes); err != nil {
+		return nil, fmt.Errorf("error decode authorization code scopes: %w", err)
+	}
+	if usedAt.Valid {
+		code.UsedAt = &usedAt.Time
+	}
+
+	return code, nil
+}
@@ -0,0 +1,168 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// FederatedIdentitySQLiteRepo implements the FederatedIdentityRepo interface
+// using the database opened by the user repository.
+type FederatedIdentitySQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewFederatedIdentitySQLiteRepo creates a new SQLite repository for
+// federated identities. It must be started after users.
+func NewFederatedIdentitySQLiteRepo(users *UserSQLiteRepo) *FederatedIdentitySQLiteRepo {
+	return &FederatedIdentitySQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the federated_identities table.
+func (r *FederatedIdentitySQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS federated_identities (
+		id TEXT PRIMARY KEY,
+		provider_id TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_used_at DATETIME
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_federated_identities_provider_subject ON federated_identities(provider_id, subject);
+	CREATE INDEX IF NOT EXISTS idx_federated_identities_user_id ON federated_identities(user_id);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create federated_identities table: %w", err)
+	}
+
+	return nil
+}
+
+const federatedIdentityColumns = `id, provider_id, subject, user_id, created_at, last_used_at`
+
+// Create stores a new FederatedIdentity.
+func (r *FederatedIdentitySQLiteRepo) Create(ctx context.Context, identity *authn.FederatedIdentity) error {
+	if identity == nil {
+		return fmt.Errorf("federated identity cannot be nil")
+	}
+
+	query := `INSERT INTO federated_identities (` + federatedIdentityColumns + `) VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err := r.db.ExecContext(ctx, query,
+		identity.ID.String(),
+		identity.ProviderID,
+		identity.Subject,
+		identity.UserID.String(),
+		identity.CreatedAt,
+		identity.LastUsedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error create federated identity: %w", err)
+	}
+
+	return nil
+}
+
+// Find retrieves the identity of a provider subject, or nil if there is none.
+func (r *FederatedIdentitySQLiteRepo) Find(ctx context.Context, providerID, subject string) (*authn.FederatedIdentity, error) {
+	query := `SELECT ` + federatedIdentityColumns + ` FROM federated_identities WHERE provider_id = ? AND subject = ?`
+
+	identity, err := scanFederatedIdentity(r.db.QueryRowContext(ctx, query, providerID, subject))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get federated identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+// ListByUser retrieves the identities linked to a user, oldest first.
+func (r *FederatedIdentitySQLiteRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]*authn.FederatedIdentity, error) {
+	query := `SELECT ` + federatedIdentityColumns + ` FROM federated_identities
+	WHERE user_id = ?
+	ORDER BY created_at ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("error query federated identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []*authn.FederatedIdentity
+	for rows.Next() {
+		identity, err := scanFederatedIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scan federated identity: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating federated identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+// Touch records that an identity was used to sign in.
+func (r *FederatedIdentitySQLiteRepo) Touch(ctx context.Context, id uuid.UUID, at time.Time) error {
+	query := `UPDATE federated_identities SET last_used_at = ? WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, at, id.String()); err != nil {
+		return fmt.Errorf("error touch federated identity: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteByUser removes the identities linked to a user.
+func (r *FederatedIdentitySQLiteRepo) DeleteByUser(ctx context.Context, userID uuid.UUID) error {
+	query := `DELETE FROM federated_identities WHERE user_id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, userID.String()); err != nil {
+		return fmt.Errorf("error delete federated identities: %w", err)
+	}
+
+	return nil
+}
+
+func scanFederatedIdentity(row rowScanner) (*authn.FederatedIdentity, error) {
+	identity := &authn.FederatedIdentity{}
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&identity.ID,
+		&identity.ProviderID,
+		&identity.Subject,
+		&identity.UserID,
+		&identity.CreatedAt,
+		&lastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastUsedAt.Valid {
+		identity.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,235 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// MFASQLiteRepo implements the MFARepo interface using the database opened
+// by the user repository.
+type MFASQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewMFASQLiteRepo creates a new SQLite repository for MFA records.
+// It must be started after users.
+func NewMFASQLiteRepo(users *UserSQLiteRepo) *MFASQLiteRepo {
+	return &MFASQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the mfa and mfa_recovery_codes tables.
+func (r *MFASQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS mfa (
+		user_id TEXT PRIMARY KEY,
+		pending_secret_ct BLOB,
+		pending_data_key BOOLEAN NOT NULL DEFAULT 0,
+		pending_expires_at DATETIME,
+		last_step INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+		user_id TEXT NOT NULL,
+		code_hash BLOB NOT NULL,
+		PRIMARY KEY (user_id, code_hash)
+	);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create mfa tables: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves the MFARecord of a user, or nil if there is none.
+func (r *MFASQLiteRepo) Get(ctx context.Context, userID uuid.UUID) (*authn.MFARecord, error) {
+	query := `SELECT user_id, pending_secret_ct, pending_data_key, pending_expires_at, last_step, updated_at
+	FROM mfa WHERE user_id = ?`
+
+	record := &authn.MFARecord{}
+	var pendingExpiresAt sql.NullTime
+
+	err := r.db.QueryRowContext(ctx, query, userID.String()).Scan(
+		&record.UserID,
+		&record.PendingSecretCT,
+		&record.PendingDataKey,
+		&pendingExpiresAt,
+		&record.LastStep,
+		&record.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get mfa record: %w", err)
+	}
+	record.PendingExpiresAt = pendingExpiresAt.Time
+
+	rows, err := r.db.QueryContext(ctx, `SELECT code_hash FROM mfa_recovery_codes WHERE user_id = ?`, userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("error query recovery codes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("error scan recovery code: %w", err)
+		}
+		record.RecoveryHashes = append(record.RecoveryHashes, hash)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recovery codes: %w", err)
+	}
+
+	return record, nil
+}
+
+// Save creates or replaces the MFARecord of a user, recovery codes included.
+func (r *MFASQLiteRepo) Save(ctx context.Context, record *authn.MFARecord) error {
+	if record == nil {
+		return fmt.Errorf("mfa record cannot be nil")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO mfa (user_id, pending_secret_ct, pending_data_key, pending_expires_at, last_step, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(user_id) DO UPDATE SET
+		pending_secret_ct = excluded.pending_secret_ct,
+		pending_data_key = excluded.pending_data_key,
+		pending_expires_at = excluded.pending_expires_at,
+		last_step = excluded.last_step,
+		updated_at = excluded.updated_at
+	`
+
+	_, err = tx.ExecContext(ctx, query,
+		record.UserID.String(),
+		record.PendingSecretCT,
+		record.PendingDataKey,
+		nullTime(record.PendingExpiresAt),
+		record.LastStep,
+		record.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error save mfa record: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = ?`, record.UserID.String()); err != nil {
+		return fmt.Errorf("error delete recovery codes: %w", err)
+	}
+
+	for _, hash := range record.RecoveryHashes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)`, record.UserID.String(), hash)
+		if err != nil {
+			return fmt.Errorf("error insert recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error commit mfa record: %w", err)
+	}
+
+	return nil
+}
+
+// SavePendingSecret updates the pending secret of an MFARecord still holding
+// previous.
+func (r *MFASQLiteRepo) SavePendingSecret(ctx context.Context, record *authn.MFARecord, previous []byte) (bool, error) {
+	query := `UPDATE mfa SET pending_secret_ct = ?, pending_data_key = ? WHERE user_id = ? AND pending_secret_ct = ?`
+
+	result, err := r.db.ExecContext(ctx, query,
+		record.PendingSecretCT,
+		record.PendingDataKey,
+		record.UserID.String(),
+		previous,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error update pending mfa secret: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error get rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// Delete removes the MFARecord of a user.
+func (r *MFASQLiteRepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID.String()); err != nil {
+		return fmt.Errorf("error delete recovery codes: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa WHERE user_id = ?`, userID.String()); err != nil {
+		return fmt.Errorf("error delete mfa record: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error commit mfa delete: %w", err)
+	}
+
+	return nil
+}
+
+// UseStep records step as the last accepted TOTP step if it is newer.
+func (r *MFASQLiteRepo) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	query := `UPDATE mfa SET last_step = ? WHERE user_id = ? AND last_step < ?`
+
+	result, err := r.db.ExecContext(ctx, query, step, userID.String(), step)
+	if err != nil {
+		return false, fmt.Errorf("error use mfa step: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error get rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode removes a recovery code hash and reports whether it existed.
+func (r *MFASQLiteRepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash []byte) (bool, error) {
+	query := `DELETE FROM mfa_recovery_codes WHERE user_id = ? AND code_hash = ?`
+
+	result, err := r.db.ExecContext(ctx, query, userID.String(), hash)
+	if err != nil {
+		return false, fmt.Errorf("error use recovery code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error get rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
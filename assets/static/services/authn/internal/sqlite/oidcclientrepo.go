@@ -0,0 +1,157 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// OIDCClientSQLiteRepo implements the OIDCClientRepo interface using the
+// database opened by the user repository.
+type OIDCClientSQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewOIDCClientSQLiteRepo creates a new SQLite repository for OIDC clients.
+// It must be started after users.
+func NewOIDCClientSQLiteRepo(users *UserSQLiteRepo) *OIDCClientSQLiteRepo {
+	return &OIDCClientSQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the oidc_clients table.
+func (r *OIDCClientSQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS oidc_clients (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		redirect_uris TEXT NOT NULL DEFAULT '[]',
+		public INTEGER NOT NULL DEFAULT 0,
+		secret_hash BLOB,
+		created_at DATETIME NOT NULL
+	);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create oidc_clients table: %w", err)
+	}
+
+	return nil
+}
+
+const oidcClientColumns = `id, name, redirect_uris, public, secret_hash, created_at`
+
+// Create stores a new OIDCClient.
+func (r *OIDCClientSQLiteRepo) Create(ctx context.Context, client *authn.OIDCClient) error {
+	if client == nil {
+		return fmt.Errorf("oidc client cannot be nil")
+	}
+
+	redirectURIs, err := json.Marshal(client.RedirectURIs)
+	if err != nil {
+		return fmt.Errorf("error encode oidc client redirect uris: %w", err)
+	}
+
+	query := `INSERT INTO oidc_clients (` + oidcClientColumns + `) VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err = r.db.ExecContext(ctx, query,
+		client.ID.String(),
+		client.Name,
+		string(redirectURIs),
+		client.Public,
+		client.SecretHash,
+		client.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error create oidc client: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves an OIDCClient by ID, or nil if there is none.
+func (r *OIDCClientSQLiteRepo) Get(ctx context.Context, id uuid.UUID) (*authn.OIDCClient, error) {
+	query := `SELECT ` + oidcClientColumns + ` FROM oidc_clients WHERE id = ?`
+
+	client, err := scanOIDCClient(r.db.QueryRowContext(ctx, query, id.String()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get oidc client: %w", err)
+	}
+
+	return client, nil
+}
+
+// List retrieves all OIDC clients by name.
+func (r *OIDCClientSQLiteRepo) List(ctx context.Context) ([]*authn.OIDCClient, error) {
+	query := `SELECT ` + oidcClientColumns + ` FROM oidc_clients ORDER BY name`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error query oidc clients: %w", err)
+	}
+	defer rows.Close()
+
+	var clients []*authn.OIDCClient
+	for rows.Next() {
+		client, err := scanOIDCClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scan oidc client: %w", err)
+		}
+		clients = append(clients, client)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating oidc clients: %w", err)
+	}
+
+	return clients, nil
+}
+
+// Delete removes an OIDCClient.
+func (r *OIDCClientSQLiteRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM oidc_clients WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, id.String()); err != nil {
+		return fmt.Errorf("error delete oidc client: %w", err)
+	}
+
+	return nil
+}
+
+func scanOIDCClient(row rowScanner) (*authn.OIDCClient, error) {
+	client := &authn.OIDCClient{}
+	var redirectURIs string
+
+	err := row.Scan(
+		&client.ID,
+		&client.Name,
+		&redirectURIs,
+		&client.Public,
+		&client.SecretHash,
+		&client.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(redirectURIs), &client.RedirectURIs); err != nil {
+		return nil, fmt.Errorf("error decode oidc client redirect uris: %w", err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,170 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	authpkg "github.com/username/repo/pkg/lib/auth"
+	"github.com/username/repo/services/authn/internal/authn"
+)
+
+// ServiceAccountSQLiteRepo implements the ServiceAccountRepo interface using
+// the database opened by the user repository.
+type ServiceAccountSQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewServiceAccountSQLiteRepo creates a new SQLite repository for service accounts.
+// It must be started after users.
+func NewServiceAccountSQLiteRepo(users *UserSQLiteRepo) *ServiceAccountSQLiteRepo {
+	return &ServiceAccountSQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the service_accounts table.
+func (r *ServiceAccountSQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS service_accounts (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME NOT NULL,
+		updated_by TEXT NOT NULL DEFAULT ''
+	);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create service_accounts table: %w", err)
+	}
+
+	return nil
+}
+
+const serviceAccountColumns = `id, name, description, status, created_at, created_by, updated_at, updated_by`
+
+// Create stores a new ServiceAccount.
+func (r *ServiceAccountSQLiteRepo) Create(ctx context.Context, account *authn.ServiceAccount) error {
+	if account == nil {
+		return fmt.Errorf("service account cannot be nil")
+	}
+
+	query := `INSERT INTO service_accounts (` + serviceAccountColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := r.db.ExecContext(ctx, query,
+		account.ID.String(),
+		account.Name,
+		account.Description,
+		string(account.Status),
+		account.CreatedAt,
+		account.CreatedBy,
+		account.UpdatedAt,
+		account.UpdatedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("error create service account: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves a ServiceAccount by ID, or nil if there is none.
+func (r *ServiceAccountSQLiteRepo) Get(ctx context.Context, id uuid.UUID) (*authn.ServiceAccount, error) {
+	query := `SELECT ` + serviceAccountColumns + ` FROM service_accounts WHERE id = ?`
+
+	account, err := scanServiceAccount(r.db.QueryRowContext(ctx, query, id.String()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get service account: %w", err)
+	}
+
+	return account, nil
+}
+
+// List retrieves all service accounts by name.
+func (r *ServiceAccountSQLiteRepo) List(ctx context.Context) ([]*authn.ServiceAccount, error) {
+	query := `SELECT ` + serviceAccountColumns + ` FROM service_accounts ORDER BY name`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error query service accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []*authn.ServiceAccount
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scan service account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating service accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// Save updates the name, description and status of a ServiceAccount.
+func (r *ServiceAccountSQLiteRepo) Save(ctx context.Context, account *authn.ServiceAccount) error {
+	if account == nil {
+		return fmt.Errorf("service account cannot be nil")
+	}
+
+	query := `
+	UPDATE service_accounts SET name = ?, description = ?, status = ?, updated_at = ?, updated_by = ?
+	WHERE id = ?
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		account.Name,
+		account.Description,
+		string(account.Status),
+		account.UpdatedAt,
+		account.UpdatedBy,
+		account.ID.String(),
+	)
+	if err != nil {
+		return fmt.Errorf("error save service account: %w", err)
+	}
+
+	return nil
+}
+
+func scanServiceAccount(row rowScanner) (*authn.ServiceAccount, error) {
+	account := &authn.ServiceAccount{}
+	var status string
+
+	err := row.Scan(
+		&account.ID,
+		&account.Name,
+		&account.Description,
+		&status,
+		&account.CreatedAt,
+		&account.CreatedBy,
+		&account.UpdatedAt,
+		&account.UpdatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	account.Status = authpkg.UserStatus(status)
+	return account, nil
+}
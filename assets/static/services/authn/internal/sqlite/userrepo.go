@@ -60,6 +60,14 @@ func (r *UserSQLiteRepo) Stop(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheck pings the database.
+func (r *UserSQLiteRepo) HealthCheck(ctx context.Context) error {
+	if r.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	return r.db.PingContext(ctx)
+}
+
 // createUsersTable creates the users table with proper schema
 func (r *UserSQLiteRepo) createUsersTable(ctx context.Context) error {
 	query := `
@@ -69,9 +77,14 @@ func (r *UserSQLiteRepo) createUsersTable(ctx context.Context) error {
 		email_iv BLOB,
 		email_tag BLOB,
 		email_lookup BLOB NOT NULL,
+		pii_key_id TEXT NOT NULL DEFAULT '',
+		email_data_key BOOLEAN NOT NULL DEFAULT 0,
 		password_hash BLOB NOT NULL,
 		password_salt BLOB NOT NULL,
 		mfa_secret_ct BLOB,
+		mfa_data_key BOOLEAN NOT NULL DEFAULT 0,
+		email_verified_at DATETIME,
+		erased_at DATETIME,
 		status TEXT NOT NULL DEFAULT 'active',
 		created_at DATETIME NOT NULL,
 		created_by TEXT DEFAULT '',
@@ -81,6 +94,7 @@ func (r *UserSQLiteRepo) createUsersTable(ctx context.Context) error {
 
 	CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lookup ON users(email_lookup);
 	CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
+	CREATE INDEX IF NOT EXISTS idx_users_pii_key_id ON users(pii_key_id, id);
 	CREATE INDEX IF NOT EXISTS idx_users_created_at ON users(created_at);
 	`
 
@@ -102,10 +116,10 @@ func (r *UserSQLiteRepo) Create(ctx context.Context, user *authn.User) error {
 
 	query := `
 	INSERT INTO users (
-		id, email_ct, email_iv, email_tag, email_lookup,
-		password_hash, password_salt, mfa_secret_ct, status,
+		id, email_ct, email_iv, email_tag, email_lookup, pii_key_id, email_data_key,
+		password_hash, password_salt, mfa_secret_ct, mfa_data_key, email_verified_at, erased_at, status,
 		created_at, created_by, updated_at, updated_by
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
@@ -114,9 +128,14 @@ func (r *UserSQLiteRepo) Create(ctx context.Context, user *authn.User) error {
 		user.EmailIV,
 		user.EmailTag,
 		user.EmailLookup,
+		user.PIIKeyID,
+		user.EmailDataKey,
 		user.PasswordHash,
 		user.PasswordSalt,
 		user.MFASecretCT,
+		user.MFADataKey,
+		user.EmailVerifiedAt,
+		user.ErasedAt,
 		string(user.Status),
 		user.CreatedAt,
 		user.CreatedBy,
@@ -134,14 +153,16 @@ func (r *UserSQLiteRepo) Create(ctx context.Context, user *authn.User) error {
 // Get retrieves a User by ID from SQLite.
 func (r *UserSQLiteRepo) Get(ctx context.Context, id uuid.UUID) (*authn.User, error) {
 	query := `
-	SELECT id, email_ct, email_iv, email_tag, email_lookup,
-	       password_hash, password_salt, mfa_secret_ct, status,
+	SELECT id, email_ct, email_iv, email_tag, email_lookup, pii_key_id, email_data_key,
+	       password_hash, password_salt, mfa_secret_ct, mfa_data_key, email_verified_at, erased_at, status,
 	       created_at, created_by, updated_at, updated_by
 	FROM users WHERE id = ?
 	`
 
 	user := &authn.User{}
 	var statusStr string
+	var verifiedAt sql.NullTime
+	var erasedAt sql.NullTime
 
 	err := r.db.QueryRowContext(ctx, query, id.String()).Scan(
 		&user.ID,
@@ -149,9 +170,14 @@ func (r *UserSQLiteRepo) Get(ctx context.Context, id uuid.UUID) (*authn.User, er
 		&user.EmailIV,
 		&user.EmailTag,
 		&user.EmailLookup,
+		&user.PIIKeyID,
+		&user.EmailDataKey,
 		&user.PasswordHash,
 		&user.PasswordSalt,
 		&user.MFASecretCT,
+		&user.MFADataKey,
+		&verifiedAt,
+		&erasedAt,
 		&statusStr,
 		&user.CreatedAt,
 		&user.CreatedBy,
@@ -168,6 +194,12 @@ func (r *UserSQLiteRepo) Get(ctx context.Context, id uuid.UUID) (*authn.User, er
 
 	// Convert status string back to enum type
 	user.Status = authpkg.UserStatus(statusStr)
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+	if erasedAt.Valid {
+		user.ErasedAt = &erasedAt.Time
+	}
 
 	return user, nil
 }
@@ -175,14 +207,16 @@ func (r *UserSQLiteRepo) Get(ctx context.Context, id uuid.UUID) (*authn.User, er
 // GetByEmailLookup retrieves a User by encrypted email lookup hash.
 func (r *UserSQLiteRepo) GetByEmailLookup(ctx context.Context, lookup []byte) (*authn.User, error) {
 	query := `
-	SELECT id, email_ct, email_iv, email_tag, email_lookup,
-	       password_hash, password_salt, mfa_secret_ct, status,
+	SELECT id, email_ct, email_iv, email_tag, email_lookup, pii_key_id, email_data_key,
+	       password_hash, password_salt, mfa_secret_ct, mfa_data_key, email_verified_at, erased_at, status,
 	       created_at, created_by, updated_at, updated_by
 	FROM users WHERE email_lookup = ?
 	`
 
 	user := &authn.User{}
 	var statusStr string
+	var verifiedAt sql.NullTime
+	var erasedAt sql.NullTime
 
 	err := r.db.QueryRowContext(ctx, query, lookup).Scan(
 		&user.ID,
@@ -190,9 +224,14 @@ func (r *UserSQLiteRepo) GetByEmailLookup(ctx context.Context, lookup []byte) (*
 		&user.EmailIV,
 		&user.EmailTag,
 		&user.EmailLookup,
+		&user.PIIKeyID,
+		&user.EmailDataKey,
 		&user.PasswordHash,
 		&user.PasswordSalt,
 		&user.MFASecretCT,
+		&user.MFADataKey,
+		&verifiedAt,
+		&erasedAt,
 		&statusStr,
 		&user.CreatedAt,
 		&user.CreatedBy,
@@ -209,6 +248,12 @@ func (r *UserSQLiteRepo) GetByEmailLookup(ctx context.Context, lookup []byte) (*
 
 	// Convert status string back to enum type
 	user.Status = authpkg.UserStatus(statusStr)
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+	if erasedAt.Valid {
+		user.ErasedAt = &erasedAt.Time
+	}
 
 	return user, nil
 }
@@ -223,8 +268,8 @@ func (r *UserSQLiteRepo) Save(ctx context.Context, user *authn.User) error {
 
 	query := `
 	UPDATE users SET
-		email_ct = ?, email_iv = ?, email_tag = ?, email_lookup = ?,
-		password_hash = ?, password_salt = ?, mfa_secret_ct = ?, status = ?,
+		email_ct = ?, email_iv = ?, email_tag = ?, email_lookup = ?, pii_key_id = ?, email_data_key = ?,
+		password_hash = ?, password_salt = ?, mfa_secret_ct = ?, mfa_data_key = ?, email_verified_at = ?, erased_at = ?, status = ?,
 		updated_at = ?, updated_by = ?
 	WHERE id = ?
 	`
@@ -234,9 +279,14 @@ func (r *UserSQLiteRepo) Save(ctx context.Context, user *authn.User) error {
 		user.EmailIV,
 		user.EmailTag,
 		user.EmailLookup,
+		user.PIIKeyID,
+		user.EmailDataKey,
 		user.PasswordHash,
 		user.PasswordSalt,
 		user.MFASecretCT,
+		user.MFADataKey,
+		user.EmailVerifiedAt,
+		user.ErasedAt,
 		string(user.Status),
 		user.UpdatedAt,
 		user.UpdatedBy,
@@ -288,8 +338,8 @@ func (r *UserSQLiteRepo) Delete(ctx context.Context, id uuid.UUID) error {
 // List retrieves all active Users from SQLite.
 func (r *UserSQLiteRepo) List(ctx context.Context) ([]*authn.User, error) {
 	query := `
-	SELECT id, email_ct, email_iv, email_tag, email_lookup,
-	       password_hash, password_salt, mfa_secret_ct, status,
+	SELECT id, email_ct, email_iv, email_tag, email_lookup, pii_key_id, email_data_key,
+	       password_hash, password_salt, mfa_secret_ct, mfa_data_key, email_verified_at, erased_at, status,
 	       created_at, created_by, updated_at, updated_by
 	FROM users WHERE status != 'deleted'
 	ORDER BY created_at DESC
@@ -306,6 +356,8 @@ func (r *UserSQLiteRepo) List(ctx context.Context) ([]*authn.User, error) {
 	for rows.Next() {
 		user := &authn.User{}
 		var statusStr string
+		var verifiedAt sql.NullTime
+		var erasedAt sql.NullTime
 
 		err := rows.Scan(
 			&user.ID,
@@ -313,9 +365,14 @@ func (r *UserSQLiteRepo) List(ctx context.Context) ([]*authn.User, error) {
 			&user.EmailIV,
 			&user.EmailTag,
 			&user.EmailLookup,
+			&user.PIIKeyID,
+			&user.EmailDataKey,
 			&user.PasswordHash,
 			&user.PasswordSalt,
 			&user.MFASecretCT,
+			&user.MFADataKey,
+			&verifiedAt,
+			&erasedAt,
 			&statusStr,
 			&user.CreatedAt,
 			&user.CreatedBy,
@@ -328,6 +385,12 @@ func (r *UserSQLiteRepo) List(ctx context.Context) ([]*authn.User, error) {
 		}
 
 		user.Status = authpkg.UserStatus(statusStr)
+		if verifiedAt.Valid {
+			user.EmailVerifiedAt = &verifiedAt.Time
+		}
+		if erasedAt.Valid {
+			user.ErasedAt = &erasedAt.Time
+		}
 		users = append(users, user)
 	}
 
@@ -341,8 +404,8 @@ func (r *UserSQLiteRepo) List(ctx context.Context) ([]*authn.User, error) {
 // ListByStatus retrieves Users filtered by status from SQLite.
 func (r *UserSQLiteRepo) ListByStatus(ctx context.Context, status string) ([]*authn.User, error) {
 	query := `
-	SELECT id, email_ct, email_iv, email_tag, email_lookup,
-	       password_hash, password_salt, mfa_secret_ct, status,
+	SELECT id, email_ct, email_iv, email_tag, email_lookup, pii_key_id, email_data_key,
+	       password_hash, password_salt, mfa_secret_ct, mfa_data_key, email_verified_at, erased_at, status,
 	       created_at, created_by, updated_at, updated_by
 	FROM users WHERE status = ?
 	ORDER BY created_at DESC
@@ -359,6 +422,8 @@ func (r *UserSQLiteRepo) ListByStatus(ctx context.Context, status string) ([]*au
 	for rows.Next() {
 		user := &authn.User{}
 		var statusStr string
+		var verifiedAt sql.NullTime
+		var erasedAt sql.NullTime
 
 		err := rows.Scan(
 			&user.ID,
@@ -366,9 +431,14 @@ func (r *UserSQLiteRepo) ListByStatus(ctx context.Context, status string) ([]*au
 			&user.EmailIV,
 			&user.EmailTag,
 			&user.EmailLookup,
+			&user.PIIKeyID,
+			&user.EmailDataKey,
 			&user.PasswordHash,
 			&user.PasswordSalt,
 			&user.MFASecretCT,
+			&user.MFADataKey,
+			&verifiedAt,
+			&erasedAt,
 			&statusStr,
 			&user.CreatedAt,
 			&user.CreatedBy,
@@ -381,6 +451,12 @@ func (r *UserSQLiteRepo) ListByStatus(ctx context.Context, status string) ([]*au
 		}
 
 		user.Status = authpkg.UserStatus(statusStr)
+		if verifiedAt.Valid {
+			user.EmailVerifiedAt = &verifiedAt.Time
+		}
+		if erasedAt.Valid {
+			user.ErasedAt = &erasedAt.Time
+		}
 		users = append(users, user)
 	}
 
@@ -389,4 +465,130 @@ func (r *UserSQLiteRepo) ListByStatus(ctx context.Context, status string) ([]*au
 	}
 
 	return users, nil
-}
\ No newline at end of file
+}
+// SavePII updates the encrypted email, lookup hash and PII key ID of a User
+// still under previousKeyID.
+func (r *UserSQLiteRepo) SavePII(ctx context.Context, user *authn.User, previousKeyID string) (bool, error) {
+	query := `
+	UPDATE users SET
+		email_ct = ?, email_iv = ?, email_tag = ?, email_lookup = ?, pii_key_id = ?, email_data_key = ?
+	WHERE id = ? AND pii_key_id = ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		user.EmailCT,
+		user.EmailIV,
+		user.EmailTag,
+		user.EmailLookup,
+		user.PIIKeyID,
+		user.EmailDataKey,
+		user.ID.String(),
+		previousKeyID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error update user pii: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not get rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// SaveMFASecret updates the MFA secret of a User still holding previous.
+func (r *UserSQLiteRepo) SaveMFASecret(ctx context.Context, user *authn.User, previous []byte) (bool, error) {
+	query := `UPDATE users SET mfa_secret_ct = ?, mfa_data_key = ? WHERE id = ? AND mfa_secret_ct = ?`
+
+	result, err := r.db.ExecContext(ctx, query,
+		user.MFASecretCT,
+		user.MFADataKey,
+		user.ID.String(),
+		previous,
+	)
+	if err != nil {
+		return false, fmt.Errorf("error update user mfa secret: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not get rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// ListForRekey retrieves up to limit Users whose PII is not under keyID or
+// whose email or MFA secret is not sealed with their data key, ordered by ID
+// after the given one. Erased users are left out.
+func (r *UserSQLiteRepo) ListForRekey(ctx context.Context, keyID string, after uuid.UUID, limit int) ([]*authn.User, error) {
+	query := `
+	SELECT id, email_ct, email_iv, email_tag, email_lookup, pii_key_id, email_data_key,
+	       password_hash, password_salt, mfa_secret_ct, mfa_data_key, email_verified_at, erased_at, status,
+	       created_at, created_by, updated_at, updated_by
+	FROM users WHERE (pii_key_id != ? OR email_data_key = 0 OR (mfa_secret_ct IS NOT NULL AND mfa_data_key = 0))
+	      AND erased_at IS NULL AND id > ?
+	ORDER BY id
+	LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, keyID, after.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error query users for rekey: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*authn.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users for rekey: %w", err)
+	}
+
+	return users, nil
+}
+
+func scanUser(row rowScanner) (*authn.User, error) {
+	user := &authn.User{}
+	var statusStr string
+	var verifiedAt sql.NullTime
+	var erasedAt sql.NullTime
+
+	err := row.Scan(
+		&user.ID,
+		&user.EmailCT,
+		&user.EmailIV,
+		&user.EmailTag,
+		&user.EmailLookup,
+		&user.PIIKeyID,
+		&user.EmailDataKey,
+		&user.PasswordHash,
+		&user.PasswordSalt,
+		&user.MFASecretCT,
+		&user.MFADataKey,
+		&verifiedAt,
+		&erasedAt,
+		&statusStr,
+		&user.CreatedAt,
+		&user.CreatedBy,
+		&user.UpdatedAt,
+		&user.UpdatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Status = authpkg.UserStatus(statusStr)
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+	if erasedAt.Valid {
+		user.ErasedAt = &erasedAt.Time
+	}
+	return user, nil
+}
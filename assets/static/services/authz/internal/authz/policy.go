@@ -3,22 +3,57 @@ package authz
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	authpkg "github.com/username/repo/pkg/lib/auth"
 )
 
-// PolicyEngine evaluates permissions based on grants and roles
+// PolicyEngine evaluates permissions based on grants and roles. Permissions
+// match as in the auth library: wildcards, implications and inherited roles
+// included. The effective permissions of roles are cached until the policy
+// version moves or for rolesTTL, as a bound should a bump get lost.
+// Grants on a scope also apply to the scopes below it, as resolved by the
+// scope resolver. Ancestries are cached until the policy version moves or
+// for ancestryTTL, as resolvers of other services don't bump it.
 type PolicyEngine struct {
 	roleRepo  RoleRepo
 	grantRepo GrantRepo
+	version   *PolicyVersion
+	scopes    ScopeResolver
+
+	mu           sync.Mutex
+	roles        []authpkg.Role
+	rolesVersion int64
+	rolesAt      time.Time
+	effective    map[string][]string
+
+	ancestryMu      sync.Mutex
+	ancestry        map[Scope]cachedAncestry
+	ancestryVersion int64
+}
+
+// cachedAncestry holds the resolved ancestors of a scope
+type cachedAncestry struct {
+	ancestors  []Scope
+	resolvedAt time.Time
 }
 
-// NewPolicyEngine creates a new policy engine
-func NewPolicyEngine(roleRepo RoleRepo, grantRepo GrantRepo) *PolicyEngine {
+// ancestryTTL bounds how long a resolved ancestry is used
+const ancestryTTL = time.Minute
+
+// rolesTTL bounds how long the loaded roles are used
+const rolesTTL = time.Minute
+
+// NewPolicyEngine creates a new policy engine. A nil scope resolver keeps
+// scopes flat: grants only apply to their own scope and globally.
+func NewPolicyEngine(roleRepo RoleRepo, grantRepo GrantRepo, version *PolicyVersion, scopes ScopeResolver) *PolicyEngine {
 	return &PolicyEngine{
 		roleRepo:  roleRepo,
 		grantRepo: grantRepo,
+		version:   version,
+		scopes:    scopes,
 	}
 }
 
@@ -33,10 +68,31 @@ func (p *PolicyEngine) Has(ctx context.Context, userID uuid.UUID, permission str
 	// Filter active and non-expired grants
 	activeGrants := p.filterActiveGrants(grants)
 
+	// Ancestors are only resolved once a grant does not match directly
+	var ancestors []Scope
+	resolved := false
+	matches := func(grant *Grant) (bool, error) {
+		if grant.MatchesScope(scope) {
+			return true, nil
+		}
+		if !resolved {
+			ancestors, err = p.scopeAncestors(ctx, scope)
+			if err != nil {
+				return false, err
+			}
+			resolved = true
+		}
+		return grant.MatchesScopeWithin(scope, ancestors), nil
+	}
+
 	// Check direct permission grants
 	for _, grant := range activeGrants {
-		if grant.GrantType == GrantTypePermission {
-			if grant.Value == permission && grant.MatchesScope(scope) {
+		if grant.GrantType == GrantTypePermission && authpkg.PermissionImplies(grant.Value, permission) {
+			ok, err := matches(grant)
+			if err != nil {
+				return false, err
+			}
+			if ok {
 				return true, nil
 			}
 		}
@@ -45,12 +101,16 @@ func (p *PolicyEngine) Has(ctx context.Context, userID uuid.UUID, permission str
 	// Check role-based permissions
 	for _, grant := range activeGrants {
 		if grant.GrantType == GrantTypeRole {
-			if grant.MatchesScope(scope) {
-				hasPermission, err := p.roleHasPermission(ctx, grant.Value, permission)
+			ok, err := matches(grant)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				rolePerms, err := p.rolePermissions(ctx, grant.Value)
 				if err != nil {
 					return false, fmt.Errorf("error check role permission: %w", err)
 				}
-				if hasPermission {
+				if authpkg.ContainsPermission(rolePerms, permission) {
 					return true, nil
 				}
 			}
@@ -60,27 +120,35 @@ func (p *PolicyEngine) Has(ctx context.Context, userID uuid.UUID, permission str
 	return false, nil
 }
 
-// GetUserPermissions returns all permissions for a user in the given scope
+// GetUserPermissions returns all permissions for a user in the given scope,
+// with the permissions they imply. Wildcard permissions are returned as is.
 func (p *PolicyEngine) GetUserPermissions(ctx context.Context, userID uuid.UUID, scope Scope) ([]string, error) {
 	grants, err := p.grantRepo.ListByUserID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("could not get user grants: %w", err)
 	}
 
+	ancestors, err := p.scopeAncestors(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+
 	activeGrants := p.filterActiveGrants(grants)
 	permissions := make(map[string]bool) // Use map to avoid duplicates
 
 	// Add direct permissions
 	for _, grant := range activeGrants {
-		if grant.GrantType == GrantTypePermission && grant.MatchesScope(scope) {
-			permissions[grant.Value] = true
+		if grant.GrantType == GrantTypePermission && grant.MatchesScopeWithin(scope, ancestors) {
+			for _, perm := range authpkg.ImpliedPermissions(grant.Value) {
+				permissions[perm] = true
+			}
 		}
 	}
 
 	// Add role-based permissions
 	for _, grant := range activeGrants {
-		if grant.GrantType == GrantTypeRole && grant.MatchesScope(scope) {
-			rolePerms, err := p.getRolePermissions(ctx, grant.Value)
+		if grant.GrantType == GrantTypeRole && grant.MatchesScopeWithin(scope, ancestors) {
+			rolePerms, err := p.rolePermissions(ctx, grant.Value)
 			if err != nil {
 				return nil, fmt.Errorf("could not get role permissions: %w", err)
 			}
@@ -99,6 +167,44 @@ func (p *PolicyEngine) GetUserPermissions(ctx context.Context, userID uuid.UUID,
 	return result, nil
 }
 
+// Explain traces how Has decides a permission: the grants considered, the
+// expired ones, the scope each matched through and the role supplying the
+// permission. Grants that are not active otherwise are left out.
+func (p *PolicyEngine) Explain(ctx context.Context, userID uuid.UUID, permission string, scope Scope) (authpkg.DecisionTrace, error) {
+	grants, err := p.grantRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return authpkg.DecisionTrace{}, fmt.Errorf("could not get user grants: %w", err)
+	}
+
+	ancestors, err := p.scopeAncestors(ctx, scope)
+	if err != nil {
+		return authpkg.DecisionTrace{}, err
+	}
+
+	p.mu.Lock()
+	err = p.loadRoles(ctx)
+	roles := p.roles
+	p.mu.Unlock()
+	if err != nil {
+		return authpkg.DecisionTrace{}, fmt.Errorf("could not get roles: %w", err)
+	}
+
+	// Expiry is left to the trace, which reports it
+	libGrants := make([]authpkg.Grant, 0, len(grants))
+	for _, grant := range grants {
+		if grant.Status == authpkg.UserStatusActive {
+			libGrants = append(libGrants, grant.authGrant())
+		}
+	}
+
+	libAncestors := make([]authpkg.Scope, 0, len(ancestors))
+	for _, ancestor := range ancestors {
+		libAncestors = append(libAncestors, ancestor.authScope())
+	}
+
+	return authpkg.ExplainPermissions(libGrants, roles, permission, scope.authScope(), libAncestors, time.Now()), nil
+}
+
 // filterActiveGrants filters grants that are active and not expired
 func (p *PolicyEngine) filterActiveGrants(grants []*Grant) []*Grant {
 	var active []*Grant
@@ -110,38 +216,91 @@ func (p *PolicyEngine) filterActiveGrants(grants []*Grant) []*Grant {
 	return active
 }
 
-// roleHasPermission checks if a role has a specific permission
-func (p *PolicyEngine) roleHasPermission(ctx context.Context, roleID string, permission string) (bool, error) {
-	id, err := uuid.Parse(roleID)
+// rolePermissions returns the effective permissions of a role: its own,
+// those of the roles it inherits from and the permissions they imply.
+// Inactive and unknown roles have none.
+func (p *PolicyEngine) rolePermissions(ctx context.Context, roleID string) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.loadRoles(ctx); err != nil {
+		return nil, err
+	}
+
+	perms, ok := p.effective[roleID]
+	if !ok {
+		perms = authpkg.EffectiveRolePermissions(p.roles, roleID)
+		p.effective[roleID] = perms
+	}
+	return perms, nil
+}
+
+// loadRoles reloads the active roles and drops the cached effective
+// permissions when the policy version has moved since they were loaded or
+// they are older than rolesTTL.
+// The caller holds mu.
+func (p *PolicyEngine) loadRoles(ctx context.Context) error {
+	version, err := p.version.Current(ctx)
 	if err != nil {
-		return false, fmt.Errorf("invalid role ID: %w", err)
+		return err
+	}
+	if p.effective != nil && p.rolesVersion == version && time.Since(p.rolesAt) < rolesTTL {
+		return nil
 	}
 
-	role, err := p.roleRepo.Get(ctx, id)
+	roles, err := p.roleRepo.List(ctx)
 	if err != nil {
-		return false, fmt.Errorf("could not get role: %w", err)
+		return fmt.Errorf("could not list roles: %w", err)
 	}
-	if role == nil {
-		return false, nil
+
+	active := make([]authpkg.Role, 0, len(roles))
+	for _, role := range roles {
+		if role.IsActive() {
+			active = append(active, role.authRole())
+		}
 	}
 
-	return role.HasPermission(permission), nil
+	p.roles = active
+	p.rolesVersion = version
+	p.rolesAt = time.Now()
+	p.effective = make(map[string][]string)
+	return nil
 }
 
-// getRolePermissions gets all permissions for a role
-func (p *PolicyEngine) getRolePermissions(ctx context.Context, roleID string) ([]string, error) {
-	id, err := uuid.Parse(roleID)
+// scopeAncestors returns the cached ancestors of a scope, resolving them
+// when missing or stale. The resolver is called without holding the lock.
+func (p *PolicyEngine) scopeAncestors(ctx context.Context, scope Scope) ([]Scope, error) {
+	if p.scopes == nil || scope.IsGlobal() {
+		return nil, nil
+	}
+
+	version, err := p.version.Current(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("invalid role ID: %w", err)
+		return nil, err
 	}
 
-	role, err := p.roleRepo.Get(ctx, id)
+	p.ancestryMu.Lock()
+	if p.ancestry == nil || p.ancestryVersion != version {
+		p.ancestry = make(map[Scope]cachedAncestry)
+		p.ancestryVersion = version
+	}
+	cached, ok := p.ancestry[scope]
+	p.ancestryMu.Unlock()
+
+	if ok && time.Since(cached.resolvedAt) < ancestryTTL {
+		return cached.ancestors, nil
+	}
+
+	ancestors, err := ScopeAncestors(ctx, p.scopes, scope)
 	if err != nil {
-		return nil, fmt.Errorf("could not get role: %w", err)
+		return nil, fmt.Errorf("could not resolve scope ancestors: %w", err)
 	}
-	if role == nil {
-		return nil, nil
+
+	p.ancestryMu.Lock()
+	if p.ancestryVersion == version {
+		p.ancestry[scope] = cachedAncestry{ancestors: ancestors, resolvedAt: time.Now()}
 	}
+	p.ancestryMu.Unlock()
 
-	return role.Permissions, nil
-}
\ No newline at end of file
+	return ancestors, nil
+}
@@ -149,11 +149,24 @@ func (r *testRoleRepo) ListByStatus(ctx context.Context, status string) ([]*Role
 	return result, nil
 }
 
+type testPolicyVersionRepo struct {
+	version int64
+}
+
+func (r *testPolicyVersionRepo) Get(ctx context.Context) (int64, error) {
+	return r.version, nil
+}
+
+func (r *testPolicyVersionRepo) Increment(ctx context.Context) (int64, error) {
+	r.version++
+	return r.version, nil
+}
+
 func TestNewPolicyEngine(t *testing.T) {
 	grantRepo := &testGrantRepo{}
 	roleRepo := &testRoleRepo{}
 	
-	engine := NewPolicyEngine(roleRepo, grantRepo)
+	engine := NewPolicyEngine(roleRepo, grantRepo, NewPolicyVersion(nil), nil)
 	
 	if engine == nil {
 		t.Error("NewPolicyEngine() returned nil")
@@ -169,7 +182,7 @@ func TestNewPolicyEngine(t *testing.T) {
 func TestPolicyEngineHasDirectPermission(t *testing.T) {
 	grantRepo := &testGrantRepo{}
 	roleRepo := &testRoleRepo{}
-	engine := NewPolicyEngine(roleRepo, grantRepo)
+	engine := NewPolicyEngine(roleRepo, grantRepo, NewPolicyVersion(nil), nil)
 	
 	userID := uuid.New()
 	scope := Scope{Type: "team", ID: "123"}
@@ -197,7 +210,7 @@ func TestPolicyEngineHasDirectPermission(t *testing.T) {
 func TestPolicyEngineHasRoleBasedPermission(t *testing.T) {
 	grantRepo := &testGrantRepo{}
 	roleRepo := &testRoleRepo{}
-	engine := NewPolicyEngine(roleRepo, grantRepo)
+	engine := NewPolicyEngine(roleRepo, grantRepo, NewPolicyVersion(nil), nil)
 	
 	userID := uuid.New()
 	roleID := uuid.New()
@@ -235,7 +248,7 @@ func TestPolicyEngineHasRoleBasedPermission(t *testing.T) {
 func TestPolicyEngineHasNoPermission(t *testing.T) {
 	grantRepo := &testGrantRepo{}
 	roleRepo := &testRoleRepo{}
-	engine := NewPolicyEngine(roleRepo, grantRepo)
+	engine := NewPolicyEngine(roleRepo, grantRepo, NewPolicyVersion(nil), nil)
 	
 	userID := uuid.New()
 	scope := Scope{Type: "team", ID: "123"}
@@ -254,7 +267,7 @@ func TestPolicyEngineHasNoPermission(t *testing.T) {
 func TestPolicyEngineHasExpiredGrant(t *testing.T) {
 	grantRepo := &testGrantRepo{}
 	roleRepo := &testRoleRepo{}
-	engine := NewPolicyEngine(roleRepo, grantRepo)
+	engine := NewPolicyEngine(roleRepo, grantRepo, NewPolicyVersion(nil), nil)
 	
 	userID := uuid.New()
 	scope := Scope{Type: "team", ID: "123"}
@@ -284,7 +297,7 @@ func TestPolicyEngineHasExpiredGrant(t *testing.T) {
 func TestPolicyEngineHasGlobalScope(t *testing.T) {
 	grantRepo := &testGrantRepo{}
 	roleRepo := &testRoleRepo{}
-	engine := NewPolicyEngine(roleRepo, grantRepo)
+	engine := NewPolicyEngine(roleRepo, grantRepo, NewPolicyVersion(nil), nil)
 	
 	userID := uuid.New()
 	globalScope := Scope{Type: "global", ID: ""}
@@ -313,7 +326,7 @@ func TestPolicyEngineHasGlobalScope(t *testing.T) {
 func TestPolicyEngineGetUserPermissions(t *testing.T) {
 	grantRepo := &testGrantRepo{}
 	roleRepo := &testRoleRepo{}
-	engine := NewPolicyEngine(roleRepo, grantRepo)
+	engine := NewPolicyEngine(roleRepo, grantRepo, NewPolicyVersion(nil), nil)
 	
 	userID := uuid.New()
 	roleID := uuid.New()
@@ -381,7 +394,7 @@ func TestPolicyEngineGetUserPermissions(t *testing.T) {
 func TestPolicyEngineFilterActiveGrants(t *testing.T) {
 	grantRepo := &testGrantRepo{}
 	roleRepo := &testRoleRepo{}
-	engine := NewPolicyEngine(roleRepo, grantRepo)
+	engine := NewPolicyEngine(roleRepo, grantRepo, NewPolicyVersion(nil), nil)
 	
 	expiredTime := time.Now().Add(-time.Hour)
 	futureTime := time.Now().Add(time.Hour)
@@ -412,4 +425,216 @@ func TestPolicyEngineFilterActiveGrants(t *testing.T) {
 	if len(activeGrants) != 2 {
 		t.Errorf("Expected 2 active grants, got %d", len(activeGrants))
 	}
-}
\ No newline at end of file
+}
+// TestPolicyEngineAgreesWithAuthLibrary runs the same checks through the
+// engine and through auth.EvaluatePermissions, which services use on their
+// own, and expects both to give the same, expected, answer.
+func TestPolicyEngineAgreesWithAuthLibrary(t *testing.T) {
+	ctx := context.Background()
+	grantRepo := &testGrantRepo{}
+	roleRepo := &testRoleRepo{}
+	engine := NewPolicyEngine(roleRepo, grantRepo, NewPolicyVersion(nil), nil)
+
+	viewer := &Role{ID: uuid.New(), Name: "viewer", Permissions: []string{"*:read"}, Status: authpkg.UserStatusActive}
+	editor := &Role{ID: uuid.New(), Name: "editor", Permissions: []string{"todos:*"}, Inherits: []uuid.UUID{viewer.ID}, Status: authpkg.UserStatusActive}
+	admin := &Role{ID: uuid.New(), Name: "admin", Permissions: []string{"roles:manage"}, Inherits: []uuid.UUID{editor.ID}, Status: authpkg.UserStatusActive}
+	suspended := &Role{ID: uuid.New(), Name: "suspended", Permissions: []string{"billing:read"}, Status: authpkg.UserStatusSuspended}
+	// A cycle stored before it could be rejected
+	loopA := &Role{ID: uuid.New(), Name: "loop-a", Permissions: []string{"a:write"}, Status: authpkg.UserStatusActive}
+	loopB := &Role{ID: uuid.New(), Name: "loop-b", Permissions: []string{"b:write"}, Inherits: []uuid.UUID{loopA.ID}, Status: authpkg.UserStatusActive}
+	loopA.Inherits = []uuid.UUID{loopB.ID}
+
+	var libRoles []authpkg.Role
+	for _, role := range []*Role{viewer, editor, admin, suspended, loopA, loopB} {
+		roleRepo.Create(ctx, role)
+		if role.IsActive() {
+			libRoles = append(libRoles, role.authRole())
+		}
+	}
+
+	team := Scope{Type: "team", ID: "123"}
+	otherTeam := Scope{Type: "team", ID: "456"}
+
+	tests := []struct {
+		name       string
+		grantType  GrantType
+		value      string
+		grantScope Scope
+		permission string
+		scope      Scope
+		expected   bool
+	}{
+		{"exact permission", GrantTypePermission, "todos:read", team, "todos:read", team, true},
+		{"other permission", GrantTypePermission, "todos:read", team, "todos:write", team, false},
+		{"action wildcard", GrantTypePermission, "todos:*", team, "todos:delete", team, true},
+		{"action wildcard other resource", GrantTypePermission, "todos:*", team, "lists:delete", team, false},
+		{"resource wildcard", GrantTypePermission, "*:read", team, "lists:read", team, true},
+		{"resource wildcard other action", GrantTypePermission, "*:read", team, "lists:write", team, false},
+		{"full wildcard", GrantTypePermission, "*", Scope{Type: "global"}, "lists:write", otherTeam, true},
+		{"wildcard in other scope", GrantTypePermission, "todos:*", team, "todos:read", otherTeam, false},
+		{"checked wildcard is literal", GrantTypePermission, "todos:read", team, "todos:*", team, false},
+		{"implied permission", GrantTypePermission, "roles:manage", team, "roles:delete", team, true},
+		{"implication is one way", GrantTypePermission, "roles:delete", team, "roles:manage", team, false},
+		{"implied through wildcard", GrantTypePermission, "*:manage", team, "grants:read", team, true},
+		{"role permission", GrantTypeRole, viewer.ID.String(), team, "lists:read", team, true},
+		{"role missing permission", GrantTypeRole, viewer.ID.String(), team, "lists:write", team, false},
+		{"inherited permission", GrantTypeRole, editor.ID.String(), team, "lists:read", team, true},
+		{"inherited through two roles", GrantTypeRole, admin.ID.String(), team, "users:read", team, true},
+		{"implied in inheriting role", GrantTypeRole, admin.ID.String(), team, "roles:write", team, true},
+		{"parent lacks child permission", GrantTypeRole, viewer.ID.String(), team, "todos:write", team, false},
+		{"suspended role", GrantTypeRole, suspended.ID.String(), team, "billing:read", team, false},
+		{"unknown role", GrantTypeRole, uuid.New().String(), team, "todos:read", team, false},
+		{"cycle", GrantTypeRole, loopA.ID.String(), team, "b:write", team, true},
+		{"cycle missing permission", GrantTypeRole, loopA.ID.String(), team, "c:write", team, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uuid.New()
+			grant := &Grant{
+				UserID:    userID,
+				GrantType: tt.grantType,
+				Value:     tt.value,
+				Scope:     tt.grantScope,
+				Status:    authpkg.UserStatusActive,
+			}
+			grantRepo.Create(ctx, grant)
+
+			got, err := engine.Has(ctx, userID, tt.permission, tt.scope)
+			if err != nil {
+				t.Fatalf("Has() error = %v", err)
+			}
+
+			libGrants := []authpkg.Grant{{
+				ID:        grant.ID,
+				UserID:    userID,
+				GrantType: authpkg.GrantType(tt.grantType),
+				Value:     tt.value,
+				Scope:     authpkg.Scope{Type: tt.grantScope.Type, ID: tt.grantScope.ID},
+			}}
+			libScope := authpkg.Scope{Type: tt.scope.Type, ID: tt.scope.ID}
+			lib := authpkg.EvaluatePermissions(libGrants, libRoles, tt.permission, libScope, time.Now())
+
+			if got != tt.expected || lib != tt.expected {
+				t.Errorf("Has() = %v, auth.EvaluatePermissions() = %v, want %v", got, lib, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPolicyEngineCachesRolePermissions(t *testing.T) {
+	ctx := context.Background()
+	grantRepo := &testGrantRepo{}
+	roleRepo := &testRoleRepo{}
+	version := NewPolicyVersion(nil)
+	engine := NewPolicyEngine(roleRepo, grantRepo, version, nil)
+	roles := NewVersionedRoleRepo(roleRepo, version)
+
+	viewer := &Role{Name: "viewer", Permissions: []string{"todos:read"}, Status: authpkg.UserStatusActive}
+	roles.Create(ctx, viewer)
+	editor := &Role{Name: "editor", Inherits: []uuid.UUID{viewer.ID}, Status: authpkg.UserStatusActive}
+	roles.Create(ctx, editor)
+
+	userID := uuid.New()
+	grantRepo.Create(ctx, &Grant{
+		UserID:    userID,
+		GrantType: GrantTypeRole,
+		Value:     editor.ID.String(),
+		Scope:     Scope{Type: "global"},
+		Status:    authpkg.UserStatusActive,
+	})
+
+	has := func(permission string) bool {
+		t.Helper()
+		allowed, err := engine.Has(ctx, userID, permission, Scope{Type: "global"})
+		if err != nil {
+			t.Fatalf("Has() error = %v", err)
+		}
+		return allowed
+	}
+
+	if !has("todos:read") {
+		t.Fatal("Has(todos:read) = false, want it inherited from viewer")
+	}
+
+	// A change the policy version does not see is not seen by the engine
+	viewer.Permissions = []string{"todos:write"}
+	if !has("todos:read") {
+		t.Error("Has(todos:read) = false before the version moved, want the cached permissions")
+	}
+
+	updated := *viewer
+	if err := roles.Save(ctx, &updated); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if has("todos:read") || !has("todos:write") {
+		t.Error("role change not seen after the version moved")
+	}
+
+	if err := roles.Delete(ctx, viewer.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if has("todos:write") {
+		t.Error("Has(todos:write) = true after the inherited role was deleted")
+	}
+}
+
+func TestPolicyEngineSeesChangesOfOtherReplicas(t *testing.T) {
+	ctx := context.Background()
+	grantRepo := &testGrantRepo{}
+	roleRepo := &testRoleRepo{}
+	versionRepo := &testPolicyVersionRepo{}
+
+	// Two replicas sharing the repos, each with its own version and engine
+	writer := NewPolicyVersion(versionRepo)
+	reader := NewPolicyVersion(versionRepo)
+	reader.refresh = 0
+	engine := NewPolicyEngine(roleRepo, grantRepo, reader, nil)
+	roles := NewVersionedRoleRepo(roleRepo, writer)
+
+	viewer := &Role{Name: "viewer", Permissions: []string{"todos:read"}, Status: authpkg.UserStatusActive}
+	if err := roles.Create(ctx, viewer); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	userID := uuid.New()
+	grantRepo.Create(ctx, &Grant{
+		UserID:    userID,
+		GrantType: GrantTypeRole,
+		Value:     viewer.ID.String(),
+		Scope:     Scope{Type: "global"},
+		Status:    authpkg.UserStatusActive,
+	})
+
+	has := func(permission string) bool {
+		t.Helper()
+		allowed, err := engine.Has(ctx, userID, permission, Scope{Type: "global"})
+		if err != nil {
+			t.Fatalf("Has() error = %v", err)
+		}
+		return allowed
+	}
+
+	if !has("todos:read") {
+		t.Fatal("Has(todos:read) = false, want it granted by viewer")
+	}
+
+	updated := *viewer
+	updated.Permissions = []string{"todos:write"}
+	if err := roles.Save(ctx, &updated); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if has("todos:read") || !has("todos:write") {
+		t.Error("role change made through another replica not seen")
+	}
+
+	got, err := reader.Current(ctx)
+	if err != nil {
+		t.Fatalf("Current() error = %v", err)
+	}
+	want, _ := writer.Current(ctx)
+	if got != want {
+		t.Errorf("Current() = %d on the reader, want %d as on the writer", got, want)
+	}
+}
@@ -29,3 +29,18 @@ type GrantRepo interface {
 	ListExpired(ctx context.Context) ([]*Grant, error)
 }
 
+// ScopeParentRepo defines the repository interface for the scope parent
+// lookup table
+type ScopeParentRepo interface {
+	Save(ctx context.Context, entry *ScopeParent) error
+	Get(ctx context.Context, scope Scope) (*ScopeParent, error)
+	Delete(ctx context.Context, scope Scope) error
+	ListByParent(ctx context.Context, parent Scope) ([]*ScopeParent, error)
+}
+
+// PolicyVersionRepo defines the repository interface for the policy version
+// shared by all replicas
+type PolicyVersionRepo interface {
+	Get(ctx context.Context) (int64, error)
+	Increment(ctx context.Context) (int64, error)
+}
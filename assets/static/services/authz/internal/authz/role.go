@@ -11,7 +11,8 @@ import (
 type Role struct {
 	ID          uuid.UUID
 	Name        string
-	Permissions []string // Permission codes
+	Permissions []string    // Permission codes, * allowed for either part
+	Inherits    []uuid.UUID // Roles whose permissions this role also has
 	Status      authpkg.UserStatus
 	CreatedAt   time.Time
 	CreatedBy   string
@@ -54,12 +55,19 @@ func (r *Role) IsActive() bool {
 	return r.Status == authpkg.UserStatusActive
 }
 
-// HasPermission checks if role has a specific permission
+// HasPermission checks if the role's own permissions cover a permission,
+// through wildcards and implications too. Inherited permissions are resolved
+// by the PolicyEngine.
 func (r *Role) HasPermission(permission string) bool {
-	for _, p := range r.Permissions {
-		if p == permission {
-			return true
-		}
+	return authpkg.ContainsPermission(r.Permissions, permission)
+}
+
+// authRole converts the role to the auth library type
+func (r *Role) authRole() authpkg.Role {
+	return authpkg.Role{
+		ID:          r.ID,
+		Name:        r.Name,
+		Permissions: r.Permissions,
+		Inherits:    r.Inherits,
 	}
-	return false
 }
\ No newline at end of file
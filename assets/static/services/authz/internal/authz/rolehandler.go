@@ -2,6 +2,7 @@ package authz
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
 
+	authpkg "github.com/username/repo/pkg/lib/auth"
 	"github.com/username/repo/pkg/lib/core"
 	"github.com/username/repo/services/authz/internal/config"
 )
@@ -40,8 +42,9 @@ func (h *RoleHandler) RegisterRoutes(r chi.Router) {
 
 // RoleRequest represents the request payload for creating/updating roles
 type RoleRequest struct {
-	Name        string   `json:"name"`
-	Permissions []string `json:"permissions"`
+	Name        string      `json:"name"`
+	Permissions []string    `json:"permissions"`
+	Inherits    []uuid.UUID `json:"inherits"`
 }
 
 // ListRoles handles GET /authz/roles
@@ -122,8 +125,14 @@ func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 
 	// Create new role
 	role := NewRole()
+	role.EnsureID()
 	role.Name = req.Name
 	role.Permissions = req.Permissions
+	role.Inherits = req.Inherits
+
+	if !h.checkInheritance(w, r, role) {
+		return
+	}
 
 	if err := h.roleRepo.Create(ctx, role); err != nil {
 		log.Error("failed to create role", "error", err)
@@ -199,6 +208,12 @@ func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
 	if req.Permissions != nil {
 		role.Permissions = req.Permissions
 	}
+	if req.Inherits != nil {
+		role.Inherits = req.Inherits
+		if !h.checkInheritance(w, r, role) {
+			return
+		}
+	}
 
 	if err := h.roleRepo.Save(ctx, role); err != nil {
 		log.Error("failed to save role", "error", err)
@@ -232,6 +247,36 @@ func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
 
 // Helper methods
 
+// checkInheritance rejects roles inheriting from missing roles or from
+// themselves, through any number of roles. It responds when it rejects.
+func (h *RoleHandler) checkInheritance(w http.ResponseWriter, r *http.Request, role *Role) bool {
+	roles, err := h.roleRepo.List(r.Context())
+	if err != nil {
+		h.logForRequest(r).Error("failed to list roles", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Failed to validate role inheritance")
+		return false
+	}
+
+	authRoles := make([]authpkg.Role, 0, len(roles))
+	for _, stored := range roles {
+		authRoles = append(authRoles, stored.authRole())
+	}
+
+	err = authpkg.CheckRoleInheritance(authRoles, role.authRole())
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, authpkg.ErrUnknownRole):
+		core.RespondError(w, http.StatusBadRequest, "Inherited role not found")
+	case errors.Is(err, authpkg.ErrRoleCycle):
+		core.RespondError(w, http.StatusBadRequest, "Role cannot inherit from itself")
+	default:
+		h.logForRequest(r).Error("failed to validate role inheritance", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Failed to validate role inheritance")
+	}
+	return false
+}
+
 func (h *RoleHandler) logForRequest(r *http.Request) core.Logger {
 	return h.xparams.Log.With(
 		"request_id", middleware.GetReqID(r.Context()),
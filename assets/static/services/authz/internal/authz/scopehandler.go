@@ -0,0 +1,199 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/username/repo/pkg/lib/core"
+	"github.com/username/repo/services/authz/internal/config"
+)
+
+// ScopeHandler handles the scope tree HTTP requests. Parents are written to
+// the lookup table; ancestors are read through the resolver, which may also
+// ask the services owning some scope types.
+type ScopeHandler struct {
+	parentRepo ScopeParentRepo
+	resolver   ScopeResolver
+	xparams    config.XParams
+}
+
+// NewScopeHandler creates a new ScopeHandler
+func NewScopeHandler(parentRepo ScopeParentRepo, resolver ScopeResolver, xparams config.XParams) *ScopeHandler {
+	return &ScopeHandler{
+		parentRepo: parentRepo,
+		resolver:   resolver,
+		xparams:    xparams,
+	}
+}
+
+// RegisterRoutes registers scope routes
+func (h *ScopeHandler) RegisterRoutes(r chi.Router) {
+	r.Route("/authz/scopes", func(r chi.Router) {
+		r.Put("/parent", h.SetParent)
+		r.Delete("/parent", h.DeleteParent)
+		r.Get("/ancestors", h.ListAncestors)
+		r.Get("/children", h.ListChildren)
+	})
+}
+
+// ScopeParentRequest represents the request payload for placing a scope in
+// the tree
+type ScopeParentRequest struct {
+	Scope  Scope `json:"scope"`
+	Parent Scope `json:"parent"`
+}
+
+// ScopeAncestorsResponse represents the ancestors of a scope, nearest first
+type ScopeAncestorsResponse struct {
+	Scope     Scope   `json:"scope"`
+	Ancestors []Scope `json:"ancestors"`
+}
+
+// SetParent handles PUT /authz/scopes/parent
+func (h *ScopeHandler) SetParent(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	var req ScopeParentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Debug("invalid request payload", "error", err)
+		core.RespondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.Scope.Type == "" || req.Parent.Type == "" {
+		core.RespondError(w, http.StatusBadRequest, "Scope and parent types are required")
+		return
+	}
+	if req.Scope.IsGlobal() || req.Parent.IsGlobal() {
+		core.RespondError(w, http.StatusBadRequest, "The global scope is above every scope")
+		return
+	}
+	if req.Scope == req.Parent {
+		core.RespondError(w, http.StatusBadRequest, "Scope cannot be its own parent")
+		return
+	}
+
+	// The scope must not already be above its new parent
+	ancestors, err := ScopeAncestors(ctx, h.resolver, req.Parent)
+	if errors.Is(err, ErrScopeCycle) {
+		core.RespondError(w, http.StatusBadRequest, "Parent scope ancestry loops or is too deep")
+		return
+	}
+	if err != nil {
+		log.Error("failed to resolve scope ancestors", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Failed to resolve scope ancestors")
+		return
+	}
+	if len(ancestors) >= MaxScopeDepth {
+		core.RespondError(w, http.StatusBadRequest, "Scope tree is too deep")
+		return
+	}
+	for _, ancestor := range ancestors {
+		if ancestor == req.Scope {
+			core.RespondError(w, http.StatusBadRequest, "Scope cannot be below itself")
+			return
+		}
+	}
+
+	entry := &ScopeParent{Scope: req.Scope, Parent: req.Parent}
+	if err := h.parentRepo.Save(ctx, entry); err != nil {
+		log.Error("failed to save scope parent", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Failed to save scope parent")
+		return
+	}
+
+	core.RespondSuccess(w, entry)
+}
+
+// DeleteParent handles DELETE /authz/scopes/parent?type=&id=
+func (h *ScopeHandler) DeleteParent(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	scope, ok := h.scopeParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.parentRepo.Delete(r.Context(), scope); err != nil {
+		log.Error("failed to delete scope parent", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Failed to delete scope parent")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAncestors handles GET /authz/scopes/ancestors?type=&id=
+func (h *ScopeHandler) ListAncestors(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	scope, ok := h.scopeParam(w, r)
+	if !ok {
+		return
+	}
+
+	ancestors, err := ScopeAncestors(r.Context(), h.resolver, scope)
+	if errors.Is(err, ErrScopeCycle) {
+		core.RespondError(w, http.StatusConflict, "Scope ancestry loops or is too deep")
+		return
+	}
+	if err != nil {
+		log.Error("failed to resolve scope ancestors", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Failed to resolve scope ancestors")
+		return
+	}
+	if ancestors == nil {
+		ancestors = []Scope{}
+	}
+
+	core.RespondSuccess(w, ScopeAncestorsResponse{Scope: scope, Ancestors: ancestors})
+}
+
+// ListChildren handles GET /authz/scopes/children?type=&id=
+// Only the children placed through the lookup table are listed.
+func (h *ScopeHandler) ListChildren(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	scope, ok := h.scopeParam(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := h.parentRepo.ListByParent(r.Context(), scope)
+	if err != nil {
+		log.Error("failed to list scope children", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Failed to retrieve scope children")
+		return
+	}
+
+	children := make([]Scope, 0, len(entries))
+	for _, entry := range entries {
+		children = append(children, entry.Scope)
+	}
+
+	core.RespondSuccess(w, children)
+}
+
+// Helper methods
+
+func (h *ScopeHandler) scopeParam(w http.ResponseWriter, r *http.Request) (Scope, bool) {
+	scope := Scope{Type: r.URL.Query().Get("type"), ID: r.URL.Query().Get("id")}
+	if scope.Type == "" {
+		core.RespondError(w, http.StatusBadRequest, "Scope type is required")
+		return scope, false
+	}
+	return scope, true
+}
+
+func (h *ScopeHandler) logForRequest(r *http.Request) core.Logger {
+	return h.xparams.Log.With(
+		"request_id", middleware.GetReqID(r.Context()),
+		"method", r.Method,
+		"path", r.URL.Path,
+	)
+}
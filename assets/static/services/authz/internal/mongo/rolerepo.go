@@ -79,6 +79,14 @@ func (r *RoleMongoRepo) Stop(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheck pings the MongoDB client.
+func (r *RoleMongoRepo) HealthCheck(ctx context.Context) error {
+	if r.client == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	return r.client.Ping(ctx, nil)
+}
+
 // createIndexes creates necessary indexes for the roles collection
 func (r *RoleMongoRepo) createIndexes(ctx context.Context) error {
 	// Index on name (unique)
@@ -111,6 +119,7 @@ type roleDocument struct {
 	ID          string    `bson:"_id"`
 	Name        string    `bson:"name"`
 	Permissions []string  `bson:"permissions"`
+	Inherits    []string  `bson:"inherits,omitempty"`
 	Status      string    `bson:"status"`
 	CreatedAt   time.Time `bson:"created_at"`
 	CreatedBy   string    `bson:"created_by"`
@@ -124,6 +133,7 @@ func (r *RoleMongoRepo) toDocument(role *authz.Role) *roleDocument {
 		ID:          role.ID.String(),
 		Name:        role.Name,
 		Permissions: role.Permissions,
+		Inherits:    roleIDStrings(role.Inherits),
 		Status:      string(role.Status),
 		CreatedAt:   role.CreatedAt,
 		CreatedBy:   role.CreatedBy,
@@ -139,10 +149,20 @@ func (r *RoleMongoRepo) fromDocument(doc *roleDocument) (*authz.Role, error) {
 		return nil, fmt.Errorf("invalid role ID format: %w", err)
 	}
 
+	inherits := make([]uuid.UUID, 0, len(doc.Inherits))
+	for _, parent := range doc.Inherits {
+		parentID, err := uuid.Parse(parent)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inherited role ID format: %w", err)
+		}
+		inherits = append(inherits, parentID)
+	}
+
 	return &authz.Role{
 		ID:          id,
 		Name:        doc.Name,
 		Permissions: doc.Permissions,
+		Inherits:    inherits,
 		Status:      authpkg.UserStatus(doc.Status),
 		CreatedAt:   doc.CreatedAt,
 		CreatedBy:   doc.CreatedBy,
@@ -151,6 +171,15 @@ func (r *RoleMongoRepo) fromDocument(doc *roleDocument) (*authz.Role, error) {
 	}, nil
 }
 
+// roleIDStrings converts role IDs to their stored form
+func roleIDStrings(ids []uuid.UUID) []string {
+	strs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strs = append(strs, id.String())
+	}
+	return strs
+}
+
 // Create creates a new Role in MongoDB
 func (r *RoleMongoRepo) Create(ctx context.Context, role *authz.Role) error {
 	if role == nil {
@@ -215,6 +244,7 @@ func (r *RoleMongoRepo) Save(ctx context.Context, role *authz.Role) error {
 		"$set": bson.M{
 			"name":        role.Name,
 			"permissions": role.Permissions,
+			"inherits":    roleIDStrings(role.Inherits),
 			"status":      string(role.Status),
 			"updated_at":  role.UpdatedAt,
 			"updated_by":  role.UpdatedBy,
@@ -0,0 +1,368 @@
+// Package authn is a typed client for the authn service.
+package authn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/adrianpk/hatmax-ref/pkg/client"
+)
+
+// Credentials is the sign up and sign in payload.
+type Credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// User is the public representation of an account.
+type User struct {
+	ID              string     `json:"id"`
+	Status          string     `json:"status"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	CreatedBy       string     `json:"created_by"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	UpdatedBy       string     `json:"updated_by"`
+}
+
+// AuthResponse is returned by sign up, sign in and refresh. Token is a short
+// lived access token; RefreshToken renews it and must be replaced by the one
+// returned on every refresh.
+type AuthResponse struct {
+	User         *User      `json:"user,omitempty"`
+	Token        string     `json:"token,omitempty"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MFARequired  bool       `json:"mfa_required,omitempty"`
+	MFAToken     string     `json:"mfa_token,omitempty"`
+}
+
+// MFAEnrollment is a pending TOTP authenticator.
+type MFAEnrollment struct {
+	Secret    string    `json:"secret"`
+	URI       string    `json:"uri"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Session is a signed in device of the current user.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// UserInput is the payload accepted when creating or updating users.
+type UserInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+// ServiceAccount is a machine principal authenticated with API keys.
+type ServiceAccount struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	CreatedBy   string    `json:"created_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UpdatedBy   string    `json:"updated_by"`
+}
+
+// ServiceAccountInput is the payload accepted when creating service accounts.
+type ServiceAccountInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// APIKey is a key of a service account. Key is only set in the response that
+// creates it.
+type APIKey struct {
+	ID               string     `json:"id"`
+	ServiceAccountID string     `json:"service_account_id"`
+	Name             string     `json:"name"`
+	Prefix           string     `json:"prefix"`
+	Scopes           []string   `json:"scopes"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	Key              string     `json:"key,omitempty"`
+}
+
+// APIKeyInput is the payload accepted when creating API keys. A key without
+// scopes has every permission granted to its account.
+type APIKeyInput struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// OIDCClient is an application registered with the authn OIDC provider.
+// ClientSecret is only set in the response that registers a confidential
+// client.
+type OIDCClient struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+// OIDCClientInput is the payload accepted when registering OIDC clients.
+type OIDCClientInput struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Public       bool     `json:"public,omitempty"`
+}
+
+// Client is a typed client for the authn service.
+type Client struct {
+	c *client.Client
+}
+
+// New creates an authn client for the service listening at baseURL.
+func New(baseURL string, opts ...client.Option) *Client {
+	return &Client{c: client.New(baseURL, opts...)}
+}
+
+// SignUp calls POST /authn/signup.
+func (c *Client) SignUp(ctx context.Context, in Credentials) (*AuthResponse, error) {
+	var out AuthResponse
+	if err := c.c.Do(ctx, http.MethodPost, "/authn/signup", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SignIn calls POST /authn/signin.
+func (c *Client) SignIn(ctx context.Context, in Credentials) (*AuthResponse, error) {
+	var out AuthResponse
+	if err := c.c.Do(ctx, http.MethodPost, "/authn/signin", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SignOut calls POST /authn/signout, revoking the session of the context token.
+func (c *Client) SignOut(ctx context.Context) error {
+	return c.c.Do(ctx, http.MethodPost, "/authn/signout", nil, nil)
+}
+
+// Refresh calls POST /authn/refresh.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*AuthResponse, error) {
+	var out AuthResponse
+	in := map[string]string{"refresh_token": refreshToken}
+	if err := c.c.Do(ctx, http.MethodPost, "/authn/refresh", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSessions calls GET /authn/sessions.
+func (c *Client) ListSessions(ctx context.Context) ([]Session, error) {
+	var out []Session
+	if err := c.c.Do(ctx, http.MethodGet, "/authn/sessions", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RevokeSession calls DELETE /authn/sessions/{id}.
+func (c *Client) RevokeSession(ctx context.Context, id string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/authn/sessions/%s", url.PathEscape(id)), nil, nil)
+}
+
+// SignInMFA calls POST /authn/signin/mfa, completing a sign in that
+// returned MFARequired with a TOTP or recovery code.
+func (c *Client) SignInMFA(ctx context.Context, mfaToken, code string) (*AuthResponse, error) {
+	var out AuthResponse
+	in := map[string]string{"mfa_token": mfaToken, "code": code}
+	if err := c.c.Do(ctx, http.MethodPost, "/authn/signin/mfa", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EnrollMFA calls POST /authn/mfa/enroll.
+func (c *Client) EnrollMFA(ctx context.Context) (*MFAEnrollment, error) {
+	var out MFAEnrollment
+	if err := c.c.Do(ctx, http.MethodPost, "/authn/mfa/enroll", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ConfirmMFA calls POST /authn/mfa/confirm and returns the recovery codes.
+func (c *Client) ConfirmMFA(ctx context.Context, code string) ([]string, error) {
+	var out struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	in := map[string]string{"code": code}
+	if err := c.c.Do(ctx, http.MethodPost, "/authn/mfa/confirm", in, &out); err != nil {
+		return nil, err
+	}
+	return out.RecoveryCodes, nil
+}
+
+// ForgotPassword calls POST /authn/password/forgot. It succeeds whether or
+// not the address has an account.
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	in := map[string]string{"email": email}
+	return c.c.Do(ctx, http.MethodPost, "/authn/password/forgot", in, nil)
+}
+
+// ResetPassword calls POST /authn/password/reset with the token of a
+// password reset mail. It signs the user out of every session.
+func (c *Client) ResetPassword(ctx context.Context, token, password string) error {
+	in := map[string]string{"token": token, "password": password}
+	return c.c.Do(ctx, http.MethodPost, "/authn/password/reset", in, nil)
+}
+
+// VerifyEmail calls POST /authn/verify with the token of a verification mail.
+func (c *Client) VerifyEmail(ctx context.Context, token string) (*User, error) {
+	var out AuthResponse
+	in := map[string]string{"token": token}
+	if err := c.c.Do(ctx, http.MethodPost, "/authn/verify", in, &out); err != nil {
+		return nil, err
+	}
+	return out.User, nil
+}
+
+// CreateUser calls POST /users.
+func (c *Client) CreateUser(ctx context.Context, in UserInput) (*User, error) {
+	var out User
+	if err := c.c.Do(ctx, http.MethodPost, "/users", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAllUsers calls GET /users.
+func (c *Client) GetAllUsers(ctx context.Context) ([]User, error) {
+	var out []User
+	if err := c.c.Do(ctx, http.MethodGet, "/users", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetUser calls GET /users/{id}.
+func (c *Client) GetUser(ctx context.Context, id string) (*User, error) {
+	var out User
+	if err := c.c.Do(ctx, http.MethodGet, fmt.Sprintf("/users/%s", url.PathEscape(id)), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateUser calls PUT /users/{id}.
+func (c *Client) UpdateUser(ctx context.Context, id string, in UserInput) (*User, error) {
+	var out User
+	if err := c.c.Do(ctx, http.MethodPut, fmt.Sprintf("/users/%s", url.PathEscape(id)), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteUser calls DELETE /users/{id}.
+func (c *Client) DeleteUser(ctx context.Context, id string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/users/%s", url.PathEscape(id)), nil, nil)
+}
+
+// ResetMFA calls DELETE /users/{id}/mfa.
+func (c *Client) ResetMFA(ctx context.Context, id string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/users/%s/mfa", url.PathEscape(id)), nil, nil)
+}
+
+// CreateServiceAccount calls POST /service-accounts.
+func (c *Client) CreateServiceAccount(ctx context.Context, in ServiceAccountInput) (*ServiceAccount, error) {
+	var out ServiceAccount
+	if err := c.c.Do(ctx, http.MethodPost, "/service-accounts", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListServiceAccounts calls GET /service-accounts.
+func (c *Client) ListServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	var out []ServiceAccount
+	if err := c.c.Do(ctx, http.MethodGet, "/service-accounts", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetServiceAccount calls GET /service-accounts/{id}.
+func (c *Client) GetServiceAccount(ctx context.Context, id string) (*ServiceAccount, error) {
+	var out ServiceAccount
+	if err := c.c.Do(ctx, http.MethodGet, fmt.Sprintf("/service-accounts/%s", url.PathEscape(id)), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DisableServiceAccount calls DELETE /service-accounts/{id}, suspending the
+// account and revoking its keys.
+func (c *Client) DisableServiceAccount(ctx context.Context, id string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/service-accounts/%s", url.PathEscape(id)), nil, nil)
+}
+
+// ListAPIKeys calls GET /service-accounts/{id}/keys.
+func (c *Client) ListAPIKeys(ctx context.Context, accountID string) ([]APIKey, error) {
+	var out []APIKey
+	if err := c.c.Do(ctx, http.MethodGet, fmt.Sprintf("/service-accounts/%s/keys", url.PathEscape(accountID)), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateAPIKey calls POST /service-accounts/{id}/keys. The returned Key is
+// not stored by authn and cannot be retrieved again.
+func (c *Client) CreateAPIKey(ctx context.Context, accountID string, in APIKeyInput) (*APIKey, error) {
+	var out APIKey
+	if err := c.c.Do(ctx, http.MethodPost, fmt.Sprintf("/service-accounts/%s/keys", url.PathEscape(accountID)), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeAPIKey calls DELETE /service-accounts/{id}/keys/{key_id}.
+func (c *Client) RevokeAPIKey(ctx context.Context, accountID, keyID string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/service-accounts/%s/keys/%s", url.PathEscape(accountID), url.PathEscape(keyID)), nil, nil)
+}
+
+// CreateOIDCClient calls POST /oidc/clients. The returned ClientSecret is not
+// stored by authn and cannot be retrieved again.
+func (c *Client) CreateOIDCClient(ctx context.Context, in OIDCClientInput) (*OIDCClient, error) {
+	var out OIDCClient
+	if err := c.c.Do(ctx, http.MethodPost, "/oidc/clients", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListOIDCClients calls GET /oidc/clients.
+func (c *Client) ListOIDCClients(ctx context.Context) ([]OIDCClient, error) {
+	var out []OIDCClient
+	if err := c.c.Do(ctx, http.MethodGet, "/oidc/clients", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteOIDCClient calls DELETE /oidc/clients/{id}.
+func (c *Client) DeleteOIDCClient(ctx context.Context, id string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/oidc/clients/%s", url.PathEscape(id)), nil, nil)
+}
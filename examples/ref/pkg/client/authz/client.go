@@ -0,0 +1,403 @@
+// Package authz is a typed client for the authz service.
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/adrianpk/hatmax-ref/pkg/client"
+)
+
+// Scope is the context a permission applies to. An empty type means global.
+type Scope struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// PermissionRequest is the payload of a permission evaluation.
+type PermissionRequest struct {
+	UserID     string `json:"user_id"`
+	Permission string `json:"permission"`
+	Scope      Scope  `json:"scope"`
+}
+
+// PermissionResponse is the result of a permission evaluation.
+type PermissionResponse struct {
+	UserID     string `json:"user_id"`
+	Permission string `json:"permission"`
+	Scope      Scope  `json:"scope"`
+	Allowed    bool   `json:"allowed"`
+}
+
+// PermissionCheck is one permission of a batch evaluation.
+type PermissionCheck struct {
+	Permission string `json:"permission"`
+	Scope      Scope  `json:"scope"`
+}
+
+// BatchPermissionRequest is the payload of a batch evaluation.
+type BatchPermissionRequest struct {
+	UserID string            `json:"user_id"`
+	Checks []PermissionCheck `json:"checks"`
+}
+
+// BatchPermissionResponse holds one result per check, in request order.
+type BatchPermissionResponse struct {
+	UserID  string               `json:"user_id"`
+	Results []PermissionResponse `json:"results"`
+}
+
+// PolicyVersion changes whenever grants or roles change.
+type PolicyVersion struct {
+	Version int64 `json:"version"`
+}
+
+// UserPermissions lists the effective permissions of a user in a scope.
+type UserPermissions struct {
+	UserID      string   `json:"user_id"`
+	Scope       Scope    `json:"scope"`
+	Permissions []string `json:"permissions"`
+}
+
+// ExplainRequest is the payload of a decision trace. Policy is a resource
+// policy as written in policy files, evaluated for Action against the
+// attributes; the subject id defaults to the user ID.
+type ExplainRequest struct {
+	UserID     string            `json:"user_id"`
+	Permission string            `json:"permission"`
+	Scope      Scope             `json:"scope"`
+	Policy     json.RawMessage   `json:"policy,omitempty"`
+	Action     string            `json:"action,omitempty"`
+	Subject    map[string]string `json:"subject,omitempty"`
+	Resource   map[string]string `json:"resource,omitempty"`
+	Context    map[string]string `json:"context,omitempty"`
+}
+
+// DecisionTrace tells why a permission is allowed or not.
+type DecisionTrace struct {
+	UserID     string       `json:"user_id"`
+	Permission string       `json:"permission"`
+	Scope      Scope        `json:"scope"`
+	Ancestors  []Scope      `json:"ancestors"`
+	Allowed    bool         `json:"allowed"`
+	Reason     string       `json:"reason"`
+	Grants     []GrantTrace `json:"grants"`
+	Policy     *PolicyTrace `json:"policy,omitempty"`
+}
+
+// GrantTrace is what a grant contributed to a decision.
+type GrantTrace struct {
+	GrantID      string     `json:"grant_id"`
+	GrantType    string     `json:"grant_type"`
+	Value        string     `json:"value"`
+	Scope        Scope      `json:"scope"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Expired      bool       `json:"expired"`
+	ScopeMatch   string     `json:"scope_match,omitempty"` // global, exact or ancestor
+	MatchedScope *Scope     `json:"matched_scope,omitempty"`
+	RoleID       string     `json:"role_id,omitempty"`
+	RoleName     string     `json:"role_name,omitempty"`
+	Permission   string     `json:"permission,omitempty"`
+	Allows       bool       `json:"allows"`
+}
+
+// PolicyTrace is the evaluation of a resource policy.
+type PolicyTrace struct {
+	Action     string           `json:"action"`
+	Defined    bool             `json:"defined"`
+	Allowed    bool             `json:"allowed"`
+	AllowedBy  string           `json:"allowed_by,omitempty"`
+	DeniedBy   string           `json:"denied_by,omitempty"`
+	Reason     string           `json:"reason"`
+	Conditions []ConditionTrace `json:"conditions"`
+}
+
+// ConditionTrace is the outcome of a condition of a policy rule.
+type ConditionTrace struct {
+	Rule      string    `json:"rule"`
+	Condition Condition `json:"condition"`
+	Holds     bool      `json:"holds"`
+	Evaluated bool      `json:"evaluated"`
+}
+
+// Condition is a policy condition as written in policies.
+type Condition struct {
+	Attribute string   `json:"attribute"`
+	Operator  string   `json:"operator"`
+	Value     string   `json:"value,omitempty"`
+	Values    []string `json:"values,omitempty"`
+	ValueFrom string   `json:"valueFrom,omitempty"`
+}
+
+// Role mirrors the role entity as serialized by authz.
+type Role struct {
+	ID          string    `json:"ID"`
+	Name        string    `json:"Name"`
+	Permissions []string  `json:"Permissions"`
+	Inherits    []string  `json:"Inherits"`
+	Status      string    `json:"Status"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+	CreatedBy   string    `json:"CreatedBy"`
+	UpdatedAt   time.Time `json:"UpdatedAt"`
+	UpdatedBy   string    `json:"UpdatedBy"`
+}
+
+// RoleInput is the payload accepted when creating or updating roles.
+// Inherits lists the IDs of the roles whose permissions the role also has.
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+	Inherits    []string `json:"inherits,omitempty"`
+}
+
+// Grant mirrors the grant entity as serialized by authz.
+type Grant struct {
+	ID        string     `json:"ID"`
+	UserID    string     `json:"UserID"`
+	GrantType string     `json:"GrantType"`
+	Value     string     `json:"Value"`
+	Scope     Scope      `json:"Scope"`
+	ExpiresAt *time.Time `json:"ExpiresAt"`
+	Status    string     `json:"Status"`
+	CreatedAt time.Time  `json:"CreatedAt"`
+	CreatedBy string     `json:"CreatedBy"`
+	UpdatedAt time.Time  `json:"UpdatedAt"`
+	UpdatedBy string     `json:"UpdatedBy"`
+}
+
+// GrantInput is the payload accepted when granting a role.
+type GrantInput struct {
+	UserID    string  `json:"user_id"`
+	RoleName  string  `json:"role_name"`
+	Resource  string  `json:"resource"`
+	Scope     *Scope  `json:"scope,omitempty"`      // Takes precedence over Resource
+	ExpiresAt *string `json:"expires_at,omitempty"` // RFC3339
+}
+
+// ScopeParentInput places a scope below its parent in the scope tree.
+type ScopeParentInput struct {
+	Scope  Scope `json:"scope"`
+	Parent Scope `json:"parent"`
+}
+
+// ScopeAncestors lists the ancestors of a scope, nearest first.
+type ScopeAncestors struct {
+	Scope     Scope   `json:"scope"`
+	Ancestors []Scope `json:"ancestors"`
+}
+
+// Client is a typed client for the authz service.
+type Client struct {
+	c *client.Client
+}
+
+// New creates an authz client for the service listening at baseURL.
+func New(baseURL string, opts ...client.Option) *Client {
+	return &Client{c: client.New(baseURL, opts...)}
+}
+
+// EvaluatePermission calls POST /authz/policy/evaluate.
+func (c *Client) EvaluatePermission(ctx context.Context, in PermissionRequest) (*PermissionResponse, error) {
+	var out PermissionResponse
+	if err := c.c.Do(ctx, http.MethodPost, "/authz/policy/evaluate", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Can reports whether the user holds the permission in the given scope.
+func (c *Client) Can(ctx context.Context, userID, permission string, scope Scope) (bool, error) {
+	res, err := c.EvaluatePermission(ctx, PermissionRequest{
+		UserID:     userID,
+		Permission: permission,
+		Scope:      scope,
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.Allowed, nil
+}
+
+// EvaluatePermissions calls POST /authz/policy/evaluate/batch.
+func (c *Client) EvaluatePermissions(ctx context.Context, in BatchPermissionRequest) (*BatchPermissionResponse, error) {
+	var out BatchPermissionResponse
+	if err := c.c.Do(ctx, http.MethodPost, "/authz/policy/evaluate/batch", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Explain calls POST /authz/policy/explain.
+func (c *Client) Explain(ctx context.Context, in ExplainRequest) (*DecisionTrace, error) {
+	var out DecisionTrace
+	if err := c.c.Do(ctx, http.MethodPost, "/authz/policy/explain", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetPolicyVersion calls GET /authz/policy/version.
+func (c *Client) GetPolicyVersion(ctx context.Context) (int64, error) {
+	var out PolicyVersion
+	if err := c.c.Do(ctx, http.MethodGet, "/authz/policy/version", nil, &out); err != nil {
+		return 0, err
+	}
+	return out.Version, nil
+}
+
+// GetUserPermissions calls GET /authz/policy/users/{user_id}/permissions.
+func (c *Client) GetUserPermissions(ctx context.Context, userID string, scope Scope) (*UserPermissions, error) {
+	path := fmt.Sprintf("/authz/policy/users/%s/permissions", url.PathEscape(userID))
+	if scope.Type != "" {
+		q := url.Values{}
+		q.Set("scope_type", scope.Type)
+		q.Set("scope_id", scope.ID)
+		path += "?" + q.Encode()
+	}
+
+	var out UserPermissions
+	if err := c.c.Do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListRoles calls GET /authz/roles.
+func (c *Client) ListRoles(ctx context.Context) ([]Role, error) {
+	var out []Role
+	if err := c.c.Do(ctx, http.MethodGet, "/authz/roles", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateRole calls POST /authz/roles.
+func (c *Client) CreateRole(ctx context.Context, in RoleInput) (*Role, error) {
+	var out Role
+	if err := c.c.Do(ctx, http.MethodPost, "/authz/roles", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetRole calls GET /authz/roles/{id}.
+func (c *Client) GetRole(ctx context.Context, id string) (*Role, error) {
+	var out Role
+	if err := c.c.Do(ctx, http.MethodGet, fmt.Sprintf("/authz/roles/%s", url.PathEscape(id)), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateRole calls PUT /authz/roles/{id}.
+func (c *Client) UpdateRole(ctx context.Context, id string, in RoleInput) (*Role, error) {
+	var out Role
+	if err := c.c.Do(ctx, http.MethodPut, fmt.Sprintf("/authz/roles/%s", url.PathEscape(id)), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteRole calls DELETE /authz/roles/{id}.
+func (c *Client) DeleteRole(ctx context.Context, id string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/authz/roles/%s", url.PathEscape(id)), nil, nil)
+}
+
+// ListGrants calls GET /authz/grants.
+func (c *Client) ListGrants(ctx context.Context) ([]Grant, error) {
+	var out []Grant
+	if err := c.c.Do(ctx, http.MethodGet, "/authz/grants", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListGrantsByScope calls GET /authz/grants?scope_type=&scope_id=.
+// Grants on the ancestors of the scope and global grants are included.
+func (c *Client) ListGrantsByScope(ctx context.Context, scope Scope) ([]Grant, error) {
+	var out []Grant
+	if err := c.c.Do(ctx, http.MethodGet, "/authz/grants?"+scopeQuery("scope_type", "scope_id", scope), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateGrant calls POST /authz/grants.
+func (c *Client) CreateGrant(ctx context.Context, in GrantInput) (*Grant, error) {
+	var out Grant
+	if err := c.c.Do(ctx, http.MethodPost, "/authz/grants", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetGrant calls GET /authz/grants/{id}.
+func (c *Client) GetGrant(ctx context.Context, id string) (*Grant, error) {
+	var out Grant
+	if err := c.c.Do(ctx, http.MethodGet, fmt.Sprintf("/authz/grants/%s", url.PathEscape(id)), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeGrant calls DELETE /authz/grants/{id}.
+func (c *Client) RevokeGrant(ctx context.Context, id string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/authz/grants/%s", url.PathEscape(id)), nil, nil)
+}
+
+// ListUserGrants calls GET /authz/grants/users/{user_id}.
+func (c *Client) ListUserGrants(ctx context.Context, userID string) ([]Grant, error) {
+	var out []Grant
+	if err := c.c.Do(ctx, http.MethodGet, fmt.Sprintf("/authz/grants/users/%s", url.PathEscape(userID)), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListExpiredGrants calls GET /authz/grants/expired.
+func (c *Client) ListExpiredGrants(ctx context.Context) ([]Grant, error) {
+	var out []Grant
+	if err := c.c.Do(ctx, http.MethodGet, "/authz/grants/expired", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetScopeParent calls PUT /authz/scopes/parent.
+func (c *Client) SetScopeParent(ctx context.Context, scope, parent Scope) error {
+	return c.c.Do(ctx, http.MethodPut, "/authz/scopes/parent", ScopeParentInput{Scope: scope, Parent: parent}, nil)
+}
+
+// DeleteScopeParent calls DELETE /authz/scopes/parent, making the scope a root.
+func (c *Client) DeleteScopeParent(ctx context.Context, scope Scope) error {
+	return c.c.Do(ctx, http.MethodDelete, "/authz/scopes/parent?"+scopeQuery("type", "id", scope), nil, nil)
+}
+
+// GetScopeAncestors calls GET /authz/scopes/ancestors.
+func (c *Client) GetScopeAncestors(ctx context.Context, scope Scope) ([]Scope, error) {
+	var out ScopeAncestors
+	if err := c.c.Do(ctx, http.MethodGet, "/authz/scopes/ancestors?"+scopeQuery("type", "id", scope), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Ancestors, nil
+}
+
+// ListScopeChildren calls GET /authz/scopes/children.
+func (c *Client) ListScopeChildren(ctx context.Context, scope Scope) ([]Scope, error) {
+	var out []Scope
+	if err := c.c.Do(ctx, http.MethodGet, "/authz/scopes/children?"+scopeQuery("type", "id", scope), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func scopeQuery(typeKey, idKey string, scope Scope) string {
+	q := url.Values{}
+	q.Set(typeKey, scope.Type)
+	q.Set(idKey, scope.ID)
+	return q.Encode()
+}
@@ -0,0 +1,291 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client performs requests against a hatmax service and unwraps its response envelope.
+// Service specific clients (pkg/client/<service>) are thin typed wrappers around it.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      TokenSource
+	retry      RetryPolicy
+}
+
+// TokenSource returns the bearer token to send with a request.
+// An empty token means the request is sent without an Authorization header.
+type TokenSource func(ctx context.Context) (string, error)
+
+// RetryPolicy controls how failed idempotent requests are retried.
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts, including the first one
+	BaseDelay   time.Duration // Delay before the first retry, doubled on each attempt
+	MaxDelay    time.Duration // Upper bound for a single delay
+}
+
+// DefaultRetryPolicy is used when no policy is configured.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// NoRetry disables retries.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the underlying http.Client.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithToken sends a fixed bearer token with every request.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = func(context.Context) (string, error) { return token, nil }
+	}
+}
+
+// WithTokenSource resolves the bearer token per request.
+func WithTokenSource(ts TokenSource) Option {
+	return func(c *Client) {
+		c.token = ts
+	}
+}
+
+// WithRetryPolicy sets the retry policy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// New creates a Client for the service listening at baseURL.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		retry:      DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type tokenKey struct{}
+
+// ContextWithToken returns a context whose requests carry the given bearer token,
+// overriding the client token. Useful to forward the caller identity between services.
+func ContextWithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// Link is a hypermedia link returned in the response envelope.
+type Link struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+}
+
+type envelope struct {
+	Data  json.RawMessage `json:"data"`
+	Meta  json.RawMessage `json:"meta,omitempty"`
+	Links []Link          `json:"links,omitempty"`
+}
+
+type errorEnvelope struct {
+	Error struct {
+		Code    string            `json:"code"`
+		Message string            `json:"message"`
+		Details []ValidationError `json:"details,omitempty"`
+	} `json:"error"`
+}
+
+// Do sends a request with in encoded as JSON body (nil for none) and decodes the
+// envelope data into out (nil to discard). Non 2xx responses are returned as *Error.
+func (c *Client) Do(ctx context.Context, method, path string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("cannot encode request body: %w", err)
+		}
+	}
+
+	attempts := c.retry.MaxAttempts
+	if attempts < 1 || !isIdempotent(method) {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		res, err := c.send(ctx, method, path, body)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			lastErr = err
+			if attempt < attempts {
+				if err := c.wait(ctx, attempt, 0); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if attempt < attempts && isRetryableStatus(res.StatusCode) {
+			retryAfter := parseRetryAfter(res.Header.Get("Retry-After"))
+			res.Body.Close()
+			lastErr = &Error{StatusCode: res.StatusCode, Message: http.StatusText(res.StatusCode)}
+			if err := c.wait(ctx, attempt, retryAfter); err != nil {
+				return err
+			}
+			continue
+		}
+
+		return decodeResponse(res, out)
+	}
+
+	return lastErr
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	token, err := c.resolveToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+func (c *Client) resolveToken(ctx context.Context) (string, error) {
+	if token, ok := ctx.Value(tokenKey{}).(string); ok && token != "" {
+		return token, nil
+	}
+	if c.token == nil {
+		return "", nil
+	}
+	return c.token(ctx)
+}
+
+// wait sleeps before the next attempt using exponential backoff,
+// or the server provided Retry-After when present.
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter time.Duration) error {
+	delay := retryAfter
+	if delay == 0 {
+		delay = c.retry.BaseDelay << (attempt - 1)
+	}
+	if c.retry.MaxDelay > 0 && delay > c.retry.MaxDelay {
+		delay = c.retry.MaxDelay
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func decodeResponse(res *http.Response, out any) error {
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read response body: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		apiErr := &Error{StatusCode: res.StatusCode, Message: http.StatusText(res.StatusCode)}
+		var env errorEnvelope
+		if json.Unmarshal(raw, &env) == nil && env.Error.Message != "" {
+			apiErr.Code = env.Error.Code
+			apiErr.Message = env.Error.Message
+			apiErr.Details = env.Error.Details
+		}
+		return apiErr
+	}
+
+	if out == nil || len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return fmt.Errorf("cannot decode response envelope: %w", err)
+	}
+	if len(env.Data) == 0 || bytes.Equal(env.Data, []byte("null")) {
+		return nil
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		return fmt.Errorf("cannot decode response data: %w", err)
+	}
+	return nil
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
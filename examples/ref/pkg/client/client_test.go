@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+type item struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestClientDoUnwrapsEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"id":"1","name":"groceries"},"links":[{"rel":"self","href":"/lists/1"}]}`))
+	}))
+	defer srv.Close()
+
+	var got item
+	if err := New(srv.URL).Do(context.Background(), http.MethodGet, "/lists/1", nil, &got); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if got.ID != "1" || got.Name != "groceries" {
+		t.Errorf("Do() decoded %+v", got)
+	}
+}
+
+func TestClientDoNoContent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var got item
+	if err := New(srv.URL).Do(context.Background(), http.MethodDelete, "/lists/1", nil, &got); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+}
+
+func TestClientDoMapsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    []error
+		notWant []error
+	}{
+		{
+			name:    "not found",
+			status:  http.StatusNotFound,
+			body:    `{"error":{"code":"Not Found","message":"List not found"}}`,
+			want:    []error{ErrNotFound},
+			notWant: []error{ErrBadRequest},
+		},
+		{
+			name:   "validation",
+			status: http.StatusBadRequest,
+			body:   `{"error":{"code":"Bad Request","message":"Validation failed","details":[{"field":"name","code":"required","message":"name is required"}]}}`,
+			want:   []error{ErrBadRequest, ErrValidation},
+		},
+		{
+			name:    "plain bad request",
+			status:  http.StatusBadRequest,
+			body:    `{"error":{"code":"Bad Request","message":"Invalid id format"}}`,
+			want:    []error{ErrBadRequest},
+			notWant: []error{ErrValidation},
+		},
+		{
+			name:   "forbidden",
+			status: http.StatusForbidden,
+			body:   `{"error":{"code":"Forbidden","message":"Account is not active"}}`,
+			want:   []error{ErrForbidden},
+		},
+		{
+			name:   "server error without payload",
+			status: http.StatusInternalServerError,
+			body:   `oops`,
+			want:   []error{ErrServer},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			err := New(srv.URL, WithRetryPolicy(NoRetry)).Do(context.Background(), http.MethodGet, "/", nil, nil)
+
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Do() error = %v, want *Error", err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.status)
+			}
+			for _, target := range tt.want {
+				if !errors.Is(err, target) {
+					t.Errorf("errors.Is(%v, %v) = false", err, target)
+				}
+			}
+			for _, target := range tt.notWant {
+				if errors.Is(err, target) {
+					t.Errorf("errors.Is(%v, %v) = true", err, target)
+				}
+			}
+		})
+	}
+}
+
+func TestClientDoRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		failures  int32
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"get recovers", http.MethodGet, 2, 3, false},
+		{"get gives up", http.MethodGet, 5, 3, true},
+		{"post is not retried", http.MethodPost, 1, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte(`{"data":null}`))
+			}))
+			defer srv.Close()
+
+			err := New(srv.URL, WithRetryPolicy(fastRetry)).Do(context.Background(), tt.method, "/", nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientDoBearerToken(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithToken("service-token"))
+
+	if err := c.Do(context.Background(), http.MethodGet, "/", nil, nil); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if got != "Bearer service-token" {
+		t.Errorf("Authorization = %q, want client token", got)
+	}
+
+	ctx := ContextWithToken(context.Background(), "user-token")
+	if err := c.Do(ctx, http.MethodGet, "/", nil, nil); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if got != "Bearer user-token" {
+		t.Errorf("Authorization = %q, want context token", got)
+	}
+}
+
+func TestClientDoContextCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := New(srv.URL, WithRetryPolicy(fastRetry)).Do(ctx, http.MethodGet, "/", nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/adrianpk/hatmax-ref/pkg/client
+
+go 1.23
@@ -0,0 +1,162 @@
+// Package todo is a typed client for the todo service.
+package todo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/adrianpk/hatmax-ref/pkg/client"
+)
+
+// List mirrors the List resource returned by the service.
+type List struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+	CreatedBy   string    `json:"created_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UpdatedBy   string    `json:"updated_by"`
+	Items       []Item    `json:"items"`
+	Tags        []Tag     `json:"tags"`
+}
+
+// ListInput holds the List fields accepted on create and update.
+type ListInput struct {
+	Description string `json:"description"`
+	Name        string `json:"name"`
+}
+
+// Item mirrors the Item resource returned by the service.
+type Item struct {
+	ID        string    `json:"id"`
+	Done      bool      `json:"done"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by"`
+}
+
+// ItemInput holds the Item fields accepted on create and update.
+type ItemInput struct {
+	Done bool   `json:"done"`
+	Text string `json:"text"`
+}
+
+// Tag mirrors the Tag resource returned by the service.
+type Tag struct {
+	ID        string    `json:"id"`
+	Color     string    `json:"color"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by"`
+}
+
+// TagInput holds the Tag fields accepted on create and update.
+type TagInput struct {
+	Color string `json:"color"`
+	Name  string `json:"name"`
+}
+
+// Client is a typed client for the todo service.
+type Client struct {
+	c *client.Client
+}
+
+// New creates a todo client for the service listening at baseURL.
+func New(baseURL string, opts ...client.Option) *Client {
+	return &Client{c: client.New(baseURL, opts...)}
+}
+
+// CreateList calls POST /lists.
+func (c *Client) CreateList(ctx context.Context, in ListInput) (*List, error) {
+	var out List
+	if err := c.c.Do(ctx, http.MethodPost, "/lists", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAllLists calls GET /lists.
+func (c *Client) GetAllLists(ctx context.Context) ([]List, error) {
+	var out []List
+	if err := c.c.Do(ctx, http.MethodGet, "/lists", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetList calls GET /lists/{id}.
+func (c *Client) GetList(ctx context.Context, id string) (*List, error) {
+	var out List
+	if err := c.c.Do(ctx, http.MethodGet, fmt.Sprintf("/lists/%s", url.PathEscape(id)), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateList calls PUT /lists/{id}.
+func (c *Client) UpdateList(ctx context.Context, id string, in ListInput) (*List, error) {
+	var out List
+	if err := c.c.Do(ctx, http.MethodPut, fmt.Sprintf("/lists/%s", url.PathEscape(id)), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteList calls DELETE /lists/{id}.
+func (c *Client) DeleteList(ctx context.Context, id string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/lists/%s", url.PathEscape(id)), nil, nil)
+}
+
+// AddItemToList calls POST /lists/{id}/items.
+func (c *Client) AddItemToList(ctx context.Context, id string, in ItemInput) (*Item, error) {
+	var out Item
+	if err := c.c.Do(ctx, http.MethodPost, fmt.Sprintf("/lists/%s/items", url.PathEscape(id)), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateItemInList calls PUT /lists/{id}/items/{childId}.
+func (c *Client) UpdateItemInList(ctx context.Context, id string, childID string, in ItemInput) (*Item, error) {
+	var out Item
+	if err := c.c.Do(ctx, http.MethodPut, fmt.Sprintf("/lists/%s/items/%s", url.PathEscape(id), url.PathEscape(childID)), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveItemFromList calls DELETE /lists/{id}/items/{childId}.
+func (c *Client) RemoveItemFromList(ctx context.Context, id string, childID string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/lists/%s/items/%s", url.PathEscape(id), url.PathEscape(childID)), nil, nil)
+}
+
+// AddTagToList calls POST /lists/{id}/tags.
+func (c *Client) AddTagToList(ctx context.Context, id string, in TagInput) (*Tag, error) {
+	var out Tag
+	if err := c.c.Do(ctx, http.MethodPost, fmt.Sprintf("/lists/%s/tags", url.PathEscape(id)), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateTagInList calls PUT /lists/{id}/tags/{childId}.
+func (c *Client) UpdateTagInList(ctx context.Context, id string, childID string, in TagInput) (*Tag, error) {
+	var out Tag
+	if err := c.c.Do(ctx, http.MethodPut, fmt.Sprintf("/lists/%s/tags/%s", url.PathEscape(id), url.PathEscape(childID)), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RemoveTagFromList calls DELETE /lists/{id}/tags/{childId}.
+func (c *Client) RemoveTagFromList(ctx context.Context, id string, childID string) error {
+	return c.c.Do(ctx, http.MethodDelete, fmt.Sprintf("/lists/%s/tags/%s", url.PathEscape(id), url.PathEscape(childID)), nil, nil)
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, id, hash := GenerateAPIKey()
+
+	if !IsAPIKey(key) {
+		t.Fatalf("GenerateAPIKey() = %q, want the %s prefix", key, APIKeyPrefix)
+	}
+
+	gotID, secret, err := ParseAPIKey(key)
+	if err != nil {
+		t.Fatalf("ParseAPIKey() error = %v", err)
+	}
+	if gotID != id {
+		t.Errorf("ParseAPIKey() id = %s, want %s", gotID, id)
+	}
+	if !VerifyAPIKeySecret(secret, hash) {
+		t.Error("VerifyAPIKeySecret() = false for the generated secret")
+	}
+	if VerifyAPIKeySecret(secret+"x", hash) {
+		t.Error("VerifyAPIKeySecret() = true for another secret")
+	}
+
+	other, _, _ := GenerateAPIKey()
+	if other == key {
+		t.Error("GenerateAPIKey() returned the same key twice")
+	}
+}
+
+func TestParseAPIKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"valid", "hmk_0123456789abcdef_c2VjcmV0", false},
+		{"secret with underscores", "hmk_0123456789abcdef_a_b_c", false},
+		{"paseto token", "v4.public.payload", true},
+		{"no secret", "hmk_0123456789abcdef", true},
+		{"empty secret", "hmk_0123456789abcdef_", true},
+		{"short id", "hmk_0123_secret", true},
+		{"id not hex", "hmk_0123456789abcdeg_secret", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, secret, err := ParseAPIKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAPIKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !strings.HasSuffix(tt.key, id+"_"+secret) {
+				t.Errorf("ParseAPIKey() = %s, %s, want the parts of %s", id, secret, tt.key)
+			}
+		})
+	}
+}
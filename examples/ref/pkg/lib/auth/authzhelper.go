@@ -12,6 +12,13 @@ type AuthzClient interface {
 	CheckPermission(ctx context.Context, userID, permission, resource string) (bool, error)
 }
 
+// BatchAuthzClient evaluates several permissions of a user in one call
+// CheckMultiplePermissions uses it when the client implements it
+type BatchAuthzClient interface {
+	AuthzClient
+	CheckPermissions(ctx context.Context, userID string, checks []PermissionCheck) ([]bool, error)
+}
+
 // PermissionCache manages cached permission results
 type PermissionCache struct {
 	permissions map[string]CachedPermission
@@ -35,15 +42,20 @@ func NewPermissionCache(defaultTTL time.Duration) *PermissionCache {
 
 // AuthzHelper provides transparent caching for authorization checks
 type AuthzHelper struct {
-	client AuthzClient
-	cache  *PermissionCache
+	client  AuthzClient
+	cache   *PermissionCache
+	flights flightGroup
+
+	versionMutex sync.Mutex
+	versions     map[string]int // Last authz_ver seen per user
 }
 
 // NewAuthzHelper creates a new authorization helper with caching
 func NewAuthzHelper(client AuthzClient, cacheTTL time.Duration) *AuthzHelper {
 	return &AuthzHelper{
-		client: client,
-		cache:  NewPermissionCache(cacheTTL),
+		client:   client,
+		cache:    NewPermissionCache(cacheTTL),
+		versions: make(map[string]int),
 	}
 }
 
@@ -56,30 +68,95 @@ func (h *AuthzHelper) CheckPermission(ctx context.Context, userID, permission, r
 	}
 
 	// Cache miss - call AuthZ service
-	allowed, err := h.client.CheckPermission(ctx, userID, permission, resource)
-	if err != nil {
-		return false, err
-	}
-
-	// Cache the result
-	h.setCachedPermission(userID, permission, resource, allowed)
+	// Concurrent misses for the same check share a single call
+	return h.flights.do(h.cacheKey(userID, permission, resource), func() (bool, error) {
+		allowed, err := h.client.CheckPermission(ctx, userID, permission, resource)
+		if err != nil {
+			return false, err
+		}
 
-	return allowed, nil
+		// Cache the result
+		h.setCachedPermission(userID, permission, resource, allowed)
+		return allowed, nil
+	})
 }
 
 // CheckMultiplePermissions checks multiple permissions efficiently
-// Returns map of permission results - useful for UI rendering
+// Returns map of permission results keyed by permission:resource - useful for UI rendering
+// Cache misses are sent in one call when the client is a BatchAuthzClient,
+// leaving out the checks already in flight, which are waited for
 func (h *AuthzHelper) CheckMultiplePermissions(ctx context.Context, userID string, checks []PermissionCheck) (map[string]bool, error) {
 	results := make(map[string]bool)
+	var misses []PermissionCheck
 
 	for _, check := range checks {
-		allowed, err := h.CheckPermission(ctx, userID, check.Permission, check.Resource)
-		if err != nil {
-			return nil, fmt.Errorf("error check %s:%s: %w", check.Permission, check.Resource, err)
+		key := fmt.Sprintf("%s:%s", check.Permission, check.Resource)
+		if allowed, found := h.getCachedPermission(userID, check.Permission, check.Resource); found {
+			results[key] = allowed
+			continue
+		}
+		misses = append(misses, check)
+	}
+
+	if len(misses) == 0 {
+		return results, nil
+	}
+
+	batch, ok := h.client.(BatchAuthzClient)
+	if !ok {
+		for _, check := range misses {
+			allowed, err := h.CheckPermission(ctx, userID, check.Permission, check.Resource)
+			if err != nil {
+				return nil, fmt.Errorf("error check %s:%s: %w", check.Permission, check.Resource, err)
+			}
+
+			key := fmt.Sprintf("%s:%s", check.Permission, check.Resource)
+			results[key] = allowed
+		}
+		return results, nil
+	}
+
+	var (
+		owned      []PermissionCheck
+		ownedCalls []*flightCall
+		calls      = make([]*flightCall, len(misses))
+	)
+	for i, check := range misses {
+		call, owner := h.flights.join(h.cacheKey(userID, check.Permission, check.Resource))
+		if owner {
+			owned = append(owned, check)
+			ownedCalls = append(ownedCalls, call)
+		}
+		calls[i] = call
+	}
+
+	if len(owned) > 0 {
+		allowed, err := batch.CheckPermissions(ctx, userID, owned)
+		if err == nil && len(allowed) != len(owned) {
+			err = fmt.Errorf("got %d results for %d checks", len(allowed), len(owned))
+		}
+
+		// Every owned call is finished, failed or not, to release its waiters
+		for i, check := range owned {
+			key := h.cacheKey(userID, check.Permission, check.Resource)
+			if err != nil {
+				h.flights.finish(key, ownedCalls[i], false, err)
+				continue
+			}
+			h.setCachedPermission(userID, check.Permission, check.Resource, allowed[i])
+			h.flights.finish(key, ownedCalls[i], allowed[i], nil)
+		}
+	}
+
+	for i, check := range misses {
+		call := calls[i]
+		<-call.done
+		if call.err != nil {
+			return nil, fmt.Errorf("error batch check: %w", call.err)
 		}
 
 		key := fmt.Sprintf("%s:%s", check.Permission, check.Resource)
-		results[key] = allowed
+		results[key] = call.allowed
 	}
 
 	return results, nil
@@ -143,6 +220,36 @@ func (h *AuthzHelper) ClearUserCache(userID string) {
 	}
 }
 
+// ClearCache removes all cached permissions
+// Useful when authz reports that grants or roles changed
+func (h *AuthzHelper) ClearCache() {
+	h.cache.mutex.Lock()
+	defer h.cache.mutex.Unlock()
+
+	h.cache.permissions = make(map[string]CachedPermission)
+}
+
+// ObserveAuthzVersion records the authz_ver claim of a user token
+// authn issues tokens with the authz policy version, so a newer version than
+// the last one seen means grants may have changed and the user cache is cleared. Returns true when the cache was cleared
+func (h *AuthzHelper) ObserveAuthzVersion(userID string, version int) bool {
+	h.versionMutex.Lock()
+	last, seen := h.versions[userID]
+	if seen && version <= last {
+		h.versionMutex.Unlock()
+		return false
+	}
+	h.versions[userID] = version
+	h.versionMutex.Unlock()
+
+	if !seen {
+		return false
+	}
+
+	h.ClearUserCache(userID)
+	return true
+}
+
 // ClearExpiredCache removes expired entries from cache
 // Should be called periodically to prevent memory leaks
 func (h *AuthzHelper) ClearExpiredCache() {
@@ -187,7 +294,91 @@ func HasAllPermissions(ctx context.Context, helper *AuthzHelper, userID string,
 	return true, nil
 }
 
-// IsResourceOwner checks if user owns/created the resource
-func IsResourceOwner(ctx context.Context, helper *AuthzHelper, userID, resourceID string) (bool, error) {
-	return helper.CheckPermission(ctx, userID, "own", resourceID)
+// IsResourceOwner checks if user owns the resource, as recorded in its
+// owner_id attribute
+func IsResourceOwner(userID string, resource Attributes) bool {
+	req := AccessRequest{Subject: Attributes{"id": userID}, Resource: resource}
+	holds, ok := EvaluateCondition(OwnerCondition(), req)
+	return ok && holds
+}
+
+// CheckPolicy evaluates a resource policy for a user. The permissions its
+// rules for the action refer to are checked on resource through the cache;
+// the subject ID defaults to userID.
+func (h *AuthzHelper) CheckPolicy(ctx context.Context, policy ResourcePolicy, action, userID, resource string, req AccessRequest) (bool, error) {
+	req.Permissions = nil
+	for _, permission := range actionPermissions(policy, action) {
+		allowed, err := h.CheckPermission(ctx, userID, permission, resource)
+		if err != nil {
+			return false, err
+		}
+		if allowed {
+			req.Permissions = append(req.Permissions, permission)
+		}
+	}
+
+	if req.Subject["id"] == "" {
+		subject := Attributes{"id": userID}
+		for key, value := range req.Subject {
+			if key != "id" {
+				subject[key] = value
+			}
+		}
+		req.Subject = subject
+	}
+
+	return EvaluatePolicyRequest(policy, action, req), nil
+}
+
+// flightGroup runs one call per key at a time; concurrent callers with the
+// same key wait for it and share its result
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	allowed bool
+	err     error
+}
+
+func (g *flightGroup) do(key string, fn func() (bool, error)) (bool, error) {
+	call, owner := g.join(key)
+	if !owner {
+		<-call.done
+		return call.allowed, call.err
+	}
+
+	allowed, err := fn()
+	g.finish(key, call, allowed, err)
+	return allowed, err
+}
+
+// join returns the call in flight for key, or starts one owned by the caller,
+// who must finish it
+func (g *flightGroup) join(key string) (*flightCall, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		return call, false
+	}
+
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	return call, true
+}
+
+// finish records the result of a call and releases its waiters
+func (g *flightGroup) finish(key string, call *flightCall, allowed bool, err error) {
+	call.allowed, call.err = allowed, err
+
+	g.mutex.Lock()
+	delete(g.calls, key)
+	g.mutex.Unlock()
+	close(call.done)
 }
@@ -3,6 +3,8 @@ package auth
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -207,6 +209,187 @@ func TestAuthzHelper_ClearUserCache(t *testing.T) {
 	}
 }
 
+// Mock BatchAuthzClient for testing
+type mockBatchAuthzClient struct {
+	mockAuthzClient
+	batchCalls int
+	lastChecks []PermissionCheck
+}
+
+func (m *mockBatchAuthzClient) CheckPermissions(ctx context.Context, userID string, checks []PermissionCheck) ([]bool, error) {
+	m.batchCalls++
+	m.lastChecks = checks
+	results := make([]bool, len(checks))
+	for i, check := range checks {
+		results[i] = m.permissions[fmt.Sprintf("%s:%s:%s", userID, check.Permission, check.Resource)]
+	}
+	return results, nil
+}
+
+func TestAuthzHelper_CheckMultiplePermissionsBatch(t *testing.T) {
+	mockClient := &mockBatchAuthzClient{mockAuthzClient: mockAuthzClient{
+		permissions: map[string]bool{
+			"user1:read:/api/todos":  true,
+			"user1:write:/api/todos": false,
+		},
+	}}
+
+	helper := NewAuthzHelper(mockClient, 5*time.Minute)
+	ctx := context.Background()
+
+	// Cache one of the checks
+	_, _ = helper.CheckPermission(ctx, "user1", "read", "/api/todos")
+
+	checks := []PermissionCheck{
+		{Permission: "read", Resource: "/api/todos"},
+		{Permission: "write", Resource: "/api/todos"},
+		{Permission: "delete", Resource: "/api/todos"},
+	}
+
+	results, err := helper.CheckMultiplePermissions(ctx, "user1", checks)
+	if err != nil {
+		t.Fatalf("CheckMultiplePermissions() error = %v", err)
+	}
+
+	if mockClient.batchCalls != 1 || len(mockClient.lastChecks) != 2 {
+		t.Errorf("Expected 1 batch call with the 2 uncached checks, got %d calls with %v", mockClient.batchCalls, mockClient.lastChecks)
+	}
+	if !results["read:/api/todos"] || results["write:/api/todos"] || results["delete:/api/todos"] {
+		t.Errorf("CheckMultiplePermissions() = %v, want only read allowed", results)
+	}
+
+	// Batch results are cached
+	_, _ = helper.CheckMultiplePermissions(ctx, "user1", checks)
+	if mockClient.batchCalls != 1 {
+		t.Errorf("Expected 1 batch call (cached), got %d", mockClient.batchCalls)
+	}
+}
+
+// Blocking AuthzClient counting concurrent calls
+type slowAuthzClient struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (s *slowAuthzClient) CheckPermission(ctx context.Context, userID, permission, resource string) (bool, error) {
+	s.calls.Add(1)
+	<-s.release
+	return true, nil
+}
+
+func TestAuthzHelper_ConcurrentChecksShareOneCall(t *testing.T) {
+	client := &slowAuthzClient{release: make(chan struct{})}
+	helper := NewAuthzHelper(client, 5*time.Minute)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if allowed, err := helper.CheckPermission(ctx, "user1", "read", "/api/todos"); err != nil || !allowed {
+				t.Errorf("CheckPermission() = %v, %v, want allowed", allowed, err)
+			}
+		}()
+	}
+
+	// Let the callers pile up on the in-flight check
+	time.Sleep(20 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+
+	if got := client.calls.Load(); got != 1 {
+		t.Errorf("Expected 1 service call for concurrent checks, got %d", got)
+	}
+}
+
+// Blocking BatchAuthzClient counting concurrent batch calls and their checks
+type slowBatchAuthzClient struct {
+	slowAuthzClient
+	checks atomic.Int32
+}
+
+func (s *slowBatchAuthzClient) CheckPermissions(ctx context.Context, userID string, checks []PermissionCheck) ([]bool, error) {
+	s.calls.Add(1)
+	s.checks.Add(int32(len(checks)))
+	<-s.release
+	results := make([]bool, len(checks))
+	for i := range results {
+		results[i] = true
+	}
+	return results, nil
+}
+
+func TestAuthzHelper_ConcurrentBatchesShareChecks(t *testing.T) {
+	client := &slowBatchAuthzClient{slowAuthzClient: slowAuthzClient{release: make(chan struct{})}}
+	helper := NewAuthzHelper(client, 5*time.Minute)
+	ctx := context.Background()
+
+	checks := []PermissionCheck{
+		{Permission: "read", Resource: "/api/todos"},
+		{Permission: "write", Resource: "/api/todos"},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := helper.CheckMultiplePermissions(ctx, "user1", checks)
+			if err != nil || !results["read:/api/todos"] || !results["write:/api/todos"] {
+				t.Errorf("CheckMultiplePermissions() = %v, %v, want both allowed", results, err)
+			}
+		}()
+	}
+
+	// Let the callers pile up on the in-flight batch
+	time.Sleep(20 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+
+	if got := client.checks.Load(); got != 2 {
+		t.Errorf("Expected the 2 checks sent once for concurrent batches, got %d checks in %d calls", got, client.calls.Load())
+	}
+}
+
+func TestAuthzHelper_ObserveAuthzVersion(t *testing.T) {
+	mockClient := &mockAuthzClient{
+		permissions: map[string]bool{
+			"user1:read:/api/todos": true,
+		},
+	}
+
+	helper := NewAuthzHelper(mockClient, 5*time.Minute)
+	ctx := context.Background()
+
+	if helper.ObserveAuthzVersion("user1", 1) {
+		t.Error("ObserveAuthzVersion() first version cleared the cache")
+	}
+	_, _ = helper.CheckPermission(ctx, "user1", "read", "/api/todos")
+
+	if helper.ObserveAuthzVersion("user1", 1) {
+		t.Error("ObserveAuthzVersion() same version cleared the cache")
+	}
+	_, _ = helper.CheckPermission(ctx, "user1", "read", "/api/todos")
+	if mockClient.callCount != 1 {
+		t.Errorf("Expected 1 service call, got %d", mockClient.callCount)
+	}
+
+	if !helper.ObserveAuthzVersion("user1", 2) {
+		t.Error("ObserveAuthzVersion() newer version did not clear the cache")
+	}
+	_, _ = helper.CheckPermission(ctx, "user1", "read", "/api/todos")
+	if mockClient.callCount != 2 {
+		t.Errorf("Expected 2 service calls (cache cleared), got %d", mockClient.callCount)
+	}
+
+	helper.ClearCache()
+	_, _ = helper.CheckPermission(ctx, "user1", "read", "/api/todos")
+	if mockClient.callCount != 3 {
+		t.Errorf("Expected 3 service calls (cache cleared), got %d", mockClient.callCount)
+	}
+}
+
 func TestHasAnyPermission(t *testing.T) {
 	mockClient := &mockAuthzClient{
 		permissions: map[string]bool{
@@ -250,3 +433,76 @@ func TestHasAllPermissions(t *testing.T) {
 		t.Errorf("HasAllPermissions() = %v, want false", allowed)
 	}
 }
+func TestIsResourceOwner(t *testing.T) {
+	if !IsResourceOwner("user1", Attributes{"owner_id": "user1"}) {
+		t.Error("IsResourceOwner() = false for the owner, want true")
+	}
+	if IsResourceOwner("user2", Attributes{"owner_id": "user1"}) {
+		t.Error("IsResourceOwner() = true for another user, want false")
+	}
+	if IsResourceOwner("user1", Attributes{}) {
+		t.Error("IsResourceOwner() = true without an owner, want false")
+	}
+	if IsResourceOwner("", Attributes{"owner_id": ""}) {
+		t.Error("IsResourceOwner() = true for empty IDs, want false")
+	}
+}
+
+func TestAuthzHelper_CheckPolicy(t *testing.T) {
+	mockClient := &mockAuthzClient{
+		permissions: map[string]bool{
+			"admin:lists:write:/lists/1": true,
+		},
+	}
+	helper := NewAuthzHelper(mockClient, 5*time.Minute)
+	ctx := context.Background()
+
+	policy := ResourcePolicy{
+		ID:      "list",
+		Type:    "list",
+		Version: 1,
+		Actions: map[string]PolicyRule{
+			"edit": {
+				AnyOf: []string{"lists:write"},
+				Or: []PolicyRule{
+					{Conditions: []Condition{OwnerCondition()}},
+				},
+			},
+		},
+		Deny: map[string][]PolicyRule{
+			"edit": {
+				{
+					Conditions: []Condition{
+						{Attribute: "resource.status", Operator: ConditionEquals, Value: "archived"},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		userID   string
+		resource Attributes
+		expected bool
+	}{
+		{"owner", "user1", Attributes{"owner_id": "user1", "status": "open"}, true},
+		{"not owner", "user2", Attributes{"owner_id": "user1", "status": "open"}, false},
+		{"permission", "admin", Attributes{"owner_id": "user1", "status": "open"}, true},
+		{"archived denies the owner", "user1", Attributes{"owner_id": "user1", "status": "archived"}, false},
+		{"archived denies the permission", "admin", Attributes{"owner_id": "user1", "status": "archived"}, false},
+		{"unknown status denies", "admin", Attributes{"owner_id": "user1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := helper.CheckPolicy(ctx, policy, "edit", tt.userID, "/lists/1", AccessRequest{Resource: tt.resource})
+			if err != nil {
+				t.Fatalf("CheckPolicy() error = %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("CheckPolicy() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
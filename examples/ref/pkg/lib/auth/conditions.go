@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Attribute sources a condition can read from
+const (
+	AttributeSubject  = "subject"
+	AttributeResource = "resource"
+	AttributeContext  = "context"
+)
+
+// OwnerAttribute is the resource attribute holding the ID of its owner
+const OwnerAttribute = "owner_id"
+
+// OwnerCondition holds when the subject owns the resource
+func OwnerCondition() Condition {
+	return Condition{
+		Attribute: AttributeResource + "." + OwnerAttribute,
+		Operator:  ConditionEquals,
+		ValueFrom: AttributeSubject + ".id",
+	}
+}
+
+// Attribute returns an attribute of the request by its qualified name, as in
+// "subject.id". "context.time" falls back to the request time, or now.
+func (r AccessRequest) Attribute(name string) (string, bool) {
+	source, key, found := strings.Cut(name, ".")
+	if !found || key == "" {
+		return "", false
+	}
+
+	var attrs Attributes
+	switch source {
+	case AttributeSubject:
+		attrs = r.Subject
+	case AttributeResource:
+		attrs = r.Resource
+	case AttributeContext:
+		attrs = r.Context
+	default:
+		return "", false
+	}
+
+	if value, ok := attrs[key]; ok && value != "" {
+		return value, true
+	}
+
+	if source == AttributeContext && key == "time" {
+		return r.now().Format(time.RFC3339), true
+	}
+
+	return "", false
+}
+
+func (r AccessRequest) now() time.Time {
+	if r.Time.IsZero() {
+		return time.Now()
+	}
+	return r.Time
+}
+
+// EvaluateCondition reports whether the condition holds for the request.
+// ok is false when it cannot be evaluated, as when an attribute is missing
+// or a value is malformed; callers decide which way that fails.
+func EvaluateCondition(cond Condition, req AccessRequest) (holds bool, ok bool) {
+	value, present := req.Attribute(cond.Attribute)
+
+	if cond.Operator == ConditionExists {
+		return present, true
+	}
+	if !present {
+		return false, false
+	}
+
+	switch cond.Operator {
+	case ConditionEquals, ConditionNotEquals:
+		expected := cond.Value
+		if cond.ValueFrom != "" {
+			var found bool
+			expected, found = req.Attribute(cond.ValueFrom)
+			if !found {
+				return false, false
+			}
+		}
+		return (value == expected) == (cond.Operator == ConditionEquals), true
+
+	case ConditionIn, ConditionNotIn:
+		return containsString(cond.Values, value) == (cond.Operator == ConditionIn), true
+
+	case ConditionIPIn, ConditionIPNotIn:
+		in, ok := ipInRanges(value, cond.Values)
+		if !ok {
+			return false, false
+		}
+		return in == (cond.Operator == ConditionIPIn), true
+
+	case ConditionBefore, ConditionAfter:
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return false, false
+		}
+		limit, err := time.Parse(time.RFC3339, cond.Value)
+		if err != nil {
+			return false, false
+		}
+		if cond.Operator == ConditionBefore {
+			return at.Before(limit), true
+		}
+		return at.After(limit), true
+
+	case ConditionTimeBetween:
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return false, false
+		}
+		return inTimeWindow(at, cond.Values)
+	}
+
+	return false, false
+}
+
+// ValidateCondition checks a condition can be evaluated
+func ValidateCondition(cond Condition, field string) ValidationErrors {
+	var errors ValidationErrors
+
+	invalid := func(code, message string) {
+		errors = append(errors, ValidationError{Field: field, Code: code, Message: message})
+	}
+
+	if !validAttributeName(cond.Attribute) {
+		invalid("invalid_attribute", "Condition attribute must be subject.*, resource.* or context.*")
+	}
+	if cond.ValueFrom != "" && !validAttributeName(cond.ValueFrom) {
+		invalid("invalid_attribute", "Condition valueFrom must be subject.*, resource.* or context.*")
+	}
+
+	switch cond.Operator {
+	case ConditionEquals, ConditionNotEquals, ConditionExists:
+	case ConditionIn, ConditionNotIn:
+		if len(cond.Values) == 0 {
+			invalid("required", "Condition values are required")
+		}
+	case ConditionIPIn, ConditionIPNotIn:
+		if len(cond.Values) == 0 {
+			invalid("required", "Condition values are required")
+		}
+		if _, ok := ipInRanges("127.0.0.1", cond.Values); !ok {
+			invalid("invalid_value", "Condition values must be IP addresses or CIDR ranges")
+		}
+	case ConditionBefore, ConditionAfter:
+		if _, err := time.Parse(time.RFC3339, cond.Value); err != nil {
+			invalid("invalid_value", "Condition value must be an RFC 3339 time")
+		}
+	case ConditionTimeBetween:
+		if _, ok := inTimeWindow(time.Now(), cond.Values); !ok {
+			invalid("invalid_value", "Condition values must be a from and to time as 15:04, and an optional location")
+		}
+	default:
+		invalid("invalid_operator", "Unknown condition operator '"+string(cond.Operator)+"'")
+	}
+
+	return errors
+}
+
+func validAttributeName(name string) bool {
+	source, key, found := strings.Cut(name, ".")
+	if !found || key == "" {
+		return false
+	}
+	return source == AttributeSubject || source == AttributeResource || source == AttributeContext
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ipInRanges reports whether ip is one of the addresses or in one of the
+// CIDR ranges. ok is false when any of them does not parse.
+func ipInRanges(ip string, ranges []string) (in bool, ok bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false, false
+	}
+	addr = addr.Unmap()
+
+	for _, r := range ranges {
+		if strings.Contains(r, "/") {
+			prefix, err := netip.ParsePrefix(r)
+			if err != nil {
+				return false, false
+			}
+			in = in || prefix.Contains(addr)
+			continue
+		}
+
+		other, err := netip.ParseAddr(r)
+		if err != nil {
+			return false, false
+		}
+		in = in || other.Unmap() == addr
+	}
+
+	return in, true
+}
+
+// inTimeWindow reports whether the time of day of at is within the window
+// given as from and to times, 15:04, and an optional location, UTC by
+// default. Windows ending before they start span midnight.
+func inTimeWindow(at time.Time, window []string) (in bool, ok bool) {
+	if len(window) != 2 && len(window) != 3 {
+		return false, false
+	}
+
+	from, fromOK := minuteOfDay(window[0])
+	to, toOK := minuteOfDay(window[1])
+	if !fromOK || !toOK {
+		return false, false
+	}
+
+	loc := time.UTC
+	if len(window) == 3 {
+		var err error
+		if loc, err = time.LoadLocation(window[2]); err != nil {
+			return false, false
+		}
+	}
+
+	local := at.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	if from <= to {
+		return minute >= from && minute < to, true
+	}
+	return minute >= from || minute < to, true
+}
+
+func minuteOfDay(value string) (int, bool) {
+	hours, minutes, found := strings.Cut(value, ":")
+	if !found {
+		return 0, false
+	}
+	h, err := strconv.Atoi(hours)
+	if err != nil || h < 0 || h > 23 {
+		return 0, false
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 || m > 59 {
+		return 0, false
+	}
+	return h*60 + m, true
+}
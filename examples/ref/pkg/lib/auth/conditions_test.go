@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluateCondition(t *testing.T) {
+	at := time.Date(2025, 10, 20, 10, 30, 0, 0, time.UTC)
+	req := AccessRequest{
+		Subject:  Attributes{"id": "user1", "department": "sales"},
+		Resource: Attributes{"owner_id": "user1", "status": "open"},
+		Context:  Attributes{"ip": "10.1.2.3"},
+		Time:     at,
+	}
+
+	tests := []struct {
+		name   string
+		cond   Condition
+		holds  bool
+		usable bool
+	}{
+		{"owner", OwnerCondition(), true, true},
+		{"equals", Condition{Attribute: "resource.status", Operator: ConditionEquals, Value: "open"}, true, true},
+		{"equals other value", Condition{Attribute: "resource.status", Operator: ConditionEquals, Value: "archived"}, false, true},
+		{"not equals", Condition{Attribute: "resource.status", Operator: ConditionNotEquals, Value: "archived"}, true, true},
+		{"value from missing attribute", Condition{Attribute: "resource.owner_id", Operator: ConditionEquals, ValueFrom: "subject.team"}, false, false},
+		{"in", Condition{Attribute: "subject.department", Operator: ConditionIn, Values: []string{"sales", "support"}}, true, true},
+		{"not in", Condition{Attribute: "subject.department", Operator: ConditionNotIn, Values: []string{"sales"}}, false, true},
+		{"missing attribute", Condition{Attribute: "resource.region", Operator: ConditionEquals, Value: "eu"}, false, false},
+		{"unknown source", Condition{Attribute: "request.ip", Operator: ConditionExists}, false, true},
+		{"exists", Condition{Attribute: "context.ip", Operator: ConditionExists}, true, true},
+		{"does not exist", Condition{Attribute: "resource.region", Operator: ConditionExists}, false, true},
+		{"ip in range", Condition{Attribute: "context.ip", Operator: ConditionIPIn, Values: []string{"10.0.0.0/8"}}, true, true},
+		{"ip in list", Condition{Attribute: "context.ip", Operator: ConditionIPIn, Values: []string{"192.168.0.1", "10.1.2.3"}}, true, true},
+		{"ip out of range", Condition{Attribute: "context.ip", Operator: ConditionIPIn, Values: []string{"192.168.0.0/16"}}, false, true},
+		{"ip not in range", Condition{Attribute: "context.ip", Operator: ConditionIPNotIn, Values: []string{"192.168.0.0/16"}}, true, true},
+		{"malformed range", Condition{Attribute: "context.ip", Operator: ConditionIPIn, Values: []string{"10.0.0.0/99"}}, false, false},
+		{"before", Condition{Attribute: "context.time", Operator: ConditionBefore, Value: "2025-12-31T00:00:00Z"}, true, true},
+		{"after", Condition{Attribute: "context.time", Operator: ConditionAfter, Value: "2025-12-31T00:00:00Z"}, false, true},
+		{"within window", Condition{Attribute: "context.time", Operator: ConditionTimeBetween, Values: []string{"09:00", "17:00"}}, true, true},
+		{"outside window", Condition{Attribute: "context.time", Operator: ConditionTimeBetween, Values: []string{"18:00", "23:00"}}, false, true},
+		{"window over midnight", Condition{Attribute: "context.time", Operator: ConditionTimeBetween, Values: []string{"22:00", "11:00"}}, true, true},
+		{"malformed window", Condition{Attribute: "context.time", Operator: ConditionTimeBetween, Values: []string{"9am"}}, false, false},
+		{"unknown operator", Condition{Attribute: "resource.status", Operator: "matches", Value: "o.*"}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holds, ok := EvaluateCondition(tt.cond, req)
+			if holds != tt.holds || ok != tt.usable {
+				t.Errorf("EvaluateCondition() = %v, %v, want %v, %v", holds, ok, tt.holds, tt.usable)
+			}
+		})
+	}
+}
+
+func TestEvaluateConditionTimeDefaultsToNow(t *testing.T) {
+	cond := Condition{Attribute: "context.time", Operator: ConditionBefore, Value: time.Now().Add(time.Hour).Format(time.RFC3339)}
+	if holds, ok := EvaluateCondition(cond, AccessRequest{}); !holds || !ok {
+		t.Errorf("EvaluateCondition() = %v, %v, want the current time used", holds, ok)
+	}
+}
+
+func TestValidateCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		cond     Condition
+		expected string
+	}{
+		{"valid owner", OwnerCondition(), ""},
+		{"valid window", Condition{Attribute: "context.time", Operator: ConditionTimeBetween, Values: []string{"09:00", "17:00", "UTC"}}, ""},
+		{"valid ranges", Condition{Attribute: "context.ip", Operator: ConditionIPIn, Values: []string{"10.0.0.0/8", "::1"}}, ""},
+		{"bad attribute", Condition{Attribute: "owner_id", Operator: ConditionExists}, "invalid_attribute"},
+		{"bad value from", Condition{Attribute: "resource.owner_id", Operator: ConditionEquals, ValueFrom: "user.id"}, "invalid_attribute"},
+		{"unknown operator", Condition{Attribute: "resource.status", Operator: "regex"}, "invalid_operator"},
+		{"in without values", Condition{Attribute: "resource.status", Operator: ConditionIn}, "required"},
+		{"bad range", Condition{Attribute: "context.ip", Operator: ConditionIPIn, Values: []string{"10.0.0.0/99"}}, "invalid_value"},
+		{"bad time", Condition{Attribute: "context.time", Operator: ConditionBefore, Value: "tomorrow"}, "invalid_value"},
+		{"bad window", Condition{Attribute: "context.time", Operator: ConditionTimeBetween, Values: []string{"25:00", "17:00"}}, "invalid_value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := ValidateCondition(tt.cond, "conditions[0]")
+			if tt.expected == "" {
+				if len(errors) != 0 {
+					t.Errorf("ValidateCondition() = %v, want no errors", errors)
+				}
+				return
+			}
+			if len(errors) == 0 || errors[0].Code != tt.expected {
+				t.Errorf("ValidateCondition() = %v, want %s", errors, tt.expected)
+			}
+		})
+	}
+}
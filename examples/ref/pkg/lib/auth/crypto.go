@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
+	"errors"
 	"strings"
 
 	"golang.org/x/crypto/argon2"
@@ -28,10 +29,13 @@ func GeneratePasswordSalt() []byte {
 	return salt
 }
 
+// HashPassword derives the legacy raw argon2id key (t=1, m=64MiB, p=4)
+// stored next to its salt. New hashes are PHC encoded by EncodePassword.
 func HashPassword(password, salt []byte) []byte {
 	return argon2.IDKey(password, salt, 1, 64*1024, 4, 32)
 }
 
+// VerifyPasswordHash checks password against a legacy HashPassword key.
 func VerifyPasswordHash(password, hash, salt []byte) bool {
 	derived := argon2.IDKey(password, salt, 1, 64*1024, 4, 32)
 	return subtle.ConstantTimeCompare(derived, hash) == 1
@@ -52,6 +56,21 @@ type EncryptedData struct {
 
 // EncryptEmail encrypts an email using AES-GCM
 func EncryptEmail(email string, key []byte) (*EncryptedData, error) {
+	return EncryptData([]byte(email), key)
+}
+
+// DecryptEmail decrypts an encrypted email
+func DecryptEmail(encrypted *EncryptedData, key []byte) (string, error) {
+	plaintext, err := DecryptData(encrypted, key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// EncryptData encrypts data using AES-GCM
+func EncryptData(plaintext []byte, key []byte) (*EncryptedData, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -68,15 +87,10 @@ func EncryptEmail(email string, key []byte) (*EncryptedData, error) {
 		return nil, err
 	}
 
-	// Encrypt the email
-	ciphertext := gcm.Seal(nil, iv, []byte(email), nil)
+	ciphertext := gcm.Seal(nil, iv, plaintext, nil)
 
 	// Split ciphertext and tag (last 16 bytes)
 	tagSize := gcm.Overhead()
-	if len(ciphertext) < tagSize {
-		return nil, err
-	}
-
 	data := ciphertext[:len(ciphertext)-tagSize]
 	tag := ciphertext[len(ciphertext)-tagSize:]
 
@@ -87,26 +101,60 @@ func EncryptEmail(email string, key []byte) (*EncryptedData, error) {
 	}, nil
 }
 
-// DecryptEmail decrypts an encrypted email
-func DecryptEmail(encrypted *EncryptedData, key []byte) (string, error) {
+// DecryptData decrypts data encrypted with EncryptData
+func DecryptData(encrypted *EncryptedData, key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	fullCiphertext := append(encrypted.Ciphertext, encrypted.Tag...)
+	if len(encrypted.IV) != gcm.NonceSize() {
+		return nil, errors.New("invalid IV length")
+	}
+
+	fullCiphertext := make([]byte, 0, len(encrypted.Ciphertext)+len(encrypted.Tag))
+	fullCiphertext = append(fullCiphertext, encrypted.Ciphertext...)
+	fullCiphertext = append(fullCiphertext, encrypted.Tag...)
+
+	return gcm.Open(nil, encrypted.IV, fullCiphertext, nil)
+}
+
+// ErrSealedDataTooShort is returned by OpenData for values too short to
+// hold an IV and a tag.
+var ErrSealedDataTooShort = errors.New("sealed data too short")
 
-	plaintext, err := gcm.Open(nil, encrypted.IV, fullCiphertext, nil)
+// SealData encrypts data with AES-GCM into a single value, IV followed by
+// ciphertext and tag.
+func SealData(plaintext []byte, key []byte) ([]byte, error) {
+	encrypted, err := EncryptData(plaintext, key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return string(plaintext), nil
+	sealed := make([]byte, 0, len(encrypted.IV)+len(encrypted.Ciphertext)+len(encrypted.Tag))
+	sealed = append(sealed, encrypted.IV...)
+	sealed = append(sealed, encrypted.Ciphertext...)
+	sealed = append(sealed, encrypted.Tag...)
+	return sealed, nil
+}
+
+// OpenData decrypts a value sealed with SealData.
+func OpenData(sealed []byte, key []byte) ([]byte, error) {
+	const ivSize, tagSize = 12, 16
+	if len(sealed) < ivSize+tagSize {
+		return nil, ErrSealedDataTooShort
+	}
+
+	return DecryptData(&EncryptedData{
+		IV:         sealed[:ivSize],
+		Ciphertext: sealed[ivSize : len(sealed)-tagSize],
+		Tag:        sealed[len(sealed)-tagSize:],
+	}, key)
 }
 
 // GenerateEncryptionKey generates a 32-byte AES-256 encryption key
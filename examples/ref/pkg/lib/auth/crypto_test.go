@@ -2,6 +2,7 @@ package auth
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 )
 
@@ -507,6 +508,41 @@ func TestDecryptEmailTampering(t *testing.T) {
 	if _, err := DecryptEmail(tamperedTag, key); err == nil {
 		t.Error("DecryptEmail should fail with tampered tag")
 	}
+
+	// Test a missing IV
+	missingIV := &EncryptedData{
+		Ciphertext: encrypted.Ciphertext,
+		Tag:        encrypted.Tag,
+	}
+	if _, err := DecryptEmail(missingIV, key); err == nil {
+		t.Error("DecryptEmail should fail without an IV")
+	}
+}
+
+func TestSealOpenData(t *testing.T) {
+	key := GenerateEncryptionKey()
+	data := []byte("192.0.2.1")
+
+	sealed, err := SealData(data, key)
+	if err != nil {
+		t.Fatalf("SealData failed: %v", err)
+	}
+
+	opened, err := OpenData(sealed, key)
+	if err != nil {
+		t.Fatalf("OpenData failed: %v", err)
+	}
+	if string(opened) != string(data) {
+		t.Errorf("OpenData = %q, want %q", opened, data)
+	}
+
+	if _, err := OpenData(sealed, GenerateEncryptionKey()); err == nil {
+		t.Error("OpenData should fail with another key")
+	}
+
+	if _, err := OpenData(sealed[:20], key); !errors.Is(err, ErrSealedDataTooShort) {
+		t.Errorf("OpenData of a short value error = %v, want ErrSealedDataTooShort", err)
+	}
 }
 
 func TestGenerateEncryptionKey(t *testing.T) {
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// JWTs signed with Ed25519 (alg EdDSA, RFC 8037), for OIDC clients that
+// expect ID tokens and access tokens in that format. Keys are published as
+// OKP JSON Web Keys under the same kid as their PASERK. Tokens of upstream
+// OpenID providers may also be RS256, verified with VerifyJWTWithJWK.
+
+// JWTAlgorithm is the JWS algorithm of issued JWTs.
+const JWTAlgorithm = "EdDSA"
+
+// JWTAlgorithmRS256 is RSASSA-PKCS1-v1_5 with SHA-256, the default algorithm
+// of OpenID Connect ID tokens. It is accepted but never issued.
+const JWTAlgorithmRS256 = "RS256"
+
+// minRSAKeyBits is the smallest RSA modulus accepted for RS256.
+const minRSAKeyBits = 2048
+
+// JWTHeader is the protected header of a JWT.
+type JWTHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// JWK is a public key as a JSON Web Key: Ed25519 (OKP) with Curve and X, or
+// RSA with N and E.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Key returns the JWK set key named kid.
+func (s JWKSet) Key(kid string) (JWK, bool) {
+	for _, key := range s.Keys {
+		if key.KeyID == kid {
+			return key, true
+		}
+	}
+	return JWK{}, false
+}
+
+// Ed25519JWK returns publicKey as a signing JWK named kid.
+func Ed25519JWK(kid string, publicKey ed25519.PublicKey) JWK {
+	return JWK{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         encodeBase64URL(publicKey),
+		KeyID:     kid,
+		Use:       "sig",
+		Algorithm: JWTAlgorithm,
+	}
+}
+
+// PublicKey decodes the Ed25519 key of the JWK.
+func (k JWK) PublicKey() (ed25519.PublicKey, error) {
+	if k.KeyType != "OKP" || k.Curve != "Ed25519" {
+		return nil, fmt.Errorf("unsupported key type %s/%s", k.KeyType, k.Curve)
+	}
+
+	key, err := decodeBase64URL(k.X)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// RSAPublicKey decodes the RSA key of the JWK. Keys under 2048 bits are
+// rejected.
+func (k JWK) RSAPublicKey() (*rsa.PublicKey, error) {
+	if k.KeyType != "RSA" {
+		return nil, fmt.Errorf("unsupported key type %s", k.KeyType)
+	}
+
+	n, err := decodeBase64URL(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, fmt.Errorf("invalid RSA modulus")
+	}
+	e, err := decodeBase64URL(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("invalid RSA exponent")
+	}
+
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if key.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("RSA key too short: %d bits", key.N.BitLen())
+	}
+	if key.E < 3 || key.E%2 == 0 {
+		return nil, fmt.Errorf("invalid RSA exponent")
+	}
+	return key, nil
+}
+
+// SignJWT encodes claims as a JWT signed with privateKey, naming kid in the header.
+func SignJWT(claims any, privateKey ed25519.PrivateKey, kid string) (string, error) {
+	header, err := json.Marshal(JWTHeader{Algorithm: JWTAlgorithm, Type: "JWT", KeyID: kid})
+	if err != nil {
+		return "", fmt.Errorf("could not marshal header: %w", err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal claims: %w", err)
+	}
+
+	signingInput := encodeBase64URL(header) + "." + encodeBase64URL(payload)
+	signature := ed25519.Sign(privateKey, []byte(signingInput))
+	return signingInput + "." + encodeBase64URL(signature), nil
+}
+
+// ParseJWTHeader decodes the header of a JWT without verifying it, to pick
+// the key by kid.
+func ParseJWTHeader(token string) (JWTHeader, error) {
+	var header JWTHeader
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return header, fmt.Errorf("%w: invalid JWT format", ErrInvalidToken)
+	}
+
+	raw, err := decodeBase64URL(parts[0])
+	if err != nil {
+		return header, fmt.Errorf("%w: could not decode header: %v", ErrInvalidToken, err)
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return header, fmt.Errorf("%w: invalid header: %v", ErrInvalidToken, err)
+	}
+	if header.Algorithm != JWTAlgorithm && header.Algorithm != JWTAlgorithmRS256 {
+		return header, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Algorithm)
+	}
+
+	return header, nil
+}
+
+// VerifyJWT checks the EdDSA signature of token with publicKey and decodes
+// its claims into claims. Expiry and audience are left to the caller.
+func VerifyJWT(token string, publicKey ed25519.PublicKey, claims any) error {
+	return verifyJWT(token, JWTAlgorithm, claims, func(signingInput, signature []byte) bool {
+		return ed25519.Verify(publicKey, signingInput, signature)
+	})
+}
+
+// VerifyJWTWithJWK checks the signature of token with key, an Ed25519 key
+// for EdDSA tokens or an RSA key for RS256 ones, and decodes its claims into
+// claims. The token algorithm must match the key type, and the JWK algorithm
+// when it names one. Expiry and audience are left to the caller.
+func VerifyJWTWithJWK(token string, key JWK, claims any) error {
+	switch key.KeyType {
+	case "OKP":
+		publicKey, err := key.PublicKey()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		if key.Algorithm != "" && key.Algorithm != JWTAlgorithm {
+			return fmt.Errorf("%w: key algorithm %q", ErrInvalidToken, key.Algorithm)
+		}
+		return VerifyJWT(token, publicKey, claims)
+
+	case "RSA":
+		publicKey, err := key.RSAPublicKey()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+		if key.Algorithm != "" && key.Algorithm != JWTAlgorithmRS256 {
+			return fmt.Errorf("%w: key algorithm %q", ErrInvalidToken, key.Algorithm)
+		}
+		return verifyJWT(token, JWTAlgorithmRS256, claims, func(signingInput, signature []byte) bool {
+			digest := sha256.Sum256(signingInput)
+			return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+		})
+
+	default:
+		return fmt.Errorf("%w: unsupported key type %q", ErrInvalidToken, key.KeyType)
+	}
+}
+
+// verifyJWT checks that token is signed with algorithm, using verify for the
+// signature, and decodes its claims.
+func verifyJWT(token, algorithm string, claims any, verify func(signingInput, signature []byte) bool) error {
+	header, err := ParseJWTHeader(token)
+	if err != nil {
+		return err
+	}
+	if header.Algorithm != algorithm {
+		return fmt.Errorf("%w: unexpected algorithm %q", ErrInvalidToken, header.Algorithm)
+	}
+
+	i := strings.LastIndex(token, ".")
+	signature, err := decodeBase64URL(token[i+1:])
+	if err != nil {
+		return fmt.Errorf("%w: could not decode signature: %v", ErrInvalidToken, err)
+	}
+	if !verify([]byte(token[:i]), signature) {
+		return fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+	}
+
+	payload, err := decodeBase64URL(token[strings.Index(token, ".")+1 : i])
+	if err != nil {
+		return fmt.Errorf("%w: could not decode payload: %v", ErrInvalidToken, err)
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return fmt.Errorf("%w: invalid claims: %v", ErrInvalidToken, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+type testJWTClaims struct {
+	Subject string `json:"sub"`
+	Nonce   string `json:"nonce"`
+}
+
+func TestSignJWT(t *testing.T) {
+	publicKey, privateKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+
+	token, err := SignJWT(testJWTClaims{Subject: "user-1", Nonce: "n-1"}, privateKey, "kid-1")
+	if err != nil {
+		t.Fatalf("SignJWT() error = %v", err)
+	}
+
+	header, err := ParseJWTHeader(token)
+	if err != nil {
+		t.Fatalf("ParseJWTHeader() error = %v", err)
+	}
+	if header.KeyID != "kid-1" || header.Algorithm != JWTAlgorithm {
+		t.Errorf("ParseJWTHeader() = %+v", header)
+	}
+
+	var claims testJWTClaims
+	if err := VerifyJWT(token, publicKey, &claims); err != nil {
+		t.Fatalf("VerifyJWT() error = %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Nonce != "n-1" {
+		t.Errorf("VerifyJWT() claims = %+v", claims)
+	}
+
+	otherKey, _, _ := GenerateKeyPair()
+	if err := VerifyJWT(token, otherKey, &claims); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyJWT() with another key error = %v, want ErrInvalidToken", err)
+	}
+
+	parts := strings.Split(token, ".")
+	forged := parts[0] + "." + encodeBase64URL([]byte(`{"sub":"admin"}`)) + "." + parts[2]
+	if err := VerifyJWT(forged, publicKey, &claims); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyJWT() forged claims error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestParseJWTHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"not a jwt", "v4.public.abc"},
+		{"bad header", "!!.e30.sig"},
+		{"none algorithm", encodeBase64URL([]byte(`{"alg":"none"}`)) + ".e30."},
+		{"hmac algorithm", encodeBase64URL([]byte(`{"alg":"HS256"}`)) + ".e30.sig"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseJWTHeader(tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ParseJWTHeader() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestEd25519JWK(t *testing.T) {
+	publicKey, _, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+
+	jwk := Ed25519JWK("kid-1", publicKey)
+	if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" || jwk.Algorithm != JWTAlgorithm {
+		t.Errorf("Ed25519JWK() = %+v", jwk)
+	}
+
+	got, err := jwk.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+	if !got.Equal(publicKey) {
+		t.Error("PublicKey() does not round trip")
+	}
+
+	jwk.X = encodeBase64URL(make([]byte, ed25519.PublicKeySize-1))
+	if _, err := jwk.PublicKey(); err == nil {
+		t.Error("PublicKey() accepted a short key")
+	}
+}
+
+func TestVerifyJWTWithJWK(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	rsaJWK := testRSAJWK("rsa-1", &rsaKey.PublicKey)
+
+	publicKey, privateKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+	edJWK := Ed25519JWK("ed-1", publicKey)
+
+	rsaToken := signTestRS256(t, testJWTClaims{Subject: "user-1"}, rsaKey, "rsa-1")
+	edToken, err := SignJWT(testJWTClaims{Subject: "user-2"}, privateKey, "ed-1")
+	if err != nil {
+		t.Fatalf("SignJWT() error = %v", err)
+	}
+
+	var claims testJWTClaims
+	if err := VerifyJWTWithJWK(rsaToken, rsaJWK, &claims); err != nil || claims.Subject != "user-1" {
+		t.Errorf("VerifyJWTWithJWK() RS256 = %+v, %v", claims, err)
+	}
+	if err := VerifyJWTWithJWK(edToken, edJWK, &claims); err != nil || claims.Subject != "user-2" {
+		t.Errorf("VerifyJWTWithJWK() EdDSA = %+v, %v", claims, err)
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	shortKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	mislabeled := rsaJWK
+	mislabeled.Algorithm = JWTAlgorithm
+
+	tests := []struct {
+		name  string
+		token string
+		key   JWK
+	}{
+		{"other RSA key", rsaToken, testRSAJWK("rsa-2", &otherKey.PublicKey)},
+		{"short RSA key", signTestRS256(t, testJWTClaims{}, shortKey, "rsa-3"), testRSAJWK("rsa-3", &shortKey.PublicKey)},
+		{"EdDSA token with RSA key", edToken, rsaJWK},
+		{"RS256 token with Ed25519 key", rsaToken, edJWK},
+		{"key for another algorithm", rsaToken, mislabeled},
+		{"unknown key type", rsaToken, JWK{KeyType: "EC"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyJWTWithJWK(tt.token, tt.key, &claims); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("VerifyJWTWithJWK() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestJWKSetKey(t *testing.T) {
+	set := JWKSet{Keys: []JWK{
+		{KeyType: "RSA", KeyID: "a"},
+		{KeyType: "OKP", KeyID: "b"},
+	}}
+
+	if key, ok := set.Key("b"); !ok || key.KeyType != "OKP" {
+		t.Errorf("Key(b) = %+v, %v", key, ok)
+	}
+	if _, ok := set.Key("c"); ok {
+		t.Error("Key(c) found a key")
+	}
+}
+
+func testRSAJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		KeyType:   "RSA",
+		N:         encodeBase64URL(key.N.Bytes()),
+		E:         encodeBase64URL(big.NewInt(int64(key.E)).Bytes()),
+		KeyID:     kid,
+		Algorithm: JWTAlgorithmRS256,
+	}
+}
+
+func signTestRS256(t *testing.T, claims any, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+
+	header, _ := json.Marshal(JWTHeader{Algorithm: JWTAlgorithmRS256, Type: "JWT", KeyID: kid})
+	payload, _ := json.Marshal(claims)
+	signingInput := encodeBase64URL(header) + "." + encodeBase64URL(payload)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("rsa.SignPKCS1v15() error = %v", err)
+	}
+	return signingInput + "." + encodeBase64URL(signature)
+}
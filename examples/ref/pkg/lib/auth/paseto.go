@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// PASETO v4.public as defined by the PASETO specification
+// (https://github.com/paseto-standard/paseto-spec, Version4.md).
+// Tokens are `v4.public.<base64url(message || signature)>[.<base64url(footer)>]`
+// and the Ed25519 signature covers PAE(header, message, footer, implicit).
+
+// PASETOV4PublicHeader is the header of every v4.public token
+const PASETOV4PublicHeader = "v4.public."
+
+// PASERK prefixes for v4 public keys and their identifiers
+const (
+	PASERKPublicPrefix   = "k4.public."
+	PASERKPublicIDPrefix = "k4.pid."
+)
+
+// TokenFooter is the JSON footer attached to issued tokens. It is
+// authenticated but not encrypted, so it must never carry secrets.
+type TokenFooter struct {
+	KeyID string `json:"kid,omitempty"`
+}
+
+// PAE implements the PASETO pre-authentication encoding: the number of
+// pieces followed by each piece prefixed with its length, all as LE64.
+func PAE(pieces ...[]byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(le64(uint64(len(pieces))))
+	for _, piece := range pieces {
+		buf.Write(le64(uint64(len(piece))))
+		buf.Write(piece)
+	}
+	return buf.Bytes()
+}
+
+// le64 encodes n as little-endian with the most significant bit cleared
+func le64(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, n&^(uint64(1)<<63))
+	return b
+}
+
+// SignV4Public signs message with an optional footer and implicit assertion
+func SignV4Public(privateKey ed25519.PrivateKey, message, footer, implicit []byte) (string, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return "", fmt.Errorf("invalid Ed25519 private key size: %d", len(privateKey))
+	}
+
+	signature := ed25519.Sign(privateKey, PAE([]byte(PASETOV4PublicHeader), message, footer, implicit))
+
+	body := make([]byte, 0, len(message)+len(signature))
+	body = append(body, message...)
+	body = append(body, signature...)
+
+	token := PASETOV4PublicHeader + encodeBase64URL(body)
+	if len(footer) > 0 {
+		token += "." + encodeBase64URL(footer)
+	}
+
+	return token, nil
+}
+
+// VerifyV4Public checks the token signature against publicKey and the
+// implicit assertion, returning the signed message and footer.
+func VerifyV4Public(token string, publicKey ed25519.PublicKey, implicit []byte) (message, footer []byte, err error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, nil, fmt.Errorf("invalid Ed25519 public key size: %d", len(publicKey))
+	}
+
+	body, footer, err := splitV4Public(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(body) < ed25519.SignatureSize {
+		return nil, nil, fmt.Errorf("%w: token too short", ErrInvalidToken)
+	}
+
+	message = body[:len(body)-ed25519.SignatureSize]
+	signature := body[len(body)-ed25519.SignatureSize:]
+
+	if !ed25519.Verify(publicKey, PAE([]byte(PASETOV4PublicHeader), message, footer, implicit), signature) {
+		return nil, nil, fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+	}
+
+	return message, footer, nil
+}
+
+// ParseTokenFooter decodes the footer of a v4.public token without verifying
+// the signature. Use it only to select the verification key by kid.
+func ParseTokenFooter(token string) (TokenFooter, error) {
+	var footer TokenFooter
+
+	_, raw, err := splitV4Public(token)
+	if err != nil {
+		return footer, err
+	}
+
+	if len(raw) == 0 {
+		return footer, nil
+	}
+
+	if err := decodeStrictJSON(raw, &footer); err != nil {
+		return footer, fmt.Errorf("%w: invalid footer: %v", ErrInvalidToken, err)
+	}
+
+	return footer, nil
+}
+
+// PASERKPublic serializes an Ed25519 public key as a k4.public PASERK
+func PASERKPublic(publicKey ed25519.PublicKey) string {
+	return PASERKPublicPrefix + encodeBase64URL(publicKey)
+}
+
+// ParsePASERKPublic decodes a k4.public PASERK
+func ParsePASERKPublic(paserk string) (ed25519.PublicKey, error) {
+	if !strings.HasPrefix(paserk, PASERKPublicPrefix) {
+		return nil, fmt.Errorf("not a k4.public key")
+	}
+
+	raw, err := decodeBase64URL(paserk[len(PASERKPublicPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode public key: %w", err)
+	}
+
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size %d", len(raw))
+	}
+
+	return ed25519.PublicKey(raw), nil
+}
+
+// PASERKPublicID returns the k4.pid identifier of a public key. It is used
+// as the token kid: a 264 bit BLAKE2b hash of the prefix and the PASERK.
+func PASERKPublicID(publicKey ed25519.PublicKey) string {
+	h, _ := blake2b.New(33, nil)
+	h.Write([]byte(PASERKPublicIDPrefix))
+	h.Write([]byte(PASERKPublic(publicKey)))
+	return PASERKPublicIDPrefix + encodeBase64URL(h.Sum(nil))
+}
+
+func splitV4Public(token string) (body, footer []byte, err error) {
+	if !strings.HasPrefix(token, PASETOV4PublicHeader) {
+		return nil, nil, fmt.Errorf("%w: not a v4.public token", ErrInvalidToken)
+	}
+
+	parts := strings.Split(token[len(PASETOV4PublicHeader):], ".")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] == "") {
+		return nil, nil, fmt.Errorf("%w: invalid PASETO token format", ErrInvalidToken)
+	}
+
+	body, err = decodeBase64URL(parts[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: could not decode payload: %v", ErrInvalidToken, err)
+	}
+
+	if len(parts) == 2 {
+		footer, err = decodeBase64URL(parts[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: could not decode footer: %v", ErrInvalidToken, err)
+		}
+	}
+
+	return body, footer, nil
+}
+
+// decodeStrictJSON decodes a single JSON object rejecting unknown fields
+// and trailing data.
+func decodeStrictJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after JSON object")
+	}
+
+	return nil
+}
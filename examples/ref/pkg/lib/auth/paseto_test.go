@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Official PASETO v4.public test vectors
+// (https://github.com/paseto-standard/test-vectors/blob/master/v4.json).
+const (
+	v4TestSecretKey = "b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774" +
+		"1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2"
+	v4TestPublicKey = "1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2"
+	v4TestPayload   = `{"data":"this is a signed message","exp":"2022-01-01T00:00:00+00:00"}`
+	v4TestFooter    = `{"kid":"zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN"}`
+)
+
+var v4PublicVectors = []struct {
+	name     string
+	footer   string
+	implicit string
+	token    string
+}{
+	{
+		name:  "4-S-1",
+		token: "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA",
+	},
+	{
+		name:   "4-S-2",
+		footer: v4TestFooter,
+		token:  "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9v3Jt8mx_TdM2ceTGoqwrh4yDFn0XsHvvV_D0DtwQxVrJEBMl0F2caAdgnpKlt4p7xBnx1HcO-SPo8FPp214HDw.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+	},
+	{
+		name:     "4-S-3",
+		footer:   v4TestFooter,
+		implicit: `{"test-vector":"4-S-3"}`,
+		token:    "v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9NPWciuD3d0o5eXJXG5pJy-DiVEoyPYWs1YSTwWHNJq6DZD3je5gf-0M4JR9ipdUSJbIovzmBECeaWmaqcaP0DQ.eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+	},
+}
+
+func testVectorKeys(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	priv, err := hex.DecodeString(v4TestSecretKey)
+	if err != nil {
+		t.Fatalf("cannot decode secret key: %v", err)
+	}
+	pub, err := hex.DecodeString(v4TestPublicKey)
+	if err != nil {
+		t.Fatalf("cannot decode public key: %v", err)
+	}
+	return ed25519.PublicKey(pub), ed25519.PrivateKey(priv)
+}
+
+func TestPAE(t *testing.T) {
+	tests := []struct {
+		name   string
+		pieces [][]byte
+		want   string
+	}{
+		{"no pieces", nil, "0000000000000000"},
+		{"empty piece", [][]byte{[]byte("")}, "01000000000000000000000000000000"},
+		{"test", [][]byte{[]byte("test")}, "0100000000000000040000000000000074657374"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(PAE(tt.pieces...)); got != tt.want {
+				t.Errorf("PAE() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestV4PublicVectors(t *testing.T) {
+	pub, priv := testVectorKeys(t)
+
+	for _, tt := range v4PublicVectors {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := SignV4Public(priv, []byte(v4TestPayload), []byte(tt.footer), []byte(tt.implicit))
+			if err != nil {
+				t.Fatalf("SignV4Public() error = %v", err)
+			}
+			if token != tt.token {
+				t.Errorf("SignV4Public() = %s, want %s", token, tt.token)
+			}
+
+			message, footer, err := VerifyV4Public(tt.token, pub, []byte(tt.implicit))
+			if err != nil {
+				t.Fatalf("VerifyV4Public() error = %v", err)
+			}
+			if string(message) != v4TestPayload || string(footer) != tt.footer {
+				t.Errorf("VerifyV4Public() = %s, %s", message, footer)
+			}
+
+			if _, _, err := VerifyV4Public(tt.token, pub, []byte("wrong")); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("VerifyV4Public() with wrong implicit error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyV4PublicRejectsTampering(t *testing.T) {
+	pub, _ := testVectorKeys(t)
+	valid := v4PublicVectors[1].token
+	body, _, _ := strings.Cut(strings.TrimPrefix(valid, PASETOV4PublicHeader), ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong version", strings.Replace(valid, "v4.", "v3.", 1)},
+		{"local purpose", strings.Replace(valid, ".public.", ".local.", 1)},
+		{"footer removed", PASETOV4PublicHeader + body},
+		{"footer swapped", PASETOV4PublicHeader + body + "." + encodeBase64URL([]byte(`{"kid":"other"}`))},
+		{"trailing dot", PASETOV4PublicHeader + body + "."},
+		{"truncated", valid[:len(PASETOV4PublicHeader)+10]},
+		{"not base64", PASETOV4PublicHeader + "!!!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := VerifyV4Public(tt.token, pub, nil); err == nil {
+				t.Error("VerifyV4Public() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestParseTokenFooter(t *testing.T) {
+	footer, err := ParseTokenFooter(v4PublicVectors[1].token)
+	if err != nil || footer.KeyID != "zVhMiPBP9fRf2snEcT7gFTioeA9COcNy9DfgL1W60haN" {
+		t.Errorf("ParseTokenFooter() = %+v, %v", footer, err)
+	}
+
+	footer, err = ParseTokenFooter(v4PublicVectors[0].token)
+	if err != nil || footer.KeyID != "" {
+		t.Errorf("ParseTokenFooter() without footer = %+v, %v", footer, err)
+	}
+}
+
+func TestPASETOTokenRoundTrip(t *testing.T) {
+	pub, priv, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+
+	claims := CreateTokenClaims("user-1", "session-1", "orders", map[string]string{"type": "global"}, time.Hour, 3)
+	claims.Issuer = "https://authn.example.com"
+	opts := TokenOptions{KeyID: "key-1", Implicit: []byte("orders")}
+
+	token, err := GeneratePASETOTokenWithOptions(claims, priv, opts)
+	if err != nil {
+		t.Fatalf("GeneratePASETOTokenWithOptions() error = %v", err)
+	}
+
+	got, err := VerifyPASETOTokenWithOptions(token, pub, opts)
+	if err != nil {
+		t.Fatalf("VerifyPASETOTokenWithOptions() error = %v", err)
+	}
+	if got.Subject != claims.Subject || got.Issuer != claims.Issuer || got.TokenID != claims.TokenID ||
+		got.ExpiresAt != claims.ExpiresAt || got.IssuedAt != claims.IssuedAt || got.NotBefore != claims.NotBefore ||
+		got.AuthzVersion != 3 || got.Context["type"] != "global" {
+		t.Errorf("claims = %+v, want %+v", got, claims)
+	}
+
+	if _, err := VerifyPASETOTokenWithOptions(token, pub, TokenOptions{KeyID: "key-2", Implicit: opts.Implicit}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("verify with other kid error = %v, want ErrInvalidToken", err)
+	}
+	if _, err := VerifyPASETOToken(token, pub); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("verify without implicit assertion error = %v, want ErrInvalidToken", err)
+	}
+
+	otherPub, _, _ := GenerateKeyPair()
+	if _, err := VerifyPASETOTokenWithOptions(token, otherPub, opts); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("verify with other key error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyPASETOTokenStrictClaims(t *testing.T) {
+	pub, priv, _ := GenerateKeyPair()
+
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{"valid", `{"sub":"u","sid":"s","aud":"a","exp":"2030-01-01T00:00:00Z","authz_ver":1}`, false},
+		{"unknown claim", `{"sub":"u","sid":"s","aud":"a","exp":"2030-01-01T00:00:00Z","authz_ver":1,"admin":true}`, true},
+		{"numeric exp", `{"sub":"u","sid":"s","aud":"a","exp":1893456000,"authz_ver":1}`, true},
+		{"malformed nbf", `{"sub":"u","sid":"s","aud":"a","exp":"2030-01-01T00:00:00Z","nbf":"tomorrow","authz_ver":1}`, true},
+		{"wrong ctx type", `{"sub":"u","sid":"s","aud":"a","exp":"2030-01-01T00:00:00Z","ctx":{"id":1},"authz_ver":1}`, true},
+		{"trailing data", `{"sub":"u","sid":"s","aud":"a","exp":"2030-01-01T00:00:00Z","authz_ver":1}{}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := SignV4Public(priv, []byte(tt.payload), nil, nil)
+			if err != nil {
+				t.Fatalf("SignV4Public() error = %v", err)
+			}
+			claims, err := VerifyPASETOToken(token, pub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyPASETOToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && claims.ExpiresAt != time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC).Unix() {
+				t.Errorf("ExpiresAt = %d", claims.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestGeneratePASETOTokenEncodesTimesAsRFC3339(t *testing.T) {
+	pub, priv, _ := GenerateKeyPair()
+	claims := TokenClaims{Subject: "u", SessionID: "s", Audience: "a", ExpiresAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC).Unix()}
+
+	token, err := GeneratePASETOToken(claims, priv)
+	if err != nil {
+		t.Fatalf("GeneratePASETOToken() error = %v", err)
+	}
+
+	message, _, err := VerifyV4Public(token, pub, nil)
+	if err != nil {
+		t.Fatalf("VerifyV4Public() error = %v", err)
+	}
+	if !bytes.Contains(message, []byte(`"exp":"2030-01-01T00:00:00Z"`)) || bytes.Contains(message, []byte(`"nbf"`)) {
+		t.Errorf("payload = %s, want RFC 3339 exp and no nbf", message)
+	}
+}
+
+func TestPASERKPublic(t *testing.T) {
+	pub, _ := testVectorKeys(t)
+
+	paserk := PASERKPublic(pub)
+	if paserk != "k4.public.Hrnbu7wEfAP9cGBOAHHwmH4Wsot1ciXBHwBBXQ4gsaI" {
+		t.Errorf("PASERKPublic() = %s", paserk)
+	}
+
+	parsed, err := ParsePASERKPublic(paserk)
+	if err != nil || !parsed.Equal(pub) {
+		t.Errorf("ParsePASERKPublic() = %x, %v, want %x", parsed, err, pub)
+	}
+
+	for _, invalid := range []string{"k4.local." + paserk[len(PASERKPublicPrefix):], "k4.public.AAAA", "k4.public.!!"} {
+		if _, err := ParsePASERKPublic(invalid); err == nil {
+			t.Errorf("ParsePASERKPublic(%q) error = nil, want error", invalid)
+		}
+	}
+
+	id := PASERKPublicID(pub)
+	if !strings.HasPrefix(id, PASERKPublicIDPrefix) || len(id) != len(PASERKPublicIDPrefix)+44 {
+		t.Errorf("PASERKPublicID() = %s, want k4.pid. and a 33 byte hash", id)
+	}
+	otherPub, _, _ := GenerateKeyPair()
+	if id != PASERKPublicID(pub) || id == PASERKPublicID(otherPub) {
+		t.Error("PASERKPublicID() is not a stable per-key identifier")
+	}
+}
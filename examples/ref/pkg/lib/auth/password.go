@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// ErrInvalidPasswordHash is returned when an encoded password hash cannot be read.
+var ErrInvalidPasswordHash = errors.New("invalid password hash")
+
+const passwordHashPrefix = "$argon2id$"
+
+// PasswordParams are the argon2id parameters of a password hash. Memory is
+// in KiB.
+type PasswordParams struct {
+	Memory     uint32
+	Time       uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultPasswordParams is the hashing policy used when none is configured.
+// It matches the parameters of the legacy hashes.
+var DefaultPasswordParams = PasswordParams{
+	Memory:     64 * 1024,
+	Time:       1,
+	Threads:    4,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+// EncodePassword hashes password with argon2id and a random salt, and
+// returns it in PHC string format: $argon2id$v=19$m=...,t=...,p=...$salt$key
+// with unpadded base64 salt and key. The hash records its own parameters, so
+// it can be verified after the policy changes.
+func EncodePassword(password []byte, params PasswordParams) (string, error) {
+	if params.Memory == 0 || params.Time == 0 || params.Threads == 0 || params.SaltLength == 0 || params.KeyLength == 0 {
+		return "", fmt.Errorf("%w: incomplete parameters", ErrInvalidPasswordHash)
+	}
+
+	salt := GenerateRandomBytes(int(params.SaltLength))
+	key := argon2.IDKey(password, salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		passwordHashPrefix, argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// DecodePasswordHash parses a PHC encoded argon2id hash into its parameters,
+// salt and key.
+func DecodePasswordHash(encoded string) (PasswordParams, []byte, []byte, error) {
+	invalid := func(reason string) (PasswordParams, []byte, []byte, error) {
+		return PasswordParams{}, nil, nil, fmt.Errorf("%w: %s", ErrInvalidPasswordHash, reason)
+	}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return invalid("not an argon2id PHC string")
+	}
+
+	if parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return invalid("unsupported version")
+	}
+
+	var memory, passes, threads uint64
+	for _, field := range strings.Split(parts[3], ",") {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return invalid("malformed parameters")
+		}
+
+		bits := 32
+		target := &memory
+		switch name {
+		case "m":
+		case "t":
+			target = &passes
+		case "p":
+			target, bits = &threads, 8
+		default:
+			return invalid("unknown parameter " + name)
+		}
+
+		n, err := strconv.ParseUint(value, 10, bits)
+		if err != nil || n == 0 {
+			return invalid("malformed parameter " + name)
+		}
+		*target = n
+	}
+	if memory == 0 || passes == 0 || threads == 0 {
+		return invalid("missing parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return invalid("malformed salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return invalid("malformed key")
+	}
+
+	params := PasswordParams{
+		Memory:     uint32(memory),
+		Time:       uint32(passes),
+		Threads:    uint8(threads),
+		SaltLength: uint32(len(salt)),
+		KeyLength:  uint32(len(key)),
+	}
+	return params, salt, key, nil
+}
+
+// IsEncodedPasswordHash reports whether a stored hash is PHC encoded rather
+// than a legacy raw key.
+func IsEncodedPasswordHash(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte(passwordHashPrefix))
+}
+
+// CheckPassword verifies password against a stored hash, either PHC encoded
+// or a legacy raw key with its salt. rehash reports that the password
+// matched but the hash is legacy or its parameters differ from policy, so the
+// caller should store a fresh EncodePassword hash.
+func CheckPassword(password, hash, salt []byte, policy PasswordParams) (ok, rehash bool) {
+	if !IsEncodedPasswordHash(hash) {
+		if !VerifyPasswordHash(password, hash, salt) {
+			return false, false
+		}
+		return true, true
+	}
+
+	params, hashSalt, key, err := DecodePasswordHash(string(hash))
+	if err != nil {
+		return false, false
+	}
+
+	derived := argon2.IDKey(password, hashSalt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	if subtle.ConstantTimeCompare(derived, key) != 1 {
+		return false, false
+	}
+	return true, params != policy
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testPasswordParams keeps the tests fast; policies in use are far costlier.
+var testPasswordParams = PasswordParams{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}
+
+func TestEncodePassword(t *testing.T) {
+	encoded, err := EncodePassword([]byte("ValidPassword123!"), testPasswordParams)
+	if err != nil {
+		t.Fatalf("EncodePassword() error = %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("EncodePassword() = %s, want a PHC argon2id string", encoded)
+	}
+	if !IsEncodedPasswordHash([]byte(encoded)) {
+		t.Error("IsEncodedPasswordHash() = false for an encoded hash")
+	}
+
+	params, salt, key, err := DecodePasswordHash(encoded)
+	if err != nil {
+		t.Fatalf("DecodePasswordHash() error = %v", err)
+	}
+	if params != testPasswordParams {
+		t.Errorf("DecodePasswordHash() params = %+v, want %+v", params, testPasswordParams)
+	}
+	if len(salt) != 16 || len(key) != 32 {
+		t.Errorf("DecodePasswordHash() salt = %d bytes, key = %d bytes", len(salt), len(key))
+	}
+
+	again, _ := EncodePassword([]byte("ValidPassword123!"), testPasswordParams)
+	if again == encoded {
+		t.Error("EncodePassword() reused a salt")
+	}
+
+	if _, err := EncodePassword([]byte("ValidPassword123!"), PasswordParams{Memory: 1024}); !errors.Is(err, ErrInvalidPasswordHash) {
+		t.Errorf("EncodePassword() with incomplete params error = %v, want %v", err, ErrInvalidPasswordHash)
+	}
+}
+
+func TestDecodePasswordHashInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"other algorithm", "$argon2i$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5"},
+		{"other version", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5"},
+		{"missing parameter", "$argon2id$v=19$m=1024,t=1$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5"},
+		{"zero parameter", "$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5"},
+		{"unknown parameter", "$argon2id$v=19$m=1024,t=1,p=1,x=1$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5"},
+		{"threads overflow", "$argon2id$v=19$m=1024,t=1,p=256$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5"},
+		{"malformed salt", "$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5a2V5a2V5"},
+		{"missing key", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0$"},
+		{"extra field", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := DecodePasswordHash(tt.encoded); !errors.Is(err, ErrInvalidPasswordHash) {
+				t.Errorf("DecodePasswordHash() error = %v, want %v", err, ErrInvalidPasswordHash)
+			}
+		})
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	password := []byte("ValidPassword123!")
+
+	legacySalt := GeneratePasswordSalt()
+	legacyHash := HashPassword(password, legacySalt)
+
+	encoded, err := EncodePassword(password, testPasswordParams)
+	if err != nil {
+		t.Fatalf("EncodePassword() error = %v", err)
+	}
+	stronger := testPasswordParams
+	stronger.Time = 2
+
+	tests := []struct {
+		name       string
+		password   []byte
+		hash       []byte
+		salt       []byte
+		policy     PasswordParams
+		wantOK     bool
+		wantRehash bool
+	}{
+		{"legacy", password, legacyHash, legacySalt, testPasswordParams, true, true},
+		{"legacy wrong password", []byte("WrongPassword123!"), legacyHash, legacySalt, testPasswordParams, false, false},
+		{"encoded", password, []byte(encoded), nil, testPasswordParams, true, false},
+		{"encoded policy changed", password, []byte(encoded), nil, stronger, true, true},
+		{"encoded wrong password", []byte("WrongPassword123!"), []byte(encoded), nil, testPasswordParams, false, false},
+		{"encoded malformed", password, []byte("$argon2id$v=19$m=1024"), nil, testPasswordParams, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash := CheckPassword(tt.password, tt.hash, tt.salt, tt.policy)
+			if ok != tt.wantOK || rehash != tt.wantRehash {
+				t.Errorf("CheckPassword() = %v, %v, want %v, %v", ok, rehash, tt.wantOK, tt.wantRehash)
+			}
+		})
+	}
+}
@@ -1,23 +1,43 @@
 package auth
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRoleCycle is returned for a role that would inherit from itself.
+	ErrRoleCycle = errors.New("role inheritance cycle")
+	// ErrUnknownRole is returned for a role inheriting from a missing role.
+	ErrUnknownRole = errors.New("unknown role")
+)
 
 func EvaluatePermissions(grants []Grant, roles []Role, permission string, scope Scope, now time.Time) bool {
+	return EvaluatePermissionsWithin(grants, roles, permission, scope, nil, now)
+}
+
+// EvaluatePermissionsWithin is EvaluatePermissions for a scope in a scope
+// tree: grants on any of its ancestors, nearest first, apply to it too.
+func EvaluatePermissionsWithin(grants []Grant, roles []Role, permission string, scope Scope, ancestors []Scope, now time.Time) bool {
 	for _, grant := range grants {
-		if grant.ExpiresAt != nil && grant.ExpiresAt.Before(now) {
+		if !grantValid(grant, now) {
 			continue
 		}
 
-		if !ScopeMatches(grant.Scope, scope) {
+		if !ScopeMatchesWithin(grant.Scope, scope, ancestors) {
 			continue
 		}
 
-		if grant.GrantType == GrantTypePermission && grant.Value == permission {
+		if grant.GrantType == GrantTypePermission && PermissionImplies(grant.Value, permission) {
 			return true
 		}
 
 		if grant.GrantType == GrantTypeRole {
-			rolePermissions := GetRolePermissions(roles, grant.Value)
+			rolePermissions := EffectiveRolePermissions(roles, grant.Value)
 			if ContainsPermission(rolePermissions, permission) {
 				return true
 			}
@@ -27,6 +47,138 @@ func EvaluatePermissions(grants []Grant, roles []Role, permission string, scope
 	return false
 }
 
+// EvaluateAnyPermission reports whether the grants give one of the permissions
+func EvaluateAnyPermission(grants []Grant, roles []Role, permissions []string, scope Scope, now time.Time) bool {
+	for _, permission := range permissions {
+		if EvaluatePermissions(grants, roles, permission, scope, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// EvaluateAllPermissions reports whether the grants give every permission
+func EvaluateAllPermissions(grants []Grant, roles []Role, permissions []string, scope Scope, now time.Time) bool {
+	for _, permission := range permissions {
+		if !EvaluatePermissions(grants, roles, permission, scope, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExplainPermissions evaluates as EvaluatePermissionsWithin does and traces
+// the decision: which grants were expired, which scope each matched through
+// and which grant, and role, supplied the permission.
+func ExplainPermissions(grants []Grant, roles []Role, permission string, scope Scope, ancestors []Scope, now time.Time) DecisionTrace {
+	trace := DecisionTrace{
+		Permission: permission,
+		Scope:      scope,
+		Ancestors:  ancestors,
+		Grants:     make([]GrantTrace, 0, len(grants)),
+	}
+
+	var expired, outOfScope int
+	for _, grant := range grants {
+		gt := GrantTrace{
+			GrantID:   grant.ID,
+			GrantType: grant.GrantType,
+			Value:     grant.Value,
+			Scope:     grant.Scope,
+			ExpiresAt: grant.ExpiresAt,
+			Expired:   !grantValid(grant, now),
+		}
+
+		if gt.Expired {
+			expired++
+		} else if gt.ScopeMatch, gt.MatchedScope = scopeMatch(grant.Scope, scope, ancestors); gt.ScopeMatch == "" {
+			outOfScope++
+		} else if grant.GrantType == GrantTypePermission && PermissionImplies(grant.Value, permission) {
+			gt.Permission = grant.Value
+			gt.Allows = true
+		} else if grant.GrantType == GrantTypeRole {
+			if role, held, ok := roleSupplying(roles, grant.Value, permission); ok {
+				gt.RoleID = role.ID.String()
+				gt.RoleName = role.Name
+				gt.Permission = held
+				gt.Allows = true
+			}
+		}
+
+		if gt.Allows && !trace.Allowed {
+			trace.Allowed = true
+			trace.Reason = fmt.Sprintf("%s granted by %s grant %s", permission, grant.GrantType, grant.ID)
+		}
+		trace.Grants = append(trace.Grants, gt)
+	}
+
+	if !trace.Allowed {
+		switch {
+		case len(grants) == 0:
+			trace.Reason = "no grants"
+		case expired == len(grants):
+			trace.Reason = "all grants expired"
+		case expired+outOfScope == len(grants):
+			trace.Reason = fmt.Sprintf("no valid grant applies to %s:%s", scope.Type, scope.ID)
+		default:
+			trace.Reason = fmt.Sprintf("no grant applying to %s:%s gives %s", scope.Type, scope.ID, permission)
+		}
+	}
+
+	return trace
+}
+
+// scopeMatch tells how a grant scope covers a request scope, as
+// ScopeMatchesWithin decides, and the scope it matched through
+func scopeMatch(grantScope, requestScope Scope, ancestors []Scope) (string, *Scope) {
+	if grantScope.Type == "global" {
+		return "global", &grantScope
+	}
+	if grantScope.Type == requestScope.Type && grantScope.ID == requestScope.ID {
+		return "exact", &requestScope
+	}
+	for _, ancestor := range ancestors {
+		if grantScope.Type == ancestor.Type && grantScope.ID == ancestor.ID {
+			return "ancestor", &ancestor
+		}
+	}
+	return "", nil
+}
+
+// roleSupplying finds the role, the granted one or one it inherits from,
+// nearest first, holding a permission that covers permission
+func roleSupplying(roles []Role, roleID, permission string) (Role, string, bool) {
+	byID := make(map[string]Role, len(roles))
+	for _, role := range roles {
+		byID[role.ID.String()] = role
+	}
+
+	visited := make(map[string]bool)
+	pending := []string{roleID}
+	for len(pending) > 0 {
+		id := pending[0]
+		pending = pending[1:]
+
+		role, ok := byID[id]
+		if !ok || visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		for _, perm := range role.Permissions {
+			if PermissionImplies(perm, permission) {
+				return role, perm, true
+			}
+		}
+
+		for _, parent := range role.Inherits {
+			pending = append(pending, parent.String())
+		}
+	}
+
+	return Role{}, "", false
+}
+
 func ScopeMatches(grantScope, requestScope Scope) bool {
 	if grantScope.Type == "global" {
 		return true
@@ -39,6 +191,22 @@ func ScopeMatches(grantScope, requestScope Scope) bool {
 	return grantScope.ID == requestScope.ID
 }
 
+// ScopeMatchesWithin reports whether a grant scope covers a request scope
+// whose ancestors, nearest first, are given: a grant on org:acme covers
+// project:acme/web when org:acme is among the ancestors of the project.
+func ScopeMatchesWithin(grantScope, requestScope Scope, ancestors []Scope) bool {
+	if ScopeMatches(grantScope, requestScope) {
+		return true
+	}
+
+	for _, ancestor := range ancestors {
+		if grantScope.Type == ancestor.Type && grantScope.ID == ancestor.ID {
+			return true
+		}
+	}
+	return false
+}
+
 func GetRolePermissions(roles []Role, roleID string) []string {
 	for _, role := range roles {
 		if role.ID.String() == roleID {
@@ -48,25 +216,167 @@ func GetRolePermissions(roles []Role, roleID string) []string {
 	return nil
 }
 
+// EffectiveRolePermissions returns the permissions of a role, those of the
+// roles it inherits from and the permissions they imply. Each role is
+// visited once, so a stored cycle ends the walk instead of looping.
+func EffectiveRolePermissions(roles []Role, roleID string) []string {
+	byID := make(map[string]Role, len(roles))
+	for _, role := range roles {
+		byID[role.ID.String()] = role
+	}
+
+	var permissions []string
+	seen := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	pending := []string{roleID}
+	for len(pending) > 0 {
+		id := pending[0]
+		pending = pending[1:]
+
+		role, ok := byID[id]
+		if !ok || visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		for _, perm := range role.Permissions {
+			for _, p := range ImpliedPermissions(perm) {
+				if !seen[p] {
+					permissions = append(permissions, p)
+					seen[p] = true
+				}
+			}
+		}
+
+		for _, parent := range role.Inherits {
+			pending = append(pending, parent.String())
+		}
+	}
+
+	return permissions
+}
+
+// CheckRoleInheritance checks the roles a role inherits from against the
+// other roles: they must all exist and none may lead back to the role.
+func CheckRoleInheritance(roles []Role, role Role) error {
+	byID := make(map[uuid.UUID]Role, len(roles)+1)
+	for _, r := range roles {
+		byID[r.ID] = r
+	}
+	// The role being checked replaces its stored version
+	byID[role.ID] = role
+
+	for _, parent := range role.Inherits {
+		if _, ok := byID[parent]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownRole, parent)
+		}
+	}
+
+	visited := make(map[uuid.UUID]bool)
+	pending := append([]uuid.UUID(nil), role.Inherits...)
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if id == role.ID {
+			return ErrRoleCycle
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+
+		pending = append(pending, byID[id].Inherits...)
+	}
+
+	return nil
+}
+
+// ContainsPermission reports whether any of the granted permissions covers
+// permission, directly, through a wildcard or through an implication.
 func ContainsPermission(permissions []string, permission string) bool {
 	for _, p := range permissions {
-		if p == permission {
+		if PermissionImplies(p, permission) {
 			return true
 		}
 	}
 	return false
 }
 
+// PermissionMatches reports whether a granted permission matches permission.
+// Either part of a granted permission may be a wildcard, so todos:* covers
+// every todos action and *:read reading everything; * alone covers all.
+// Wildcards in the checked permission are literal: holding todos:read is
+// not enough for todos:*.
+func PermissionMatches(granted, permission string) bool {
+	if granted == permission || granted == "*" {
+		return true
+	}
+
+	grantedResource, grantedAction, ok := strings.Cut(granted, ":")
+	if !ok {
+		return false
+	}
+	resource, action, ok := strings.Cut(permission, ":")
+	if !ok {
+		return false
+	}
+
+	return (grantedResource == "*" || grantedResource == resource) &&
+		(grantedAction == "*" || grantedAction == action)
+}
+
+// PermissionImplies reports whether holding granted is enough for
+// permission, by matching it or a permission implying it, as roles:manage
+// implies roles:read.
+func PermissionImplies(granted, permission string) bool {
+	if PermissionMatches(granted, permission) {
+		return true
+	}
+
+	for implying, implied := range PermissionImplications {
+		for _, p := range implied {
+			if string(p) == permission && PermissionImplies(granted, string(implying)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ImpliedPermissions returns permission followed by the permissions it
+// implies, directly or not.
+func ImpliedPermissions(permission string) []string {
+	permissions := []string{permission}
+	seen := map[string]bool{permission: true}
+
+	for i := 0; i < len(permissions); i++ {
+		for _, p := range PermissionImplications[Permission(permissions[i])] {
+			if !seen[string(p)] {
+				permissions = append(permissions, string(p))
+				seen[string(p)] = true
+			}
+		}
+	}
+	return permissions
+}
+
 func FilterValidGrants(grants []Grant, now time.Time) []Grant {
 	var validGrants []Grant
 	for _, grant := range grants {
-		if grant.ExpiresAt == nil || grant.ExpiresAt.After(now) {
+		if grantValid(grant, now) {
 			validGrants = append(validGrants, grant)
 		}
 	}
 	return validGrants
 }
 
+// grantValid reports whether a grant has not expired at now
+func grantValid(grant Grant, now time.Time) bool {
+	return grant.ExpiresAt == nil || grant.ExpiresAt.After(now)
+}
+
 func GetUserPermissions(grants []Grant, roles []Role, scope Scope, now time.Time) []string {
 	var permissions []string
 	seen := make(map[string]bool)
@@ -79,14 +389,16 @@ func GetUserPermissions(grants []Grant, roles []Role, scope Scope, now time.Time
 		}
 
 		if grant.GrantType == GrantTypePermission {
-			if !seen[grant.Value] {
-				permissions = append(permissions, grant.Value)
-				seen[grant.Value] = true
+			for _, perm := range ImpliedPermissions(grant.Value) {
+				if !seen[perm] {
+					permissions = append(permissions, perm)
+					seen[perm] = true
+				}
 			}
 		}
 
 		if grant.GrantType == GrantTypeRole {
-			rolePermissions := GetRolePermissions(roles, grant.Value)
+			rolePermissions := EffectiveRolePermissions(roles, grant.Value)
 			for _, perm := range rolePermissions {
 				if !seen[perm] {
 					permissions = append(permissions, perm)
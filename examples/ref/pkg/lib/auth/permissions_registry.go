@@ -71,6 +71,13 @@ var PermissionRegistry = []PermissionCategory{
 	},
 }
 
+// PermissionImplications lists the permissions implied by holding another,
+// so that a user managing roles passes the checks for reading them.
+var PermissionImplications = map[Permission][]Permission{
+	PermRolesManage:  {PermRolesRead, PermRolesWrite, PermRolesDelete},
+	PermGrantsManage: {PermGrantsRead, PermGrantsWrite, PermGrantsDelete},
+}
+
 func AllPermissions() []Permission {
 	var perms []Permission
 	for _, cat := range PermissionRegistry {
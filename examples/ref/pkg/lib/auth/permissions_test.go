@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -17,8 +18,14 @@ func TestEvaluatePermissions(t *testing.T) {
 		Name:        "admin",
 		Permissions: []string{"users:read", "users:write", "orders:read", "orders:write"},
 	}
+	ownerRole := Role{
+		ID:          uuid.New(),
+		Name:        "owner",
+		Permissions: []string{"roles:manage"},
+		Inherits:    []uuid.UUID{roleID},
+	}
 
-	roles := []Role{adminRole}
+	roles := []Role{adminRole, ownerRole}
 
 	tests := []struct {
 		name       string
@@ -172,6 +179,66 @@ func TestEvaluatePermissions(t *testing.T) {
 			scope:      Scope{Type: "team", ID: "123"},
 			expected:   false,
 		},
+		{
+			name: "wildcard permission grant matches",
+			grants: []Grant{
+				{
+					ID:        uuid.New(),
+					UserID:    userID,
+					GrantType: GrantTypePermission,
+					Value:     "orders:*",
+					Scope:     Scope{Type: "team", ID: "123"},
+				},
+			},
+			permission: "orders:delete",
+			scope:      Scope{Type: "team", ID: "123"},
+			expected:   true,
+		},
+		{
+			name: "implied permission grant matches",
+			grants: []Grant{
+				{
+					ID:        uuid.New(),
+					UserID:    userID,
+					GrantType: GrantTypePermission,
+					Value:     "grants:manage",
+					Scope:     Scope{Type: "team", ID: "123"},
+				},
+			},
+			permission: "grants:write",
+			scope:      Scope{Type: "team", ID: "123"},
+			expected:   true,
+		},
+		{
+			name: "inherited role permission matches",
+			grants: []Grant{
+				{
+					ID:        uuid.New(),
+					UserID:    userID,
+					GrantType: GrantTypeRole,
+					Value:     ownerRole.ID.String(),
+					Scope:     Scope{Type: "team", ID: "123"},
+				},
+			},
+			permission: "orders:write",
+			scope:      Scope{Type: "team", ID: "123"},
+			expected:   true,
+		},
+		{
+			name: "parent role does not get child permissions",
+			grants: []Grant{
+				{
+					ID:        uuid.New(),
+					UserID:    userID,
+					GrantType: GrantTypeRole,
+					Value:     roleID.String(),
+					Scope:     Scope{Type: "team", ID: "123"},
+				},
+			},
+			permission: "roles:read",
+			scope:      Scope{Type: "team", ID: "123"},
+			expected:   false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -239,6 +306,117 @@ func TestScopeMatches(t *testing.T) {
 	}
 }
 
+func TestScopeMatchesWithin(t *testing.T) {
+	org := Scope{Type: "org", ID: "acme"}
+	project := Scope{Type: "project", ID: "acme/web"}
+	resource := Scope{Type: "resource", ID: "acme/web/deploys"}
+	ancestors := []Scope{project, org}
+
+	tests := []struct {
+		name       string
+		grantScope Scope
+		expected   bool
+	}{
+		{"global", Scope{Type: "global"}, true},
+		{"same scope", resource, true},
+		{"parent", project, true},
+		{"grandparent", org, true},
+		{"sibling", Scope{Type: "project", ID: "acme/api"}, false},
+		{"same id other type", Scope{Type: "team", ID: "acme"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ScopeMatchesWithin(tt.grantScope, resource, ancestors); got != tt.expected {
+				t.Errorf("ScopeMatchesWithin() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	if ScopeMatchesWithin(resource, project, []Scope{org}) {
+		t.Error("ScopeMatchesWithin() = true for a grant below the request scope")
+	}
+
+	grants := []Grant{
+		{ID: uuid.New(), GrantType: GrantTypePermission, Value: "deploys:write", Scope: org},
+	}
+	if !EvaluatePermissionsWithin(grants, nil, "deploys:write", resource, ancestors, time.Now()) {
+		t.Error("EvaluatePermissionsWithin() = false for a grant on an ancestor")
+	}
+	if EvaluatePermissions(grants, nil, "deploys:write", resource, time.Now()) {
+		t.Error("EvaluatePermissions() = true for a grant on an unknown ancestor")
+	}
+}
+
+func TestExplainPermissions(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	org := Scope{Type: "org", ID: "acme"}
+	project := Scope{Type: "project", ID: "acme/web"}
+	ancestors := []Scope{org}
+
+	viewer := Role{ID: uuid.New(), Name: "viewer", Permissions: []string{"deploys:read"}}
+	deployer := Role{ID: uuid.New(), Name: "deployer", Permissions: []string{"deploys:write"}, Inherits: []uuid.UUID{viewer.ID}}
+	roles := []Role{viewer, deployer}
+
+	expired := Grant{ID: uuid.New(), GrantType: GrantTypePermission, Value: "deploys:*", Scope: project, ExpiresAt: &past}
+	elsewhere := Grant{ID: uuid.New(), GrantType: GrantTypePermission, Value: "deploys:*", Scope: Scope{Type: "project", ID: "acme/api"}}
+	inherited := Grant{ID: uuid.New(), GrantType: GrantTypeRole, Value: deployer.ID.String(), Scope: org}
+	grants := []Grant{expired, elsewhere, inherited}
+
+	tests := []struct {
+		name       string
+		grants     []Grant
+		permission string
+		allowed    bool
+		reason     string
+	}{
+		{"no grants", nil, "deploys:read", false, "no grants"},
+		{"expired", []Grant{expired}, "deploys:read", false, "all grants expired"},
+		{"out of scope", []Grant{expired, elsewhere}, "deploys:read", false, "no valid grant applies to project:acme/web"},
+		{"not held", grants, "deploys:delete", false, "no grant applying to project:acme/web gives deploys:delete"},
+		{"inherited role on ancestor", grants, "deploys:read", true, "deploys:read granted by role grant " + inherited.ID.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := ExplainPermissions(tt.grants, roles, tt.permission, project, ancestors, now)
+			if trace.Allowed != tt.allowed || trace.Reason != tt.reason {
+				t.Errorf("ExplainPermissions() = %v, %q, want %v, %q", trace.Allowed, trace.Reason, tt.allowed, tt.reason)
+			}
+			if want := EvaluatePermissionsWithin(tt.grants, roles, tt.permission, project, ancestors, now); trace.Allowed != want {
+				t.Errorf("ExplainPermissions() = %v, EvaluatePermissionsWithin() = %v", trace.Allowed, want)
+			}
+			if len(trace.Grants) != len(tt.grants) {
+				t.Errorf("ExplainPermissions() traced %d grants, want %d", len(trace.Grants), len(tt.grants))
+			}
+		})
+	}
+
+	trace := ExplainPermissions(grants, roles, "deploys:read", project, ancestors, now)
+	if !trace.Grants[0].Expired || trace.Grants[0].ScopeMatch != "" {
+		t.Errorf("expired grant traced as %+v", trace.Grants[0])
+	}
+	if trace.Grants[1].Expired || trace.Grants[1].ScopeMatch != "" || trace.Grants[1].Allows {
+		t.Errorf("grant on another scope traced as %+v", trace.Grants[1])
+	}
+	got := trace.Grants[2]
+	if got.ScopeMatch != "ancestor" || got.MatchedScope == nil || *got.MatchedScope != org {
+		t.Errorf("ScopeMatch = %q, %v, want ancestor %v", got.ScopeMatch, got.MatchedScope, org)
+	}
+	if got.RoleID != viewer.ID.String() || got.RoleName != "viewer" || got.Permission != "deploys:read" || !got.Allows {
+		t.Errorf("role grant traced as %+v, want deploys:read from the inherited viewer role", got)
+	}
+
+	implied := []Grant{
+		{ID: uuid.New(), GrantType: GrantTypePermission, Value: "roles:manage", Scope: Scope{Type: "global"}},
+	}
+	trace = ExplainPermissions(implied, nil, "roles:delete", project, nil, now)
+	if !trace.Allowed || trace.Grants[0].ScopeMatch != "global" || trace.Grants[0].Permission != "roles:manage" {
+		t.Errorf("implied permission traced as %+v", trace.Grants[0])
+	}
+}
+
 func TestGetRolePermissions(t *testing.T) {
 	roleID1 := uuid.New()
 	roleID2 := uuid.New()
@@ -293,6 +471,101 @@ func TestGetRolePermissions(t *testing.T) {
 	}
 }
 
+func TestEffectiveRolePermissions(t *testing.T) {
+	viewer := Role{ID: uuid.New(), Name: "viewer", Permissions: []string{"todos:read"}}
+	editor := Role{ID: uuid.New(), Name: "editor", Permissions: []string{"todos:write"}, Inherits: []uuid.UUID{viewer.ID}}
+	manager := Role{ID: uuid.New(), Name: "manager", Permissions: []string{"roles:manage", "todos:write"}, Inherits: []uuid.UUID{editor.ID, viewer.ID}}
+
+	// A cycle stored by hand must not loop
+	loopA := Role{ID: uuid.New(), Name: "a", Permissions: []string{"a:read"}}
+	loopB := Role{ID: uuid.New(), Name: "b", Permissions: []string{"b:read"}, Inherits: []uuid.UUID{loopA.ID}}
+	loopA.Inherits = []uuid.UUID{loopB.ID}
+
+	roles := []Role{viewer, editor, manager, loopA, loopB}
+
+	tests := []struct {
+		name     string
+		roleID   string
+		expected []string
+	}{
+		{"own permissions", viewer.ID.String(), []string{"todos:read"}},
+		{"inherited permissions", editor.ID.String(), []string{"todos:write", "todos:read"}},
+		{"implied and shared ancestors once", manager.ID.String(), []string{"roles:manage", "roles:read", "roles:write", "roles:delete", "todos:write", "todos:read"}},
+		{"cycle", loopA.ID.String(), []string{"a:read", "b:read"}},
+		{"missing role", uuid.New().String(), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EffectiveRolePermissions(roles, tt.roleID)
+			if !equalStringSlices(result, tt.expected) {
+				t.Errorf("EffectiveRolePermissions() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckRoleInheritance(t *testing.T) {
+	viewer := Role{ID: uuid.New(), Name: "viewer"}
+	editor := Role{ID: uuid.New(), Name: "editor", Inherits: []uuid.UUID{viewer.ID}}
+	manager := Role{ID: uuid.New(), Name: "manager", Inherits: []uuid.UUID{editor.ID}}
+	roles := []Role{viewer, editor, manager}
+
+	tests := []struct {
+		name    string
+		role    Role
+		wantErr error
+	}{
+		{"no parents", Role{ID: uuid.New()}, nil},
+		{"existing parents", Role{ID: uuid.New(), Inherits: []uuid.UUID{manager.ID, viewer.ID}}, nil},
+		{"unknown parent", Role{ID: uuid.New(), Inherits: []uuid.UUID{uuid.New()}}, ErrUnknownRole},
+		{"itself", Role{ID: viewer.ID, Inherits: []uuid.UUID{viewer.ID}}, ErrRoleCycle},
+		{"through ancestors", Role{ID: viewer.ID, Inherits: []uuid.UUID{manager.ID}}, ErrRoleCycle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckRoleInheritance(roles, tt.role)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckRoleInheritance() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPermissionImplies(t *testing.T) {
+	tests := []struct {
+		granted    string
+		permission string
+		expected   bool
+	}{
+		{"todos:read", "todos:read", true},
+		{"todos:read", "todos:write", false},
+		{"todos:*", "todos:write", true},
+		{"todos:*", "lists:write", false},
+		{"*:read", "lists:read", true},
+		{"*:read", "lists:write", false},
+		{"*:*", "lists:write", true},
+		{"*", "lists:write", true},
+		{"todos:read", "todos:*", false},
+		{"todos:*", "todos:*", true},
+		{"todos", "todos:read", false},
+		{"roles:manage", "roles:delete", true},
+		{"roles:manage", "grants:delete", false},
+		{"roles:read", "roles:manage", false},
+		{"*:manage", "grants:read", true},
+		{"roles:*", "roles:read", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.granted+" "+tt.permission, func(t *testing.T) {
+			if got := PermissionImplies(tt.granted, tt.permission); got != tt.expected {
+				t.Errorf("PermissionImplies(%q, %q) = %v, want %v", tt.granted, tt.permission, got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestFilterValidGrants(t *testing.T) {
 	now := time.Now()
 	userID := uuid.New()
@@ -344,7 +617,7 @@ func TestFilterValidGrants(t *testing.T) {
 	}
 }
 
-func TestHasAnyPermission(t *testing.T) {
+func TestEvaluateAnyPermission(t *testing.T) {
 	now := time.Now()
 	userID := uuid.New()
 	roleID := uuid.New()
@@ -405,15 +678,15 @@ func TestHasAnyPermission(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := HasAnyPermission(tt.grants, roles, tt.permissions, tt.scope, now)
+			result := EvaluateAnyPermission(tt.grants, roles, tt.permissions, tt.scope, now)
 			if result != tt.expected {
-				t.Errorf("HasAnyPermission() = %v, want %v", result, tt.expected)
+				t.Errorf("EvaluateAnyPermission() = %v, want %v", result, tt.expected)
 			}
 		})
 	}
 }
 
-func TestHasAllPermissions(t *testing.T) {
+func TestEvaluateAllPermissions(t *testing.T) {
 	now := time.Now()
 	userID := uuid.New()
 	roleID := uuid.New()
@@ -474,9 +747,9 @@ func TestHasAllPermissions(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := HasAllPermissions(tt.grants, roles, tt.permissions, tt.scope, now)
+			result := EvaluateAllPermissions(tt.grants, roles, tt.permissions, tt.scope, now)
 			if result != tt.expected {
-				t.Errorf("HasAllPermissions() = %v, want %v", result, tt.expected)
+				t.Errorf("EvaluateAllPermissions() = %v, want %v", result, tt.expected)
 			}
 		})
 	}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	// Example from RFC 7636, Appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != want {
+		t.Errorf("PKCEChallenge() = %s, want %s", got, want)
+	}
+	if !VerifyPKCE(verifier, want, PKCEMethodS256) {
+		t.Error("VerifyPKCE() = false for the RFC example")
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	verifier := GeneratePKCEVerifier()
+	challenge := PKCEChallenge(verifier)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		method    string
+		want      bool
+	}{
+		{"matching verifier", verifier, challenge, PKCEMethodS256, true},
+		{"other verifier", GeneratePKCEVerifier(), challenge, PKCEMethodS256, false},
+		{"plain method", verifier, verifier, "plain", false},
+		{"short verifier", "abc", PKCEChallenge("abc"), PKCEMethodS256, false},
+		{"long verifier", strings.Repeat("a", 129), PKCEChallenge(strings.Repeat("a", 129)), PKCEMethodS256, false},
+		{"invalid characters", strings.Repeat("a", 42) + "!", PKCEChallenge(strings.Repeat("a", 42) + "!"), PKCEMethodS256, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge, tt.method); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,25 +1,172 @@
 package auth
 
+import "strconv"
+
+// DenyAllActions is the deny rules key applying to every action
+const DenyAllActions = "*"
+
+// EvaluatePolicy evaluates a policy on permissions alone. Conditions cannot
+// hold without attributes, so rules with conditions do not allow and deny
+// rules with conditions deny; use EvaluatePolicyRequest for those.
 func EvaluatePolicy(policy ResourcePolicy, action string, userPermissions []string) bool {
+	return EvaluatePolicyRequest(policy, action, AccessRequest{Permissions: userPermissions})
+}
+
+// EvaluatePolicyRequest evaluates a policy against the permissions and the
+// subject, resource and context attributes of a request. Any matching deny
+// rule of the action, or of DenyAllActions, refuses it, whatever allows it.
+// Conditions that cannot be evaluated make allow rules fail and deny rules
+// match, so missing attributes never grant access.
+func EvaluatePolicyRequest(policy ResourcePolicy, action string, req AccessRequest) bool {
+	return ExplainPolicy(policy, action, req).Allowed
+}
+
+// ExplainPolicy evaluates as EvaluatePolicyRequest does and traces the
+// decision: the deny rule that fired or the allow rule that matched, and
+// every condition evaluated on the way.
+func ExplainPolicy(policy ResourcePolicy, action string, req AccessRequest) PolicyTrace {
+	trace := PolicyTrace{Action: action}
+
 	rule, exists := policy.Actions[action]
 	if !exists {
+		trace.Reason = "action " + action + " is not defined"
+		return trace
+	}
+	trace.Defined = true
+
+	if _, path, denied := findDenyRule(policy, action, req, &trace.Conditions); denied {
+		trace.DeniedBy = path
+		trace.Reason = "denied by " + path
+		return trace
+	}
+
+	path, matched := ruleMatches(rule, req, false, "actions."+action, &trace.Conditions)
+	if !matched {
+		trace.Reason = "actions." + action + " does not match"
+		return trace
+	}
+
+	trace.Allowed = true
+	trace.AllowedBy = path
+	trace.Reason = "allowed by " + path
+	return trace
+}
+
+// WithPolicy adds a policy evaluation to a permission decision; access is
+// allowed when both allow it.
+func (t DecisionTrace) WithPolicy(policy PolicyTrace) DecisionTrace {
+	t.Policy = &policy
+	if t.Allowed && !policy.Allowed {
+		t.Allowed = false
+		t.Reason = policy.Reason
+	}
+	return t
+}
+
+// FindDenyRule returns the first deny rule refusing the action, if any
+func FindDenyRule(policy ResourcePolicy, action string, req AccessRequest) (PolicyRule, bool) {
+	rule, _, denied := findDenyRule(policy, action, req, nil)
+	return rule, denied
+}
+
+// RuleMatches reports whether the permissions of the request satisfy the rule
+// and its conditions hold, or one of its Or rules matches. Conditions that
+// cannot be evaluated hold for deny rules and fail for allow rules.
+func RuleMatches(rule PolicyRule, req AccessRequest, deny bool) bool {
+	_, matched := ruleMatches(rule, req, deny, "", nil)
+	return matched
+}
+
+// findDenyRule returns the first deny rule refusing the action and its path
+func findDenyRule(policy ResourcePolicy, action string, req AccessRequest, trace *[]ConditionTrace) (PolicyRule, string, bool) {
+	for _, key := range []string{action, DenyAllActions} {
+		for i, rule := range policy.Deny[key] {
+			path := "deny." + key + "[" + strconv.Itoa(i) + "]"
+			if matchedPath, matched := ruleMatches(rule, req, true, path, trace); matched {
+				return rule, matchedPath, true
+			}
+		}
+	}
+	return PolicyRule{}, "", false
+}
+
+// ruleMatches matches a rule as RuleMatches does, returning the path of the
+// rule, or Or rule, that matched. Evaluated conditions are added to trace
+// when it is not nil.
+func ruleMatches(rule PolicyRule, req AccessRequest, deny bool, path string, trace *[]ConditionTrace) (string, bool) {
+	ownTerms := len(rule.AllOf) > 0 || len(rule.AnyOf) > 0 || len(rule.Conditions) > 0
+	if (ownTerms || len(rule.Or) == 0) && ruleTermsMatch(rule, req, deny, path, trace) {
+		return path, true
+	}
+
+	for i, alternative := range rule.Or {
+		if matchedPath, matched := ruleMatches(alternative, req, deny, path+".or["+strconv.Itoa(i)+"]", trace); matched {
+			return matchedPath, true
+		}
+	}
+
+	return "", false
+}
+
+// actionPermissions lists the permissions the allow and deny rules of an
+// action refer to, Or rules included
+func actionPermissions(policy ResourcePolicy, action string) []string {
+	var permissions []string
+	seen := make(map[string]bool)
+
+	var collect func(rule PolicyRule)
+	collect = func(rule PolicyRule) {
+		for _, perm := range append(append([]string{}, rule.AllOf...), rule.AnyOf...) {
+			if !seen[perm] {
+				permissions = append(permissions, perm)
+				seen[perm] = true
+			}
+		}
+		for _, alternative := range rule.Or {
+			collect(alternative)
+		}
+	}
+
+	if rule, exists := policy.Actions[action]; exists {
+		collect(rule)
+	}
+	for _, key := range []string{action, DenyAllActions} {
+		for _, rule := range policy.Deny[key] {
+			collect(rule)
+		}
+	}
+
+	return permissions
+}
+
+func ruleTermsMatch(rule PolicyRule, req AccessRequest, deny bool, path string, trace *[]ConditionTrace) bool {
+	if !evaluateAllOfRule(rule.AllOf, req.Permissions) {
 		return false
 	}
 
-	if !evaluateAllOfRule(rule.AllOf, userPermissions) {
+	if len(rule.AnyOf) > 0 && !evaluateAnyOfRule(rule.AnyOf, req.Permissions) {
 		return false
 	}
 
-	if len(rule.AnyOf) == 0 {
-		return true
+	for _, cond := range rule.Conditions {
+		holds, ok := EvaluateCondition(cond, req)
+		if !ok {
+			holds = deny
+		}
+		if trace != nil {
+			*trace = append(*trace, ConditionTrace{Rule: path, Condition: cond, Holds: holds, Evaluated: ok})
+		}
+		if !holds {
+			return false
+		}
 	}
 
-	return evaluateAnyOfRule(rule.AnyOf, userPermissions)
+	return true
 }
 
 func evaluateAllOfRule(allOfPermissions []string, userPermissions []string) bool {
 	for _, requiredPermission := range allOfPermissions {
-		if !containsPermission(userPermissions, requiredPermission) {
+		if !ContainsPermission(userPermissions, requiredPermission) {
 			return false
 		}
 	}
@@ -28,29 +175,26 @@ func evaluateAllOfRule(allOfPermissions []string, userPermissions []string) bool
 
 func evaluateAnyOfRule(anyOfPermissions []string, userPermissions []string) bool {
 	for _, permission := range anyOfPermissions {
-		if containsPermission(userPermissions, permission) {
+		if ContainsPermission(userPermissions, permission) {
 			return true
 		}
 	}
 	return false
 }
 
-func containsPermission(permissions []string, permission string) bool {
-	for _, p := range permissions {
-		if p == permission {
-			return true
-		}
-	}
-	return false
+func EvaluateResourceAccess(policies []ResourcePolicy, resourceType, action string, userPermissions []string) bool {
+	return EvaluateResourceAccessRequest(policies, resourceType, action, AccessRequest{Permissions: userPermissions})
 }
 
-func EvaluateResourceAccess(policies []ResourcePolicy, resourceType, action string, userPermissions []string) bool {
+// EvaluateResourceAccessRequest evaluates the policy of a resource type
+// against a request with attributes
+func EvaluateResourceAccessRequest(policies []ResourcePolicy, resourceType, action string, req AccessRequest) bool {
 	policy := FindPolicy(policies, resourceType)
 	if policy == nil {
 		return false
 	}
 
-	return EvaluatePolicy(*policy, action, userPermissions)
+	return EvaluatePolicyRequest(*policy, action, req)
 }
 
 func FindPolicy(policies []ResourcePolicy, resourceType string) *ResourcePolicy {
@@ -125,17 +269,33 @@ func ValidatePolicy(policy ResourcePolicy) ValidationErrors {
 		errors = append(errors, ruleErrors...)
 	}
 
+	for actionName, rules := range policy.Deny {
+		if actionName == "" {
+			errors = append(errors, ValidationError{
+				Field:   "deny",
+				Code:    "empty_action_name",
+				Message: "Action name cannot be empty",
+			})
+			continue
+		}
+
+		for i, rule := range rules {
+			ruleErrors := ValidatePolicyRule(rule, "deny."+actionName+"["+strconv.Itoa(i)+"]")
+			errors = append(errors, ruleErrors...)
+		}
+	}
+
 	return errors
 }
 
 func ValidatePolicyRule(rule PolicyRule, fieldPrefix string) ValidationErrors {
 	var errors ValidationErrors
 
-	if len(rule.AllOf) == 0 && len(rule.AnyOf) == 0 {
+	if len(rule.AllOf) == 0 && len(rule.AnyOf) == 0 && len(rule.Conditions) == 0 && len(rule.Or) == 0 {
 		errors = append(errors, ValidationError{
 			Field:   fieldPrefix,
 			Code:    "empty_rule",
-			Message: "Policy rule must define at least one permission in allOf or anyOf",
+			Message: "Policy rule must define at least one permission in allOf or anyOf, a condition or an or rule",
 		})
 	}
 
@@ -161,6 +321,14 @@ func ValidatePolicyRule(rule PolicyRule, fieldPrefix string) ValidationErrors {
 		}
 	}
 
+	for i, cond := range rule.Conditions {
+		errors = append(errors, ValidateCondition(cond, fieldPrefix+".conditions["+strconv.Itoa(i)+"]")...)
+	}
+
+	for i, alternative := range rule.Or {
+		errors = append(errors, ValidatePolicyRule(alternative, fieldPrefix+".or["+strconv.Itoa(i)+"]")...)
+	}
+
 	return errors
 }
 
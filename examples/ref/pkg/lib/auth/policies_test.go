@@ -3,6 +3,7 @@ package auth
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestEvaluatePolicy(t *testing.T) {
@@ -483,6 +484,59 @@ func TestValidatePolicy(t *testing.T) {
 			expectedCount: 1,
 			expectedCodes: []string{"invalid_format"},
 		},
+		{
+			name: "condition only rule",
+			policy: ResourcePolicy{
+				ID:      "order",
+				Type:    "order",
+				Version: 1,
+				Actions: map[string]PolicyRule{
+					"edit": {Conditions: []Condition{OwnerCondition()}},
+				},
+			},
+			expectedCount: 0,
+			expectedCodes: []string{},
+		},
+		{
+			name: "invalid condition in or rule",
+			policy: ResourcePolicy{
+				ID:      "order",
+				Type:    "order",
+				Version: 1,
+				Actions: map[string]PolicyRule{
+					"edit": {
+						AnyOf: []string{"orders:write"},
+						Or: []PolicyRule{
+							{
+								Conditions: []Condition{
+									{Attribute: "owner", Operator: ConditionEquals},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedCount: 1,
+			expectedCodes: []string{"invalid_attribute"},
+		},
+		{
+			name: "empty deny rule",
+			policy: ResourcePolicy{
+				ID:      "order",
+				Type:    "order",
+				Version: 1,
+				Actions: map[string]PolicyRule{
+					"read": {AnyOf: []string{"orders:read"}},
+				},
+				Deny: map[string][]PolicyRule{
+					"*": {
+						{},
+					},
+				},
+			},
+			expectedCount: 1,
+			expectedCodes: []string{"empty_rule"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -617,3 +671,128 @@ func TestPolicySupportsAction(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluatePolicyRequest(t *testing.T) {
+	officeHours := Condition{Attribute: "context.time", Operator: ConditionTimeBetween, Values: []string{"08:00", "18:00"}}
+	policy := ResourcePolicy{
+		ID:      "list",
+		Type:    "list",
+		Version: 1,
+		Actions: map[string]PolicyRule{
+			"read": {AnyOf: []string{"lists:read"}},
+			"edit": {
+				AllOf: []string{"lists:write"},
+				Or: []PolicyRule{
+					{Conditions: []Condition{OwnerCondition()}},
+				},
+			},
+			"export": {
+				AllOf:      []string{"lists:read"},
+				Conditions: []Condition{officeHours},
+			},
+		},
+		Deny: map[string][]PolicyRule{
+			"edit": {
+				{
+					Conditions: []Condition{
+						{Attribute: "resource.status", Operator: ConditionEquals, Value: "archived"},
+					},
+				},
+			},
+			DenyAllActions: {
+				{
+					Conditions: []Condition{
+						{Attribute: "context.ip", Operator: ConditionIPNotIn, Values: []string{"10.0.0.0/8"}},
+					},
+				},
+			},
+		},
+	}
+
+	day := time.Date(2025, 10, 20, 10, 0, 0, 0, time.UTC)
+	night := time.Date(2025, 10, 20, 23, 0, 0, 0, time.UTC)
+	office := Attributes{"ip": "10.0.0.7"}
+	open := Attributes{"owner_id": "user1", "status": "open"}
+
+	tests := []struct {
+		name     string
+		action   string
+		req      AccessRequest
+		expected bool
+	}{
+		{"permission", "read", AccessRequest{Permissions: []string{"lists:read"}, Context: office}, true},
+		{"owner without permission", "edit", AccessRequest{Subject: Attributes{"id": "user1"}, Resource: open, Context: office}, true},
+		{"other user without permission", "edit", AccessRequest{Subject: Attributes{"id": "user2"}, Resource: open, Context: office}, false},
+		{"other user with permission", "edit", AccessRequest{Permissions: []string{"lists:write"}, Subject: Attributes{"id": "user2"}, Resource: open, Context: office}, true},
+		{"deny overrides owner", "edit", AccessRequest{Subject: Attributes{"id": "user1"}, Resource: Attributes{"owner_id": "user1", "status": "archived"}, Context: office}, false},
+		{"deny overrides permission", "edit", AccessRequest{Permissions: []string{"*"}, Resource: Attributes{"status": "archived"}, Context: office}, false},
+		{"deny all actions outside office", "read", AccessRequest{Permissions: []string{"lists:read"}, Context: Attributes{"ip": "203.0.113.9"}}, false},
+		{"deny fails closed without ip", "read", AccessRequest{Permissions: []string{"lists:read"}}, false},
+		{"within time window", "export", AccessRequest{Permissions: []string{"lists:read"}, Context: office, Time: day}, true},
+		{"outside time window", "export", AccessRequest{Permissions: []string{"lists:read"}, Context: office, Time: night}, false},
+		{"unknown action", "share", AccessRequest{Permissions: []string{"*"}, Context: office}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EvaluatePolicyRequest(policy, tt.action, tt.req); got != tt.expected {
+				t.Errorf("EvaluatePolicyRequest() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	if EvaluatePolicy(policy, "read", []string{"lists:read"}) {
+		t.Error("EvaluatePolicy() = true without the attributes a deny rule needs, want false")
+	}
+}
+
+func TestExplainPolicy(t *testing.T) {
+	archived := Condition{Attribute: "resource.status", Operator: ConditionEquals, Value: "archived"}
+	policy := ResourcePolicy{
+		ID:      "list",
+		Type:    "list",
+		Version: 1,
+		Actions: map[string]PolicyRule{
+			"edit": {
+				AllOf: []string{"lists:write"},
+				Or: []PolicyRule{
+					{Conditions: []Condition{OwnerCondition()}},
+				},
+			},
+		},
+		Deny: map[string][]PolicyRule{
+			"edit": {
+				{Conditions: []Condition{archived}},
+			},
+		},
+	}
+
+	owner := AccessRequest{Subject: Attributes{"id": "user1"}, Resource: Attributes{"owner_id": "user1", "status": "open"}}
+	trace := ExplainPolicy(policy, "edit", owner)
+	if !trace.Allowed || trace.AllowedBy != "actions.edit.or[0]" {
+		t.Errorf("ExplainPolicy() = %v by %q, want allowed by actions.edit.or[0]", trace.Allowed, trace.AllowedBy)
+	}
+	if len(trace.Conditions) != 2 || trace.Conditions[0].Rule != "deny.edit[0]" || trace.Conditions[0].Holds {
+		t.Errorf("ExplainPolicy() conditions = %+v, want the deny condition first, not holding", trace.Conditions)
+	}
+
+	owner.Resource = Attributes{"owner_id": "user1", "status": "archived"}
+	trace = ExplainPolicy(policy, "edit", owner)
+	if trace.Allowed || trace.DeniedBy != "deny.edit[0]" || trace.Reason != "denied by deny.edit[0]" {
+		t.Errorf("ExplainPolicy() = %v, %q, want denied by deny.edit[0]", trace.Allowed, trace.Reason)
+	}
+
+	trace = ExplainPolicy(policy, "edit", AccessRequest{Permissions: []string{"lists:write"}})
+	if trace.Allowed || trace.DeniedBy != "deny.edit[0]" || trace.Conditions[0].Evaluated || !trace.Conditions[0].Holds {
+		t.Errorf("ExplainPolicy() = %+v, want the unevaluable deny condition to deny", trace)
+	}
+
+	if trace = ExplainPolicy(policy, "share", owner); trace.Defined || trace.Allowed {
+		t.Errorf("ExplainPolicy() = %+v for an undefined action", trace)
+	}
+
+	decision := DecisionTrace{Allowed: true, Reason: "granted"}.WithPolicy(ExplainPolicy(policy, "edit", owner))
+	if decision.Allowed || decision.Reason != "denied by deny.edit[0]" || decision.Policy == nil {
+		t.Errorf("WithPolicy() = %v, %q, want the policy to refuse", decision.Allowed, decision.Reason)
+	}
+}
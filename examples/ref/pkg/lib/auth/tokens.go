@@ -3,12 +3,16 @@ package auth
 import (
 	"crypto/ed25519"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"sort"
 	"time"
 )
 
+// NotBeforeLeeway tolerates clock drift between the issuer and the service
+const NotBeforeLeeway = 30 * time.Second
+
 func ValidateTokenClaims(claims TokenClaims, now time.Time) ValidationErrors {
 	var errors ValidationErrors
 
@@ -91,10 +95,45 @@ func ValidateTokenAudience(claims TokenClaims, expectedAudience string) Validati
 	return errors
 }
 
+func ValidateTokenNotBefore(claims TokenClaims, now time.Time) ValidationErrors {
+	var errors ValidationErrors
+
+	if claims.NotBefore != 0 && now.Add(NotBeforeLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		errors = append(errors, ValidationError{
+			Field:   "nbf",
+			Code:    "not_yet_valid",
+			Message: "Token is not valid yet",
+		})
+	}
+
+	return errors
+}
+
+func ValidateTokenIssuer(claims TokenClaims, expectedIssuer string) ValidationErrors {
+	var errors ValidationErrors
+
+	if claims.Issuer != expectedIssuer {
+		errors = append(errors, ValidationError{
+			Field:   "iss",
+			Code:    "invalid_issuer",
+			Message: "Token issuer does not match expected value",
+		})
+	}
+
+	return errors
+}
+
 func ValidateTokenContext(claims TokenClaims, expectedContext map[string]string) ValidationErrors {
 	var errors ValidationErrors
 
-	for key, expectedValue := range expectedContext {
+	keys := make([]string, 0, len(expectedContext))
+	for key := range expectedContext {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		expectedValue := expectedContext[key]
 		actualValue, exists := claims.Context[key]
 		if !exists {
 			errors = append(errors, ValidationError{
@@ -129,6 +168,9 @@ func ValidateTokenForService(claims TokenClaims, service string, now time.Time)
 	audErrors := ValidateTokenAudience(claims, service)
 	errors = append(errors, audErrors...)
 
+	nbfErrors := ValidateTokenNotBefore(claims, now)
+	errors = append(errors, nbfErrors...)
+
 	return errors
 }
 
@@ -238,6 +280,17 @@ func ValidateTokenScope(claims TokenClaims, requiredScope Scope) ValidationError
 	return errors
 }
 
+// TokenAllowsPermission reports whether the token scopes cover permission,
+// matched as grants are. Tokens without scopes are limited only by the
+// grants of their subject.
+func TokenAllowsPermission(claims TokenClaims, permission string) bool {
+	if len(claims.Scopes) == 0 {
+		return true
+	}
+
+	return ContainsPermission(claims.Scopes, permission)
+}
+
 func CreateTokenClaims(subject, sessionID, audience string, context map[string]string, ttl time.Duration, authzVersion int) TokenClaims {
 	now := time.Now()
 	return TokenClaims{
@@ -246,6 +299,9 @@ func CreateTokenClaims(subject, sessionID, audience string, context map[string]s
 		Audience:     audience,
 		Context:      context,
 		ExpiresAt:    now.Add(ttl).Unix(),
+		NotBefore:    now.Unix(),
+		IssuedAt:     now.Unix(),
+		TokenID:      hex.EncodeToString(GenerateRandomBytes(16)),
 		AuthzVersion: authzVersion,
 	}
 }
@@ -271,101 +327,134 @@ func GenerateInternalToken(userID, sessionID, audience string, context map[strin
 	return GeneratePASETOToken(claims, privateKey)
 }
 
-// GeneratePASETOToken creates a PASETO token from claims
-func GeneratePASETOToken(claims TokenClaims, privateKey ed25519.PrivateKey) (string, error) {
-	// Create PASETO payload
-	payload := map[string]interface{}{
-		"sub":       claims.Subject,
-		"sid":       claims.SessionID,
-		"aud":       claims.Audience,
-		"exp":       claims.ExpiresAt,
-		"authz_ver": claims.AuthzVersion,
-	}
+// TokenOptions carry the parts of a token that live outside the claims
+type TokenOptions struct {
+	// KeyID is written to the footer on issue and, when set, must match the
+	// footer on verify.
+	KeyID string
+	// Implicit is an assertion bound to the signature but not sent in the token.
+	Implicit []byte
+}
 
-	if claims.Context != nil && len(claims.Context) > 0 {
-		payload["ctx"] = claims.Context
-	}
+// pasetoClaims is the wire form of TokenClaims
+type pasetoClaims struct {
+	Issuer       string            `json:"iss,omitempty"`
+	Subject      string            `json:"sub"`
+	Audience     string            `json:"aud"`
+	ExpiresAt    string            `json:"exp"`
+	NotBefore    string            `json:"nbf,omitempty"`
+	IssuedAt     string            `json:"iat,omitempty"`
+	TokenID      string            `json:"jti,omitempty"`
+	SessionID    string            `json:"sid"`
+	Context      map[string]string `json:"ctx,omitempty"`
+	AuthzVersion int               `json:"authz_ver"`
+}
+
+// GeneratePASETOToken creates a v4.public token from claims
+func GeneratePASETOToken(claims TokenClaims, privateKey ed25519.PrivateKey) (string, error) {
+	return GeneratePASETOTokenWithOptions(claims, privateKey, TokenOptions{})
+}
 
-	// Marshal to JSON
-	payloadJSON, err := json.Marshal(payload)
+// GeneratePASETOTokenWithOptions creates a v4.public token from claims with
+// a kid footer and implicit assertion.
+func GeneratePASETOTokenWithOptions(claims TokenClaims, privateKey ed25519.PrivateKey, opts TokenOptions) (string, error) {
+	payload, err := json.Marshal(pasetoClaims{
+		Issuer:       claims.Issuer,
+		Subject:      claims.Subject,
+		Audience:     claims.Audience,
+		ExpiresAt:    formatClaimTime(claims.ExpiresAt),
+		NotBefore:    formatClaimTime(claims.NotBefore),
+		IssuedAt:     formatClaimTime(claims.IssuedAt),
+		TokenID:      claims.TokenID,
+		SessionID:    claims.SessionID,
+		Context:      claims.Context,
+		AuthzVersion: claims.AuthzVersion,
+	})
 	if err != nil {
 		return "", fmt.Errorf("could not marshal token payload: %w", err)
 	}
 
-	// Sign with Ed25519 (simplified PASETO v4.public implementation)
-	signature := ed25519.Sign(privateKey, payloadJSON)
-
-	// Create PASETO token format: v4.public.payload.signature
-	token := fmt.Sprintf("v4.public.%s.%s",
-		encodeBase64URL(payloadJSON),
-		encodeBase64URL(signature))
+	var footer []byte
+	if opts.KeyID != "" {
+		footer, err = json.Marshal(TokenFooter{KeyID: opts.KeyID})
+		if err != nil {
+			return "", fmt.Errorf("could not marshal token footer: %w", err)
+		}
+	}
 
-	return token, nil
+	return SignV4Public(privateKey, payload, footer, opts.Implicit)
 }
 
-// VerifyPASETOToken verifies and parses a PASETO token
+// VerifyPASETOToken verifies a v4.public token and decodes its claims
 func VerifyPASETOToken(token string, publicKey ed25519.PublicKey) (*TokenClaims, error) {
-	// Parse PASETO token format: v4.public.payload.signature
-	parts := strings.Split(token, ".")
-	if len(parts) != 4 || parts[0] != "v4" || parts[1] != "public" {
-		return nil, fmt.Errorf("invalid PASETO token format")
-	}
+	return VerifyPASETOTokenWithOptions(token, publicKey, TokenOptions{})
+}
 
-	// Decode payload and signature
-	payload, err := decodeBase64URL(parts[2])
+// VerifyPASETOTokenWithOptions verifies a v4.public token against the
+// implicit assertion and, when opts.KeyID is set, the footer kid.
+// Claims are decoded strictly: unknown claims or malformed times are rejected.
+func VerifyPASETOTokenWithOptions(token string, publicKey ed25519.PublicKey, opts TokenOptions) (*TokenClaims, error) {
+	payload, rawFooter, err := VerifyV4Public(token, publicKey, opts.Implicit)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode payload: %w", err)
+		return nil, err
 	}
 
-	signature, err := decodeBase64URL(parts[3])
-	if err != nil {
-		return nil, fmt.Errorf("could not decode signature: %w", err)
+	if opts.KeyID != "" {
+		var footer TokenFooter
+		if err := decodeStrictJSON(rawFooter, &footer); err != nil {
+			return nil, fmt.Errorf("%w: invalid footer: %v", ErrInvalidToken, err)
+		}
+		if footer.KeyID != opts.KeyID {
+			return nil, fmt.Errorf("%w: unexpected key ID %q", ErrInvalidToken, footer.KeyID)
+		}
 	}
 
-	// Verify signature
-	if !ed25519.Verify(publicKey, payload, signature) {
-		return nil, fmt.Errorf("invalid token signature")
+	var raw pasetoClaims
+	if err := decodeStrictJSON(payload, &raw); err != nil {
+		return nil, fmt.Errorf("%w: could not parse token claims: %v", ErrInvalidToken, err)
 	}
 
-	// Parse claims
-	var rawClaims map[string]interface{}
-	if err := json.Unmarshal(payload, &rawClaims); err != nil {
-		return nil, fmt.Errorf("could not parse token claims: %w", err)
+	claims := &TokenClaims{
+		Issuer:       raw.Issuer,
+		Subject:      raw.Subject,
+		SessionID:    raw.SessionID,
+		Audience:     raw.Audience,
+		Context:      raw.Context,
+		TokenID:      raw.TokenID,
+		AuthzVersion: raw.AuthzVersion,
 	}
 
-	// Convert to TokenClaims struct
-	claims := &TokenClaims{}
-
-	if sub, ok := rawClaims["sub"].(string); ok {
-		claims.Subject = sub
+	if claims.ExpiresAt, err = parseClaimTime("exp", raw.ExpiresAt); err != nil {
+		return nil, err
 	}
-
-	if sid, ok := rawClaims["sid"].(string); ok {
-		claims.SessionID = sid
+	if claims.NotBefore, err = parseClaimTime("nbf", raw.NotBefore); err != nil {
+		return nil, err
 	}
-
-	if aud, ok := rawClaims["aud"].(string); ok {
-		claims.Audience = aud
+	if claims.IssuedAt, err = parseClaimTime("iat", raw.IssuedAt); err != nil {
+		return nil, err
 	}
 
-	if exp, ok := rawClaims["exp"].(float64); ok {
-		claims.ExpiresAt = int64(exp)
-	}
+	return claims, nil
+}
 
-	if authzVer, ok := rawClaims["authz_ver"].(float64); ok {
-		claims.AuthzVersion = int(authzVer)
+// formatClaimTime encodes Unix seconds as an RFC 3339 claim; zero is omitted
+func formatClaimTime(unix int64) string {
+	if unix == 0 {
+		return ""
 	}
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
 
-	if ctx, ok := rawClaims["ctx"].(map[string]interface{}); ok {
-		claims.Context = make(map[string]string)
-		for k, v := range ctx {
-			if strVal, ok := v.(string); ok {
-				claims.Context[k] = strVal
-			}
-		}
+// parseClaimTime decodes an RFC 3339 claim into Unix seconds; empty is zero
+func parseClaimTime(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
 	}
-
-	return claims, nil
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid %s claim: %v", ErrInvalidToken, name, err)
+	}
+	return t.Unix(), nil
 }
 
 // GenerateKeyPair generates an Ed25519 key pair for PASETO tokens
@@ -329,7 +329,7 @@ func TestValidateTokenContext(t *testing.T) {
 				"id":   "123",
 			},
 			expectedCount: 2,
-			expectedCodes: []string{"invalid_context", "missing_context"},
+			expectedCodes: []string{"missing_context", "invalid_context"},
 		},
 		{
 			name:            "empty expected context",
@@ -644,3 +644,49 @@ func TestCreateTokenClaims(t *testing.T) {
 		t.Errorf("CreateTokenClaims() expiration time is not within expected range")
 	}
 }
+func TestValidateTokenNotBefore(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		notBefore int64
+		wantErr   bool
+	}{
+		{"no nbf", 0, false},
+		{"in the past", now.Add(-time.Minute).Unix(), false},
+		{"within leeway", now.Add(NotBeforeLeeway / 2).Unix(), false},
+		{"in the future", now.Add(time.Hour).Unix(), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := ValidateTokenNotBefore(TokenClaims{NotBefore: tt.notBefore}, now)
+			if (len(errors) > 0) != tt.wantErr {
+				t.Errorf("ValidateTokenNotBefore() = %v, wantErr %v", errors, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenAllowsPermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string
+		permission string
+		want       bool
+	}{
+		{"no scopes", nil, "posts:write", true},
+		{"listed", []string{"posts:read", "posts:write"}, "posts:write", true},
+		{"not listed", []string{"posts:read"}, "posts:write", false},
+		{"wildcard", []string{"posts:*"}, "posts:write", true},
+		{"implied", []string{"roles:manage"}, "roles:read", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TokenAllowsPermission(TokenClaims{Scopes: tt.scopes}, tt.permission); got != tt.want {
+				t.Errorf("TokenAllowsPermission() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
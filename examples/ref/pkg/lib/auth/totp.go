@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). They are the defaults authenticator apps assume.
+const (
+	TOTPDigits     = 6
+	TOTPPeriod     = 30 * time.Second
+	TOTPSkew       = 1 // Steps accepted before and after the current one
+	TOTPSecretSize = 20
+
+	RecoveryCodeCount = 10
+	recoveryCodeSize  = 10
+)
+
+// ErrInvalidTOTPSecret is returned when a stored TOTP secret cannot be read.
+var ErrInvalidTOTPSecret = errors.New("invalid TOTP secret")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random TOTP secret.
+func GenerateTOTPSecret() []byte {
+	return GenerateRandomBytes(TOTPSecretSize)
+}
+
+// EncodeTOTPSecret returns the base32 form users type into authenticator apps.
+func EncodeTOTPSecret(secret []byte) string {
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPStep returns the time step t falls in.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// TOTPCode returns the code for the time step t falls in.
+func TOTPCode(secret []byte, t time.Time) string {
+	return hotp(secret, TOTPStep(t))
+}
+
+// ValidateTOTP checks code against the steps around t and returns the step
+// it matched. Callers store the step and reject codes for it or earlier
+// steps, so a code cannot be used twice.
+func ValidateTOTP(secret []byte, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	current := TOTPStep(t)
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPURI returns the otpauth URI authenticator apps enroll from, usually
+// shown as a QR code.
+func TOTPURI(issuer, account string, secret []byte) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+
+	params := url.Values{}
+	params.Set("secret", EncodeTOTPSecret(secret))
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(TOTPDigits))
+	params.Set("period", fmt.Sprint(int(TOTPPeriod/time.Second)))
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// EncryptTOTPSecret encrypts a TOTP secret with SealData, as stored in
+// User.MFASecretCT.
+func EncryptTOTPSecret(secret []byte, key []byte) ([]byte, error) {
+	return SealData(secret, key)
+}
+
+// DecryptTOTPSecret decrypts a secret encrypted with EncryptTOTPSecret.
+func DecryptTOTPSecret(sealed []byte, key []byte) ([]byte, error) {
+	secret, err := OpenData(sealed, key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTOTPSecret, err)
+	}
+	return secret, nil
+}
+
+// GenerateRecoveryCodes returns n one-time recovery codes, formatted as
+// dash separated groups of four characters.
+func GenerateRecoveryCodes(n int) []string {
+	codes := make([]string, n)
+	for i := range codes {
+		raw := strings.ToLower(totpEncoding.EncodeToString(GenerateRandomBytes(recoveryCodeSize)))
+
+		groups := make([]string, 0, len(raw)/4)
+		for j := 0; j < len(raw); j += 4 {
+			groups = append(groups, raw[j:j+4])
+		}
+		codes[i] = strings.Join(groups, "-")
+	}
+	return codes
+}
+
+// HashRecoveryCode returns the stored form of a recovery code. Codes are
+// compared case insensitively and without dashes or spaces.
+func HashRecoveryCode(code string) []byte {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return sum[:]
+}
+
+// hotp computes an RFC 4226 code for counter.
+func hotp(secret []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod)
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B vectors for the SHA1 secret, truncated to six digits.
+func TestTOTPCodeVectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := TOTPCode(secret, time.Unix(tt.unix, 0)); got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := GenerateTOTPSecret()
+	now := time.Unix(1700000000, 0)
+	code := TOTPCode(secret, now)
+
+	tests := []struct {
+		name   string
+		code   string
+		at     time.Time
+		wantOK bool
+	}{
+		{"current step", code, now, true},
+		{"previous step accepted", code, now.Add(TOTPPeriod), true},
+		{"next step accepted", code, now.Add(-TOTPPeriod), true},
+		{"too old", code, now.Add(2 * TOTPPeriod), false},
+		{"wrong length", code[:5], now, false},
+		{"padded", " " + code + " ", now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(secret, tt.code, tt.at)
+			if ok != tt.wantOK {
+				t.Fatalf("ValidateTOTP() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step != TOTPStep(now) {
+				t.Errorf("ValidateTOTP() step = %d, want %d", step, TOTPStep(now))
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	uri := TOTPURI("Hatmax App", "user@example.com", secret)
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("cannot parse URI: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Errorf("URI = %s, want otpauth://totp/...", uri)
+	}
+	if parsed.Path != "/Hatmax App:user@example.com" {
+		t.Errorf("label = %s", parsed.Path)
+	}
+
+	query := parsed.Query()
+	if query.Get("secret") != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("secret = %s", query.Get("secret"))
+	}
+	if query.Get("issuer") != "Hatmax App" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("query = %v", query)
+	}
+}
+
+func TestEncryptTOTPSecret(t *testing.T) {
+	key := GenerateEncryptionKey()
+	secret := GenerateTOTPSecret()
+
+	sealed, err := EncryptTOTPSecret(secret, key)
+	if err != nil {
+		t.Fatalf("EncryptTOTPSecret() error = %v", err)
+	}
+	if bytes.Contains(sealed, secret) {
+		t.Error("sealed secret contains the plaintext")
+	}
+
+	got, err := DecryptTOTPSecret(sealed, key)
+	if err != nil || !bytes.Equal(got, secret) {
+		t.Fatalf("DecryptTOTPSecret() = %x, %v, want %x", got, err, secret)
+	}
+
+	if _, err := DecryptTOTPSecret(sealed, GenerateEncryptionKey()); err == nil {
+		t.Error("DecryptTOTPSecret() with wrong key error = nil")
+	}
+	if _, err := DecryptTOTPSecret(sealed[:10], key); err == nil {
+		t.Error("DecryptTOTPSecret() with short input error = nil")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes := GenerateRecoveryCodes(RecoveryCodeCount)
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("codes = %d, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 19 || strings.Count(code, "-") != 3 {
+			t.Errorf("code %q is not four dash separated groups of four", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	hash := HashRecoveryCode(codes[0])
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+	if !bytes.Equal(HashRecoveryCode(typed), hash) {
+		t.Error("HashRecoveryCode() depends on case or separators")
+	}
+	if bytes.Equal(HashRecoveryCode(codes[1]), hash) {
+		t.Error("different codes hash the same")
+	}
+}
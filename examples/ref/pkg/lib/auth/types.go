@@ -31,6 +31,7 @@ type Role struct {
 	ID          uuid.UUID
 	Name        string
 	Permissions []string
+	Inherits    []uuid.UUID // IDs of the roles whose permissions it also has
 }
 
 type Grant struct {
@@ -54,25 +55,133 @@ type Scope struct {
 	ID   string
 }
 
+// ResourcePolicy allows an action when its rule matches and no deny rule of
+// the action, or of "*", matches. Deny rules always win over allow rules.
 type ResourcePolicy struct {
 	ID      string
 	Type    string
 	Version int
 	Actions map[string]PolicyRule
+	Deny    map[string][]PolicyRule
 }
 
+// PolicyRule matches when the permissions are held and all conditions hold,
+// or when one of the Or rules matches.
 type PolicyRule struct {
-	AnyOf []string
-	AllOf []string
+	AnyOf      []string
+	AllOf      []string
+	Conditions []Condition
+	Or         []PolicyRule
 }
 
+// Condition compares an attribute of the subject, resource or request
+// context, named as in "resource.owner_id", with Value, Values or the
+// attribute named by ValueFrom.
+type Condition struct {
+	Attribute string
+	Operator  ConditionOperator
+	Value     string
+	Values    []string
+	ValueFrom string
+}
+
+type ConditionOperator string
+
+const (
+	ConditionEquals      ConditionOperator = "eq"
+	ConditionNotEquals   ConditionOperator = "ne"
+	ConditionIn          ConditionOperator = "in"
+	ConditionNotIn       ConditionOperator = "not_in"
+	ConditionExists      ConditionOperator = "exists"
+	ConditionIPIn        ConditionOperator = "ip_in"     // Values are CIDRs or IPs
+	ConditionIPNotIn     ConditionOperator = "ip_not_in" // Values are CIDRs or IPs
+	ConditionBefore      ConditionOperator = "before"    // Value is RFC 3339
+	ConditionAfter       ConditionOperator = "after"     // Value is RFC 3339
+	ConditionTimeBetween ConditionOperator = "time_between"
+)
+
+// Attributes are the attributes of a subject, resource or request context
+type Attributes map[string]string
+
+// AccessRequest is what policies are evaluated against. Context usually has
+// "ip"; "time" is Time, or now when zero.
+type AccessRequest struct {
+	Permissions []string
+	Subject     Attributes
+	Resource    Attributes
+	Context     Attributes
+	Time        time.Time
+}
+
+// DecisionTrace explains a permission decision: every grant considered and
+// what it contributed, and the resource policy evaluation when there is one.
+type DecisionTrace struct {
+	Permission string
+	Scope      Scope
+	Ancestors  []Scope
+	Allowed    bool
+	Reason     string
+	Grants     []GrantTrace
+	Policy     *PolicyTrace
+}
+
+// GrantTrace is what a grant contributed to a decision. ScopeMatch is
+// "global", "exact" or "ancestor", with the scope it matched through; for
+// role grants, RoleID is the role, maybe inherited, holding Permission.
+type GrantTrace struct {
+	GrantID      uuid.UUID
+	GrantType    GrantType
+	Value        string
+	Scope        Scope
+	ExpiresAt    *time.Time
+	Expired      bool
+	ScopeMatch   string
+	MatchedScope *Scope
+	RoleID       string
+	RoleName     string
+	Permission   string
+	Allows       bool
+}
+
+// PolicyTrace explains a resource policy evaluation: the deny rule that
+// fired or the allow rule that matched, and every condition evaluated on
+// the way. Rules are named by path, as in "actions.edit.or[0]" or "deny.*[0]".
+type PolicyTrace struct {
+	Action     string
+	Defined    bool
+	Allowed    bool
+	AllowedBy  string
+	DeniedBy   string
+	Reason     string
+	Conditions []ConditionTrace
+}
+
+// ConditionTrace is the outcome of a condition. Evaluated is false when it
+// could not be; Holds is then false for allow rules and true for deny rules.
+type ConditionTrace struct {
+	Rule      string
+	Condition Condition
+	Holds     bool
+	Evaluated bool
+}
+
+// TokenClaims are the claims carried by access tokens. Times are Unix
+// seconds; on the wire they are encoded as RFC 3339 strings as PASETO requires.
 type TokenClaims struct {
+	Issuer       string            `json:"iss,omitempty"`
 	Subject      string            `json:"sub"`
 	SessionID    string            `json:"sid"`
 	Audience     string            `json:"aud"`
 	Context      map[string]string `json:"ctx"`
 	ExpiresAt    int64             `json:"exp"`
+	NotBefore    int64             `json:"nbf,omitempty"`
+	IssuedAt     int64             `json:"iat,omitempty"`
+	TokenID      string            `json:"jti,omitempty"`
 	AuthzVersion int               `json:"authz_ver"`
+	// SubjectType is empty or user for users and service_account for API keys.
+	SubjectType string `json:"sub_type,omitempty"`
+	// Scopes limit the permissions of the subject to those listed, when set.
+	Scopes []string `json:"scp,omitempty"`
 }
 
 type EmailSubscription struct {
@@ -83,9 +192,12 @@ type EmailSubscription struct {
 	ConfirmedAt *time.Time
 }
 
+// ConsentRecord is a consent given or withdrawn by a user, such as to
+// marketing email. Granted is false for a withdrawal.
 type ConsentRecord struct {
-	Type      string
-	Scope     string
-	Timestamp time.Time
-	SourceIP  string
+	Type      string    `json:"type"`
+	Scope     string    `json:"scope"`
+	Granted   bool      `json:"granted"`
+	Timestamp time.Time `json:"timestamp"`
+	SourceIP  string    `json:"source_ip,omitempty"`
 }
@@ -173,6 +173,7 @@ func ValidateScope(scope Scope) ValidationErrors {
 			Code:    "required",
 			Message: "Scope type is required",
 		})
+		return errors
 	}
 
 	switch scope.Type {
@@ -223,12 +224,12 @@ func ValidatePermissionCode(permission string) ValidationErrors {
 		})
 	}
 
-	validPermissionRegex := regexp.MustCompile(`^[a-z][a-z0-9_]*:[a-z][a-z0-9_]*$`)
+	validPermissionRegex := regexp.MustCompile(`^\*$|^([a-z][a-z0-9_]*|\*):([a-z][a-z0-9_]*|\*)$`)
 	if !validPermissionRegex.MatchString(permission) {
 		errors = append(errors, ValidationError{
 			Field:   "permission",
 			Code:    "invalid_format",
-			Message: "Permission code must be in format 'resource:action' with lowercase letters, numbers, and underscores",
+			Message: "Permission code must be in format 'resource:action' with lowercase letters, numbers, and underscores, or * for either part",
 		})
 	}
 
@@ -456,6 +456,30 @@ func TestValidatePermissionCode(t *testing.T) {
 			expectedCount: 0,
 			expectedCodes: []string{},
 		},
+		{
+			name:          "valid wildcard action",
+			permission:    "orders:*",
+			expectedCount: 0,
+			expectedCodes: []string{},
+		},
+		{
+			name:          "valid wildcard resource",
+			permission:    "*:read",
+			expectedCount: 0,
+			expectedCodes: []string{},
+		},
+		{
+			name:          "valid wildcard",
+			permission:    "*",
+			expectedCount: 0,
+			expectedCodes: []string{},
+		},
+		{
+			name:          "partial wildcard",
+			permission:    "orders:re*",
+			expectedCount: 1,
+			expectedCodes: []string{"invalid_format"},
+		},
 		{
 			name:          "empty permission",
 			permission:    "",
@@ -1,16 +1,129 @@
 package core
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+)
+
+// Auth modes, selected with auth.mode in the spec.
+const (
+	AuthModeDevelopment = "development"
+	AuthModeProduction  = "production"
 )
 
+const (
+	defaultKeysTTL        = 5 * time.Minute
+	defaultRevocationsTTL = 30 * time.Second
+	defaultAPIKeysTTL     = 30 * time.Second
+)
+
+// Authenticator validates a bearer token and returns its claims.
 type Authenticator interface {
-	ValidateToken(token string) (string, error)
+	ValidateToken(ctx context.Context, token string) (*auth.TokenClaims, error)
+}
+
+// AuthOptions configures the Authenticator built by NewAuthenticator.
+type AuthOptions struct {
+	// Mode is development (fake tokens) or production (verified PASETO tokens).
+	Mode string
+	// Audiences accepted by the service. A token is valid if its audience matches one.
+	Audiences []string
+	// PublicKeys are base64 encoded Ed25519 public keys.
+	PublicKeys []string
+	// KeysURL is fetched for public keys when PublicKeys is empty (authn /authn/keys).
+	KeysURL string
+	// KeysTTL is how long fetched keys are reused. Defaults to 5 minutes.
+	KeysTTL time.Duration
+	// MinAuthzVersion rejects tokens issued before permissions changed.
+	MinAuthzVersion int
+	// Issuer is the iss tokens must carry, the public base URL of authn.
+	// When empty the issuer is not checked.
+	Issuer string
+	// RevocationsURL is polled for revoked sessions (authn /authn/revocations).
+	// When empty, tokens of revoked sessions stay valid until they expire.
+	RevocationsURL string
+	// RevocationsTTL is how long the revocation list is reused. Defaults to 30 seconds.
+	RevocationsTTL time.Duration
+	// APIKeysURL is where API keys (hmk_...) are introspected
+	// (authn /authn/apikeys/introspect). When empty, API keys are rejected.
+	APIKeysURL string
+	// APIKeysTTL is how long an introspected API key is trusted. Defaults to 30 seconds.
+	APIKeysTTL time.Duration
+}
+
+// NewAuthenticator returns a FakeAuthenticator in development mode and a
+// PASETOAuthenticator in production mode. With an APIKeysURL, API keys are
+// accepted next to them.
+func NewAuthenticator(opts AuthOptions) (Authenticator, error) {
+	tokens, err := newTokenAuthenticator(opts)
+	if err != nil || opts.APIKeysURL == "" {
+		return tokens, err
+	}
+
+	ttl := opts.APIKeysTTL
+	if ttl <= 0 {
+		ttl = defaultAPIKeysTTL
+	}
+	return NewAPIKeyAuthenticator(tokens, NewRemoteAPIKeys(opts.APIKeysURL, ttl)), nil
+}
+
+func newTokenAuthenticator(opts AuthOptions) (Authenticator, error) {
+	switch opts.Mode {
+	case "", AuthModeDevelopment:
+		return NewFakeAuthenticator(), nil
+
+	case AuthModeProduction:
+		if len(opts.Audiences) == 0 {
+			return nil, errors.New("production auth requires at least one audience")
+		}
+
+		var keys KeySource
+		switch {
+		case strings.TrimSpace(strings.Join(opts.PublicKeys, "")) != "":
+			static, err := ParsePublicKeys(opts.PublicKeys...)
+			if err != nil {
+				return nil, err
+			}
+			keys = static
+		case opts.KeysURL != "":
+			ttl := opts.KeysTTL
+			if ttl <= 0 {
+				ttl = defaultKeysTTL
+			}
+			keys = NewRemoteKeys(opts.KeysURL, ttl)
+		default:
+			return nil, errors.New("production auth requires public keys or a keys URL")
+		}
+
+		authenticator := NewPASETOAuthenticator(keys, opts.Audiences, opts.MinAuthzVersion).WithIssuer(opts.Issuer)
+		if opts.RevocationsURL != "" {
+			ttl := opts.RevocationsTTL
+			if ttl <= 0 {
+				ttl = defaultRevocationsTTL
+			}
+			authenticator.WithRevocations(NewRemoteRevocations(opts.RevocationsURL, ttl))
+		}
+		return authenticator, nil
+
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", opts.Mode)
+	}
 }
 
+// FakeAuthenticator accepts a fixed set of development tokens.
 type FakeAuthenticator struct {
 	tokens map[string]string
 }
@@ -33,19 +146,613 @@ func NewFakeAuthenticatorWithTokens(tokens map[string]string) *FakeAuthenticator
 	return &FakeAuthenticator{tokens: clone}
 }
 
-func (f *FakeAuthenticator) ValidateToken(token string) (string, error) {
+func (f *FakeAuthenticator) ValidateToken(ctx context.Context, token string) (*auth.TokenClaims, error) {
 	userID, ok := f.tokens[token]
 	if !ok {
-		return "", errors.New("invalid token")
+		return nil, auth.ErrInvalidToken
+	}
+	return &auth.TokenClaims{
+		Subject:   userID,
+		SessionID: "dev-session",
+		Audience:  AuthModeDevelopment,
+		Context:   map[string]string{"type": "global"},
+	}, nil
+}
+
+// KeySource provides the public keys tokens are verified with.
+type KeySource interface {
+	PublicKeys(ctx context.Context) ([]ed25519.PublicKey, error)
+}
+
+// KeyResolver is implemented by key sources that can pick the key named by
+// the kid in a token footer, so tokens are not tried against every key.
+type KeyResolver interface {
+	PublicKey(ctx context.Context, kid string) (ed25519.PublicKey, error)
+}
+
+// ErrUnknownKey is returned when no key matches a token kid.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// StaticKeys is a fixed KeySource, usually loaded from config.
+type StaticKeys []ed25519.PublicKey
+
+func (k StaticKeys) PublicKeys(ctx context.Context) ([]ed25519.PublicKey, error) {
+	return k, nil
+}
+
+// PublicKey matches kid against the PASERK id of each key.
+func (k StaticKeys) PublicKey(ctx context.Context, kid string) (ed25519.PublicKey, error) {
+	for _, key := range k {
+		if auth.PASERKPublicID(key) == kid {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// ParsePublicKeys decodes base64 or k4.public PASERK encoded Ed25519 public
+// keys. Entries may hold several comma separated keys, as set from an
+// environment variable.
+func ParsePublicKeys(encoded ...string) (StaticKeys, error) {
+	keys := make(StaticKeys, 0, len(encoded))
+	for _, entry := range encoded {
+		for _, e := range strings.Split(entry, ",") {
+			if strings.TrimSpace(e) == "" {
+				continue
+			}
+			key, err := decodePublicKey(e)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys")
+	}
+	return keys, nil
+}
+
+// PublicKeySet is the document served by authn at /authn/keys, wrapped in the
+// standard success envelope. Keys are k4.public PASERKs identified by their
+// k4.pid, which is also the kid in token footers.
+type PublicKeySet struct {
+	Keys []PublicKeyInfo `json:"keys"`
+}
+
+// PublicKeyInfo describes a token verification key.
+type PublicKeyInfo struct {
+	ID        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	PublicKey string `json:"public_key"`
+	Status    string `json:"status,omitempty"`
+}
+
+// minKeysRefetch limits refetches triggered by tokens with an unknown kid.
+const minKeysRefetch = 10 * time.Second
+
+// RemoteKeys fetches public keys from authn and caches them by kid for a TTL.
+// A token signed with a kid not in the cache triggers a refetch, so freshly
+// rotated keys are picked up before the TTL ends. If a refresh fails, the
+// last fetched keys keep being used.
+type RemoteKeys struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	flight fetchFlight
+
+	mu        sync.Mutex
+	keys      []ed25519.PublicKey
+	byID      map[string]ed25519.PublicKey
+	fetchedAt time.Time
+}
+
+// NewRemoteKeys creates a KeySource backed by a keys endpoint.
+func NewRemoteKeys(url string, ttl time.Duration) *RemoteKeys {
+	return &RemoteKeys{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
 	}
-	return userID, nil
+}
+
+func (k *RemoteKeys) PublicKeys(ctx context.Context) ([]ed25519.PublicKey, error) {
+	k.mu.Lock()
+	keys, fresh := k.keys, k.keys != nil && time.Since(k.fetchedAt) < k.ttl
+	k.mu.Unlock()
+	if fresh {
+		return keys, nil
+	}
+
+	err := k.refresh(ctx)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys == nil {
+		return nil, err
+	}
+	return k.keys, nil
+}
+
+func (k *RemoteKeys) PublicKey(ctx context.Context, kid string) (ed25519.PublicKey, error) {
+	k.mu.Lock()
+	key, ok := k.byID[kid]
+	fresh := k.keys != nil && time.Since(k.fetchedAt) < k.ttl
+	refetch := !fresh || time.Since(k.fetchedAt) >= minKeysRefetch
+	k.mu.Unlock()
+	if ok && fresh {
+		return key, nil
+	}
+
+	var err error
+	if refetch {
+		err = k.refresh(ctx)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if key, ok := k.byID[kid]; ok {
+		return key, nil
+	}
+	if k.keys == nil {
+		return nil, err
+	}
+	return nil, ErrUnknownKey
+}
+
+// refresh fetches the key set without holding the lock and swaps it in, so
+// cached keys stay readable meanwhile. Concurrent refreshes share one fetch.
+// The cached set is kept if the fetch fails.
+func (k *RemoteKeys) refresh(ctx context.Context) error {
+	return k.flight.do(ctx, func() error {
+		keys, byID, err := k.fetch(ctx)
+		if err != nil {
+			return err
+		}
+
+		k.mu.Lock()
+		k.keys = keys
+		k.byID = byID
+		k.fetchedAt = time.Now()
+		k.mu.Unlock()
+		return nil
+	})
+}
+
+func (k *RemoteKeys) fetch(ctx context.Context) ([]ed25519.PublicKey, map[string]ed25519.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create keys request: %w", err)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot fetch keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("cannot fetch keys: status %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Data PublicKeySet `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, nil, fmt.Errorf("cannot decode keys: %w", err)
+	}
+
+	keys := make([]ed25519.PublicKey, 0, len(envelope.Data.Keys))
+	byID := make(map[string]ed25519.PublicKey, len(envelope.Data.Keys))
+	for _, info := range envelope.Data.Keys {
+		key, err := decodePublicKey(info.PublicKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("key %s: %w", info.ID, err)
+		}
+		keys = append(keys, key)
+
+		kid := info.ID
+		if kid == "" {
+			kid = auth.PASERKPublicID(key)
+		}
+		byID[kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, nil, errors.New("keys endpoint returned no keys")
+	}
+	return keys, byID, nil
+}
+
+// RevocationList is served by authn with the sessions revoked recently
+// enough that their access tokens may not have expired yet.
+type RevocationList struct {
+	SessionIDs []string `json:"session_ids"`
+}
+
+// RevocationChecker reports whether a session was revoked.
+type RevocationChecker interface {
+	Revoked(ctx context.Context, sessionID string) (bool, error)
+}
+
+// RemoteRevocations fetches the revocation list from authn and caches it for
+// a short TTL, which bounds how long a revoked session keeps working. If a
+// refresh fails, the last fetched list keeps being used.
+type RemoteRevocations struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	flight fetchFlight
+
+	mu        sync.Mutex
+	revoked   map[string]struct{}
+	fetchedAt time.Time
+}
+
+// NewRemoteRevocations creates a RevocationChecker backed by a revocations endpoint.
+func NewRemoteRevocations(url string, ttl time.Duration) *RemoteRevocations {
+	return &RemoteRevocations{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (r *RemoteRevocations) Revoked(ctx context.Context, sessionID string) (bool, error) {
+	r.mu.Lock()
+	stale := r.revoked == nil || time.Since(r.fetchedAt) >= r.ttl
+	r.mu.Unlock()
+
+	var err error
+	if stale {
+		err = r.refresh(ctx)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.revoked == nil {
+		return false, err
+	}
+	_, ok := r.revoked[sessionID]
+	return ok, nil
+}
+
+// refresh fetches the list without holding the lock and swaps it in.
+// Concurrent refreshes share one fetch.
+func (r *RemoteRevocations) refresh(ctx context.Context) error {
+	return r.flight.do(ctx, func() error {
+		revoked, err := r.fetch(ctx)
+		if err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		r.revoked = revoked
+		r.fetchedAt = time.Now()
+		r.mu.Unlock()
+		return nil
+	})
+}
+
+func (r *RemoteRevocations) fetch(ctx context.Context) (map[string]struct{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create revocations request: %w", err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch revocations: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch revocations: status %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Data RevocationList `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("cannot decode revocations: %w", err)
+	}
+
+	revoked := make(map[string]struct{}, len(envelope.Data.SessionIDs))
+	for _, id := range envelope.Data.SessionIDs {
+		revoked[id] = struct{}{}
+	}
+	return revoked, nil
+}
+
+// fetchFlight runs one fetch at a time; callers arriving meanwhile wait for
+// it and share its error instead of fetching again.
+type fetchFlight struct {
+	mu   sync.Mutex
+	call *fetchCall
+}
+
+type fetchCall struct {
+	done chan struct{}
+	err  error
+}
+
+func (f *fetchFlight) do(ctx context.Context, fn func() error) error {
+	f.mu.Lock()
+	if call := f.call; call != nil {
+		f.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	call := &fetchCall{done: make(chan struct{})}
+	f.call = call
+	f.mu.Unlock()
+
+	call.err = fn()
+
+	f.mu.Lock()
+	f.call = nil
+	f.mu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// PASETOAuthenticator verifies Ed25519 signed PASETO tokens issued by authn.
+type PASETOAuthenticator struct {
+	keys            KeySource
+	audiences       []string
+	minAuthzVersion int
+	issuer          string
+	revocations     RevocationChecker
+	now             func() time.Time
+}
+
+// NewPASETOAuthenticator creates an authenticator accepting tokens signed by
+// any of the keys and addressed to any of the audiences.
+func NewPASETOAuthenticator(keys KeySource, audiences []string, minAuthzVersion int) *PASETOAuthenticator {
+	return &PASETOAuthenticator{
+		keys:            keys,
+		audiences:       audiences,
+		minAuthzVersion: minAuthzVersion,
+		now:             time.Now,
+	}
+}
+
+// WithRevocations makes the authenticator reject tokens of revoked sessions.
+func (a *PASETOAuthenticator) WithRevocations(revocations RevocationChecker) *PASETOAuthenticator {
+	a.revocations = revocations
+	return a
+}
+
+// WithIssuer makes the authenticator reject tokens not issued by issuer. An
+// empty issuer accepts any.
+func (a *PASETOAuthenticator) WithIssuer(issuer string) *PASETOAuthenticator {
+	a.issuer = issuer
+	return a
+}
+
+// ValidateToken checks signature, required claims, expiry, audience, issuer
+// and authz_ver, and that the session was not revoked when a RevocationChecker is set.
+// Tokens with a kid footer are verified with that key when the key source is a
+// KeyResolver; otherwise every key is tried.
+func (a *PASETOAuthenticator) ValidateToken(ctx context.Context, token string) (*auth.TokenClaims, error) {
+	footer, err := auth.ParseTokenFooter(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims *auth.TokenClaims
+	if resolver, ok := a.keys.(KeyResolver); ok && footer.KeyID != "" {
+		key, err := resolver.PublicKey(ctx, footer.KeyID)
+		if errors.Is(err, ErrUnknownKey) {
+			return nil, fmt.Errorf("%w: %v", auth.ErrInvalidToken, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot load public key: %w", err)
+		}
+		if claims, err = auth.VerifyPASETOTokenWithOptions(token, key, auth.TokenOptions{KeyID: footer.KeyID}); err != nil {
+			return nil, err
+		}
+	} else {
+		keys, err := a.keys.PublicKeys(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load public keys: %w", err)
+		}
+
+		for _, key := range keys {
+			if claims, err = auth.VerifyPASETOToken(token, key); err == nil {
+				break
+			}
+		}
+		if claims == nil {
+			return nil, fmt.Errorf("%w: %v", auth.ErrInvalidToken, err)
+		}
+	}
+
+	now := a.now()
+	var verrs auth.ValidationErrors
+	for _, audience := range a.audiences {
+		if verrs = auth.ValidateTokenForService(*claims, audience, now); len(verrs) == 0 {
+			break
+		}
+	}
+	if len(verrs) == 0 && a.issuer != "" {
+		verrs = auth.ValidateTokenIssuer(*claims, a.issuer)
+	}
+	if len(verrs) == 0 {
+		verrs = auth.ValidateTokenAuthzVersion(*claims, a.minAuthzVersion)
+	}
+	if len(verrs) > 0 {
+		return nil, fmt.Errorf("%w: %v", auth.ErrInvalidToken, verrs)
+	}
+
+	if a.revocations != nil {
+		revoked, err := a.revocations.Revoked(ctx, claims.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot check revocations: %w", err)
+		}
+		if revoked {
+			return nil, fmt.Errorf("%w: session revoked", auth.ErrInvalidToken)
+		}
+	}
+
+	return claims, nil
+}
+
+// APIKeyAuthenticator validates API keys with one authenticator and every
+// other bearer token with another.
+type APIKeyAuthenticator struct {
+	tokens  Authenticator
+	apiKeys Authenticator
+}
+
+// NewAPIKeyAuthenticator creates an authenticator accepting the tokens of
+// tokens and the API keys of apiKeys.
+func NewAPIKeyAuthenticator(tokens, apiKeys Authenticator) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		tokens:  tokens,
+		apiKeys: apiKeys,
+	}
+}
+
+func (a *APIKeyAuthenticator) ValidateToken(ctx context.Context, token string) (*auth.TokenClaims, error) {
+	if auth.IsAPIKey(token) {
+		return a.apiKeys.ValidateToken(ctx, token)
+	}
+	return a.tokens.ValidateToken(ctx, token)
+}
+
+// APIKeyIntrospection is the payload posted to the authn introspection endpoint.
+type APIKeyIntrospection struct {
+	Key string `json:"key"`
+}
+
+// RemoteAPIKeys validates API keys with the authn introspection endpoint and
+// caches the claims of valid keys for a TTL, which bounds how long a revoked
+// key keeps working. Rejected keys are not cached.
+type RemoteAPIKeys struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	claims auth.TokenClaims
+	until  time.Time
+}
+
+// NewRemoteAPIKeys creates an Authenticator for API keys backed by an
+// introspection endpoint.
+func NewRemoteAPIKeys(url string, ttl time.Duration) *RemoteAPIKeys {
+	return &RemoteAPIKeys{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+		now:    time.Now,
+		cache:  make(map[string]cachedAPIKey),
+	}
+}
+
+// ValidateToken returns the claims of the service account of an API key.
+// Keys are cached by their hash, never in the clear.
+func (k *RemoteAPIKeys) ValidateToken(ctx context.Context, token string) (*auth.TokenClaims, error) {
+	if _, _, err := auth.ParseAPIKey(token); err != nil {
+		return nil, fmt.Errorf("%w: %v", auth.ErrInvalidToken, err)
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	id := hex.EncodeToString(sum[:])
+	now := k.now()
+
+	k.mu.Lock()
+	cached, ok := k.cache[id]
+	k.mu.Unlock()
+	if ok && now.Before(cached.until) {
+		claims := cached.claims
+		return &claims, nil
+	}
+
+	claims, err := k.introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	until := now.Add(k.ttl)
+	if claims.ExpiresAt != 0 {
+		expiresAt := time.Unix(claims.ExpiresAt, 0)
+		if !now.Before(expiresAt) {
+			return nil, fmt.Errorf("%w: api key expired", auth.ErrInvalidToken)
+		}
+		if expiresAt.Before(until) {
+			until = expiresAt
+		}
+	}
+
+	k.mu.Lock()
+	for key, entry := range k.cache {
+		if !now.Before(entry.until) {
+			delete(k.cache, key)
+		}
+	}
+	k.cache[id] = cachedAPIKey{claims: *claims, until: until}
+	k.mu.Unlock()
+
+	return claims, nil
+}
+
+func (k *RemoteAPIKeys) introspect(ctx context.Context, key string) (*auth.TokenClaims, error) {
+	body, err := json.Marshal(APIKeyIntrospection{Key: key})
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode introspection request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot introspect api key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, fmt.Errorf("%w: api key rejected", auth.ErrInvalidToken)
+	default:
+		return nil, fmt.Errorf("cannot introspect api key: status %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Data auth.TokenClaims `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("cannot decode introspection: %w", err)
+	}
+	if envelope.Data.Subject == "" {
+		return nil, fmt.Errorf("%w: api key without subject", auth.ErrInvalidToken)
+	}
+
+	return &envelope.Data, nil
 }
 
 type contextKey string
 
-const userIDContextKey contextKey = "core_auth_user_id"
+const claimsContextKey contextKey = "core_auth_claims"
 
-func AuthMiddleware(auth Authenticator, log Logger) func(http.Handler) http.Handler {
+// AuthMiddleware rejects requests without a valid bearer token and stores the
+// token claims in the request context.
+func AuthMiddleware(authn Authenticator, log Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token := extractBearerToken(r)
@@ -55,15 +762,14 @@ func AuthMiddleware(auth Authenticator, log Logger) func(http.Handler) http.Hand
 				return
 			}
 
-			userID, err := auth.ValidateToken(token)
+			claims, err := authn.ValidateToken(r.Context(), token)
 			if err != nil {
-				log.Debug("invalid token", "error", err, "token", token)
+				log.Debug("invalid token", "error", err)
 				Error(w, http.StatusUnauthorized, "unauthorized", "Invalid token")
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), userIDContextKey, userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
 		})
 	}
 }
@@ -82,7 +788,38 @@ func extractBearerToken(r *http.Request) string {
 	return parts[1]
 }
 
+func decodePublicKey(encoded string) (ed25519.PublicKey, error) {
+	encoded = strings.TrimSpace(encoded)
+	if strings.HasPrefix(encoded, auth.PASERKPublicPrefix) {
+		return auth.ParsePASERKPublic(encoded)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size %d", len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// ContextWithClaims returns a context carrying the token claims.
+func ContextWithClaims(ctx context.Context, claims *auth.TokenClaims) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// ClaimsFromContext returns the claims stored by AuthMiddleware.
+func ClaimsFromContext(ctx context.Context) (*auth.TokenClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*auth.TokenClaims)
+	return claims, ok && claims != nil
+}
+
+// GetUserIDFromContext returns the subject of the token claims.
 func GetUserIDFromContext(ctx context.Context) (string, bool) {
-	userID, ok := ctx.Value(userIDContextKey).(string)
-	return userID, ok
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return claims.Subject, true
 }
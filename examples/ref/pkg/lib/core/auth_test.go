@@ -0,0 +1,525 @@
+package core
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+)
+
+func newKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := auth.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+	return pub, priv
+}
+
+func signToken(t *testing.T, priv ed25519.PrivateKey, audience string, ttl time.Duration, authzVersion int) string {
+	t.Helper()
+	claims := auth.CreateTokenClaims("user-1", "session-1", audience, map[string]string{"type": "global"}, ttl, authzVersion)
+	token, err := auth.GeneratePASETOToken(claims, priv)
+	if err != nil {
+		t.Fatalf("GeneratePASETOToken() error = %v", err)
+	}
+	return token
+}
+
+func TestPASETOAuthenticator(t *testing.T) {
+	pub, priv := newKey(t)
+	_, otherPriv := newKey(t)
+	a := NewPASETOAuthenticator(StaticKeys{pub}, []string{"todo", "session"}, 2)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", signToken(t, priv, "todo", time.Hour, 2), false},
+		{"session audience", signToken(t, priv, "session", time.Hour, 3), false},
+		{"other audience", signToken(t, priv, "billing", time.Hour, 2), true},
+		{"expired", signToken(t, priv, "todo", -time.Minute, 2), true},
+		{"outdated authz version", signToken(t, priv, "todo", time.Hour, 1), true},
+		{"unknown key", signToken(t, otherPriv, "todo", time.Hour, 2), true},
+		{"malformed", "v4.public.nope", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := a.ValidateToken(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && claims.Subject != "user-1" {
+				t.Errorf("Subject = %s, want user-1", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestPASETOAuthenticatorIssuer(t *testing.T) {
+	pub, priv := newKey(t)
+	a := NewPASETOAuthenticator(StaticKeys{pub}, []string{"todo"}, 0).WithIssuer("https://authn.example.com")
+
+	sign := func(issuer string) string {
+		claims := auth.CreateTokenClaims("user-1", "session-1", "todo", map[string]string{"type": "global"}, time.Hour, 1)
+		claims.Issuer = issuer
+		token, err := auth.GeneratePASETOToken(claims, priv)
+		if err != nil {
+			t.Fatalf("GeneratePASETOToken() error = %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		issuer  string
+		wantErr bool
+	}{
+		{"expected issuer", "https://authn.example.com", false},
+		{"other issuer", "https://evil.example.com", true},
+		{"no issuer", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.ValidateToken(context.Background(), sign(tt.issuer))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, auth.ErrInvalidToken) {
+				t.Errorf("ValidateToken() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestRemoteKeys(t *testing.T) {
+	pub, priv := newKey(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		RespondSuccess(w, PublicKeySet{Keys: []PublicKeyInfo{
+			{ID: "k1", Algorithm: "EdDSA", PublicKey: base64.StdEncoding.EncodeToString(pub)},
+		}})
+	}))
+	defer srv.Close()
+
+	a, err := NewAuthenticator(AuthOptions{
+		Mode:      AuthModeProduction,
+		Audiences: []string{"todo"},
+		KeysURL:   srv.URL,
+		KeysTTL:   time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+
+	token := signToken(t, priv, "todo", time.Hour, 1)
+	for i := 0; i < 2; i++ {
+		if _, err := a.ValidateToken(context.Background(), token); err != nil {
+			t.Fatalf("ValidateToken() error = %v", err)
+		}
+	}
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("keys fetched %d times, want 1", got)
+	}
+}
+
+func signTokenWithKeyID(t *testing.T, priv ed25519.PrivateKey, kid string) string {
+	t.Helper()
+	claims := auth.CreateTokenClaims("user-1", "session-1", "todo", map[string]string{"type": "global"}, time.Hour, 1)
+	token, err := auth.GeneratePASETOTokenWithOptions(claims, priv, auth.TokenOptions{KeyID: kid})
+	if err != nil {
+		t.Fatalf("GeneratePASETOTokenWithOptions() error = %v", err)
+	}
+	return token
+}
+
+func TestRemoteKeysResolveByKeyID(t *testing.T) {
+	oldPub, oldPriv := newKey(t)
+	newPub, newPriv := newKey(t)
+
+	var calls atomic.Int32
+	var rotated atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		info := func(pub ed25519.PublicKey, status string) PublicKeyInfo {
+			return PublicKeyInfo{ID: auth.PASERKPublicID(pub), Algorithm: "v4.public", PublicKey: auth.PASERKPublic(pub), Status: status}
+		}
+		keys := []PublicKeyInfo{info(oldPub, "active")}
+		if rotated.Load() {
+			keys = []PublicKeyInfo{info(newPub, "active"), info(oldPub, "verifying")}
+		}
+		RespondSuccess(w, PublicKeySet{Keys: keys})
+	}))
+	defer srv.Close()
+
+	keys := NewRemoteKeys(srv.URL, time.Hour)
+	a := NewPASETOAuthenticator(keys, []string{"todo"}, 0)
+	ctx := context.Background()
+
+	if _, err := a.ValidateToken(ctx, signTokenWithKeyID(t, oldPriv, auth.PASERKPublicID(oldPub))); err != nil {
+		t.Fatalf("ValidateToken() with current kid error = %v", err)
+	}
+
+	// A token signed with the wrong key for its kid is rejected.
+	if _, err := a.ValidateToken(ctx, signTokenWithKeyID(t, newPriv, auth.PASERKPublicID(oldPub))); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("ValidateToken() with mismatched kid error = %v, want ErrInvalidToken", err)
+	}
+
+	// A new kid triggers a refetch once the minimum refetch interval passed.
+	rotated.Store(true)
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-minKeysRefetch)
+	keys.mu.Unlock()
+
+	if _, err := a.ValidateToken(ctx, signTokenWithKeyID(t, newPriv, auth.PASERKPublicID(newPub))); err != nil {
+		t.Fatalf("ValidateToken() with rotated kid error = %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("keys fetched %d times, want 2", got)
+	}
+
+	// Unknown kids do not refetch again within the interval.
+	_, strayPriv := newKey(t)
+	if _, err := a.ValidateToken(ctx, signTokenWithKeyID(t, strayPriv, "k4.pid.unknown")); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("ValidateToken() with unknown kid error = %v, want ErrInvalidToken", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("keys fetched %d times after unknown kid, want 2", got)
+	}
+}
+
+func TestRemoteKeysRefreshOutsideLock(t *testing.T) {
+	pub, _ := newKey(t)
+	kid := auth.PASERKPublicID(pub)
+
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 2 {
+			close(started)
+			<-release
+		}
+		RespondSuccess(w, PublicKeySet{Keys: []PublicKeyInfo{
+			{ID: kid, Algorithm: "v4.public", PublicKey: auth.PASERKPublic(pub)},
+		}})
+	}))
+	defer srv.Close()
+
+	keys := NewRemoteKeys(srv.URL, time.Hour)
+	ctx := context.Background()
+	if _, err := keys.PublicKey(ctx, kid); err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-minKeysRefetch)
+	keys.mu.Unlock()
+
+	// Unknown kids refetch once, however many arrive while it runs.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := keys.PublicKey(ctx, "k4.pid.unknown"); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("PublicKey() with unknown kid error = %v, want ErrUnknownKey", err)
+			}
+		}()
+	}
+	<-started
+
+	// Known keys are served from the cache while the fetch is in flight.
+	done := make(chan error, 1)
+	go func() {
+		_, err := keys.PublicKey(ctx, kid)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("PublicKey() during refresh error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("PublicKey() blocked by the refresh in flight")
+	}
+
+	close(release)
+	wg.Wait()
+	if got := calls.Load(); got != 2 {
+		t.Errorf("keys fetched %d times, want 2", got)
+	}
+}
+
+func TestStaticKeysResolveByKeyID(t *testing.T) {
+	pub, priv := newKey(t)
+	keys, err := ParsePublicKeys(auth.PASERKPublic(pub))
+	if err != nil {
+		t.Fatalf("ParsePublicKeys() error = %v", err)
+	}
+
+	a := NewPASETOAuthenticator(keys, []string{"todo"}, 0)
+	if _, err := a.ValidateToken(context.Background(), signTokenWithKeyID(t, priv, auth.PASERKPublicID(pub))); err != nil {
+		t.Errorf("ValidateToken() error = %v", err)
+	}
+}
+
+func TestRemoteRevocations(t *testing.T) {
+	pub, priv := newKey(t)
+	keys := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondSuccess(w, PublicKeySet{Keys: []PublicKeyInfo{
+			{ID: "k1", Algorithm: "v4.public", PublicKey: auth.PASERKPublic(pub)},
+		}})
+	}))
+	defer keys.Close()
+
+	var calls atomic.Int32
+	var revoked, failing atomic.Bool
+	revocations := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		list := RevocationList{SessionIDs: []string{}}
+		if revoked.Load() {
+			list.SessionIDs = append(list.SessionIDs, "session-1")
+		}
+		RespondSuccess(w, list)
+	}))
+	defer revocations.Close()
+
+	a, err := NewAuthenticator(AuthOptions{
+		Mode:           AuthModeProduction,
+		Audiences:      []string{"todo"},
+		KeysURL:        keys.URL,
+		RevocationsURL: revocations.URL,
+		RevocationsTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+	checker := a.(*PASETOAuthenticator).revocations.(*RemoteRevocations)
+
+	ctx := context.Background()
+	token := signToken(t, priv, "todo", time.Hour, 1)
+	if _, err := a.ValidateToken(ctx, token); err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+
+	// The list is cached until the TTL ends.
+	revoked.Store(true)
+	if _, err := a.ValidateToken(ctx, token); err != nil {
+		t.Fatalf("ValidateToken() with cached list error = %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("revocations fetched %d times, want 1", got)
+	}
+
+	checker.fetchedAt = time.Time{}
+	if _, err := a.ValidateToken(ctx, token); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("ValidateToken() of revoked session error = %v, want ErrInvalidToken", err)
+	}
+
+	// A failed refresh keeps the last list.
+	failing.Store(true)
+	checker.fetchedAt = time.Time{}
+	if _, err := a.ValidateToken(ctx, token); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("ValidateToken() with stale list error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRemoteRevocationsShareFetch(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		RespondSuccess(w, RevocationList{SessionIDs: []string{"session-1"}})
+	}))
+	defer srv.Close()
+
+	checker := NewRemoteRevocations(srv.URL, time.Hour)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if revoked, err := checker.Revoked(ctx, "session-1"); err != nil || !revoked {
+				t.Errorf("Revoked() = %v, %v, want true", revoked, err)
+			}
+		}()
+	}
+
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("revocations fetched %d times, want 1", got)
+	}
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	pub, _ := newKey(t)
+
+	tests := []struct {
+		name     string
+		opts     AuthOptions
+		wantFake bool
+		wantErr  bool
+	}{
+		{"development", AuthOptions{Mode: AuthModeDevelopment}, true, false},
+		{"default", AuthOptions{}, true, false},
+		{"production with keys", AuthOptions{Mode: AuthModeProduction, Audiences: []string{"todo"}, PublicKeys: []string{base64.StdEncoding.EncodeToString(pub)}}, false, false},
+		{"production without keys", AuthOptions{Mode: AuthModeProduction, Audiences: []string{"todo"}}, false, true},
+		{"production with bad key", AuthOptions{Mode: AuthModeProduction, Audiences: []string{"todo"}, PublicKeys: []string{"bm9wZQ=="}}, false, true},
+		{"unknown mode", AuthOptions{Mode: "staging"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAuthenticator(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, fake := a.(*FakeAuthenticator); err == nil && fake != tt.wantFake {
+				t.Errorf("NewAuthenticator() = %T, want fake %v", a, tt.wantFake)
+			}
+		})
+	}
+}
+
+func TestRemoteAPIKeys(t *testing.T) {
+	key, _, _ := auth.GenerateAPIKey()
+
+	var calls atomic.Int32
+	var revoked atomic.Bool
+	introspection := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req APIKeyIntrospection
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Key != key || revoked.Load() {
+			Error(w, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+			return
+		}
+		RespondSuccess(w, auth.TokenClaims{Subject: "service-1", SubjectType: auth.SubjectTypeServiceAccount, Scopes: []string{"lists:read"}})
+	}))
+	defer introspection.Close()
+
+	a, err := NewAuthenticator(AuthOptions{
+		Mode:       AuthModeDevelopment,
+		APIKeysURL: introspection.URL,
+		APIKeysTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+	apiKeys := a.(*APIKeyAuthenticator).apiKeys.(*RemoteAPIKeys)
+
+	ctx := context.Background()
+	claims, err := a.ValidateToken(ctx, key)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if claims.Subject != "service-1" || claims.SubjectType != auth.SubjectTypeServiceAccount || len(claims.Scopes) != 1 {
+		t.Errorf("ValidateToken() = %+v, want the service account claims", claims)
+	}
+
+	if claims, err := a.ValidateToken(ctx, "dev-user"); err != nil || claims.Subject != "user-456" {
+		t.Errorf("ValidateToken() of a development token = %v, %v", claims, err)
+	}
+
+	// Valid keys are cached until the TTL ends.
+	revoked.Store(true)
+	if _, err := a.ValidateToken(ctx, key); err != nil {
+		t.Fatalf("ValidateToken() with cached key error = %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("introspection called %d times, want 1", got)
+	}
+
+	apiKeys.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := a.ValidateToken(ctx, key); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("ValidateToken() of a revoked key error = %v, want ErrInvalidToken", err)
+	}
+
+	if _, err := a.ValidateToken(ctx, "hmk_malformed"); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Errorf("ValidateToken() of a malformed key error = %v, want ErrInvalidToken", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("introspection called %d times, want 2 (malformed keys are not sent)", got)
+	}
+}
+
+type pingHandler struct{}
+
+func (pingHandler) RegisterRoutes(r chi.Router) {
+	r.Route("/lists", func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(claims.Subject))
+		})
+	})
+}
+
+func TestAuthMiddlewareWithSetup(t *testing.T) {
+	r := chi.NewRouter()
+	requireAuth := AuthMiddleware(NewFakeAuthenticator(), NewLogger("error"))
+	Setup(context.Background(), r, WithMiddlewares(pingHandler{}, requireAuth), NewHealth())
+
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{"missing token", "/lists", "", http.StatusUnauthorized, ""},
+		{"invalid token", "/lists", "nope", http.StatusUnauthorized, ""},
+		{"valid token", "/lists", "dev-user", http.StatusOK, "user-456"},
+		{"public route", "/livez", "", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("GET %s = %d, want %d", tt.path, rr.Code, tt.wantCode)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,472 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+)
+
+// Authz endpoints used by HTTPAuthzClient.
+const (
+	PolicyEvaluatePath      = "/authz/policy/evaluate"
+	PolicyEvaluateBatchPath = "/authz/policy/evaluate/batch"
+	PolicyVersionPath       = "/authz/policy/version"
+)
+
+// Reason codes of the 403 responses written by Authorizer.
+const (
+	ReasonUnauthenticated  = "unauthenticated"
+	ReasonPermissionDenied = "permission_denied"
+	ReasonAuthzUnavailable = "authz_unavailable"
+)
+
+const (
+	defaultAuthzCacheTTL = time.Minute
+	defaultAuthzTimeout  = 2 * time.Second
+)
+
+// AuthzOptions configures the Authorizer built by NewAuthorizer.
+type AuthzOptions struct {
+	// Mode is development (FakeAuthzClient) or production (authz service).
+	Mode string
+	// URL is the base URL of the authz service.
+	URL string
+	// CacheTTL is how long permission checks are cached. Defaults to 1 minute.
+	CacheTTL time.Duration
+	// Timeout of each call to authz. Defaults to 2 seconds.
+	Timeout time.Duration
+	// PollInterval is how often the authz policy version is checked; the
+	// cache is cleared when it changes. Zero disables polling.
+	PollInterval time.Duration
+	// Client replaces the client selected by Mode.
+	Client auth.AuthzClient
+}
+
+// NewAuthzClient returns a FakeAuthzClient in development mode and an
+// HTTPAuthzClient in production mode.
+func NewAuthzClient(opts AuthzOptions) (auth.AuthzClient, error) {
+	switch opts.Mode {
+	case "", AuthModeDevelopment:
+		return NewFakeAuthzClient(), nil
+
+	case AuthModeProduction:
+		if opts.URL == "" {
+			return nil, errors.New("production auth requires the authz service URL")
+		}
+		return NewHTTPAuthzClient(opts.URL, opts.Timeout), nil
+
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", opts.Mode)
+	}
+}
+
+// FakeAuthzClient grants permissions to the users of FakeAuthenticator.
+// Grants are matched as authz matches them (see auth.PermissionMatches).
+type FakeAuthzClient struct {
+	grants map[string][]string
+}
+
+func NewFakeAuthzClient() *FakeAuthzClient {
+	return NewFakeAuthzClientWithGrants(map[string][]string{
+		"user-admin-123":  {"*"},
+		"user-456":        {"*:read", "*:write"},
+		"user-viewer-789": {"*:read"},
+	})
+}
+
+func NewFakeAuthzClientWithGrants(grants map[string][]string) *FakeAuthzClient {
+	return &FakeAuthzClient{grants: grants}
+}
+
+func (f *FakeAuthzClient) CheckPermission(ctx context.Context, userID, permission, resource string) (bool, error) {
+	for _, grant := range f.grants[userID] {
+		if auth.PermissionMatches(grant, permission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PolicyVersionSource reports the authz policy version, which changes when
+// grants or roles change.
+type PolicyVersionSource interface {
+	PolicyVersion(ctx context.Context) (int64, error)
+}
+
+// HTTPAuthzClient evaluates permissions with the authz service. It keeps
+// connections to authz alive between calls.
+type HTTPAuthzClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPAuthzClient creates a client for the authz service at baseURL.
+// A zero timeout uses the 2 seconds default.
+func NewHTTPAuthzClient(baseURL string, timeout time.Duration) *HTTPAuthzClient {
+	if timeout <= 0 {
+		timeout = defaultAuthzTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 32
+
+	return &HTTPAuthzClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout, Transport: transport},
+	}
+}
+
+type authzScope struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type authzEvaluateRequest struct {
+	UserID     string     `json:"user_id"`
+	Permission string     `json:"permission"`
+	Scope      authzScope `json:"scope"`
+}
+
+type authzCheck struct {
+	Permission string     `json:"permission"`
+	Scope      authzScope `json:"scope"`
+}
+
+type authzBatchRequest struct {
+	UserID string       `json:"user_id"`
+	Checks []authzCheck `json:"checks"`
+}
+
+// CheckPermission asks authz whether the user holds permission on resource,
+// written as <scope type>:<id> (see ScopeResource). An empty resource is the
+// global scope.
+func (c *HTTPAuthzClient) CheckPermission(ctx context.Context, userID, permission, resource string) (bool, error) {
+	req := authzEvaluateRequest{UserID: userID, Permission: permission, Scope: resourceScope(resource)}
+
+	var result struct {
+		Allowed bool `json:"allowed"`
+	}
+	if err := c.do(ctx, http.MethodPost, PolicyEvaluatePath, req, &result); err != nil {
+		return false, fmt.Errorf("cannot evaluate permission: %w", err)
+	}
+	return result.Allowed, nil
+}
+
+// CheckPermissions evaluates several checks in one call. Results follow the
+// order of checks.
+func (c *HTTPAuthzClient) CheckPermissions(ctx context.Context, userID string, checks []auth.PermissionCheck) ([]bool, error) {
+	req := authzBatchRequest{UserID: userID, Checks: make([]authzCheck, len(checks))}
+	for i, check := range checks {
+		req.Checks[i] = authzCheck{Permission: check.Permission, Scope: resourceScope(check.Resource)}
+	}
+
+	var result struct {
+		Results []struct {
+			Allowed bool `json:"allowed"`
+		} `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodPost, PolicyEvaluateBatchPath, req, &result); err != nil {
+		return nil, fmt.Errorf("cannot evaluate permissions: %w", err)
+	}
+	if len(result.Results) != len(checks) {
+		return nil, fmt.Errorf("cannot evaluate permissions: got %d results for %d checks", len(result.Results), len(checks))
+	}
+
+	allowed := make([]bool, len(checks))
+	for i, r := range result.Results {
+		allowed[i] = r.Allowed
+	}
+	return allowed, nil
+}
+
+// PolicyVersion returns the current authz policy version.
+func (c *HTTPAuthzClient) PolicyVersion(ctx context.Context) (int64, error) {
+	var result struct {
+		Version int64 `json:"version"`
+	}
+	if err := c.do(ctx, http.MethodGet, PolicyVersionPath, nil, &result); err != nil {
+		return 0, fmt.Errorf("cannot get policy version: %w", err)
+	}
+	return result.Version, nil
+}
+
+// do sends a JSON request and decodes the data of the success envelope.
+func (c *HTTPAuthzClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("cannot encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Drain so the connection can be reused.
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	envelope := struct {
+		Data any `json:"data"`
+	}{Data: out}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("cannot decode response: %w", err)
+	}
+	return nil
+}
+
+func resourceScope(resource string) authzScope {
+	if resource == "" {
+		return authzScope{Type: "global"}
+	}
+	var scope authzScope
+	scope.Type, scope.ID, _ = strings.Cut(resource, ":")
+	return scope
+}
+
+// ScopeResource returns the resource string of an authz scope.
+func ScopeResource(scopeType, id string) string {
+	return scopeType + ":" + id
+}
+
+// Authorizer checks the permissions listed in the route metadata of a service
+// before its handlers run. Routes without permissions are not checked.
+type Authorizer struct {
+	helper       *auth.AuthzHelper
+	client       auth.AuthzClient
+	routes       []routePermissions
+	log          Logger
+	pollInterval time.Duration
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+type routePermissions struct {
+	method      string
+	segments    []string
+	permissions []string
+	scopeType   string
+}
+
+// NewAuthorizer creates an Authorizer for the JSON route metadata generated for
+// the service (a list of RouteInfo).
+func NewAuthorizer(opts AuthzOptions, meta []byte, log Logger) (*Authorizer, error) {
+	client := opts.Client
+	if client == nil {
+		var err error
+		if client, err = NewAuthzClient(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	ttl := opts.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultAuthzCacheTTL
+	}
+
+	a := &Authorizer{
+		helper:       auth.NewAuthzHelper(client, ttl),
+		client:       client,
+		log:          log,
+		pollInterval: opts.PollInterval,
+	}
+	if len(meta) == 0 {
+		return a, nil
+	}
+
+	var routes []RouteInfo
+	if err := json.Unmarshal(meta, &routes); err != nil {
+		return nil, fmt.Errorf("cannot parse route metadata: %w", err)
+	}
+	for _, r := range routes {
+		if len(r.Permissions) == 0 {
+			continue
+		}
+		a.routes = append(a.routes, routePermissions{
+			method:      strings.ToUpper(r.Method),
+			segments:    pathSegments(r.Path),
+			permissions: r.Permissions,
+			scopeType:   r.ScopeType,
+		})
+	}
+	return a, nil
+}
+
+// Helper returns the cached authz helper, e.g. to clear a user cache after
+// their grants change.
+func (a *Authorizer) Helper() *auth.AuthzHelper {
+	return a.helper
+}
+
+// Start polls the authz policy version when PollInterval is set and the
+// client can report it.
+func (a *Authorizer) Start(ctx context.Context) error {
+	source, ok := a.client.(PolicyVersionSource)
+	if !ok || a.pollInterval <= 0 {
+		return nil
+	}
+
+	// The first version is read now so changes from here on are noticed.
+	last, err := a.pollPolicyVersion(source)
+	if err != nil {
+		a.log.Debug("cannot poll policy version", "error", err)
+	}
+
+	a.stop, a.done = make(chan struct{}), make(chan struct{})
+	go a.watchPolicyVersion(source, last)
+	return nil
+}
+
+// Stop ends the policy version polling.
+func (a *Authorizer) Stop(ctx context.Context) error {
+	if a.stop == nil {
+		return nil
+	}
+	close(a.stop)
+	<-a.done
+	a.stop = nil
+	return nil
+}
+
+// watchPolicyVersion clears the permission cache when the version changes.
+// Failed polls keep the cache; entries still expire with the cache TTL.
+func (a *Authorizer) watchPolicyVersion(source PolicyVersionSource, last int64) {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+
+		version, err := a.pollPolicyVersion(source)
+		switch {
+		case err != nil:
+			a.log.Debug("cannot poll policy version", "error", err)
+		case last != 0 && version != last:
+			a.log.Info("authz policy changed, clearing permission cache", "version", version)
+			a.helper.ClearCache()
+			last = version
+		default:
+			last = version
+		}
+	}
+}
+
+func (a *Authorizer) pollPolicyVersion(source PolicyVersionSource) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.pollInterval)
+	defer cancel()
+	return source.PolicyVersion(ctx)
+}
+
+// Middleware must run after AuthMiddleware, which provides the user.
+func (a *Authorizer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params, ok := a.match(r.Method, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok || claims.Subject == "" {
+			Error(w, http.StatusForbidden, ReasonUnauthenticated, "No authenticated user")
+			return
+		}
+		userID := claims.Subject
+
+		// authn issues tokens with the authz policy version as authz_ver.
+		if a.helper.ObserveAuthzVersion(userID, claims.AuthzVersion) {
+			a.log.Debug("authz version changed, permission cache cleared", "user_id", userID)
+		}
+
+		// API keys may be limited to some of the permissions of their account.
+		for _, permission := range route.permissions {
+			if !auth.TokenAllowsPermission(*claims, permission) {
+				a.log.Debug("permission outside token scopes", "user_id", userID, "permission", permission)
+				Error(w, http.StatusForbidden, ReasonPermissionDenied, fmt.Sprintf("Missing permission %s", permission))
+				return
+			}
+		}
+
+		var resource string
+		if route.scopeType != "" && len(params) > 0 {
+			resource = ScopeResource(route.scopeType, params[0])
+		}
+
+		checks := make([]auth.PermissionCheck, len(route.permissions))
+		for i, permission := range route.permissions {
+			checks[i] = auth.PermissionCheck{Permission: permission, Resource: resource}
+		}
+
+		results, err := a.helper.CheckMultiplePermissions(r.Context(), userID, checks)
+		if err != nil {
+			a.log.Error("cannot check permissions", "error", err, "user_id", userID, "permissions", route.permissions)
+			Error(w, http.StatusForbidden, ReasonAuthzUnavailable, "Cannot check permissions")
+			return
+		}
+
+		for _, check := range checks {
+			if !results[check.Permission+":"+check.Resource] {
+				a.log.Debug("permission denied", "user_id", userID, "permission", check.Permission, "resource", resource)
+				Error(w, http.StatusForbidden, ReasonPermissionDenied, fmt.Sprintf("Missing permission %s", check.Permission))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// match finds the route of a request and returns its path parameter values.
+// Routes with fewer parameters win, so /lists/new is preferred to /lists/{id}.
+func (a *Authorizer) match(method, path string) (routePermissions, []string, bool) {
+	segments := pathSegments(path)
+	var (
+		best       routePermissions
+		bestParams []string
+		found      bool
+	)
+	for _, route := range a.routes {
+		if route.method != method || len(route.segments) != len(segments) || !matchSegments(route.segments, segments) {
+			continue
+		}
+		var params []string
+		for i, s := range route.segments {
+			if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+				params = append(params, segments[i])
+			}
+		}
+		if !found || len(params) < len(bestParams) {
+			best, bestParams, found = route, params, true
+		}
+	}
+	return best, bestParams, found
+}
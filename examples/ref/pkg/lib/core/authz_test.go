@@ -0,0 +1,362 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+)
+
+const authzTestRoutes = `[
+  {"method": "GET", "path": "/lists", "auth": true, "permissions": ["lists:read"]},
+  {"method": "GET", "path": "/lists/{id}", "auth": true, "permissions": ["lists:read"], "scope_type": "list"},
+  {"method": "PUT", "path": "/lists/{id}", "auth": true, "permissions": ["lists:write", "todos:write"], "scope_type": "list"},
+  {"method": "GET", "path": "/lists/archived", "auth": true, "permissions": ["lists:manage"]},
+  {"method": "GET", "path": "/status", "auth": false}
+]`
+
+type recordingAuthzClient struct {
+	calls     atomic.Int32
+	resources []string
+	allow     func(permission, resource string) bool
+}
+
+func (c *recordingAuthzClient) CheckPermission(ctx context.Context, userID, permission, resource string) (bool, error) {
+	c.calls.Add(1)
+	c.resources = append(c.resources, resource)
+	return c.allow(permission, resource), nil
+}
+
+func authorize(t *testing.T, a *Authorizer, method, path, userID string) *httptest.ResponseRecorder {
+	t.Helper()
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(method, path, nil)
+	if userID != "" {
+		req = req.WithContext(ContextWithClaims(req.Context(), &auth.TokenClaims{Subject: userID}))
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func errorCode(t *testing.T, rr *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("cannot decode error response: %v", err)
+	}
+	return resp.Error.Code
+}
+
+func TestAuthorizerMiddleware(t *testing.T) {
+	client := &recordingAuthzClient{allow: func(permission, resource string) bool {
+		return permission == "lists:read" || (permission == "lists:write" && resource == "list:42")
+	}}
+	a, err := NewAuthorizer(AuthzOptions{Client: client}, []byte(authzTestRoutes), NewLogger("error"))
+	if err != nil {
+		t.Fatalf("NewAuthorizer() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		userID   string
+		want     int
+		wantCode string
+	}{
+		{"allowed", http.MethodGet, "/lists/42", "user-1", http.StatusOK, ""},
+		{"no user", http.MethodGet, "/lists", "", http.StatusForbidden, ReasonUnauthenticated},
+		{"missing required scope", http.MethodPut, "/lists/42", "user-1", http.StatusForbidden, ReasonPermissionDenied},
+		{"literal route wins", http.MethodGet, "/lists/archived", "user-1", http.StatusForbidden, ReasonPermissionDenied},
+		{"route without permissions", http.MethodGet, "/status", "", http.StatusOK, ""},
+		{"unknown route", http.MethodDelete, "/lists/42", "", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := authorize(t, a, tt.method, tt.path, tt.userID)
+			if rr.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d", tt.method, tt.path, rr.Code, tt.want)
+			}
+			if tt.wantCode != "" {
+				if code := errorCode(t, rr); code != tt.wantCode {
+					t.Errorf("error code = %q, want %q", code, tt.wantCode)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizerScopeAndCache(t *testing.T) {
+	client := &recordingAuthzClient{allow: func(string, string) bool { return true }}
+	a, err := NewAuthorizer(AuthzOptions{Client: client}, []byte(authzTestRoutes), NewLogger("error"))
+	if err != nil {
+		t.Fatalf("NewAuthorizer() error = %v", err)
+	}
+
+	authorize(t, a, http.MethodGet, "/lists/42", "user-1")
+	authorize(t, a, http.MethodGet, "/lists/42", "user-1")
+	authorize(t, a, http.MethodGet, "/lists", "user-1")
+
+	if got := client.calls.Load(); got != 2 {
+		t.Errorf("authz calls = %d, want 2 (second check cached)", got)
+	}
+	if len(client.resources) != 2 || client.resources[0] != "list:42" || client.resources[1] != "" {
+		t.Errorf("resources = %q, want [list:42 \"\"]", client.resources)
+	}
+}
+
+func TestAuthorizerTokenScopes(t *testing.T) {
+	client := &recordingAuthzClient{allow: func(string, string) bool { return true }}
+	a, err := NewAuthorizer(AuthzOptions{Client: client}, []byte(authzTestRoutes), NewLogger("error"))
+	if err != nil {
+		t.Fatalf("NewAuthorizer() error = %v", err)
+	}
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	claims := &auth.TokenClaims{Subject: "service-1", SubjectType: auth.SubjectTypeServiceAccount, Scopes: []string{"lists:read", "lists:write"}}
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/lists/42", http.StatusOK},
+		{http.MethodPut, "/lists/42", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req = req.WithContext(ContextWithClaims(req.Context(), claims))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rr.Code, tt.want)
+		}
+	}
+
+	if got := client.calls.Load(); got != 1 {
+		t.Errorf("authz calls = %d, want 1 (out of scope checks skip authz)", got)
+	}
+}
+
+func TestHTTPAuthzClient(t *testing.T) {
+	var got authzEvaluateRequest
+	var gotBatch authzBatchRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == PolicyEvaluatePath:
+			json.NewDecoder(r.Body).Decode(&got)
+			json.NewEncoder(w).Encode(SuccessResponse{Data: map[string]any{"allowed": got.Permission == "lists:read"}})
+		case r.Method == http.MethodPost && r.URL.Path == PolicyEvaluateBatchPath:
+			json.NewDecoder(r.Body).Decode(&gotBatch)
+			results := make([]map[string]any, len(gotBatch.Checks))
+			for i, c := range gotBatch.Checks {
+				results[i] = map[string]any{"allowed": c.Permission == "lists:read"}
+			}
+			json.NewEncoder(w).Encode(SuccessResponse{Data: map[string]any{"results": results}})
+		case r.Method == http.MethodGet && r.URL.Path == PolicyVersionPath:
+			json.NewEncoder(w).Encode(SuccessResponse{Data: map[string]any{"version": 7}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewHTTPAuthzClient(srv.URL+"/", 0)
+	ctx := context.Background()
+
+	allowed, err := client.CheckPermission(ctx, "user-1", "lists:read", ScopeResource("list", "42"))
+	if err != nil || !allowed {
+		t.Fatalf("CheckPermission() = %v, %v, want allowed", allowed, err)
+	}
+	if got.UserID != "user-1" || got.Scope.Type != "list" || got.Scope.ID != "42" {
+		t.Errorf("request = %+v, want user-1 on list 42", got)
+	}
+
+	allowed, err = client.CheckPermission(ctx, "user-1", "lists:write", "")
+	if err != nil || allowed {
+		t.Fatalf("CheckPermission() = %v, %v, want denied", allowed, err)
+	}
+	if got.Scope.Type != "global" {
+		t.Errorf("scope type = %q, want global", got.Scope.Type)
+	}
+
+	results, err := client.CheckPermissions(ctx, "user-1", []auth.PermissionCheck{
+		{Permission: "lists:write", Resource: ScopeResource("list", "42")},
+		{Permission: "lists:read"},
+	})
+	if err != nil || len(results) != 2 || results[0] || !results[1] {
+		t.Fatalf("CheckPermissions() = %v, %v, want [false true]", results, err)
+	}
+	if len(gotBatch.Checks) != 2 || gotBatch.Checks[0].Scope.ID != "42" || gotBatch.Checks[1].Scope.Type != "global" {
+		t.Errorf("batch request = %+v, want list 42 and global checks", gotBatch)
+	}
+
+	if version, err := client.PolicyVersion(ctx); err != nil || version != 7 {
+		t.Errorf("PolicyVersion() = %d, %v, want 7", version, err)
+	}
+
+	srv.Close()
+	if _, err := client.CheckPermission(ctx, "user-1", "lists:read", ""); err == nil {
+		t.Error("CheckPermission() with authz down error = nil, want error")
+	}
+}
+
+// TestAuthorizerGrants runs generated route permissions through
+// HTTPAuthzClient against an authz server matching grants as authz does.
+func TestAuthorizerGrants(t *testing.T) {
+	grants := map[string][]string{
+		"editor": {"lists:*", "todos:write"},
+		"reader": {"*:read"},
+		"viewer": {"lists:read"},
+		"legacy": {"read:lists", "write:lists"},
+	}
+	allowed := func(userID, permission string) bool {
+		for _, grant := range grants[userID] {
+			if auth.PermissionImplies(grant, permission) {
+				return true
+			}
+		}
+		return false
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case PolicyEvaluatePath:
+			var req authzEvaluateRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(SuccessResponse{Data: map[string]any{"allowed": allowed(req.UserID, req.Permission)}})
+		case PolicyEvaluateBatchPath:
+			var req authzBatchRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			results := make([]map[string]any, len(req.Checks))
+			for i, c := range req.Checks {
+				results[i] = map[string]any{"allowed": allowed(req.UserID, c.Permission)}
+			}
+			json.NewEncoder(w).Encode(SuccessResponse{Data: map[string]any{"results": results}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	a, err := NewAuthorizer(AuthzOptions{Client: NewHTTPAuthzClient(srv.URL, 0)}, []byte(authzTestRoutes), NewLogger("error"))
+	if err != nil {
+		t.Fatalf("NewAuthorizer() error = %v", err)
+	}
+
+	tests := []struct {
+		userID string
+		method string
+		path   string
+		want   int
+	}{
+		{"editor", http.MethodGet, "/lists", http.StatusOK},
+		{"editor", http.MethodPut, "/lists/42", http.StatusOK},
+		{"reader", http.MethodGet, "/lists/42", http.StatusOK},
+		{"reader", http.MethodPut, "/lists/42", http.StatusForbidden},
+		{"viewer", http.MethodGet, "/lists/42", http.StatusOK},
+		{"viewer", http.MethodGet, "/lists/archived", http.StatusForbidden},
+		{"editor", http.MethodGet, "/lists/archived", http.StatusOK},
+		{"legacy", http.MethodGet, "/lists", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		if rr := authorize(t, a, tt.method, tt.path, tt.userID); rr.Code != tt.want {
+			t.Errorf("%s %s by %s = %d, want %d", tt.method, tt.path, tt.userID, rr.Code, tt.want)
+		}
+	}
+}
+
+type versionedAuthzClient struct {
+	recordingAuthzClient
+	version atomic.Int64
+}
+
+func (c *versionedAuthzClient) PolicyVersion(ctx context.Context) (int64, error) {
+	return c.version.Load(), nil
+}
+
+func TestAuthorizerCacheInvalidation(t *testing.T) {
+	client := &versionedAuthzClient{recordingAuthzClient: recordingAuthzClient{allow: func(string, string) bool { return true }}}
+	client.version.Store(1)
+
+	a, err := NewAuthorizer(AuthzOptions{Client: client, PollInterval: 5 * time.Millisecond}, []byte(authzTestRoutes), NewLogger("error"))
+	if err != nil {
+		t.Fatalf("NewAuthorizer() error = %v", err)
+	}
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer a.Stop(context.Background())
+
+	request := func(authzVersion int) {
+		h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest(http.MethodGet, "/lists", nil)
+		req = req.WithContext(ContextWithClaims(req.Context(), &auth.TokenClaims{Subject: "user-1", AuthzVersion: authzVersion}))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	request(1)
+	request(1)
+	if got := client.calls.Load(); got != 1 {
+		t.Fatalf("authz calls = %d, want 1", got)
+	}
+
+	// A token with a newer authz_ver drops the user cache.
+	request(2)
+	if got := client.calls.Load(); got != 2 {
+		t.Fatalf("authz calls after authz_ver change = %d, want 2", got)
+	}
+
+	// A policy version change drops the whole cache.
+	client.version.Store(2)
+	deadline := time.Now().Add(time.Second)
+	for client.calls.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		request(2)
+	}
+	if got := client.calls.Load(); got != 3 {
+		t.Errorf("authz calls after policy change = %d, want 3", got)
+	}
+}
+
+func TestFakeAuthzClient(t *testing.T) {
+	client := NewFakeAuthzClient()
+
+	tests := []struct {
+		userID     string
+		permission string
+		want       bool
+	}{
+		{"user-admin-123", "lists:manage", true},
+		{"user-456", "lists:write", true},
+		{"user-456", "lists:manage", false},
+		{"user-viewer-789", "lists:read", true},
+		{"user-viewer-789", "lists:write", false},
+		{"someone", "lists:read", false},
+	}
+
+	for _, tt := range tests {
+		got, _ := client.CheckPermission(context.Background(), tt.userID, tt.permission, "")
+		if got != tt.want {
+			t.Errorf("CheckPermission(%s, %s) = %v, want %v", tt.userID, tt.permission, got, tt.want)
+		}
+	}
+
+	if _, err := NewAuthzClient(AuthzOptions{Mode: AuthModeProduction}); err == nil || !strings.Contains(err.Error(), "URL") {
+		t.Errorf("NewAuthzClient() without URL error = %v, want URL error", err)
+	}
+}
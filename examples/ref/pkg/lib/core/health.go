@@ -0,0 +1,266 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Health statuses reported by /readyz and /healthz.
+const (
+	HealthUp       = "up"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+const (
+	defaultHealthTimeout  = 2 * time.Second
+	defaultHealthCacheTTL = 5 * time.Second
+)
+
+// HealthChecker is implemented by components that can report the state of
+// the dependencies they own (a database, a remote client...).
+// Components passed to Setup that implement it are checked by /healthz.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// HealthNamer lets a HealthChecker choose the name it is reported under.
+type HealthNamer interface {
+	HealthName() string
+}
+
+// HealthItem is the result of a single check.
+type HealthItem struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HealthReport is the aggregated result served by /healthz.
+type HealthReport struct {
+	Status string       `json:"status"`
+	Items  []HealthItem `json:"items,omitempty"`
+}
+
+type healthCheck struct {
+	name     string
+	critical bool
+	checker  HealthChecker
+}
+
+// Health serves the standard health endpoints:
+//
+//	/ping    process responds, always 200
+//	/livez   process is alive and should not be restarted
+//	/readyz  ready to receive traffic, 503 before Start and after Stop
+//	/healthz aggregated dependency health, 503 when degraded or down
+//
+// It is Startable and Stoppable so readiness follows the service lifecycle.
+type Health struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+	ready    atomic.Bool
+
+	mu     sync.Mutex
+	checks []healthCheck
+
+	cacheMu  sync.Mutex
+	cached   *HealthReport
+	cachedAt time.Time
+}
+
+// HealthOption configures Health.
+type HealthOption func(*Health)
+
+// WithHealthTimeout sets the timeout applied to each check.
+func WithHealthTimeout(d time.Duration) HealthOption {
+	return func(h *Health) {
+		h.timeout = d
+	}
+}
+
+// WithHealthCacheTTL sets how long a /healthz report is reused. Zero disables caching.
+func WithHealthCacheTTL(d time.Duration) HealthOption {
+	return func(h *Health) {
+		h.cacheTTL = d
+	}
+}
+
+// NewHealth creates a Health component. It reports not ready until started.
+func NewHealth(opts ...HealthOption) *Health {
+	h := &Health{
+		timeout:  defaultHealthTimeout,
+		cacheTTL: defaultHealthCacheTTL,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Register adds a critical check. A failing critical check takes the service down.
+func (h *Health) Register(name string, c HealthChecker) {
+	h.register(name, true, c)
+}
+
+// RegisterOptional adds a non critical check. A failing optional check degrades the service.
+func (h *Health) RegisterOptional(name string, c HealthChecker) {
+	h.register(name, false, c)
+}
+
+func (h *Health) register(name string, critical bool, c HealthChecker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, healthCheck{name: name, critical: critical, checker: c})
+}
+
+// Start marks the service ready. Setup runs it after every other component.
+func (h *Health) Start(ctx context.Context) error {
+	h.SetReady(true)
+	return nil
+}
+
+// Stop marks the service not ready.
+func (h *Health) Stop(ctx context.Context) error {
+	h.SetReady(false)
+	return nil
+}
+
+// SetReady flips readiness.
+func (h *Health) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// Ready reports whether the service accepts traffic.
+func (h *Health) Ready() bool {
+	return h.ready.Load()
+}
+
+// RegisterRoutes registers the health endpoints.
+func (h *Health) RegisterRoutes(r chi.Router) {
+	r.Get("/ping", h.Ping)
+	r.Get("/livez", h.Livez)
+	r.Get("/readyz", h.Readyz)
+	r.Get("/healthz", h.Healthz)
+}
+
+// Ping handles GET /ping.
+func (h *Health) Ping(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("pong"))
+}
+
+// Livez handles GET /livez.
+func (h *Health) Livez(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, HealthReport{Status: HealthUp})
+}
+
+// Readyz handles GET /readyz.
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	if !h.Ready() {
+		writeHealth(w, http.StatusServiceUnavailable, HealthReport{Status: HealthDown})
+		return
+	}
+	writeHealth(w, http.StatusOK, HealthReport{Status: HealthUp})
+}
+
+// Healthz handles GET /healthz.
+func (h *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	report := h.Check(r.Context())
+	status := http.StatusOK
+	if report.Status != HealthUp {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, report)
+}
+
+// Check runs all registered checks in parallel, each bounded by the configured
+// timeout, and aggregates them. Reports are cached for the configured TTL.
+func (h *Health) Check(ctx context.Context) HealthReport {
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+
+	if h.cached != nil && h.cacheTTL > 0 && time.Since(h.cachedAt) < h.cacheTTL {
+		return *h.cached
+	}
+
+	h.mu.Lock()
+	checks := append([]healthCheck(nil), h.checks...)
+	h.mu.Unlock()
+
+	items := make([]HealthItem, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			items[i] = h.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HealthUp, Items: items}
+	for _, item := range items {
+		if item.Status == HealthUp {
+			continue
+		}
+		if item.Critical {
+			report.Status = HealthDown
+			break
+		}
+		report.Status = HealthDegraded
+	}
+
+	h.cached = &report
+	h.cachedAt = time.Now()
+	return report
+}
+
+func (h *Health) run(ctx context.Context, c healthCheck) HealthItem {
+	item := HealthItem{Name: c.name, Status: HealthUp, Critical: c.critical}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.checker.HealthCheck(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			item.Status = HealthDown
+			item.Error = err.Error()
+		}
+	case <-ctx.Done():
+		item.Status = HealthDown
+		item.Error = "timeout"
+	}
+	return item
+}
+
+// healthName returns the name a component is reported under.
+func healthName(c any) string {
+	if n, ok := c.(HealthNamer); ok {
+		return n.HealthName()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", c), "*")
+}
+
+func writeHealth(w http.ResponseWriter, status int, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
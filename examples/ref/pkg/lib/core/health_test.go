@@ -0,0 +1,191 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type checkFunc func(ctx context.Context) error
+
+func (f checkFunc) HealthCheck(ctx context.Context) error {
+	return f(ctx)
+}
+
+type countingChecker struct {
+	calls atomic.Int32
+}
+
+func (c *countingChecker) HealthCheck(ctx context.Context) error {
+	c.calls.Add(1)
+	return nil
+}
+
+func (c *countingChecker) HealthName() string {
+	return "db"
+}
+
+func serveHealth(t *testing.T, h *Health, path string) (int, HealthReport) {
+	t.Helper()
+
+	r := chi.NewRouter()
+	h.RegisterRoutes(r)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var report HealthReport
+	if path != "/ping" {
+		if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+			t.Fatalf("cannot decode %s response: %v", path, err)
+		}
+	}
+	return rr.Code, report
+}
+
+func TestHealthPingAndLivez(t *testing.T) {
+	h := NewHealth()
+
+	if code, _ := serveHealth(t, h, "/ping"); code != http.StatusOK {
+		t.Errorf("/ping status = %d, want 200", code)
+	}
+	if code, report := serveHealth(t, h, "/livez"); code != http.StatusOK || report.Status != HealthUp {
+		t.Errorf("/livez = %d %s, want 200 up", code, report.Status)
+	}
+}
+
+func TestHealthReadinessFollowsLifecycle(t *testing.T) {
+	h := NewHealth()
+	ctx := context.Background()
+
+	if code, _ := serveHealth(t, h, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before start = %d, want 503", code)
+	}
+
+	h.Start(ctx)
+	if code, report := serveHealth(t, h, "/readyz"); code != http.StatusOK || report.Status != HealthUp {
+		t.Errorf("/readyz after start = %d %s, want 200 up", code, report.Status)
+	}
+
+	h.Stop(ctx)
+	if code, _ := serveHealth(t, h, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz after stop = %d, want 503", code)
+	}
+}
+
+func TestHealthzAggregation(t *testing.T) {
+	ok := checkFunc(func(ctx context.Context) error { return nil })
+	failing := checkFunc(func(ctx context.Context) error { return errors.New("connection refused") })
+
+	tests := []struct {
+		name       string
+		register   func(h *Health)
+		wantCode   int
+		wantStatus string
+	}{
+		{
+			name:       "no checks",
+			register:   func(h *Health) {},
+			wantCode:   http.StatusOK,
+			wantStatus: HealthUp,
+		},
+		{
+			name: "all up",
+			register: func(h *Health) {
+				h.Register("db", ok)
+				h.RegisterOptional("cache", ok)
+			},
+			wantCode:   http.StatusOK,
+			wantStatus: HealthUp,
+		},
+		{
+			name: "optional down",
+			register: func(h *Health) {
+				h.Register("db", ok)
+				h.RegisterOptional("cache", failing)
+			},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: HealthDegraded,
+		},
+		{
+			name: "critical down",
+			register: func(h *Health) {
+				h.RegisterOptional("cache", failing)
+				h.Register("db", failing)
+			},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: HealthDown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealth(WithHealthCacheTTL(0))
+			tt.register(h)
+
+			code, report := serveHealth(t, h, "/healthz")
+			if code != tt.wantCode || report.Status != tt.wantStatus {
+				t.Errorf("/healthz = %d %s, want %d %s", code, report.Status, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	h := NewHealth(WithHealthTimeout(10*time.Millisecond), WithHealthCacheTTL(0))
+	h.Register("slow", checkFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}))
+
+	report := h.Check(context.Background())
+	if report.Status != HealthDown || report.Items[0].Error != "timeout" {
+		t.Errorf("Check() = %+v, want down with timeout", report)
+	}
+}
+
+func TestHealthCheckCaching(t *testing.T) {
+	checker := &countingChecker{}
+	h := NewHealth(WithHealthCacheTTL(time.Minute))
+	h.Register("db", checker)
+
+	h.Check(context.Background())
+	h.Check(context.Background())
+
+	if got := checker.calls.Load(); got != 1 {
+		t.Errorf("checker called %d times, want 1", got)
+	}
+}
+
+func TestSetupWiresHealth(t *testing.T) {
+	checker := &countingChecker{}
+	h := NewHealth()
+	r := chi.NewRouter()
+
+	starts, stops := Setup(context.Background(), r, h, checker)
+	if err := Start(context.Background(), starts, stops); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	if !h.Ready() {
+		t.Error("Ready() = false after Start, want true")
+	}
+
+	report := h.Check(context.Background())
+	if len(report.Items) != 1 || report.Items[0].Name != "db" {
+		t.Errorf("Check() items = %+v, want db", report.Items)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("/readyz via Setup = %d, want 200", rr.Code)
+	}
+}
@@ -21,13 +21,40 @@ type RouteRegistrar interface {
 	RegisterRoutes(chi.Router)
 }
 
+type guarded struct {
+	comp        any
+	middlewares []func(http.Handler) http.Handler
+}
+
+// WithMiddlewares wraps a component so Setup registers its routes behind the
+// given middlewares. It is otherwise wired as usual.
+func WithMiddlewares(comp any, middlewares ...func(http.Handler) http.Handler) any {
+	return guarded{comp: comp, middlewares: middlewares}
+}
+
 func Setup(ctx context.Context, r chi.Router, comps ...any) (
 	starts []func(context.Context) error,
 	stops []func(context.Context) error,
 ) {
+	// Health is wired last: it checks the other components and only reports
+	// ready once all of them have started.
+	var health *Health
 	for _, c := range comps {
+		if h, ok := c.(*Health); ok {
+			health = h
+		}
+	}
+
+	for _, c := range comps {
+		router := r
+		if g, ok := c.(guarded); ok {
+			c, router = g.comp, r.With(g.middlewares...)
+		}
+		if health != nil && c == any(health) {
+			continue
+		}
 		if rr, ok := c.(RouteRegistrar); ok {
-			rr.RegisterRoutes(r)
+			rr.RegisterRoutes(router)
 		}
 		if s, ok := c.(Startable); ok {
 			starts = append(starts, s.Start)
@@ -35,6 +62,15 @@ func Setup(ctx context.Context, r chi.Router, comps ...any) (
 		if st, ok := c.(Stoppable); ok {
 			stops = append(stops, st.Stop)
 		}
+		if hc, ok := c.(HealthChecker); ok && health != nil {
+			health.Register(healthName(c), hc)
+		}
+	}
+
+	if health != nil {
+		health.RegisterRoutes(r)
+		starts = append(starts, health.Start)
+		stops = append(stops, health.Stop)
 	}
 	return
 }
@@ -0,0 +1,357 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer drivers selected by MailerOptions.Driver.
+const (
+	MailerSMTP    = "smtp"
+	MailerFile    = "file"
+	MailerConsole = "console"
+	MailerMemory  = "memory"
+)
+
+// ErrInvalidMessage is returned for messages without recipients or sender,
+// or with line breaks in header fields.
+var ErrInvalidMessage = errors.New("invalid mail message")
+
+// Message is an email. Text is always sent; HTML, when set, is sent as an
+// alternative part.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// MailerOptions configures the Mailer built by NewMailer.
+type MailerOptions struct {
+	// Driver is smtp, file, console (the default) or memory.
+	Driver string
+	// Dir is where the file driver writes messages.
+	Dir string
+	// SMTP configures the smtp driver.
+	SMTP SMTPOptions
+}
+
+// SMTPOptions configures an SMTPMailer. Username and Password are optional;
+// when set, PLAIN authentication is used, which net/smtp only allows over
+// TLS or to localhost.
+type SMTPOptions struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+// NewMailer returns the Mailer for opts.Driver. Development setups use the
+// console or file drivers, tests the memory one.
+func NewMailer(opts MailerOptions) (Mailer, error) {
+	switch opts.Driver {
+	case "", MailerConsole:
+		return NewConsoleMailer(os.Stdout), nil
+
+	case MailerFile:
+		if opts.Dir == "" {
+			return nil, errors.New("file mailer requires a directory")
+		}
+		return NewFileMailer(opts.Dir), nil
+
+	case MailerSMTP:
+		if opts.SMTP.Host == "" {
+			return nil, errors.New("smtp mailer requires a host")
+		}
+		return NewSMTPMailer(opts.SMTP), nil
+
+	case MailerMemory:
+		return NewMemoryMailer(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", opts.Driver)
+	}
+}
+
+// SMTPMailer sends messages through an SMTP server.
+type SMTPMailer struct {
+	opts SMTPOptions
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	now  func() time.Time
+}
+
+// NewSMTPMailer creates an SMTPMailer. Port defaults to 587.
+func NewSMTPMailer(opts SMTPOptions) *SMTPMailer {
+	if opts.Port == 0 {
+		opts.Port = 587
+	}
+
+	return &SMTPMailer{
+		opts: opts,
+		send: smtp.SendMail,
+		now:  time.Now,
+	}
+}
+
+// Send delivers msg. The context is only checked before connecting; net/smtp
+// does not support cancellation.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	raw, err := FormatMessage(msg, m.now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.opts.Username != "" {
+		auth = smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)
+	}
+
+	addr := net.JoinHostPort(m.opts.Host, strconv.Itoa(m.opts.Port))
+	if err := m.send(addr, auth, msg.From, msg.To, raw); err != nil {
+		return fmt.Errorf("cannot send mail: %w", err)
+	}
+	return nil
+}
+
+// FileMailer writes messages instead of sending them, either as .eml files
+// in a directory or to a writer such as the console.
+type FileMailer struct {
+	dir string
+	w   io.Writer
+	now func() time.Time
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewFileMailer creates a FileMailer writing one .eml file per message in dir.
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{dir: dir, now: time.Now}
+}
+
+// NewConsoleMailer creates a FileMailer writing messages to w.
+func NewConsoleMailer(w io.Writer) *FileMailer {
+	return &FileMailer{w: w, now: time.Now}
+}
+
+// Send writes msg.
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := m.now()
+	raw, err := FormatMessage(msg, now)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.w != nil {
+		if _, err := fmt.Fprintf(m.w, "%s\n\n", raw); err != nil {
+			return fmt.Errorf("cannot write mail: %w", err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("cannot create mail directory: %w", err)
+	}
+
+	m.seq++
+	name := fmt.Sprintf("%s-%04d.eml", now.UTC().Format("20060102T150405"), m.seq)
+	if err := os.WriteFile(filepath.Join(m.dir, name), raw, 0o644); err != nil {
+		return fmt.Errorf("cannot write mail: %w", err)
+	}
+	return nil
+}
+
+// MemoryMailer keeps sent messages in memory, for tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryMailer creates an empty MemoryMailer.
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send records msg after validating it as the other mailers do.
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	if err := validateMessage(msg); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the last message sent.
+func (m *MemoryMailer) Last() (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) == 0 {
+		return Message{}, false
+	}
+	return m.messages[len(m.messages)-1], true
+}
+
+// Reset drops the recorded messages.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+// MailComposer renders messages from templates loaded by a TemplateManager.
+// A message named welcome lives in welcome.html, whose body is the HTML part
+// and which defines the blocks welcome.subject and welcome.text.
+type MailComposer struct {
+	templates *TemplateManager
+	from      string
+}
+
+// NewMailComposer creates a MailComposer sending from the given address.
+func NewMailComposer(templates *TemplateManager, from string) *MailComposer {
+	return &MailComposer{
+		templates: templates,
+		from:      from,
+	}
+}
+
+// Compose renders the message name for the recipient to with data.
+func (c *MailComposer) Compose(name, to string, data any) (Message, error) {
+	tmpl, err := c.templates.Get(name + ".html")
+	if err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{From: c.from, To: []string{to}}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name+".subject", data); err != nil {
+		return Message{}, fmt.Errorf("cannot render %s subject: %w", name, err)
+	}
+	// Subject and text are rendered by html/template; undo its escaping.
+	msg.Subject = strings.TrimSpace(html.UnescapeString(buf.String()))
+
+	buf.Reset()
+	if err := tmpl.ExecuteTemplate(&buf, name+".text", data); err != nil {
+		return Message{}, fmt.Errorf("cannot render %s text: %w", name, err)
+	}
+	msg.Text = strings.TrimSpace(html.UnescapeString(buf.String()))
+
+	buf.Reset()
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return Message{}, fmt.Errorf("cannot render %s html: %w", name, err)
+	}
+	msg.HTML = strings.TrimSpace(buf.String())
+
+	return msg, nil
+}
+
+// FormatMessage encodes msg as an RFC 5322 message dated at date.
+func FormatMessage(msg Message, date time.Time) ([]byte, error) {
+	if err := validateMessage(msg); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func validateMessage(msg Message) error {
+	if msg.From == "" || len(msg.To) == 0 {
+		return fmt.Errorf("%w: sender and recipients are required", ErrInvalidMessage)
+	}
+
+	fields := append([]string{msg.From, msg.Subject}, msg.To...)
+	for _, field := range fields {
+		if strings.ContainsAny(field, "\r\n") {
+			return fmt.Errorf("%w: line break in header", ErrInvalidMessage)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var testMessage = Message{
+	From:    "no-reply@example.com",
+	To:      []string{"user@example.com"},
+	Subject: "Réinitialiser",
+	Text:    "Open https://example.com/reset?token=a&b=c",
+	HTML:    `<a href="https://example.com/reset?token=a&amp;b=c">Reset</a>`,
+}
+
+func TestNewMailer(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    MailerOptions
+		wantErr bool
+	}{
+		{"default console", MailerOptions{}, false},
+		{"file", MailerOptions{Driver: MailerFile, Dir: t.TempDir()}, false},
+		{"file without dir", MailerOptions{Driver: MailerFile}, true},
+		{"smtp", MailerOptions{Driver: MailerSMTP, SMTP: SMTPOptions{Host: "localhost"}}, false},
+		{"smtp without host", MailerOptions{Driver: MailerSMTP}, true},
+		{"memory", MailerOptions{Driver: MailerMemory}, false},
+		{"unknown", MailerOptions{Driver: "pigeon"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMailer(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewMailer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormatMessage(t *testing.T) {
+	raw, err := FormatMessage(testMessage, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatalf("FormatMessage() error = %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("cannot parse message: %v", err)
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != testMessage.Subject || parsed.Header.Get("To") != "user@example.com" {
+		t.Errorf("headers = %v, subject %q", parsed.Header, subject)
+	}
+
+	_, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("cannot parse content type: %v", err)
+	}
+
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("cannot read part: %v", err)
+		}
+		body, _ := io.ReadAll(quotedprintable.NewReader(part))
+		bodies = append(bodies, string(body))
+	}
+
+	if len(bodies) != 2 || bodies[0] != testMessage.Text || bodies[1] != testMessage.HTML {
+		t.Errorf("parts = %q, want text and html", bodies)
+	}
+}
+
+func TestFormatMessageRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"no recipients", Message{From: "a@example.com"}},
+		{"no sender", Message{To: []string{"b@example.com"}}},
+		{"header injection", Message{From: "a@example.com", To: []string{"b@example.com"}, Subject: "Hi\r\nBcc: c@example.com"}},
+		{"recipient injection", Message{From: "a@example.com", To: []string{"b@example.com\nBcc: c@example.com"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FormatMessage(tt.msg, time.Now()); !errors.Is(err, ErrInvalidMessage) {
+				t.Errorf("FormatMessage() error = %v, want %v", err, ErrInvalidMessage)
+			}
+		})
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	m := NewSMTPMailer(SMTPOptions{Host: "mail.example.com", Username: "user", Password: "secret"})
+
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotAuth smtp.Auth
+	m.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotAuth, gotFrom, gotTo = addr, a, from, to
+		return nil
+	}
+
+	if err := m.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if gotAddr != "mail.example.com:587" || gotFrom != testMessage.From || len(gotTo) != 1 || gotAuth == nil {
+		t.Errorf("SendMail(%s, %v, %s, %v)", gotAddr, gotAuth, gotFrom, gotTo)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Send(ctx, testMessage); !errors.Is(err, context.Canceled) {
+		t.Errorf("Send() with canceled context error = %v", err)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFileMailer(dir)
+
+	for i := 0; i < 2; i++ {
+		if err := m.Send(context.Background(), testMessage); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("files = %v, %v, want two .eml files", files, err)
+	}
+
+	raw, _ := os.ReadFile(files[0])
+	if _, err := mail.ReadMessage(bytes.NewReader(raw)); err != nil {
+		t.Errorf("written file is not a message: %v", err)
+	}
+
+	var console bytes.Buffer
+	if err := NewConsoleMailer(&console).Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if !strings.Contains(console.String(), "To: user@example.com") {
+		t.Errorf("console output = %q", console.String())
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	if _, ok := m.Last(); ok {
+		t.Fatal("Last() on empty mailer ok = true")
+	}
+
+	if err := m.Send(context.Background(), testMessage); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if err := m.Send(context.Background(), Message{}); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Send() invalid message error = %v", err)
+	}
+
+	last, ok := m.Last()
+	if !ok || last.Subject != testMessage.Subject || len(m.Messages()) != 1 {
+		t.Errorf("Last() = %+v, %v; messages %d", last, ok, len(m.Messages()))
+	}
+
+	m.Reset()
+	if len(m.Messages()) != 0 {
+		t.Error("Reset() kept messages")
+	}
+}
+
+func TestMailComposer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"assets/templates/mail/reset.html": {Data: []byte(
+			`{{define "reset.subject"}}Reset for {{.Name}}{{end}}` +
+				`{{define "reset.text"}}Open {{.URL}}{{end}}` +
+				`<a href="{{.URL}}">{{.Name}}</a>`,
+		)},
+	}
+
+	templates := NewTemplateManager(fsys, NewNoopLogger())
+	if err := templates.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	composer := NewMailComposer(templates, "no-reply@example.com")
+	msg, err := composer.Compose("reset", "user@example.com", map[string]string{
+		"Name": "Tom & Jerry",
+		"URL":  "https://example.com/reset?token=a&b=c",
+	})
+	if err != nil {
+		t.Fatalf("Compose() error = %v", err)
+	}
+
+	if msg.From != "no-reply@example.com" || len(msg.To) != 1 || msg.To[0] != "user@example.com" {
+		t.Errorf("addresses = %s, %v", msg.From, msg.To)
+	}
+	if msg.Subject != "Reset for Tom & Jerry" {
+		t.Errorf("Subject = %q", msg.Subject)
+	}
+	if msg.Text != "Open https://example.com/reset?token=a&b=c" {
+		t.Errorf("Text = %q", msg.Text)
+	}
+	if msg.HTML != `<a href="https://example.com/reset?token=a&amp;b=c">Tom &amp; Jerry</a>` {
+		t.Errorf("HTML = %q", msg.HTML)
+	}
+
+	if _, err := composer.Compose("missing", "user@example.com", nil); err == nil {
+		t.Error("Compose() of a missing template error = nil")
+	}
+}
@@ -0,0 +1,307 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Built-in middleware names, as used in the middlewares section of the spec.
+const (
+	MiddlewareRecoverer    = "recoverer"
+	MiddlewareRequestID    = "request_id"
+	MiddlewareRealIP       = "real_ip"
+	MiddlewareLogger       = "logger"
+	MiddlewareTimeout      = "timeout"
+	MiddlewareThrottle     = "throttle"
+	MiddlewareCompress     = "compress"
+	MiddlewareCORS         = "cors"
+	MiddlewareBodyLimit    = "body_limit"
+	MiddlewareStripSlashes = "strip_slashes"
+	MiddlewareHeartbeat    = "heartbeat"
+)
+
+// Middleware wraps an http.Handler.
+type Middleware func(http.Handler) http.Handler
+
+// MiddlewareFactory builds a middleware from the stack options.
+type MiddlewareFactory func(opts MiddlewareOptions) Middleware
+
+// CORSOptions configures the cors middleware.
+type CORSOptions struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int
+}
+
+// MiddlewareOptions describes a middleware stack: which middlewares are
+// enabled and the settings of the ones that need them.
+type MiddlewareOptions struct {
+	Enabled       []string
+	Timeout       time.Duration
+	Throttle      int
+	CompressLevel int
+	CORS          CORSOptions
+	BodyLimit     int64
+	HeartbeatPath string
+}
+
+// MiddlewareGroup overrides the stack for requests under Path.
+// Path segments written as {param} match any segment.
+type MiddlewareGroup struct {
+	Path    string
+	Options MiddlewareOptions
+}
+
+var (
+	middlewareMu sync.RWMutex
+
+	// middlewareOrder is the order middlewares are chained in, outermost first.
+	// Custom middlewares are appended in registration order.
+	middlewareOrder = []string{
+		MiddlewareRecoverer,
+		MiddlewareRequestID,
+		MiddlewareRealIP,
+		MiddlewareLogger,
+		MiddlewareTimeout,
+		MiddlewareThrottle,
+		MiddlewareCompress,
+		MiddlewareCORS,
+		MiddlewareBodyLimit,
+		MiddlewareStripSlashes,
+		MiddlewareHeartbeat,
+	}
+
+	middlewareRegistry = map[string]MiddlewareFactory{
+		MiddlewareRecoverer: func(MiddlewareOptions) Middleware { return middleware.Recoverer },
+		MiddlewareRequestID: func(MiddlewareOptions) Middleware { return middleware.RequestID },
+		MiddlewareRealIP:    func(MiddlewareOptions) Middleware { return middleware.RealIP },
+		MiddlewareLogger:    func(MiddlewareOptions) Middleware { return middleware.Logger },
+		MiddlewareTimeout: func(o MiddlewareOptions) Middleware {
+			return middleware.Timeout(o.Timeout)
+		},
+		MiddlewareThrottle: func(o MiddlewareOptions) Middleware {
+			return middleware.Throttle(o.Throttle)
+		},
+		MiddlewareCompress: func(o MiddlewareOptions) Middleware {
+			return middleware.Compress(o.CompressLevel)
+		},
+		MiddlewareCORS: func(o MiddlewareOptions) Middleware {
+			return CORS(o.CORS)
+		},
+		MiddlewareBodyLimit: func(o MiddlewareOptions) Middleware {
+			return middleware.RequestSize(o.BodyLimit)
+		},
+		MiddlewareStripSlashes: func(MiddlewareOptions) Middleware { return middleware.StripSlashes },
+		MiddlewareHeartbeat: func(o MiddlewareOptions) Middleware {
+			return middleware.Heartbeat(o.HeartbeatPath)
+		},
+	}
+)
+
+// RegisterMiddleware adds a custom middleware that can then be enabled by name.
+// Registering an existing name replaces its factory but keeps its position.
+func RegisterMiddleware(name string, factory MiddlewareFactory) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+
+	if _, ok := middlewareRegistry[name]; !ok {
+		middlewareOrder = append(middlewareOrder, name)
+	}
+	middlewareRegistry[name] = factory
+}
+
+// DefaultMiddlewareOptions returns the stack used when the spec sets none.
+func DefaultMiddlewareOptions() MiddlewareOptions {
+	return MiddlewareOptions{
+		Enabled: []string{MiddlewareRecoverer, MiddlewareRequestID, MiddlewareRealIP, MiddlewareLogger},
+	}
+}
+
+// Chain returns the enabled middlewares in registry order, outermost first.
+// The order they are listed in Enabled does not matter.
+func (o MiddlewareOptions) Chain() ([]Middleware, error) {
+	middlewareMu.RLock()
+	defer middlewareMu.RUnlock()
+
+	enabled := make(map[string]bool, len(o.Enabled))
+	for _, name := range o.Enabled {
+		if _, ok := middlewareRegistry[name]; !ok {
+			return nil, fmt.Errorf("unknown middleware %q", name)
+		}
+		enabled[name] = true
+	}
+
+	if err := o.validate(enabled); err != nil {
+		return nil, err
+	}
+
+	var chain []Middleware
+	for _, name := range middlewareOrder {
+		if enabled[name] {
+			chain = append(chain, middlewareRegistry[name](o))
+		}
+	}
+	return chain, nil
+}
+
+func (o MiddlewareOptions) validate(enabled map[string]bool) error {
+	switch {
+	case enabled[MiddlewareTimeout] && o.Timeout <= 0:
+		return fmt.Errorf("middleware %s requires a positive timeout", MiddlewareTimeout)
+	case enabled[MiddlewareThrottle] && o.Throttle <= 0:
+		return fmt.Errorf("middleware %s requires a positive limit", MiddlewareThrottle)
+	case enabled[MiddlewareBodyLimit] && o.BodyLimit <= 0:
+		return fmt.Errorf("middleware %s requires a positive size", MiddlewareBodyLimit)
+	case enabled[MiddlewareHeartbeat] && !strings.HasPrefix(o.HeartbeatPath, "/"):
+		return fmt.Errorf("middleware %s requires a path starting with /", MiddlewareHeartbeat)
+	}
+	return nil
+}
+
+// MiddlewareStack applies a base middleware chain to every request, or the
+// chain of the most specific group matching the request path.
+type MiddlewareStack struct {
+	base   []Middleware
+	groups []middlewareGroup
+}
+
+type middlewareGroup struct {
+	segments []string
+	chain    []Middleware
+}
+
+// NewMiddlewareStack builds the base chain and one chain per group.
+// Groups carry the full stack used under their path, not a delta.
+func NewMiddlewareStack(base MiddlewareOptions, groups ...MiddlewareGroup) (*MiddlewareStack, error) {
+	chain, err := base.Chain()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &MiddlewareStack{base: chain}
+	for _, g := range groups {
+		chain, err := g.Options.Chain()
+		if err != nil {
+			return nil, fmt.Errorf("middleware group %s: %w", g.Path, err)
+		}
+		s.groups = append(s.groups, middlewareGroup{segments: pathSegments(g.Path), chain: chain})
+	}
+	return s, nil
+}
+
+// Handler is meant for router.Use and must be registered before any route.
+func (s *MiddlewareStack) Handler(next http.Handler) http.Handler {
+	base := wrap(next, s.base)
+	if len(s.groups) == 0 {
+		return base
+	}
+
+	handlers := make([]http.Handler, len(s.groups))
+	for i, g := range s.groups {
+		handlers[i] = wrap(next, g.chain)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, best := base, -1
+		segments := pathSegments(r.URL.Path)
+		for i, g := range s.groups {
+			if len(g.segments) > best && matchSegments(g.segments, segments) {
+				h, best = handlers[i], len(g.segments)
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// CORS answers preflight requests and sets the CORS response headers for
+// allowed origins. An empty AllowedOrigins allows any origin.
+func CORS(o CORSOptions) Middleware {
+	if len(o.AllowedMethods) == 0 {
+		o.AllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+	}
+	if len(o.AllowedHeaders) == 0 {
+		o.AllowedHeaders = []string{"Accept", "Authorization", "Content-Type", "X-Request-Id"}
+	}
+	anyOrigin := len(o.AllowedOrigins) == 0
+	origins := make(map[string]bool, len(o.AllowedOrigins))
+	for _, origin := range o.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		origins[origin] = true
+	}
+	methods := strings.Join(o.AllowedMethods, ", ")
+	headers := strings.Join(o.AllowedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || !(anyOrigin || origins[origin]) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if anyOrigin && !o.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if o.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Methods", methods)
+			h.Set("Access-Control-Allow-Headers", headers)
+			if o.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(o.MaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func wrap(h http.Handler, chain []Middleware) http.Handler {
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	return h
+}
+
+func pathSegments(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// matchSegments reports whether path starts with the prefix segments.
+func matchSegments(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i, s := range prefix {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			continue
+		}
+		if s != path[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func tagMiddleware(tag string) MiddlewareFactory {
+	return func(MiddlewareOptions) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Chain", tag)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+}
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	RegisterMiddleware("test_first", tagMiddleware("first"))
+	RegisterMiddleware("test_second", tagMiddleware("second"))
+
+	opts := MiddlewareOptions{Enabled: []string{"test_second", MiddlewareRequestID, "test_first"}}
+	chain, err := opts.Chain()
+	if err != nil {
+		t.Fatalf("Chain() error = %v", err)
+	}
+	if len(chain) != 3 {
+		t.Fatalf("Chain() returned %d middlewares, want 3", len(chain))
+	}
+
+	stack, err := NewMiddlewareStack(opts)
+	if err != nil {
+		t.Fatalf("NewMiddlewareStack() error = %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	stack.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := rr.Header().Values("X-Chain"); !reflect.DeepEqual(got, []string{"first", "second"}) {
+		t.Errorf("chain order = %v, want [first second]", got)
+	}
+}
+
+func TestMiddlewareChainErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts MiddlewareOptions
+	}{
+		{"unknown", MiddlewareOptions{Enabled: []string{"nope"}}},
+		{"timeout without duration", MiddlewareOptions{Enabled: []string{MiddlewareTimeout}}},
+		{"throttle without limit", MiddlewareOptions{Enabled: []string{MiddlewareThrottle}}},
+		{"body limit without size", MiddlewareOptions{Enabled: []string{MiddlewareBodyLimit}}},
+		{"heartbeat without path", MiddlewareOptions{Enabled: []string{MiddlewareHeartbeat}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.opts.Chain(); err == nil {
+				t.Error("Chain() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMiddlewareStackGroups(t *testing.T) {
+	base := DefaultMiddlewareOptions()
+	limited := DefaultMiddlewareOptions()
+	limited.Enabled = append(limited.Enabled, MiddlewareBodyLimit)
+	limited.BodyLimit = 4
+
+	stack, err := NewMiddlewareStack(base, MiddlewareGroup{Path: "/lists/{id}/items", Options: limited})
+	if err != nil {
+		t.Fatalf("NewMiddlewareStack() error = %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(stack.Handler)
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Body.Read(make([]byte, 16)); err != nil && err != io.EOF {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	r.Post("/lists", echo)
+	r.Post("/lists/{id}/items", echo)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/lists", http.StatusOK},
+		{"/lists/42/items", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader("a long body")))
+		if rr.Code != tt.want {
+			t.Errorf("POST %s = %d, want %d", tt.path, rr.Code, tt.want)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	h := CORS(CORSOptions{AllowedOrigins: []string{"https://app.example.com"}, MaxAge: 600})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	preflight := httptest.NewRequest(http.MethodOptions, "/lists", nil)
+	preflight.Header.Set("Origin", "https://app.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, preflight)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("preflight status = %d, want 204", rr.Code)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Max-Age"); got != "600" {
+		t.Errorf("Access-Control-Max-Age = %q, want 600", got)
+	}
+
+	other := httptest.NewRequest(http.MethodGet, "/lists", nil)
+	other.Header.Set("Origin", "https://evil.example.com")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, other)
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin for disallowed origin = %q, want empty", got)
+	}
+}
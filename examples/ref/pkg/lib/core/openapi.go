@@ -0,0 +1,58 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// OpenAPIHandler serves the service OpenAPI document and, optionally, a docs page rendering it.
+type OpenAPIHandler struct {
+	spec []byte
+	docs bool
+}
+
+// NewOpenAPIHandler creates a handler for the given OpenAPI document.
+// When docs is true an HTML page rendering the document is served at /docs.
+func NewOpenAPIHandler(spec []byte, docs bool) *OpenAPIHandler {
+	return &OpenAPIHandler{
+		spec: spec,
+		docs: docs,
+	}
+}
+
+// RegisterRoutes registers the OpenAPI routes.
+func (h *OpenAPIHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/openapi.yaml", h.Spec)
+	if h.docs {
+		r.Get("/docs", h.Docs)
+	}
+}
+
+// Spec writes the raw OpenAPI document.
+func (h *OpenAPIHandler) Spec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(h.spec)
+}
+
+// Docs writes an HTML page that renders /openapi.yaml.
+func (h *OpenAPIHandler) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(openAPIDocsPage))
+}
+
+const openAPIDocsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>API Reference</title>
+</head>
+<body>
+  <redoc spec-url="/openapi.yaml"></redoc>
+  <script src="https://cdn.redoc.ly/redoc/latest/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RoutesPath is the well known path where a service publishes its routes.
+const RoutesPath = "/.well-known/routes"
+
+// RouteInfo describes a route published by /.well-known/routes.
+// Exposed is false for virtual routes: described but not mounted on the router.
+// Permissions are checked by Authorizer, scoped to ScopeType and the value of
+// the first path parameter when ScopeType is set.
+type RouteInfo struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	HandlerID   string   `json:"handler_id,omitempty"`
+	Summary     string   `json:"summary,omitempty"`
+	Auth        bool     `json:"auth"`
+	Scopes      []string `json:"scopes,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	ScopeType   string   `json:"scope_type,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Exposed     bool     `json:"exposed"`
+}
+
+// RouteCatalog publishes the routes of a service. Mounted routes are discovered
+// with chi.Walk and enriched with the metadata the catalog was built with.
+type RouteCatalog struct {
+	mu     sync.RWMutex
+	router chi.Routes
+	meta   []RouteInfo
+}
+
+// NewRouteCatalog creates a catalog from the JSON route metadata generated for
+// the service (a list of RouteInfo). Metadata may be empty.
+func NewRouteCatalog(meta []byte) (*RouteCatalog, error) {
+	c := &RouteCatalog{}
+	if len(meta) == 0 {
+		return c, nil
+	}
+
+	if err := json.Unmarshal(meta, &c.meta); err != nil {
+		return nil, fmt.Errorf("cannot parse route metadata: %w", err)
+	}
+	for i := range c.meta {
+		c.meta[i].Method = strings.ToUpper(c.meta[i].Method)
+		c.meta[i].Path = normalizeRoutePath(c.meta[i].Path)
+	}
+	return c, nil
+}
+
+// AddVirtualRoute describes a route. If no mounted route matches its method and
+// path it is published as not exposed.
+func (c *RouteCatalog) AddVirtualRoute(info RouteInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info.Method = strings.ToUpper(info.Method)
+	info.Path = normalizeRoutePath(info.Path)
+	c.meta = append(c.meta, info)
+}
+
+// RegisterRoutes registers the discovery route and keeps the router to walk.
+func (c *RouteCatalog) RegisterRoutes(r chi.Router) {
+	c.mu.Lock()
+	c.router = r
+	c.mu.Unlock()
+
+	r.Get(RoutesPath, c.List)
+}
+
+// Routes returns mounted and virtual routes sorted by path and method.
+func (c *RouteCatalog) Routes() ([]RouteInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	meta := make(map[string]RouteInfo, len(c.meta))
+	for _, info := range c.meta {
+		meta[routeKey(info.Method, info.Path)] = info
+	}
+
+	routes := []RouteInfo{}
+	seen := map[string]bool{}
+
+	if c.router != nil {
+		walk := func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			path := normalizeRoutePath(route)
+			key := routeKey(method, path)
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+
+			info, ok := meta[key]
+			if !ok {
+				info = RouteInfo{Method: method, Path: path}
+			}
+			info.Exposed = true
+			routes = append(routes, info)
+			return nil
+		}
+		if err := chi.Walk(c.router, walk); err != nil {
+			return nil, fmt.Errorf("cannot walk routes: %w", err)
+		}
+	}
+
+	for _, info := range c.meta {
+		key := routeKey(info.Method, info.Path)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		info.Exposed = false
+		routes = append(routes, info)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes, nil
+}
+
+// List handles GET /.well-known/routes.
+func (c *RouteCatalog) List(w http.ResponseWriter, r *http.Request) {
+	routes, err := c.Routes()
+	if err != nil {
+		RespondError(w, http.StatusInternalServerError, "Cannot list routes")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(routes)
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// normalizeRoutePath drops the trailing slash chi reports for sub router roots.
+func normalizeRoutePath(path string) string {
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
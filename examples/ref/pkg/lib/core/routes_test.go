@@ -0,0 +1,103 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestRouteCatalogList(t *testing.T) {
+	meta := []byte(`[
+		{"method": "get", "path": "/lists/{id}", "handler_id": "todo_lists_get", "summary": "Get List", "auth": true, "scopes": ["todos:read"], "tags": ["lists"]},
+		{"method": "GET", "path": "/items", "handler_id": "todo_items_list", "auth": true}
+	]`)
+
+	catalog, err := NewRouteCatalog(meta)
+	if err != nil {
+		t.Fatalf("NewRouteCatalog() error = %v", err)
+	}
+	catalog.AddVirtualRoute(RouteInfo{Method: "post", Path: "/v1/orders/", Summary: "Create order"})
+
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	r := chi.NewRouter()
+	r.Route("/lists", func(r chi.Router) {
+		r.Get("/", noop)
+		r.Get("/{id}", noop)
+	})
+	catalog.RegisterRoutes(r)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, RoutesPath, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want 200", RoutesPath, rr.Code)
+	}
+
+	var routes []RouteInfo
+	if err := json.NewDecoder(rr.Body).Decode(&routes); err != nil {
+		t.Fatalf("cannot decode routes: %v", err)
+	}
+
+	byKey := map[string]RouteInfo{}
+	for _, route := range routes {
+		byKey[route.Method+" "+route.Path] = route
+	}
+
+	tests := []struct {
+		key         string
+		wantExposed bool
+		wantHandler string
+	}{
+		{"GET /.well-known/routes", true, ""},
+		{"GET /lists", true, ""},
+		{"GET /lists/{id}", true, "todo_lists_get"},
+		{"GET /items", false, "todo_items_list"},
+		{"POST /v1/orders", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			route, ok := byKey[tt.key]
+			if !ok {
+				t.Fatalf("route %s not listed in %+v", tt.key, routes)
+			}
+			if route.Exposed != tt.wantExposed {
+				t.Errorf("Exposed = %v, want %v", route.Exposed, tt.wantExposed)
+			}
+			if route.HandlerID != tt.wantHandler {
+				t.Errorf("HandlerID = %q, want %q", route.HandlerID, tt.wantHandler)
+			}
+		})
+	}
+
+	if got := byKey["GET /lists/{id}"]; !got.Auth || len(got.Scopes) != 1 || got.Summary != "Get List" {
+		t.Errorf("GET /lists/{id} metadata = %+v, want auth, scopes and summary", got)
+	}
+
+	if len(routes) != len(tests) {
+		t.Errorf("listed %d routes, want %d", len(routes), len(tests))
+	}
+}
+
+func TestRouteCatalogInvalidMetadata(t *testing.T) {
+	if _, err := NewRouteCatalog([]byte(`{not json`)); err == nil {
+		t.Error("NewRouteCatalog() error = nil, want parse error")
+	}
+}
+
+func TestRouteCatalogEmpty(t *testing.T) {
+	catalog, err := NewRouteCatalog(nil)
+	if err != nil {
+		t.Fatalf("NewRouteCatalog() error = %v", err)
+	}
+
+	routes, err := catalog.Routes()
+	if err != nil {
+		t.Fatalf("Routes() error = %v", err)
+	}
+	if routes == nil || len(routes) != 0 {
+		t.Errorf("Routes() = %v, want empty list", routes)
+	}
+}
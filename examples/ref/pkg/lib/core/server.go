@@ -63,10 +63,15 @@ func Serve(router *chi.Mux, opts ServerOpts, stops []func(context.Context) error
 	<-quit
 
 	log.Info("Shutting down server...")
+	if opts.Health != nil {
+		opts.Health.SetReady(false)
+	}
 	Shutdown(srv, stops)
 }
 
 // ServerOpts holds server-related options.
 type ServerOpts struct {
 	Port string
+	// Health, when set, is marked not ready before the server drains.
+	Health *Health
 }
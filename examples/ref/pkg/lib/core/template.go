@@ -2,9 +2,10 @@ package core
 
 import (
 	"context"
-	"embed"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"strings"
 	"sync"
 
@@ -13,14 +14,16 @@ import (
 
 const templateBasePath = "assets/templates"
 
+// TemplateManager parses the HTML templates under assets/templates: shared
+// ones and one directory per handler. The shared directory is optional.
 type TemplateManager struct {
 	log       Logger
-	assetsFS  embed.FS
+	assetsFS  fs.FS
 	templates map[string]*template.Template
 	mutex     sync.RWMutex
 }
 
-func NewTemplateManager(assetsFS embed.FS, log Logger) *TemplateManager {
+func NewTemplateManager(assetsFS fs.FS, log Logger) *TemplateManager {
 	return &TemplateManager{
 		log:       log,
 		assetsFS:  assetsFS,
@@ -45,8 +48,8 @@ func (tm *TemplateManager) parseTemplates() error {
 
 	var allPaths []string
 
-	sharedEntries, err := tm.assetsFS.ReadDir(templateBasePath + "/shared")
-	if err != nil {
+	sharedEntries, err := fs.ReadDir(tm.assetsFS, templateBasePath+"/shared")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return fmt.Errorf("error reading shared templates: %w", err)
 	}
 
@@ -57,7 +60,7 @@ func (tm *TemplateManager) parseTemplates() error {
 		allPaths = append(allPaths, templateBasePath+"/shared/"+entry.Name())
 	}
 
-	rootEntries, err := tm.assetsFS.ReadDir(templateBasePath)
+	rootEntries, err := fs.ReadDir(tm.assetsFS, templateBasePath)
 	if err != nil {
 		return fmt.Errorf("error reading template base path: %w", err)
 	}
@@ -70,7 +73,7 @@ func (tm *TemplateManager) parseTemplates() error {
 	}
 
 	for _, handlerDir := range handlerDirs {
-		entries, err := tm.assetsFS.ReadDir(templateBasePath + "/" + handlerDir)
+		entries, err := fs.ReadDir(tm.assetsFS, templateBasePath+"/"+handlerDir)
 		if err != nil {
 			tm.log.Error("error reading handler templates", "path", handlerDir, "error", err)
 			continue
@@ -85,7 +88,7 @@ func (tm *TemplateManager) parseTemplates() error {
 	}
 
 	for _, handlerDir := range handlerDirs {
-		entries, err := tm.assetsFS.ReadDir(templateBasePath + "/" + handlerDir)
+		entries, err := fs.ReadDir(tm.assetsFS, templateBasePath+"/"+handlerDir)
 		if err != nil {
 			continue
 		}
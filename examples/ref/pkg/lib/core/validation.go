@@ -85,6 +85,19 @@ func IsEmail(value string) bool {
 	return regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`).MatchString(value)
 }
 
+// IsOneOf checks if a string value is one of the comma separated allowed values.
+func IsOneOf(value, allowed string) bool {
+	if value == "" {
+		return true // Empty string is considered valid if not required
+	}
+	for _, a := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(a) == value {
+			return true
+		}
+	}
+	return false
+}
+
 // MinValueInt checks if an int value meets the minimum value requirement.
 func MinValueInt(value, min int) bool {
 	return value >= min
@@ -2,6 +2,8 @@ package admin
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -13,20 +15,22 @@ import (
 
 // AdminHandler manages the web interface for system administration
 type AdminHandler struct {
-	xparams   config.XParams
-	tmplMgr   *core.TemplateManager
-	userRepo  UserRepo
-	roleRepo  RoleRepo
-	grantRepo GrantRepo
+	xparams            config.XParams
+	tmplMgr            *core.TemplateManager
+	userRepo           UserRepo
+	roleRepo           RoleRepo
+	grantRepo          GrantRepo
+	serviceAccountRepo ServiceAccountRepo
 }
 
-func NewAdminHandler(tmplMgr *core.TemplateManager, userRepo UserRepo, roleRepo RoleRepo, grantRepo GrantRepo, xparams config.XParams) *AdminHandler {
+func NewAdminHandler(tmplMgr *core.TemplateManager, userRepo UserRepo, roleRepo RoleRepo, grantRepo GrantRepo, serviceAccountRepo ServiceAccountRepo, xparams config.XParams) *AdminHandler {
 	return &AdminHandler{
-		xparams:   xparams,
-		tmplMgr:   tmplMgr,
-		userRepo:  userRepo,
-		roleRepo:  roleRepo,
-		grantRepo: grantRepo,
+		xparams:            xparams,
+		tmplMgr:            tmplMgr,
+		userRepo:           userRepo,
+		roleRepo:           roleRepo,
+		grantRepo:          grantRepo,
+		serviceAccountRepo: serviceAccountRepo,
 	}
 }
 
@@ -59,6 +63,21 @@ func (h *AdminHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/user-grants/{userId}", h.UserGrants)
 	r.Post("/create-grant", h.CreateGrant)
 	r.Post("/delete-grant/{id}", h.DeleteGrant)
+	r.Get("/explain-grant/{userId}", h.ExplainGrant)
+
+	h.xparams.Log.Info("Registering service account management routes...")
+	r.Group(func(r chi.Router) {
+		// Service accounts live in authn, called with the admin's token
+		r.Use(WithCallerToken)
+		r.Get("/list-service-accounts", h.ListServiceAccounts)
+		r.Get("/new-service-account", h.NewServiceAccount)
+		r.Post("/create-service-account", h.CreateServiceAccount)
+		r.Get("/show-service-account/{id}", h.ShowServiceAccount)
+		r.Post("/disable-service-account/{id}", h.DisableServiceAccount)
+		r.Get("/service-account-grants/{id}", h.ServiceAccountGrants)
+		r.Post("/create-api-key/{id}", h.CreateAPIKey)
+		r.Post("/revoke-api-key/{id}/{keyId}", h.RevokeAPIKey)
+	})
 
 	h.xparams.Log.Info("Admin routes registered successfully")
 }
@@ -607,6 +626,12 @@ func (h *AdminHandler) CreateGrant(w http.ResponseWriter, r *http.Request) {
 
 	h.xparams.Log.Info("Grant created successfully", "id", grant.ID, "user_id", grant.UserID)
 
+	if r.FormValue("principal") == "service-account" {
+		w.Header().Set("HX-Redirect", "/service-account-grants/"+userID.String())
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
 	w.Header().Set("HX-Redirect", "/user-grants/"+userID.String())
 	w.WriteHeader(http.StatusOK)
 }
@@ -633,3 +658,353 @@ func (h *AdminHandler) DeleteGrant(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// ExplainGrant renders why a user or service account has a permission or
+// not: the grants considered and what each contributed. Scopes are flat
+// here, grants only apply to their own scope and globally.
+func (h *AdminHandler) ExplainGrant(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userId"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	permission := strings.TrimSpace(r.URL.Query().Get("permission"))
+	if permission == "" {
+		http.Error(w, "Permission is required", http.StatusBadRequest)
+		return
+	}
+
+	scope := authpkg.Scope{Type: r.URL.Query().Get("scope_type"), ID: r.URL.Query().Get("scope_id")}
+	if scope.Type == "" {
+		scope.Type = "global"
+	}
+
+	grants, err := h.grantRepo.ListByUser(r.Context(), userID)
+	if err != nil {
+		h.xparams.Log.Error("error fetching grants", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	roles, err := h.roleRepo.List(r.Context())
+	if err != nil {
+		h.xparams.Log.Error("error fetching roles", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	authGrants := make([]authpkg.Grant, 0, len(grants))
+	for _, grant := range grants {
+		authGrants = append(authGrants, grant.authGrant())
+	}
+
+	authRoles := make([]authpkg.Role, 0, len(roles))
+	for _, role := range roles {
+		if role.Status == "active" {
+			authRoles = append(authRoles, role.authRole())
+		}
+	}
+
+	trace := authpkg.ExplainPermissions(authGrants, authRoles, permission, scope, nil, time.Now())
+
+	tmpl, err := h.tmplMgr.Get("user-grants.html")
+	if err != nil {
+		h.xparams.Log.Error("error getting user-grants template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "grant-explain", trace); err != nil {
+		h.xparams.Log.Error("error executing template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func (h *AdminHandler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := h.tmplMgr.Get("service-accounts.html")
+	if err != nil {
+		h.xparams.Log.Error("error getting service-accounts template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	accounts, err := h.serviceAccountRepo.List(r.Context())
+	if err != nil {
+		h.xparams.Log.Error("error fetching service accounts", "error", err)
+		status := authnStatus(err, http.StatusInternalServerError)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":           "Service Accounts",
+		"ActiveNav":       "service-accounts",
+		"Template":        "service-accounts-content",
+		"ServiceAccounts": accounts,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base.html", data); err != nil {
+		h.xparams.Log.Error("error executing service-accounts template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func (h *AdminHandler) NewServiceAccount(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := h.tmplMgr.Get("new-service-account.html")
+	if err != nil {
+		h.xparams.Log.Error("error getting new-service-account template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":     "New Service Account",
+		"ActiveNav": "service-accounts",
+		"Template":  "new-service-account",
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base.html", data); err != nil {
+		h.xparams.Log.Error("error executing base template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func (h *AdminHandler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.xparams.Log.Error("error parsing form", "error", err)
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	req := &CreateServiceAccountRequest{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: r.FormValue("description"),
+	}
+
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	account, err := h.serviceAccountRepo.Create(r.Context(), req)
+	if err != nil {
+		h.xparams.Log.Error("error creating service account", "error", err)
+		http.Error(w, "Cannot create service account: "+err.Error(), authnStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	h.xparams.Log.Info("Service account created successfully", "id", account.ID, "name", account.Name)
+
+	w.Header().Set("HX-Redirect", "/show-service-account/"+account.ID.String())
+	w.WriteHeader(http.StatusOK)
+}
+
+// ShowServiceAccount renders an account with its keys and the form to
+// create new ones.
+func (h *AdminHandler) ShowServiceAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.serviceAccountParam(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := h.serviceAccountRepo.ListKeys(r.Context(), account.ID)
+	if err != nil {
+		h.xparams.Log.Error("error fetching api keys", "error", err, "id", account.ID)
+		status := authnStatus(err, http.StatusInternalServerError)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	tmpl, err := h.tmplMgr.Get("show-service-account.html")
+	if err != nil {
+		h.xparams.Log.Error("error getting show-service-account template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":              "View Service Account",
+		"ActiveNav":          "service-accounts",
+		"Template":           "show-service-account",
+		"ServiceAccount":     account,
+		"Keys":               keys,
+		"PermissionRegistry": authpkg.PermissionRegistry,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base.html", data); err != nil {
+		h.xparams.Log.Error("error executing template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func (h *AdminHandler) DisableServiceAccount(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.serviceAccountParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.serviceAccountRepo.Disable(r.Context(), account.ID); err != nil {
+		h.xparams.Log.Error("error disabling service account", "error", err, "id", account.ID)
+		http.Error(w, "Cannot disable service account", authnStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	h.xparams.Log.Info("Service account disabled successfully", "id", account.ID)
+	w.Header().Set("HX-Redirect", "/show-service-account/"+account.ID.String())
+	w.WriteHeader(http.StatusOK)
+}
+
+// ServiceAccountGrants renders the grants screen of users for a service
+// account; authz grants apply to both in the same way.
+func (h *AdminHandler) ServiceAccountGrants(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.serviceAccountParam(w, r)
+	if !ok {
+		return
+	}
+
+	grants, err := h.grantRepo.ListByUser(r.Context(), account.ID)
+	if err != nil {
+		h.xparams.Log.Error("error fetching grants", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	roles, err := h.roleRepo.List(r.Context())
+	if err != nil {
+		h.xparams.Log.Error("error fetching roles", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := h.tmplMgr.Get("user-grants.html")
+	if err != nil {
+		h.xparams.Log.Error("error getting user-grants template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":              "Service Account Grants",
+		"ActiveNav":          "service-accounts",
+		"Template":           "user-grants",
+		"User":               account,
+		"ServiceAccount":     true,
+		"Grants":             grants,
+		"Roles":              roles,
+		"PermissionRegistry": authpkg.PermissionRegistry,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base.html", data); err != nil {
+		h.xparams.Log.Error("error executing template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// CreateAPIKey creates a key and renders it in place of the form. This is the
+// only time the key is shown.
+func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.serviceAccountParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.xparams.Log.Error("error parsing form", "error", err)
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	req := &CreateAPIKeyRequest{
+		Name:   strings.TrimSpace(r.FormValue("name")),
+		Scopes: r.Form["scopes"],
+	}
+
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	if expires := r.FormValue("expires_at"); expires != "" {
+		expiresAt, err := time.Parse("2006-01-02", expires)
+		if err != nil || !expiresAt.After(time.Now()) {
+			http.Error(w, "Expiration must be a future date", http.StatusBadRequest)
+			return
+		}
+		req.ExpiresAt = &expiresAt
+	}
+
+	key, raw, err := h.serviceAccountRepo.CreateKey(r.Context(), account.ID, req)
+	if err != nil {
+		h.xparams.Log.Error("error creating api key", "error", err, "id", account.ID)
+		http.Error(w, "Cannot create API key: "+err.Error(), authnStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	h.xparams.Log.Info("API key created successfully", "id", account.ID, "api_key_id", key.ID)
+
+	tmpl, err := h.tmplMgr.Get("show-service-account.html")
+	if err != nil {
+		h.xparams.Log.Error("error getting show-service-account template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"ServiceAccount": account,
+		"Key":            key,
+		"Secret":         raw,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if err := tmpl.ExecuteTemplate(w, "api-key-created", data); err != nil {
+		h.xparams.Log.Error("error executing template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func (h *AdminHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.serviceAccountParam(w, r)
+	if !ok {
+		return
+	}
+
+	keyID, err := uuid.Parse(chi.URLParam(r, "keyId"))
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.serviceAccountRepo.RevokeKey(r.Context(), account.ID, keyID); err != nil {
+		h.xparams.Log.Error("error revoking api key", "error", err, "api_key_id", keyID)
+		http.Error(w, "Cannot revoke API key", authnStatus(err, http.StatusNotFound))
+		return
+	}
+
+	h.xparams.Log.Info("API key revoked successfully", "id", account.ID, "api_key_id", keyID)
+	w.Header().Set("HX-Redirect", "/show-service-account/"+account.ID.String())
+	w.WriteHeader(http.StatusOK)
+}
+
+// serviceAccountParam reads the service account named by the id URL parameter.
+func (h *AdminHandler) serviceAccountParam(w http.ResponseWriter, r *http.Request) (*ServiceAccount, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid service account ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	account, err := h.serviceAccountRepo.Get(r.Context(), id)
+	if err != nil {
+		h.xparams.Log.Error("error fetching service account", "error", err, "id", id)
+		status := authnStatus(err, http.StatusInternalServerError)
+		if status == http.StatusNotFound {
+			http.Error(w, "Service account not found", status)
+		} else {
+			http.Error(w, http.StatusText(status), status)
+		}
+		return nil, false
+	}
+
+	return account, true
+}
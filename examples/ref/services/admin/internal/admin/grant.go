@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
 )
 
 // Grant represents a permission grant to a user in the admin interface
@@ -43,3 +45,15 @@ type GrantWithDetails struct {
 	PermissionName string   // If grant_type is "permission"
 	Permissions    []string // Effective permissions from role
 }
+
+// authGrant converts the grant to the auth library type
+func (g *Grant) authGrant() authpkg.Grant {
+	return authpkg.Grant{
+		ID:        g.ID,
+		UserID:    g.UserID,
+		GrantType: authpkg.GrantType(g.GrantType),
+		Value:     g.Value,
+		Scope:     authpkg.Scope{Type: g.Scope.Type, ID: g.Scope.ID},
+		ExpiresAt: g.ExpiresAt,
+	}
+}
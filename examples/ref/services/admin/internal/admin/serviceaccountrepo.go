@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// ServiceAccountRepo defines the interface for service account management operations in admin
+type ServiceAccountRepo interface {
+	// Create creates a new service account
+	Create(ctx context.Context, req *CreateServiceAccountRequest) (*ServiceAccount, error)
+
+	// Get retrieves a service account by ID
+	Get(ctx context.Context, id uuid.UUID) (*ServiceAccount, error)
+
+	// List retrieves all service accounts
+	List(ctx context.Context) ([]*ServiceAccount, error)
+
+	// Disable suspends a service account and revokes its keys
+	Disable(ctx context.Context, id uuid.UUID) error
+
+	// ListKeys retrieves the keys of a service account, newest first
+	ListKeys(ctx context.Context, accountID uuid.UUID) ([]*APIKey, error)
+
+	// CreateKey creates a key for a service account and returns it with the
+	// key string, which cannot be retrieved again
+	CreateKey(ctx context.Context, accountID uuid.UUID, req *CreateAPIKeyRequest) (*APIKey, string, error)
+
+	// RevokeKey revokes a key of a service account
+	RevokeKey(ctx context.Context, accountID, keyID uuid.UUID) error
+}
@@ -0,0 +1,84 @@
+package authn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+const (
+	testAdminToken = "admin-token"
+	testAdminID    = "admin-user"
+)
+
+// newTestAdminGuard admits testAdminToken as an admin holding every
+// permission, and each of users, a token to user ID map, without permissions.
+func newTestAdminGuard(xparams config.XParams, users map[string]string) *AdminGuard {
+	tokens := map[string]string{testAdminToken: testAdminID}
+	for token, userID := range users {
+		tokens[token] = userID
+	}
+
+	return NewAdminGuard(
+		core.NewFakeAuthenticatorWithTokens(tokens),
+		core.NewFakeAuthzClientWithGrants(map[string][]string{testAdminID: {"*"}}),
+		xparams,
+	)
+}
+
+func TestAdminGuardRequire(t *testing.T) {
+	xparams := config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{}}
+	guard := newTestAdminGuard(xparams, map[string]string{"user-token": "user-1"})
+	closed := NewAdminGuard(core.NewFakeAuthenticatorWithTokens(map[string]string{testAdminToken: testAdminID}), nil, xparams)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name           string
+		guard          *AdminGuard
+		token          string
+		expectedStatus int
+	}{
+		{"no token", guard, "", http.StatusUnauthorized},
+		{"invalid token", guard, "invalid", http.StatusUnauthorized},
+		{"missing permission", guard, "user-token", http.StatusForbidden},
+		{"admin", guard, testAdminToken, http.StatusNoContent},
+		{"no authz service", closed, testAdminToken, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := chi.NewRouter()
+			router.With(tt.guard.Require("users:write")).Get("/guarded", ok)
+
+			req := httptest.NewRequest(http.MethodGet, "/guarded", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestNewAuthzPermissions(t *testing.T) {
+	if client := NewAuthzPermissions(config.XParams{Cfg: &config.Config{}}); client != nil {
+		t.Errorf("NewAuthzPermissions() without a URL = %v, want nil", client)
+	}
+
+	cfg := &config.Config{Services: config.ServicesConfig{AuthzURL: "http://authz:8080/"}}
+	if client := NewAuthzPermissions(config.XParams{Cfg: cfg}); client == nil {
+		t.Error("NewAuthzPermissions() = nil, want a client")
+	}
+}
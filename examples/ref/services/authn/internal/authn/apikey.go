@@ -0,0 +1,53 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey is a named credential of a service account. The key handed out is
+// Prefix followed by a secret; only the prefix and the hash of the secret are
+// stored, so a lost key cannot be shown again, only revoked and replaced.
+type APIKey struct {
+	ID               uuid.UUID  `json:"id" db:"id" bson:"_id"`
+	ServiceAccountID uuid.UUID  `json:"service_account_id" db:"service_account_id" bson:"service_account_id"`
+	Name             string     `json:"name" db:"name" bson:"name"`
+	Prefix           string     `json:"prefix" db:"prefix" bson:"prefix"`
+	SecretHash       []byte     `json:"-" db:"secret_hash" bson:"secret_hash"`
+	Scopes           []string   `json:"scopes" db:"scopes" bson:"scopes"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" db:"expires_at" bson:"expires_at,omitempty"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty" db:"last_used_at" bson:"last_used_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty" db:"revoked_at" bson:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at" bson:"created_at"`
+}
+
+// Active reports whether the key can still be used.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// APIKeyRepo persists API keys.
+type APIKeyRepo interface {
+	// Create stores a new APIKey.
+	Create(ctx context.Context, key *APIKey) error
+
+	// Get retrieves an APIKey by ID, or nil if there is none.
+	Get(ctx context.Context, id uuid.UUID) (*APIKey, error)
+
+	// GetByPrefix retrieves an APIKey by prefix, or nil if there is none.
+	GetByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+
+	// ListByServiceAccount retrieves every key of a service account, newest first.
+	ListByServiceAccount(ctx context.Context, accountID uuid.UUID) ([]*APIKey, error)
+
+	// Revoke marks an APIKey revoked. Revoking twice keeps the first time.
+	Revoke(ctx context.Context, id uuid.UUID, at time.Time) error
+
+	// RevokeByServiceAccount revokes the unrevoked keys of a service account.
+	RevokeByServiceAccount(ctx context.Context, accountID uuid.UUID, at time.Time) error
+
+	// Touch records the last time a key was used.
+	Touch(ctx context.Context, id uuid.UUID, at time.Time) error
+}
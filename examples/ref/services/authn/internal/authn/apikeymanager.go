@@ -0,0 +1,157 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+// APIKeyAudience is the audience of the claims returned for API keys.
+const APIKeyAudience = "api_key"
+
+var (
+	// ErrInvalidAPIKey is returned for unknown, wrong, expired or revoked API keys.
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrServiceAccountDisabled is returned when issuing keys for a disabled account.
+	ErrServiceAccountDisabled = errors.New("service account disabled")
+)
+
+// APIKeyManager issues and verifies the API keys of service accounts.
+// Services do not verify keys themselves: they introspect them with authn,
+// which returns the claims of the key as if it were an access token.
+type APIKeyManager struct {
+	accounts ServiceAccountRepo
+	keys     APIKeyRepo
+	log      core.Logger
+	now      func() time.Time
+}
+
+// NewAPIKeyManager creates an API key manager.
+func NewAPIKeyManager(accounts ServiceAccountRepo, keys APIKeyRepo, xparams config.XParams) *APIKeyManager {
+	return &APIKeyManager{
+		accounts: accounts,
+		keys:     keys,
+		log:      xparams.Log,
+		now:      time.Now,
+	}
+}
+
+// Issue creates a key for an active account and returns it with the key
+// string, which is not stored and cannot be shown again.
+func (m *APIKeyManager) Issue(ctx context.Context, account *ServiceAccount, name string, scopes []string, expiresAt *time.Time) (*APIKey, string, error) {
+	if !account.Active() {
+		return nil, "", ErrServiceAccountDisabled
+	}
+
+	raw, id, hash := authpkg.GenerateAPIKey()
+	key := &APIKey{
+		ID:               uuid.New(),
+		ServiceAccountID: account.ID,
+		Name:             name,
+		Prefix:           authpkg.APIKeyPrefix + id,
+		SecretHash:       hash,
+		Scopes:           normalizeScopes(scopes),
+		ExpiresAt:        expiresAt,
+		CreatedAt:        m.now(),
+	}
+
+	if err := m.keys.Create(ctx, key); err != nil {
+		return nil, "", fmt.Errorf("cannot create api key: %w", err)
+	}
+
+	return key, raw, nil
+}
+
+// Authenticate verifies an API key and returns it with its account. Keys of
+// disabled accounts are rejected.
+func (m *APIKeyManager) Authenticate(ctx context.Context, raw string) (*APIKey, *ServiceAccount, error) {
+	id, secret, err := authpkg.ParseAPIKey(raw)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := m.keys.GetByPrefix(ctx, authpkg.APIKeyPrefix+id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot get api key: %w", err)
+	}
+	now := m.now()
+	if key == nil || !authpkg.VerifyAPIKeySecret(secret, key.SecretHash) || !key.Active(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	account, err := m.accounts.Get(ctx, key.ServiceAccountID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot get service account: %w", err)
+	}
+	if account == nil || !account.Active() {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if err := m.keys.Touch(ctx, key.ID, now); err != nil {
+		m.log.Error("cannot record api key use", "error", err, "api_key_id", key.ID)
+	}
+
+	return key, account, nil
+}
+
+// Claims returns the claims services see for a key. The subject is the
+// account, so its grants apply, and the key ID stands in for a session.
+func (m *APIKeyManager) Claims(key *APIKey, account *ServiceAccount) authpkg.TokenClaims {
+	claims := authpkg.TokenClaims{
+		Subject:     account.ID.String(),
+		SessionID:   key.ID.String(),
+		Audience:    APIKeyAudience,
+		Context:     map[string]string{"type": "global"},
+		IssuedAt:    m.now().Unix(),
+		TokenID:     key.ID.String(),
+		SubjectType: authpkg.SubjectTypeServiceAccount,
+		Scopes:      key.Scopes,
+	}
+	if key.ExpiresAt != nil {
+		claims.ExpiresAt = key.ExpiresAt.Unix()
+	}
+	return claims
+}
+
+// Revoke revokes a key of an account.
+func (m *APIKeyManager) Revoke(ctx context.Context, key *APIKey) error {
+	return m.keys.Revoke(ctx, key.ID, m.now())
+}
+
+// Disable suspends an account and revokes all of its keys.
+func (m *APIKeyManager) Disable(ctx context.Context, account *ServiceAccount) error {
+	account.Status = authpkg.UserStatusSuspended
+	account.UpdatedAt = m.now()
+	if err := m.accounts.Save(ctx, account); err != nil {
+		return fmt.Errorf("cannot save service account: %w", err)
+	}
+
+	if err := m.keys.RevokeByServiceAccount(ctx, account.ID, m.now()); err != nil {
+		return fmt.Errorf("cannot revoke api keys: %w", err)
+	}
+
+	return nil
+}
+
+// normalizeScopes trims scopes and drops empty and repeated ones.
+func normalizeScopes(scopes []string) []string {
+	normalized := make([]string, 0, len(scopes))
+	seen := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		normalized = append(normalized, scope)
+	}
+	return normalized
+}
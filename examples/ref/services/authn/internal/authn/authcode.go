@@ -0,0 +1,35 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuthorizationCode is issued to an OIDC client once the user signs in and
+// consents, and redeemed at the token endpoint with the PKCE verifier. Only
+// the hash of the code is stored, and a code is good for one exchange.
+type AuthorizationCode struct {
+	Hash          []byte     `json:"-" db:"hash" bson:"_id"`
+	ClientID      uuid.UUID  `json:"client_id" db:"client_id" bson:"client_id"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id" bson:"user_id"`
+	RedirectURI   string     `json:"redirect_uri" db:"redirect_uri" bson:"redirect_uri"`
+	Scopes        []string   `json:"scopes" db:"scopes" bson:"scopes"`
+	Nonce         string     `json:"nonce,omitempty" db:"nonce" bson:"nonce,omitempty"`
+	CodeChallenge string     `json:"-" db:"code_challenge" bson:"code_challenge"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at" bson:"created_at"`
+	ExpiresAt     time.Time  `json:"expires_at" db:"expires_at" bson:"expires_at"`
+	UsedAt        *time.Time `json:"used_at,omitempty" db:"used_at" bson:"used_at,omitempty"`
+}
+
+// AuthorizationCodeRepo persists authorization codes.
+type AuthorizationCodeRepo interface {
+	// Create stores a new AuthorizationCode.
+	Create(ctx context.Context, code *AuthorizationCode) error
+
+	// Consume marks the unused code with the given hash used at the given
+	// time and returns it. It returns nil for unknown and used codes, so two
+	// exchanges of the same code cannot both win.
+	Consume(ctx context.Context, hash []byte, at time.Time) (*AuthorizationCode, error)
+}
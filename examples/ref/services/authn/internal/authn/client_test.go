@@ -0,0 +1,194 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/adrianpk/hatmax-ref/pkg/client"
+	authnclient "github.com/adrianpk/hatmax-ref/pkg/client/authn"
+)
+
+func newTestAuthnClient(t *testing.T) *authnclient.Client {
+	t.Helper()
+
+	authHandler, repo := setupAuthHandler()
+
+	router := chi.NewRouter()
+	authHandler.RegisterRoutes(router)
+	NewUserHandler(repo, authHandler.mfa, newTestPrivacy(authHandler, nil), newTestAdminGuard(authHandler.xparams, nil), authHandler.xparams).RegisterRoutes(router)
+
+	accounts, keys := newMockServiceAccountRepo(), newMockAPIKeyRepo()
+	apiKeys := NewAPIKeyManager(accounts, keys, authHandler.xparams)
+	NewServiceAccountHandler(accounts, keys, apiKeys, newTestAdminGuard(authHandler.xparams, nil), authHandler.xparams).RegisterRoutes(router)
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return authnclient.New(srv.URL, client.WithRetryPolicy(client.NoRetry))
+}
+
+func TestClientSignUpAndSignIn(t *testing.T) {
+	c := newTestAuthnClient(t)
+	ctx := context.Background()
+	creds := authnclient.Credentials{Email: "client@example.com", Password: "ValidPassword123!"}
+
+	signedUp, err := c.SignUp(ctx, creds)
+	if err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+	if signedUp.User == nil || signedUp.User.ID == "" {
+		t.Fatal("SignUp() returned no user")
+	}
+
+	if _, err := c.SignUp(ctx, creds); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("SignUp() duplicate error = %v, want ErrConflict", err)
+	}
+
+	signedIn, err := c.SignIn(ctx, creds)
+	if err != nil {
+		t.Fatalf("SignIn() error = %v", err)
+	}
+	if signedIn.User.ID != signedUp.User.ID {
+		t.Errorf("SignIn() user = %s, want %s", signedIn.User.ID, signedUp.User.ID)
+	}
+
+	got, err := c.GetUser(ctx, signedUp.User.ID)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if got.ID != signedUp.User.ID {
+		t.Errorf("GetUser() ID = %s, want %s", got.ID, signedUp.User.ID)
+	}
+
+	if err := c.SignOut(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("SignOut() without token error = %v, want ErrUnauthorized", err)
+	}
+
+	authed := client.ContextWithToken(ctx, signedIn.Token)
+	if err := c.SignOut(authed); err != nil {
+		t.Errorf("SignOut() error = %v", err)
+	}
+	if _, err := c.Refresh(ctx, signedIn.RefreshToken); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("Refresh() after sign out error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestClientSessions(t *testing.T) {
+	c := newTestAuthnClient(t)
+	ctx := context.Background()
+	creds := authnclient.Credentials{Email: "client@example.com", Password: "ValidPassword123!"}
+
+	if _, err := c.SignUp(ctx, creds); err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+	first, err := c.SignIn(ctx, creds)
+	if err != nil {
+		t.Fatalf("SignIn() error = %v", err)
+	}
+	second, err := c.SignIn(ctx, creds)
+	if err != nil {
+		t.Fatalf("SignIn() error = %v", err)
+	}
+
+	refreshed, err := c.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if refreshed.Token == "" || refreshed.RefreshToken == first.RefreshToken {
+		t.Error("Refresh() did not rotate the tokens")
+	}
+
+	authed := client.ContextWithToken(ctx, refreshed.Token)
+	sessions, err := c.ListSessions(authed)
+	if err != nil {
+		t.Fatalf("ListSessions() error = %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("ListSessions() = %d sessions, want 2", len(sessions))
+	}
+
+	var other string
+	for _, session := range sessions {
+		if !session.Current {
+			other = session.ID
+		}
+	}
+	if err := c.RevokeSession(authed, other); err != nil {
+		t.Fatalf("RevokeSession() error = %v", err)
+	}
+	if _, err := c.Refresh(ctx, second.RefreshToken); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("Refresh() of revoked session error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestClientSignInWrongPassword(t *testing.T) {
+	c := newTestAuthnClient(t)
+	ctx := context.Background()
+
+	if _, err := c.SignUp(ctx, authnclient.Credentials{Email: "client@example.com", Password: "ValidPassword123!"}); err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+
+	_, err := c.SignIn(ctx, authnclient.Credentials{Email: "client@example.com", Password: "WrongPassword123!"})
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("SignIn() error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestClientSignUpValidation(t *testing.T) {
+	c := newTestAuthnClient(t)
+
+	_, err := c.SignUp(context.Background(), authnclient.Credentials{Email: "invalid-email", Password: "123"})
+	if !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("SignUp() error = %v, want ErrBadRequest", err)
+	}
+}
+
+func TestClientServiceAccounts(t *testing.T) {
+	c := newTestAuthnClient(t)
+	ctx := client.ContextWithToken(context.Background(), testAdminToken)
+
+	account, err := c.CreateServiceAccount(ctx, authnclient.ServiceAccountInput{Name: "billing-worker"})
+	if err != nil {
+		t.Fatalf("CreateServiceAccount() error = %v", err)
+	}
+
+	key, err := c.CreateAPIKey(ctx, account.ID, authnclient.APIKeyInput{Name: "ci", Scopes: []string{"invoice:read"}})
+	if err != nil {
+		t.Fatalf("CreateAPIKey() error = %v", err)
+	}
+	if key.Key == "" || key.ServiceAccountID != account.ID {
+		t.Errorf("CreateAPIKey() = %+v, want a key of the account", key)
+	}
+
+	keys, err := c.ListAPIKeys(ctx, account.ID)
+	if err != nil {
+		t.Fatalf("ListAPIKeys() error = %v", err)
+	}
+	if len(keys) != 1 || keys[0].Key != "" {
+		t.Errorf("ListAPIKeys() = %+v, want one key without its secret", keys)
+	}
+
+	if err := c.RevokeAPIKey(ctx, account.ID, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey() error = %v", err)
+	}
+	if err := c.DisableServiceAccount(ctx, account.ID); err != nil {
+		t.Fatalf("DisableServiceAccount() error = %v", err)
+	}
+
+	got, err := c.GetServiceAccount(ctx, account.ID)
+	if err != nil {
+		t.Fatalf("GetServiceAccount() error = %v", err)
+	}
+	if got.Status != "suspended" {
+		t.Errorf("Status = %s, want suspended", got.Status)
+	}
+
+	if _, err := c.CreateAPIKey(ctx, account.ID, authnclient.APIKeyInput{Name: "again"}); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("CreateAPIKey() for disabled account error = %v, want ErrConflict", err)
+	}
+}
@@ -0,0 +1,45 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+)
+
+// Consent is a persisted authpkg.ConsentRecord. Records are only appended,
+// a withdrawal being a record that is not granted, so they keep the history
+// of what the user agreed to. The source IP is sealed with the user data key
+// and is shredded with it, while the record itself outlives erasure.
+type Consent struct {
+	ID         uuid.UUID `json:"id" db:"id" bson:"_id"`
+	UserID     uuid.UUID `json:"user_id" db:"user_id" bson:"user_id"`
+	Type       string    `json:"type" db:"type" bson:"type"`
+	Scope      string    `json:"scope" db:"scope" bson:"scope"`
+	Granted    bool      `json:"granted" db:"granted" bson:"granted"`
+	SourceIPCT []byte    `json:"-" db:"source_ip_ct" bson:"source_ip_ct,omitempty"`
+	Timestamp  time.Time `json:"timestamp" db:"timestamp" bson:"timestamp"`
+}
+
+// Record returns the consent as an authpkg.ConsentRecord with its opened
+// source IP.
+func (c *Consent) Record(sourceIP string) authpkg.ConsentRecord {
+	return authpkg.ConsentRecord{
+		Type:      c.Type,
+		Scope:     c.Scope,
+		Granted:   c.Granted,
+		Timestamp: c.Timestamp,
+		SourceIP:  sourceIP,
+	}
+}
+
+// ConsentRepo persists consents.
+type ConsentRepo interface {
+	// Create appends a Consent.
+	Create(ctx context.Context, consent *Consent) error
+
+	// ListByUser retrieves the consents of a user, oldest first.
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*Consent, error)
+}
@@ -0,0 +1,33 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DataKey is the key a user's PII is encrypted with, itself wrapped under a
+// PII key version. Deleting it crypto-shreds everything sealed with it.
+type DataKey struct {
+	UserID    uuid.UUID `json:"user_id" db:"user_id" bson:"_id"`
+	KeyCT     []byte    `json:"-" db:"key_ct" bson:"key_ct"`
+	PIIKeyID  string    `json:"-" db:"pii_key_id" bson:"pii_key_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at" bson:"updated_at"`
+}
+
+// DataKeyRepo persists user data keys.
+type DataKeyRepo interface {
+	// Create stores the first DataKey of a user.
+	Create(ctx context.Context, key *DataKey) error
+
+	// Get retrieves the DataKey of a user, or nil if there is none.
+	Get(ctx context.Context, userID uuid.UUID) (*DataKey, error)
+
+	// Save replaces the wrapped key and its PII key ID.
+	Save(ctx context.Context, key *DataKey) error
+
+	// Delete removes the DataKey of a user.
+	Delete(ctx context.Context, userID uuid.UUID) error
+}
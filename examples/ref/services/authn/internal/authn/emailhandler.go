@@ -0,0 +1,126 @@
+package authn
+
+import (
+	"errors"
+	"net/http"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+)
+
+// ForgotPasswordRequest represents the payload requesting a password reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest represents the payload setting a new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// VerifyEmailRequest represents the payload verifying an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// ForgotPassword handles POST /authn/password/forgot. It responds 202 whether
+// or not the address has an account, so it cannot be used to find users.
+// Requests past the limits per address or per IP get 429.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	var req ForgotPasswordRequest
+	if !h.decodePayload(w, r, log, &req) {
+		return
+	}
+	if len(authpkg.ValidateEmail(req.Email)) > 0 {
+		core.RespondError(w, http.StatusBadRequest, "Valid email is required")
+		return
+	}
+
+	// Requests are counted whether or not the address has an account
+	ip := clientIP(r)
+	wait, err := h.limiter.AllowPasswordReset(r.Context(), h.pii.Lookup(authpkg.NormalizeEmail(req.Email)), ip)
+	if err != nil {
+		log.Error("error checking password reset requests", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not send password reset")
+		return
+	}
+	if wait > 0 {
+		log.Info("password reset throttled", "ip", ip, "retry_after", wait)
+		(&signInFailure{Status: http.StatusTooManyRequests, Message: "Too many password reset requests", RetryAfter: wait}).respond(w)
+		return
+	}
+
+	h.emails.SendPasswordReset(r.Context(), req.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword handles POST /authn/password/reset. A valid reset token sets
+// the new password and signs the user out of every session.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	var req ResetPasswordRequest
+	if !h.decodePayload(w, r, log, &req) {
+		return
+	}
+	if validationErrors := ValidatePasswordResetRequest(req.Token, req.Password); len(validationErrors) > 0 {
+		log.Debug("validation failed", "errors", validationErrors)
+		core.RespondError(w, http.StatusBadRequest, "Validation failed")
+		return
+	}
+
+	user, err := h.emails.ResetPassword(ctx, req.Token, req.Password)
+	if errors.Is(err, ErrInvalidEmailToken) {
+		log.Debug("invalid password reset token")
+		core.RespondError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		log.Error("error resetting password", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not reset password")
+		return
+	}
+
+	if err := h.sessions.RevokeAll(ctx, user.ID, RevokeReasonPasswordReset); err != nil {
+		log.Error("error revoking sessions", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not reset password")
+		return
+	}
+
+	log.Info("password reset", "user_id", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyEmail handles POST /authn/verify with the token of a verification mail.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	var req VerifyEmailRequest
+	if !h.decodePayload(w, r, log, &req) {
+		return
+	}
+	if req.Token == "" {
+		core.RespondError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	user, err := h.emails.VerifyEmail(r.Context(), req.Token)
+	if errors.Is(err, ErrInvalidEmailToken) {
+		log.Debug("invalid email verification token")
+		core.RespondError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		log.Error("error verifying email", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not verify email")
+		return
+	}
+
+	log.Debug("email verified", "user_id", user.ID)
+	core.RespondSuccess(w, AuthResponse{User: user})
+}
@@ -0,0 +1,383 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+)
+
+type mockEmailTokenRepo struct {
+	mu     sync.Mutex
+	tokens map[uuid.UUID]EmailToken
+}
+
+func newMockEmailTokenRepo() *mockEmailTokenRepo {
+	return &mockEmailTokenRepo{tokens: make(map[uuid.UUID]EmailToken)}
+}
+
+func (m *mockEmailTokenRepo) Create(ctx context.Context, token *EmailToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[token.ID] = *token
+	return nil
+}
+
+func (m *mockEmailTokenRepo) Use(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.tokens[id]
+	if !ok || token.UsedAt != nil || !at.Before(token.ExpiresAt) {
+		return false, nil
+	}
+	token.UsedAt = &at
+	m.tokens[id] = token
+	return true, nil
+}
+
+func (m *mockEmailTokenRepo) UseAll(ctx context.Context, userID uuid.UUID, purpose string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, token := range m.tokens {
+		if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+			token.UsedAt = &at
+			m.tokens[id] = token
+		}
+	}
+	return nil
+}
+
+// setupEmails returns a handler whose email manager runs on a fixed clock,
+// the mailer it sends with and an active user with a known password.
+func setupEmails(t *testing.T) (*AuthHandler, *core.MemoryMailer, *fixedClock, *User) {
+	t.Helper()
+	handler, _, clock, user := setupMFA(t)
+	handler.emails.now = clock.now
+	return handler, handler.emails.mailer.(*core.MemoryMailer), clock, user
+}
+
+// mailedToken returns the token of the link in the last message sent.
+func mailedToken(t *testing.T, mailer *core.MemoryMailer, path string) string {
+	t.Helper()
+	msg, ok := mailer.Last()
+	if !ok {
+		t.Fatal("no mail sent")
+	}
+	return linkToken(t, msg, path)
+}
+
+// linkToken returns the token of the link to path in a message.
+func linkToken(t *testing.T, msg core.Message, path string) string {
+	t.Helper()
+	prefix := "https://app.example.com" + path + "?token="
+	start := strings.Index(msg.Text, prefix)
+	if start < 0 {
+		t.Fatalf("mail text %q has no %s link", msg.Text, path)
+	}
+	link := strings.Fields(msg.Text[start:])[0]
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("cannot parse link %q: %v", link, err)
+	}
+	return parsed.Query().Get("token")
+}
+
+func TestEmailManagerVerification(t *testing.T) {
+	handler, mailer, clock, user := setupEmails(t)
+	emails := handler.emails
+	ctx := context.Background()
+
+	if err := emails.SendVerification(ctx, user); err != nil {
+		t.Fatalf("SendVerification() error = %v", err)
+	}
+
+	msg, _ := mailer.Last()
+	if msg.To[0] != "test@example.com" || msg.From != "no-reply@example.com" || msg.Subject != "Verify your email address" {
+		t.Errorf("message = %s -> %v %q", msg.From, msg.To, msg.Subject)
+	}
+	if !strings.Contains(msg.HTML, `href="https://app.example.com/verify-email?token=`) {
+		t.Errorf("HTML = %q, want a verification link", msg.HTML)
+	}
+
+	token := mailedToken(t, mailer, "/verify-email")
+
+	if _, err := emails.ResetPassword(ctx, token, "OtherPassword123!"); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("ResetPassword() with a verification token error = %v, want %v", err, ErrInvalidEmailToken)
+	}
+
+	verified, err := emails.VerifyEmail(ctx, token)
+	if err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+	if verified.EmailVerifiedAt == nil || !verified.EmailVerifiedAt.Equal(clock.now()) {
+		t.Errorf("EmailVerifiedAt = %v, want %v", verified.EmailVerifiedAt, clock.now())
+	}
+
+	if _, err := emails.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("VerifyEmail() reused token error = %v, want %v", err, ErrInvalidEmailToken)
+	}
+}
+
+func TestEmailManagerTokenExpires(t *testing.T) {
+	handler, mailer, clock, user := setupEmails(t)
+	ctx := context.Background()
+
+	if err := handler.emails.SendVerification(ctx, user); err != nil {
+		t.Fatalf("SendVerification() error = %v", err)
+	}
+	token := mailedToken(t, mailer, "/verify-email")
+
+	clock.advance(emailVerifyTTL + time.Second)
+	if _, err := handler.emails.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("VerifyEmail() expired token error = %v, want %v", err, ErrInvalidEmailToken)
+	}
+}
+
+func TestEmailManagerPasswordReset(t *testing.T) {
+	handler, mailer, _, user := setupEmails(t)
+	emails := handler.emails
+	ctx := context.Background()
+
+	emails.SendPasswordReset(ctx, "nobody@example.com")
+	emails.Stop(ctx)
+	if len(mailer.Messages()) != 0 {
+		t.Fatal("SendPasswordReset() mailed an unknown address")
+	}
+
+	for i := 0; i < 2; i++ {
+		emails.SendPasswordReset(ctx, " Test@Example.com ")
+		emails.Stop(ctx)
+	}
+	messages := mailer.Messages()
+	if len(messages) != 2 || messages[0].Subject != "Reset your password" {
+		t.Fatalf("messages = %d, want two reset mails", len(messages))
+	}
+	first := linkToken(t, messages[0], "/reset-password")
+	second := linkToken(t, messages[1], "/reset-password")
+
+	updated, err := emails.ResetPassword(ctx, first, "NewPassword123!")
+	if err != nil {
+		t.Fatalf("ResetPassword() error = %v", err)
+	}
+	if ok, _ := authpkg.CheckPassword([]byte("NewPassword123!"), updated.PasswordHash, updated.PasswordSalt, emails.passwords); !ok {
+		t.Error("ResetPassword() did not set the new password")
+	}
+	if updated.ID != user.ID {
+		t.Errorf("ResetPassword() user = %s, want %s", updated.ID, user.ID)
+	}
+
+	for name, token := range map[string]string{"used": first, "other": second} {
+		if _, err := emails.ResetPassword(ctx, token, "AnotherPassword123!"); !errors.Is(err, ErrInvalidEmailToken) {
+			t.Errorf("ResetPassword() %s token error = %v, want %v", name, err, ErrInvalidEmailToken)
+		}
+	}
+}
+
+// blockingMailer holds every message until released.
+type blockingMailer struct {
+	*core.MemoryMailer
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg core.Message) error {
+	<-m.release
+	return m.MemoryMailer.Send(ctx, msg)
+}
+
+func TestEmailManagerPasswordResetInBackground(t *testing.T) {
+	handler, mailer, _, _ := setupEmails(t)
+	emails := handler.emails
+	blocking := &blockingMailer{MemoryMailer: mailer, release: make(chan struct{})}
+	emails.mailer = blocking
+
+	// A known address returns as soon as an unknown one, before its mail is
+	// sent, so response times do not tell which addresses have accounts.
+	for _, email := range []string{"nobody@example.com", "test@example.com"} {
+		returned := make(chan struct{})
+		go func() {
+			emails.SendPasswordReset(context.Background(), email)
+			close(returned)
+		}()
+
+		select {
+		case <-returned:
+		case <-time.After(time.Second):
+			t.Fatalf("SendPasswordReset(%s) waited for the mail to be sent", email)
+		}
+	}
+
+	// The request context ending does not cancel the send.
+	ctx, cancel := context.WithCancel(context.Background())
+	emails.SendPasswordReset(ctx, "test@example.com")
+	cancel()
+
+	close(blocking.release)
+	emails.Stop(context.Background())
+
+	if got := len(mailer.Messages()); got != 2 {
+		t.Errorf("messages = %d, want 2 reset mails", got)
+	}
+}
+
+func TestEmailManagerPasswordResetDropsWhenFull(t *testing.T) {
+	handler, mailer, _, _ := setupEmails(t)
+	emails := handler.emails
+	blocking := &blockingMailer{MemoryMailer: mailer, release: make(chan struct{})}
+	emails.mailer = blocking
+	ctx := context.Background()
+
+	for i := 0; i < passwordResetMaxPending+5; i++ {
+		emails.SendPasswordReset(ctx, "test@example.com")
+	}
+	close(blocking.release)
+	emails.Stop(ctx)
+
+	if got := len(mailer.Messages()); got != passwordResetMaxPending {
+		t.Errorf("messages = %d, want %d, the rest dropped", got, passwordResetMaxPending)
+	}
+}
+
+func TestAuthHandler_ForgotPasswordLimits(t *testing.T) {
+	handler, _, _, _ := setupEmails(t)
+	defer handler.emails.Stop(context.Background())
+
+	forgot := func(email, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/authn/password/forgot", strings.NewReader(`{"email":"`+email+`"}`))
+		req.RemoteAddr = ip + ":1234"
+		rr := httptest.NewRecorder()
+		handler.ForgotPassword(rr, req)
+		return rr
+	}
+
+	// Per address, known or not, whatever the IP.
+	for _, email := range []string{"test@example.com", "nobody@example.com"} {
+		for i := 0; i < passwordResetMaxRequests; i++ {
+			if rr := forgot(email, fmt.Sprintf("198.51.100.%d", i)); rr.Code != http.StatusAccepted {
+				t.Fatalf("ForgotPassword(%s) request %d status = %d, want %d", email, i+1, rr.Code, http.StatusAccepted)
+			}
+		}
+		rr := forgot(email, "198.51.100.99")
+		if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+			t.Errorf("ForgotPassword(%s) past the limit = %d, Retry-After %q, want 429 with Retry-After", email, rr.Code, rr.Header().Get("Retry-After"))
+		}
+	}
+
+	// Per IP, across addresses.
+	for i := 0; i < passwordResetIPMaxRequests; i++ {
+		if rr := forgot(fmt.Sprintf("user%d@example.com", i), "203.0.113.7"); rr.Code != http.StatusAccepted {
+			t.Fatalf("ForgotPassword() request %d from one IP status = %d, want %d", i+1, rr.Code, http.StatusAccepted)
+		}
+	}
+	if rr := forgot("another@example.com", "203.0.113.7"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("ForgotPassword() past the IP limit status = %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestAuthHandler_PasswordReset(t *testing.T) {
+	handler, mailer, _, user := setupEmails(t)
+	ctx := context.Background()
+
+	tokens, err := handler.sessions.Start(ctx, user.ID, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	forgot := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"invalid email", `{"email":"not-an-email"}`, http.StatusBadRequest},
+		{"unknown email", `{"email":"nobody@example.com"}`, http.StatusAccepted},
+		{"known email", `{"email":"test@example.com"}`, http.StatusAccepted},
+	}
+	for _, tt := range forgot {
+		req := httptest.NewRequest(http.MethodPost, "/authn/password/forgot", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		handler.ForgotPassword(rr, req)
+		if rr.Code != tt.expectedStatus {
+			t.Errorf("ForgotPassword(%s) status = %d, want %d", tt.name, rr.Code, tt.expectedStatus)
+		}
+	}
+	handler.emails.Stop(ctx)
+
+	token := mailedToken(t, mailer, "/reset-password")
+
+	reset := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"weak password", `{"token":"` + token + `","password":"short"}`, http.StatusBadRequest},
+		{"invalid token", `{"token":"invalid","password":"NewPassword123!"}`, http.StatusBadRequest},
+		{"valid", `{"token":"` + token + `","password":"NewPassword123!"}`, http.StatusNoContent},
+		{"reused token", `{"token":"` + token + `","password":"NewPassword123!"}`, http.StatusBadRequest},
+	}
+	for _, tt := range reset {
+		req := httptest.NewRequest(http.MethodPost, "/authn/password/reset", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		handler.ResetPassword(rr, req)
+		if rr.Code != tt.expectedStatus {
+			t.Errorf("ResetPassword(%s) status = %d, want %d", tt.name, rr.Code, tt.expectedStatus)
+		}
+	}
+
+	if _, _, err := handler.sessions.Authenticate(ctx, tokens.AccessToken); err == nil {
+		t.Error("session survived the password reset")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/authn/signin", strings.NewReader(`{"email":"test@example.com","password":"NewPassword123!"}`))
+	rr := httptest.NewRecorder()
+	handler.SignIn(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("SignIn() with the new password status = %d, want %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestAuthHandler_VerifyEmailAfterSignUp(t *testing.T) {
+	handler, _ := setupAuthHandler()
+	mailer := handler.emails.mailer.(*core.MemoryMailer)
+
+	req := httptest.NewRequest(http.MethodPost, "/authn/signup", strings.NewReader(`{"email":"new@example.com","password":"ValidPassword123!"}`))
+	rr := httptest.NewRecorder()
+	handler.SignUp(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("SignUp() status = %d, want %d", rr.Code, http.StatusCreated)
+	}
+
+	token := mailedToken(t, mailer, "/verify-email")
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"missing token", `{}`, http.StatusBadRequest},
+		{"invalid token", `{"token":"invalid"}`, http.StatusBadRequest},
+		{"valid", `{"token":"` + token + `"}`, http.StatusOK},
+		{"reused token", `{"token":"` + token + `"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/authn/verify", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		handler.VerifyEmail(rr, req)
+		if rr.Code != tt.expectedStatus {
+			t.Errorf("VerifyEmail(%s) status = %d, want %d", tt.name, rr.Code, tt.expectedStatus)
+		}
+		if tt.name == "valid" && !strings.Contains(rr.Body.String(), `"email_verified_at"`) {
+			t.Errorf("VerifyEmail() body = %s, want email_verified_at", rr.Body.String())
+		}
+	}
+}
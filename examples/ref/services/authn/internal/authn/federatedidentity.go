@@ -0,0 +1,50 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FederatedIdentity links a user to the subject an upstream OpenID provider
+// knows them by. Once linked, the user signs in with that provider even if
+// the email at the provider changes.
+type FederatedIdentity struct {
+	ID         uuid.UUID  `json:"id" db:"id" bson:"_id"`
+	ProviderID string     `json:"provider_id" db:"provider_id" bson:"provider_id"`
+	Subject    string     `json:"subject" db:"subject" bson:"subject"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id" bson:"user_id"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at" bson:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at" bson:"last_used_at,omitempty"`
+}
+
+// GetID returns the ID of the FederatedIdentity.
+func (i *FederatedIdentity) GetID() uuid.UUID {
+	return i.ID
+}
+
+// ResourceType returns the resource type for URL generation.
+func (i *FederatedIdentity) ResourceType() string {
+	return "federated-identity"
+}
+
+// FederatedIdentityRepo persists federated identities.
+type FederatedIdentityRepo interface {
+	// Create stores a new FederatedIdentity. A provider subject links to one
+	// user only.
+	Create(ctx context.Context, identity *FederatedIdentity) error
+
+	// Find retrieves the identity of a provider subject, or nil if there is
+	// none.
+	Find(ctx context.Context, providerID, subject string) (*FederatedIdentity, error)
+
+	// ListByUser retrieves the identities linked to a user.
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*FederatedIdentity, error)
+
+	// Touch records that an identity was used to sign in.
+	Touch(ctx context.Context, id uuid.UUID, at time.Time) error
+
+	// DeleteByUser removes the identities linked to a user.
+	DeleteByUser(ctx context.Context, userID uuid.UUID) error
+}
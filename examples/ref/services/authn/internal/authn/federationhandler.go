@@ -0,0 +1,188 @@
+package authn
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+// FederationStateCookie holds the state token of a federated sign in between
+// the redirect to the provider and its callback.
+const FederationStateCookie = "hm_federation_state"
+
+// FederationHandler serves sign in with upstream OpenID Connect providers.
+// The callback answers as /authn/signin does: a session, or an mfa_pending
+// token for users with MFA enabled.
+type FederationHandler struct {
+	federation *Federation
+	auth       *AuthHandler
+	xparams    config.XParams
+}
+
+// NewFederationHandler creates a new FederationHandler.
+func NewFederationHandler(federation *Federation, auth *AuthHandler, xparams config.XParams) *FederationHandler {
+	return &FederationHandler{
+		federation: federation,
+		auth:       auth,
+		xparams:    xparams,
+	}
+}
+
+// FederatedProviderInfo describes a provider users can sign in with.
+type FederatedProviderInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	SignInURL string `json:"signin_url"`
+}
+
+func (h *FederationHandler) RegisterRoutes(r chi.Router) {
+	r.Route("/authn/federation", func(r chi.Router) {
+		r.Get("/", h.ListProviders)
+		r.Get("/{provider}", h.Begin)
+		r.Get("/{provider}/callback", h.Callback)
+	})
+}
+
+// ListProviders handles GET /authn/federation.
+func (h *FederationHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	providers := h.federation.Providers()
+
+	infos := make([]FederatedProviderInfo, 0, len(providers))
+	for _, provider := range providers {
+		infos = append(infos, FederatedProviderInfo{
+			ID:        provider.ID(),
+			Name:      provider.Name(),
+			SignInURL: "/authn/federation/" + provider.ID(),
+		})
+	}
+
+	core.RespondSuccess(w, infos)
+}
+
+// Begin handles GET /authn/federation/{provider}, redirecting the user to
+// the provider with the state of the sign in kept in a cookie.
+func (h *FederationHandler) Begin(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	providerID := chi.URLParam(r, "provider")
+
+	authURL, stateToken, expiresAt, err := h.federation.Begin(r.Context(), providerID)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrUnknownProvider):
+		core.RespondError(w, http.StatusNotFound, "Identity provider not found")
+		return
+	case errors.Is(err, ErrProviderUnavailable):
+		log.Error("identity provider unavailable", "provider", providerID, "error", err)
+		core.RespondError(w, http.StatusBadGateway, "Identity provider unavailable")
+		return
+	default:
+		log.Error("cannot start federated sign in", "provider", providerID, "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Authentication failed")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     FederationStateCookie,
+		Value:    stateToken,
+		Path:     "/authn/federation/" + providerID,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   h.secureCookie(),
+		// Lax, so the cookie comes back with the top level redirect from the
+		// provider
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback handles GET /authn/federation/{provider}/callback.
+func (h *FederationHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	providerID := chi.URLParam(r, "provider")
+	query := r.URL.Query()
+
+	// The state cookie is single use, whatever the outcome
+	http.SetCookie(w, &http.Cookie{
+		Name:     FederationStateCookie,
+		Path:     "/authn/federation/" + providerID,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secureCookie(),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if errCode := query.Get("error"); errCode != "" {
+		log.Info("federated sign in refused by provider", "provider", providerID, "error", errCode)
+		core.RespondError(w, http.StatusUnauthorized, "Sign in was not completed at the identity provider")
+		return
+	}
+
+	var stateToken string
+	if cookie, err := r.Cookie(FederationStateCookie); err == nil {
+		stateToken = cookie.Value
+	}
+	if stateToken == "" || query.Get("code") == "" {
+		core.RespondError(w, http.StatusBadRequest, "Invalid sign in state")
+		return
+	}
+
+	user, err := h.federation.Complete(r.Context(), providerID, stateToken, query.Get("state"), query.Get("code"))
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrUnknownProvider):
+		core.RespondError(w, http.StatusNotFound, "Identity provider not found")
+		return
+	case errors.Is(err, ErrInvalidFederationState):
+		log.Debug("invalid federation state", "provider", providerID)
+		core.RespondError(w, http.StatusBadRequest, "Invalid sign in state")
+		return
+	case errors.Is(err, ErrInvalidIDToken):
+		log.Info("invalid id token from identity provider", "provider", providerID, "error", err)
+		core.RespondError(w, http.StatusUnauthorized, "Authentication failed")
+		return
+	case errors.Is(err, ErrFederatedEmailUnverified):
+		core.RespondError(w, http.StatusForbidden, "Email not verified by the identity provider")
+		return
+	case errors.Is(err, ErrFederatedUserNotFound):
+		core.RespondError(w, http.StatusForbidden, "No account for this identity")
+		return
+	case errors.Is(err, ErrProviderUnavailable):
+		log.Error("identity provider unavailable", "provider", providerID, "error", err)
+		core.RespondError(w, http.StatusBadGateway, "Identity provider unavailable")
+		return
+	default:
+		log.Error("cannot complete federated sign in", "provider", providerID, "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Authentication failed")
+		return
+	}
+
+	if user.Status != authpkg.UserStatusActive {
+		log.Debug("user not active", "status", user.Status)
+		core.RespondError(w, http.StatusForbidden, "Account is not active")
+		return
+	}
+
+	h.auth.completeSignIn(w, r, log, user, clientIP(r))
+}
+
+// secureCookie reports whether the state cookie is limited to HTTPS, as it
+// is when providers call back over HTTPS.
+func (h *FederationHandler) secureCookie() bool {
+	return strings.HasPrefix(h.xparams.Cfg.Federation.CallbackURL, "https://")
+}
+
+func (h *FederationHandler) logForRequest(r *http.Request) core.Logger {
+	return h.xparams.Log.With(
+		"request_id", middleware.GetReqID(r.Context()),
+		"method", r.Method,
+		"path", r.URL.Path,
+	)
+}
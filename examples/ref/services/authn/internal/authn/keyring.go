@@ -0,0 +1,528 @@
+package authn
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+const (
+	// KeysPath serves the public keys verifiers fetch and cache by kid.
+	KeysPath = "/authn/keys"
+
+	// KeyAlgorithm is the token format the published keys verify.
+	KeyAlgorithm = "v4.public"
+
+	defaultKeyRotation     = 30 * 24 * time.Hour
+	defaultKeyVerifyPeriod = 48 * time.Hour
+	keyCheckInterval       = time.Hour
+	keyReloadInterval      = 5 * time.Second
+	keysMaxAge             = 5 * time.Minute
+)
+
+// ErrNoSigningKey is returned when the keyring has no active key.
+var ErrNoSigningKey = errors.New("no active signing key")
+
+// Keyring holds the token signing keys. One key is active and signs new
+// tokens. When it is older than the rotation interval a new key takes over
+// and the old one stays verifying for the verify period, so tokens it signed
+// remain valid until they expire, and then retires.
+// Keys are persisted with their private part encrypted, so issued tokens
+// survive restarts.
+type Keyring struct {
+	repo          SigningKeyRepo
+	encryptionKey []byte
+	bootstrapKey  string
+	rotation      time.Duration
+	verifyPeriod  time.Duration
+	log           core.Logger
+	now           func() time.Time
+
+	mu       sync.RWMutex
+	keys     []*SigningKey
+	active   *SigningKey
+	private  ed25519.PrivateKey
+	loadedAt time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewKeyring creates a keyring backed by repo. The verify period must cover
+// the access TTL, otherwise tokens would outlive their key.
+func NewKeyring(repo SigningKeyRepo, xparams config.XParams) (*Keyring, error) {
+	cfg := xparams.Cfg.Auth
+
+	rotation, err := parseKeyDuration(cfg.KeyRotation, defaultKeyRotation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key rotation: %w", err)
+	}
+
+	verifyPeriod, err := parseKeyDuration(cfg.KeyVerifyPeriod, defaultKeyVerifyPeriod)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key verify period: %w", err)
+	}
+
+	if accessTTL, err := time.ParseDuration(cfg.AccessTTL); err == nil && verifyPeriod < accessTTL {
+		return nil, fmt.Errorf("key verify period %s is shorter than access TTL %s", verifyPeriod, accessTTL)
+	}
+
+	return &Keyring{
+		repo:          repo,
+		encryptionKey: []byte(cfg.EncryptionKey),
+		bootstrapKey:  cfg.TokenPrivateKey,
+		rotation:      rotation,
+		verifyPeriod:  verifyPeriod,
+		log:           xparams.Log,
+		now:           time.Now,
+	}, nil
+}
+
+// Start loads the keys, creating the first one if there is none, and starts
+// the rotation schedule.
+func (k *Keyring) Start(ctx context.Context) error {
+	if err := k.ensureKeys(ctx); err != nil {
+		return err
+	}
+
+	k.stop = make(chan struct{})
+	k.done = make(chan struct{})
+	go k.schedule()
+
+	return nil
+}
+
+// Stop ends the rotation schedule.
+func (k *Keyring) Stop(ctx context.Context) error {
+	if k.stop == nil {
+		return nil
+	}
+
+	close(k.stop)
+	select {
+	case <-k.done:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// SigningKey returns the kid and private key new tokens are signed with.
+func (k *Keyring) SigningKey() (string, ed25519.PrivateKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.active == nil {
+		return "", nil, ErrNoSigningKey
+	}
+	return k.active.ID, k.private, nil
+}
+
+// PublicKeySet returns the active and verifying keys as k4.public PASERKs.
+func (k *Keyring) PublicKeySet() core.PublicKeySet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := core.PublicKeySet{Keys: make([]core.PublicKeyInfo, 0, len(k.keys))}
+	for _, key := range k.keys {
+		set.Keys = append(set.Keys, core.PublicKeyInfo{
+			ID:        key.ID,
+			Algorithm: KeyAlgorithm,
+			PublicKey: authpkg.PASERKPublic(key.PublicKey),
+			Status:    string(key.Status),
+		})
+	}
+	return set
+}
+
+// JWKSet returns the active and verifying keys as JSON Web Keys, for OIDC
+// clients verifying the JWTs signed by SignJWT. Kids match PublicKeySet.
+func (k *Keyring) JWKSet() authpkg.JWKSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := authpkg.JWKSet{Keys: make([]authpkg.JWK, 0, len(k.keys))}
+	for _, key := range k.keys {
+		set.Keys = append(set.Keys, authpkg.Ed25519JWK(key.ID, ed25519.PublicKey(key.PublicKey)))
+	}
+	return set
+}
+
+// PublicKeys returns the active and verifying public keys, so authn can
+// verify its own tokens with a core.PASETOAuthenticator.
+func (k *Keyring) PublicKeys(ctx context.Context) ([]ed25519.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := make([]ed25519.PublicKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, ed25519.PublicKey(key.PublicKey))
+	}
+	return keys, nil
+}
+
+// PublicKey returns the unretired public key with the given kid. Unknown
+// kids reload the keys, at most once every keyReloadInterval, as the key may
+// have been activated by another instance.
+func (k *Keyring) PublicKey(ctx context.Context, kid string) (ed25519.PublicKey, error) {
+	if key, ok := k.publicKey(kid); ok {
+		return key, nil
+	}
+
+	if err := k.reload(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := k.publicKey(kid); ok {
+		return key, nil
+	}
+	return nil, core.ErrUnknownKey
+}
+
+func (k *Keyring) publicKey(kid string) (ed25519.PublicKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.ID == kid {
+			return ed25519.PublicKey(key.PublicKey), true
+		}
+	}
+	return nil, false
+}
+
+// reload reads the keys again unless they were loaded less than
+// keyReloadInterval ago.
+func (k *Keyring) reload(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.now().Sub(k.loadedAt) < keyReloadInterval {
+		return nil
+	}
+	return k.load(ctx)
+}
+
+// Sign signs claims with the active key, naming it in the token footer.
+func (k *Keyring) Sign(claims authpkg.TokenClaims) (string, error) {
+	kid, privateKey, err := k.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	return authpkg.GeneratePASETOTokenWithOptions(claims, privateKey, authpkg.TokenOptions{KeyID: kid})
+}
+
+// SignJWT signs claims as a JWT with the active key, naming it in the header.
+func (k *Keyring) SignJWT(claims any) (string, error) {
+	kid, privateKey, err := k.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	return authpkg.SignJWT(claims, privateKey, kid)
+}
+
+// VerifyJWT checks that token was signed by a key of the keyring and decodes
+// its claims into claims. Validating them is left to the caller.
+func (k *Keyring) VerifyJWT(ctx context.Context, token string, claims any) error {
+	header, err := authpkg.ParseJWTHeader(token)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := k.PublicKey(ctx, header.KeyID)
+	if errors.Is(err, core.ErrUnknownKey) {
+		return fmt.Errorf("%w: unknown key", authpkg.ErrInvalidToken)
+	}
+	if err != nil {
+		return err
+	}
+
+	return authpkg.VerifyJWT(token, publicKey, claims)
+}
+
+// Verify checks that token was signed by a key of the keyring and that its
+// claims are valid for audience at now. Errors wrap authpkg.ErrInvalidToken
+// unless the keys cannot be read.
+func (k *Keyring) Verify(ctx context.Context, token, audience string, now time.Time) (*authpkg.TokenClaims, error) {
+	footer, err := authpkg.ParseTokenFooter(token)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := k.PublicKey(ctx, footer.KeyID)
+	if errors.Is(err, core.ErrUnknownKey) {
+		return nil, fmt.Errorf("%w: unknown key", authpkg.ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := authpkg.VerifyPASETOTokenWithOptions(token, publicKey, authpkg.TokenOptions{KeyID: footer.KeyID})
+	if err != nil {
+		return nil, err
+	}
+	if verrs := authpkg.ValidateTokenForService(*claims, audience, now); len(verrs) > 0 {
+		return nil, fmt.Errorf("%w: %v", authpkg.ErrInvalidToken, verrs)
+	}
+	return claims, nil
+}
+
+// Rotate makes a new key active and moves the current one to verifying.
+func (k *Keyring) Rotate(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.rotate(ctx)
+}
+
+// RegisterRoutes registers the public key set route.
+func (k *Keyring) RegisterRoutes(r chi.Router) {
+	r.Get(KeysPath, k.GetKeys)
+}
+
+// GetKeys handles GET /authn/keys. The keys are reloaded first, as for an
+// unknown kid, so keys activated by other instances are published too.
+func (k *Keyring) GetKeys(w http.ResponseWriter, r *http.Request) {
+	if err := k.reload(r.Context()); err != nil {
+		k.log.Error("cannot reload signing keys", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(keysMaxAge.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(core.SuccessResponse{Data: k.PublicKeySet()})
+}
+
+func (k *Keyring) schedule() {
+	defer close(k.done)
+
+	ticker := time.NewTicker(keyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := k.maintain(ctx); err != nil {
+				k.log.Error("cannot maintain signing keys", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// ensureKeys loads the keys and creates the first active key if needed,
+// importing the configured token private key when there is one.
+func (k *Keyring) ensureKeys(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.load(ctx); err != nil {
+		return err
+	}
+	if k.active != nil {
+		return nil
+	}
+
+	var private ed25519.PrivateKey
+	if k.bootstrapKey != "" {
+		raw, err := base64.StdEncoding.DecodeString(k.bootstrapKey)
+		if err != nil {
+			return fmt.Errorf("cannot decode token private key: %w", err)
+		}
+		if len(raw) != ed25519.PrivateKeySize {
+			return fmt.Errorf("invalid token private key size %d", len(raw))
+		}
+		private = ed25519.PrivateKey(raw)
+	}
+
+	return k.activate(ctx, private)
+}
+
+// maintain reloads the keys, so rotations done by other instances are seen,
+// rotates the active key when due and retires keys past their verify period.
+// Instances rotating at the same time each activate a key; all but the newest
+// are demoted to verifying, so a single key signs again.
+func (k *Keyring) maintain(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.load(ctx); err != nil {
+		return err
+	}
+
+	now := k.now()
+	if k.active == nil || now.Sub(k.active.CreatedAt) >= k.rotation {
+		if err := k.rotate(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range k.keys {
+		if key.Status == KeyStatusActive && key != k.active {
+			key.Status = KeyStatusVerifying
+			key.RotatedAt = now
+			if err := k.repo.Save(ctx, key); err != nil {
+				return fmt.Errorf("cannot demote signing key %s: %w", key.ID, err)
+			}
+			k.log.Info("concurrent signing key demoted", "kid", key.ID, "active", k.active.ID)
+		}
+	}
+
+	keys := k.keys[:0]
+	for _, key := range k.keys {
+		if key.Status == KeyStatusVerifying && now.Sub(key.RotatedAt) >= k.verifyPeriod {
+			key.Status = KeyStatusRetired
+			key.RetiredAt = now
+			if err := k.repo.Save(ctx, key); err != nil {
+				return fmt.Errorf("cannot retire signing key %s: %w", key.ID, err)
+			}
+			k.log.Info("signing key retired", "kid", key.ID)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	k.keys = keys
+
+	return nil
+}
+
+// load reads the unretired keys and decrypts the active one, the newest
+// when there are several. Ties are broken by ID so every instance picks the
+// same key. The caller holds the lock.
+func (k *Keyring) load(ctx context.Context) error {
+	keys, err := k.repo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot list signing keys: %w", err)
+	}
+
+	var active *SigningKey
+	for _, key := range keys {
+		if key.Status == KeyStatusActive && (active == nil || newerKey(key, active)) {
+			active = key
+		}
+	}
+
+	var private ed25519.PrivateKey
+	if active != nil {
+		seed, err := authpkg.DecryptData(&authpkg.EncryptedData{
+			Ciphertext: active.PrivateKeyCT,
+			IV:         active.PrivateKeyIV,
+			Tag:        active.PrivateKeyTag,
+		}, k.encryptionKey)
+		if err != nil {
+			return fmt.Errorf("cannot decrypt signing key %s: %w", active.ID, err)
+		}
+		if len(seed) != ed25519.SeedSize {
+			return fmt.Errorf("invalid signing key %s", active.ID)
+		}
+		private = ed25519.NewKeyFromSeed(seed)
+	}
+
+	k.keys = keys
+	k.active = active
+	k.private = private
+	k.loadedAt = k.now()
+	return nil
+}
+
+// newerKey reports whether a was created after b
+func newerKey(a, b *SigningKey) bool {
+	if a.CreatedAt.Equal(b.CreatedAt) {
+		return a.ID > b.ID
+	}
+	return a.CreatedAt.After(b.CreatedAt)
+}
+
+// rotate moves the active key to verifying and activates a new one.
+// The caller holds the lock.
+func (k *Keyring) rotate(ctx context.Context) error {
+	previous := k.active
+
+	if err := k.activate(ctx, nil); err != nil {
+		return err
+	}
+
+	if previous != nil {
+		previous.Status = KeyStatusVerifying
+		previous.RotatedAt = k.now()
+		if err := k.repo.Save(ctx, previous); err != nil {
+			return fmt.Errorf("cannot demote signing key %s: %w", previous.ID, err)
+		}
+		k.log.Info("signing key rotated", "kid", k.active.ID, "previous", previous.ID)
+	}
+
+	return nil
+}
+
+// activate stores private, or a new key when nil, as the active key.
+// The caller holds the lock.
+func (k *Keyring) activate(ctx context.Context, private ed25519.PrivateKey) error {
+	if private == nil {
+		var err error
+		if _, private, err = authpkg.GenerateKeyPair(); err != nil {
+			return fmt.Errorf("cannot generate signing key: %w", err)
+		}
+	}
+
+	encrypted, err := authpkg.EncryptData(private.Seed(), k.encryptionKey)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt signing key: %w", err)
+	}
+
+	public := private.Public().(ed25519.PublicKey)
+	key := &SigningKey{
+		ID:            authpkg.PASERKPublicID(public),
+		PublicKey:     public,
+		PrivateKeyCT:  encrypted.Ciphertext,
+		PrivateKeyIV:  encrypted.IV,
+		PrivateKeyTag: encrypted.Tag,
+		Status:        KeyStatusActive,
+		CreatedAt:     k.now(),
+	}
+
+	if err := k.repo.Create(ctx, key); err != nil {
+		return fmt.Errorf("cannot store signing key: %w", err)
+	}
+
+	k.keys = append([]*SigningKey{key}, k.keys...)
+	k.active = key
+	k.private = private
+	return nil
+}
+
+func parseKeyDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be positive, got %s", value)
+	}
+	return d, nil
+}
+
+// claimsAt returns claims for a token issued at now that lives ttl.
+func claimsAt(subject, id, audience string, ttl time.Duration, now time.Time) authpkg.TokenClaims {
+	claims := authpkg.CreateTokenClaims(subject, id, audience, map[string]string{"type": "global"}, ttl, 0)
+	claims.IssuedAt = now.Unix()
+	claims.NotBefore = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
+	return claims
+}
@@ -0,0 +1,372 @@
+package authn
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+type mockSigningKeyRepo struct {
+	mu    sync.Mutex
+	keys  map[string]SigningKey
+	lists int
+}
+
+func newMockSigningKeyRepo() *mockSigningKeyRepo {
+	return &mockSigningKeyRepo{keys: make(map[string]SigningKey)}
+}
+
+func (m *mockSigningKeyRepo) Create(ctx context.Context, key *SigningKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key.ID] = *key
+	return nil
+}
+
+func (m *mockSigningKeyRepo) Save(ctx context.Context, key *SigningKey) error {
+	return m.Create(ctx, key)
+}
+
+func (m *mockSigningKeyRepo) List(ctx context.Context) ([]*SigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lists++
+	var keys []*SigningKey
+	for _, key := range m.keys {
+		if key.Status != KeyStatusRetired {
+			key := key
+			keys = append(keys, &key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockSigningKeyRepo) status(kid string) KeyStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.keys[kid].Status
+}
+
+func newTestKeyring(t *testing.T, repo SigningKeyRepo, auth config.AuthConfig) *Keyring {
+	t.Helper()
+	if auth.EncryptionKey == "" {
+		auth.EncryptionKey = "12345678901234567890123456789012"
+	}
+	if auth.AccessTTL == "" {
+		auth.AccessTTL = "15m"
+	}
+	keys, err := NewKeyring(repo, config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{Auth: auth}})
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	return keys
+}
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    config.AuthConfig
+		wantErr bool
+	}{
+		{"defaults", config.AuthConfig{AccessTTL: "15m"}, false},
+		{"configured", config.AuthConfig{AccessTTL: "1h", KeyRotation: "24h", KeyVerifyPeriod: "2h"}, false},
+		{"invalid rotation", config.AuthConfig{KeyRotation: "monthly"}, true},
+		{"negative verify period", config.AuthConfig{KeyVerifyPeriod: "-1h"}, true},
+		{"verify period shorter than access tokens", config.AuthConfig{AccessTTL: "2h", KeyVerifyPeriod: "1h"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(newMockSigningKeyRepo(), config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{Auth: tt.auth}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewKeyring() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyringPersistsKeys(t *testing.T) {
+	repo := newMockSigningKeyRepo()
+	ctx := context.Background()
+
+	first := newTestKeyring(t, repo, config.AuthConfig{})
+	if err := first.ensureKeys(ctx); err != nil {
+		t.Fatalf("ensureKeys() error = %v", err)
+	}
+	kid, private, err := first.SigningKey()
+	if err != nil {
+		t.Fatalf("SigningKey() error = %v", err)
+	}
+	if kid != authpkg.PASERKPublicID(private.Public().(ed25519.PublicKey)) {
+		t.Errorf("kid = %s, want the PASERK id of the key", kid)
+	}
+
+	stored := repo.keys[kid]
+	if len(stored.PrivateKeyCT) == 0 || string(stored.PrivateKeyCT) == string(private.Seed()) {
+		t.Error("private key is not stored encrypted")
+	}
+
+	// A restart picks up the same key instead of creating a new one.
+	restarted := newTestKeyring(t, repo, config.AuthConfig{})
+	if err := restarted.ensureKeys(ctx); err != nil {
+		t.Fatalf("ensureKeys() after restart error = %v", err)
+	}
+	restartedKID, restartedPrivate, _ := restarted.SigningKey()
+	if restartedKID != kid || !restartedPrivate.Equal(private) {
+		t.Errorf("restarted keyring uses %s, want %s", restartedKID, kid)
+	}
+	if len(repo.keys) != 1 {
+		t.Errorf("stored keys = %d, want 1", len(repo.keys))
+	}
+}
+
+func TestKeyringImportsConfiguredKey(t *testing.T) {
+	configured := generateBase64Ed25519Key()
+	keys := newTestKeyring(t, newMockSigningKeyRepo(), config.AuthConfig{TokenPrivateKey: configured})
+	if err := keys.ensureKeys(context.Background()); err != nil {
+		t.Fatalf("ensureKeys() error = %v", err)
+	}
+
+	_, private, _ := keys.SigningKey()
+	if base64.StdEncoding.EncodeToString(private) != configured {
+		t.Error("configured token private key was not imported")
+	}
+
+	invalid := newTestKeyring(t, newMockSigningKeyRepo(), config.AuthConfig{TokenPrivateKey: "invalid-key"})
+	if err := invalid.ensureKeys(context.Background()); err == nil {
+		t.Error("ensureKeys() with invalid configured key error = nil, want error")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	repo := newMockSigningKeyRepo()
+	keys := newTestKeyring(t, repo, config.AuthConfig{AccessTTL: "1h", KeyRotation: "24h", KeyVerifyPeriod: "2h"})
+	now := time.Now()
+	keys.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := keys.ensureKeys(ctx); err != nil {
+		t.Fatalf("ensureKeys() error = %v", err)
+	}
+	firstKID, _, _ := keys.SigningKey()
+
+	// Not due yet.
+	now = now.Add(23 * time.Hour)
+	if err := keys.maintain(ctx); err != nil {
+		t.Fatalf("maintain() error = %v", err)
+	}
+	if kid, _, _ := keys.SigningKey(); kid != firstKID {
+		t.Fatalf("key rotated before the rotation interval")
+	}
+
+	// Due: a new key signs and the old one keeps verifying.
+	now = now.Add(time.Hour)
+	if err := keys.maintain(ctx); err != nil {
+		t.Fatalf("maintain() error = %v", err)
+	}
+	secondKID, _, _ := keys.SigningKey()
+	if secondKID == firstKID {
+		t.Fatal("key not rotated after the rotation interval")
+	}
+	if got := repo.status(firstKID); got != KeyStatusVerifying {
+		t.Errorf("old key status = %s, want verifying", got)
+	}
+	if set := keys.PublicKeySet(); len(set.Keys) != 2 {
+		t.Errorf("published keys = %d, want 2", len(set.Keys))
+	}
+
+	// After the verify period the old key retires and is no longer published.
+	now = now.Add(2 * time.Hour)
+	if err := keys.maintain(ctx); err != nil {
+		t.Fatalf("maintain() error = %v", err)
+	}
+	if got := repo.status(firstKID); got != KeyStatusRetired {
+		t.Errorf("old key status = %s, want retired", got)
+	}
+	set := keys.PublicKeySet()
+	if len(set.Keys) != 1 || set.Keys[0].ID != secondKID || set.Keys[0].Status != string(KeyStatusActive) {
+		t.Errorf("published keys = %+v, want only %s", set.Keys, secondKID)
+	}
+}
+
+func TestKeyringConcurrentRotation(t *testing.T) {
+	repo := newMockSigningKeyRepo()
+	auth := config.AuthConfig{AccessTTL: "1h", KeyRotation: "24h", KeyVerifyPeriod: "2h"}
+	a := newTestKeyring(t, repo, auth)
+	b := newTestKeyring(t, repo, auth)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	b.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := a.ensureKeys(ctx); err != nil {
+		t.Fatalf("ensureKeys() error = %v", err)
+	}
+	if err := b.ensureKeys(ctx); err != nil {
+		t.Fatalf("ensureKeys() error = %v", err)
+	}
+	firstKID, _, _ := a.SigningKey()
+
+	// Both instances find the key due and rotate it before seeing each other.
+	now = now.Add(24 * time.Hour)
+	if err := a.maintain(ctx); err != nil {
+		t.Fatalf("maintain() error = %v", err)
+	}
+	b.mu.Lock()
+	err := b.rotate(ctx)
+	b.mu.Unlock()
+	if err != nil {
+		t.Fatalf("rotate() error = %v", err)
+	}
+
+	aKID, _, _ := a.SigningKey()
+	bKID, _, _ := b.SigningKey()
+	if aKID == bKID {
+		t.Fatal("instances activated the same key, want one each")
+	}
+
+	now = now.Add(time.Minute)
+	for _, keys := range []*Keyring{a, b} {
+		if err := keys.maintain(ctx); err != nil {
+			t.Fatalf("maintain() error = %v", err)
+		}
+	}
+
+	aKID, _, _ = a.SigningKey()
+	bKID, _, _ = b.SigningKey()
+	if aKID != bKID {
+		t.Errorf("instances sign with %s and %s, want the same key", aKID, bKID)
+	}
+
+	var active, verifying int
+	for kid := range repo.keys {
+		switch repo.status(kid) {
+		case KeyStatusActive:
+			active++
+		case KeyStatusVerifying:
+			verifying++
+		}
+	}
+	if active != 1 || verifying != 2 {
+		t.Errorf("keys = %d active and %d verifying, want 1 and 2", active, verifying)
+	}
+	if got := repo.status(firstKID); got != KeyStatusVerifying {
+		t.Errorf("first key status = %s, want verifying", got)
+	}
+}
+
+func TestKeyringFindsKeysOfOtherInstances(t *testing.T) {
+	repo := newMockSigningKeyRepo()
+	auth := config.AuthConfig{AccessTTL: "1h", KeyRotation: "24h", KeyVerifyPeriod: "2h"}
+	a := newTestKeyring(t, repo, auth)
+	b := newTestKeyring(t, repo, auth)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	b.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := a.ensureKeys(ctx); err != nil {
+		t.Fatalf("ensureKeys() error = %v", err)
+	}
+	if err := b.ensureKeys(ctx); err != nil {
+		t.Fatalf("ensureKeys() error = %v", err)
+	}
+
+	// a rotates; b has not run its schedule since.
+	now = now.Add(time.Minute)
+	if err := a.Rotate(ctx); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	token, err := a.Sign(authpkg.CreateTokenClaims("user-1", "session-1", SessionAudience, nil, time.Hour, 1))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	kid, _, _ := a.SigningKey()
+
+	if _, err := b.Verify(ctx, token, SessionAudience, now); err != nil {
+		t.Fatalf("Verify() of a token signed by another instance error = %v", err)
+	}
+
+	// Unknown kids reload at most once every keyReloadInterval.
+	repo.mu.Lock()
+	lists := repo.lists
+	repo.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		if _, err := b.PublicKey(ctx, "k4.pid.unknown"); !errors.Is(err, core.ErrUnknownKey) {
+			t.Fatalf("PublicKey() unknown kid error = %v, want %v", err, core.ErrUnknownKey)
+		}
+	}
+	repo.mu.Lock()
+	reloads := repo.lists - lists
+	repo.mu.Unlock()
+	if reloads != 0 {
+		t.Errorf("reloads within the interval = %d, want 0", reloads)
+	}
+
+	found := false
+	for _, key := range b.PublicKeySet().Keys {
+		found = found || key.ID == kid
+	}
+	if !found {
+		t.Errorf("published keys of b miss %s", kid)
+	}
+}
+
+func TestKeyringGetKeys(t *testing.T) {
+	keys := newTestKeyring(t, newMockSigningKeyRepo(), config.AuthConfig{})
+	ctx := context.Background()
+	if err := keys.ensureKeys(ctx); err != nil {
+		t.Fatalf("ensureKeys() error = %v", err)
+	}
+	if err := keys.Rotate(ctx); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+
+	r := chi.NewRouter()
+	keys.RegisterRoutes(r)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, KeysPath, nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d, want 200", KeysPath, rr.Code)
+	}
+
+	var resp struct {
+		Data core.PublicKeySet `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("cannot decode key set: %v", err)
+	}
+	if len(resp.Data.Keys) != 2 {
+		t.Fatalf("keys = %d, want 2", len(resp.Data.Keys))
+	}
+
+	// Verifiers can check a fresh token against the published set by kid.
+	published, err := core.ParsePublicKeys(resp.Data.Keys[0].PublicKey, resp.Data.Keys[1].PublicKey)
+	if err != nil {
+		t.Fatalf("ParsePublicKeys() error = %v", err)
+	}
+	kid, private, _ := keys.SigningKey()
+	claims := authpkg.CreateTokenClaims("user-1", "session-1", "session", map[string]string{"type": "global"}, time.Hour, 1)
+	token, err := authpkg.GeneratePASETOTokenWithOptions(claims, private, authpkg.TokenOptions{KeyID: kid})
+	if err != nil {
+		t.Fatalf("GeneratePASETOTokenWithOptions() error = %v", err)
+	}
+	authenticator := core.NewPASETOAuthenticator(published, []string{"session"}, 0)
+	if _, err := authenticator.ValidateToken(ctx, token); err != nil {
+		t.Errorf("ValidateToken() with published keys error = %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package authn
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttempt counts the failed sign ins of a key, either an account (by
+// email lookup hash) or a client IP, and its lockouts.
+type LoginAttempt struct {
+	Key           string    `json:"key" db:"key" bson:"_id"`
+	Failures      int       `json:"failures" db:"failures" bson:"failures"`
+	Lockouts      int       `json:"lockouts" db:"lockouts" bson:"lockouts"`
+	LastFailureAt time.Time `json:"last_failure_at" db:"last_failure_at" bson:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until" db:"locked_until" bson:"locked_until"`
+}
+
+// Locked reports whether the key is locked out at now.
+func (a *LoginAttempt) Locked(now time.Time) bool {
+	return now.Before(a.LockedUntil)
+}
+
+// LoginAttemptRepo persists login attempts. Updates are atomic so limits
+// hold when several authn replicas share the database.
+type LoginAttemptRepo interface {
+	// Get retrieves the LoginAttempt of a key, or nil if there is none.
+	Get(ctx context.Context, key string) (*LoginAttempt, error)
+
+	// RecordFailure adds a failure to key at at and returns the result.
+	// Failures count from one again when the last one is older than since.
+	RecordFailure(ctx context.Context, key string, at, since time.Time) (*LoginAttempt, error)
+
+	// Lock locks key until until if it has at least limit failures, clearing
+	// them and counting a lockout. It returns the lockouts and whether it locked.
+	Lock(ctx context.Context, key string, limit int, until time.Time) (int, bool, error)
+
+	// Reset forgets the failures and lockouts of key.
+	Reset(ctx context.Context, key string) error
+}
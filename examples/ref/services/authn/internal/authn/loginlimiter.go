@@ -0,0 +1,201 @@
+package authn
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+const (
+	defaultLoginMaxAttempts   = 5
+	defaultLoginIPMaxAttempts = 50
+	defaultLoginWindow        = 15 * time.Minute
+	defaultLoginLockout       = time.Minute
+	defaultLoginMaxLockout    = time.Hour
+	defaultLoginSuspendAfter  = 5
+
+	passwordResetMaxRequests   = 3
+	passwordResetIPMaxRequests = 20
+)
+
+// LoginLimiter throttles sign in attempts per account and per client IP.
+// A key that reaches its failure limit within the window is locked out; each
+// lockout doubles the previous one up to a maximum, and an account locked out
+// suspendAfter times in a row is suspended until an admin reactivates it.
+// Failures are counted in the repo, so the limits hold across replicas.
+// Password reset requests are limited per account and per IP too, in the
+// same window.
+type LoginLimiter struct {
+	repo          LoginAttemptRepo
+	users         UserRepo
+	maxAttempts   int
+	ipMaxAttempts int
+	window        time.Duration
+	lockout       time.Duration
+	maxLockout    time.Duration
+	suspendAfter  int
+	now           func() time.Time
+}
+
+// NewLoginLimiter creates a login limiter. Zero settings use the defaults; a
+// negative auth.login.suspend.after disables suspension.
+func NewLoginLimiter(repo LoginAttemptRepo, users UserRepo, xparams config.XParams) (*LoginLimiter, error) {
+	cfg := xparams.Cfg.Auth
+
+	window, err := parseKeyDuration(cfg.LoginWindow, defaultLoginWindow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid login window: %w", err)
+	}
+
+	lockout, err := parseKeyDuration(cfg.LoginLockout, defaultLoginLockout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid login lockout: %w", err)
+	}
+
+	maxLockout, err := parseKeyDuration(cfg.LoginMaxLockout, defaultLoginMaxLockout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid login max lockout: %w", err)
+	}
+	if maxLockout < lockout {
+		maxLockout = lockout
+	}
+
+	return &LoginLimiter{
+		repo:          repo,
+		users:         users,
+		maxAttempts:   nonZeroOr(cfg.LoginMaxAttempts, defaultLoginMaxAttempts),
+		ipMaxAttempts: nonZeroOr(cfg.LoginIPMaxAttempts, defaultLoginIPMaxAttempts),
+		window:        window,
+		lockout:       lockout,
+		maxLockout:    maxLockout,
+		suspendAfter:  nonZeroOr(cfg.LoginSuspendAfter, defaultLoginSuspendAfter),
+		now:           time.Now,
+	}, nil
+}
+
+// Check returns how long sign ins for the account with the given email
+// lookup hash, or from ip, must wait. It is zero when neither is locked.
+func (l *LoginLimiter) Check(ctx context.Context, lookup []byte, ip string) (time.Duration, error) {
+	now := l.now()
+
+	var wait time.Duration
+	for _, key := range []string{accountKey(lookup), ipKey(ip)} {
+		attempt, err := l.repo.Get(ctx, key)
+		if err != nil {
+			return 0, fmt.Errorf("cannot get login attempts: %w", err)
+		}
+		if attempt != nil && attempt.Locked(now) {
+			wait = max(wait, attempt.LockedUntil.Sub(now))
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed sign in for the account and the IP. user is nil when
+// no account has the email; the failure is counted all the same, so responses
+// do not depend on whether the account exists.
+func (l *LoginLimiter) Fail(ctx context.Context, user *User, lookup []byte, ip string) error {
+	now := l.now()
+
+	lockouts, locked, err := l.fail(ctx, accountKey(lookup), l.maxAttempts, now)
+	if err != nil {
+		return err
+	}
+	if locked && user != nil && l.suspendAfter > 0 && lockouts >= l.suspendAfter && user.Status == authpkg.UserStatusActive {
+		user.Status = authpkg.UserStatusSuspended
+		user.BeforeUpdate()
+		if err := l.users.Save(ctx, user); err != nil {
+			return fmt.Errorf("cannot suspend user: %w", err)
+		}
+	}
+
+	if _, _, err := l.fail(ctx, ipKey(ip), l.ipMaxAttempts, now); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AllowPasswordReset counts a password reset request for the account with
+// the given email lookup hash and for ip. It returns how long the requester
+// must wait, zero while both are within their limit for the window. Unknown
+// emails are counted like known ones.
+func (l *LoginLimiter) AllowPasswordReset(ctx context.Context, lookup []byte, ip string) (time.Duration, error) {
+	now := l.now()
+
+	limits := []struct {
+		key   string
+		limit int
+	}{
+		{"reset:" + accountKey(lookup), passwordResetMaxRequests},
+		{"reset:" + ipKey(ip), passwordResetIPMaxRequests},
+	}
+
+	var wait time.Duration
+	for _, entry := range limits {
+		attempt, err := l.repo.RecordFailure(ctx, entry.key, now, now.Add(-l.window))
+		if err != nil {
+			return 0, fmt.Errorf("cannot record password reset request: %w", err)
+		}
+		if attempt.Failures > entry.limit {
+			wait = l.window
+		}
+	}
+	return wait, nil
+}
+
+// Succeed forgets the failures and lockouts of an account once it signs in.
+// Those of the IP are kept.
+func (l *LoginLimiter) Succeed(ctx context.Context, lookup []byte) error {
+	if err := l.repo.Reset(ctx, accountKey(lookup)); err != nil {
+		return fmt.Errorf("cannot reset login attempts: %w", err)
+	}
+	return nil
+}
+
+// fail counts a failure for key and locks it when it reaches limit.
+func (l *LoginLimiter) fail(ctx context.Context, key string, limit int, now time.Time) (int, bool, error) {
+	attempt, err := l.repo.RecordFailure(ctx, key, now, now.Add(-l.window))
+	if err != nil {
+		return 0, false, fmt.Errorf("cannot record login failure: %w", err)
+	}
+	if attempt.Failures < limit {
+		return attempt.Lockouts, false, nil
+	}
+
+	lockouts, locked, err := l.repo.Lock(ctx, key, limit, now.Add(l.lockoutFor(attempt.Lockouts+1)))
+	if err != nil {
+		return 0, false, fmt.Errorf("cannot lock login: %w", err)
+	}
+	return lockouts, locked, nil
+}
+
+// lockoutFor returns the duration of the nth lockout: the base lockout
+// doubled for each previous one, up to the maximum.
+func (l *LoginLimiter) lockoutFor(n int) time.Duration {
+	d := l.lockout
+	for i := 1; i < n && d < l.maxLockout; i++ {
+		d *= 2
+	}
+	return min(d, l.maxLockout)
+}
+
+// accountKey keys attempts by the email lookup hash, so the email itself is
+// not stored and unknown addresses are limited like known ones.
+func accountKey(lookup []byte) string {
+	return "account:" + hex.EncodeToString(lookup)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func nonZeroOr(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
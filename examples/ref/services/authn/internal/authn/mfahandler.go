@@ -0,0 +1,171 @@
+package authn
+
+import (
+	"errors"
+	"net/http"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+)
+
+// MFACodeRequest represents the payload confirming an MFA enrollment
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+// SignInMFARequest represents the second step of a sign in with MFA
+type SignInMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// MFARecoveryCodes is returned once, when an MFA enrollment is confirmed.
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// EnrollMFA handles POST /authn/mfa/enroll. It returns the secret and
+// otpauth URI of a new authenticator, which stays pending until confirmed.
+func (h *AuthHandler) EnrollMFA(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	user, ok := h.authenticatedUser(w, r, log)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.mfa.Enroll(r.Context(), user)
+	if errors.Is(err, ErrMFAAlreadyEnabled) {
+		core.RespondError(w, http.StatusConflict, "MFA already enabled")
+		return
+	}
+	if err != nil {
+		log.Error("error enrolling mfa", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not enroll MFA")
+		return
+	}
+
+	core.RespondSuccess(w, enrollment)
+}
+
+// ConfirmMFA handles POST /authn/mfa/confirm. A valid code from the pending
+// authenticator enables MFA; the response carries the recovery codes.
+func (h *AuthHandler) ConfirmMFA(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	user, ok := h.authenticatedUser(w, r, log)
+	if !ok {
+		return
+	}
+
+	var req MFACodeRequest
+	if !h.decodePayload(w, r, log, &req) {
+		return
+	}
+	if req.Code == "" {
+		core.RespondError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	codes, err := h.mfa.Confirm(r.Context(), user, req.Code)
+	switch {
+	case errors.Is(err, ErrMFAAlreadyEnabled):
+		core.RespondError(w, http.StatusConflict, "MFA already enabled")
+		return
+	case errors.Is(err, ErrMFANotEnrolled):
+		core.RespondError(w, http.StatusBadRequest, "No pending MFA enrollment")
+		return
+	case errors.Is(err, ErrInvalidMFACode):
+		core.RespondError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	case err != nil:
+		log.Error("error confirming mfa", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not confirm MFA")
+		return
+	}
+
+	log.Info("mfa enabled", "user_id", user.ID)
+	core.RespondSuccess(w, MFARecoveryCodes{RecoveryCodes: codes})
+}
+
+// SignInMFA handles POST /authn/signin/mfa, the second step of a sign in
+// with MFA. It takes the mfa_pending token and a TOTP or recovery code.
+func (h *AuthHandler) SignInMFA(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	var req SignInMFARequest
+	if !h.decodePayload(w, r, log, &req) {
+		return
+	}
+	if req.MFAToken == "" || req.Code == "" {
+		core.RespondError(w, http.StatusBadRequest, "MFA token and code are required")
+		return
+	}
+
+	ip := clientIP(r)
+	user, failure := h.checkMFACode(r, log, req.MFAToken, req.Code, ip)
+	if failure != nil {
+		failure.respond(w)
+		return
+	}
+
+	tokens, err := h.sessions.Start(ctx, user.ID, ip, r.UserAgent())
+	if err != nil {
+		log.Error("error starting session", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Authentication failed")
+		return
+	}
+
+	h.resetLoginAttempts(r, log, user)
+
+	core.RespondSuccess(w, AuthResponse{
+		User:         user,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    &tokens.ExpiresAt,
+	})
+}
+
+// checkMFACode runs the second step of a sign in with MFA, shared by the
+// JSON API and the OIDC sign in page. It returns the user of the mfa_pending
+// token once code is valid for it; wrong codes count as failed sign ins.
+func (h *AuthHandler) checkMFACode(r *http.Request, log core.Logger, mfaToken, code, ip string) (*User, *signInFailure) {
+	ctx := r.Context()
+
+	userID, err := h.mfa.VerifyPendingToken(ctx, mfaToken)
+	if errors.Is(err, ErrInvalidMFAToken) {
+		log.Debug("invalid mfa token")
+		return nil, &signInFailure{Status: http.StatusUnauthorized, Message: "Invalid MFA token"}
+	}
+	if err != nil {
+		log.Error("error verifying mfa token", "error", err)
+		return nil, errSignInFailed
+	}
+
+	user, err := h.repo.Get(ctx, userID)
+	if err != nil {
+		log.Error("error finding user", "error", err)
+		return nil, errSignInFailed
+	}
+	if user == nil || !h.mfa.Enabled(user) || user.Status != authpkg.UserStatusActive {
+		return nil, &signInFailure{Status: http.StatusUnauthorized, Message: "Invalid MFA token"}
+	}
+
+	if failure := h.checkLoginLimit(r, log, user.EmailLookup, ip); failure != nil {
+		return nil, failure
+	}
+
+	err = h.mfa.Verify(ctx, user, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		log.Debug("invalid mfa code", "user_id", user.ID)
+		h.recordLoginFailure(r, log, user, user.EmailLookup, ip)
+		return nil, &signInFailure{Status: http.StatusUnauthorized, Message: "Invalid code"}
+	}
+	if err != nil {
+		log.Error("error verifying mfa code", "error", err)
+		return nil, errSignInFailed
+	}
+
+	return user, nil
+}
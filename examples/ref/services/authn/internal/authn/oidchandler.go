@@ -0,0 +1,466 @@
+package authn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+// OIDC endpoint paths, relative to the issuer.
+const (
+	OIDCDiscoveryPath = "/.well-known/openid-configuration"
+	OIDCAuthorizePath = "/oidc/authorize"
+	OIDCTokenPath     = "/oidc/token"
+	OIDCUserInfoPath  = "/oidc/userinfo"
+	OIDCKeysPath      = "/oidc/jwks"
+)
+
+const OIDCMaxBodyBytes = 1 << 16
+
+// OIDCHandler serves the OpenID Connect provider endpoints and the client
+// registration API. The authorization endpoint renders a sign in and
+// consent page; credentials go through the same checks and login limits as
+// /authn/signin.
+type OIDCHandler struct {
+	provider  *OIDCProvider
+	clients   OIDCClientRepo
+	auth      *AuthHandler
+	templates *core.TemplateManager
+	guard     *AdminGuard
+	xparams   config.XParams
+}
+
+// NewOIDCHandler creates a new OIDCHandler. Clients are registered by
+// admins admitted by guard.
+func NewOIDCHandler(provider *OIDCProvider, clients OIDCClientRepo, auth *AuthHandler, templates *core.TemplateManager, guard *AdminGuard, xparams config.XParams) *OIDCHandler {
+	return &OIDCHandler{
+		provider:  provider,
+		clients:   clients,
+		auth:      auth,
+		templates: templates,
+		guard:     guard,
+		xparams:   xparams,
+	}
+}
+
+// OIDCClientRequest is the payload of POST /oidc/clients. Public clients get
+// no secret and must use PKCE alone.
+type OIDCClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Public       bool     `json:"public"`
+}
+
+// RegisteredOIDCClient is returned once, when a client is registered.
+// ClientSecret is not stored and is empty for public clients.
+type RegisteredOIDCClient struct {
+	*OIDCClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// AuthorizePage is the data of the oidc/authorize.html template.
+type AuthorizePage struct {
+	Client   *OIDCClient
+	Request  AuthorizationRequest
+	Scopes   []string
+	Email    string
+	MFAToken string
+	Error    string
+}
+
+func (h *OIDCHandler) RegisterRoutes(r chi.Router) {
+	r.Get(OIDCDiscoveryPath, h.Discovery)
+	r.Get(OIDCKeysPath, h.Keys)
+	r.Get(OIDCAuthorizePath, h.Authorize)
+	r.Post(OIDCAuthorizePath, h.Consent)
+	r.Post(OIDCTokenPath, h.Token)
+	r.Get(OIDCUserInfoPath, h.UserInfo)
+	r.Post(OIDCUserInfoPath, h.UserInfo)
+	r.Route("/oidc/clients", func(r chi.Router) {
+		r.Use(h.guard.Require(string(authpkg.PermSystemConfig)))
+		r.Post("/", h.CreateClient)
+		r.Get("/", h.ListClients)
+		r.Get("/{id}", h.GetClient)
+		r.Delete("/{id}", h.DeleteClient)
+	})
+}
+
+// Discovery handles GET /.well-known/openid-configuration.
+func (h *OIDCHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, h.provider.Discovery())
+}
+
+// Keys handles GET /oidc/jwks, the keys ID tokens are verified with.
+func (h *OIDCHandler) Keys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, h.provider.KeySet())
+}
+
+// Authorize handles GET /oidc/authorize. Valid requests get the sign in and
+// consent page; invalid ones are sent back to the client, unless the client
+// or its redirect URI cannot be trusted.
+func (h *OIDCHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	req := ParseAuthorizationRequest(r.URL.Query())
+
+	client, ok := h.validate(w, r, req)
+	if !ok {
+		return
+	}
+
+	h.render(w, r, http.StatusOK, AuthorizePage{Client: client, Request: req, Scopes: req.Scopes()})
+}
+
+// Consent handles POST /oidc/authorize, the submitted page. Denying sends
+// access_denied back; allowing needs the user credentials and, with MFA
+// enabled, a second submission with a code. Then the client is redirected
+// with an authorization code.
+func (h *OIDCHandler) Consent(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, OIDCMaxBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Could not parse form", http.StatusBadRequest)
+		return
+	}
+	req := ParseAuthorizationRequest(r.PostForm)
+
+	client, ok := h.validate(w, r, req)
+	if !ok {
+		return
+	}
+
+	if r.PostForm.Get("action") != "allow" {
+		log.Info("oidc consent denied", "client_id", client.ID.String())
+		h.redirectError(w, r, req, oauthError("access_denied", "the user denied the request"))
+		return
+	}
+
+	page := AuthorizePage{Client: client, Request: req, Scopes: req.Scopes(), Email: r.PostForm.Get("email")}
+	ip := clientIP(r)
+
+	var user *User
+	var failure *signInFailure
+	if mfaToken := r.PostForm.Get("mfa_token"); mfaToken != "" {
+		page.MFAToken = mfaToken
+		user, failure = h.auth.checkMFACode(r, log, mfaToken, r.PostForm.Get("code"), ip)
+	} else {
+		user, failure = h.auth.checkPassword(r, log, page.Email, r.PostForm.Get("password"), ip)
+		if failure == nil && h.auth.mfa.Enabled(user) {
+			mfaToken, _, err := h.auth.mfa.IssuePendingToken(user)
+			if err != nil {
+				log.Error("error issuing mfa token", "error", err)
+				failure = errSignInFailed
+			} else {
+				page.MFAToken = mfaToken
+				h.render(w, r, http.StatusOK, page)
+				return
+			}
+		}
+	}
+	if failure != nil {
+		page.Error = failure.Message
+		h.render(w, r, failure.Status, page)
+		return
+	}
+
+	h.auth.resetLoginAttempts(r, log, user)
+
+	code, err := h.provider.IssueCode(r.Context(), client, user, req)
+	if err != nil {
+		log.Error("error issuing authorization code", "error", err)
+		h.redirectError(w, r, req, oauthError("server_error", "could not issue an authorization code"))
+		return
+	}
+
+	log.Info("oidc authorization granted", "client_id", client.ID.String(), "user_id", user.ID.String())
+	h.redirect(w, r, req, url.Values{"code": {code}})
+}
+
+// Token handles POST /oidc/token for the authorization_code and
+// refresh_token grants. Clients authenticate with HTTP Basic or form
+// credentials; public clients send only their client_id.
+func (h *OIDCHandler) Token(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	r.Body = http.MaxBytesReader(w, r.Body, OIDCMaxBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, oauthError("invalid_request", "could not parse form"))
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := h.provider.AuthenticateClient(ctx, clientID, secret)
+	if errors.Is(err, ErrInvalidClient) {
+		log.Debug("oidc client authentication failed", "client_id", clientID)
+		writeOAuthError(w, http.StatusUnauthorized, oauthError("invalid_client", "client authentication failed"))
+		return
+	}
+	if err != nil {
+		log.Error("error authenticating oidc client", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, oauthError("server_error", ""))
+		return
+	}
+
+	var resp *TokenResponse
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		resp, err = h.provider.Exchange(ctx, client, r.PostForm.Get("code"), r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"), clientIP(r), r.UserAgent())
+	case "refresh_token":
+		resp, err = h.provider.Refresh(ctx, client, r.PostForm.Get("refresh_token"))
+	default:
+		writeOAuthError(w, http.StatusBadRequest, oauthError("unsupported_grant_type", ""))
+		return
+	}
+
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		log.Debug("oidc token request rejected", "client_id", clientID, "error", oauthErr.Description)
+		writeOAuthError(w, http.StatusBadRequest, oauthErr)
+		return
+	}
+	if err != nil {
+		log.Error("error issuing oidc tokens", "error", err)
+		writeOAuthError(w, http.StatusInternalServerError, oauthError("server_error", ""))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// UserInfo handles GET and POST /oidc/userinfo for a bearer access token.
+func (h *OIDCHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		writeOAuthError(w, http.StatusUnauthorized, oauthError("invalid_token", "missing bearer token"))
+		return
+	}
+
+	info, err := h.provider.UserInfo(r.Context(), token)
+	if err != nil {
+		log.Debug("userinfo token rejected", "error", err)
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(w, http.StatusUnauthorized, oauthError("invalid_token", ""))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, info)
+}
+
+// CreateClient handles POST /oidc/clients. The response holds the client
+// secret of confidential clients, which is shown only this once.
+func (h *OIDCHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	var req OIDCClientRequest
+	r.Body = http.MaxBytesReader(w, r.Body, OIDCMaxBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Debug("cannot decode JSON", "error", err)
+		core.RespondError(w, http.StatusBadRequest, "Could not parse JSON")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		core.RespondError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	client, secret, err := h.provider.RegisterClient(r.Context(), strings.TrimSpace(req.Name), req.RedirectURIs, req.Public)
+	if errors.Is(err, ErrInvalidRedirectURI) {
+		core.RespondError(w, http.StatusBadRequest, "Redirect URIs must be absolute URIs without a fragment")
+		return
+	}
+	if err != nil {
+		log.Error("cannot register oidc client", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not register client")
+		return
+	}
+
+	log.Info("oidc client registered", "client_id", client.ID.String())
+	w.WriteHeader(http.StatusCreated)
+	core.RespondSuccess(w, RegisteredOIDCClient{OIDCClient: client, ClientSecret: secret})
+}
+
+// ListClients handles GET /oidc/clients.
+func (h *OIDCHandler) ListClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.clients.List(r.Context())
+	if err != nil {
+		h.logForRequest(r).Error("error listing oidc clients", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not list clients")
+		return
+	}
+
+	core.RespondCollection(w, clients, "oidc-client")
+}
+
+// GetClient handles GET /oidc/clients/{id}.
+func (h *OIDCHandler) GetClient(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.loadClient(w, r, "Could not retrieve client")
+	if !ok {
+		return
+	}
+
+	core.RespondSuccess(w, client)
+}
+
+// DeleteClient handles DELETE /oidc/clients/{id}. Sessions the client
+// started are left alone; revoke them through /authn/sessions.
+func (h *OIDCHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	client, ok := h.loadClient(w, r, "Could not delete client")
+	if !ok {
+		return
+	}
+
+	if err := h.clients.Delete(r.Context(), client.ID); err != nil {
+		log.Error("error deleting oidc client", "error", err, "client_id", client.ID.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not delete client")
+		return
+	}
+
+	log.Info("oidc client deleted", "client_id", client.ID.String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validate checks an authorization request. Requests whose client or
+// redirect URI is unknown get an error page, never a redirect; other
+// errors go back to the client.
+func (h *OIDCHandler) validate(w http.ResponseWriter, r *http.Request, req AuthorizationRequest) (*OIDCClient, bool) {
+	client, err := h.provider.ValidateAuthorization(r.Context(), req)
+
+	var oauthErr *OAuthError
+	switch {
+	case err == nil:
+		return client, true
+	case errors.As(err, &oauthErr):
+		h.redirectError(w, r, req, oauthErr)
+	case errors.Is(err, ErrInvalidClient):
+		http.Error(w, "Unknown client", http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidRedirectURI):
+		http.Error(w, "Redirect URI not registered for this client", http.StatusBadRequest)
+	default:
+		h.logForRequest(r).Error("error validating authorization request", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+	return nil, false
+}
+
+// redirect sends the user back to the client with params, the request state
+// and the issuer (RFC 9207).
+func (h *OIDCHandler) redirect(w http.ResponseWriter, r *http.Request, req AuthorizationRequest, params url.Values) {
+	target, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", h.provider.Issuer())
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (h *OIDCHandler) redirectError(w http.ResponseWriter, r *http.Request, req AuthorizationRequest, oauthErr *OAuthError) {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	h.redirect(w, r, req, params)
+}
+
+// render writes the sign in and consent page. It must not be framed, so
+// other sites cannot trick users into consenting.
+func (h *OIDCHandler) render(w http.ResponseWriter, r *http.Request, status int, page AuthorizePage) {
+	tmpl, err := h.templates.Get("authorize.html")
+	if err != nil {
+		h.logForRequest(r).Error("error loading authorize template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, page); err != nil {
+		h.logForRequest(r).Error("error executing authorize template", "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// loadClient reads the client named by the id URL parameter, responding
+// with failure as the message of unexpected errors.
+func (h *OIDCHandler) loadClient(w http.ResponseWriter, r *http.Request, failure string) (*OIDCClient, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		core.RespondError(w, http.StatusBadRequest, "Invalid id format")
+		return nil, false
+	}
+
+	client, err := h.clients.Get(r.Context(), id)
+	if err != nil {
+		h.logForRequest(r).Error("error loading oidc client", "error", err, "id", id.String())
+		core.RespondError(w, http.StatusInternalServerError, failure)
+		return nil, false
+	}
+	if client == nil {
+		core.RespondError(w, http.StatusNotFound, "Client not found")
+		return nil, false
+	}
+
+	return client, true
+}
+
+func (h *OIDCHandler) logForRequest(r *http.Request) core.Logger {
+	return h.xparams.Log.With(
+		"request_id", middleware.GetReqID(r.Context()),
+		"method", r.Method,
+		"path", r.URL.Path,
+	)
+}
+
+// writeJSON writes v as a bare JSON body. OIDC clients expect the protocol
+// documents as specified, not wrapped in data.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, oauthErr *OAuthError) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, oauthErr)
+}
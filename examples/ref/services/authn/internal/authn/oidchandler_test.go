@@ -0,0 +1,567 @@
+package authn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+)
+
+type mockOIDCClientRepo struct {
+	mu      sync.Mutex
+	clients map[uuid.UUID]OIDCClient
+}
+
+func newMockOIDCClientRepo() *mockOIDCClientRepo {
+	return &mockOIDCClientRepo{clients: make(map[uuid.UUID]OIDCClient)}
+}
+
+func (m *mockOIDCClientRepo) Create(ctx context.Context, client *OIDCClient) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients[client.ID] = *client
+	return nil
+}
+
+func (m *mockOIDCClientRepo) Get(ctx context.Context, id uuid.UUID) (*OIDCClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.clients[id]
+	if !ok {
+		return nil, nil
+	}
+	return &client, nil
+}
+
+func (m *mockOIDCClientRepo) List(ctx context.Context) ([]*OIDCClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var clients []*OIDCClient
+	for _, client := range m.clients {
+		client := client
+		clients = append(clients, &client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Name < clients[j].Name })
+	return clients, nil
+}
+
+func (m *mockOIDCClientRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.clients, id)
+	return nil
+}
+
+type mockAuthorizationCodeRepo struct {
+	mu    sync.Mutex
+	codes map[string]AuthorizationCode
+}
+
+func newMockAuthorizationCodeRepo() *mockAuthorizationCodeRepo {
+	return &mockAuthorizationCodeRepo{codes: make(map[string]AuthorizationCode)}
+}
+
+func (m *mockAuthorizationCodeRepo) Create(ctx context.Context, code *AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[string(code.Hash)] = *code
+	return nil
+}
+
+func (m *mockAuthorizationCodeRepo) Consume(ctx context.Context, hash []byte, at time.Time) (*AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.codes[string(hash)]
+	if !ok || code.UsedAt != nil {
+		return nil, nil
+	}
+	code.UsedAt = &at
+	m.codes[string(hash)] = code
+	return &code, nil
+}
+
+const testRedirectURI = "https://app.example.com/callback"
+
+// oidcTest drives the provider through a real HTTP server, as a client app
+// and its user's browser would.
+type oidcTest struct {
+	t        *testing.T
+	srv      *httptest.Server
+	http     *http.Client
+	handler  *AuthHandler
+	provider *OIDCProvider
+	clock    *fixedClock
+	user     *User
+}
+
+func setupOIDC(t *testing.T, format string) *oidcTest {
+	t.Helper()
+	handler, repo, clock, user := setupMFA(t)
+
+	router := chi.NewRouter()
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	xparams := handler.xparams
+	xparams.Cfg.OIDC.Issuer = srv.URL
+	xparams.Cfg.OIDC.AccessTokenFormat = format
+
+	clients := newMockOIDCClientRepo()
+	provider, err := NewOIDCProvider(clients, newMockAuthorizationCodeRepo(), repo, handler.pii, handler.sessions, handler.sessions.keys, xparams)
+	if err != nil {
+		t.Fatalf("NewOIDCProvider() error = %v", err)
+	}
+	provider.now = clock.now
+
+	templates := core.NewTemplateManager(os.DirFS("../.."), xparams.Log)
+	if err := templates.Start(context.Background()); err != nil {
+		t.Fatalf("cannot load templates: %v", err)
+	}
+
+	handler.RegisterRoutes(router)
+	guard := newTestAdminGuard(xparams, map[string]string{"user-token": user.ID.String()})
+	NewOIDCHandler(provider, clients, handler, templates, guard, xparams).RegisterRoutes(router)
+
+	return &oidcTest{
+		t:        t,
+		srv:      srv,
+		http:     &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }},
+		handler:  handler,
+		provider: provider,
+		clock:    clock,
+		user:     user,
+	}
+}
+
+func (o *oidcTest) do(req *http.Request) (*http.Response, []byte) {
+	o.t.Helper()
+	resp, err := o.http.Do(req)
+	if err != nil {
+		o.t.Fatalf("%s %s error = %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		o.t.Fatalf("cannot read response: %v", err)
+	}
+	return resp, body
+}
+
+func (o *oidcTest) get(path string) (*http.Response, []byte) {
+	o.t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, o.srv.URL+path, nil)
+	return o.do(req)
+}
+
+func (o *oidcTest) postForm(path string, form url.Values) (*http.Response, []byte) {
+	o.t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, o.srv.URL+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return o.do(req)
+}
+
+func (o *oidcTest) registerClient(public bool) RegisteredOIDCClient {
+	o.t.Helper()
+	payload, _ := json.Marshal(OIDCClientRequest{Name: "Test App", RedirectURIs: []string{testRedirectURI}, Public: public})
+	req, _ := http.NewRequest(http.MethodPost, o.srv.URL+"/oidc/clients", bytes.NewReader(payload))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+	resp, body := o.do(req)
+	if resp.StatusCode != http.StatusCreated {
+		o.t.Fatalf("register client status = %d, body = %s", resp.StatusCode, body)
+	}
+
+	var out struct {
+		Data RegisteredOIDCClient `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		o.t.Fatalf("cannot decode client: %v", err)
+	}
+	return out.Data
+}
+
+// authorization returns the parameters of an authorization request with
+// PKCE, and the verifier to redeem its code with.
+func authorization(clientID uuid.UUID) (url.Values, string) {
+	verifier := authpkg.GeneratePKCEVerifier()
+	return url.Values{
+		"client_id":             {clientID.String()},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {"openid email"},
+		"state":                 {"state-1"},
+		"nonce":                 {"nonce-1"},
+		"code_challenge":        {authpkg.PKCEChallenge(verifier)},
+		"code_challenge_method": {authpkg.PKCEMethodS256},
+	}, verifier
+}
+
+// consent submits the page with the given extra fields and returns the
+// parameters of the redirect back to the client.
+func (o *oidcTest) consent(params url.Values, fields url.Values) url.Values {
+	o.t.Helper()
+	form := url.Values{}
+	for key, values := range params {
+		form[key] = values
+	}
+	for key, values := range fields {
+		form[key] = values
+	}
+
+	resp, body := o.postForm(OIDCAuthorizePath, form)
+	if resp.StatusCode != http.StatusFound {
+		o.t.Fatalf("consent status = %d, body = %s", resp.StatusCode, body)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		o.t.Fatalf("invalid redirect: %v", err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testRedirectURI {
+		o.t.Fatalf("redirect to %s, want %s", got, testRedirectURI)
+	}
+	return location.Query()
+}
+
+func (o *oidcTest) token(form url.Values) (int, TokenResponse, OAuthError) {
+	o.t.Helper()
+	resp, body := o.postForm(OIDCTokenPath, form)
+
+	var tokens TokenResponse
+	var oauthErr OAuthError
+	if resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(body, &tokens); err != nil {
+			o.t.Fatalf("cannot decode tokens: %v", err)
+		}
+	} else if err := json.Unmarshal(body, &oauthErr); err != nil {
+		o.t.Fatalf("cannot decode error: %v, body = %s", err, body)
+	}
+	return resp.StatusCode, tokens, oauthErr
+}
+
+func (o *oidcTest) userInfo(accessToken string) (int, UserInfo) {
+	o.t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, o.srv.URL+OIDCUserInfoPath, nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, body := o.do(req)
+	var info UserInfo
+	if resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(body, &info); err != nil {
+			o.t.Fatalf("cannot decode userinfo: %v", err)
+		}
+	}
+	return resp.StatusCode, info
+}
+
+// verifyJWT checks a JWT against the published key set, as a client would.
+func (o *oidcTest) verifyJWT(token string, claims any) {
+	o.t.Helper()
+	_, body := o.get(OIDCKeysPath)
+
+	var set authpkg.JWKSet
+	if err := json.Unmarshal(body, &set); err != nil {
+		o.t.Fatalf("cannot decode key set: %v", err)
+	}
+
+	header, err := authpkg.ParseJWTHeader(token)
+	if err != nil {
+		o.t.Fatalf("ParseJWTHeader() error = %v", err)
+	}
+	for _, jwk := range set.Keys {
+		if jwk.KeyID != header.KeyID {
+			continue
+		}
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			o.t.Fatalf("JWK PublicKey() error = %v", err)
+		}
+		if err := authpkg.VerifyJWT(token, publicKey, claims); err != nil {
+			o.t.Fatalf("VerifyJWT() error = %v", err)
+		}
+		return
+	}
+	o.t.Fatalf("no published key for kid %s", header.KeyID)
+}
+
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	for _, format := range []string{AccessTokenFormatPASETO, AccessTokenFormatJWT} {
+		t.Run(format, func(t *testing.T) {
+			o := setupOIDC(t, format)
+			client := o.registerClient(true)
+			if client.ClientSecret != "" {
+				t.Error("public client got a secret")
+			}
+
+			_, body := o.get(OIDCDiscoveryPath)
+			var discovery DiscoveryDocument
+			if err := json.Unmarshal(body, &discovery); err != nil {
+				t.Fatalf("cannot decode discovery: %v", err)
+			}
+			if discovery.Issuer != o.srv.URL || discovery.TokenEndpoint != o.srv.URL+OIDCTokenPath || discovery.JWKSURI != o.srv.URL+OIDCKeysPath {
+				t.Errorf("discovery = %+v", discovery)
+			}
+
+			params, verifier := authorization(client.ID)
+			resp, body := o.get(OIDCAuthorizePath + "?" + params.Encode())
+			if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "Sign in to Test App") {
+				t.Fatalf("authorize status = %d, body = %s", resp.StatusCode, body)
+			}
+			if resp.Header.Get("X-Frame-Options") != "DENY" {
+				t.Error("consent page can be framed")
+			}
+
+			callback := o.consent(params, url.Values{"action": {"allow"}, "email": {"test@example.com"}, "password": {"ValidPassword123!"}})
+			if callback.Get("state") != "state-1" || callback.Get("iss") != o.srv.URL || callback.Get("code") == "" {
+				t.Fatalf("callback = %v", callback)
+			}
+
+			exchange := url.Values{
+				"grant_type":    {"authorization_code"},
+				"client_id":     {client.ID.String()},
+				"code":          {callback.Get("code")},
+				"redirect_uri":  {testRedirectURI},
+				"code_verifier": {verifier},
+			}
+			status, tokens, oauthErr := o.token(exchange)
+			if status != http.StatusOK {
+				t.Fatalf("token status = %d, error = %+v", status, oauthErr)
+			}
+			if tokens.TokenType != "Bearer" || tokens.RefreshToken == "" || tokens.Scope != "openid email" {
+				t.Errorf("tokens = %+v", tokens)
+			}
+
+			var idToken IDTokenClaims
+			o.verifyJWT(tokens.IDToken, &idToken)
+			if idToken.Issuer != o.srv.URL || idToken.Audience != client.ID.String() || idToken.Subject != o.user.ID.String() ||
+				idToken.Nonce != "nonce-1" || idToken.Email != "test@example.com" {
+				t.Errorf("id token claims = %+v", idToken)
+			}
+
+			if format == AccessTokenFormatPASETO {
+				if _, _, err := o.handler.sessions.Authenticate(context.Background(), tokens.AccessToken); err != nil {
+					t.Errorf("access token is not a session token: %v", err)
+				}
+			} else {
+				var claims AccessTokenClaims
+				o.verifyJWT(tokens.AccessToken, &claims)
+				if claims.ClientID != client.ID.String() || claims.Subject != o.user.ID.String() {
+					t.Errorf("access token claims = %+v", claims)
+				}
+			}
+
+			status, info := o.userInfo(tokens.AccessToken)
+			if status != http.StatusOK || info.Subject != o.user.ID.String() || info.Email != "test@example.com" {
+				t.Errorf("userinfo = %d %+v", status, info)
+			}
+
+			// Codes are single use
+			if status, _, oauthErr := o.token(exchange); status != http.StatusBadRequest || oauthErr.Code != "invalid_grant" {
+				t.Errorf("second exchange = %d %+v, want invalid_grant", status, oauthErr)
+			}
+
+			status, refreshed, oauthErr := o.token(url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {client.ID.String()},
+				"refresh_token": {tokens.RefreshToken},
+			})
+			if status != http.StatusOK || refreshed.RefreshToken == tokens.RefreshToken {
+				t.Fatalf("refresh = %d %+v %+v", status, refreshed, oauthErr)
+			}
+			if status, _ := o.userInfo(refreshed.AccessToken); status != http.StatusOK {
+				t.Errorf("userinfo with refreshed token = %d", status)
+			}
+
+			// The refresh token is bound to the client it was issued to.
+			other := o.registerClient(true)
+			status, _, oauthErr = o.token(url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {other.ID.String()},
+				"refresh_token": {refreshed.RefreshToken},
+			})
+			if status != http.StatusBadRequest || oauthErr.Code != "invalid_grant" {
+				t.Errorf("refresh by another client = %d %+v, want invalid_grant", status, oauthErr)
+			}
+			if _, _, err := o.handler.sessions.Refresh(context.Background(), refreshed.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Errorf("first party refresh of a client token error = %v, want ErrInvalidRefreshToken", err)
+			}
+			if status, _, oauthErr := o.token(url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {client.ID.String()},
+				"refresh_token": {refreshed.RefreshToken},
+			}); status != http.StatusOK {
+				t.Errorf("refresh by its client after rejections = %d %+v", status, oauthErr)
+			}
+		})
+	}
+}
+
+func TestOIDCClientsRequireAdmin(t *testing.T) {
+	o := setupOIDC(t, AccessTokenFormatPASETO)
+	client := o.registerClient(true)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		expectedStatus int
+	}{
+		{"register unauthenticated", http.MethodPost, "/oidc/clients", "", http.StatusUnauthorized},
+		{"register by a user", http.MethodPost, "/oidc/clients", "user-token", http.StatusForbidden},
+		{"list unauthenticated", http.MethodGet, "/oidc/clients", "", http.StatusUnauthorized},
+		{"delete unauthenticated", http.MethodDelete, "/oidc/clients/" + client.ID.String(), "", http.StatusUnauthorized},
+		{"delete by a user", http.MethodDelete, "/oidc/clients/" + client.ID.String(), "user-token", http.StatusForbidden},
+		{"delete by an admin", http.MethodDelete, "/oidc/clients/" + client.ID.String(), testAdminToken, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := `{"name":"Intruder","redirect_uris":["https://evil.example.com/callback"]}`
+			req, _ := http.NewRequest(tt.method, o.srv.URL+tt.path, strings.NewReader(payload))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			if resp, body := o.do(req); resp.StatusCode != tt.expectedStatus {
+				t.Errorf("status = %d, want %d: %s", resp.StatusCode, tt.expectedStatus, body)
+			}
+		})
+	}
+}
+
+func TestOIDCAuthorizeRejects(t *testing.T) {
+	o := setupOIDC(t, AccessTokenFormatPASETO)
+	client := o.registerClient(true)
+
+	params, _ := authorization(uuid.New())
+	if resp, _ := o.get(OIDCAuthorizePath + "?" + params.Encode()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown client status = %d, want 400", resp.StatusCode)
+	}
+
+	params, _ = authorization(client.ID)
+	params.Set("redirect_uri", "https://evil.example.com/callback")
+	if resp, _ := o.get(OIDCAuthorizePath + "?" + params.Encode()); resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Location") != "" {
+		t.Errorf("unregistered redirect status = %d, want 400 without redirect", resp.StatusCode)
+	}
+
+	params, _ = authorization(client.ID)
+	params.Del("code_challenge")
+	resp, _ := o.get(OIDCAuthorizePath + "?" + params.Encode())
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || location.Query().Get("error") != "invalid_request" {
+		t.Errorf("missing PKCE = %d %s, want invalid_request redirect", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	params, _ = authorization(client.ID)
+	if callback := o.consent(params, url.Values{"action": {"deny"}}); callback.Get("error") != "access_denied" || callback.Get("code") != "" {
+		t.Errorf("denied callback = %v", callback)
+	}
+
+	form := url.Values{"action": {"allow"}, "email": {"test@example.com"}, "password": {"WrongPassword123!"}}
+	for key, values := range params {
+		form[key] = values
+	}
+	resp, body := o.postForm(OIDCAuthorizePath, form)
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), "Invalid credentials") {
+		t.Errorf("wrong password = %d, body = %s", resp.StatusCode, body)
+	}
+}
+
+func TestOIDCTokenRejects(t *testing.T) {
+	o := setupOIDC(t, AccessTokenFormatPASETO)
+	client := o.registerClient(false)
+	if client.ClientSecret == "" {
+		t.Fatal("confidential client got no secret")
+	}
+
+	credentials := url.Values{"action": {"allow"}, "email": {"test@example.com"}, "password": {"ValidPassword123!"}}
+	exchange := func(code, verifier, secret string) (int, OAuthError) {
+		status, _, oauthErr := o.token(url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {client.ID.String()},
+			"client_secret": {secret},
+			"code":          {code},
+			"redirect_uri":  {testRedirectURI},
+			"code_verifier": {verifier},
+		})
+		return status, oauthErr
+	}
+
+	params, verifier := authorization(client.ID)
+	code := o.consent(params, credentials).Get("code")
+
+	if status, oauthErr := exchange(code, verifier, ""); status != http.StatusUnauthorized || oauthErr.Code != "invalid_client" {
+		t.Errorf("missing secret = %d %+v, want invalid_client", status, oauthErr)
+	}
+	if status, oauthErr := exchange(code, authpkg.GeneratePKCEVerifier(), client.ClientSecret); status != http.StatusBadRequest || oauthErr.Code != "invalid_grant" {
+		t.Errorf("wrong verifier = %d %+v, want invalid_grant", status, oauthErr)
+	}
+
+	params, verifier = authorization(client.ID)
+	code = o.consent(params, credentials).Get("code")
+	o.clock.advance(2 * time.Minute)
+	if status, oauthErr := exchange(code, verifier, client.ClientSecret); status != http.StatusBadRequest || oauthErr.Code != "invalid_grant" {
+		t.Errorf("expired code = %d %+v, want invalid_grant", status, oauthErr)
+	}
+
+	params, verifier = authorization(client.ID)
+	code = o.consent(params, credentials).Get("code")
+	if status, oauthErr := exchange(code, verifier, client.ClientSecret); status != http.StatusOK {
+		t.Errorf("valid exchange = %d %+v", status, oauthErr)
+	}
+
+	if status, _ := o.userInfo("not-a-token"); status != http.StatusUnauthorized {
+		t.Errorf("userinfo with invalid token = %d, want 401", status)
+	}
+}
+
+func TestOIDCAuthorizeWithMFA(t *testing.T) {
+	o := setupOIDC(t, AccessTokenFormatPASETO)
+	secret, _ := enableMFA(t, o.handler.mfa, o.user, o.clock.now())
+	client := o.registerClient(true)
+	params, verifier := authorization(client.ID)
+
+	form := url.Values{"action": {"allow"}, "email": {"test@example.com"}, "password": {"ValidPassword123!"}}
+	for key, values := range params {
+		form[key] = values
+	}
+	resp, body := o.postForm(OIDCAuthorizePath, form)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `name="mfa_token"`) {
+		t.Fatalf("password step = %d, body = %s", resp.StatusCode, body)
+	}
+
+	start := strings.Index(string(body), `name="mfa_token" value="`) + len(`name="mfa_token" value="`)
+	mfaToken := string(body[start : start+strings.Index(string(body[start:]), `"`)])
+
+	o.clock.advance(30 * time.Second)
+	callback := o.consent(params, url.Values{"action": {"allow"}, "mfa_token": {mfaToken}, "code": {authpkg.TOTPCode(secret, o.clock.now())}})
+
+	status, _, oauthErr := o.token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.ID.String()},
+		"code":          {callback.Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	})
+	if status != http.StatusOK {
+		t.Errorf("token after MFA = %d %+v", status, oauthErr)
+	}
+}
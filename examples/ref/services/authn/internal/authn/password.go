@@ -0,0 +1,75 @@
+package authn
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+// passwordPolicy returns the argon2id parameters new password hashes are made
+// with. Unset or out of range settings use the defaults.
+func passwordPolicy(cfg config.AuthConfig) authpkg.PasswordParams {
+	policy := authpkg.DefaultPasswordParams
+	if cfg.PasswordMemory > 0 {
+		policy.Memory = uint32(cfg.PasswordMemory)
+	}
+	if cfg.PasswordTime > 0 {
+		policy.Time = uint32(cfg.PasswordTime)
+	}
+	if cfg.PasswordThreads > 0 && cfg.PasswordThreads <= 255 {
+		policy.Threads = uint8(cfg.PasswordThreads)
+	}
+	return policy
+}
+
+// SetPassword stores a PHC encoded hash of password made with policy. The
+// salt is part of the encoded hash, so the legacy salt column is emptied.
+func (u *User) SetPassword(password string, policy authpkg.PasswordParams) error {
+	hash, err := authpkg.EncodePassword([]byte(password), policy)
+	if err != nil {
+		return fmt.Errorf("cannot hash password: %w", err)
+	}
+
+	u.PasswordHash = []byte(hash)
+	u.PasswordSalt = []byte{}
+	return nil
+}
+
+// CheckPassword verifies password against the user's hash, PHC encoded or
+// legacy. A matching password whose hash is legacy or made with other
+// parameters than policy is rehashed and saved; failing to save only leaves
+// the old hash in place, so that error is returned for logging alone.
+func (u *User) CheckPassword(ctx context.Context, repo UserRepo, password string, policy authpkg.PasswordParams) (bool, error) {
+	ok, rehash := authpkg.CheckPassword([]byte(password), u.PasswordHash, u.PasswordSalt, policy)
+	if !ok || !rehash {
+		return ok, nil
+	}
+
+	if err := u.SetPassword(password, policy); err != nil {
+		return true, err
+	}
+	u.BeforeUpdate()
+	if err := repo.Save(ctx, u); err != nil {
+		return true, fmt.Errorf("cannot save rehashed password: %w", err)
+	}
+	return true, nil
+}
+
+// dummyPasswords holds a hash per policy that is checked when signing in with
+// an unknown email, so the response takes as long as for a wrong password.
+var dummyPasswords sync.Map
+
+func verifyDummyPassword(password string, policy authpkg.PasswordParams) {
+	hash, ok := dummyPasswords.Load(policy)
+	if !ok {
+		encoded, err := authpkg.EncodePassword([]byte("dummy-password"), policy)
+		if err != nil {
+			return
+		}
+		hash, _ = dummyPasswords.LoadOrStore(policy, []byte(encoded))
+	}
+	authpkg.CheckPassword([]byte(password), hash.([]byte), nil, policy)
+}
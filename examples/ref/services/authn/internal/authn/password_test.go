@@ -0,0 +1,75 @@
+package authn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		auth config.AuthConfig
+		want authpkg.PasswordParams
+	}{
+		{"defaults", config.AuthConfig{}, authpkg.DefaultPasswordParams},
+		{"custom", config.AuthConfig{PasswordMemory: 1024, PasswordTime: 3, PasswordThreads: 2}, authpkg.PasswordParams{Memory: 1024, Time: 3, Threads: 2, SaltLength: 16, KeyLength: 32}},
+		{"out of range", config.AuthConfig{PasswordMemory: -1, PasswordThreads: 300}, authpkg.DefaultPasswordParams},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := passwordPolicy(tt.auth); got != tt.want {
+				t.Errorf("passwordPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_SignInRehashesPassword(t *testing.T) {
+	handler, repo, _, user := setupMFA(t)
+	ctx := context.Background()
+
+	signIn := func(password string) int {
+		body := `{"email":"test@example.com","password":"` + password + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/authn/signin", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.SignIn(rr, req)
+		return rr.Code
+	}
+
+	legacy := user.PasswordHash
+	if code := signIn("WrongPassword123!"); code != http.StatusUnauthorized {
+		t.Fatalf("SignIn() wrong password status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if saved, _ := repo.Get(ctx, user.ID); string(saved.PasswordHash) != string(legacy) {
+		t.Fatal("a wrong password rehashed the legacy hash")
+	}
+
+	if code := signIn("ValidPassword123!"); code != http.StatusOK {
+		t.Fatalf("SignIn() legacy hash status = %d, want %d", code, http.StatusOK)
+	}
+	saved, _ := repo.Get(ctx, user.ID)
+	if !strings.HasPrefix(string(saved.PasswordHash), "$argon2id$v=19$m=65536,t=1,p=4$") || len(saved.PasswordSalt) != 0 {
+		t.Fatalf("PasswordHash after sign in = %s, want a PHC hash with the default policy", saved.PasswordHash)
+	}
+
+	handler.xparams.Cfg.Auth.PasswordMemory = 1024
+	handler.xparams.Cfg.Auth.PasswordTime = 2
+	if code := signIn("ValidPassword123!"); code != http.StatusOK {
+		t.Fatalf("SignIn() encoded hash status = %d, want %d", code, http.StatusOK)
+	}
+	saved, _ = repo.Get(ctx, user.ID)
+	if !strings.HasPrefix(string(saved.PasswordHash), "$argon2id$v=19$m=1024,t=2,p=4$") {
+		t.Errorf("PasswordHash after the policy changed = %s, want it rehashed", saved.PasswordHash)
+	}
+
+	if code := signIn("ValidPassword123!"); code != http.StatusOK {
+		t.Errorf("SignIn() rehashed password status = %d, want %d", code, http.StatusOK)
+	}
+}
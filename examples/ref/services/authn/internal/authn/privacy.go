@@ -0,0 +1,251 @@
+package authn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/pkg/client"
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+var (
+	// ErrUserErased is returned when recording data for an erased user.
+	ErrUserErased = errors.New("user erased")
+
+	// ErrGrantsUnavailable is returned by an export when authz cannot be
+	// reached. Exports are not returned without the grants.
+	ErrGrantsUnavailable = errors.New("grants unavailable")
+)
+
+// GrantSource lists the grants a user holds in authz.
+type GrantSource interface {
+	ListByUser(ctx context.Context, userID uuid.UUID) (json.RawMessage, error)
+}
+
+// AuthzGrants reads the grants of users from the authz service. They are
+// passed through as authz renders them, authn not owning their shape.
+type AuthzGrants struct {
+	c *client.Client
+}
+
+// NewAuthzGrants creates a GrantSource for services.authz_url. It returns
+// nil when that is unset, and exports then leave grants out.
+func NewAuthzGrants(xparams config.XParams) GrantSource {
+	url := strings.TrimRight(strings.TrimSpace(xparams.Cfg.Services.AuthzURL), "/")
+	if url == "" {
+		return nil
+	}
+	return &AuthzGrants{c: client.New(url)}
+}
+
+// ListByUser calls GET /authz/grants/users/{user_id}.
+func (g *AuthzGrants) ListByUser(ctx context.Context, userID uuid.UUID) (json.RawMessage, error) {
+	var grants json.RawMessage
+	if err := g.c.Do(ctx, http.MethodGet, "/authz/grants/users/"+userID.String(), nil, &grants); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// UserExport is the data held about a user, as returned by
+// GET /users/{id}/export.
+type UserExport struct {
+	User                *User                   `json:"user"`
+	Email               string                  `json:"email,omitempty"`
+	MFAEnabled          bool                    `json:"mfa_enabled"`
+	Sessions            []*Session              `json:"sessions"`
+	Consents            []authpkg.ConsentRecord `json:"consents"`
+	FederatedIdentities []*FederatedIdentity    `json:"federated_identities"`
+	Grants              json.RawMessage         `json:"grants,omitempty"`
+	ExportedAt          time.Time               `json:"exported_at"`
+}
+
+// PrivacyManager exports and erases the data of users, and records their
+// consents. Erasure crypto-shreds: the user data key is deleted, so PII
+// sealed with it is unreadable wherever it was copied, and the user is kept
+// as a tombstone so audit trails referencing its ID stay intact.
+type PrivacyManager struct {
+	users      UserRepo
+	sessions   SessionRepo
+	mfa        MFARepo
+	consents   ConsentRepo
+	identities FederatedIdentityRepo
+	pii        *PIIKeyring
+	grants     GrantSource
+	log        core.Logger
+	now        func() time.Time
+}
+
+// NewPrivacyManager creates a PrivacyManager. grants may be nil when there
+// is no authz service to export grants from.
+func NewPrivacyManager(users UserRepo, sessions SessionRepo, mfa MFARepo, consents ConsentRepo, identities FederatedIdentityRepo, pii *PIIKeyring, grants GrantSource, xparams config.XParams) *PrivacyManager {
+	return &PrivacyManager{
+		users:      users,
+		sessions:   sessions,
+		mfa:        mfa,
+		consents:   consents,
+		identities: identities,
+		pii:        pii,
+		grants:     grants,
+		log:        xparams.Log,
+		now:        time.Now,
+	}
+}
+
+// Export gathers the data held about a user. Erased users export their
+// tombstone and what outlived it.
+func (p *PrivacyManager) Export(ctx context.Context, user *User) (*UserExport, error) {
+	export := &UserExport{
+		User:       user,
+		MFAEnabled: user.MFASecretCT != nil,
+		ExportedAt: p.now(),
+	}
+
+	if user.ErasedAt == nil {
+		email, err := p.pii.OpenEmail(ctx, user)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt email: %w", err)
+		}
+		export.Email = email
+	}
+
+	sessions, err := p.sessions.ListAllByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list sessions: %w", err)
+	}
+	export.Sessions = sessions
+
+	consents, err := p.Consents(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	export.Consents = consents
+
+	identities, err := p.identities.ListByUser(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list federated identities: %w", err)
+	}
+	export.FederatedIdentities = identities
+
+	if p.grants != nil {
+		grants, err := p.grants.ListByUser(ctx, user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrGrantsUnavailable, err)
+		}
+		export.Grants = grants
+	}
+
+	return export, nil
+}
+
+// RecordConsent appends a consent of the user, stamped now when the record
+// has no timestamp.
+func (p *PrivacyManager) RecordConsent(ctx context.Context, user *User, record authpkg.ConsentRecord) (*Consent, error) {
+	if user.ErasedAt != nil {
+		return nil, ErrUserErased
+	}
+
+	consent := &Consent{
+		ID:        core.GenerateNewID(),
+		UserID:    user.ID,
+		Type:      record.Type,
+		Scope:     record.Scope,
+		Granted:   record.Granted,
+		Timestamp: record.Timestamp,
+	}
+	if consent.Timestamp.IsZero() {
+		consent.Timestamp = p.now()
+	}
+
+	if record.SourceIP != "" {
+		sealed, err := p.pii.SealData(ctx, user.ID, []byte(record.SourceIP))
+		if err != nil {
+			return nil, fmt.Errorf("cannot encrypt consent source ip: %w", err)
+		}
+		consent.SourceIPCT = sealed
+	}
+
+	if err := p.consents.Create(ctx, consent); err != nil {
+		return nil, fmt.Errorf("cannot save consent: %w", err)
+	}
+	return consent, nil
+}
+
+// Consents returns the consent history of a user. Source IPs shredded by
+// erasure are left empty.
+func (p *PrivacyManager) Consents(ctx context.Context, userID uuid.UUID) ([]authpkg.ConsentRecord, error) {
+	consents, err := p.consents.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list consents: %w", err)
+	}
+
+	records := make([]authpkg.ConsentRecord, 0, len(consents))
+	for _, consent := range consents {
+		var sourceIP string
+		if len(consent.SourceIPCT) > 0 {
+			ip, err := p.pii.OpenData(ctx, userID, consent.SourceIPCT)
+			if err != nil && !errors.Is(err, ErrDataShredded) {
+				return nil, fmt.Errorf("cannot decrypt consent source ip: %w", err)
+			}
+			sourceIP = string(ip)
+		}
+		records = append(records, consent.Record(sourceIP))
+	}
+	return records, nil
+}
+
+// Erase crypto-shreds the PII of a user and leaves a tombstone. Sessions are
+// revoked and stripped of client details, MFA and links to federated
+// identities are removed and the data key is deleted before the user is saved as erased, so an erasure that fails half
+// way can be run again. Erasing an erased user does nothing.
+func (p *PrivacyManager) Erase(ctx context.Context, user *User) error {
+	if user.ErasedAt != nil {
+		return nil
+	}
+	now := p.now()
+
+	if err := p.sessions.EraseByUser(ctx, user.ID, RevokeReasonErased, now); err != nil {
+		return fmt.Errorf("cannot erase sessions: %w", err)
+	}
+	if err := p.mfa.Delete(ctx, user.ID); err != nil {
+		return fmt.Errorf("cannot delete mfa record: %w", err)
+	}
+	if err := p.identities.DeleteByUser(ctx, user.ID); err != nil {
+		return fmt.Errorf("cannot delete federated identities: %w", err)
+	}
+	if err := p.pii.Shred(ctx, user.ID); err != nil {
+		return err
+	}
+
+	user.tombstone(now)
+	user.BeforeUpdate()
+	if err := p.users.Save(ctx, user); err != nil {
+		return fmt.Errorf("cannot save erased user: %w", err)
+	}
+	return nil
+}
+
+// tombstone strips the user down to what audit trails need: the ID, status
+// and timestamps. The lookup hash, unique per user, is replaced with one no
+// email hashes to.
+func (u *User) tombstone(at time.Time) {
+	lookup := sha256.Sum256([]byte("erased:" + u.ID.String()))
+
+	u.EmailCT, u.EmailIV, u.EmailTag = nil, nil, nil
+	u.EmailLookup = lookup[:]
+	u.PIIKeyID, u.EmailDataKey = "", false
+	u.PasswordHash, u.PasswordSalt = []byte{}, []byte{}
+	u.MFASecretCT, u.MFADataKey = nil, false
+	u.Status = authpkg.UserStatusDeleted
+	u.ErasedAt = &at
+}
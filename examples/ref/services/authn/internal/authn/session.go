@@ -0,0 +1,75 @@
+package authn
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session reasons recorded when a session is revoked.
+const (
+	RevokeReasonSignOut       = "signout"
+	RevokeReasonUser          = "revoked_by_user"
+	RevokeReasonRefreshReuse  = "refresh_token_reused"
+	RevokeReasonPasswordReset = "password_reset"
+	RevokeReasonErased        = "user_erased"
+)
+
+// Session is a signed in device. Access tokens carry its ID as sid and are
+// renewed with the session refresh token, which rotates on every use. The
+// hash of the token rotated out last is kept to recognize its reuse.
+// Sessions started through an OIDC client record it, and only that client
+// can refresh them.
+type Session struct {
+	ID                  uuid.UUID  `json:"id" db:"id" bson:"_id"`
+	UserID              uuid.UUID  `json:"user_id" db:"user_id" bson:"user_id"`
+	ClientID            string     `json:"client_id,omitempty" db:"client_id" bson:"client_id,omitempty"`
+	RefreshHash         []byte     `json:"-" db:"refresh_hash" bson:"refresh_hash"`
+	PreviousRefreshHash []byte     `json:"-" db:"previous_refresh_hash" bson:"previous_refresh_hash,omitempty"`
+	IP                  string     `json:"ip" db:"ip" bson:"ip"`
+	UserAgent           string     `json:"user_agent" db:"user_agent" bson:"user_agent"`
+	CreatedAt           time.Time  `json:"created_at" db:"created_at" bson:"created_at"`
+	LastSeenAt          time.Time  `json:"last_seen_at" db:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt           time.Time  `json:"expires_at" db:"expires_at" bson:"expires_at"`
+	RevokedAt           *time.Time `json:"revoked_at,omitempty" db:"revoked_at" bson:"revoked_at,omitempty"`
+	RevokeReason        string     `json:"revoke_reason,omitempty" db:"revoke_reason" bson:"revoke_reason,omitempty"`
+}
+
+// Active reports whether the session can still be used.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// SessionRepo persists sessions.
+type SessionRepo interface {
+	// Create stores a new Session.
+	Create(ctx context.Context, session *Session) error
+
+	// Get retrieves a Session by ID.
+	Get(ctx context.Context, id uuid.UUID) (*Session, error)
+
+	// ListByUser retrieves the sessions of a user that are not revoked or expired.
+	ListByUser(ctx context.Context, userID uuid.UUID, now time.Time) ([]*Session, error)
+
+	// ListAllByUser retrieves every session of a user, revoked and expired
+	// ones included.
+	ListAllByUser(ctx context.Context, userID uuid.UUID) ([]*Session, error)
+
+	// RotateRefresh replaces the refresh hash of an unrevoked session only if
+	// it still equals previous, keeps previous as the rotated out hash and
+	// records lastSeen. It reports whether the session was updated, so two
+	// uses of the same refresh token cannot both win.
+	RotateRefresh(ctx context.Context, id uuid.UUID, previous, next []byte, lastSeen time.Time) (bool, error)
+
+	// Revoke marks a Session revoked. Revoking twice keeps the first reason.
+	Revoke(ctx context.Context, id uuid.UUID, reason string, at time.Time) error
+
+	// EraseByUser revokes the unrevoked sessions of a user and clears the IP
+	// and user agent of all of them. The sessions themselves are kept, so
+	// their revocation still reaches other services.
+	EraseByUser(ctx context.Context, userID uuid.UUID, reason string, at time.Time) error
+
+	// ListRevokedSince retrieves the IDs of sessions revoked at or after since.
+	ListRevokedSince(ctx context.Context, since time.Time) ([]uuid.UUID, error)
+}
@@ -0,0 +1,259 @@
+package authn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+)
+
+// revocationsMaxAge is how long verifiers may cache the revocation list.
+const revocationsMaxAge = 30 * time.Second
+
+// RefreshRequest represents the refresh payload
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// SessionInfo is a session as listed to its user.
+type SessionInfo struct {
+	*Session
+	Current bool `json:"current"`
+}
+
+// Refresh handles POST /authn/refresh. The refresh token is rotated: the
+// response carries the one to use next and the presented one stops working.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	req, ok := h.decodeRefreshPayload(w, r, log)
+	if !ok {
+		return
+	}
+
+	tokens, session, err := h.sessions.Refresh(r.Context(), req.RefreshToken)
+	switch {
+	case errors.Is(err, ErrRefreshTokenReused):
+		log.Info("refresh token reused, session revoked")
+		core.RespondError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	case errors.Is(err, ErrInvalidRefreshToken), errors.Is(err, ErrSessionRevoked):
+		log.Debug("refresh rejected", "error", err)
+		core.RespondError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	case err != nil:
+		log.Error("error refreshing session", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not refresh session")
+		return
+	}
+
+	log.Debug("session refreshed", "session_id", session.ID)
+	core.RespondSuccess(w, AuthResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    &tokens.ExpiresAt,
+	})
+}
+
+// SignOut handles POST /authn/signout by revoking the session of the access token.
+func (h *AuthHandler) SignOut(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	session, ok := h.authenticate(w, r, log)
+	if !ok {
+		return
+	}
+
+	if err := h.sessions.Revoke(r.Context(), session.ID, RevokeReasonSignOut); err != nil {
+		log.Error("error revoking session", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not sign out")
+		return
+	}
+
+	log.Debug("user signed out", "session_id", session.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSessions handles GET /authn/sessions, listing the active sessions of the caller.
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	current, ok := h.authenticate(w, r, log)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessions.List(r.Context(), current.UserID)
+	if err != nil {
+		log.Error("error listing sessions", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not list sessions")
+		return
+	}
+
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, SessionInfo{Session: session, Current: session.ID == current.ID})
+	}
+
+	core.RespondSuccess(w, infos)
+}
+
+// RevokeSession handles DELETE /authn/sessions/{id}. Users can only revoke
+// their own sessions; other IDs are reported as not found.
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	current, ok := h.authenticate(w, r, log)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		core.RespondError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	session, err := h.sessions.Get(r.Context(), id)
+	if err != nil {
+		log.Error("error getting session", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not revoke session")
+		return
+	}
+	if session == nil || session.UserID != current.UserID {
+		core.RespondError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	if err := h.sessions.Revoke(r.Context(), id, RevokeReasonUser); err != nil {
+		log.Error("error revoking session", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not revoke session")
+		return
+	}
+
+	log.Debug("session revoked", "session_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetRevocations handles GET /authn/revocations, the list verifiers consult
+// to reject access tokens of revoked sessions before they expire. An optional
+// since query parameter (RFC 3339) limits it to newer revocations.
+func (h *AuthHandler) GetRevocations(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			core.RespondError(w, http.StatusBadRequest, "Invalid since parameter")
+			return
+		}
+		since = parsed
+	}
+
+	ids, err := h.sessions.RevokedSince(r.Context(), since)
+	if err != nil {
+		log.Error("error listing revocations", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not list revocations")
+		return
+	}
+
+	list := core.RevocationList{SessionIDs: make([]string, 0, len(ids))}
+	for _, id := range ids {
+		list.SessionIDs = append(list.SessionIDs, id.String())
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(revocationsMaxAge.Seconds())))
+	core.RespondSuccess(w, list)
+}
+
+// authenticate validates the bearer token and returns its active session,
+// responding 401 when there is none.
+func (h *AuthHandler) authenticate(w http.ResponseWriter, r *http.Request, log core.Logger) (*Session, bool) {
+	token := bearerToken(r)
+	if token == "" {
+		log.Debug("missing authorization header")
+		core.RespondError(w, http.StatusUnauthorized, "Missing authorization header")
+		return nil, false
+	}
+
+	_, session, err := h.sessions.Authenticate(r.Context(), token)
+	if err != nil {
+		log.Debug("invalid token", "error", err)
+		core.RespondError(w, http.StatusUnauthorized, "Invalid token")
+		return nil, false
+	}
+
+	return session, true
+}
+
+// authenticatedUser validates the bearer token and loads its user,
+// responding 401 when either is missing.
+func (h *AuthHandler) authenticatedUser(w http.ResponseWriter, r *http.Request, log core.Logger) (*User, bool) {
+	session, ok := h.authenticate(w, r, log)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := h.repo.Get(r.Context(), session.UserID)
+	if err != nil {
+		log.Error("error finding user", "error", err)
+		core.RespondError(w, http.StatusInternalServerError, "Could not load user")
+		return nil, false
+	}
+	if user == nil {
+		core.RespondError(w, http.StatusUnauthorized, "Invalid token")
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (h *AuthHandler) decodeRefreshPayload(w http.ResponseWriter, r *http.Request, log core.Logger) (RefreshRequest, bool) {
+	var req RefreshRequest
+
+	r.Body = http.MaxBytesReader(w, r.Body, AuthMaxBodyBytes)
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Debug("cannot read request body", "error", err)
+		core.RespondError(w, http.StatusBadRequest, "Could not read request body")
+		return req, false
+	}
+
+	if err := json.Unmarshal(body, &req); err != nil || req.RefreshToken == "" {
+		log.Debug("cannot decode refresh request", "error", err)
+		core.RespondError(w, http.StatusBadRequest, "Refresh token is required")
+		return req, false
+	}
+
+	return req, true
+}
+
+func bearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+// clientIP returns the address recorded for new sessions. The middleware
+// stack sets RemoteAddr from proxy headers when configured to.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
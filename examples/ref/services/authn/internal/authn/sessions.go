@@ -0,0 +1,334 @@
+package authn
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+// SessionAudience is the audience of the access tokens issued by authn.
+const SessionAudience = "session"
+
+const (
+	defaultAccessTTL  = 15 * time.Minute
+	defaultSessionTTL = 24 * time.Hour
+	refreshSecretSize = 32
+
+	// defaultAuthzVersion is the authz_ver of tokens issued when the authz
+	// policy version is unknown.
+	defaultAuthzVersion = 1
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for malformed or unknown refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a rotated refresh token is
+	// presented again. The session is revoked, since the token may be stolen.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	// ErrSessionRevoked is returned for revoked or expired sessions.
+	ErrSessionRevoked = errors.New("session revoked or expired")
+)
+
+// IssuedTokens are returned on sign in and refresh.
+type IssuedTokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	SessionID    uuid.UUID
+}
+
+// SessionManager creates sessions, issues their access and refresh tokens
+// and revokes them. Access tokens are short lived; the refresh token renews
+// them until the session expires and is replaced on every use.
+// Access tokens carry the authz policy version as authz_ver, so services
+// drop the permissions they cached for a user presenting a newer token.
+type SessionManager struct {
+	repo       SessionRepo
+	keys       *Keyring
+	policy     core.PolicyVersionSource
+	accessTTL  time.Duration
+	sessionTTL time.Duration
+	issuer     string
+	verifier   *core.PASETOAuthenticator
+	log        core.Logger
+	now        func() time.Time
+}
+
+// NewSessionManager creates a session manager signing with keys. policy may
+// be nil when there is no authz service, and tokens then carry the default
+// authz_ver. Access tokens carry the OIDC issuer as iss.
+func NewSessionManager(repo SessionRepo, keys *Keyring, policy core.PolicyVersionSource, xparams config.XParams) (*SessionManager, error) {
+	cfg := xparams.Cfg.Auth
+
+	accessTTL, err := parseKeyDuration(cfg.AccessTTL, defaultAccessTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access TTL: %w", err)
+	}
+
+	sessionTTL, err := parseKeyDuration(cfg.SessionTTL, defaultSessionTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session TTL: %w", err)
+	}
+
+	issuer := strings.TrimSuffix(xparams.Cfg.OIDC.Issuer, "/")
+
+	return &SessionManager{
+		repo:       repo,
+		keys:       keys,
+		policy:     policy,
+		accessTTL:  accessTTL,
+		sessionTTL: sessionTTL,
+		issuer:     issuer,
+		verifier:   core.NewPASETOAuthenticator(keys, []string{SessionAudience}, 0).WithIssuer(issuer),
+		log:        xparams.Log,
+		now:        time.Now,
+	}, nil
+}
+
+// AccessTTL is the lifetime of access tokens.
+func (m *SessionManager) AccessTTL() time.Duration {
+	return m.accessTTL
+}
+
+// Start creates a session for the user and issues its first tokens.
+func (m *SessionManager) Start(ctx context.Context, userID uuid.UUID, ip, userAgent string) (*IssuedTokens, error) {
+	return m.StartForClient(ctx, "", userID, ip, userAgent)
+}
+
+// StartForClient creates a session for the user signed in through an OIDC
+// client. Its refresh token is only accepted from that client.
+func (m *SessionManager) StartForClient(ctx context.Context, clientID string, userID uuid.UUID, ip, userAgent string) (*IssuedTokens, error) {
+	secret, hash := newRefreshSecret()
+	now := m.now()
+
+	session := &Session{
+		ID:          uuid.New(),
+		UserID:      userID,
+		ClientID:    clientID,
+		RefreshHash: hash,
+		IP:          ip,
+		UserAgent:   userAgent,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(m.sessionTTL),
+	}
+
+	if err := m.repo.Create(ctx, session); err != nil {
+		return nil, fmt.Errorf("cannot create session: %w", err)
+	}
+
+	return m.issue(ctx, session, secret)
+}
+
+// Refresh exchanges a refresh token for new access and refresh tokens.
+// Presenting the refresh token that was rotated out revokes the session; any
+// other unknown secret is rejected without touching it, since session IDs are
+// not secret.
+func (m *SessionManager) Refresh(ctx context.Context, refreshToken string) (*IssuedTokens, *Session, error) {
+	return m.RefreshForClient(ctx, "", refreshToken)
+}
+
+// RefreshForClient is Refresh for the refresh tokens of sessions started
+// through the OIDC client clientID. Tokens of other sessions are rejected.
+func (m *SessionManager) RefreshForClient(ctx context.Context, clientID, refreshToken string) (*IssuedTokens, *Session, error) {
+	sessionID, secret, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := m.repo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot get session: %w", err)
+	}
+	if session == nil || session.ClientID != clientID {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	now := m.now()
+	if !session.Active(now) {
+		return nil, nil, ErrSessionRevoked
+	}
+
+	hash := hashRefreshSecret(secret)
+	if subtle.ConstantTimeCompare(hash, session.RefreshHash) != 1 {
+		if subtle.ConstantTimeCompare(hash, session.PreviousRefreshHash) == 1 {
+			return nil, nil, m.revokeReused(ctx, session.ID)
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	nextSecret, nextHash := newRefreshSecret()
+	rotated, err := m.repo.RotateRefresh(ctx, session.ID, hash, nextHash, now)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot rotate refresh token: %w", err)
+	}
+	if !rotated {
+		// Another request used the same token first.
+		return nil, nil, m.revokeReused(ctx, session.ID)
+	}
+
+	session.PreviousRefreshHash = session.RefreshHash
+	session.RefreshHash = nextHash
+	session.LastSeenAt = now
+
+	tokens, err := m.issue(ctx, session, nextSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, session, nil
+}
+
+// Authenticate validates an access token issued by authn and checks that its
+// session is still active.
+func (m *SessionManager) Authenticate(ctx context.Context, token string) (*authpkg.TokenClaims, *Session, error) {
+	claims, err := m.verifier.ValidateToken(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid session id", authpkg.ErrInvalidToken)
+	}
+
+	session, err := m.repo.Get(ctx, sessionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot get session: %w", err)
+	}
+	if session == nil || !session.Active(m.now()) || session.UserID.String() != claims.Subject {
+		return nil, nil, ErrSessionRevoked
+	}
+
+	return claims, session, nil
+}
+
+// ValidateToken implements core.Authenticator with Authenticate, so that
+// authn endpoints can be guarded by core.AuthMiddleware.
+func (m *SessionManager) ValidateToken(ctx context.Context, token string) (*authpkg.TokenClaims, error) {
+	claims, _, err := m.Authenticate(ctx, token)
+	return claims, err
+}
+
+// Get returns a session by ID, or nil if there is none.
+func (m *SessionManager) Get(ctx context.Context, sessionID uuid.UUID) (*Session, error) {
+	return m.repo.Get(ctx, sessionID)
+}
+
+// List returns the active sessions of a user.
+func (m *SessionManager) List(ctx context.Context, userID uuid.UUID) ([]*Session, error) {
+	return m.repo.ListByUser(ctx, userID, m.now())
+}
+
+// Revoke ends a session. Its access tokens are rejected by verifiers that
+// consult the revocation list and expire within the access TTL anyway.
+func (m *SessionManager) Revoke(ctx context.Context, sessionID uuid.UUID, reason string) error {
+	return m.repo.Revoke(ctx, sessionID, reason, m.now())
+}
+
+// RevokeAll ends every active session of a user, as after a password reset.
+func (m *SessionManager) RevokeAll(ctx context.Context, userID uuid.UUID, reason string) error {
+	now := m.now()
+	sessions, err := m.repo.ListByUser(ctx, userID, now)
+	if err != nil {
+		return fmt.Errorf("cannot list sessions: %w", err)
+	}
+
+	for _, session := range sessions {
+		if err := m.repo.Revoke(ctx, session.ID, reason, now); err != nil {
+			return fmt.Errorf("cannot revoke session: %w", err)
+		}
+	}
+	return nil
+}
+
+// RevokedSince lists sessions revoked since the given time. Revocations
+// older than the access TTL are left out: their access tokens have expired.
+func (m *SessionManager) RevokedSince(ctx context.Context, since time.Time) ([]uuid.UUID, error) {
+	if oldest := m.now().Add(-m.accessTTL); since.Before(oldest) {
+		since = oldest
+	}
+	return m.repo.ListRevokedSince(ctx, since)
+}
+
+func (m *SessionManager) revokeReused(ctx context.Context, sessionID uuid.UUID) error {
+	if err := m.repo.Revoke(ctx, sessionID, RevokeReasonRefreshReuse, m.now()); err != nil {
+		return fmt.Errorf("cannot revoke session: %w", err)
+	}
+	return ErrRefreshTokenReused
+}
+
+func (m *SessionManager) issue(ctx context.Context, session *Session, secret string) (*IssuedTokens, error) {
+	kid, privateKey, err := m.keys.SigningKey()
+	if err != nil {
+		return nil, fmt.Errorf("could not get signing key: %w", err)
+	}
+
+	claims := authpkg.CreateTokenClaims(session.UserID.String(), session.ID.String(), SessionAudience, map[string]string{"type": "global"}, m.accessTTL, m.authzVersion(ctx))
+	claims.Issuer = m.issuer
+	token, err := authpkg.GeneratePASETOTokenWithOptions(claims, privateKey, authpkg.TokenOptions{KeyID: kid})
+	if err != nil {
+		return nil, fmt.Errorf("could not sign access token: %w", err)
+	}
+
+	return &IssuedTokens{
+		AccessToken:  token,
+		RefreshToken: session.ID.String() + "." + secret,
+		ExpiresAt:    time.Unix(claims.ExpiresAt, 0),
+		SessionID:    session.ID,
+	}, nil
+}
+
+// authzVersion returns the current authz policy version. Tokens are still
+// issued when authz cannot be reached, with the default version.
+func (m *SessionManager) authzVersion(ctx context.Context) int {
+	if m.policy == nil {
+		return defaultAuthzVersion
+	}
+
+	version, err := m.policy.PolicyVersion(ctx)
+	if err != nil {
+		m.log.Error("cannot get authz policy version", "error", err)
+		return defaultAuthzVersion
+	}
+	if version < defaultAuthzVersion {
+		return defaultAuthzVersion
+	}
+	return int(version)
+}
+
+// newRefreshSecret returns a random refresh secret and the hash stored for it
+func newRefreshSecret() (string, []byte) {
+	secret := base64.RawURLEncoding.EncodeToString(authpkg.GenerateRandomBytes(refreshSecretSize))
+	return secret, hashRefreshSecret(secret)
+}
+
+func hashRefreshSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// parseRefreshToken splits a refresh token into its session ID and secret
+func parseRefreshToken(token string) (uuid.UUID, string, error) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return uuid.Nil, "", ErrInvalidRefreshToken
+	}
+
+	sessionID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, "", ErrInvalidRefreshToken
+	}
+
+	return sessionID, secret, nil
+}
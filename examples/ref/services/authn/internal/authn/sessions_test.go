@@ -0,0 +1,512 @@
+package authn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
+)
+
+type mockSessionRepo struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]Session
+}
+
+func newMockSessionRepo() *mockSessionRepo {
+	return &mockSessionRepo{sessions: make(map[uuid.UUID]Session)}
+}
+
+func (m *mockSessionRepo) Create(ctx context.Context, session *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session.ID] = *session
+	return nil
+}
+
+func (m *mockSessionRepo) Get(ctx context.Context, id uuid.UUID) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (m *mockSessionRepo) ListByUser(ctx context.Context, userID uuid.UUID, now time.Time) ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []*Session
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.Active(now) {
+			session := session
+			sessions = append(sessions, &session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *mockSessionRepo) ListAllByUser(ctx context.Context, userID uuid.UUID) ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []*Session
+	for _, session := range m.sessions {
+		if session.UserID == userID {
+			session := session
+			sessions = append(sessions, &session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *mockSessionRepo) RotateRefresh(ctx context.Context, id uuid.UUID, previous, next []byte, lastSeen time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok || session.RevokedAt != nil || !bytes.Equal(session.RefreshHash, previous) {
+		return false, nil
+	}
+	session.PreviousRefreshHash = session.RefreshHash
+	session.RefreshHash = next
+	session.LastSeenAt = lastSeen
+	m.sessions[id] = session
+	return true, nil
+}
+
+func (m *mockSessionRepo) Revoke(ctx context.Context, id uuid.UUID, reason string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok || session.RevokedAt != nil {
+		return nil
+	}
+	session.RevokedAt = &at
+	session.RevokeReason = reason
+	m.sessions[id] = session
+	return nil
+}
+
+func (m *mockSessionRepo) EraseByUser(ctx context.Context, userID uuid.UUID, reason string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, session := range m.sessions {
+		if session.UserID != userID {
+			continue
+		}
+		if session.RevokedAt == nil {
+			session.RevokedAt = &at
+			session.RevokeReason = reason
+		}
+		session.IP, session.UserAgent = "", ""
+		m.sessions[id] = session
+	}
+	return nil
+}
+
+func (m *mockSessionRepo) ListRevokedSince(ctx context.Context, since time.Time) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []uuid.UUID
+	for _, session := range m.sessions {
+		if session.RevokedAt != nil && !session.RevokedAt.Before(since) {
+			ids = append(ids, session.ID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	return ids, nil
+}
+
+func newTestSessionManager(t *testing.T, repo SessionRepo, auth config.AuthConfig) *SessionManager {
+	t.Helper()
+	keys := newTestKeyring(t, newMockSigningKeyRepo(), auth)
+	if err := keys.ensureKeys(context.Background()); err != nil {
+		t.Fatalf("ensureKeys() error = %v", err)
+	}
+	sessions, err := NewSessionManager(repo, keys, nil, config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{Auth: auth}})
+	if err != nil {
+		t.Fatalf("NewSessionManager() error = %v", err)
+	}
+	return sessions
+}
+
+func TestNewSessionManager(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    config.AuthConfig
+		wantErr bool
+	}{
+		{"defaults", config.AuthConfig{}, false},
+		{"configured", config.AuthConfig{AccessTTL: "5m", SessionTTL: "720h"}, false},
+		{"invalid access TTL", config.AuthConfig{AccessTTL: "soon"}, true},
+		{"invalid session TTL", config.AuthConfig{SessionTTL: "-1h"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSessionManager(newMockSessionRepo(), nil, nil, config.XParams{Log: core.NewNoopLogger(), Cfg: &config.Config{Auth: tt.auth}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSessionManager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSessionManagerRefreshRotates(t *testing.T) {
+	repo := newMockSessionRepo()
+	sessions := newTestSessionManager(t, repo, config.AuthConfig{})
+	ctx := context.Background()
+	userID := uuid.New()
+
+	first, err := sessions.Start(ctx, userID, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	_, secret, _ := parseRefreshToken(first.RefreshToken)
+	if stored := repo.sessions[first.SessionID]; !bytes.Equal(stored.RefreshHash, hashRefreshSecret(secret)) {
+		t.Error("refresh token is not stored hashed")
+	}
+
+	second, session, err := sessions.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if second.SessionID != first.SessionID || session.UserID != userID {
+		t.Errorf("Refresh() session = %s, want %s", second.SessionID, first.SessionID)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("Refresh() did not rotate the refresh token")
+	}
+
+	claims, _, err := sessions.Authenticate(ctx, second.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if claims.Subject != userID.String() || claims.SessionID != first.SessionID.String() {
+		t.Errorf("Authenticate() claims = %+v", claims)
+	}
+
+	if _, _, err := sessions.Refresh(ctx, second.RefreshToken); err != nil {
+		t.Errorf("Refresh() with rotated token error = %v", err)
+	}
+}
+
+func TestSessionManagerIssuer(t *testing.T) {
+	keys := newTestKeyring(t, newMockSigningKeyRepo(), config.AuthConfig{})
+	if err := keys.ensureKeys(context.Background()); err != nil {
+		t.Fatalf("ensureKeys() error = %v", err)
+	}
+	cfg := &config.Config{OIDC: config.OIDCConfig{Issuer: "https://authn.example.com/"}}
+	sessions, err := NewSessionManager(newMockSessionRepo(), keys, nil, config.XParams{Log: core.NewNoopLogger(), Cfg: cfg})
+	if err != nil {
+		t.Fatalf("NewSessionManager() error = %v", err)
+	}
+	ctx := context.Background()
+
+	tokens, err := sessions.Start(ctx, uuid.New(), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	claims, _, err := sessions.Authenticate(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if claims.Issuer != "https://authn.example.com" {
+		t.Errorf("Issuer = %q, want https://authn.example.com", claims.Issuer)
+	}
+
+	other, err := core.NewPASETOAuthenticator(keys, []string{SessionAudience}, 0).WithIssuer("https://other.example.com").ValidateToken(ctx, tokens.AccessToken)
+	if !errors.Is(err, authpkg.ErrInvalidToken) {
+		t.Errorf("ValidateToken() with other issuer = %v, %v, want ErrInvalidToken", other, err)
+	}
+}
+
+type stubPolicyVersion struct {
+	version int64
+	err     error
+}
+
+func (s *stubPolicyVersion) PolicyVersion(ctx context.Context) (int64, error) {
+	return s.version, s.err
+}
+
+func TestSessionManagerAuthzVersion(t *testing.T) {
+	policy := &stubPolicyVersion{version: 42}
+	sessions := newTestSessionManager(t, newMockSessionRepo(), config.AuthConfig{})
+	sessions.policy = policy
+	ctx := context.Background()
+
+	authzVersion := func(tokens *IssuedTokens) int {
+		t.Helper()
+		claims, _, err := sessions.Authenticate(ctx, tokens.AccessToken)
+		if err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		return claims.AuthzVersion
+	}
+
+	tokens, err := sessions.Start(ctx, uuid.New(), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if got := authzVersion(tokens); got != 42 {
+		t.Errorf("authz_ver = %d, want 42", got)
+	}
+
+	// Grants changed in authz.
+	policy.version = 43
+	tokens, _, err = sessions.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got := authzVersion(tokens); got != 43 {
+		t.Errorf("authz_ver after policy change = %d, want 43", got)
+	}
+
+	policy.err = errors.New("authz down")
+	tokens, _, err = sessions.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() with authz down error = %v", err)
+	}
+	if got := authzVersion(tokens); got != defaultAuthzVersion {
+		t.Errorf("authz_ver with authz down = %d, want %d", got, defaultAuthzVersion)
+	}
+}
+
+func TestSessionManagerRefreshReuseRevokes(t *testing.T) {
+	repo := newMockSessionRepo()
+	sessions := newTestSessionManager(t, repo, config.AuthConfig{})
+	ctx := context.Background()
+
+	first, err := sessions.Start(ctx, uuid.New(), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	second, _, err := sessions.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	// The rotated token comes back: whoever holds it may have stolen it.
+	if _, _, err := sessions.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Refresh() with reused token error = %v, want ErrRefreshTokenReused", err)
+	}
+	if got := repo.sessions[first.SessionID].RevokeReason; got != RevokeReasonRefreshReuse {
+		t.Errorf("revoke reason = %q, want %q", got, RevokeReasonRefreshReuse)
+	}
+
+	// The legitimate holder is signed out as well.
+	if _, _, err := sessions.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("Refresh() after reuse error = %v, want ErrSessionRevoked", err)
+	}
+	if _, _, err := sessions.Authenticate(ctx, second.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("Authenticate() after reuse error = %v, want ErrSessionRevoked", err)
+	}
+}
+
+func TestSessionManagerRefreshForgedSecretKeepsSession(t *testing.T) {
+	repo := newMockSessionRepo()
+	sessions := newTestSessionManager(t, repo, config.AuthConfig{})
+	ctx := context.Background()
+
+	tokens, err := sessions.Start(ctx, uuid.New(), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Session IDs are visible in access tokens, so anyone can pair one with
+	// a made up secret. That must not sign the user out.
+	forged := tokens.SessionID.String() + ".garbage"
+	if _, _, err := sessions.Refresh(ctx, forged); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh() with forged secret error = %v, want ErrInvalidRefreshToken", err)
+	}
+	if stored := repo.sessions[tokens.SessionID]; stored.RevokedAt != nil {
+		t.Fatalf("session revoked by forged secret: %q", stored.RevokeReason)
+	}
+
+	if _, _, err := sessions.Refresh(ctx, tokens.RefreshToken); err != nil {
+		t.Errorf("Refresh() after forged secret error = %v", err)
+	}
+}
+
+func TestSessionManagerRefreshRejects(t *testing.T) {
+	sessions := newTestSessionManager(t, newMockSessionRepo(), config.AuthConfig{SessionTTL: "1h"})
+	ctx := context.Background()
+	now := time.Now()
+	sessions.now = func() time.Time { return now }
+
+	tokens, err := sessions.Start(ctx, uuid.New(), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"malformed", "not-a-refresh-token", ErrInvalidRefreshToken},
+		{"invalid session id", "session.secret", ErrInvalidRefreshToken},
+		{"unknown session", uuid.New().String() + ".secret", ErrInvalidRefreshToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := sessions.Refresh(ctx, tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("Refresh() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	now = now.Add(time.Hour)
+	if _, _, err := sessions.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("Refresh() of expired session error = %v, want ErrSessionRevoked", err)
+	}
+}
+
+func TestSessionManagerRevokedSince(t *testing.T) {
+	sessions := newTestSessionManager(t, newMockSessionRepo(), config.AuthConfig{AccessTTL: "15m"})
+	ctx := context.Background()
+	now := time.Now()
+	sessions.now = func() time.Time { return now }
+
+	old, _ := sessions.Start(ctx, uuid.New(), "", "")
+	if err := sessions.Revoke(ctx, old.SessionID, RevokeReasonSignOut); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+
+	now = now.Add(20 * time.Minute)
+	recent, _ := sessions.Start(ctx, uuid.New(), "", "")
+	if err := sessions.Revoke(ctx, recent.SessionID, RevokeReasonUser); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+
+	// Access tokens of the older session have expired, so it is not listed.
+	ids, err := sessions.RevokedSince(ctx, time.Time{})
+	if err != nil {
+		t.Fatalf("RevokedSince() error = %v", err)
+	}
+	if len(ids) != 1 || ids[0] != recent.SessionID {
+		t.Errorf("RevokedSince() = %v, want [%s]", ids, recent.SessionID)
+	}
+}
+
+func TestAuthHandler_Refresh(t *testing.T) {
+	handler, _ := setupAuthHandler()
+	tokens, err := handler.sessions.Start(context.Background(), uuid.New(), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"missing token", `{}`, http.StatusBadRequest},
+		{"invalid JSON", `refresh`, http.StatusBadRequest},
+		{"invalid token", `{"refresh_token":"invalid"}`, http.StatusUnauthorized},
+		{"valid token", `{"refresh_token":"` + tokens.RefreshToken + `"}`, http.StatusOK},
+		{"reused token", `{"refresh_token":"` + tokens.RefreshToken + `"}`, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/authn/refresh", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			handler.Refresh(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Refresh() status = %d, want %d", rr.Code, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Sessions(t *testing.T) {
+	handler, _ := setupAuthHandler()
+	ctx := context.Background()
+	userID := uuid.New()
+
+	current, _ := handler.sessions.Start(ctx, userID, "127.0.0.1", "current")
+	other, _ := handler.sessions.Start(ctx, userID, "127.0.0.2", "other")
+	stranger, _ := handler.sessions.Start(ctx, uuid.New(), "127.0.0.3", "stranger")
+
+	r := chi.NewRouter()
+	handler.RegisterRoutes(r)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+current.AccessToken)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodGet, "/authn/sessions")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /authn/sessions status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var list struct {
+		Data []struct {
+			ID        uuid.UUID `json:"id"`
+			UserAgent string    `json:"user_agent"`
+			Current   bool      `json:"current"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("cannot decode sessions: %v", err)
+	}
+	if len(list.Data) != 2 {
+		t.Fatalf("sessions = %d, want 2", len(list.Data))
+	}
+	for _, session := range list.Data {
+		if session.Current != (session.ID == current.SessionID) {
+			t.Errorf("session %s current = %v", session.UserAgent, session.Current)
+		}
+	}
+	if strings.Contains(rr.Body.String(), "refresh_hash") {
+		t.Error("sessions list exposes the refresh hash")
+	}
+
+	if rr := do(http.MethodDelete, "/authn/sessions/"+stranger.SessionID.String()); rr.Code != http.StatusNotFound {
+		t.Errorf("revoke other user session status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+	if rr := do(http.MethodDelete, "/authn/sessions/invalid"); rr.Code != http.StatusBadRequest {
+		t.Errorf("revoke invalid id status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	if rr := do(http.MethodDelete, "/authn/sessions/"+other.SessionID.String()); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke own session status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+
+	rr = do(http.MethodGet, "/authn/revocations")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET /authn/revocations status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var revocations struct {
+		Data core.RevocationList `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&revocations); err != nil {
+		t.Fatalf("cannot decode revocations: %v", err)
+	}
+	if len(revocations.Data.SessionIDs) != 1 || revocations.Data.SessionIDs[0] != other.SessionID.String() {
+		t.Errorf("revocations = %v, want [%s]", revocations.Data.SessionIDs, other.SessionID)
+	}
+
+	if rr := do(http.MethodGet, "/authn/revocations?since=yesterday"); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid since status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
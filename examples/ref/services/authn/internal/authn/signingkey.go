@@ -0,0 +1,47 @@
+package authn
+
+import (
+	"context"
+	"time"
+)
+
+// KeyStatus is the lifecycle state of a token signing key.
+type KeyStatus string
+
+const (
+	// KeyStatusActive keys sign new tokens. There is one active key at a time.
+	KeyStatusActive KeyStatus = "active"
+	// KeyStatusVerifying keys no longer sign but are still published so
+	// tokens they signed stay valid until they expire.
+	KeyStatusVerifying KeyStatus = "verifying"
+	// KeyStatusRetired keys are neither used nor published.
+	KeyStatusRetired KeyStatus = "retired"
+)
+
+// SigningKey is an Ed25519 token signing key. The private key is stored
+// encrypted with the service encryption key.
+type SigningKey struct {
+	ID            string    `json:"kid" db:"id" bson:"_id"`
+	PublicKey     []byte    `json:"-" db:"public_key" bson:"public_key"`
+	PrivateKeyCT  []byte    `json:"-" db:"private_key_ct" bson:"private_key_ct"`
+	PrivateKeyIV  []byte    `json:"-" db:"private_key_iv" bson:"private_key_iv"`
+	PrivateKeyTag []byte    `json:"-" db:"private_key_tag" bson:"private_key_tag"`
+	Status        KeyStatus `json:"status" db:"status" bson:"status"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at" bson:"created_at"`
+	// RotatedAt is when the key stopped signing. Zero while active.
+	RotatedAt time.Time `json:"rotated_at,omitempty" db:"rotated_at" bson:"rotated_at,omitempty"`
+	// RetiredAt is when the key stopped being published. Zero until retired.
+	RetiredAt time.Time `json:"retired_at,omitempty" db:"retired_at" bson:"retired_at,omitempty"`
+}
+
+// SigningKeyRepo persists token signing keys.
+type SigningKeyRepo interface {
+	// Create stores a new SigningKey.
+	Create(ctx context.Context, key *SigningKey) error
+
+	// Save updates the status and timestamps of an existing SigningKey.
+	Save(ctx context.Context, key *SigningKey) error
+
+	// List retrieves all SigningKeys that are not retired.
+	List(ctx context.Context) ([]*SigningKey, error)
+}
@@ -10,19 +10,24 @@ import (
 
 // User is the aggregate root for the User domain.
 type User struct {
-	ID           uuid.UUID          `json:"id" db:"id" bson:"_id"`
-	EmailCT      []byte             `json:"-" db:"email_ct" bson:"email_ct"`
-	EmailIV      []byte             `json:"-" db:"email_iv" bson:"email_iv"`
-	EmailTag     []byte             `json:"-" db:"email_tag" bson:"email_tag"`
-	EmailLookup  []byte             `json:"-" db:"email_lookup" bson:"email_lookup"`
-	PasswordHash []byte             `json:"-" db:"password_hash" bson:"pass_hash"`
-	PasswordSalt []byte             `json:"-" db:"password_salt" bson:"pass_salt"`
-	MFASecretCT  []byte             `json:"-" db:"mfa_secret_ct" bson:"mfa_secret_ct,omitempty"`
-	Status       authpkg.UserStatus `json:"status" db:"status" bson:"status"`
-	CreatedAt    time.Time          `json:"created_at" db:"created_at" bson:"created_at"`
-	CreatedBy    string             `json:"created_by" db:"created_by" bson:"created_by"`
-	UpdatedAt    time.Time          `json:"updated_at" db:"updated_at" bson:"updated_at"`
-	UpdatedBy    string             `json:"updated_by" db:"updated_by" bson:"updated_by"`
+	ID              uuid.UUID          `json:"id" db:"id" bson:"_id"`
+	EmailCT         []byte             `json:"-" db:"email_ct" bson:"email_ct"`
+	EmailIV         []byte             `json:"-" db:"email_iv" bson:"email_iv"`
+	EmailTag        []byte             `json:"-" db:"email_tag" bson:"email_tag"`
+	EmailLookup     []byte             `json:"-" db:"email_lookup" bson:"email_lookup"`
+	PIIKeyID        string             `json:"-" db:"pii_key_id" bson:"pii_key_id"`
+	EmailDataKey    bool               `json:"-" db:"email_data_key" bson:"email_data_key,omitempty"`
+	PasswordHash    []byte             `json:"-" db:"password_hash" bson:"pass_hash"`
+	PasswordSalt    []byte             `json:"-" db:"password_salt" bson:"pass_salt"`
+	MFASecretCT     []byte             `json:"-" db:"mfa_secret_ct" bson:"mfa_secret_ct,omitempty"`
+	MFADataKey      bool               `json:"-" db:"mfa_data_key" bson:"mfa_data_key,omitempty"`
+	EmailVerifiedAt *time.Time         `json:"email_verified_at,omitempty" db:"email_verified_at" bson:"email_verified_at,omitempty"`
+	ErasedAt        *time.Time         `json:"erased_at,omitempty" db:"erased_at" bson:"erased_at,omitempty"`
+	Status          authpkg.UserStatus `json:"status" db:"status" bson:"status"`
+	CreatedAt       time.Time          `json:"created_at" db:"created_at" bson:"created_at"`
+	CreatedBy       string             `json:"created_by" db:"created_by" bson:"created_by"`
+	UpdatedAt       time.Time          `json:"updated_at" db:"updated_at" bson:"updated_at"`
+	UpdatedBy       string             `json:"updated_by" db:"updated_by" bson:"updated_by"`
 }
 
 // GetID returns the ID of the User (implements Identifiable interface).
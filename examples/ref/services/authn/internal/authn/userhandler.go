@@ -2,6 +2,7 @@ package authn
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
@@ -10,6 +11,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
 
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
 	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
 	"github.com/adrianpk/hatmax-ref/services/authn/internal/config"
 )
@@ -17,18 +19,35 @@ import (
 const UserMaxBodyBytes = 1 << 20
 
 // NewUserHandler creates a new UserHandler for the User aggregate.
-func NewUserHandler(repo UserRepo, xparams config.XParams) *UserHandler {
+// Resetting MFA requires an admin admitted by guard; exports and consents
+// are open to the user as well.
+func NewUserHandler(repo UserRepo, mfa *MFAManager, privacy *PrivacyManager, guard *AdminGuard, xparams config.XParams) *UserHandler {
 	return &UserHandler{
 		repo:    repo,
+		mfa:     mfa,
+		privacy: privacy,
+		guard:   guard,
 		xparams: xparams,
 	}
 }
 
 type UserHandler struct {
 	repo    UserRepo
+	mfa     *MFAManager
+	privacy *PrivacyManager
+	guard   *AdminGuard
 	xparams config.XParams
 }
 
+// ConsentRequest is the payload of POST /users/{id}/consents. SourceIP
+// defaults to the address of the caller.
+type ConsentRequest struct {
+	Type     string `json:"type"`
+	Scope    string `json:"scope"`
+	Granted  bool   `json:"granted"`
+	SourceIP string `json:"source_ip"`
+}
+
 func (h *UserHandler) RegisterRoutes(r chi.Router) {
 	r.Route("/users", func(r chi.Router) {
 		r.Post("/", h.CreateUser)
@@ -36,6 +55,10 @@ func (h *UserHandler) RegisterRoutes(r chi.Router) {
 		r.Get("/{id}", h.GetUser)
 		r.Put("/{id}", h.UpdateUser)
 		r.Delete("/{id}", h.DeleteUser)
+		r.With(h.guard.Require(string(authpkg.PermUsersWrite))).Delete("/{id}/mfa", h.ResetMFA)
+		r.With(h.guard.RequireSelfOr("id", string(authpkg.PermUsersRead))).Get("/{id}/export", h.ExportUser)
+		r.With(h.guard.RequireSelfOr("id", string(authpkg.PermUsersRead))).Get("/{id}/consents", h.ListConsents)
+		r.With(h.guard.RequireSelfOr("id", string(authpkg.PermUsersWrite))).Post("/{id}/consents", h.RecordConsent)
 	})
 }
 
@@ -149,26 +172,171 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	core.RespondSuccess(w, user, links...)
 }
 
+// DeleteUser erases a user: its PII is crypto-shredded and the user is kept
+// as a tombstone with the deleted status.
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	log := h.logForRequest(r)
 	ctx := r.Context()
 
-	id, ok := h.parseIDParam(w, r)
+	user, ok := h.loadUser(w, r, "Could not delete user")
 	if !ok {
 		return
 	}
 
-	if err := h.repo.Delete(ctx, id); err != nil {
-		log.Error("error deleting user", "error", err, "id", id.String())
+	if err := h.privacy.Erase(ctx, user); err != nil {
+		log.Error("error erasing user", "error", err, "id", user.ID.String())
 		core.RespondError(w, http.StatusInternalServerError, "Could not delete user")
 		return
 	}
 
+	log.Info("user erased", "id", user.ID.String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportUser returns the data held about a user, grants from authz included.
+func (h *UserHandler) ExportUser(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	user, ok := h.loadUser(w, r, "Could not export user")
+	if !ok {
+		return
+	}
+
+	export, err := h.privacy.Export(ctx, user)
+	if errors.Is(err, ErrGrantsUnavailable) {
+		log.Error("cannot fetch grants for export", "error", err, "id", user.ID.String())
+		core.RespondError(w, http.StatusBadGateway, "Could not fetch grants")
+		return
+	}
+	if err != nil {
+		log.Error("error exporting user", "error", err, "id", user.ID.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not export user")
+		return
+	}
+
+	log.Info("user exported", "id", user.ID.String())
+	core.RespondSuccess(w, export)
+}
+
+// ListConsents returns the consent history of a user.
+func (h *UserHandler) ListConsents(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	user, ok := h.loadUser(w, r, "Could not list consents")
+	if !ok {
+		return
+	}
+
+	consents, err := h.privacy.Consents(ctx, user.ID)
+	if err != nil {
+		log.Error("error listing consents", "error", err, "id", user.ID.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not list consents")
+		return
+	}
+
+	core.RespondSuccess(w, consents)
+}
+
+// RecordConsent appends a consent given or withdrawn by a user.
+func (h *UserHandler) RecordConsent(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	user, ok := h.loadUser(w, r, "Could not record consent")
+	if !ok {
+		return
+	}
+
+	var req ConsentRequest
+	r.Body = http.MaxBytesReader(w, r.Body, UserMaxBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		core.RespondError(w, http.StatusBadRequest, "Could not parse JSON")
+		return
+	}
+	if strings.TrimSpace(req.Type) == "" {
+		core.RespondError(w, http.StatusBadRequest, "Consent type is required")
+		return
+	}
+	if req.SourceIP == "" {
+		req.SourceIP = clientIP(r)
+	}
+
+	record := authpkg.ConsentRecord{Type: req.Type, Scope: req.Scope, Granted: req.Granted, SourceIP: req.SourceIP}
+	consent, err := h.privacy.RecordConsent(ctx, user, record)
+	if errors.Is(err, ErrUserErased) {
+		core.RespondError(w, http.StatusConflict, "User is erased")
+		return
+	}
+	if err != nil {
+		log.Error("error recording consent", "error", err, "id", user.ID.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not record consent")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	core.RespondSuccess(w, consent.Record(req.SourceIP))
+}
+
+// ResetMFA disables MFA for a user who lost their authenticator. The user
+// signs in with the password alone until enrolling again.
+func (h *UserHandler) ResetMFA(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	id, ok := h.parseIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.repo.Get(ctx, id)
+	if err != nil {
+		log.Error("error loading user", "error", err, "id", id.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not reset MFA")
+		return
+	}
+
+	if user == nil {
+		core.RespondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := h.mfa.Reset(ctx, user); err != nil {
+		log.Error("error resetting mfa", "error", err, "id", id.String())
+		core.RespondError(w, http.StatusInternalServerError, "Could not reset MFA")
+		return
+	}
+
+	log.Info("mfa reset", "id", id.String())
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // Helper methods following same patterns as ListHandler
 
+// loadUser reads the user named by the id URL parameter, responding with
+// failure as the message of unexpected errors.
+func (h *UserHandler) loadUser(w http.ResponseWriter, r *http.Request, failure string) (*User, bool) {
+	id, ok := h.parseIDParam(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := h.repo.Get(r.Context(), id)
+	if err != nil {
+		h.logForRequest(r).Error("error loading user", "error", err, "id", id.String())
+		core.RespondError(w, http.StatusInternalServerError, failure)
+		return nil, false
+	}
+
+	if user == nil {
+		core.RespondError(w, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+
+	return user, true
+}
+
 func (h *UserHandler) logForRequest(r *http.Request) core.Logger {
 	return h.xparams.Log.With(
 		"request_id", middleware.GetReqID(r.Context()),
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -101,11 +102,61 @@ func (m *mockUserRepo) ListByStatus(ctx context.Context, status string) ([]*User
 	return users, nil
 }
 
+func (m *mockUserRepo) SavePII(ctx context.Context, user *User, previousKeyID string) (bool, error) {
+	if m.saveError != nil {
+		return false, m.saveError
+	}
+	stored, ok := m.users[user.ID]
+	if !ok || stored.PIIKeyID != previousKeyID {
+		return false, nil
+	}
+	stored.EmailCT, stored.EmailIV, stored.EmailTag = user.EmailCT, user.EmailIV, user.EmailTag
+	stored.EmailLookup, stored.PIIKeyID, stored.EmailDataKey = user.EmailLookup, user.PIIKeyID, user.EmailDataKey
+	return true, nil
+}
+
+func (m *mockUserRepo) SaveMFASecret(ctx context.Context, user *User, previous []byte) (bool, error) {
+	if m.saveError != nil {
+		return false, m.saveError
+	}
+	stored, ok := m.users[user.ID]
+	if !ok || !bytes.Equal(stored.MFASecretCT, previous) {
+		return false, nil
+	}
+	stored.MFASecretCT, stored.MFADataKey = user.MFASecretCT, user.MFADataKey
+	return true, nil
+}
+
+func (m *mockUserRepo) ListForRekey(ctx context.Context, keyID string, after uuid.UUID, limit int) ([]*User, error) {
+	if m.listError != nil {
+		return nil, m.listError
+	}
+	var users []*User
+	for _, user := range m.users {
+		legacyMFA := user.MFASecretCT != nil && !user.MFADataKey
+		if (user.PIIKeyID != keyID || !user.EmailDataKey || legacyMFA) && user.ErasedAt == nil && user.ID.String() > after.String() {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID.String() < users[j].ID.String() })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
 func setupUserHandler() (*UserHandler, *mockUserRepo) {
 	repo := newMockUserRepo()
 	log := core.NewNoopLogger()
-	xparams := config.XParams{Log: log}
-	handler := NewUserHandler(repo, xparams)
+	xparams := config.XParams{Log: log, Cfg: &config.Config{}}
+
+	pii, err := NewPIIKeyring(newMockDataKeyRepo(), xparams)
+	if err != nil {
+		panic(err)
+	}
+	privacy := NewPrivacyManager(repo, newMockSessionRepo(), newMockMFARepo(), newMockConsentRepo(), newMockFederatedIdentityRepo(), pii, nil, xparams)
+
+	handler := NewUserHandler(repo, nil, privacy, newTestAdminGuard(xparams, nil), xparams)
 	return handler, repo
 }
 
@@ -460,8 +511,6 @@ func TestUserHandlerDeleteUser(t *testing.T) {
 	handler, repo := setupUserHandler()
 
 	existingID := uuid.New()
-	existingUser := &User{ID: existingID, Status: authpkg.UserStatusActive}
-	repo.users[existingID] = existingUser
 
 	tests := []struct {
 		name           string
@@ -474,6 +523,11 @@ func TestUserHandlerDeleteUser(t *testing.T) {
 			userID:         existingID.String(),
 			expectedStatus: http.StatusNoContent,
 		},
+		{
+			name:           "user not found",
+			userID:         uuid.New().String(),
+			expectedStatus: http.StatusNotFound,
+		},
 		{
 			name:           "invalid UUID",
 			userID:         "invalid-uuid",
@@ -501,7 +555,8 @@ func TestUserHandlerDeleteUser(t *testing.T) {
 			repo.deleteError = nil
 			repo.listError = nil
 
-			repo.deleteError = tt.repoError
+			repo.users[existingID] = &User{ID: existingID, EmailCT: []byte("email"), Status: authpkg.UserStatusActive}
+			repo.saveError = tt.repoError
 
 			req := httptest.NewRequest(http.MethodDelete, "/users/"+tt.userID, nil)
 
@@ -517,8 +572,12 @@ func TestUserHandlerDeleteUser(t *testing.T) {
 			}
 
 			if tt.expectedStatus == http.StatusNoContent {
-				if _, exists := repo.users[existingID]; exists {
-					t.Error("DeleteUser() should have removed user from repository")
+				user, exists := repo.users[existingID]
+				if !exists {
+					t.Fatal("DeleteUser() should have kept the user as a tombstone")
+				}
+				if user.Status != authpkg.UserStatusDeleted || user.ErasedAt == nil || user.EmailCT != nil {
+					t.Errorf("DeleteUser() left %+v, want an erased tombstone", user)
 				}
 			}
 		})
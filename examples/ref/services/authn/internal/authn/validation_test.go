@@ -89,6 +89,19 @@ func TestValidateCreateUser(t *testing.T) {
 			expectedCount:  1,
 			expectedFields: []string{"password"},
 		},
+		{
+			name: "encoded password hash without salt",
+			user: User{
+				ID:           validID,
+				EmailLookup:  []byte("test@example.com"),
+				PasswordHash: []byte("$argon2id$v=19$m=65536,t=1,p=4$c2FsdA$aGFzaA"),
+				PasswordSalt: []byte{},
+				Status:       authpkg.UserStatusActive,
+				CreatedAt:    validTime,
+				UpdatedAt:    validTime,
+			},
+			expectedCount: 0,
+		},
 		{
 			name: "invalid status",
 			user: User{
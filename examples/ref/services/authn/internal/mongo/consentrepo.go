@@ -0,0 +1,121 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// ConsentMongoRepo implements the ConsentRepo interface using the database
+// connected by the user repository.
+type ConsentMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewConsentMongoRepo creates a new MongoDB repository for consents.
+// It must be started after users.
+func NewConsentMongoRepo(users *UserMongoRepo) *ConsentMongoRepo {
+	return &ConsentMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the consents collection.
+func (r *ConsentMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("consents")
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "timestamp", Value: 1}}},
+	}
+
+	if _, err := r.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("cannot create indexes: %w", err)
+	}
+
+	return nil
+}
+
+// consentDocument represents the MongoDB document structure.
+type consentDocument struct {
+	ID         string    `bson:"_id"`
+	UserID     string    `bson:"user_id"`
+	Type       string    `bson:"type"`
+	Scope      string    `bson:"scope"`
+	Granted    bool      `bson:"granted"`
+	SourceIPCT []byte    `bson:"source_ip_ct,omitempty"`
+	Timestamp  time.Time `bson:"timestamp"`
+}
+
+// Create appends a Consent.
+func (r *ConsentMongoRepo) Create(ctx context.Context, consent *authn.Consent) error {
+	if consent == nil {
+		return fmt.Errorf("consent cannot be nil")
+	}
+
+	doc := &consentDocument{
+		ID:         consent.ID.String(),
+		UserID:     consent.UserID.String(),
+		Type:       consent.Type,
+		Scope:      consent.Scope,
+		Granted:    consent.Granted,
+		SourceIPCT: consent.SourceIPCT,
+		Timestamp:  consent.Timestamp,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("error create consent: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUser retrieves the consents of a user, oldest first.
+func (r *ConsentMongoRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]*authn.Consent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID.String()}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error query consents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var consents []*authn.Consent
+	for cursor.Next(ctx) {
+		var doc consentDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("error decode consent: %w", err)
+		}
+
+		id, err := uuid.Parse(doc.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid consent ID format: %w", err)
+		}
+
+		consents = append(consents, &authn.Consent{
+			ID:         id,
+			UserID:     userID,
+			Type:       doc.Type,
+			Scope:      doc.Scope,
+			Granted:    doc.Granted,
+			SourceIPCT: doc.SourceIPCT,
+			Timestamp:  doc.Timestamp,
+		})
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating consents: %w", err)
+	}
+
+	return consents, nil
+}
@@ -0,0 +1,161 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// MFAMongoRepo implements the MFARepo interface using the database
+// connected by the user repository.
+type MFAMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewMFAMongoRepo creates a new MongoDB repository for MFA records.
+// It must be started after users.
+func NewMFAMongoRepo(users *UserMongoRepo) *MFAMongoRepo {
+	return &MFAMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the mfa collection.
+func (r *MFAMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("mfa")
+
+	return nil
+}
+
+// mfaDocument represents the MongoDB document structure.
+type mfaDocument struct {
+	UserID           string    `bson:"_id"`
+	PendingSecretCT  []byte    `bson:"pending_secret_ct,omitempty"`
+	PendingDataKey   bool      `bson:"pending_data_key,omitempty"`
+	PendingExpiresAt time.Time `bson:"pending_expires_at,omitempty"`
+	LastStep         int64     `bson:"last_step"`
+	RecoveryHashes   [][]byte  `bson:"recovery_hashes"`
+	UpdatedAt        time.Time `bson:"updated_at"`
+}
+
+// Get retrieves the MFARecord of a user, or nil if there is none.
+func (r *MFAMongoRepo) Get(ctx context.Context, userID uuid.UUID) (*authn.MFARecord, error) {
+	var doc mfaDocument
+	err := r.collection.FindOne(ctx, bson.M{"_id": userID.String()}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get mfa record: %w", err)
+	}
+
+	return &authn.MFARecord{
+		UserID:           userID,
+		PendingSecretCT:  doc.PendingSecretCT,
+		PendingDataKey:   doc.PendingDataKey,
+		PendingExpiresAt: doc.PendingExpiresAt,
+		LastStep:         doc.LastStep,
+		RecoveryHashes:   doc.RecoveryHashes,
+		UpdatedAt:        doc.UpdatedAt,
+	}, nil
+}
+
+// Save creates or replaces the MFARecord of a user, recovery codes included.
+func (r *MFAMongoRepo) Save(ctx context.Context, record *authn.MFARecord) error {
+	if record == nil {
+		return fmt.Errorf("mfa record cannot be nil")
+	}
+
+	hashes := record.RecoveryHashes
+	if hashes == nil {
+		hashes = [][]byte{}
+	}
+
+	doc := &mfaDocument{
+		UserID:           record.UserID.String(),
+		PendingSecretCT:  record.PendingSecretCT,
+		PendingDataKey:   record.PendingDataKey,
+		PendingExpiresAt: record.PendingExpiresAt,
+		LastStep:         record.LastStep,
+		RecoveryHashes:   hashes,
+		UpdatedAt:        record.UpdatedAt,
+	}
+
+	opts := options.Replace().SetUpsert(true)
+	if _, err := r.collection.ReplaceOne(ctx, bson.M{"_id": doc.UserID}, doc, opts); err != nil {
+		return fmt.Errorf("error save mfa record: %w", err)
+	}
+
+	return nil
+}
+
+// SavePendingSecret updates the pending secret of an MFARecord still holding
+// previous.
+func (r *MFAMongoRepo) SavePendingSecret(ctx context.Context, record *authn.MFARecord, previous []byte) (bool, error) {
+	filter := bson.M{"_id": record.UserID.String(), "pending_secret_ct": previous}
+	update := bson.M{
+		"$set": bson.M{
+			"pending_secret_ct": record.PendingSecretCT,
+			"pending_data_key":  record.PendingDataKey,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error update pending mfa secret: %w", err)
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// Delete removes the MFARecord of a user.
+func (r *MFAMongoRepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": userID.String()}); err != nil {
+		return fmt.Errorf("error delete mfa record: %w", err)
+	}
+
+	return nil
+}
+
+// UseStep records step as the last accepted TOTP step if it is newer.
+func (r *MFAMongoRepo) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	filter := bson.M{
+		"_id":       userID.String(),
+		"last_step": bson.M{"$lt": step},
+	}
+	update := bson.M{"$set": bson.M{"last_step": step}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error use mfa step: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode removes a recovery code hash and reports whether it existed.
+func (r *MFAMongoRepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash []byte) (bool, error) {
+	filter := bson.M{
+		"_id":             userID.String(),
+		"recovery_hashes": hash,
+	}
+	update := bson.M{"$pull": bson.M{"recovery_hashes": hash}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error use recovery code: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
@@ -0,0 +1,141 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// OIDCClientMongoRepo implements the OIDCClientRepo interface using the
+// database connected by the user repository.
+type OIDCClientMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewOIDCClientMongoRepo creates a new MongoDB repository for OIDC clients.
+// It must be started after users.
+func NewOIDCClientMongoRepo(users *UserMongoRepo) *OIDCClientMongoRepo {
+	return &OIDCClientMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the oidc_clients collection.
+func (r *OIDCClientMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("oidc_clients")
+
+	return nil
+}
+
+// oidcClientDocument represents the MongoDB document structure.
+type oidcClientDocument struct {
+	ID           string    `bson:"_id"`
+	Name         string    `bson:"name"`
+	RedirectURIs []string  `bson:"redirect_uris"`
+	Public       bool      `bson:"public"`
+	SecretHash   []byte    `bson:"secret_hash,omitempty"`
+	CreatedAt    time.Time `bson:"created_at"`
+}
+
+// Create stores a new OIDCClient in MongoDB.
+func (r *OIDCClientMongoRepo) Create(ctx context.Context, client *authn.OIDCClient) error {
+	if client == nil {
+		return fmt.Errorf("oidc client cannot be nil")
+	}
+
+	doc := &oidcClientDocument{
+		ID:           client.ID.String(),
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Public:       client.Public,
+		SecretHash:   client.SecretHash,
+		CreatedAt:    client.CreatedAt,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("error create oidc client: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves an OIDCClient by ID from MongoDB.
+func (r *OIDCClientMongoRepo) Get(ctx context.Context, id uuid.UUID) (*authn.OIDCClient, error) {
+	var doc oidcClientDocument
+	err := r.collection.FindOne(ctx, bson.M{"_id": id.String()}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get oidc client: %w", err)
+	}
+
+	return fromOIDCClientDocument(&doc)
+}
+
+// List retrieves all OIDC clients by name.
+func (r *OIDCClientMongoRepo) List(ctx context.Context) ([]*authn.OIDCClient, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error query oidc clients: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var clients []*authn.OIDCClient
+	for cursor.Next(ctx) {
+		var doc oidcClientDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("error decode oidc client: %w", err)
+		}
+
+		client, err := fromOIDCClientDocument(&doc)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating oidc clients: %w", err)
+	}
+
+	return clients, nil
+}
+
+// Delete removes an OIDCClient from MongoDB.
+func (r *OIDCClientMongoRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": id.String()}); err != nil {
+		return fmt.Errorf("error delete oidc client: %w", err)
+	}
+
+	return nil
+}
+
+func fromOIDCClientDocument(doc *oidcClientDocument) (*authn.OIDCClient, error) {
+	id, err := uuid.Parse(doc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid oidc client ID format: %w", err)
+	}
+
+	return &authn.OIDCClient{
+		ID:           id,
+		Name:         doc.Name,
+		RedirectURIs: doc.RedirectURIs,
+		Public:       doc.Public,
+		SecretHash:   doc.SecretHash,
+		CreatedAt:    doc.CreatedAt,
+	}, nil
+}
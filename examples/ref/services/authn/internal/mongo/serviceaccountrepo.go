@@ -0,0 +1,170 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// ServiceAccountMongoRepo implements the ServiceAccountRepo interface using
+// the database connected by the user repository.
+type ServiceAccountMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewServiceAccountMongoRepo creates a new MongoDB repository for service accounts.
+// It must be started after users.
+func NewServiceAccountMongoRepo(users *UserMongoRepo) *ServiceAccountMongoRepo {
+	return &ServiceAccountMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the service_accounts collection.
+func (r *ServiceAccountMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("service_accounts")
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}},
+	}
+
+	if _, err := r.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("cannot create indexes: %w", err)
+	}
+
+	return nil
+}
+
+// serviceAccountDocument represents the MongoDB document structure.
+type serviceAccountDocument struct {
+	ID          string    `bson:"_id"`
+	Name        string    `bson:"name"`
+	Description string    `bson:"description"`
+	Status      string    `bson:"status"`
+	CreatedAt   time.Time `bson:"created_at"`
+	CreatedBy   string    `bson:"created_by"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+	UpdatedBy   string    `bson:"updated_by"`
+}
+
+// Create stores a new ServiceAccount in MongoDB.
+func (r *ServiceAccountMongoRepo) Create(ctx context.Context, account *authn.ServiceAccount) error {
+	if account == nil {
+		return fmt.Errorf("service account cannot be nil")
+	}
+
+	doc := &serviceAccountDocument{
+		ID:          account.ID.String(),
+		Name:        account.Name,
+		Description: account.Description,
+		Status:      string(account.Status),
+		CreatedAt:   account.CreatedAt,
+		CreatedBy:   account.CreatedBy,
+		UpdatedAt:   account.UpdatedAt,
+		UpdatedBy:   account.UpdatedBy,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("error create service account: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves a ServiceAccount by ID from MongoDB.
+func (r *ServiceAccountMongoRepo) Get(ctx context.Context, id uuid.UUID) (*authn.ServiceAccount, error) {
+	var doc serviceAccountDocument
+	err := r.collection.FindOne(ctx, bson.M{"_id": id.String()}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get service account: %w", err)
+	}
+
+	return fromServiceAccountDocument(&doc)
+}
+
+// List retrieves all service accounts by name.
+func (r *ServiceAccountMongoRepo) List(ctx context.Context) ([]*authn.ServiceAccount, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error query service accounts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var accounts []*authn.ServiceAccount
+	for cursor.Next(ctx) {
+		var doc serviceAccountDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("error decode service account: %w", err)
+		}
+
+		account, err := fromServiceAccountDocument(&doc)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating service accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// Save updates the name, description and status of a ServiceAccount.
+func (r *ServiceAccountMongoRepo) Save(ctx context.Context, account *authn.ServiceAccount) error {
+	if account == nil {
+		return fmt.Errorf("service account cannot be nil")
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"name":        account.Name,
+			"description": account.Description,
+			"status":      string(account.Status),
+			"updated_at":  account.UpdatedAt,
+			"updated_by":  account.UpdatedBy,
+		},
+	}
+
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": account.ID.String()}, update); err != nil {
+		return fmt.Errorf("error save service account: %w", err)
+	}
+
+	return nil
+}
+
+func fromServiceAccountDocument(doc *serviceAccountDocument) (*authn.ServiceAccount, error) {
+	id, err := uuid.Parse(doc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account ID format: %w", err)
+	}
+
+	return &authn.ServiceAccount{
+		ID:          id,
+		Name:        doc.Name,
+		Description: doc.Description,
+		Status:      authpkg.UserStatus(doc.Status),
+		CreatedAt:   doc.CreatedAt,
+		CreatedBy:   doc.CreatedBy,
+		UpdatedAt:   doc.UpdatedAt,
+		UpdatedBy:   doc.UpdatedBy,
+	}, nil
+}
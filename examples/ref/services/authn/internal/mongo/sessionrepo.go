@@ -0,0 +1,280 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// SessionMongoRepo implements the SessionRepo interface using the
+// database connected by the user repository.
+type SessionMongoRepo struct {
+	users      *UserMongoRepo
+	collection *mongo.Collection
+}
+
+// NewSessionMongoRepo creates a new MongoDB repository for sessions.
+// It must be started after users.
+func NewSessionMongoRepo(users *UserMongoRepo) *SessionMongoRepo {
+	return &SessionMongoRepo{
+		users: users,
+	}
+}
+
+// Start initializes the sessions collection.
+func (r *SessionMongoRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.users.db.Collection("sessions")
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "revoked_at", Value: 1}}},
+	}
+
+	if _, err := r.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("cannot create indexes: %w", err)
+	}
+
+	return nil
+}
+
+// sessionDocument represents the MongoDB document structure.
+type sessionDocument struct {
+	ID                  string     `bson:"_id"`
+	UserID              string     `bson:"user_id"`
+	ClientID            string     `bson:"client_id,omitempty"`
+	RefreshHash         []byte     `bson:"refresh_hash"`
+	PreviousRefreshHash []byte     `bson:"previous_refresh_hash,omitempty"`
+	IP                  string     `bson:"ip"`
+	UserAgent           string     `bson:"user_agent"`
+	CreatedAt           time.Time  `bson:"created_at"`
+	LastSeenAt          time.Time  `bson:"last_seen_at"`
+	ExpiresAt           time.Time  `bson:"expires_at"`
+	RevokedAt           *time.Time `bson:"revoked_at,omitempty"`
+	RevokeReason        string     `bson:"revoke_reason,omitempty"`
+}
+
+// Create stores a new Session in MongoDB.
+func (r *SessionMongoRepo) Create(ctx context.Context, session *authn.Session) error {
+	if session == nil {
+		return fmt.Errorf("session cannot be nil")
+	}
+
+	doc := &sessionDocument{
+		ID:                  session.ID.String(),
+		UserID:              session.UserID.String(),
+		ClientID:            session.ClientID,
+		RefreshHash:         session.RefreshHash,
+		PreviousRefreshHash: session.PreviousRefreshHash,
+		IP:                  session.IP,
+		UserAgent:           session.UserAgent,
+		CreatedAt:           session.CreatedAt,
+		LastSeenAt:          session.LastSeenAt,
+		ExpiresAt:           session.ExpiresAt,
+		RevokedAt:           session.RevokedAt,
+		RevokeReason:        session.RevokeReason,
+	}
+
+	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("error create session: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves a Session by ID from MongoDB.
+func (r *SessionMongoRepo) Get(ctx context.Context, id uuid.UUID) (*authn.Session, error) {
+	var doc sessionDocument
+	err := r.collection.FindOne(ctx, bson.M{"_id": id.String()}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get session: %w", err)
+	}
+
+	return fromSessionDocument(&doc)
+}
+
+// ListByUser retrieves the active sessions of a user, most recently used first.
+func (r *SessionMongoRepo) ListByUser(ctx context.Context, userID uuid.UUID, now time.Time) ([]*authn.Session, error) {
+	filter := bson.M{
+		"user_id":    userID.String(),
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	return r.list(ctx, filter)
+}
+
+// ListAllByUser retrieves every session of a user, most recently used first.
+func (r *SessionMongoRepo) ListAllByUser(ctx context.Context, userID uuid.UUID) ([]*authn.Session, error) {
+	return r.list(ctx, bson.M{"user_id": userID.String()})
+}
+
+func (r *SessionMongoRepo) list(ctx context.Context, filter bson.M) ([]*authn.Session, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error query sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []*authn.Session
+	for cursor.Next(ctx) {
+		var doc sessionDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("error decode session: %w", err)
+		}
+
+		session, err := fromSessionDocument(&doc)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// RotateRefresh replaces the refresh hash if it still matches previous.
+func (r *SessionMongoRepo) RotateRefresh(ctx context.Context, id uuid.UUID, previous, next []byte, lastSeen time.Time) (bool, error) {
+	filter := bson.M{
+		"_id":          id.String(),
+		"refresh_hash": previous,
+		"revoked_at":   bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"refresh_hash":          next,
+			"previous_refresh_hash": previous,
+			"last_seen_at":          lastSeen,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error rotate refresh token: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// Revoke marks a Session revoked, keeping the first revocation.
+func (r *SessionMongoRepo) Revoke(ctx context.Context, id uuid.UUID, reason string, at time.Time) error {
+	filter := bson.M{
+		"_id":        id.String(),
+		"revoked_at": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked_at":    at,
+			"revoke_reason": reason,
+		},
+	}
+
+	if _, err := r.collection.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("error revoke session: %w", err)
+	}
+
+	return nil
+}
+
+// EraseByUser revokes the unrevoked sessions of a user and clears the IP and
+// user agent of all of them.
+func (r *SessionMongoRepo) EraseByUser(ctx context.Context, userID uuid.UUID, reason string, at time.Time) error {
+	unrevoked := bson.M{
+		"user_id":    userID.String(),
+		"revoked_at": bson.M{"$exists": false},
+	}
+	revoke := bson.M{
+		"$set": bson.M{
+			"revoked_at":    at,
+			"revoke_reason": reason,
+		},
+	}
+	if _, err := r.collection.UpdateMany(ctx, unrevoked, revoke); err != nil {
+		return fmt.Errorf("error revoke sessions: %w", err)
+	}
+
+	scrub := bson.M{"$set": bson.M{"ip": "", "user_agent": ""}}
+	if _, err := r.collection.UpdateMany(ctx, bson.M{"user_id": userID.String()}, scrub); err != nil {
+		return fmt.Errorf("error erase sessions: %w", err)
+	}
+
+	return nil
+}
+
+// ListRevokedSince retrieves the IDs of sessions revoked at or after since.
+func (r *SessionMongoRepo) ListRevokedSince(ctx context.Context, since time.Time) ([]uuid.UUID, error) {
+	filter := bson.M{"revoked_at": bson.M{"$gte": since}}
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error query revoked sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var ids []uuid.UUID
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("error decode revoked session: %w", err)
+		}
+
+		id, err := uuid.Parse(doc.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid session ID format: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating revoked sessions: %w", err)
+	}
+
+	return ids, nil
+}
+
+func fromSessionDocument(doc *sessionDocument) (*authn.Session, error) {
+	id, err := uuid.Parse(doc.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session ID format: %w", err)
+	}
+
+	userID, err := uuid.Parse(doc.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	return &authn.Session{
+		ID:                  id,
+		UserID:              userID,
+		ClientID:            doc.ClientID,
+		RefreshHash:         doc.RefreshHash,
+		PreviousRefreshHash: doc.PreviousRefreshHash,
+		IP:                  doc.IP,
+		UserAgent:           doc.UserAgent,
+		CreatedAt:           doc.CreatedAt,
+		LastSeenAt:          doc.LastSeenAt,
+		ExpiresAt:           doc.ExpiresAt,
+		RevokedAt:           doc.RevokedAt,
+		RevokeReason:        doc.RevokeReason,
+	}, nil
+}
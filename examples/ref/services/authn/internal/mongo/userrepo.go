@@ -79,6 +79,14 @@ func (r *UserMongoRepo) Stop(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheck pings the MongoDB client.
+func (r *UserMongoRepo) HealthCheck(ctx context.Context) error {
+	if r.client == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	return r.client.Ping(ctx, nil)
+}
+
 // createIndexes creates necessary indexes for the users collection.
 func (r *UserMongoRepo) createIndexes(ctx context.Context) error {
 	// Index on email_lookup (unique)
@@ -92,6 +100,11 @@ func (r *UserMongoRepo) createIndexes(ctx context.Context) error {
 		Keys: bson.D{{Key: "status", Value: 1}},
 	}
 
+	// Index on pii_key_id, for the re-encryption job
+	piiKeyIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "pii_key_id", Value: 1}, {Key: "_id", Value: 1}},
+	}
+
 	// Index on created_at
 	createdAtIndex := mongo.IndexModel{
 		Keys: bson.D{{Key: "created_at", Value: -1}},
@@ -100,6 +113,7 @@ func (r *UserMongoRepo) createIndexes(ctx context.Context) error {
 	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
 		emailLookupIndex,
 		statusIndex,
+		piiKeyIndex,
 		createdAtIndex,
 	})
 
@@ -108,37 +122,47 @@ func (r *UserMongoRepo) createIndexes(ctx context.Context) error {
 
 // userDocument represents the MongoDB document structure.
 type userDocument struct {
-	ID           string    `bson:"_id"`
-	EmailCT      []byte    `bson:"email_ct"`
-	EmailIV      []byte    `bson:"email_iv"`
-	EmailTag     []byte    `bson:"email_tag"`
-	EmailLookup  []byte    `bson:"email_lookup"`
-	PasswordHash []byte    `bson:"password_hash"`
-	PasswordSalt []byte    `bson:"password_salt"`
-	MFASecretCT  []byte    `bson:"mfa_secret_ct,omitempty"`
-	Status       string    `bson:"status"`
-	CreatedAt    time.Time `bson:"created_at"`
-	CreatedBy    string    `bson:"created_by"`
-	UpdatedAt    time.Time `bson:"updated_at"`
-	UpdatedBy    string    `bson:"updated_by"`
+	ID              string     `bson:"_id"`
+	EmailCT         []byte     `bson:"email_ct"`
+	EmailIV         []byte     `bson:"email_iv"`
+	EmailTag        []byte     `bson:"email_tag"`
+	EmailLookup     []byte     `bson:"email_lookup"`
+	PIIKeyID        string     `bson:"pii_key_id"`
+	EmailDataKey    bool       `bson:"email_data_key,omitempty"`
+	PasswordHash    []byte     `bson:"password_hash"`
+	PasswordSalt    []byte     `bson:"password_salt"`
+	MFASecretCT     []byte     `bson:"mfa_secret_ct,omitempty"`
+	MFADataKey      bool       `bson:"mfa_data_key,omitempty"`
+	EmailVerifiedAt *time.Time `bson:"email_verified_at,omitempty"`
+	ErasedAt        *time.Time `bson:"erased_at,omitempty"`
+	Status          string     `bson:"status"`
+	CreatedAt       time.Time  `bson:"created_at"`
+	CreatedBy       string     `bson:"created_by"`
+	UpdatedAt       time.Time  `bson:"updated_at"`
+	UpdatedBy       string     `bson:"updated_by"`
 }
 
 // toDocument converts a User entity to MongoDB document.
 func (r *UserMongoRepo) toDocument(user *authn.User) *userDocument {
 	return &userDocument{
-		ID:           user.ID.String(),
-		EmailCT:      user.EmailCT,
-		EmailIV:      user.EmailIV,
-		EmailTag:     user.EmailTag,
-		EmailLookup:  user.EmailLookup,
-		PasswordHash: user.PasswordHash,
-		PasswordSalt: user.PasswordSalt,
-		MFASecretCT:  user.MFASecretCT,
-		Status:       string(user.Status),
-		CreatedAt:    user.CreatedAt,
-		CreatedBy:    user.CreatedBy,
-		UpdatedAt:    user.UpdatedAt,
-		UpdatedBy:    user.UpdatedBy,
+		ID:              user.ID.String(),
+		EmailCT:         user.EmailCT,
+		EmailIV:         user.EmailIV,
+		EmailTag:        user.EmailTag,
+		EmailLookup:     user.EmailLookup,
+		PIIKeyID:        user.PIIKeyID,
+		EmailDataKey:    user.EmailDataKey,
+		PasswordHash:    user.PasswordHash,
+		PasswordSalt:    user.PasswordSalt,
+		MFASecretCT:     user.MFASecretCT,
+		MFADataKey:      user.MFADataKey,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		ErasedAt:        user.ErasedAt,
+		Status:          string(user.Status),
+		CreatedAt:       user.CreatedAt,
+		CreatedBy:       user.CreatedBy,
+		UpdatedAt:       user.UpdatedAt,
+		UpdatedBy:       user.UpdatedBy,
 	}
 }
 
@@ -150,19 +174,24 @@ func (r *UserMongoRepo) fromDocument(doc *userDocument) (*authn.User, error) {
 	}
 
 	return &authn.User{
-		ID:           id,
-		EmailCT:      doc.EmailCT,
-		EmailIV:      doc.EmailIV,
-		EmailTag:     doc.EmailTag,
-		EmailLookup:  doc.EmailLookup,
-		PasswordHash: doc.PasswordHash,
-		PasswordSalt: doc.PasswordSalt,
-		MFASecretCT:  doc.MFASecretCT,
-		Status:       authpkg.UserStatus(doc.Status),
-		CreatedAt:    doc.CreatedAt,
-		CreatedBy:    doc.CreatedBy,
-		UpdatedAt:    doc.UpdatedAt,
-		UpdatedBy:    doc.UpdatedBy,
+		ID:              id,
+		EmailCT:         doc.EmailCT,
+		EmailIV:         doc.EmailIV,
+		EmailTag:        doc.EmailTag,
+		EmailLookup:     doc.EmailLookup,
+		PIIKeyID:        doc.PIIKeyID,
+		EmailDataKey:    doc.EmailDataKey,
+		PasswordHash:    doc.PasswordHash,
+		PasswordSalt:    doc.PasswordSalt,
+		MFASecretCT:     doc.MFASecretCT,
+		MFADataKey:      doc.MFADataKey,
+		EmailVerifiedAt: doc.EmailVerifiedAt,
+		ErasedAt:        doc.ErasedAt,
+		Status:          authpkg.UserStatus(doc.Status),
+		CreatedAt:       doc.CreatedAt,
+		CreatedBy:       doc.CreatedBy,
+		UpdatedAt:       doc.UpdatedAt,
+		UpdatedBy:       doc.UpdatedBy,
 	}, nil
 }
 
@@ -228,16 +257,21 @@ func (r *UserMongoRepo) Save(ctx context.Context, user *authn.User) error {
 	filter := bson.M{"_id": user.ID.String()}
 	update := bson.M{
 		"$set": bson.M{
-			"email_ct":      user.EmailCT,
-			"email_iv":      user.EmailIV,
-			"email_tag":     user.EmailTag,
-			"email_lookup":  user.EmailLookup,
-			"password_hash": user.PasswordHash,
-			"password_salt": user.PasswordSalt,
-			"mfa_secret_ct": user.MFASecretCT,
-			"status":        string(user.Status),
-			"updated_at":    user.UpdatedAt,
-			"updated_by":    user.UpdatedBy,
+			"email_ct":          user.EmailCT,
+			"email_iv":          user.EmailIV,
+			"email_tag":         user.EmailTag,
+			"email_lookup":      user.EmailLookup,
+			"pii_key_id":        user.PIIKeyID,
+			"email_data_key":    user.EmailDataKey,
+			"password_hash":     user.PasswordHash,
+			"password_salt":     user.PasswordSalt,
+			"mfa_secret_ct":     user.MFASecretCT,
+			"mfa_data_key":      user.MFADataKey,
+			"email_verified_at": user.EmailVerifiedAt,
+			"erased_at":         user.ErasedAt,
+			"status":            string(user.Status),
+			"updated_at":        user.UpdatedAt,
+			"updated_by":        user.UpdatedBy,
 		},
 	}
 
@@ -342,3 +376,91 @@ func (r *UserMongoRepo) ListByStatus(ctx context.Context, status string) ([]*aut
 
 	return users, nil
 }
+
+// SavePII updates the encrypted email, lookup hash and PII key ID of a User
+// still under previousKeyID.
+func (r *UserMongoRepo) SavePII(ctx context.Context, user *authn.User, previousKeyID string) (bool, error) {
+	filter := bson.M{"_id": user.ID.String(), "pii_key_id": previousKeyID}
+	if previousKeyID == "" {
+		// Users stored before key versions may lack the field
+		filter["pii_key_id"] = bson.M{"$in": bson.A{"", nil}}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"email_ct":       user.EmailCT,
+			"email_iv":       user.EmailIV,
+			"email_tag":      user.EmailTag,
+			"email_lookup":   user.EmailLookup,
+			"pii_key_id":     user.PIIKeyID,
+			"email_data_key": user.EmailDataKey,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error update user pii: %w", err)
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// SaveMFASecret updates the MFA secret of a User still holding previous.
+func (r *UserMongoRepo) SaveMFASecret(ctx context.Context, user *authn.User, previous []byte) (bool, error) {
+	filter := bson.M{"_id": user.ID.String(), "mfa_secret_ct": previous}
+	update := bson.M{
+		"$set": bson.M{
+			"mfa_secret_ct": user.MFASecretCT,
+			"mfa_data_key":  user.MFADataKey,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error update user mfa secret: %w", err)
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// ListForRekey retrieves up to limit Users whose PII is not under keyID or
+// whose email or MFA secret is not sealed with their data key, ordered by ID
+// after the given one. Erased users are left out.
+func (r *UserMongoRepo) ListForRekey(ctx context.Context, keyID string, after uuid.UUID, limit int) ([]*authn.User, error) {
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"pii_key_id": bson.M{"$ne": keyID}},
+			bson.M{"email_data_key": bson.M{"$ne": true}},
+			bson.M{"mfa_secret_ct": bson.M{"$ne": nil}, "mfa_data_key": bson.M{"$ne": true}},
+		},
+		"erased_at": nil,
+		"_id":       bson.M{"$gt": after.String()},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error query users for rekey: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var users []*authn.User
+
+	for cursor.Next(ctx) {
+		var doc userDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("error decode user document: %w", err)
+		}
+
+		user, err := r.fromDocument(&doc)
+		if err != nil {
+			return nil, fmt.Errorf("error convert document to user: %w", err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// ConsentSQLiteRepo implements the ConsentRepo interface using the database
+// opened by the user repository.
+type ConsentSQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewConsentSQLiteRepo creates a new SQLite repository for consents.
+// It must be started after users.
+func NewConsentSQLiteRepo(users *UserSQLiteRepo) *ConsentSQLiteRepo {
+	return &ConsentSQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the consents table.
+func (r *ConsentSQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS consents (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		type TEXT NOT NULL,
+		scope TEXT NOT NULL DEFAULT '',
+		granted INTEGER NOT NULL,
+		source_ip_ct BLOB,
+		timestamp DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_consents_user_id ON consents(user_id, timestamp);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create consents table: %w", err)
+	}
+
+	return nil
+}
+
+// Create appends a Consent.
+func (r *ConsentSQLiteRepo) Create(ctx context.Context, consent *authn.Consent) error {
+	if consent == nil {
+		return fmt.Errorf("consent cannot be nil")
+	}
+
+	query := `
+	INSERT INTO consents (id, user_id, type, scope, granted, source_ip_ct, timestamp)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		consent.ID.String(),
+		consent.UserID.String(),
+		consent.Type,
+		consent.Scope,
+		consent.Granted,
+		consent.SourceIPCT,
+		consent.Timestamp,
+	)
+	if err != nil {
+		return fmt.Errorf("error create consent: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUser retrieves the consents of a user, oldest first.
+func (r *ConsentSQLiteRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]*authn.Consent, error) {
+	query := `SELECT id, user_id, type, scope, granted, source_ip_ct, timestamp
+	FROM consents WHERE user_id = ? ORDER BY timestamp`
+
+	rows, err := r.db.QueryContext(ctx, query, userID.String())
+	if err != nil {
+		return nil, fmt.Errorf("error query consents: %w", err)
+	}
+	defer rows.Close()
+
+	var consents []*authn.Consent
+	for rows.Next() {
+		consent := &authn.Consent{}
+		err := rows.Scan(
+			&consent.ID,
+			&consent.UserID,
+			&consent.Type,
+			&consent.Scope,
+			&consent.Granted,
+			&consent.SourceIPCT,
+			&consent.Timestamp,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scan consent: %w", err)
+		}
+		consents = append(consents, consent)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating consents: %w", err)
+	}
+
+	return consents, nil
+}
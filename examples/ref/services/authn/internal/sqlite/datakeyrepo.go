@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// DataKeySQLiteRepo implements the DataKeyRepo interface using the database
+// opened by the user repository.
+type DataKeySQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewDataKeySQLiteRepo creates a new SQLite repository for user data keys.
+// It must be started after users.
+func NewDataKeySQLiteRepo(users *UserSQLiteRepo) *DataKeySQLiteRepo {
+	return &DataKeySQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the data_keys table.
+func (r *DataKeySQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS data_keys (
+		user_id TEXT PRIMARY KEY,
+		key_ct BLOB NOT NULL,
+		pii_key_id TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create data_keys table: %w", err)
+	}
+
+	return nil
+}
+
+// Create stores the first DataKey of a user.
+func (r *DataKeySQLiteRepo) Create(ctx context.Context, key *authn.DataKey) error {
+	if key == nil {
+		return fmt.Errorf("data key cannot be nil")
+	}
+
+	query := `
+	INSERT INTO data_keys (user_id, key_ct, pii_key_id, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		key.UserID.String(),
+		key.KeyCT,
+		key.PIIKeyID,
+		key.CreatedAt,
+		key.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error create data key: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves the DataKey of a user, or nil if there is none.
+func (r *DataKeySQLiteRepo) Get(ctx context.Context, userID uuid.UUID) (*authn.DataKey, error) {
+	query := `SELECT user_id, key_ct, pii_key_id, created_at, updated_at
+	FROM data_keys WHERE user_id = ?`
+
+	key := &authn.DataKey{}
+	err := r.db.QueryRowContext(ctx, query, userID.String()).Scan(
+		&key.UserID,
+		&key.KeyCT,
+		&key.PIIKeyID,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get data key: %w", err)
+	}
+
+	return key, nil
+}
+
+// Save replaces the wrapped key and its PII key ID.
+func (r *DataKeySQLiteRepo) Save(ctx context.Context, key *authn.DataKey) error {
+	if key == nil {
+		return fmt.Errorf("data key cannot be nil")
+	}
+
+	query := `UPDATE data_keys SET key_ct = ?, pii_key_id = ?, updated_at = ? WHERE user_id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, key.KeyCT, key.PIIKeyID, key.UpdatedAt, key.UserID.String()); err != nil {
+		return fmt.Errorf("error save data key: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the DataKey of a user.
+func (r *DataKeySQLiteRepo) Delete(ctx context.Context, userID uuid.UUID) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM data_keys WHERE user_id = ?`, userID.String()); err != nil {
+		return fmt.Errorf("error delete data key: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// EmailTokenSQLiteRepo implements the EmailTokenRepo interface using the
+// database opened by the user repository.
+type EmailTokenSQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewEmailTokenSQLiteRepo creates a new SQLite repository for email tokens.
+// It must be started after users.
+func NewEmailTokenSQLiteRepo(users *UserSQLiteRepo) *EmailTokenSQLiteRepo {
+	return &EmailTokenSQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the email_tokens table.
+func (r *EmailTokenSQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS email_tokens (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		purpose TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_email_tokens_user ON email_tokens(user_id, purpose);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create email_tokens table: %w", err)
+	}
+
+	return nil
+}
+
+// Create stores a new EmailToken.
+func (r *EmailTokenSQLiteRepo) Create(ctx context.Context, token *authn.EmailToken) error {
+	if token == nil {
+		return fmt.Errorf("email token cannot be nil")
+	}
+
+	query := `INSERT INTO email_tokens (id, user_id, purpose, created_at, expires_at, used_at)
+	VALUES (?, ?, ?, ?, ?, ?)`
+
+	var usedAt sql.NullTime
+	if token.UsedAt != nil {
+		usedAt = nullTime(*token.UsedAt)
+	}
+
+	_, err := r.db.ExecContext(ctx, query,
+		token.ID.String(),
+		token.UserID.String(),
+		token.Purpose,
+		token.CreatedAt,
+		token.ExpiresAt,
+		usedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error create email token: %w", err)
+	}
+
+	return nil
+}
+
+// Use marks an unused, unexpired token as used.
+func (r *EmailTokenSQLiteRepo) Use(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	query := `
+	UPDATE email_tokens SET used_at = ?
+	WHERE id = ? AND used_at IS NULL AND expires_at > ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query, at, id.String(), at)
+	if err != nil {
+		return false, fmt.Errorf("error use email token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error get rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseAll marks every unused token of a user for purpose as used.
+func (r *EmailTokenSQLiteRepo) UseAll(ctx context.Context, userID uuid.UUID, purpose string, at time.Time) error {
+	query := `
+	UPDATE email_tokens SET used_at = ?
+	WHERE user_id = ? AND purpose = ? AND used_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, at, userID.String(), purpose); err != nil {
+		return fmt.Errorf("error use email tokens: %w", err)
+	}
+
+	return nil
+}
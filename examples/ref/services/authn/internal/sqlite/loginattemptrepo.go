@@ -0,0 +1,131 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// LoginAttemptSQLiteRepo implements the LoginAttemptRepo interface using the
+// database opened by the user repository.
+type LoginAttemptSQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewLoginAttemptSQLiteRepo creates a new SQLite repository for login attempts.
+// It must be started after users.
+func NewLoginAttemptSQLiteRepo(users *UserSQLiteRepo) *LoginAttemptSQLiteRepo {
+	return &LoginAttemptSQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the login_attempts table.
+func (r *LoginAttemptSQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		key TEXT PRIMARY KEY,
+		failures INTEGER NOT NULL DEFAULT 0,
+		lockouts INTEGER NOT NULL DEFAULT 0,
+		last_failure_at DATETIME NOT NULL,
+		locked_until DATETIME
+	);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create login_attempts table: %w", err)
+	}
+
+	return nil
+}
+
+const loginAttemptColumns = `key, failures, lockouts, last_failure_at, locked_until`
+
+// Get retrieves the LoginAttempt of a key, or nil if there is none.
+func (r *LoginAttemptSQLiteRepo) Get(ctx context.Context, key string) (*authn.LoginAttempt, error) {
+	query := `SELECT ` + loginAttemptColumns + ` FROM login_attempts WHERE key = ?`
+
+	attempt, err := scanLoginAttempt(r.db.QueryRowContext(ctx, query, key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get login attempt: %w", err)
+	}
+
+	return attempt, nil
+}
+
+// RecordFailure adds a failure to key in a single statement.
+func (r *LoginAttemptSQLiteRepo) RecordFailure(ctx context.Context, key string, at, since time.Time) (*authn.LoginAttempt, error) {
+	query := `
+	INSERT INTO login_attempts (key, failures, lockouts, last_failure_at) VALUES (?, 1, 0, ?)
+	ON CONFLICT(key) DO UPDATE SET
+		failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,
+		last_failure_at = excluded.last_failure_at
+	RETURNING ` + loginAttemptColumns
+
+	attempt, err := scanLoginAttempt(r.db.QueryRowContext(ctx, query, key, at, since))
+	if err != nil {
+		return nil, fmt.Errorf("error record login failure: %w", err)
+	}
+
+	return attempt, nil
+}
+
+// Lock locks key if it still has at least limit failures.
+func (r *LoginAttemptSQLiteRepo) Lock(ctx context.Context, key string, limit int, until time.Time) (int, bool, error) {
+	query := `
+	UPDATE login_attempts SET failures = 0, lockouts = lockouts + 1, locked_until = ?
+	WHERE key = ? AND failures >= ?
+	RETURNING lockouts
+	`
+
+	var lockouts int
+	err := r.db.QueryRowContext(ctx, query, until, key, limit).Scan(&lockouts)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("error lock login: %w", err)
+	}
+
+	return lockouts, true, nil
+}
+
+// Reset forgets the failures and lockouts of key.
+func (r *LoginAttemptSQLiteRepo) Reset(ctx context.Context, key string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = ?`, key); err != nil {
+		return fmt.Errorf("error reset login attempts: %w", err)
+	}
+
+	return nil
+}
+
+func scanLoginAttempt(row rowScanner) (*authn.LoginAttempt, error) {
+	attempt := &authn.LoginAttempt{}
+	var lockedUntil sql.NullTime
+
+	err := row.Scan(
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.Lockouts,
+		&attempt.LastFailureAt,
+		&lockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	attempt.LockedUntil = lockedUntil.Time
+
+	return attempt, nil
+}
@@ -0,0 +1,270 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// SessionSQLiteRepo implements the SessionRepo interface using the
+// database opened by the user repository.
+type SessionSQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewSessionSQLiteRepo creates a new SQLite repository for sessions.
+// It must be started after users.
+func NewSessionSQLiteRepo(users *UserSQLiteRepo) *SessionSQLiteRepo {
+	return &SessionSQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the sessions table.
+func (r *SessionSQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		client_id TEXT,
+		refresh_hash BLOB NOT NULL,
+		previous_refresh_hash BLOB,
+		ip TEXT,
+		user_agent TEXT,
+		created_at DATETIME NOT NULL,
+		last_seen_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		revoke_reason TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+	CREATE INDEX IF NOT EXISTS idx_sessions_revoked_at ON sessions(revoked_at);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create sessions table: %w", err)
+	}
+
+	return nil
+}
+
+const sessionColumns = `id, user_id, client_id, refresh_hash, previous_refresh_hash, ip, user_agent,
+	created_at, last_seen_at, expires_at, revoked_at, revoke_reason`
+
+// Create stores a new Session.
+func (r *SessionSQLiteRepo) Create(ctx context.Context, session *authn.Session) error {
+	if session == nil {
+		return fmt.Errorf("session cannot be nil")
+	}
+
+	query := `INSERT INTO sessions (` + sessionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	var revokedAt sql.NullTime
+	if session.RevokedAt != nil {
+		revokedAt = nullTime(*session.RevokedAt)
+	}
+
+	_, err := r.db.ExecContext(ctx, query,
+		session.ID.String(),
+		session.UserID.String(),
+		session.ClientID,
+		session.RefreshHash,
+		session.PreviousRefreshHash,
+		session.IP,
+		session.UserAgent,
+		session.CreatedAt,
+		session.LastSeenAt,
+		session.ExpiresAt,
+		revokedAt,
+		session.RevokeReason,
+	)
+	if err != nil {
+		return fmt.Errorf("error create session: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves a Session by ID.
+func (r *SessionSQLiteRepo) Get(ctx context.Context, id uuid.UUID) (*authn.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = ?`
+
+	session, err := scanSession(r.db.QueryRowContext(ctx, query, id.String()))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get session: %w", err)
+	}
+
+	return session, nil
+}
+
+// ListByUser retrieves the active sessions of a user, most recently used first.
+func (r *SessionSQLiteRepo) ListByUser(ctx context.Context, userID uuid.UUID, now time.Time) ([]*authn.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+	WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+	ORDER BY last_seen_at DESC`
+
+	return r.list(ctx, query, userID.String(), now)
+}
+
+// ListAllByUser retrieves every session of a user, most recently used first.
+func (r *SessionSQLiteRepo) ListAllByUser(ctx context.Context, userID uuid.UUID) ([]*authn.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+	WHERE user_id = ?
+	ORDER BY last_seen_at DESC`
+
+	return r.list(ctx, query, userID.String())
+}
+
+func (r *SessionSQLiteRepo) list(ctx context.Context, query string, args ...any) ([]*authn.Session, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*authn.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// RotateRefresh replaces the refresh hash if it still matches previous.
+func (r *SessionSQLiteRepo) RotateRefresh(ctx context.Context, id uuid.UUID, previous, next []byte, lastSeen time.Time) (bool, error) {
+	query := `
+	UPDATE sessions SET refresh_hash = ?, previous_refresh_hash = refresh_hash, last_seen_at = ?
+	WHERE id = ? AND refresh_hash = ? AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, next, lastSeen, id.String(), previous)
+	if err != nil {
+		return false, fmt.Errorf("error rotate refresh token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error get rows affected: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// Revoke marks a Session revoked, keeping the first revocation.
+func (r *SessionSQLiteRepo) Revoke(ctx context.Context, id uuid.UUID, reason string, at time.Time) error {
+	query := `
+	UPDATE sessions SET revoked_at = ?, revoke_reason = ?
+	WHERE id = ? AND revoked_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, at, reason, id.String()); err != nil {
+		return fmt.Errorf("error revoke session: %w", err)
+	}
+
+	return nil
+}
+
+// EraseByUser revokes the unrevoked sessions of a user and clears the IP and
+// user agent of all of them.
+func (r *SessionSQLiteRepo) EraseByUser(ctx context.Context, userID uuid.UUID, reason string, at time.Time) error {
+	query := `
+	UPDATE sessions SET
+		ip = '', user_agent = '',
+		revoke_reason = CASE WHEN revoked_at IS NULL THEN ? ELSE revoke_reason END,
+		revoked_at = COALESCE(revoked_at, ?)
+	WHERE user_id = ?
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, reason, at, userID.String()); err != nil {
+		return fmt.Errorf("error erase sessions: %w", err)
+	}
+
+	return nil
+}
+
+// ListRevokedSince retrieves the IDs of sessions revoked at or after since.
+func (r *SessionSQLiteRepo) ListRevokedSince(ctx context.Context, since time.Time) ([]uuid.UUID, error) {
+	query := `SELECT id FROM sessions WHERE revoked_at >= ? ORDER BY revoked_at`
+
+	rows, err := r.db.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("error query revoked sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scan revoked session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating revoked sessions: %w", err)
+	}
+
+	return ids, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner) (*authn.Session, error) {
+	session := &authn.Session{}
+	var clientID, ip, userAgent, reason sql.NullString
+	var revokedAt sql.NullTime
+
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&clientID,
+		&session.RefreshHash,
+		&session.PreviousRefreshHash,
+		&ip,
+		&userAgent,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+		&revokedAt,
+		&reason,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	session.ClientID = clientID.String
+	session.IP = ip.String
+	session.UserAgent = userAgent.String
+	session.RevokeReason = reason.String
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+
+	return session, nil
+}
@@ -0,0 +1,174 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/adrianpk/hatmax-ref/services/authn/internal/authn"
+)
+
+// SigningKeySQLiteRepo implements the SigningKeyRepo interface using the
+// database opened by the user repository.
+type SigningKeySQLiteRepo struct {
+	users *UserSQLiteRepo
+	db    *sql.DB
+}
+
+// NewSigningKeySQLiteRepo creates a new SQLite repository for signing keys.
+// It must be started after users.
+func NewSigningKeySQLiteRepo(users *UserSQLiteRepo) *SigningKeySQLiteRepo {
+	return &SigningKeySQLiteRepo{
+		users: users,
+	}
+}
+
+// Start creates the signing_keys table.
+func (r *SigningKeySQLiteRepo) Start(ctx context.Context) error {
+	if r.users.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	r.db = r.users.db
+
+	query := `
+	CREATE TABLE IF NOT EXISTS signing_keys (
+		id TEXT PRIMARY KEY,
+		public_key BLOB NOT NULL,
+		private_key_ct BLOB NOT NULL,
+		private_key_iv BLOB NOT NULL,
+		private_key_tag BLOB NOT NULL,
+		status TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		rotated_at DATETIME,
+		retired_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_signing_keys_status ON signing_keys(status);
+	`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error create signing_keys table: %w", err)
+	}
+
+	return nil
+}
+
+// Create stores a new SigningKey.
+func (r *SigningKeySQLiteRepo) Create(ctx context.Context, key *authn.SigningKey) error {
+	if key == nil {
+		return fmt.Errorf("signing key cannot be nil")
+	}
+
+	query := `
+	INSERT INTO signing_keys (
+		id, public_key, private_key_ct, private_key_iv, private_key_tag,
+		status, created_at, rotated_at, retired_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		key.ID,
+		key.PublicKey,
+		key.PrivateKeyCT,
+		key.PrivateKeyIV,
+		key.PrivateKeyTag,
+		string(key.Status),
+		key.CreatedAt,
+		nullTime(key.RotatedAt),
+		nullTime(key.RetiredAt),
+	)
+	if err != nil {
+		return fmt.Errorf("error create signing key: %w", err)
+	}
+
+	return nil
+}
+
+// Save updates the status and timestamps of a SigningKey.
+func (r *SigningKeySQLiteRepo) Save(ctx context.Context, key *authn.SigningKey) error {
+	if key == nil {
+		return fmt.Errorf("signing key cannot be nil")
+	}
+
+	query := `
+	UPDATE signing_keys SET status = ?, rotated_at = ?, retired_at = ?
+	WHERE id = ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		string(key.Status),
+		nullTime(key.RotatedAt),
+		nullTime(key.RetiredAt),
+		key.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("error update signing key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("signing key %s not found for update", key.ID)
+	}
+
+	return nil
+}
+
+// List retrieves all SigningKeys that are not retired.
+func (r *SigningKeySQLiteRepo) List(ctx context.Context) ([]*authn.SigningKey, error) {
+	query := `
+	SELECT id, public_key, private_key_ct, private_key_iv, private_key_tag,
+	       status, created_at, rotated_at, retired_at
+	FROM signing_keys WHERE status != 'retired'
+	ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error query signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*authn.SigningKey
+
+	for rows.Next() {
+		key := &authn.SigningKey{}
+		var status string
+		var rotatedAt, retiredAt sql.NullTime
+
+		err := rows.Scan(
+			&key.ID,
+			&key.PublicKey,
+			&key.PrivateKeyCT,
+			&key.PrivateKeyIV,
+			&key.PrivateKeyTag,
+			&status,
+			&key.CreatedAt,
+			&rotatedAt,
+			&retiredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scan signing key: %w", err)
+		}
+
+		key.Status = authn.KeyStatus(status)
+		key.RotatedAt = rotatedAt.Time
+		key.RetiredAt = retiredAt.Time
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating signing keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// nullTime stores zero times as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"embed"
 	"log"
 	"os"
 	"os/signal"
@@ -20,6 +21,9 @@ const (
 	version = "0.1.0"
 )
 
+//go:embed assets
+var assetsFS embed.FS
+
 func main() {
 	cfg, err := config.LoadConfig("config.yaml", "AUTHN_", os.Args)
 	if err != nil {
@@ -36,18 +40,147 @@ func main() {
 		Cfg: cfg,
 	}
 
+	middlewares, err := core.NewMiddlewareStack(core.DefaultMiddlewareOptions())
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+
 	router := chi.NewRouter()
+	router.Use(middlewares.Handler)
 
 	var deps []any
 	UserRepo := mongo.NewUserMongoRepo(xparams)
 	deps = append(deps, UserRepo)
 
-	UserHandler := authn.NewUserHandler(UserRepo, xparams)
+	SigningKeyRepo := mongo.NewSigningKeyMongoRepo(UserRepo)
+	deps = append(deps, SigningKeyRepo)
+
+	Keyring, err := authn.NewKeyring(SigningKeyRepo, xparams)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+	deps = append(deps, Keyring)
+
+	DataKeyRepo := mongo.NewDataKeyMongoRepo(UserRepo)
+	deps = append(deps, DataKeyRepo)
+
+	PIIKeys, err := authn.NewPIIKeyring(DataKeyRepo, xparams)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+
+	SessionRepo := mongo.NewSessionMongoRepo(UserRepo)
+	deps = append(deps, SessionRepo)
+
+	Sessions, err := authn.NewSessionManager(SessionRepo, Keyring, authn.NewAuthzPolicyVersion(xparams), xparams)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+
+	MFARepo := mongo.NewMFAMongoRepo(UserRepo)
+	deps = append(deps, MFARepo)
+
+	MFA := authn.NewMFAManager(UserRepo, MFARepo, Keyring, PIIKeys, xparams)
+
+	Rekeyer, err := authn.NewPIIRekeyer(UserRepo, PIIKeys, MFA, xparams)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+	deps = append(deps, Rekeyer)
+
+	tmplMgr := core.NewTemplateManager(assetsFS, logger)
+	deps = append(deps, tmplMgr)
+
+	mailer, err := core.NewMailer(core.MailerOptions{
+		Driver: cfg.Mail.Driver,
+		Dir:    cfg.Mail.Dir,
+		SMTP: core.SMTPOptions{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+
+	EmailTokenRepo := mongo.NewEmailTokenMongoRepo(UserRepo)
+	deps = append(deps, EmailTokenRepo)
+
+	Emails := authn.NewEmailManager(UserRepo, EmailTokenRepo, Keyring, PIIKeys, mailer, tmplMgr, xparams)
+	deps = append(deps, Emails)
+
+	ConsentRepo := mongo.NewConsentMongoRepo(UserRepo)
+	deps = append(deps, ConsentRepo)
+
+	FederatedIdentityRepo := mongo.NewFederatedIdentityMongoRepo(UserRepo)
+	deps = append(deps, FederatedIdentityRepo)
+
+	Privacy := authn.NewPrivacyManager(UserRepo, SessionRepo, MFARepo, ConsentRepo, FederatedIdentityRepo, PIIKeys, authn.NewAuthzGrants(xparams), xparams)
+
+	Guard := authn.NewAdminGuard(Sessions, authn.NewAuthzPermissions(xparams), xparams)
+
+	UserHandler := authn.NewUserHandler(UserRepo, MFA, Privacy, Guard, xparams)
 	deps = append(deps, UserHandler)
 
-	AuthHandler := authn.NewAuthHandler(UserRepo, xparams)
+	LoginAttemptRepo := mongo.NewLoginAttemptMongoRepo(UserRepo)
+	deps = append(deps, LoginAttemptRepo)
+
+	Limiter, err := authn.NewLoginLimiter(LoginAttemptRepo, UserRepo, xparams)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+
+	AuthHandler := authn.NewAuthHandler(UserRepo, PIIKeys, Sessions, MFA, Emails, Limiter, xparams)
 	deps = append(deps, AuthHandler)
 
+	ServiceAccountRepo := mongo.NewServiceAccountMongoRepo(UserRepo)
+	deps = append(deps, ServiceAccountRepo)
+
+	APIKeyRepo := mongo.NewAPIKeyMongoRepo(UserRepo)
+	deps = append(deps, APIKeyRepo)
+
+	APIKeys := authn.NewAPIKeyManager(ServiceAccountRepo, APIKeyRepo, xparams)
+
+	ServiceAccountHandler := authn.NewServiceAccountHandler(ServiceAccountRepo, APIKeyRepo, APIKeys, Guard, xparams)
+	deps = append(deps, ServiceAccountHandler)
+
+	if cfg.OIDC.Enabled {
+		OIDCClientRepo := mongo.NewOIDCClientMongoRepo(UserRepo)
+		deps = append(deps, OIDCClientRepo)
+
+		AuthorizationCodeRepo := mongo.NewAuthorizationCodeMongoRepo(UserRepo)
+		deps = append(deps, AuthorizationCodeRepo)
+
+		OIDC, err := authn.NewOIDCProvider(OIDCClientRepo, AuthorizationCodeRepo, UserRepo, PIIKeys, Sessions, Keyring, xparams)
+		if err != nil {
+			log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+		}
+
+		OIDCHandler := authn.NewOIDCHandler(OIDC, OIDCClientRepo, AuthHandler, tmplMgr, Guard, xparams)
+		deps = append(deps, OIDCHandler)
+	}
+
+	if len(cfg.Federation.Providers) > 0 {
+		Federation, err := authn.NewFederation(FederatedIdentityRepo, UserRepo, PIIKeys, Keyring, xparams)
+		if err != nil {
+			log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+		}
+
+		FederationHandler := authn.NewFederationHandler(Federation, AuthHandler, xparams)
+		deps = append(deps, FederationHandler)
+	}
+
+	routeCatalog, err := core.NewRouteCatalog(nil)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+	deps = append(deps, routeCatalog)
+
+	health := core.NewHealth()
+	deps = append(deps, health)
+
 	starts, stops := core.Setup(ctx, router, deps...)
 
 	if err := core.Start(ctx, starts, stops); err != nil {
@@ -58,7 +191,7 @@ func main() {
 	logger.Infof("%s(%s) started successfully", name, version)
 
 	go func() {
-		core.Serve(router, core.ServerOpts{Port: cfg.Server.Port}, stops, logger)
+		core.Serve(router, core.ServerOpts{Port: cfg.Server.Port, Health: health}, stops, logger)
 	}()
 
 	stop := make(chan os.Signal, 1)
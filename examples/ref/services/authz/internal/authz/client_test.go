@@ -0,0 +1,366 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/pkg/client"
+	authzclient "github.com/adrianpk/hatmax-ref/pkg/client/authz"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/authz/internal/config"
+)
+
+func newTestAuthzClient(t *testing.T) *authzclient.Client {
+	t.Helper()
+
+	grantRepo := &testGrantRepo{}
+	roleRepo := &testRoleRepo{}
+	xparams := config.XParams{Log: core.NewNoopLogger()}
+
+	version := NewPolicyVersion(nil)
+	scopeParentRepo := newTestScopeParentRepo()
+	scopes := NewTableScopeResolver(scopeParentRepo)
+
+	router := chi.NewRouter()
+	NewPolicyHandler(NewPolicyEngine(roleRepo, grantRepo, version, scopes), xparams).RegisterRoutes(router)
+	NewRoleHandler(NewVersionedRoleRepo(roleRepo, version), xparams).RegisterRoutes(router)
+	NewGrantHandler(NewInheritingGrantRepo(NewVersionedGrantRepo(grantRepo, version), scopes), roleRepo, xparams).RegisterRoutes(router)
+	NewScopeHandler(NewVersionedScopeParentRepo(scopeParentRepo, version), scopes, xparams).RegisterRoutes(router)
+	version.RegisterRoutes(router)
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return authzclient.New(srv.URL, client.WithRetryPolicy(client.NoRetry))
+}
+
+func TestClientRoleLifecycle(t *testing.T) {
+	c := newTestAuthzClient(t)
+	ctx := context.Background()
+
+	role, err := c.CreateRole(ctx, authzclient.RoleInput{Name: "editor", Permissions: []string{"posts:write"}})
+	if err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+	if role.Name != "editor" {
+		t.Errorf("CreateRole() name = %s, want editor", role.Name)
+	}
+
+	if _, err := c.CreateRole(ctx, authzclient.RoleInput{Name: "editor"}); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("CreateRole() duplicate error = %v, want ErrConflict", err)
+	}
+
+	got, err := c.GetRole(ctx, role.ID)
+	if err != nil {
+		t.Fatalf("GetRole() error = %v", err)
+	}
+	if got.ID != role.ID {
+		t.Errorf("GetRole() ID = %s, want %s", got.ID, role.ID)
+	}
+
+	roles, err := c.ListRoles(ctx)
+	if err != nil {
+		t.Fatalf("ListRoles() error = %v", err)
+	}
+	if len(roles) != 1 {
+		t.Errorf("ListRoles() returned %d roles, want 1", len(roles))
+	}
+
+	if err := c.DeleteRole(ctx, role.ID); err != nil {
+		t.Fatalf("DeleteRole() error = %v", err)
+	}
+
+	if _, err := c.GetRole(ctx, role.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("GetRole() after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClientGrantAndCan(t *testing.T) {
+	c := newTestAuthzClient(t)
+	ctx := context.Background()
+	userID := uuid.New().String()
+	scope := authzclient.Scope{Type: "resource", ID: "posts"}
+
+	if _, err := c.CreateRole(ctx, authzclient.RoleInput{Name: "editor", Permissions: []string{"posts:write"}}); err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+
+	allowed, err := c.Can(ctx, userID, "posts:write", scope)
+	if err != nil {
+		t.Fatalf("Can() error = %v", err)
+	}
+	if allowed {
+		t.Error("Can() = true before grant, want false")
+	}
+
+	grant, err := c.CreateGrant(ctx, authzclient.GrantInput{UserID: userID, RoleName: "editor", Resource: "posts"})
+	if err != nil {
+		t.Fatalf("CreateGrant() error = %v", err)
+	}
+
+	allowed, err = c.Can(ctx, userID, "posts:write", scope)
+	if err != nil {
+		t.Fatalf("Can() error = %v", err)
+	}
+	if !allowed {
+		t.Error("Can() = false after grant, want true")
+	}
+
+	grants, err := c.ListUserGrants(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListUserGrants() error = %v", err)
+	}
+	if len(grants) != 1 || grants[0].ID != grant.ID {
+		t.Errorf("ListUserGrants() = %v, want [%s]", grants, grant.ID)
+	}
+
+	if err := c.RevokeGrant(ctx, grant.ID); err != nil {
+		t.Fatalf("RevokeGrant() error = %v", err)
+	}
+}
+
+func TestClientBatchEvaluateAndPolicyVersion(t *testing.T) {
+	c := newTestAuthzClient(t)
+	ctx := context.Background()
+	userID := uuid.New().String()
+
+	before, err := c.GetPolicyVersion(ctx)
+	if err != nil {
+		t.Fatalf("GetPolicyVersion() error = %v", err)
+	}
+
+	if _, err := c.CreateRole(ctx, authzclient.RoleInput{Name: "editor", Permissions: []string{"posts:write"}}); err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+	if _, err := c.CreateGrant(ctx, authzclient.GrantInput{UserID: userID, RoleName: "editor", Resource: "posts"}); err != nil {
+		t.Fatalf("CreateGrant() error = %v", err)
+	}
+
+	after, err := c.GetPolicyVersion(ctx)
+	if err != nil {
+		t.Fatalf("GetPolicyVersion() error = %v", err)
+	}
+	if after == before {
+		t.Errorf("GetPolicyVersion() = %d after role and grant changes, want a new version", after)
+	}
+
+	scope := authzclient.Scope{Type: "resource", ID: "posts"}
+	res, err := c.EvaluatePermissions(ctx, authzclient.BatchPermissionRequest{
+		UserID: userID,
+		Checks: []authzclient.PermissionCheck{
+			{Permission: "posts:write", Scope: scope},
+			{Permission: "posts:delete", Scope: scope},
+		},
+	})
+	if err != nil {
+		t.Fatalf("EvaluatePermissions() error = %v", err)
+	}
+	if len(res.Results) != 2 || !res.Results[0].Allowed || res.Results[1].Allowed {
+		t.Errorf("EvaluatePermissions() = %+v, want [allowed denied]", res.Results)
+	}
+
+	_, err = c.EvaluatePermissions(ctx, authzclient.BatchPermissionRequest{UserID: userID})
+	if !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("EvaluatePermissions() without checks error = %v, want ErrBadRequest", err)
+	}
+}
+
+func TestClientGrantUnknownRole(t *testing.T) {
+	c := newTestAuthzClient(t)
+
+	_, err := c.CreateGrant(context.Background(), authzclient.GrantInput{UserID: uuid.New().String(), RoleName: "missing"})
+	if !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("CreateGrant() error = %v, want ErrBadRequest", err)
+	}
+}
+
+func TestClientRoleInheritance(t *testing.T) {
+	c := newTestAuthzClient(t)
+	ctx := context.Background()
+	userID := uuid.New().String()
+	scope := authzclient.Scope{Type: "resource", ID: "posts"}
+
+	viewer, err := c.CreateRole(ctx, authzclient.RoleInput{Name: "viewer", Permissions: []string{"posts:read"}})
+	if err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+	editor, err := c.CreateRole(ctx, authzclient.RoleInput{Name: "editor", Permissions: []string{"posts:write"}, Inherits: []string{viewer.ID}})
+	if err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+	if len(editor.Inherits) != 1 || editor.Inherits[0] != viewer.ID {
+		t.Errorf("CreateRole() inherits = %v, want [%s]", editor.Inherits, viewer.ID)
+	}
+
+	if _, err := c.CreateGrant(ctx, authzclient.GrantInput{UserID: userID, RoleName: "editor", Resource: "posts"}); err != nil {
+		t.Fatalf("CreateGrant() error = %v", err)
+	}
+	if allowed, err := c.Can(ctx, userID, "posts:read", scope); err != nil || !allowed {
+		t.Errorf("Can(posts:read) = %v, %v, want it inherited from viewer", allowed, err)
+	}
+
+	// Changing the inherited role reaches the users of the inheriting one
+	if _, err := c.UpdateRole(ctx, viewer.ID, authzclient.RoleInput{Permissions: []string{"posts:*"}}); err != nil {
+		t.Fatalf("UpdateRole() error = %v", err)
+	}
+	if allowed, err := c.Can(ctx, userID, "posts:delete", scope); err != nil || !allowed {
+		t.Errorf("Can(posts:delete) = %v, %v after viewer got posts:*, want true", allowed, err)
+	}
+
+	_, err = c.UpdateRole(ctx, viewer.ID, authzclient.RoleInput{Inherits: []string{editor.ID}})
+	if !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("UpdateRole() with a cycle error = %v, want ErrBadRequest", err)
+	}
+
+	_, err = c.CreateRole(ctx, authzclient.RoleInput{Name: "orphan", Inherits: []string{uuid.New().String()}})
+	if !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("CreateRole() with an unknown parent error = %v, want ErrBadRequest", err)
+	}
+}
+
+func TestClientScopeHierarchy(t *testing.T) {
+	c := newTestAuthzClient(t)
+	ctx := context.Background()
+	userID := uuid.New().String()
+	org := authzclient.Scope{Type: "org", ID: "acme"}
+	project := authzclient.Scope{Type: "project", ID: "acme/web"}
+	resource := authzclient.Scope{Type: "resource", ID: "acme/web/site"}
+
+	if err := c.SetScopeParent(ctx, project, org); err != nil {
+		t.Fatalf("SetScopeParent() error = %v", err)
+	}
+	if err := c.SetScopeParent(ctx, resource, project); err != nil {
+		t.Fatalf("SetScopeParent() error = %v", err)
+	}
+
+	ancestors, err := c.GetScopeAncestors(ctx, resource)
+	if err != nil {
+		t.Fatalf("GetScopeAncestors() error = %v", err)
+	}
+	if len(ancestors) != 2 || ancestors[0] != project || ancestors[1] != org {
+		t.Errorf("GetScopeAncestors() = %v, want [%v %v]", ancestors, project, org)
+	}
+
+	children, err := c.ListScopeChildren(ctx, org)
+	if err != nil {
+		t.Fatalf("ListScopeChildren() error = %v", err)
+	}
+	if len(children) != 1 || children[0] != project {
+		t.Errorf("ListScopeChildren() = %v, want [%v]", children, project)
+	}
+
+	if err := c.SetScopeParent(ctx, org, resource); !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("SetScopeParent() with a cycle error = %v, want ErrBadRequest", err)
+	}
+
+	if _, err := c.CreateRole(ctx, authzclient.RoleInput{Name: "maintainer", Permissions: []string{"sites:write"}}); err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+	grant, err := c.CreateGrant(ctx, authzclient.GrantInput{UserID: userID, RoleName: "maintainer", Scope: &org})
+	if err != nil {
+		t.Fatalf("CreateGrant() error = %v", err)
+	}
+	if grant.Scope != org {
+		t.Errorf("CreateGrant() scope = %v, want %v", grant.Scope, org)
+	}
+
+	if allowed, err := c.Can(ctx, userID, "sites:write", resource); err != nil || !allowed {
+		t.Errorf("Can() on a resource of the org = %v, %v, want the org grant inherited", allowed, err)
+	}
+	if allowed, err := c.Can(ctx, userID, "sites:write", authzclient.Scope{Type: "org", ID: "other"}); err != nil || allowed {
+		t.Errorf("Can() on another org = %v, %v, want false", allowed, err)
+	}
+
+	grants, err := c.ListGrantsByScope(ctx, project)
+	if err != nil {
+		t.Fatalf("ListGrantsByScope() error = %v", err)
+	}
+	if len(grants) != 1 || grants[0].ID != grant.ID {
+		t.Errorf("ListGrantsByScope() = %v, want the inherited org grant", grants)
+	}
+
+	if err := c.DeleteScopeParent(ctx, project); err != nil {
+		t.Fatalf("DeleteScopeParent() error = %v", err)
+	}
+	if allowed, err := c.Can(ctx, userID, "sites:write", resource); err != nil || allowed {
+		t.Errorf("Can() after the project left the org = %v, %v, want false", allowed, err)
+	}
+}
+
+func TestClientExplain(t *testing.T) {
+	c := newTestAuthzClient(t)
+	ctx := context.Background()
+	userID := uuid.New().String()
+	org := authzclient.Scope{Type: "org", ID: "acme"}
+	project := authzclient.Scope{Type: "project", ID: "acme/web"}
+
+	if err := c.SetScopeParent(ctx, project, org); err != nil {
+		t.Fatalf("SetScopeParent() error = %v", err)
+	}
+	viewer, err := c.CreateRole(ctx, authzclient.RoleInput{Name: "viewer", Permissions: []string{"lists:read"}})
+	if err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+	if _, err := c.CreateRole(ctx, authzclient.RoleInput{Name: "editor", Permissions: []string{"lists:write"}, Inherits: []string{viewer.ID}}); err != nil {
+		t.Fatalf("CreateRole() error = %v", err)
+	}
+
+	trace, err := c.Explain(ctx, authzclient.ExplainRequest{UserID: userID, Permission: "lists:read", Scope: project})
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	if trace.Allowed || trace.Reason != "no grants" {
+		t.Errorf("Explain() without grants = %v, %q, want not allowed, no grants", trace.Allowed, trace.Reason)
+	}
+
+	grant, err := c.CreateGrant(ctx, authzclient.GrantInput{UserID: userID, RoleName: "editor", Scope: &org})
+	if err != nil {
+		t.Fatalf("CreateGrant() error = %v", err)
+	}
+
+	trace, err = c.Explain(ctx, authzclient.ExplainRequest{UserID: userID, Permission: "lists:read", Scope: project})
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	if !trace.Allowed || len(trace.Ancestors) != 1 || trace.Ancestors[0] != org {
+		t.Fatalf("Explain() = %+v, want allowed through the org", trace)
+	}
+	if len(trace.Grants) != 1 {
+		t.Fatalf("Explain() traced %d grants, want 1", len(trace.Grants))
+	}
+	got := trace.Grants[0]
+	if got.GrantID != grant.ID || got.ScopeMatch != "ancestor" || got.RoleName != "viewer" || got.Permission != "lists:read" || !got.Allows {
+		t.Errorf("Explain() grant = %+v, want lists:read from the inherited viewer role on the org", got)
+	}
+
+	policy := []byte(`{
+		"actions": {"edit": {"allOf": ["lists:write"]}},
+		"deny": {"edit": [{"conditions": [{"attribute": "resource.status", "operator": "eq", "value": "archived"}]}]}
+	}`)
+	trace, err = c.Explain(ctx, authzclient.ExplainRequest{
+		UserID:     userID,
+		Permission: "lists:write",
+		Scope:      project,
+		Policy:     policy,
+		Action:     "edit",
+		Resource:   map[string]string{"status": "archived"},
+	})
+	if err != nil {
+		t.Fatalf("Explain() with a policy error = %v", err)
+	}
+	if trace.Allowed || trace.Policy == nil || trace.Policy.DeniedBy != "deny.edit[0]" {
+		t.Fatalf("Explain() with a policy = %+v, want denied by deny.edit[0]", trace)
+	}
+	if len(trace.Policy.Conditions) != 1 || trace.Policy.Conditions[0].Condition.Attribute != "resource.status" || !trace.Policy.Conditions[0].Holds {
+		t.Errorf("Explain() conditions = %+v, want the archived condition holding", trace.Policy.Conditions)
+	}
+
+	if _, err := c.Explain(ctx, authzclient.ExplainRequest{UserID: userID, Permission: "lists:write", Policy: policy}); !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("Explain() with a policy and no action error = %v, want ErrBadRequest", err)
+	}
+}
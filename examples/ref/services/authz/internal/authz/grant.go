@@ -21,10 +21,11 @@ type Scope struct {
 	ID   string `json:"id"`   // Specific ID or empty for global
 }
 
-// Grant represents a permission grant to a user
+// Grant represents a permission grant to a user. UserID may also be the ID
+// of an authn service account; grants apply to both in the same way.
 type Grant struct {
 	ID        uuid.UUID
-	UserID    uuid.UUID
+	UserID    uuid.UUID // User or service account ID
 	GrantType GrantType
 	Value     string     // RoleID or PermissionCode
 	Scope     Scope      // Context scope
@@ -95,3 +96,36 @@ func (g *Grant) MatchesScope(requestedScope Scope) bool {
 	// Exact match required for specific scopes
 	return g.Scope.Type == requestedScope.Type && g.Scope.ID == requestedScope.ID
 }
+
+// authGrant converts the grant to the auth library type
+func (g *Grant) authGrant() authpkg.Grant {
+	return authpkg.Grant{
+		ID:        g.ID,
+		UserID:    g.UserID,
+		GrantType: authpkg.GrantType(g.GrantType),
+		Value:     g.Value,
+		Scope:     g.Scope.authScope(),
+		ExpiresAt: g.ExpiresAt,
+	}
+}
+
+// authScope converts the scope to the auth library type
+func (s Scope) authScope() authpkg.Scope {
+	return authpkg.Scope{Type: s.Type, ID: s.ID}
+}
+
+// MatchesScopeWithin checks if the grant scope matches the requested scope
+// or one of its ancestors, as grants on a scope apply to everything below it
+func (g *Grant) MatchesScopeWithin(requestedScope Scope, ancestors []Scope) bool {
+	if g.MatchesScope(requestedScope) {
+		return true
+	}
+
+	for _, ancestor := range ancestors {
+		if g.Scope == ancestor {
+			return true
+		}
+	}
+
+	return false
+}
@@ -47,9 +47,10 @@ func (h *GrantHandler) RegisterRoutes(r chi.Router) {
 
 // GrantRequest represents the request payload for creating grants
 type GrantRequest struct {
-	UserID    string  `json:"user_id"`
+	UserID    string  `json:"user_id"` // User or service account ID
 	RoleName  string  `json:"role_name"`
 	Resource  string  `json:"resource"`
+	Scope     *Scope  `json:"scope,omitempty"`      // Takes precedence over Resource
 	ExpiresAt *string `json:"expires_at,omitempty"` // ISO8601 timestamp
 }
 
@@ -60,11 +61,15 @@ func (h *GrantHandler) ListGrants(w http.ResponseWriter, r *http.Request) {
 
 	// Parse query parameters
 	userID := r.URL.Query().Get("user_id")
+	scopeType := r.URL.Query().Get("scope_type")
 
 	var grants []*Grant
 	var err error
 
-	if userID != "" {
+	if scopeType != "" {
+		// Includes the grants inherited from the ancestors of the scope
+		grants, err = h.grantRepo.ListByScope(ctx, Scope{Type: scopeType, ID: r.URL.Query().Get("scope_id")})
+	} else if userID != "" {
 		uid, parseErr := uuid.Parse(userID)
 		if parseErr != nil {
 			core.RespondError(w, http.StatusBadRequest, "Invalid user ID")
@@ -152,6 +157,13 @@ func (h *GrantHandler) CreateGrant(w http.ResponseWriter, r *http.Request) {
 	grant.GrantType = grantType
 	grant.Value = role.ID.String() // Store role UUID, not name
 	grant.Scope = Scope{Type: "resource", ID: req.Resource}
+	if req.Scope != nil {
+		if req.Scope.Type == "" {
+			core.RespondError(w, http.StatusBadRequest, "Scope type is required")
+			return
+		}
+		grant.Scope = *req.Scope
+	}
 	grant.ExpiresAt = expiresAt
 
 	if err := h.grantRepo.Create(ctx, grant); err != nil {
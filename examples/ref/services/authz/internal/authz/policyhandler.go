@@ -3,11 +3,13 @@ package authz
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
 
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
 	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
 	"github.com/adrianpk/hatmax-ref/services/authz/internal/config"
 )
@@ -30,6 +32,8 @@ func NewPolicyHandler(policyEngine *PolicyEngine, xparams config.XParams) *Polic
 func (h *PolicyHandler) RegisterRoutes(r chi.Router) {
 	r.Route("/authz/policy", func(r chi.Router) {
 		r.Post("/evaluate", h.EvaluatePermission)
+		r.Post("/evaluate/batch", h.EvaluatePermissions)
+		r.Post("/explain", h.ExplainPermission)
 		r.Get("/users/{user_id}/permissions", h.GetUserPermissions)
 	})
 }
@@ -49,6 +53,27 @@ type PermissionResponse struct {
 	Allowed    bool   `json:"allowed"`
 }
 
+// MaxBatchChecks caps the checks accepted by a batch evaluation
+const MaxBatchChecks = 100
+
+// PermissionCheck is one permission of a batch evaluation
+type PermissionCheck struct {
+	Permission string `json:"permission"`
+	Scope      Scope  `json:"scope"`
+}
+
+// BatchPermissionRequest represents the request payload for batch evaluation
+type BatchPermissionRequest struct {
+	UserID string            `json:"user_id"`
+	Checks []PermissionCheck `json:"checks"`
+}
+
+// BatchPermissionResponse holds one result per check, in request order
+type BatchPermissionResponse struct {
+	UserID  string               `json:"user_id"`
+	Results []PermissionResponse `json:"results"`
+}
+
 // UserPermissionsResponse represents the response for user permissions
 type UserPermissionsResponse struct {
 	UserID      string   `json:"user_id"`
@@ -56,6 +81,80 @@ type UserPermissionsResponse struct {
 	Permissions []string `json:"permissions"`
 }
 
+// ExplainRequest represents the request payload for a decision trace. A
+// resource policy, with the action and attributes it is evaluated against,
+// can be given to explain it too; the subject id defaults to the user ID.
+type ExplainRequest struct {
+	UserID     string                  `json:"user_id"`
+	Permission string                  `json:"permission"`
+	Scope      Scope                   `json:"scope"`
+	Policy     *authpkg.ResourcePolicy `json:"policy,omitempty"`
+	Action     string                  `json:"action,omitempty"`
+	Subject    authpkg.Attributes      `json:"subject,omitempty"`
+	Resource   authpkg.Attributes      `json:"resource,omitempty"`
+	Context    authpkg.Attributes      `json:"context,omitempty"`
+}
+
+// ExplainResponse is the trace of a decision: every grant considered and,
+// when a policy was given, its evaluation
+type ExplainResponse struct {
+	UserID     string               `json:"user_id"`
+	Permission string               `json:"permission"`
+	Scope      Scope                `json:"scope"`
+	Ancestors  []Scope              `json:"ancestors"`
+	Allowed    bool                 `json:"allowed"`
+	Reason     string               `json:"reason"`
+	Grants     []GrantTraceResponse `json:"grants"`
+	Policy     *PolicyTraceResponse `json:"policy,omitempty"`
+}
+
+// GrantTraceResponse is what a grant contributed to a decision. ScopeMatch
+// is "global", "exact" or "ancestor"; RoleID is the role, maybe inherited,
+// holding Permission.
+type GrantTraceResponse struct {
+	GrantID      string     `json:"grant_id"`
+	GrantType    GrantType  `json:"grant_type"`
+	Value        string     `json:"value"`
+	Scope        Scope      `json:"scope"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Expired      bool       `json:"expired"`
+	ScopeMatch   string     `json:"scope_match,omitempty"`
+	MatchedScope *Scope     `json:"matched_scope,omitempty"`
+	RoleID       string     `json:"role_id,omitempty"`
+	RoleName     string     `json:"role_name,omitempty"`
+	Permission   string     `json:"permission,omitempty"`
+	Allows       bool       `json:"allows"`
+}
+
+// PolicyTraceResponse is the evaluation of a resource policy. Rules are
+// named by path, as in "actions.edit.or[0]" or "deny.*[0]".
+type PolicyTraceResponse struct {
+	Action     string                   `json:"action"`
+	Defined    bool                     `json:"defined"`
+	Allowed    bool                     `json:"allowed"`
+	AllowedBy  string                   `json:"allowed_by,omitempty"`
+	DeniedBy   string                   `json:"denied_by,omitempty"`
+	Reason     string                   `json:"reason"`
+	Conditions []ConditionTraceResponse `json:"conditions"`
+}
+
+// ConditionTraceResponse is the outcome of a condition of a policy rule
+type ConditionTraceResponse struct {
+	Rule      string            `json:"rule"`
+	Condition ConditionResponse `json:"condition"`
+	Holds     bool              `json:"holds"`
+	Evaluated bool              `json:"evaluated"`
+}
+
+// ConditionResponse is a policy condition as written in policies
+type ConditionResponse struct {
+	Attribute string   `json:"attribute"`
+	Operator  string   `json:"operator"`
+	Value     string   `json:"value,omitempty"`
+	Values    []string `json:"values,omitempty"`
+	ValueFrom string   `json:"valueFrom,omitempty"`
+}
+
 // EvaluatePermission handles POST /authz/policy/evaluate
 // This is the core endpoint that other services will call to check permissions
 func (h *PolicyHandler) EvaluatePermission(w http.ResponseWriter, r *http.Request) {
@@ -123,6 +222,152 @@ func (h *PolicyHandler) EvaluatePermission(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(core.SuccessResponse{Data: response})
 }
 
+// EvaluatePermissions handles POST /authz/policy/evaluate/batch
+// It evaluates several permissions of a user in one round trip
+func (h *PolicyHandler) EvaluatePermissions(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	var req BatchPermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Debug("invalid request payload", "error", err)
+		core.RespondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.UserID == "" {
+		core.RespondError(w, http.StatusBadRequest, "User ID is required")
+		return
+	}
+	if len(req.Checks) == 0 || len(req.Checks) > MaxBatchChecks {
+		core.RespondError(w, http.StatusBadRequest, "Between 1 and 100 checks are required")
+		return
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		core.RespondError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	response := BatchPermissionResponse{
+		UserID:  req.UserID,
+		Results: make([]PermissionResponse, 0, len(req.Checks)),
+	}
+
+	for _, check := range req.Checks {
+		if check.Permission == "" {
+			core.RespondError(w, http.StatusBadRequest, "Permission is required")
+			return
+		}
+
+		scope := check.Scope
+		if scope.Type == "" {
+			scope = Scope{Type: "global", ID: ""}
+		}
+
+		allowed, err := h.policyEngine.Has(ctx, userID, check.Permission, scope)
+		if err != nil {
+			log.Error("failed to evaluate permission", "error", err,
+				"user_id", req.UserID,
+				"permission", check.Permission,
+				"scope", scope)
+			core.RespondError(w, http.StatusInternalServerError, "Failed to evaluate permission")
+			return
+		}
+
+		response.Results = append(response.Results, PermissionResponse{
+			UserID:     req.UserID,
+			Permission: check.Permission,
+			Scope:      scope,
+			Allowed:    allowed,
+		})
+	}
+
+	log.Info("permissions evaluated", "user_id", req.UserID, "checks", len(req.Checks))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(core.SuccessResponse{Data: response})
+}
+
+// ExplainPermission handles POST /authz/policy/explain
+// It tells why a user has a permission or not, for admins and debugging
+func (h *PolicyHandler) ExplainPermission(w http.ResponseWriter, r *http.Request) {
+	log := h.logForRequest(r)
+	ctx := r.Context()
+
+	var req ExplainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Debug("invalid request payload", "error", err)
+		core.RespondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if req.UserID == "" {
+		core.RespondError(w, http.StatusBadRequest, "User ID is required")
+		return
+	}
+	if req.Permission == "" {
+		core.RespondError(w, http.StatusBadRequest, "Permission is required")
+		return
+	}
+	if req.Policy != nil && req.Action == "" {
+		core.RespondError(w, http.StatusBadRequest, "Action is required with a policy")
+		return
+	}
+
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		core.RespondError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	scope := req.Scope
+	if scope.Type == "" {
+		scope = Scope{Type: "global", ID: ""}
+	}
+
+	trace, err := h.policyEngine.Explain(ctx, userID, req.Permission, scope)
+	if err != nil {
+		log.Error("failed to explain permission", "error", err,
+			"user_id", req.UserID,
+			"permission", req.Permission,
+			"scope", scope)
+		core.RespondError(w, http.StatusInternalServerError, "Failed to explain permission")
+		return
+	}
+
+	if req.Policy != nil {
+		permissions, err := h.policyEngine.GetUserPermissions(ctx, userID, scope)
+		if err != nil {
+			log.Error("failed to get user permissions", "error", err, "user_id", req.UserID, "scope", scope)
+			core.RespondError(w, http.StatusInternalServerError, "Failed to explain permission")
+			return
+		}
+
+		subject := authpkg.Attributes{"id": req.UserID}
+		for name, value := range req.Subject {
+			subject[name] = value
+		}
+
+		trace = trace.WithPolicy(authpkg.ExplainPolicy(*req.Policy, req.Action, authpkg.AccessRequest{
+			Permissions: permissions,
+			Subject:     subject,
+			Resource:    req.Resource,
+			Context:     req.Context,
+		}))
+	}
+
+	log.Info("permission explained",
+		"user_id", req.UserID,
+		"permission", req.Permission,
+		"scope", scope,
+		"allowed", trace.Allowed)
+
+	core.RespondSuccess(w, explainResponse(req.UserID, scope, trace))
+}
+
 // GetUserPermissions handles GET /authz/policy/users/{user_id}/permissions
 // Returns all permissions for a user in a given scope
 func (h *PolicyHandler) GetUserPermissions(w http.ResponseWriter, r *http.Request) {
@@ -178,6 +423,71 @@ func (h *PolicyHandler) GetUserPermissions(w http.ResponseWriter, r *http.Reques
 
 // Helper methods
 
+func explainResponse(userID string, scope Scope, trace authpkg.DecisionTrace) ExplainResponse {
+	response := ExplainResponse{
+		UserID:     userID,
+		Permission: trace.Permission,
+		Scope:      scope,
+		Ancestors:  make([]Scope, 0, len(trace.Ancestors)),
+		Allowed:    trace.Allowed,
+		Reason:     trace.Reason,
+		Grants:     make([]GrantTraceResponse, 0, len(trace.Grants)),
+	}
+
+	for _, ancestor := range trace.Ancestors {
+		response.Ancestors = append(response.Ancestors, Scope{Type: ancestor.Type, ID: ancestor.ID})
+	}
+
+	for _, grant := range trace.Grants {
+		gt := GrantTraceResponse{
+			GrantID:    grant.GrantID.String(),
+			GrantType:  GrantType(grant.GrantType),
+			Value:      grant.Value,
+			Scope:      Scope{Type: grant.Scope.Type, ID: grant.Scope.ID},
+			ExpiresAt:  grant.ExpiresAt,
+			Expired:    grant.Expired,
+			ScopeMatch: grant.ScopeMatch,
+			RoleID:     grant.RoleID,
+			RoleName:   grant.RoleName,
+			Permission: grant.Permission,
+			Allows:     grant.Allows,
+		}
+		if grant.MatchedScope != nil {
+			gt.MatchedScope = &Scope{Type: grant.MatchedScope.Type, ID: grant.MatchedScope.ID}
+		}
+		response.Grants = append(response.Grants, gt)
+	}
+
+	if trace.Policy != nil {
+		policy := &PolicyTraceResponse{
+			Action:     trace.Policy.Action,
+			Defined:    trace.Policy.Defined,
+			Allowed:    trace.Policy.Allowed,
+			AllowedBy:  trace.Policy.AllowedBy,
+			DeniedBy:   trace.Policy.DeniedBy,
+			Reason:     trace.Policy.Reason,
+			Conditions: make([]ConditionTraceResponse, 0, len(trace.Policy.Conditions)),
+		}
+		for _, cond := range trace.Policy.Conditions {
+			policy.Conditions = append(policy.Conditions, ConditionTraceResponse{
+				Rule: cond.Rule,
+				Condition: ConditionResponse{
+					Attribute: cond.Condition.Attribute,
+					Operator:  string(cond.Condition.Operator),
+					Value:     cond.Condition.Value,
+					Values:    cond.Condition.Values,
+					ValueFrom: cond.Condition.ValueFrom,
+				},
+				Holds:     cond.Holds,
+				Evaluated: cond.Evaluated,
+			})
+		}
+		response.Policy = policy
+	}
+
+	return response
+}
+
 func (h *PolicyHandler) logForRequest(r *http.Request) core.Logger {
 	return h.xparams.Log.With(
 		"request_id", middleware.GetReqID(r.Context()),
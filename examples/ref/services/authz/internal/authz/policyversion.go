@@ -0,0 +1,197 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+)
+
+// PolicyVersion changes every time grants or roles change. Services caching
+// permission checks poll it and drop their cache when it moves.
+// The version is kept in the repo so every replica sees the changes made
+// through the others. Reads are cached for policyVersionRefresh, so a replica
+// sees a change made elsewhere after at most that long.
+// Without a repo the version lives in memory, seeded with the start time so a
+// restart is also seen as a change; that only holds for a single replica.
+type PolicyVersion struct {
+	repo    PolicyVersionRepo
+	refresh time.Duration
+
+	mu      sync.Mutex
+	version int64
+	readAt  time.Time
+}
+
+// policyVersionRefresh bounds how long a version read from the repo is used
+const policyVersionRefresh = time.Second
+
+// PolicyVersionResponse represents the response of the version endpoint
+type PolicyVersionResponse struct {
+	Version int64 `json:"version"`
+}
+
+// NewPolicyVersion creates a policy version stored in repo. A nil repo keeps
+// it in memory.
+func NewPolicyVersion(repo PolicyVersionRepo) *PolicyVersion {
+	v := &PolicyVersion{repo: repo, refresh: policyVersionRefresh}
+	if repo == nil {
+		v.version = time.Now().UnixNano()
+	}
+	return v
+}
+
+// Current returns the current version
+func (v *PolicyVersion) Current(ctx context.Context) (int64, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.repo == nil || time.Since(v.readAt) < v.refresh {
+		return v.version, nil
+	}
+
+	version, err := v.repo.Get(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("could not get policy version: %w", err)
+	}
+
+	v.version = version
+	v.readAt = time.Now()
+	return version, nil
+}
+
+// Bump records a change of grants or roles
+func (v *PolicyVersion) Bump(ctx context.Context) (int64, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.repo == nil {
+		v.version++
+		return v.version, nil
+	}
+
+	version, err := v.repo.Increment(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("could not bump policy version: %w", err)
+	}
+
+	v.version = version
+	v.readAt = time.Now()
+	return version, nil
+}
+
+// RegisterRoutes registers the version route
+func (v *PolicyVersion) RegisterRoutes(r chi.Router) {
+	r.Get("/authz/policy/version", v.GetVersion)
+}
+
+// GetVersion handles GET /authz/policy/version
+func (v *PolicyVersion) GetVersion(w http.ResponseWriter, r *http.Request) {
+	version, err := v.Current(r.Context())
+	if err != nil {
+		core.RespondError(w, http.StatusInternalServerError, "Failed to get policy version")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(core.SuccessResponse{Data: PolicyVersionResponse{Version: version}})
+}
+
+// versionedRoleRepo bumps the policy version on every role change
+type versionedRoleRepo struct {
+	RoleRepo
+	version *PolicyVersion
+}
+
+// NewVersionedRoleRepo wraps a RoleRepo so writes bump the policy version
+func NewVersionedRoleRepo(repo RoleRepo, version *PolicyVersion) RoleRepo {
+	return &versionedRoleRepo{RoleRepo: repo, version: version}
+}
+
+func (r *versionedRoleRepo) Create(ctx context.Context, role *Role) error {
+	return r.bump(ctx, r.RoleRepo.Create(ctx, role))
+}
+
+func (r *versionedRoleRepo) Save(ctx context.Context, role *Role) error {
+	return r.bump(ctx, r.RoleRepo.Save(ctx, role))
+}
+
+func (r *versionedRoleRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.bump(ctx, r.RoleRepo.Delete(ctx, id))
+}
+
+func (r *versionedRoleRepo) bump(ctx context.Context, err error) error {
+	if err != nil {
+		return err
+	}
+	_, err = r.version.Bump(ctx)
+	return err
+}
+
+// versionedGrantRepo bumps the policy version on every grant change
+type versionedGrantRepo struct {
+	GrantRepo
+	version *PolicyVersion
+}
+
+// NewVersionedGrantRepo wraps a GrantRepo so writes bump the policy version
+func NewVersionedGrantRepo(repo GrantRepo, version *PolicyVersion) GrantRepo {
+	return &versionedGrantRepo{GrantRepo: repo, version: version}
+}
+
+func (r *versionedGrantRepo) Create(ctx context.Context, grant *Grant) error {
+	return r.bump(ctx, r.GrantRepo.Create(ctx, grant))
+}
+
+func (r *versionedGrantRepo) Save(ctx context.Context, grant *Grant) error {
+	return r.bump(ctx, r.GrantRepo.Save(ctx, grant))
+}
+
+func (r *versionedGrantRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.bump(ctx, r.GrantRepo.Delete(ctx, id))
+}
+
+func (r *versionedGrantRepo) bump(ctx context.Context, err error) error {
+	if err != nil {
+		return err
+	}
+	_, err = r.version.Bump(ctx)
+	return err
+}
+
+// versionedScopeParentRepo bumps the policy version on every change of the
+// scope tree, as it changes which grants apply where
+type versionedScopeParentRepo struct {
+	ScopeParentRepo
+	version *PolicyVersion
+}
+
+// NewVersionedScopeParentRepo wraps a ScopeParentRepo so writes bump the
+// policy version
+func NewVersionedScopeParentRepo(repo ScopeParentRepo, version *PolicyVersion) ScopeParentRepo {
+	return &versionedScopeParentRepo{ScopeParentRepo: repo, version: version}
+}
+
+func (r *versionedScopeParentRepo) Save(ctx context.Context, entry *ScopeParent) error {
+	return r.bump(ctx, r.ScopeParentRepo.Save(ctx, entry))
+}
+
+func (r *versionedScopeParentRepo) Delete(ctx context.Context, scope Scope) error {
+	return r.bump(ctx, r.ScopeParentRepo.Delete(ctx, scope))
+}
+
+func (r *versionedScopeParentRepo) bump(ctx context.Context, err error) error {
+	if err != nil {
+		return err
+	}
+	_, err = r.version.Bump(ctx)
+	return err
+}
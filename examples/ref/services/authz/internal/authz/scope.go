@@ -0,0 +1,194 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/pkg/client"
+)
+
+// MaxScopeDepth bounds how far up the ancestry of a scope is followed
+const MaxScopeDepth = 16
+
+// ErrScopeCycle is returned for scope ancestries that loop or are deeper
+// than MaxScopeDepth
+var ErrScopeCycle = errors.New("scope ancestry loops or is too deep")
+
+// GlobalScope is the scope above every other one
+var GlobalScope = Scope{Type: "global", ID: ""}
+
+// IsGlobal reports whether the scope is the global one
+func (s Scope) IsGlobal() bool {
+	return s.Type == "global"
+}
+
+// ScopeResolver finds the parent of a scope in its tree, as project:acme/web
+// is below org:acme. Scopes at the top of their tree have no parent and
+// resolve to nil; the global scope is above all of them.
+type ScopeResolver interface {
+	Parent(ctx context.Context, scope Scope) (*Scope, error)
+}
+
+// ScopeAncestors returns the ancestors of a scope, nearest first, not
+// including the global scope. A nil resolver makes every scope a root.
+func ScopeAncestors(ctx context.Context, resolver ScopeResolver, scope Scope) ([]Scope, error) {
+	if resolver == nil || scope.IsGlobal() {
+		return nil, nil
+	}
+
+	var ancestors []Scope
+	seen := map[Scope]bool{scope: true}
+
+	current := scope
+	for {
+		parent, err := resolver.Parent(ctx, current)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve parent of %s:%s: %w", current.Type, current.ID, err)
+		}
+		if parent == nil || parent.IsGlobal() {
+			return ancestors, nil
+		}
+		if seen[*parent] || len(ancestors) == MaxScopeDepth {
+			return nil, ErrScopeCycle
+		}
+
+		seen[*parent] = true
+		ancestors = append(ancestors, *parent)
+		current = *parent
+	}
+}
+
+// ScopeParent is an entry of the scope parent lookup table
+type ScopeParent struct {
+	Scope     Scope
+	Parent    Scope
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// tableScopeResolver resolves parents from the lookup table
+type tableScopeResolver struct {
+	repo ScopeParentRepo
+}
+
+// NewTableScopeResolver creates a resolver backed by the parent lookup table
+func NewTableScopeResolver(repo ScopeParentRepo) ScopeResolver {
+	return &tableScopeResolver{repo: repo}
+}
+
+func (r *tableScopeResolver) Parent(ctx context.Context, scope Scope) (*Scope, error) {
+	entry, err := r.repo.Get(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	return &entry.Parent, nil
+}
+
+// HTTPScopeResolver asks the service owning a scope type for the parent of
+// its scopes at GET {url}/scopes/{type}/{id}/parent. The service answers
+// with the parent scope, or 404 for scopes at the top of their tree.
+type HTTPScopeResolver struct {
+	client *client.Client
+}
+
+// NewHTTPScopeResolver creates a resolver calling the service at baseURL
+func NewHTTPScopeResolver(baseURL string, opts ...client.Option) *HTTPScopeResolver {
+	return &HTTPScopeResolver{client: client.New(baseURL, opts...)}
+}
+
+// Parent implements ScopeResolver
+func (r *HTTPScopeResolver) Parent(ctx context.Context, scope Scope) (*Scope, error) {
+	path := fmt.Sprintf("/scopes/%s/%s/parent", url.PathEscape(scope.Type), url.PathEscape(scope.ID))
+
+	var parent Scope
+	err := r.client.Do(ctx, http.MethodGet, path, nil, &parent)
+	if errors.Is(err, client.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &parent, nil
+}
+
+// ScopeResolvers picks the resolver of a scope by its type, falling back to
+// a default one, usually the lookup table.
+type ScopeResolvers struct {
+	byType   map[string]ScopeResolver
+	fallback ScopeResolver
+}
+
+// NewScopeResolvers creates a resolver set with a fallback, which may be nil
+func NewScopeResolvers(fallback ScopeResolver) *ScopeResolvers {
+	return &ScopeResolvers{
+		byType:   make(map[string]ScopeResolver),
+		fallback: fallback,
+	}
+}
+
+// Register sets the resolver of a scope type
+func (r *ScopeResolvers) Register(scopeType string, resolver ScopeResolver) {
+	r.byType[scopeType] = resolver
+}
+
+// Parent implements ScopeResolver
+func (r *ScopeResolvers) Parent(ctx context.Context, scope Scope) (*Scope, error) {
+	if resolver, ok := r.byType[scope.Type]; ok {
+		return resolver.Parent(ctx, scope)
+	}
+	if r.fallback == nil {
+		return nil, nil
+	}
+	return r.fallback.Parent(ctx, scope)
+}
+
+// inheritingGrantRepo lists, for a scope, the grants made on it, on its
+// ancestors and on the global scope, as they all apply to it
+type inheritingGrantRepo struct {
+	GrantRepo
+	scopes ScopeResolver
+}
+
+// NewInheritingGrantRepo wraps a GrantRepo so ListByScope includes the
+// grants inherited from the ancestors of the scope
+func NewInheritingGrantRepo(repo GrantRepo, scopes ScopeResolver) GrantRepo {
+	return &inheritingGrantRepo{GrantRepo: repo, scopes: scopes}
+}
+
+func (r *inheritingGrantRepo) ListByScope(ctx context.Context, scope Scope) ([]*Grant, error) {
+	ancestors, err := ScopeAncestors(ctx, r.scopes, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := append([]Scope{scope}, ancestors...)
+	if !scope.IsGlobal() {
+		scopes = append(scopes, GlobalScope)
+	}
+
+	var grants []*Grant
+	seen := make(map[uuid.UUID]bool)
+	for _, s := range scopes {
+		found, err := r.GrantRepo.ListByScope(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		for _, grant := range found {
+			if !seen[grant.ID] {
+				grants = append(grants, grant)
+				seen[grant.ID] = true
+			}
+		}
+	}
+
+	return grants, nil
+}
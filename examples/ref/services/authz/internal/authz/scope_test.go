@@ -0,0 +1,324 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/pkg/client"
+	authpkg "github.com/adrianpk/hatmax-ref/pkg/lib/auth"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+)
+
+// In-memory scope parent table for testing
+type testScopeParentRepo struct {
+	entries map[Scope]*ScopeParent
+	gets    int
+}
+
+func newTestScopeParentRepo(pairs ...Scope) *testScopeParentRepo {
+	r := &testScopeParentRepo{entries: make(map[Scope]*ScopeParent)}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		r.Save(context.Background(), &ScopeParent{Scope: pairs[i], Parent: pairs[i+1]})
+	}
+	return r
+}
+
+func (r *testScopeParentRepo) Save(ctx context.Context, entry *ScopeParent) error {
+	r.entries[entry.Scope] = entry
+	return nil
+}
+
+func (r *testScopeParentRepo) Get(ctx context.Context, scope Scope) (*ScopeParent, error) {
+	r.gets++
+	return r.entries[scope], nil
+}
+
+func (r *testScopeParentRepo) Delete(ctx context.Context, scope Scope) error {
+	delete(r.entries, scope)
+	return nil
+}
+
+func (r *testScopeParentRepo) ListByParent(ctx context.Context, parent Scope) ([]*ScopeParent, error) {
+	var result []*ScopeParent
+	for _, entry := range r.entries {
+		if entry.Parent == parent {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+var (
+	orgAcme     = Scope{Type: "org", ID: "acme"}
+	orgOther    = Scope{Type: "org", ID: "other"}
+	projectWeb  = Scope{Type: "project", ID: "acme/web"}
+	projectAPI  = Scope{Type: "project", ID: "acme/api"}
+	resourceWeb = Scope{Type: "resource", ID: "acme/web/site"}
+)
+
+func TestScopeAncestors(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestScopeParentRepo(
+		resourceWeb, projectWeb,
+		projectWeb, orgAcme,
+		projectAPI, orgAcme,
+	)
+	resolver := NewTableScopeResolver(repo)
+
+	tests := []struct {
+		name     string
+		resolver ScopeResolver
+		scope    Scope
+		expected []Scope
+	}{
+		{"resource", resolver, resourceWeb, []Scope{projectWeb, orgAcme}},
+		{"project", resolver, projectWeb, []Scope{orgAcme}},
+		{"root", resolver, orgAcme, nil},
+		{"unknown scope", resolver, Scope{Type: "team", ID: "1"}, nil},
+		{"global", resolver, GlobalScope, nil},
+		{"no resolver", nil, resourceWeb, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ScopeAncestors(ctx, tt.resolver, tt.scope)
+			if err != nil {
+				t.Fatalf("ScopeAncestors() error = %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Errorf("ScopeAncestors() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScopeAncestorsCycle(t *testing.T) {
+	ctx := context.Background()
+
+	loop := newTestScopeParentRepo(projectWeb, orgAcme, orgAcme, projectWeb)
+	if _, err := ScopeAncestors(ctx, NewTableScopeResolver(loop), projectWeb); !errors.Is(err, ErrScopeCycle) {
+		t.Errorf("ScopeAncestors() with a loop error = %v, want ErrScopeCycle", err)
+	}
+
+	deep := newTestScopeParentRepo()
+	for i := 0; i <= MaxScopeDepth; i++ {
+		deep.Save(ctx, &ScopeParent{
+			Scope:  Scope{Type: "level", ID: fmt.Sprint(i)},
+			Parent: Scope{Type: "level", ID: fmt.Sprint(i + 1)},
+		})
+	}
+	if _, err := ScopeAncestors(ctx, NewTableScopeResolver(deep), Scope{Type: "level", ID: "0"}); !errors.Is(err, ErrScopeCycle) {
+		t.Errorf("ScopeAncestors() too deep error = %v, want ErrScopeCycle", err)
+	}
+}
+
+func TestHTTPScopeResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/scopes/project/acme%2Fweb/parent":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(core.SuccessResponse{Data: orgAcme})
+		case "/scopes/org/acme/parent":
+			core.RespondError(w, http.StatusNotFound, "No parent")
+		default:
+			core.RespondError(w, http.StatusInternalServerError, "Unexpected path "+r.URL.EscapedPath())
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	resolvers := NewScopeResolvers(NewTableScopeResolver(newTestScopeParentRepo(resourceWeb, projectWeb)))
+	resolvers.Register("project", NewHTTPScopeResolver(srv.URL, client.WithRetryPolicy(client.NoRetry)))
+	resolvers.Register("org", NewHTTPScopeResolver(srv.URL, client.WithRetryPolicy(client.NoRetry)))
+
+	got, err := ScopeAncestors(ctx, resolvers, resourceWeb)
+	if err != nil {
+		t.Fatalf("ScopeAncestors() error = %v", err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]Scope{projectWeb, orgAcme}) {
+		t.Errorf("ScopeAncestors() = %v, want [%v %v]", got, projectWeb, orgAcme)
+	}
+
+	if _, err := resolvers.Parent(ctx, Scope{Type: "org", ID: "broken"}); err == nil {
+		t.Error("Parent() error = nil for a failing owner, want it reported")
+	}
+}
+
+func TestInheritingGrantRepoListByScope(t *testing.T) {
+	ctx := context.Background()
+	grantRepo := &testGrantRepo{}
+	repo := NewInheritingGrantRepo(grantRepo, NewTableScopeResolver(newTestScopeParentRepo(
+		projectWeb, orgAcme,
+		projectAPI, orgAcme,
+	)))
+
+	onOrg := &Grant{UserID: uuid.New(), GrantType: GrantTypeRole, Value: "r", Scope: orgAcme, Status: authpkg.UserStatusActive}
+	onWeb := &Grant{UserID: uuid.New(), GrantType: GrantTypeRole, Value: "r", Scope: projectWeb, Status: authpkg.UserStatusActive}
+	onAPI := &Grant{UserID: uuid.New(), GrantType: GrantTypeRole, Value: "r", Scope: projectAPI, Status: authpkg.UserStatusActive}
+	global := &Grant{UserID: uuid.New(), GrantType: GrantTypeRole, Value: "r", Scope: GlobalScope, Status: authpkg.UserStatusActive}
+	for _, grant := range []*Grant{onOrg, onWeb, onAPI, global} {
+		grantRepo.Create(ctx, grant)
+	}
+
+	grants, err := repo.ListByScope(ctx, projectWeb)
+	if err != nil {
+		t.Fatalf("ListByScope() error = %v", err)
+	}
+
+	got := make(map[uuid.UUID]bool)
+	for _, grant := range grants {
+		got[grant.ID] = true
+	}
+	if len(grants) != 3 || !got[onWeb.ID] || !got[onOrg.ID] || !got[global.ID] {
+		t.Errorf("ListByScope(project) = %d grants, want its own, the org one and the global one", len(grants))
+	}
+}
+
+func TestPolicyEngineScopeHierarchy(t *testing.T) {
+	ctx := context.Background()
+	grantRepo := &testGrantRepo{}
+	roleRepo := &testRoleRepo{}
+	scopes := newTestScopeParentRepo(
+		resourceWeb, projectWeb,
+		projectWeb, orgAcme,
+		projectAPI, orgAcme,
+	)
+	engine := NewPolicyEngine(roleRepo, grantRepo, NewPolicyVersion(nil), NewTableScopeResolver(scopes))
+
+	viewer := &Role{Name: "viewer", Permissions: []string{"sites:read"}, Status: authpkg.UserStatusActive}
+	roleRepo.Create(ctx, viewer)
+	libRoles := []authpkg.Role{viewer.authRole()}
+
+	tests := []struct {
+		name       string
+		grantType  GrantType
+		value      string
+		grantScope Scope
+		permission string
+		scope      Scope
+		expected   bool
+	}{
+		{"org grant on project", GrantTypePermission, "sites:read", orgAcme, "sites:read", projectWeb, true},
+		{"org grant on resource", GrantTypePermission, "sites:read", orgAcme, "sites:read", resourceWeb, true},
+		{"project grant on resource", GrantTypePermission, "sites:read", projectWeb, "sites:read", resourceWeb, true},
+		{"project grant on sibling", GrantTypePermission, "sites:read", projectAPI, "sites:read", resourceWeb, false},
+		{"project grant on org", GrantTypePermission, "sites:read", projectWeb, "sites:read", orgAcme, false},
+		{"other org", GrantTypePermission, "sites:read", orgOther, "sites:read", projectWeb, false},
+		{"org role on resource", GrantTypeRole, viewer.ID.String(), orgAcme, "sites:read", resourceWeb, true},
+		{"org role other permission", GrantTypeRole, viewer.ID.String(), orgAcme, "sites:write", resourceWeb, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uuid.New()
+			grant := &Grant{
+				UserID:    userID,
+				GrantType: tt.grantType,
+				Value:     tt.value,
+				Scope:     tt.grantScope,
+				Status:    authpkg.UserStatusActive,
+			}
+			grantRepo.Create(ctx, grant)
+
+			got, err := engine.Has(ctx, userID, tt.permission, tt.scope)
+			if err != nil {
+				t.Fatalf("Has() error = %v", err)
+			}
+
+			ancestors, _ := ScopeAncestors(ctx, NewTableScopeResolver(scopes), tt.scope)
+			libAncestors := make([]authpkg.Scope, 0, len(ancestors))
+			for _, ancestor := range ancestors {
+				libAncestors = append(libAncestors, authpkg.Scope{Type: ancestor.Type, ID: ancestor.ID})
+			}
+			libGrants := []authpkg.Grant{{
+				ID:        grant.ID,
+				UserID:    userID,
+				GrantType: authpkg.GrantType(tt.grantType),
+				Value:     tt.value,
+				Scope:     authpkg.Scope{Type: tt.grantScope.Type, ID: tt.grantScope.ID},
+			}}
+			libScope := authpkg.Scope{Type: tt.scope.Type, ID: tt.scope.ID}
+			lib := authpkg.EvaluatePermissionsWithin(libGrants, libRoles, tt.permission, libScope, libAncestors, time.Now())
+
+			if got != tt.expected || lib != tt.expected {
+				t.Errorf("Has() = %v, auth.EvaluatePermissionsWithin() = %v, want %v", got, lib, tt.expected)
+			}
+
+			perms, err := engine.GetUserPermissions(ctx, userID, tt.scope)
+			if err != nil {
+				t.Fatalf("GetUserPermissions() error = %v", err)
+			}
+			if authpkg.ContainsPermission(perms, tt.permission) != tt.expected {
+				t.Errorf("GetUserPermissions() = %v, want %s included %v", perms, tt.permission, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPolicyEngineCachesScopeAncestry(t *testing.T) {
+	ctx := context.Background()
+	grantRepo := &testGrantRepo{}
+	version := NewPolicyVersion(nil)
+	table := newTestScopeParentRepo(projectWeb, orgAcme)
+	scopes := NewVersionedScopeParentRepo(table, version)
+	engine := NewPolicyEngine(&testRoleRepo{}, grantRepo, version, NewTableScopeResolver(table))
+
+	userID := uuid.New()
+	grantRepo.Create(ctx, &Grant{
+		UserID:    userID,
+		GrantType: GrantTypePermission,
+		Value:     "sites:read",
+		Scope:     orgAcme,
+		Status:    authpkg.UserStatusActive,
+	})
+
+	has := func(scope Scope) bool {
+		t.Helper()
+		allowed, err := engine.Has(ctx, userID, "sites:read", scope)
+		if err != nil {
+			t.Fatalf("Has() error = %v", err)
+		}
+		return allowed
+	}
+
+	if !has(projectWeb) || !has(projectWeb) {
+		t.Fatal("Has() = false on a project of the org, want the org grant inherited")
+	}
+	if table.gets != 2 {
+		t.Errorf("resolver called %d times, want the ancestry of the project resolved once", table.gets)
+	}
+
+	// Direct matches do not resolve ancestors
+	table.gets = 0
+	has(orgAcme)
+	if table.gets != 0 {
+		t.Errorf("resolver called %d times for a direct match, want 0", table.gets)
+	}
+
+	if err := scopes.Delete(ctx, projectWeb); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if has(projectWeb) {
+		t.Error("Has() = true after the project left the org, want the cached ancestry dropped")
+	}
+
+	if err := scopes.Save(ctx, &ScopeParent{Scope: projectWeb, Parent: orgAcme}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if !has(projectWeb) {
+		t.Error("Has() = false after the project was placed back in the org")
+	}
+
+	loop := NewPolicyEngine(&testRoleRepo{}, grantRepo, version, NewTableScopeResolver(newTestScopeParentRepo(projectWeb, orgOther, orgOther, projectWeb)))
+	if _, err := loop.Has(ctx, userID, "sites:read", projectWeb); !errors.Is(err, ErrScopeCycle) {
+		t.Errorf("Has() with a scope loop error = %v, want ErrScopeCycle", err)
+	}
+}
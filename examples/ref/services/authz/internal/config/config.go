@@ -18,6 +18,7 @@ type Config struct {
 	Server   ServerConfig   `koanf:"server"`
 	Database DatabaseConfig `koanf:"database"`
 	Auth     AuthConfig     `koanf:"auth"`
+	Scopes   ScopesConfig   `koanf:"scopes"`
 }
 
 type ServerConfig struct {
@@ -42,6 +43,19 @@ type AuthConfig struct {
 	TokenPublicKey  string `koanf:"token.public.key"`
 }
 
+// ScopesConfig lists the services owning scope types. The parents of their
+// scopes are asked to them; other scope types use the parent lookup table.
+type ScopesConfig struct {
+	Owners []ScopeOwnerConfig `koanf:"owners"`
+}
+
+// ScopeOwnerConfig is a service answering GET {url}/scopes/{type}/{id}/parent
+// for the scopes of Type
+type ScopeOwnerConfig struct {
+	Type string `koanf:"type"`
+	URL  string `koanf:"url"`
+}
+
 func New() *Config {
 	return &Config{
 		Server: ServerConfig{
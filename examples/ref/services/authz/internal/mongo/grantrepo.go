@@ -79,6 +79,14 @@ func (r *GrantMongoRepo) Stop(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheck pings the MongoDB client.
+func (r *GrantMongoRepo) HealthCheck(ctx context.Context) error {
+	if r.client == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	return r.client.Ping(ctx, nil)
+}
+
 // createIndexes creates necessary indexes for the grants collection
 func (r *GrantMongoRepo) createIndexes(ctx context.Context) error {
 	// Index on user_id (primary lookup)
@@ -0,0 +1,77 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// policyVersionID is the ID of the single policy version document
+const policyVersionID = "policy"
+
+// PolicyVersionMongoRepo implements the PolicyVersionRepo interface using the
+// database connected by the grant repository.
+type PolicyVersionMongoRepo struct {
+	grants     *GrantMongoRepo
+	collection *mongo.Collection
+}
+
+// NewPolicyVersionMongoRepo creates a new MongoDB repository for the policy
+// version. It must be started after grants.
+func NewPolicyVersionMongoRepo(grants *GrantMongoRepo) *PolicyVersionMongoRepo {
+	return &PolicyVersionMongoRepo{
+		grants: grants,
+	}
+}
+
+// Start initializes the policy_version collection.
+func (r *PolicyVersionMongoRepo) Start(ctx context.Context) error {
+	if r.grants.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.grants.db.Collection("policy_version")
+
+	return nil
+}
+
+// policyVersionDocument represents the MongoDB document structure
+type policyVersionDocument struct {
+	ID      string `bson:"_id"`
+	Version int64  `bson:"version"`
+}
+
+// Get retrieves the stored policy version, zero when none was stored yet.
+func (r *PolicyVersionMongoRepo) Get(ctx context.Context) (int64, error) {
+	var doc policyVersionDocument
+	err := r.collection.FindOne(ctx, bson.M{"_id": policyVersionID}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("could not get policy version: %w", err)
+	}
+
+	return doc.Version, nil
+}
+
+// Increment atomically adds one to the stored policy version and returns it.
+func (r *PolicyVersionMongoRepo) Increment(ctx context.Context) (int64, error) {
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	var doc policyVersionDocument
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": policyVersionID},
+		bson.M{"$inc": bson.M{"version": int64(1)}},
+		opts,
+	).Decode(&doc)
+	if err != nil {
+		return 0, fmt.Errorf("error increment policy version: %w", err)
+	}
+
+	return doc.Version, nil
+}
@@ -0,0 +1,159 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/adrianpk/hatmax-ref/services/authz/internal/authz"
+)
+
+// ScopeParentMongoRepo implements the ScopeParentRepo interface using the
+// database connected by the grant repository.
+type ScopeParentMongoRepo struct {
+	grants     *GrantMongoRepo
+	collection *mongo.Collection
+}
+
+// NewScopeParentMongoRepo creates a new MongoDB repository for the scope
+// parent lookup table. It must be started after grants.
+func NewScopeParentMongoRepo(grants *GrantMongoRepo) *ScopeParentMongoRepo {
+	return &ScopeParentMongoRepo{
+		grants: grants,
+	}
+}
+
+// Start initializes the scope_parents collection.
+func (r *ScopeParentMongoRepo) Start(ctx context.Context) error {
+	if r.grants.db == nil {
+		return fmt.Errorf("mongo client is not connected")
+	}
+	r.collection = r.grants.db.Collection("scope_parents")
+
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "parent.type", Value: 1}, {Key: "parent.id", Value: 1}}},
+	}
+
+	if _, err := r.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("cannot create indexes: %w", err)
+	}
+
+	return nil
+}
+
+// scopeDocument represents a scope in MongoDB documents.
+type scopeDocument struct {
+	Type string `bson:"type"`
+	ID   string `bson:"id"`
+}
+
+// scopeParentDocument represents the MongoDB document structure. The ID is
+// the scope itself, so each scope has a single parent.
+type scopeParentDocument struct {
+	ID        scopeDocument `bson:"_id"`
+	Parent    scopeDocument `bson:"parent"`
+	CreatedAt time.Time     `bson:"created_at"`
+	UpdatedAt time.Time     `bson:"updated_at"`
+}
+
+// Save sets the parent of a scope, replacing the previous one.
+func (r *ScopeParentMongoRepo) Save(ctx context.Context, entry *authz.ScopeParent) error {
+	if entry == nil {
+		return fmt.Errorf("scope parent cannot be nil")
+	}
+
+	now := time.Now()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = now
+	}
+	entry.UpdatedAt = now
+
+	filter := bson.M{"_id": toScopeDocument(entry.Scope)}
+	update := bson.M{
+		"$set": bson.M{
+			"parent":     toScopeDocument(entry.Parent),
+			"updated_at": entry.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{
+			"created_at": entry.CreatedAt,
+		},
+	}
+
+	_, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error save scope parent: %w", err)
+	}
+
+	return nil
+}
+
+// Get retrieves the parent entry of a scope from MongoDB.
+func (r *ScopeParentMongoRepo) Get(ctx context.Context, scope authz.Scope) (*authz.ScopeParent, error) {
+	var doc scopeParentDocument
+	err := r.collection.FindOne(ctx, bson.M{"_id": toScopeDocument(scope)}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get scope parent: %w", err)
+	}
+
+	return fromScopeParentDocument(&doc), nil
+}
+
+// Delete removes the parent of a scope, making it a root.
+func (r *ScopeParentMongoRepo) Delete(ctx context.Context, scope authz.Scope) error {
+	if _, err := r.collection.DeleteOne(ctx, bson.M{"_id": toScopeDocument(scope)}); err != nil {
+		return fmt.Errorf("error delete scope parent: %w", err)
+	}
+
+	return nil
+}
+
+// ListByParent retrieves the entries of the children of a scope.
+func (r *ScopeParentMongoRepo) ListByParent(ctx context.Context, parent authz.Scope) ([]*authz.ScopeParent, error) {
+	filter := bson.M{
+		"parent.type": parent.Type,
+		"parent.id":   parent.ID,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id.type", Value: 1}, {Key: "_id.id", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error query scope children: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var entries []*authz.ScopeParent
+
+	for cursor.Next(ctx) {
+		var doc scopeParentDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("error decode scope parent document: %w", err)
+		}
+		entries = append(entries, fromScopeParentDocument(&doc))
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor error: %w", err)
+	}
+
+	return entries, nil
+}
+
+func toScopeDocument(scope authz.Scope) scopeDocument {
+	return scopeDocument{Type: scope.Type, ID: scope.ID}
+}
+
+func fromScopeParentDocument(doc *scopeParentDocument) *authz.ScopeParent {
+	return &authz.ScopeParent{
+		Scope:     authz.Scope{Type: doc.ID.Type, ID: doc.ID.ID},
+		Parent:    authz.Scope{Type: doc.Parent.Type, ID: doc.Parent.ID},
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+	}
+}
@@ -60,6 +60,14 @@ func (r *UserSQLiteRepo) Stop(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheck pings the database.
+func (r *UserSQLiteRepo) HealthCheck(ctx context.Context) error {
+	if r.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	return r.db.PingContext(ctx)
+}
+
 // createUsersTable creates the users table with proper schema
 func (r *UserSQLiteRepo) createUsersTable(ctx context.Context) error {
 	query := `
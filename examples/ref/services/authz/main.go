@@ -36,7 +36,13 @@ func main() {
 		Cfg: cfg,
 	}
 
+	middlewares, err := core.NewMiddlewareStack(core.DefaultMiddlewareOptions())
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+
 	router := chi.NewRouter()
+	router.Use(middlewares.Handler)
 
 	var deps []any
 
@@ -47,19 +53,53 @@ func main() {
 	grantRepo := mongo.NewGrantMongoRepo(xparams)
 	deps = append(deps, grantRepo)
 
+	scopeParentRepo := mongo.NewScopeParentMongoRepo(grantRepo)
+	deps = append(deps, scopeParentRepo)
+
+	policyVersionRepo := mongo.NewPolicyVersionMongoRepo(grantRepo)
+	deps = append(deps, policyVersionRepo)
+
+	// Role and grant writes bump the policy version polled by services, kept
+	// in the database so all replicas share it
+	policyVersion := authz.NewPolicyVersion(policyVersionRepo)
+	deps = append(deps, policyVersion)
+
+	versionedRoleRepo := authz.NewVersionedRoleRepo(roleRepo, policyVersion)
+	versionedGrantRepo := authz.NewVersionedGrantRepo(grantRepo, policyVersion)
+	versionedScopeParentRepo := authz.NewVersionedScopeParentRepo(scopeParentRepo, policyVersion)
+
+	// Scope trees: owning services resolve the parents of their scope types,
+	// the lookup table those of any other type
+	scopeResolver := authz.NewScopeResolvers(authz.NewTableScopeResolver(scopeParentRepo))
+	for _, owner := range cfg.Scopes.Owners {
+		scopeResolver.Register(owner.Type, authz.NewHTTPScopeResolver(owner.URL))
+	}
+
 	// Policy engine setup
-	policyEngine := authz.NewPolicyEngine(roleRepo, grantRepo)
+	policyEngine := authz.NewPolicyEngine(roleRepo, grantRepo, policyVersion, scopeResolver)
 
 	// Handler setup
-	roleHandler := authz.NewRoleHandler(roleRepo, xparams)
+	roleHandler := authz.NewRoleHandler(versionedRoleRepo, xparams)
 	deps = append(deps, roleHandler)
 
-	grantHandler := authz.NewGrantHandler(grantRepo, roleRepo, xparams)
+	grantHandler := authz.NewGrantHandler(authz.NewInheritingGrantRepo(versionedGrantRepo, scopeResolver), roleRepo, xparams)
 	deps = append(deps, grantHandler)
 
+	scopeHandler := authz.NewScopeHandler(versionedScopeParentRepo, scopeResolver, xparams)
+	deps = append(deps, scopeHandler)
+
 	policyHandler := authz.NewPolicyHandler(policyEngine, xparams)
 	deps = append(deps, policyHandler)
 
+	routeCatalog, err := core.NewRouteCatalog(nil)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+	deps = append(deps, routeCatalog)
+
+	health := core.NewHealth()
+	deps = append(deps, health)
+
 	starts, stops := core.Setup(ctx, router, deps...)
 
 	if err := core.Start(ctx, starts, stops); err != nil {
@@ -70,7 +110,7 @@ func main() {
 	logger.Infof("%s(%s) started successfully", name, version)
 
 	go func() {
-		core.Serve(router, core.ServerOpts{Port: cfg.Server.Port}, stops, logger)
+		core.Serve(router, core.ServerOpts{Port: cfg.Server.Port, Health: health}, stops, logger)
 	}()
 
 	stop := make(chan os.Signal, 1)
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/env"
@@ -19,6 +20,7 @@ type Config struct {
 	Log      LogConfig      `koanf:"log"`
 	Server   ServerConfig   `koanf:"server"`
 	Database DatabaseConfig `koanf:"database"`
+	Auth     AuthConfig     `koanf:"auth"`
 }
 
 type ServerConfig struct {
@@ -33,6 +35,46 @@ type LogConfig struct {
 	Level string `koanf:"level"`
 }
 
+// AuthConfig selects how bearer tokens are validated.
+// In production mode tokens are verified with Keys.Public or, when empty,
+// with the keys fetched from Keys.URL (authn /authn/keys), tokens of
+// sessions listed at Revocations.URL are rejected, and route permissions
+// are evaluated by the authz service at Authz.URL. API keys of service
+// accounts are accepted in both modes when APIKeys.URL is set.
+type AuthConfig struct {
+	Mode         string                `koanf:"mode"` // development | production
+	Audiences    []string              `koanf:"audiences"`
+	Issuer       string                `koanf:"issuer"` // Expected iss, empty skips the check
+	Keys         AuthKeysConfig        `koanf:"keys"`
+	Revocations  AuthRevocationsConfig `koanf:"revocations"`
+	APIKeys      AuthAPIKeysConfig     `koanf:"apikeys"`
+	AuthzVersion int                   `koanf:"authzversion"` // Minimum authz_ver accepted
+	Authz        AuthzConfig           `koanf:"authz"`
+}
+
+type AuthKeysConfig struct {
+	Public []string      `koanf:"public"` // Base64 Ed25519 public keys
+	URL    string        `koanf:"url"`
+	TTL    time.Duration `koanf:"ttl"`
+}
+
+type AuthRevocationsConfig struct {
+	URL string        `koanf:"url"` // Empty disables revocation checks
+	TTL time.Duration `koanf:"ttl"` // How long the revocation list is cached
+}
+
+type AuthAPIKeysConfig struct {
+	URL string        `koanf:"url"` // Empty rejects API keys
+	TTL time.Duration `koanf:"ttl"` // How long an introspected key is trusted
+}
+
+type AuthzConfig struct {
+	URL          string        `koanf:"url"`          // Base URL of the authz service
+	CacheTTL     time.Duration `koanf:"cachettl"`     // How long permission checks are cached
+	Timeout      time.Duration `koanf:"timeout"`      // Timeout of each authz call
+	PollInterval time.Duration `koanf:"pollinterval"` // Policy version polling, 0 disables it
+}
+
 func New() *Config {
 	return &Config{
 		Server: ServerConfig{
@@ -44,6 +86,26 @@ func New() *Config {
 		Log: LogConfig{
 			Level: "info",
 		},
+		Auth: AuthConfig{
+			Mode:      "development",
+			Audiences: []string{"todo", "session"},
+			Issuer:    "http://localhost:8082",
+			Keys: AuthKeysConfig{
+				TTL: 5 * time.Minute,
+			},
+			Revocations: AuthRevocationsConfig{
+				TTL: 30 * time.Second,
+			},
+			APIKeys: AuthAPIKeysConfig{
+				TTL: 30 * time.Second,
+			},
+			Authz: AuthzConfig{
+				URL:          "http://localhost:8083",
+				CacheTTL:     1 * time.Minute,
+				Timeout:      2 * time.Second,
+				PollInterval: 30 * time.Second,
+			},
+		},
 	}
 }
 
@@ -60,6 +122,7 @@ func LoadConfig(path, envPrefix string, args []string) (*Config, error) {
 	fs.String("server.port", ":8085", "Server listen address")
 	fs.String("database.path", "./app.db", "Path to the SQLite database file")
 	fs.String("log.level", "info", "Log level (debug, info, error)")
+	fs.String("auth.mode", "development", "Auth mode (development, production)")
 	fs.Parse(args[1:])
 
 	raw, err := os.ReadFile(path)
@@ -25,6 +25,11 @@ func NewListMongoRepo(db *mongo.Database) *ListMongoRepo {
 	}
 }
 
+// HealthCheck pings the MongoDB client.
+func (r *ListMongoRepo) HealthCheck(ctx context.Context) error {
+	return r.collection.Database().Client().Ping(ctx, nil)
+}
+
 // Create creates a new List aggregate in MongoDB.
 // The entire aggregate (root + children) is stored as a single document.
 func (r *ListMongoRepo) Create(ctx context.Context, aggregate *todo.List) error {
@@ -56,6 +56,14 @@ func (r *ListSQLiteRepo) Stop(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheck pings the database.
+func (r *ListSQLiteRepo) HealthCheck(ctx context.Context) error {
+	if r.db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	return r.db.PingContext(ctx)
+}
+
 // Create creates a new List aggregate in SQLite.
 // This involves inserting the root and all child entities in a single transaction.
 func (r *ListSQLiteRepo) Create(ctx context.Context, aggregate *todo.List) error {
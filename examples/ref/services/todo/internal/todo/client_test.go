@@ -0,0 +1,160 @@
+package todo_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/adrianpk/hatmax-ref/pkg/client"
+	todoclient "github.com/adrianpk/hatmax-ref/pkg/client/todo"
+	"github.com/adrianpk/hatmax-ref/pkg/lib/core"
+	"github.com/adrianpk/hatmax-ref/services/todo/internal/config"
+	"github.com/adrianpk/hatmax-ref/services/todo/internal/todo"
+)
+
+// memRepo is an in-memory store satisfying the generated repo and service interfaces.
+type memRepo[T any] struct {
+	mu    sync.Mutex
+	id    func(*T) uuid.UUID
+	items map[uuid.UUID]*T
+	order []uuid.UUID
+}
+
+func newMemRepo[T any](id func(*T) uuid.UUID) *memRepo[T] {
+	return &memRepo[T]{id: id, items: map[uuid.UUID]*T{}}
+}
+
+func (r *memRepo[T]) Create(ctx context.Context, v *T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.id(v)
+	r.items[id] = v
+	r.order = append(r.order, id)
+	return nil
+}
+
+func (r *memRepo[T]) Get(ctx context.Context, id uuid.UUID) (*T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.items[id], nil
+}
+
+func (r *memRepo[T]) Save(ctx context.Context, v *T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[r.id(v)] = v
+	return nil
+}
+
+func (r *memRepo[T]) Update(ctx context.Context, v *T) error {
+	return r.Save(ctx, v)
+}
+
+func (r *memRepo[T]) Delete(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.items, id)
+	return nil
+}
+
+func (r *memRepo[T]) List(ctx context.Context) ([]*T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var all []*T
+	for _, id := range r.order {
+		if v, ok := r.items[id]; ok {
+			all = append(all, v)
+		}
+	}
+	return all, nil
+}
+
+func newTestClient(t *testing.T) *todoclient.Client {
+	t.Helper()
+
+	xparams := config.XParams{Log: core.NewNoopLogger()}
+	router := chi.NewRouter()
+	todo.NewListHandler(newMemRepo(func(v *todo.List) uuid.UUID { return v.ID }), xparams).RegisterRoutes(router)
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return todoclient.New(srv.URL, client.WithRetryPolicy(client.NoRetry))
+}
+
+func TestClientListLifecycle(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	created, err := c.CreateList(ctx, todoclient.ListInput{Description: "sample", Name: "sample"})
+	if err != nil {
+		t.Fatalf("CreateList() error = %v", err)
+	}
+	if created.ID == "" {
+		t.Fatal("CreateList() returned no ID")
+	}
+
+	got, err := c.GetList(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetList() error = %v", err)
+	}
+	if got.ID != created.ID {
+		t.Errorf("GetList() ID = %s, want %s", got.ID, created.ID)
+	}
+
+	all, err := c.GetAllLists(ctx)
+	if err != nil {
+		t.Fatalf("GetAllLists() error = %v", err)
+	}
+	if len(all) != 1 {
+		t.Errorf("GetAllLists() returned %d items, want 1", len(all))
+	}
+
+	if _, err := c.UpdateList(ctx, created.ID, todoclient.ListInput{Description: "sample", Name: "sample"}); err != nil {
+		t.Fatalf("UpdateList() error = %v", err)
+	}
+
+	item, err := c.AddItemToList(ctx, created.ID, todoclient.ItemInput{Done: true, Text: "sample"})
+	if err != nil {
+		t.Fatalf("AddItemToList() error = %v", err)
+	}
+	if _, err := c.UpdateItemInList(ctx, created.ID, item.ID, todoclient.ItemInput{Done: true, Text: "sample"}); err != nil {
+		t.Fatalf("UpdateItemInList() error = %v", err)
+	}
+	if err := c.RemoveItemFromList(ctx, created.ID, item.ID); err != nil {
+		t.Fatalf("RemoveItemFromList() error = %v", err)
+	}
+
+	tag, err := c.AddTagToList(ctx, created.ID, todoclient.TagInput{Color: "sample", Name: "sample"})
+	if err != nil {
+		t.Fatalf("AddTagToList() error = %v", err)
+	}
+	if _, err := c.UpdateTagInList(ctx, created.ID, tag.ID, todoclient.TagInput{Color: "sample", Name: "sample"}); err != nil {
+		t.Fatalf("UpdateTagInList() error = %v", err)
+	}
+	if err := c.RemoveTagFromList(ctx, created.ID, tag.ID); err != nil {
+		t.Fatalf("RemoveTagFromList() error = %v", err)
+	}
+
+	if err := c.DeleteList(ctx, created.ID); err != nil {
+		t.Fatalf("DeleteList() error = %v", err)
+	}
+
+	if _, err := c.GetList(ctx, created.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("GetList() after delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClientListInvalidID(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.GetList(context.Background(), "not-a-uuid")
+	if !errors.Is(err, client.ErrBadRequest) {
+		t.Errorf("GetList() error = %v, want ErrBadRequest", err)
+	}
+}
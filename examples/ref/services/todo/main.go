@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	_ "embed"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -20,6 +22,12 @@ const (
 	version = "0.1.0"
 )
 
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+//go:embed routes.json
+var routeMetadata []byte
+
 func main() {
 	cfg, err := config.LoadConfig("config.yaml", "APP", os.Args)
 	if err != nil {
@@ -36,14 +44,80 @@ func main() {
 		Cfg: cfg,
 	}
 
+	middlewares, err := core.NewMiddlewareStack(
+		core.MiddlewareOptions{
+			Enabled: []string{"recoverer", "request_id", "real_ip", "logger", "timeout", "cors", "strip_slashes"},
+			Timeout: 30 * time.Second,
+			CORS: core.CORSOptions{
+				AllowedOrigins: []string{"http://localhost:5173"},
+			},
+		},
+		core.MiddlewareGroup{
+			Path: "/lists",
+			Options: core.MiddlewareOptions{
+				Enabled: []string{"recoverer", "request_id", "real_ip", "logger", "timeout", "cors", "body_limit", "strip_slashes"},
+				Timeout: 30 * time.Second,
+				CORS: core.CORSOptions{
+					AllowedOrigins: []string{"http://localhost:5173"},
+				},
+				BodyLimit: 1048576,
+			},
+		},
+	)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+
 	router := chi.NewRouter()
+	router.Use(middlewares.Handler)
 
 	var deps []any
+
+	authenticator, err := core.NewAuthenticator(core.AuthOptions{
+		Mode:            cfg.Auth.Mode,
+		Audiences:       cfg.Auth.Audiences,
+		Issuer:          cfg.Auth.Issuer,
+		PublicKeys:      cfg.Auth.Keys.Public,
+		KeysURL:         cfg.Auth.Keys.URL,
+		KeysTTL:         cfg.Auth.Keys.TTL,
+		RevocationsURL:  cfg.Auth.Revocations.URL,
+		RevocationsTTL:  cfg.Auth.Revocations.TTL,
+		APIKeysURL:      cfg.Auth.APIKeys.URL,
+		APIKeysTTL:      cfg.Auth.APIKeys.TTL,
+		MinAuthzVersion: cfg.Auth.AuthzVersion,
+	})
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+	requireAuth := core.AuthMiddleware(authenticator, logger)
+
+	authorizer, err := core.NewAuthorizer(core.AuthzOptions{
+		Mode:         cfg.Auth.Mode,
+		URL:          cfg.Auth.Authz.URL,
+		CacheTTL:     cfg.Auth.Authz.CacheTTL,
+		Timeout:      cfg.Auth.Authz.Timeout,
+		PollInterval: cfg.Auth.Authz.PollInterval,
+	}, routeMetadata, logger)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+	deps = append(deps, authorizer)
 	ListRepo := sqlite.NewListSQLiteRepo(xparams)
 	deps = append(deps, ListRepo)
 
 	ListHandler := todo.NewListHandler(ListRepo, xparams)
-	deps = append(deps, ListHandler)
+	deps = append(deps, core.WithMiddlewares(ListHandler, requireAuth, authorizer.Middleware))
+
+	deps = append(deps, core.NewOpenAPIHandler(openAPISpec, true))
+
+	routeCatalog, err := core.NewRouteCatalog(routeMetadata)
+	if err != nil {
+		log.Fatalf("Cannot setup %s(%s): %v", name, version, err)
+	}
+	deps = append(deps, routeCatalog)
+
+	health := core.NewHealth()
+	deps = append(deps, health)
 
 	starts, stops := core.Setup(ctx, router, deps...)
 
@@ -55,7 +129,7 @@ func main() {
 	logger.Infof("%s(%s) started successfully", name, version)
 
 	go func() {
-		core.Serve(router, core.ServerOpts{Port: cfg.Server.Port}, stops, logger)
+		core.Serve(router, core.ServerOpts{Port: cfg.Server.Port, Health: health}, stops, logger)
 	}()
 
 	stop := make(chan os.Signal, 1)
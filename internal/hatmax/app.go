@@ -27,6 +27,10 @@ func NewApp(templateFS fs.FS) *cli.App {
 						Aliases: []string{"m"},
 						Usage:   "Go module path for generated code (auto-inferred if not specified)",
 					},
+					&cli.StringSliceFlag{
+						Name:  "clients",
+						Usage: "Additional clients to generate for frontend consumers (ts)",
+					},
 					&cli.BoolFlag{
 						Name:  "dev",
 						Usage: "Enable development mode",
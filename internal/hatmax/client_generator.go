@@ -0,0 +1,362 @@
+package hatmax
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// ClientGenerator renders the typed Go client of a generated service into
+// pkg/client/<service> and a test exercising it against the service handlers.
+type ClientGenerator struct {
+	Config         *Config
+	OutputDir      string // Monorepo root
+	ServiceName    string
+	Service        *Service
+	TemplateFS     fs.FS
+	ClientTmpl     *template.Template
+	ClientTestTmpl *template.Template
+}
+
+// ClientTemplateData holds the data for the service client template.
+type ClientTemplateData struct {
+	PackageName        string
+	ServiceName        string
+	ModulePath         string
+	MonorepoModulePath string
+	ClientModulePath   string
+	NeedsTime          bool
+	NeedsPathParams    bool
+	Types              []ClientTypeData
+	Methods            []ClientMethodData
+	Aggregates         []ClientResourceData
+	Models             []ClientResourceData
+}
+
+// ClientTypeData describes a resource struct and its input variant.
+type ClientTypeData struct {
+	Name   string
+	Fields []ClientFieldData
+	Input  []ClientFieldData
+}
+
+// ClientFieldData describes a single struct field.
+type ClientFieldData struct {
+	Name    string
+	Type    string
+	JSONTag string
+}
+
+// ClientMethodData describes a typed client method bound to a route.
+type ClientMethodData struct {
+	Name        string
+	HTTPMethod  string
+	MethodConst string
+	Path        string
+	PathExpr    string
+	Params      []string
+	Input       string
+	Output      string
+	List        bool
+}
+
+// ClientResourceData drives the generated client test.
+type ClientResourceData struct {
+	Name        string
+	Plural      string
+	Lower       string
+	SampleInput string
+	Children    []ClientResourceData
+}
+
+func NewClientGenerator(config *Config, outputDir, serviceName string, service *Service, templateFS fs.FS) (*ClientGenerator, error) {
+	cg := &ClientGenerator{
+		Config:      config,
+		OutputDir:   outputDir,
+		ServiceName: serviceName,
+		Service:     service,
+		TemplateFS:  templateFS,
+	}
+
+	if err := cg.loadTemplates(); err != nil {
+		return nil, fmt.Errorf("failed to load client templates: %w", err)
+	}
+
+	return cg, nil
+}
+
+func (cg *ClientGenerator) loadTemplates() error {
+	var err error
+	cg.ClientTmpl, err = template.ParseFS(cg.TemplateFS, "assets/templates/client_service.tmpl")
+	if err != nil {
+		return fmt.Errorf("failed to parse client template: %w", err)
+	}
+
+	cg.ClientTestTmpl, err = template.ParseFS(cg.TemplateFS, "assets/templates/client_service_test.tmpl")
+	if err != nil {
+		return fmt.Errorf("failed to parse client test template: %w", err)
+	}
+
+	return nil
+}
+
+// Generate writes pkg/client/<service>/client.go and the service side client test.
+func (cg *ClientGenerator) Generate() error {
+	data, err := BuildClientTemplateData(cg.ServiceName, *cg.Service)
+	if err != nil {
+		return err
+	}
+	data.ModulePath = cg.Config.ModulePath
+	data.MonorepoModulePath = cg.Config.MonorepoModulePath
+	data.ClientModulePath = clientModulePath(cg.OutputDir, *cg.Config)
+
+	clientPath := filepath.Join(cg.OutputDir, "pkg", "client", cg.ServiceName, "client.go")
+	if err := renderGoFile(cg.ClientTmpl, clientPath, data); err != nil {
+		return fmt.Errorf("cannot generate client for service %s: %w", cg.ServiceName, err)
+	}
+	logCreated(clientPath)
+
+	testPath := filepath.Join(cg.OutputDir, "services", cg.ServiceName, "internal", cg.ServiceName, "client_test.go")
+	if err := renderGoFile(cg.ClientTestTmpl, testPath, data); err != nil {
+		return fmt.Errorf("cannot generate client test for service %s: %w", cg.ServiceName, err)
+	}
+	logCreated(testPath)
+
+	return nil
+}
+
+// BuildClientTemplateData maps the service routes and schemas to client types and methods.
+func BuildClientTemplateData(serviceName string, service Service) (*ClientTemplateData, error) {
+	data := &ClientTemplateData{
+		PackageName: serviceName,
+		ServiceName: serviceName,
+	}
+
+	for _, aggName := range sortedAggregateNames(service) {
+		agg := service.Aggregates[aggName]
+		typ := ClientTypeData{Name: aggName}
+		typ.Fields = append(typ.Fields, ClientFieldData{Name: "ID", Type: "string", JSONTag: "id"})
+		inputs := clientFields(agg.Fields)
+		typ.Fields = append(typ.Fields, inputs...)
+		typ.Input = inputs
+		if agg.VersionField != "" {
+			typ.Fields = append(typ.Fields, ClientFieldData{Name: strings.Title(agg.VersionField), Type: "int", JSONTag: agg.VersionField})
+		}
+		if agg.Audit {
+			typ.Fields = append(typ.Fields, clientAuditFields()...)
+			data.NeedsTime = true
+		}
+
+		resource := ClientResourceData{
+			Name:        aggName,
+			Plural:      pluralize(aggName),
+			Lower:       strings.ToLower(aggName),
+			SampleInput: sampleInput(serviceName, aggName, agg.Fields),
+		}
+
+		for _, childKey := range sortedChildKeys(agg) {
+			child := agg.Children[childKey]
+			childModel, ok := service.Models[child.Of]
+			if !ok {
+				return nil, fmt.Errorf("child model %s of aggregate %s not found in service models", child.Of, aggName)
+			}
+			typ.Fields = append(typ.Fields, ClientFieldData{
+				Name:    capitalizeFirst(childKey),
+				Type:    "[]" + child.Of,
+				JSONTag: toSnakeCase(childKey),
+			})
+			resource.Children = append(resource.Children, ClientResourceData{
+				Name:        child.Of,
+				Plural:      capitalizeFirst(childKey),
+				Lower:       strings.ToLower(child.Of),
+				SampleInput: sampleInput(serviceName, child.Of, childModel.Fields),
+			})
+		}
+
+		data.Types = append(data.Types, typ)
+		data.Aggregates = append(data.Aggregates, resource)
+	}
+
+	for _, modelName := range sortedModelNames(service) {
+		model := service.Models[modelName]
+		typ := ClientTypeData{Name: modelName}
+		typ.Fields = append(typ.Fields, ClientFieldData{Name: "ID", Type: "string", JSONTag: "id"})
+		inputs := clientFields(model.Fields)
+		typ.Fields = append(typ.Fields, inputs...)
+		typ.Input = inputs
+		if model.Options != nil && model.Options.Audit {
+			typ.Fields = append(typ.Fields, clientAuditFields()...)
+			data.NeedsTime = true
+		}
+		data.Types = append(data.Types, typ)
+
+		if !isPartOfAggregate(modelName, service.Aggregates) {
+			data.Models = append(data.Models, ClientResourceData{
+				Name:        modelName,
+				Plural:      pluralize(modelName),
+				Lower:       strings.ToLower(modelName),
+				SampleInput: sampleInput(serviceName, modelName, model.Fields),
+			})
+		}
+	}
+
+	for _, route := range ServiceRoutes(service) {
+		method := ClientMethodData{
+			Name:        route.OperationID,
+			HTTPMethod:  route.Method,
+			MethodConst: capitalizeFirst(strings.ToLower(route.Method)),
+			Path:        route.Path,
+			List:        route.List,
+		}
+
+		format := route.Path
+		var args []string
+		for _, param := range pathParams(route.Path) {
+			name := goParamName(param)
+			method.Params = append(method.Params, name)
+			format = strings.Replace(format, "{"+param+"}", "%s", 1)
+			args = append(args, "url.PathEscape("+name+")")
+		}
+		if len(args) > 0 {
+			method.PathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", format, strings.Join(args, ", "))
+			data.NeedsPathParams = true
+		} else {
+			method.PathExpr = strconv.Quote(route.Path)
+		}
+
+		if route.Op == OpCreate || route.Op == OpUpdate {
+			method.Input = route.Resource + "Input"
+		}
+		if route.Status != http.StatusNoContent {
+			method.Output = route.Resource
+		}
+
+		data.Methods = append(data.Methods, method)
+	}
+
+	return data, nil
+}
+
+func clientFields(fields map[string]Field) []ClientFieldData {
+	var result []ClientFieldData
+	for _, fieldName := range sortedFieldNames(fields) {
+		result = append(result, ClientFieldData{
+			Name:    strings.Title(fieldName),
+			Type:    clientGoType(fields[fieldName].Type),
+			JSONTag: toSnakeCase(fieldName),
+		})
+	}
+	return result
+}
+
+func clientAuditFields() []ClientFieldData {
+	return []ClientFieldData{
+		{Name: "CreatedAt", Type: "time.Time", JSONTag: "created_at"},
+		{Name: "CreatedBy", Type: "string", JSONTag: "created_by"},
+		{Name: "UpdatedAt", Type: "time.Time", JSONTag: "updated_at"},
+		{Name: "UpdatedBy", Type: "string", JSONTag: "updated_by"},
+	}
+}
+
+// clientGoType maps spec types to client types. UUIDs travel as strings so the
+// client package stays free of third party dependencies.
+func clientGoType(specType string) string {
+	switch specType {
+	case "text", "string", "email", "uuid":
+		return "string"
+	case "bool":
+		return "bool"
+	default:
+		return "any"
+	}
+}
+
+// sampleInput builds an input literal that passes the generated validators.
+func sampleInput(pkg, typeName string, fields map[string]Field) string {
+	var parts []string
+	for _, fieldName := range sortedFieldNames(fields) {
+		field := fields[fieldName]
+		var value string
+		switch field.Type {
+		case "text", "string":
+			value = strconv.Quote(sampleString(field.Validations))
+		case "email":
+			value = strconv.Quote("user@example.com")
+		case "bool":
+			value = "true"
+		default:
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", strings.Title(fieldName), value))
+	}
+	return fmt.Sprintf("%sclient.%sInput{%s}", pkg, typeName, strings.Join(parts, ", "))
+}
+
+func sampleString(rules []ValidationRule) string {
+	value := "sample"
+	for _, v := range rules {
+		switch v.Name {
+		case "one_of":
+			if values := splitOneOf(v.Value); len(values) > 0 {
+				return values[0]
+			}
+		case "is_email":
+			return "user@example.com"
+		case "min_length":
+			if n, err := strconv.Atoi(v.Value); err == nil && len(value) < n {
+				value += strings.Repeat("x", n-len(value))
+			}
+		}
+	}
+	for _, v := range rules {
+		if v.Name == "max_length" {
+			if n, err := strconv.Atoi(v.Value); err == nil && len(value) > n {
+				value = value[:n]
+			}
+		}
+	}
+	return value
+}
+
+// goParamName turns a route parameter into a Go identifier (childId -> childID).
+func goParamName(param string) string {
+	name := strings.ReplaceAll(param, "_id", "ID")
+	if strings.HasSuffix(name, "Id") {
+		name = strings.TrimSuffix(name, "Id") + "ID"
+	}
+	return name
+}
+
+// clientModulePath returns the module path of the monorepo client library.
+func clientModulePath(outputDir string, config Config) string {
+	if config.Package != "" {
+		return config.Package + "/pkg/client"
+	}
+	return "github.com/adrianpk/hatmax-" + filepath.Base(outputDir) + "/pkg/client"
+}
+
+// renderGoFile executes a template and writes the gofmt'd result.
+func renderGoFile(tmpl *template.Template, filePath string, data any) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("cannot execute template: %w", err)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("cannot format %s: %w", filePath, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return fmt.Errorf("cannot create directory for %s: %w", filePath, err)
+	}
+
+	return os.WriteFile(filePath, src, 0o644)
+}
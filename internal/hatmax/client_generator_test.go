@@ -0,0 +1,146 @@
+package hatmax
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildClientTemplateDataMethods(t *testing.T) {
+	data, err := BuildClientTemplateData("todo", testTodoService())
+	if err != nil {
+		t.Fatalf("BuildClientTemplateData() error = %v", err)
+	}
+
+	if !data.NeedsTime {
+		t.Error("NeedsTime = false, want true for audited resources")
+	}
+	if !data.NeedsPathParams {
+		t.Error("NeedsPathParams = false, want true")
+	}
+
+	methods := map[string]ClientMethodData{}
+	for _, m := range data.Methods {
+		methods[m.Name] = m
+	}
+
+	tests := []struct {
+		name       string
+		wantPath   string
+		wantParams []string
+		wantInput  string
+		wantOutput string
+		wantList   bool
+	}{
+		{"CreateList", `"/lists"`, nil, "ListInput", "List", false},
+		{"GetAllLists", `"/lists"`, nil, "", "List", true},
+		{"GetList", `fmt.Sprintf("/lists/%s", url.PathEscape(id))`, []string{"id"}, "", "List", false},
+		{"DeleteList", `fmt.Sprintf("/lists/%s", url.PathEscape(id))`, []string{"id"}, "", "", false},
+		{"UpdateItemInList", `fmt.Sprintf("/lists/%s/items/%s", url.PathEscape(id), url.PathEscape(childID))`, []string{"id", "childID"}, "ItemInput", "Item", false},
+		{"RemoveItemFromList", `fmt.Sprintf("/lists/%s/items/%s", url.PathEscape(id), url.PathEscape(childID))`, []string{"id", "childID"}, "", "", false},
+		{"ListNotes", `"/notes"`, nil, "", "Note", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ok := methods[tt.name]
+			if !ok {
+				t.Fatalf("method %s not generated", tt.name)
+			}
+			if m.PathExpr != tt.wantPath {
+				t.Errorf("PathExpr = %s, want %s", m.PathExpr, tt.wantPath)
+			}
+			if !reflect.DeepEqual(m.Params, tt.wantParams) {
+				t.Errorf("Params = %v, want %v", m.Params, tt.wantParams)
+			}
+			if m.Input != tt.wantInput {
+				t.Errorf("Input = %q, want %q", m.Input, tt.wantInput)
+			}
+			if m.Output != tt.wantOutput {
+				t.Errorf("Output = %q, want %q", m.Output, tt.wantOutput)
+			}
+			if m.List != tt.wantList {
+				t.Errorf("List = %v, want %v", m.List, tt.wantList)
+			}
+		})
+	}
+}
+
+func TestBuildClientTemplateDataTypes(t *testing.T) {
+	data, err := BuildClientTemplateData("todo", testTodoService())
+	if err != nil {
+		t.Fatalf("BuildClientTemplateData() error = %v", err)
+	}
+
+	var list *ClientTypeData
+	for i := range data.Types {
+		if data.Types[i].Name == "List" {
+			list = &data.Types[i]
+		}
+	}
+	if list == nil {
+		t.Fatal("List type not generated")
+	}
+
+	fields := map[string]ClientFieldData{}
+	for _, f := range list.Fields {
+		fields[f.Name] = f
+	}
+	if got := fields["Items"]; got.Type != "[]Item" || got.JSONTag != "items" {
+		t.Errorf("Items field = %+v, want []Item tagged items", got)
+	}
+	if got := fields["CreatedAt"]; got.Type != "time.Time" {
+		t.Errorf("CreatedAt type = %s, want time.Time", got.Type)
+	}
+	if len(list.Input) != 1 || list.Input[0].Name != "Name" {
+		t.Errorf("List input = %+v, want only Name", list.Input)
+	}
+
+	if len(data.Models) != 1 || data.Models[0].Name != "Note" {
+		t.Errorf("standalone models = %+v, want only Note", data.Models)
+	}
+}
+
+func TestBuildClientTemplateDataMissingChild(t *testing.T) {
+	service := testTodoService()
+	delete(service.Models, "Item")
+
+	if _, err := BuildClientTemplateData("todo", service); err == nil {
+		t.Error("BuildClientTemplateData() error = nil, want missing child model error")
+	}
+}
+
+func TestGoParamName(t *testing.T) {
+	tests := map[string]string{
+		"id":      "id",
+		"childId": "childID",
+		"user_id": "userID",
+	}
+
+	for param, want := range tests {
+		if got := goParamName(param); got != want {
+			t.Errorf("goParamName(%q) = %q, want %q", param, got, want)
+		}
+	}
+}
+
+func TestSampleString(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []ValidationRule
+		want  string
+	}{
+		{"no rules", nil, "sample"},
+		{"one of", []ValidationRule{{Name: "one_of", Value: "low, normal,high"}}, "low"},
+		{"email", []ValidationRule{{Name: "is_email"}}, "user@example.com"},
+		{"min length", []ValidationRule{{Name: "min_length", Value: "8"}}, "samplexx"},
+		{"max length", []ValidationRule{{Name: "max_length", Value: "3"}}, "sam"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sampleString(tt.rules); got != tt.want {
+				t.Errorf("sampleString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@ type Config struct {
 	ModulePath         string             `yaml:"module_path,omitempty"`
 	MonorepoModulePath string             `yaml:"-"` // Runtime computed, not from YAML
 	Deployment         *DeploymentConfig  `yaml:"deployment,omitempty"`
+	Middlewares        *MiddlewareConfig  `yaml:"middlewares,omitempty"`
 	Services           map[string]Service `yaml:"services"`
 }
 
@@ -26,6 +27,7 @@ type Service struct {
 	SQLiteDriver string                   `yaml:"sqlite_driver,omitempty"` // "stdlib", "sqlx", "sqlc"
 	Auth         *AuthConfig              `yaml:"auth,omitempty"`
 	Deployment   *ServiceDeploymentConfig `yaml:"deployment,omitempty"`
+	Middlewares  *MiddlewareSettings      `yaml:"middlewares,omitempty"`
 	Models       map[string]Model         `yaml:"models"`
 	Aggregates   map[string]AggregateRoot `yaml:"aggregates,omitempty"`
 	API          *APIConfig               `yaml:"api"`
@@ -100,18 +102,63 @@ type ValidationRule struct {
 
 // APIConfig defines API-related settings for a service.
 type APIConfig struct {
-	BasePath string    `yaml:"base_path"`
-	Handlers []Handler `yaml:"handlers"`
+	BasePath    string             `yaml:"base_path"`
+	Docs        bool               `yaml:"docs,omitempty"` // Serve an HTML docs page next to /openapi.yaml
+	Middlewares []RouteMiddlewares `yaml:"middlewares,omitempty"`
+	Handlers    []Handler          `yaml:"handlers"`
+}
+
+// MiddlewareConfig defines the middleware stack shared by all services.
+type MiddlewareConfig struct {
+	Global MiddlewareSettings `yaml:"global"`
+}
+
+// MiddlewareSettings configures a middleware stack. Service settings override
+// the global ones and route group settings override the service ones.
+// Setting a value (timeout, throttle, cors...) enables its middleware.
+type MiddlewareSettings struct {
+	Defaults     []string         `yaml:"defaults,omitempty"` // Global only, replaces the built-in defaults
+	Timeout      string           `yaml:"timeout,omitempty"`  // Go duration: "30s", "2m"
+	Throttle     int              `yaml:"throttle,omitempty"` // Max concurrent requests
+	StripSlashes bool             `yaml:"strip_slashes,omitempty"`
+	Heartbeat    *HeartbeatConfig `yaml:"heartbeat,omitempty"`
+	Compress     int              `yaml:"compress,omitempty"` // Compression level, 1-9
+	CORS         *CORSConfig      `yaml:"cors,omitempty"`
+	BodyLimit    string           `yaml:"body_limit,omitempty"` // "512KB", "1MB"
+	Additional   []string         `yaml:"additional,omitempty"`
+	Disable      []string         `yaml:"disable,omitempty"`
+}
+
+// HeartbeatConfig defines the heartbeat endpoint.
+type HeartbeatConfig struct {
+	Path string `yaml:"path"`
+}
+
+// CORSConfig defines the cors middleware settings.
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins,omitempty"`
+	AllowedMethods   []string `yaml:"allowed_methods,omitempty"`
+	AllowedHeaders   []string `yaml:"allowed_headers,omitempty"`
+	AllowCredentials bool     `yaml:"allow_credentials,omitempty"`
+	MaxAge           int      `yaml:"max_age,omitempty"`
+}
+
+// RouteMiddlewares overrides the service middleware stack for the routes under Path.
+type RouteMiddlewares struct {
+	Path               string `yaml:"path"`
+	MiddlewareSettings `yaml:",inline"`
 }
 
 // Handler defines an API handler.
 type Handler struct {
 	ID              string            `yaml:"id"`
 	Route           string            `yaml:"route"`
+	Summary         string            `yaml:"summary,omitempty"`
 	Source          HandlerSource     `yaml:"source"`
 	Model           string            `yaml:"model"`
 	Operation       StandardOp        `yaml:"op"`
 	CustomOperation string            `yaml:"custom_operation,omitempty"`
+	Permission      string            `yaml:"permission,omitempty"` // Defaults to read:<plural> or write:<plural>
 	Overrides       *HandlerOverrides `yaml:"overrides,omitempty"`
 }
 
@@ -137,6 +184,10 @@ const (
 )
 
 // AuthConfig defines authentication and authorization settings.
+// RequiredScopes are checked on every route next to the route permission:
+// :read scopes on GET requests, :write scopes on the others and any other
+// scope on all of them. Legacy read:<resource> and write:<resource> scopes
+// are accepted and checked as <resource>:read and <resource>:write.
 type AuthConfig struct {
 	Enabled         bool     `yaml:"enabled"`
 	Mode            string   `yaml:"mode,omitempty"`
@@ -145,6 +196,20 @@ type AuthConfig struct {
 	CacheTTL        string   `yaml:"cache_ttl,omitempty"`
 }
 
+// Scopes returns RequiredScopes written as permissions, <resource>:<action>,
+// and the legacy <action>:<resource> scopes that were rewritten.
+func (a *AuthConfig) Scopes() (scopes, legacy []string) {
+	for _, scope := range a.RequiredScopes {
+		action, resource, ok := strings.Cut(scope, ":")
+		if ok && (action == "read" || action == "write") && resource != "" && !strings.Contains(resource, ":") {
+			legacy = append(legacy, scope)
+			scope = resource + ":" + action
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, legacy
+}
+
 // HandlerOverrides allows overriding generated handler names.
 type HandlerOverrides struct {
 	RepoName    string `yaml:"repo_name,omitempty"`
@@ -175,6 +240,19 @@ func (s *StringOrSlice) UnmarshalYAML(value *yaml.Node) error {
 	return fmt.Errorf("cannot unmarshal repo_impl into string or slice: unexpected YAML kind %v", value.Kind)
 }
 
+// ParseRoute splits the handler route ("GET /items") into method and path.
+func (h *Handler) ParseRoute() (method, path string) {
+	parts := strings.Fields(h.Route)
+	switch len(parts) {
+	case 0:
+		return "", ""
+	case 1:
+		return "", parts[0]
+	default:
+		return strings.ToUpper(parts[0]), parts[1]
+	}
+}
+
 // InferRepoName infers the repository name from the model name.
 func (h *Handler) InferRepoName() string {
 	if h.Overrides != nil && h.Overrides.RepoName != "" {
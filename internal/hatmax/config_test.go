@@ -1,6 +1,9 @@
 package hatmax
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestHandlerInferRepoName(t *testing.T) {
 	tests := []struct {
@@ -139,3 +142,53 @@ func TestCapitalizeFirst(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthTemplateData(t *testing.T) {
+	mg := &ModelGenerator{Config: Config{Services: map[string]Service{
+		"todo":   {Auth: &AuthConfig{Enabled: true}},
+		"ledger": {Auth: &AuthConfig{Enabled: true, Mode: "production", CacheTTL: "30s"}},
+		"public": {Auth: &AuthConfig{Enabled: false, Mode: "production"}},
+		"open":   {},
+	}}}
+
+	tests := []struct {
+		service  string
+		wantNil  bool
+		wantMode string
+		wantTTL  time.Duration
+	}{
+		{"todo", false, "development", time.Minute},
+		{"ledger", false, "production", 30 * time.Second},
+		{"public", true, "", 0},
+		{"open", true, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			got, err := mg.authTemplateData(tt.service)
+			if err != nil {
+				t.Fatalf("authTemplateData() error = %v", err)
+			}
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("authTemplateData() = %+v, want nil %v", got, tt.wantNil)
+			}
+			if got == nil {
+				return
+			}
+			if got.Mode != tt.wantMode {
+				t.Errorf("Mode = %s, want %s", got.Mode, tt.wantMode)
+			}
+			if len(got.Audiences) != 2 || got.Audiences[0] != tt.service || got.Audiences[1] != "session" {
+				t.Errorf("Audiences = %v, want [%s session]", got.Audiences, tt.service)
+			}
+			if got.AuthzCacheTTL != tt.wantTTL {
+				t.Errorf("AuthzCacheTTL = %v, want %v", got.AuthzCacheTTL, tt.wantTTL)
+			}
+		})
+	}
+
+	mg.Config.Services["broken"] = Service{Auth: &AuthConfig{Enabled: true, CacheTTL: "often"}}
+	if _, err := mg.authTemplateData("broken"); err == nil {
+		t.Error("authTemplateData() with invalid cache_ttl error = nil, want error")
+	}
+}
@@ -132,14 +132,16 @@ func (dg *DeploymentGenerator) buildJobData() *NomadJobData {
 		consulTags = serviceConfig.Consul.Tags
 	}
 
+	healthCheck := healthCheckConfig(serviceConfig.HealthCheck)
+
 	return &NomadJobData{
 		ServiceName:         dg.ServiceName,
 		Datacenter:          globalConfig.Datacenter,
 		Port:                serviceConfig.Port,
 		Replicas:            serviceConfig.Replicas,
 		Resources:           resources,
-		HealthCheckPath:     serviceConfig.HealthCheck.Path,
-		HealthCheckInterval: serviceConfig.HealthCheck.Interval,
+		HealthCheckPath:     healthCheck.Path,
+		HealthCheckInterval: healthCheck.Interval,
 		TraefikRule:         serviceConfig.Traefik.Rule,
 		TraefikEntrypoint:   entrypoint,
 		ConsulTags:          consulTags,
@@ -147,6 +149,22 @@ func (dg *DeploymentGenerator) buildJobData() *NomadJobData {
 	}
 }
 
+// healthCheckConfig fills in the Nomad/Consul check defaults. Checks target
+// /readyz so instances leave rotation while starting or draining.
+func healthCheckConfig(hc *HealthCheckConfig) HealthCheckConfig {
+	result := HealthCheckConfig{Path: "/readyz", Interval: "10s"}
+	if hc == nil {
+		return result
+	}
+	if hc.Path != "" {
+		result.Path = hc.Path
+	}
+	if hc.Interval != "" {
+		result.Interval = hc.Interval
+	}
+	return result
+}
+
 func (dg *DeploymentGenerator) generateConfigTemplate() string {
 	consulAddress := "127.0.0.1:8500"
 	if dg.Config.Deployment.Infrastructure != nil && dg.Config.Deployment.Infrastructure.Consul != nil {
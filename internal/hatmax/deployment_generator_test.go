@@ -0,0 +1,24 @@
+package hatmax
+
+import "testing"
+
+func TestHealthCheckConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *HealthCheckConfig
+		want HealthCheckConfig
+	}{
+		{"defaults", nil, HealthCheckConfig{Path: "/readyz", Interval: "10s"}},
+		{"empty", &HealthCheckConfig{}, HealthCheckConfig{Path: "/readyz", Interval: "10s"}},
+		{"custom", &HealthCheckConfig{Path: "/healthz", Interval: "30s"}, HealthCheckConfig{Path: "/healthz", Interval: "30s"}},
+		{"interval only", &HealthCheckConfig{Interval: "5s"}, HealthCheckConfig{Path: "/readyz", Interval: "5s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := healthCheckConfig(tt.in); got != tt.want {
+				t.Errorf("healthCheckConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -30,6 +31,27 @@ func logSubStepLast(message string) {
 	fmt.Printf("  └─ %s\n", message)
 }
 
+// warnLegacyScopes reports the required scopes written action first, which
+// are checked as their resource first permissions.
+func warnLegacyScopes(config Config) {
+	names := make([]string, 0, len(config.Services))
+	for name := range config.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		auth := config.Services[name].Auth
+		if auth == nil {
+			continue
+		}
+		scopes, legacy := auth.Scopes()
+		if len(legacy) > 0 {
+			fmt.Printf("Warning: service %s: required_scopes %v use the legacy <action>:<resource> form, checked as %v. Update the config to the <resource>:<action> form.\n", name, legacy, scopes)
+		}
+	}
+}
+
 func logCreated(filePath string) {
 	fmt.Printf("    ✓ Created %s\n", filePath)
 }
@@ -63,9 +85,16 @@ func GenerateAction(c *cli.Context, tmplFS fs.FS) error {
 		return fmt.Errorf("error parsing YAML file: %w", err)
 	}
 
+	warnLegacyScopes(config)
+
 	outputDir := c.String("output")
 	devMode := c.Bool("dev")
 
+	clients, err := parseClients(c.StringSlice("clients"))
+	if err != nil {
+		return err
+	}
+
 	monorepoName := "monorepo"
 	if config.Name != "" {
 		monorepoName = SanitizeName(config.Name)
@@ -122,6 +151,13 @@ func GenerateAction(c *cli.Context, tmplFS fs.FS) error {
 		logSuccess("Authz service generated successfully")
 	}
 
+	// Generate client library (always generate for inter-service calls)
+	logStep("Generating client library...")
+	if err := generateClientLibrary(outputDir, config, tmplFS); err != nil {
+		return fmt.Errorf("error generating client library: %w", err)
+	}
+	logSuccess("Client library generated successfully")
+
 	// Generate admin service (always generate for system administration)
 	logStep("Generating admin service...")
 	if err := generateAdminService(outputDir, config, tmplFS); err != nil {
@@ -131,7 +167,7 @@ func GenerateAction(c *cli.Context, tmplFS fs.FS) error {
 
 	for serviceName := range config.Services {
 		// Skip authn, authz, and admin services - they're generated statically
-		if serviceName == "authn" || serviceName == "authz" || serviceName == "admin" {
+		if isStaticService(serviceName) {
 			continue
 		}
 		
@@ -244,6 +280,43 @@ func GenerateAction(c *cli.Context, tmplFS fs.FS) error {
 		}
 		fmt.Println("Validators generated successfully.")
 
+		service := config.Services[serviceName]
+
+		fmt.Println("Generating OpenAPI document...")
+		openAPIGen := NewOpenAPIGenerator(&config, servicePath, serviceName, &service)
+		if err := openAPIGen.Generate(); err != nil {
+			return fmt.Errorf("cannot generate OpenAPI document for service %s: %w", serviceName, err)
+		}
+		fmt.Println("OpenAPI document generated successfully.")
+
+		fmt.Println("Generating route catalog...")
+		if err := GenerateServiceRouteCatalog(outputDir, serviceName, service); err != nil {
+			return err
+		}
+		fmt.Println("Route catalog generated successfully.")
+
+		fmt.Println("Generating Go client...")
+		clientGen, err := NewClientGenerator(&config, outputDir, serviceName, &service, tmplFS)
+		if err != nil {
+			return fmt.Errorf("cannot create client generator for service %s: %w", serviceName, err)
+		}
+		if err := clientGen.Generate(); err != nil {
+			return fmt.Errorf("cannot generate Go client for service %s: %w", serviceName, err)
+		}
+		fmt.Println("Go client generated successfully.")
+
+		if clients[ClientTS] {
+			fmt.Println("Generating TypeScript client...")
+			tsClientGen, err := NewTSClientGenerator(outputDir, serviceName, &service, tmplFS)
+			if err != nil {
+				return fmt.Errorf("cannot create TypeScript client generator for service %s: %w", serviceName, err)
+			}
+			if err := tsClientGen.Generate(); err != nil {
+				return fmt.Errorf("cannot generate TypeScript client for service %s: %w", serviceName, err)
+			}
+			fmt.Println("TypeScript client generated successfully.")
+		}
+
 		fmt.Println("Generating main.go...")
 		if err := modelGen.GenerateMain(); err != nil {
 			return fmt.Errorf("cannot generate main.go for service %s: %w", serviceName, err)
@@ -275,7 +348,6 @@ func GenerateAction(c *cli.Context, tmplFS fs.FS) error {
 		logSuccess(".gitignore generated successfully")
 
 		fmt.Println("Generating deployment configurations...")
-		service := config.Services[serviceName]
 		deploymentGen, err := NewDeploymentGenerator(&config, outputDir, serviceName, &service, tmplFS)
 		if err != nil {
 			return fmt.Errorf("cannot create deployment generator for service %s: %w", serviceName, err)
@@ -286,6 +358,12 @@ func GenerateAction(c *cli.Context, tmplFS fs.FS) error {
 		fmt.Println("Deployment configurations generated successfully.")
 	}
 
+	fmt.Println("Generating monorepo route catalog...")
+	if err := GenerateMonorepoRouteCatalog(outputDir, config); err != nil {
+		return fmt.Errorf("error generating monorepo route catalog: %w", err)
+	}
+	fmt.Println("Monorepo route catalog generated successfully.")
+
 	fmt.Println("Generating monorepo-level deployment scripts...")
 	if err := generateMonorepoDeploymentScripts(outputDir); err != nil {
 		return fmt.Errorf("error generating monorepo deployment scripts: %w", err)
@@ -470,17 +548,35 @@ func generateMonorepoCoreLibrary(outputDir string, config Config, tmplFS fs.FS)
 		return fmt.Errorf("cannot create templates sub-filesystem: %w", err)
 	}
 
+	data := struct {
+		AuthModulePath string
+	}{
+		AuthModulePath: authLibModulePath(outputDir, config),
+	}
+
 	// Generate each core library file
 	coreFileMapping := map[string]string{
-		"core_lifecycle.tmpl":  "lifecycle.go",
-		"core_server.tmpl":     "server.go",
-		"core_log.tmpl":        "log.go",
-		"core_auth.tmpl":       "auth.go",
-		"core_model.tmpl":      "model.go",
-		"core_response.tmpl":   "response.go",
-		"core_validation.tmpl": "validation.go",
-		"core_fileserver.tmpl": "fileserver.go",
-		"core_template.tmpl":   "template.go",
+		"core_lifecycle.tmpl":       "lifecycle.go",
+		"core_server.tmpl":          "server.go",
+		"core_log.tmpl":             "log.go",
+		"core_auth.tmpl":            "auth.go",
+		"core_auth_test.tmpl":       "auth_test.go",
+		"core_authz.tmpl":           "authz.go",
+		"core_authz_test.tmpl":      "authz_test.go",
+		"core_model.tmpl":           "model.go",
+		"core_response.tmpl":        "response.go",
+		"core_validation.tmpl":      "validation.go",
+		"core_fileserver.tmpl":      "fileserver.go",
+		"core_template.tmpl":        "template.go",
+		"core_openapi.tmpl":         "openapi.go",
+		"core_health.tmpl":          "health.go",
+		"core_health_test.tmpl":     "health_test.go",
+		"core_mailer.tmpl":          "mailer.go",
+		"core_mailer_test.tmpl":     "mailer_test.go",
+		"core_middleware.tmpl":      "middleware.go",
+		"core_middleware_test.tmpl": "middleware_test.go",
+		"core_routes.tmpl":          "routes.go",
+		"core_routes_test.tmpl":     "routes_test.go",
 	}
 
 	// Generate each core library file
@@ -491,7 +587,7 @@ func generateMonorepoCoreLibrary(outputDir string, config Config, tmplFS fs.FS)
 		}
 
 		filePath := filepath.Join(coreDir, outputFile)
-		if err := executeTemplate(tmpl, filePath, nil); err != nil {
+		if err := executeTemplate(tmpl, filePath, data); err != nil {
 			return fmt.Errorf("cannot generate core file %s: %w", outputFile, err)
 		}
 
@@ -575,6 +671,9 @@ func generateMonorepoWorkspace(outputDir string, config Config) error {
 	// Always include fake library for testing
 	workspaceBuilder.WriteString("\t./pkg/lib/fake\n")
 
+	// Always include client library for inter-service calls
+	workspaceBuilder.WriteString("\t./pkg/client\n")
+
 	// Always include admin service for system administration
 	workspaceBuilder.WriteString("\t./services/admin\n")
 
@@ -654,18 +753,32 @@ func generateAuthLibrary(outputDir string, config Config, tmplFS fs.FS) error {
 
 	// Generate each auth library file
 	authFileMapping := map[string]string{
+		"auth_apikeys.tmpl":             "apikeys.go",
+		"auth_apikeys_test.tmpl":        "apikeys_test.go",
 		"auth_authzhelper.tmpl":         "authzhelper.go",
 		"auth_authzhelper_test.tmpl":    "authzhelper_test.go",
+		"auth_conditions.tmpl":          "conditions.go",
+		"auth_conditions_test.tmpl":     "conditions_test.go",
 		"auth_crypto.tmpl":              "crypto.go",
 		"auth_crypto_test.tmpl":         "crypto_test.go",
 		"auth_errors.tmpl":              "errors.go",
+		"auth_jwt.tmpl":                 "jwt.go",
+		"auth_jwt_test.tmpl":            "jwt_test.go",
+		"auth_paseto.tmpl":              "paseto.go",
+		"auth_paseto_test.tmpl":         "paseto_test.go",
+		"auth_password.tmpl":            "password.go",
+		"auth_password_test.tmpl":       "password_test.go",
 		"auth_permissions.tmpl":         "permissions.go",
 		"auth_permissions_registry.tmpl": "permissions_registry.go",
 		"auth_permissions_test.tmpl":    "permissions_test.go",
+		"auth_pkce.tmpl":                "pkce.go",
+		"auth_pkce_test.tmpl":           "pkce_test.go",
 		"auth_policies.tmpl":            "policies.go",
 		"auth_policies_test.tmpl":       "policies_test.go",
 		"auth_tokens.tmpl":              "tokens.go",
 		"auth_tokens_test.tmpl":         "tokens_test.go",
+		"auth_totp.tmpl":                "totp.go",
+		"auth_totp_test.tmpl":           "totp_test.go",
 		"auth_types.tmpl":               "types.go",
 		"auth_validation.tmpl":          "validation.go",
 		"auth_validation_test.tmpl":     "validation_test.go",
@@ -689,13 +802,18 @@ func generateAuthLibrary(outputDir string, config Config, tmplFS fs.FS) error {
 	return nil
 }
 
-// generateAuthGoMod generates a go.mod file for the auth library module
-func generateAuthGoMod(outputDir string, config Config) error {
-	// Use the package field from config for the auth library module
-	authModulePath := "github.com/adrianpk/hatmax-" + filepath.Base(outputDir) + "/pkg/lib/auth"
+// authLibModulePath returns the auth library module path, from the package
+// field of the config when set.
+func authLibModulePath(outputDir string, config Config) string {
 	if config.Package != "" {
-		authModulePath = config.Package + "/pkg/lib/auth"
+		return config.Package + "/pkg/lib/auth"
 	}
+	return "github.com/adrianpk/hatmax-" + filepath.Base(outputDir) + "/pkg/lib/auth"
+}
+
+// generateAuthGoMod generates a go.mod file for the auth library module
+func generateAuthGoMod(outputDir string, config Config) error {
+	authModulePath := authLibModulePath(outputDir, config)
 
 	// Create auth library go.mod with all necessary dependencies
 	goModContent := fmt.Sprintf(`module %s
@@ -795,6 +913,87 @@ require (
 	return nil
 }
 
+// isStaticService reports whether a service is copied from the static assets
+// instead of being generated from its spec.
+func isStaticService(serviceName string) bool {
+	return serviceName == "authn" || serviceName == "authz" || serviceName == "admin"
+}
+
+// generateClientLibrary generates the shared Go client library and the typed
+// clients of the statically generated services.
+func generateClientLibrary(outputDir string, config Config, tmplFS fs.FS) error {
+	clientDir := filepath.Join(outputDir, "pkg", "client")
+	if err := os.MkdirAll(clientDir, 0o755); err != nil {
+		return fmt.Errorf("cannot create client library directory: %w", err)
+	}
+
+	// Generate go.mod for the client library module
+	if err := generateClientGoMod(outputDir, config); err != nil {
+		return fmt.Errorf("cannot generate client go.mod: %w", err)
+	}
+
+	// Get templates filesystem
+	templateFS, err := fs.Sub(tmplFS, "assets/templates")
+	if err != nil {
+		return fmt.Errorf("cannot create templates sub-filesystem: %w", err)
+	}
+
+	clientFileMapping := map[string]string{
+		"client_client.tmpl":      "client.go",
+		"client_client_test.tmpl": "client_test.go",
+		"client_errors.tmpl":      "errors.go",
+	}
+	if shouldGenerateAuthService(config) {
+		clientFileMapping["client_authn.tmpl"] = filepath.Join("authn", "client.go")
+	}
+	if shouldGenerateAuthzService(config) {
+		clientFileMapping["client_authz.tmpl"] = filepath.Join("authz", "client.go")
+	}
+
+	data := struct {
+		ClientModulePath string
+	}{
+		ClientModulePath: clientModulePath(outputDir, config),
+	}
+
+	// Generate each client library file
+	for templateFile, outputFile := range clientFileMapping {
+		tmpl, err := template.ParseFS(templateFS, templateFile)
+		if err != nil {
+			return fmt.Errorf("cannot parse template %s: %w", templateFile, err)
+		}
+
+		filePath := filepath.Join(clientDir, outputFile)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			return fmt.Errorf("cannot create directory for %s: %w", filePath, err)
+		}
+		if err := executeTemplate(tmpl, filePath, data); err != nil {
+			return fmt.Errorf("cannot generate client file %s: %w", outputFile, err)
+		}
+
+		logCreated(filePath)
+	}
+
+	return nil
+}
+
+// generateClientGoMod generates a go.mod file for the client library module.
+// The client library only depends on the standard library.
+func generateClientGoMod(outputDir string, config Config) error {
+	goModContent := fmt.Sprintf(`module %s
+
+go 1.23
+`, clientModulePath(outputDir, config))
+
+	goModPath := filepath.Join(outputDir, "pkg", "client", "go.mod")
+	if err := os.WriteFile(goModPath, []byte(goModContent), 0o644); err != nil {
+		return fmt.Errorf("cannot write client go.mod: %w", err)
+	}
+	logCreated(goModPath)
+
+	return nil
+}
+
 // shouldGenerateAuthService checks if there's an authn service configured
 func shouldGenerateAuthService(config Config) bool {
 	for serviceName, service := range config.Services {
@@ -11,6 +11,7 @@ import (
 	"sort"
 	"strings"
 	"text/template"
+	"time"
 	"unicode"
 
 	_ "github.com/adrianpk/hatmax/pkg/lib/hm"
@@ -814,6 +815,11 @@ func (mg *ModelGenerator) GenerateMain() error {
 	}
 	sort.Strings(aggregateNames)
 
+	middlewares, err := ResolveMiddlewares(mg.Config.Middlewares, currentService)
+	if err != nil {
+		return fmt.Errorf("cannot resolve middlewares for service %s: %w", currentServiceName, err)
+	}
+
 	service := mainTemplateService{
 		Name:       currentServiceName,
 		Models:     modelNames,
@@ -825,11 +831,17 @@ func (mg *ModelGenerator) GenerateMain() error {
 		MonorepoModulePath string
 		ServiceName        string
 		Services           []mainTemplateService
+		APIDocs            bool
+		AuthEnabled        bool
+		Middlewares        MiddlewareStackSpec
 	}{
 		ModulePath:         mg.Config.ModulePath,
 		MonorepoModulePath: mg.Config.MonorepoModulePath,
 		ServiceName:        currentServiceName,
 		Services:           []mainTemplateService{service},
+		APIDocs:            currentService.API != nil && currentService.API.Docs,
+		AuthEnabled:        currentService.Auth != nil && currentService.Auth.Enabled,
+		Middlewares:        middlewares,
 	}
 
 	if err := mg.generateFile(mg.MainTemplate, mainPath, data); err != nil {
@@ -848,16 +860,22 @@ func (mg *ModelGenerator) GenerateConfigAndXParams() error {
 	// Calculate port for this service
 	currentServiceName := filepath.Base(mg.OutputDir)
 	port := mg.calculateServicePort(currentServiceName)
+	auth, err := mg.authTemplateData(currentServiceName)
+	if err != nil {
+		return err
+	}
 	data := struct {
 		ModulePath         string
 		MonorepoModulePath string
 		Port               int
 		ServicePrefix      string
+		Auth               *authTemplateData
 	}{
 		ModulePath:         mg.Config.ModulePath,
 		MonorepoModulePath: mg.Config.MonorepoModulePath,
 		Port:               port,
 		ServicePrefix:      strings.ToUpper(currentServiceName),
+		Auth:               auth,
 	}
 	if err := mg.generateFile(mg.ConfigTemplate, configGoPath, data); err != nil {
 		return fmt.Errorf("cannot generate config.go: %w", err)
@@ -875,9 +893,11 @@ func (mg *ModelGenerator) GenerateConfigAndXParams() error {
 	configData := struct {
 		Port          int
 		ServicePrefix string
+		Auth          *authTemplateData
 	}{
 		Port:          port,
 		ServicePrefix: strings.ToUpper(currentServiceName),
+		Auth:          auth,
 	}
 	if err := mg.generateFile(mg.ConfigYAMLTemplate, configYAMLPath, configData); err != nil {
 		return fmt.Errorf("cannot generate config.yaml: %w", err)
@@ -887,6 +907,57 @@ func (mg *ModelGenerator) GenerateConfigAndXParams() error {
 	return nil
 }
 
+// authTemplateData holds the auth defaults rendered into a service config.
+type authTemplateData struct {
+	Mode           string
+	Audiences      []string
+	Issuer         string
+	KeysURL        string
+	RevocationsURL string
+	APIKeysURL     string
+	AuthzURL       string
+	AuthzCacheTTL  time.Duration
+}
+
+// AuthzCacheTTLLiteral renders the permission cache TTL as a Go expression.
+func (a authTemplateData) AuthzCacheTTLLiteral() string {
+	return goDuration(a.AuthzCacheTTL)
+}
+
+// authTemplateData returns nil when the service does not enable auth.
+// Session tokens issued by authn are accepted next to the service audience.
+func (mg *ModelGenerator) authTemplateData(serviceName string) (*authTemplateData, error) {
+	service := mg.Config.Services[serviceName]
+	if service.Auth == nil || !service.Auth.Enabled {
+		return nil, nil
+	}
+
+	mode := service.Auth.Mode
+	if mode == "" {
+		mode = "development"
+	}
+
+	cacheTTL := time.Minute
+	if service.Auth.CacheTTL != "" {
+		d, err := time.ParseDuration(service.Auth.CacheTTL)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid auth cache_ttl %q for service %s", service.Auth.CacheTTL, serviceName)
+		}
+		cacheTTL = d
+	}
+
+	return &authTemplateData{
+		Mode:           mode,
+		Audiences:      []string{serviceName, "session"},
+		Issuer:         "http://localhost:8082",                          // Static authn default issuer
+		KeysURL:        "http://localhost:8082/authn/keys",               // Static authn default port
+		RevocationsURL: "http://localhost:8082/authn/revocations",        // Static authn default port
+		APIKeysURL:     "http://localhost:8082/authn/apikeys/introspect", // Static authn default port
+		AuthzURL:       "http://localhost:8083",                          // Static authz default port
+		AuthzCacheTTL:  cacheTTL,
+	}, nil
+}
+
 // generateFile is a helper to execute a template and write to a file.
 func (mg *ModelGenerator) generateFile(tmpl *template.Template, path string, data any) error {
 	if tmpl == nil {
@@ -0,0 +1,365 @@
+package hatmax
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// middlewareNames lists the middlewares known by core.MiddlewareStack in the
+// order they are chained, outermost first.
+var middlewareNames = []string{
+	"recoverer",
+	"request_id",
+	"real_ip",
+	"logger",
+	"timeout",
+	"throttle",
+	"compress",
+	"cors",
+	"body_limit",
+	"strip_slashes",
+	"heartbeat",
+}
+
+// defaultMiddlewares are enabled when the spec does not set global defaults.
+var defaultMiddlewares = []string{"recoverer", "request_id", "real_ip", "logger"}
+
+// MiddlewareStackSpec is the resolved middleware stack of a service.
+type MiddlewareStackSpec struct {
+	Base   MiddlewareSpec
+	Groups []MiddlewareGroupSpec
+}
+
+// MiddlewareGroupSpec is the full stack applied under a route group path.
+type MiddlewareGroupSpec struct {
+	Path string
+	MiddlewareSpec
+}
+
+// MiddlewareSpec mirrors core.MiddlewareOptions.
+type MiddlewareSpec struct {
+	Enabled       []string
+	Timeout       time.Duration
+	Throttle      int
+	CompressLevel int
+	CORS          *CORSConfig
+	BodyLimit     int64
+	HeartbeatPath string
+}
+
+// ResolveMiddlewares merges the global, service and route group middleware
+// settings. Groups inherit the resolved service stack.
+func ResolveMiddlewares(global *MiddlewareConfig, service Service) (MiddlewareStackSpec, error) {
+	defaults := defaultMiddlewares
+	if global != nil && len(global.Global.Defaults) > 0 {
+		defaults = global.Global.Defaults
+	}
+
+	base := middlewareState{enabled: map[string]bool{}}
+	for _, name := range defaults {
+		if !isMiddlewareName(name) {
+			return MiddlewareStackSpec{}, fmt.Errorf("unknown middleware %q in global defaults", name)
+		}
+		base.enabled[name] = true
+	}
+	// Recoverer is never disabled.
+	base.enabled["recoverer"] = true
+
+	if global != nil {
+		if err := base.apply(global.Global); err != nil {
+			return MiddlewareStackSpec{}, fmt.Errorf("global middlewares: %w", err)
+		}
+	}
+	if service.Middlewares != nil {
+		if err := base.apply(*service.Middlewares); err != nil {
+			return MiddlewareStackSpec{}, fmt.Errorf("service middlewares: %w", err)
+		}
+	}
+
+	spec := MiddlewareStackSpec{}
+	var err error
+	if spec.Base, err = base.build(); err != nil {
+		return MiddlewareStackSpec{}, fmt.Errorf("service middlewares: %w", err)
+	}
+
+	if service.API == nil {
+		return spec, nil
+	}
+
+	for _, group := range service.API.Middlewares {
+		if !strings.HasPrefix(group.Path, "/") {
+			return MiddlewareStackSpec{}, fmt.Errorf("middleware group path %q must start with /", group.Path)
+		}
+		state := base.clone()
+		if err := state.apply(group.MiddlewareSettings); err != nil {
+			return MiddlewareStackSpec{}, fmt.Errorf("middleware group %s: %w", group.Path, err)
+		}
+		groupSpec, err := state.build()
+		if err != nil {
+			return MiddlewareStackSpec{}, fmt.Errorf("middleware group %s: %w", group.Path, err)
+		}
+		spec.Groups = append(spec.Groups, MiddlewareGroupSpec{Path: group.Path, MiddlewareSpec: groupSpec})
+	}
+	return spec, nil
+}
+
+// UsesTime reports whether the rendered stack needs the time package.
+func (s MiddlewareStackSpec) UsesTime() bool {
+	if s.Base.Timeout > 0 {
+		return true
+	}
+	for _, g := range s.Groups {
+		if g.Timeout > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GoLiteral renders the spec as a core.MiddlewareOptions composite literal.
+func (s MiddlewareSpec) GoLiteral() string {
+	var b strings.Builder
+	b.WriteString("core.MiddlewareOptions{\n")
+	fmt.Fprintf(&b, "Enabled: %s,\n", goStringSlice(s.Enabled))
+	if s.Timeout > 0 {
+		fmt.Fprintf(&b, "Timeout: %s,\n", goDuration(s.Timeout))
+	}
+	if s.Throttle > 0 {
+		fmt.Fprintf(&b, "Throttle: %d,\n", s.Throttle)
+	}
+	if s.CompressLevel > 0 {
+		fmt.Fprintf(&b, "CompressLevel: %d,\n", s.CompressLevel)
+	}
+	if c := s.CORS; c != nil {
+		b.WriteString("CORS: core.CORSOptions{\n")
+		if len(c.AllowedOrigins) > 0 {
+			fmt.Fprintf(&b, "AllowedOrigins: %s,\n", goStringSlice(c.AllowedOrigins))
+		}
+		if len(c.AllowedMethods) > 0 {
+			fmt.Fprintf(&b, "AllowedMethods: %s,\n", goStringSlice(c.AllowedMethods))
+		}
+		if len(c.AllowedHeaders) > 0 {
+			fmt.Fprintf(&b, "AllowedHeaders: %s,\n", goStringSlice(c.AllowedHeaders))
+		}
+		if c.AllowCredentials {
+			b.WriteString("AllowCredentials: true,\n")
+		}
+		if c.MaxAge > 0 {
+			fmt.Fprintf(&b, "MaxAge: %d,\n", c.MaxAge)
+		}
+		b.WriteString("},\n")
+	}
+	if s.BodyLimit > 0 {
+		fmt.Fprintf(&b, "BodyLimit: %d,\n", s.BodyLimit)
+	}
+	if s.HeartbeatPath != "" {
+		fmt.Fprintf(&b, "HeartbeatPath: %q,\n", s.HeartbeatPath)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+type middlewareState struct {
+	enabled map[string]bool
+	spec    MiddlewareSpec
+}
+
+func (st middlewareState) clone() middlewareState {
+	enabled := make(map[string]bool, len(st.enabled))
+	for name, on := range st.enabled {
+		enabled[name] = on
+	}
+	return middlewareState{enabled: enabled, spec: st.spec}
+}
+
+// apply overlays settings: values replace inherited ones and enable their
+// middleware, additional enables and disable removes.
+func (st *middlewareState) apply(s MiddlewareSettings) error {
+	disabled := map[string]bool{}
+	for _, name := range s.Disable {
+		if !isMiddlewareName(name) {
+			return fmt.Errorf("unknown middleware %q in disable", name)
+		}
+		if name == "recoverer" {
+			return fmt.Errorf("recoverer cannot be disabled")
+		}
+		disabled[name] = true
+	}
+	for _, name := range s.Additional {
+		if !isMiddlewareName(name) {
+			return fmt.Errorf("unknown middleware %q in additional", name)
+		}
+		if disabled[name] {
+			return fmt.Errorf("middleware %q is both added and disabled", name)
+		}
+		st.enabled[name] = true
+	}
+
+	if s.Timeout != "" {
+		d, err := time.ParseDuration(s.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", s.Timeout)
+		}
+		st.spec.Timeout = d
+		st.enabled["timeout"] = true
+	}
+	if s.Throttle < 0 {
+		return fmt.Errorf("throttle must be positive, got %d", s.Throttle)
+	}
+	if s.Throttle > 0 {
+		st.spec.Throttle = s.Throttle
+		st.enabled["throttle"] = true
+	}
+	if s.StripSlashes {
+		st.enabled["strip_slashes"] = true
+	}
+	if s.Heartbeat != nil {
+		if !strings.HasPrefix(s.Heartbeat.Path, "/") {
+			return fmt.Errorf("heartbeat path %q must start with /", s.Heartbeat.Path)
+		}
+		st.spec.HeartbeatPath = s.Heartbeat.Path
+		st.enabled["heartbeat"] = true
+	}
+	if s.Compress != 0 {
+		if s.Compress < 1 || s.Compress > 9 {
+			return fmt.Errorf("compress level must be between 1 and 9, got %d", s.Compress)
+		}
+		st.spec.CompressLevel = s.Compress
+		st.enabled["compress"] = true
+	}
+	if s.CORS != nil {
+		st.spec.CORS = s.CORS
+		st.enabled["cors"] = true
+	}
+	if s.BodyLimit != "" {
+		n, err := parseByteSize(s.BodyLimit)
+		if err != nil {
+			return err
+		}
+		st.spec.BodyLimit = n
+		st.enabled["body_limit"] = true
+	}
+
+	for name := range disabled {
+		delete(st.enabled, name)
+	}
+	return nil
+}
+
+// build checks that enabled middlewares have their settings and lists them
+// in chain order.
+func (st middlewareState) build() (MiddlewareSpec, error) {
+	spec := st.spec
+	spec.Enabled = nil
+	for _, name := range middlewareNames {
+		if st.enabled[name] {
+			spec.Enabled = append(spec.Enabled, name)
+		}
+	}
+
+	// Settings of disabled middlewares are dropped so they are not rendered.
+	if !st.enabled["timeout"] {
+		spec.Timeout = 0
+	}
+	if !st.enabled["throttle"] {
+		spec.Throttle = 0
+	}
+	if !st.enabled["body_limit"] {
+		spec.BodyLimit = 0
+	}
+	if !st.enabled["heartbeat"] {
+		spec.HeartbeatPath = ""
+	}
+	switch {
+	case !st.enabled["compress"]:
+		spec.CompressLevel = 0
+	case spec.CompressLevel == 0:
+		spec.CompressLevel = 5
+	}
+	switch {
+	case !st.enabled["cors"]:
+		spec.CORS = nil
+	case spec.CORS == nil:
+		spec.CORS = &CORSConfig{}
+	}
+
+	switch {
+	case st.enabled["timeout"] && spec.Timeout == 0:
+		return MiddlewareSpec{}, fmt.Errorf("timeout is enabled without a duration")
+	case st.enabled["throttle"] && spec.Throttle == 0:
+		return MiddlewareSpec{}, fmt.Errorf("throttle is enabled without a limit")
+	case st.enabled["body_limit"] && spec.BodyLimit == 0:
+		return MiddlewareSpec{}, fmt.Errorf("body_limit is enabled without a size")
+	case st.enabled["heartbeat"] && spec.HeartbeatPath == "":
+		return MiddlewareSpec{}, fmt.Errorf("heartbeat is enabled without a path")
+	}
+	return spec, nil
+}
+
+func isMiddlewareName(name string) bool {
+	for _, n := range middlewareNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseByteSize parses sizes like "512", "64KB" or "1MB" (powers of 1024).
+func parseByteSize(s string) (int64, error) {
+	// Longest suffixes first so "MB" is not read as "B".
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(value, u.suffix) {
+			multiplier = u.multiplier
+			value = strings.TrimSpace(strings.TrimSuffix(value, u.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// goDuration renders d as a Go expression using the largest exact unit.
+func goDuration(d time.Duration) string {
+	units := []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+	}
+	for _, u := range units {
+		if d%u.d == 0 {
+			return fmt.Sprintf("%d * %s", d/u.d, u.name)
+		}
+	}
+	return fmt.Sprintf("time.Duration(%d)", int64(d))
+}
+
+func goStringSlice(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[]string{" + strings.Join(quoted, ", ") + "}"
+}
@@ -0,0 +1,140 @@
+package hatmax
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveMiddlewaresDefaults(t *testing.T) {
+	spec, err := ResolveMiddlewares(nil, Service{})
+	if err != nil {
+		t.Fatalf("ResolveMiddlewares() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(spec.Base.Enabled, defaultMiddlewares) {
+		t.Errorf("Enabled = %v, want %v", spec.Base.Enabled, defaultMiddlewares)
+	}
+	if spec.UsesTime() {
+		t.Error("UsesTime() = true without timeouts")
+	}
+}
+
+func TestResolveMiddlewaresOverrides(t *testing.T) {
+	global := &MiddlewareConfig{
+		Global: MiddlewareSettings{
+			Timeout:  "30s",
+			Throttle: 100,
+		},
+	}
+	service := Service{
+		Middlewares: &MiddlewareSettings{
+			Timeout:    "10s",
+			Additional: []string{"compress"},
+			Disable:    []string{"logger", "throttle"},
+		},
+		API: &APIConfig{
+			Middlewares: []RouteMiddlewares{
+				{Path: "/items/bulk", MiddlewareSettings: MiddlewareSettings{Timeout: "1m", BodyLimit: "2MB"}},
+			},
+		},
+	}
+
+	spec, err := ResolveMiddlewares(global, service)
+	if err != nil {
+		t.Fatalf("ResolveMiddlewares() error = %v", err)
+	}
+
+	wantBase := []string{"recoverer", "request_id", "real_ip", "timeout", "compress"}
+	if !reflect.DeepEqual(spec.Base.Enabled, wantBase) {
+		t.Errorf("base Enabled = %v, want %v", spec.Base.Enabled, wantBase)
+	}
+	if spec.Base.Timeout != 10*time.Second || spec.Base.Throttle != 0 || spec.Base.CompressLevel != 5 {
+		t.Errorf("base = %+v, want 10s timeout, no throttle, compress level 5", spec.Base)
+	}
+
+	if len(spec.Groups) != 1 {
+		t.Fatalf("Groups = %+v, want one group", spec.Groups)
+	}
+	group := spec.Groups[0]
+	wantGroup := []string{"recoverer", "request_id", "real_ip", "timeout", "compress", "body_limit"}
+	if !reflect.DeepEqual(group.Enabled, wantGroup) {
+		t.Errorf("group Enabled = %v, want %v", group.Enabled, wantGroup)
+	}
+	if group.Timeout != time.Minute || group.BodyLimit != 2<<20 {
+		t.Errorf("group = %+v, want 1m timeout and 2MB body limit", group.MiddlewareSpec)
+	}
+}
+
+func TestResolveMiddlewaresErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		global   *MiddlewareConfig
+		settings MiddlewareSettings
+	}{
+		{"unknown default", &MiddlewareConfig{Global: MiddlewareSettings{Defaults: []string{"gzip"}}}, MiddlewareSettings{}},
+		{"unknown additional", nil, MiddlewareSettings{Additional: []string{"route_headers"}}},
+		{"disable recoverer", nil, MiddlewareSettings{Disable: []string{"recoverer"}}},
+		{"add and disable", nil, MiddlewareSettings{Additional: []string{"logger"}, Disable: []string{"logger"}}},
+		{"invalid timeout", nil, MiddlewareSettings{Timeout: "soon"}},
+		{"negative throttle", nil, MiddlewareSettings{Throttle: -1}},
+		{"heartbeat path", nil, MiddlewareSettings{Heartbeat: &HeartbeatConfig{Path: "health"}}},
+		{"compress level", nil, MiddlewareSettings{Compress: 12}},
+		{"body limit", nil, MiddlewareSettings{BodyLimit: "lots"}},
+		{"timeout without duration", nil, MiddlewareSettings{Additional: []string{"timeout"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := tt.settings
+			if _, err := ResolveMiddlewares(tt.global, Service{Middlewares: &settings}); err == nil {
+				t.Error("ResolveMiddlewares() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMiddlewareSpecGoLiteral(t *testing.T) {
+	spec := MiddlewareSpec{
+		Enabled:       []string{"recoverer", "timeout", "cors", "heartbeat"},
+		Timeout:       90 * time.Second,
+		CORS:          &CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true},
+		HeartbeatPath: "/health",
+	}
+
+	got := spec.GoLiteral()
+	for _, want := range []string{
+		`Enabled: []string{"recoverer", "timeout", "cors", "heartbeat"},`,
+		"Timeout: 90 * time.Second,",
+		`AllowedOrigins: []string{"https://app.example.com"},`,
+		"AllowCredentials: true,",
+		`HeartbeatPath: "/health",`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("GoLiteral() missing %q\n%s", want, got)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"512", 512, false},
+		{"64KB", 64 << 10, false},
+		{"1 mb", 1 << 20, false},
+		{"2GB", 2 << 30, false},
+		{"0", 0, true},
+		{"MB", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
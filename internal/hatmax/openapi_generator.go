@@ -0,0 +1,499 @@
+package hatmax
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const openAPIVersion = "3.1.0"
+
+// OpenAPIGenerator renders the OpenAPI document of a generated service.
+type OpenAPIGenerator struct {
+	Config      *Config
+	OutputDir   string
+	ServiceName string
+	Service     *Service
+}
+
+// OpenAPIDocument is the subset of the OpenAPI 3.1 object model hatmax emits.
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `yaml:"openapi"`
+	Info       OpenAPIInfo                             `yaml:"info"`
+	Tags       []OpenAPITag                            `yaml:"tags,omitempty"`
+	Security   []map[string][]string                   `yaml:"security,omitempty"`
+	Paths      map[string]map[string]*OpenAPIOperation `yaml:"paths"`
+	Components OpenAPIComponents                       `yaml:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `yaml:"title"`
+	Version string `yaml:"version"`
+}
+
+type OpenAPITag struct {
+	Name string `yaml:"name"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `yaml:"operationId"`
+	Summary     string                      `yaml:"summary,omitempty"`
+	Tags        []string                    `yaml:"tags,omitempty"`
+	HandlerID   string                      `yaml:"x-handler-id,omitempty"`
+	Parameters  []OpenAPIParameter          `yaml:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `yaml:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `yaml:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name     string         `yaml:"name"`
+	In       string         `yaml:"in"`
+	Required bool           `yaml:"required"`
+	Schema   *OpenAPISchema `yaml:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                        `yaml:"required"`
+	Content  map[string]OpenAPIMediaType `yaml:"content"`
+}
+
+type OpenAPIResponse struct {
+	Ref         string                      `yaml:"$ref,omitempty"`
+	Description string                      `yaml:"description,omitempty"`
+	Content     map[string]OpenAPIMediaType `yaml:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `yaml:"schema"`
+}
+
+type OpenAPISchema struct {
+	Ref         string                    `yaml:"$ref,omitempty"`
+	Type        string                    `yaml:"type,omitempty"`
+	Format      string                    `yaml:"format,omitempty"`
+	Description string                    `yaml:"description,omitempty"`
+	Properties  map[string]*OpenAPISchema `yaml:"properties,omitempty"`
+	Required    []string                  `yaml:"required,omitempty"`
+	Items       *OpenAPISchema            `yaml:"items,omitempty"`
+	AllOf       []*OpenAPISchema          `yaml:"allOf,omitempty"`
+	Enum        []string                  `yaml:"enum,omitempty"`
+	Default     any                       `yaml:"default,omitempty"`
+	MinLength   *int                      `yaml:"minLength,omitempty"`
+	MaxLength   *int                      `yaml:"maxLength,omitempty"`
+	ReadOnly    bool                      `yaml:"readOnly,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema        `yaml:"schemas"`
+	Responses       map[string]*OpenAPIResponse      `yaml:"responses"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `yaml:"securitySchemes,omitempty"`
+}
+
+type OpenAPISecurityScheme struct {
+	Type         string `yaml:"type"`
+	Scheme       string `yaml:"scheme"`
+	BearerFormat string `yaml:"bearerFormat,omitempty"`
+	Description  string `yaml:"description,omitempty"`
+}
+
+func NewOpenAPIGenerator(config *Config, outputDir, serviceName string, service *Service) *OpenAPIGenerator {
+	return &OpenAPIGenerator{
+		Config:      config,
+		OutputDir:   outputDir,
+		ServiceName: serviceName,
+		Service:     service,
+	}
+}
+
+// Generate writes openapi.yaml at the root of the service directory, next to main.go,
+// so the service can embed and serve it.
+func (og *OpenAPIGenerator) Generate() error {
+	doc, err := BuildOpenAPIDocument(og.ServiceName, *og.Service)
+	if err != nil {
+		return fmt.Errorf("cannot build OpenAPI document: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by hatmax. Do not edit.\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("cannot marshal OpenAPI document: %w", err)
+	}
+	enc.Close()
+
+	if err := os.MkdirAll(og.OutputDir, 0o755); err != nil {
+		return fmt.Errorf("cannot create directory %s: %w", og.OutputDir, err)
+	}
+
+	specPath := filepath.Join(og.OutputDir, "openapi.yaml")
+	if err := os.WriteFile(specPath, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("cannot write %s: %w", specPath, err)
+	}
+
+	fmt.Printf("  - Created %s\n", specPath)
+	return nil
+}
+
+// BuildOpenAPIDocument describes the routes, schemas and envelopes of a generated service.
+func BuildOpenAPIDocument(serviceName string, service Service) (*OpenAPIDocument, error) {
+	doc := &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: OpenAPIInfo{
+			Title:   serviceName,
+			Version: "0.1.0",
+		},
+		Paths: map[string]map[string]*OpenAPIOperation{},
+		Components: OpenAPIComponents{
+			Schemas:   envelopeSchemas(),
+			Responses: sharedResponses(),
+		},
+	}
+
+	for _, aggName := range sortedAggregateNames(service) {
+		agg := service.Aggregates[aggName]
+		schema, err := aggregateSchema(aggName, agg, service)
+		if err != nil {
+			return nil, err
+		}
+		doc.Components.Schemas[aggName] = schema
+		doc.Components.Schemas[aggName+"Input"] = inputSchema(aggName, schema)
+	}
+
+	for _, modelName := range sortedModelNames(service) {
+		schema := modelSchema(service.Models[modelName], isPartOfAggregate(modelName, service.Aggregates))
+		doc.Components.Schemas[modelName] = schema
+		doc.Components.Schemas[modelName+"Input"] = inputSchema(modelName, schema)
+	}
+
+	secured := service.Auth != nil && service.Auth.Enabled
+	if secured {
+		scopes, _ := service.Auth.Scopes()
+		doc.Security = []map[string][]string{{"bearerAuth": scopes}}
+		doc.Components.SecuritySchemes = map[string]OpenAPISecurityScheme{
+			"bearerAuth": {
+				Type:         "http",
+				Scheme:       "bearer",
+				BearerFormat: "PASETO",
+				Description:  "Access token issued by the authn service.",
+			},
+		}
+	}
+
+	seenTags := map[string]bool{}
+	for _, route := range ServiceRoutes(service) {
+		for _, tag := range route.Tags {
+			if !seenTags[tag] {
+				seenTags[tag] = true
+				doc.Tags = append(doc.Tags, OpenAPITag{Name: tag})
+			}
+		}
+
+		if doc.Paths[route.Path] == nil {
+			doc.Paths[route.Path] = map[string]*OpenAPIOperation{}
+		}
+		doc.Paths[route.Path][strings.ToLower(route.Method)] = buildOperation(route, secured)
+	}
+
+	return doc, nil
+}
+
+func buildOperation(route RouteSpec, secured bool) *OpenAPIOperation {
+	op := &OpenAPIOperation{
+		OperationID: route.OperationID,
+		Summary:     route.Summary,
+		Tags:        route.Tags,
+		HandlerID:   route.HandlerID,
+		Responses:   map[string]*OpenAPIResponse{},
+	}
+
+	for _, name := range pathParams(route.Path) {
+		op.Parameters = append(op.Parameters, OpenAPIParameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &OpenAPISchema{Type: "string", Format: "uuid"},
+		})
+	}
+
+	// Child routes take and return the child resource, not the aggregate.
+	if route.Op == OpCreate || route.Op == OpUpdate {
+		op.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content: map[string]OpenAPIMediaType{
+				"application/json": {Schema: schemaRef(route.Resource + "Input")},
+			},
+		}
+		op.Responses["400"] = responseRef("BadRequest")
+	}
+
+	status := strconv.Itoa(route.Status)
+	switch {
+	case route.Status == http.StatusNoContent:
+		op.Responses[status] = &OpenAPIResponse{Description: http.StatusText(route.Status)}
+	case route.List:
+		op.Responses[status] = successResponse(http.StatusText(route.Status), &OpenAPISchema{Type: "array", Items: schemaRef(route.Resource)})
+	default:
+		op.Responses[status] = successResponse(http.StatusText(route.Status), schemaRef(route.Resource))
+	}
+
+	if len(op.Parameters) > 0 {
+		op.Responses["404"] = responseRef("NotFound")
+	}
+	if secured {
+		op.Responses["401"] = responseRef("Unauthorized")
+	}
+	op.Responses["500"] = responseRef("InternalError")
+
+	return op
+}
+
+func successResponse(description string, data *OpenAPISchema) *OpenAPIResponse {
+	return &OpenAPIResponse{
+		Description: description,
+		Content: map[string]OpenAPIMediaType{
+			"application/json": {
+				Schema: &OpenAPISchema{
+					AllOf: []*OpenAPISchema{
+						schemaRef("SuccessResponse"),
+						{
+							Type:       "object",
+							Properties: map[string]*OpenAPISchema{"data": data},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func aggregateSchema(name string, agg AggregateRoot, service Service) (*OpenAPISchema, error) {
+	schema := &OpenAPISchema{
+		Type:       "object",
+		Properties: map[string]*OpenAPISchema{"id": idSchema()},
+	}
+	addFieldSchemas(schema, agg.Fields)
+
+	if agg.VersionField != "" {
+		schema.Properties[agg.VersionField] = &OpenAPISchema{Type: "integer", ReadOnly: true}
+	}
+	if agg.Audit {
+		addAuditSchemas(schema, false)
+	}
+
+	for _, childKey := range sortedChildKeys(agg) {
+		child := agg.Children[childKey]
+		if _, ok := service.Models[child.Of]; !ok {
+			return nil, fmt.Errorf("child model %s of aggregate %s not found in service models", child.Of, name)
+		}
+		schema.Properties[toSnakeCase(childKey)] = &OpenAPISchema{
+			Type:     "array",
+			Items:    schemaRef(child.Of),
+			ReadOnly: true,
+		}
+	}
+
+	return schema, nil
+}
+
+func modelSchema(model Model, child bool) *OpenAPISchema {
+	schema := &OpenAPISchema{
+		Type:       "object",
+		Properties: map[string]*OpenAPISchema{"id": idSchema()},
+	}
+	addFieldSchemas(schema, model.Fields)
+
+	if model.Options != nil && model.Options.Audit {
+		// Aggregate children carry the actor as a plain string, standalone models as a UUID.
+		addAuditSchemas(schema, !child)
+	}
+
+	return schema
+}
+
+// inputSchema is the request body variant of a resource: writable fields only.
+func inputSchema(name string, schema *OpenAPISchema) *OpenAPISchema {
+	input := &OpenAPISchema{
+		Type:        "object",
+		Description: name + " fields accepted on create and update.",
+		Properties:  map[string]*OpenAPISchema{},
+		Required:    schema.Required,
+	}
+	for propName, prop := range schema.Properties {
+		if !prop.ReadOnly {
+			input.Properties[propName] = prop
+		}
+	}
+	return input
+}
+
+func addFieldSchemas(schema *OpenAPISchema, fields map[string]Field) {
+	for _, fieldName := range sortedFieldNames(fields) {
+		field := fields[fieldName]
+		jsonName := toSnakeCase(fieldName)
+		prop := fieldSchema(field)
+		schema.Properties[jsonName] = prop
+
+		for _, v := range field.Validations {
+			if v.Name == "required" {
+				schema.Required = append(schema.Required, jsonName)
+			}
+		}
+	}
+}
+
+func fieldSchema(field Field) *OpenAPISchema {
+	prop := &OpenAPISchema{}
+	switch field.Type {
+	case "text", "string":
+		prop.Type = "string"
+	case "email":
+		prop.Type = "string"
+		prop.Format = "email"
+	case "bool":
+		prop.Type = "boolean"
+	case "uuid":
+		prop.Type = "string"
+		prop.Format = "uuid"
+	}
+
+	if field.Default != nil {
+		prop.Default = field.Default
+	}
+
+	for _, v := range field.Validations {
+		switch v.Name {
+		case "min_length":
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				prop.MinLength = &n
+			}
+		case "max_length":
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				prop.MaxLength = &n
+			}
+		case "is_email":
+			prop.Format = "email"
+		case "one_of":
+			prop.Enum = splitOneOf(v.Value)
+		}
+	}
+
+	return prop
+}
+
+func addAuditSchemas(schema *OpenAPISchema, uuidActor bool) {
+	actor := &OpenAPISchema{Type: "string", ReadOnly: true}
+	if uuidActor {
+		actor.Format = "uuid"
+	}
+	updatedBy := *actor
+
+	schema.Properties["created_at"] = &OpenAPISchema{Type: "string", Format: "date-time", ReadOnly: true}
+	schema.Properties["updated_at"] = &OpenAPISchema{Type: "string", Format: "date-time", ReadOnly: true}
+	schema.Properties["created_by"] = actor
+	schema.Properties["updated_by"] = &updatedBy
+}
+
+func envelopeSchemas() map[string]*OpenAPISchema {
+	return map[string]*OpenAPISchema{
+		"Link": {
+			Type:     "object",
+			Required: []string{"rel", "href"},
+			Properties: map[string]*OpenAPISchema{
+				"rel":  {Type: "string"},
+				"href": {Type: "string"},
+			},
+		},
+		"SuccessResponse": {
+			Type:     "object",
+			Required: []string{"data"},
+			Properties: map[string]*OpenAPISchema{
+				"data":  {},
+				"meta":  {Type: "object"},
+				"links": {Type: "array", Items: schemaRef("Link")},
+			},
+		},
+		"ValidationError": {
+			Type:     "object",
+			Required: []string{"field", "code", "message"},
+			Properties: map[string]*OpenAPISchema{
+				"field":   {Type: "string"},
+				"code":    {Type: "string"},
+				"message": {Type: "string"},
+			},
+		},
+		"ErrorPayload": {
+			Type:     "object",
+			Required: []string{"code", "message"},
+			Properties: map[string]*OpenAPISchema{
+				"code":    {Type: "string"},
+				"message": {Type: "string"},
+				"details": {Type: "array", Items: schemaRef("ValidationError")},
+			},
+		},
+		"ErrorResponse": {
+			Type:     "object",
+			Required: []string{"error"},
+			Properties: map[string]*OpenAPISchema{
+				"error": schemaRef("ErrorPayload"),
+			},
+		},
+	}
+}
+
+func sharedResponses() map[string]*OpenAPIResponse {
+	errorResponse := func(description string) *OpenAPIResponse {
+		return &OpenAPIResponse{
+			Description: description,
+			Content: map[string]OpenAPIMediaType{
+				"application/json": {Schema: schemaRef("ErrorResponse")},
+			},
+		}
+	}
+
+	return map[string]*OpenAPIResponse{
+		"BadRequest":    errorResponse("Invalid request body or validation failure"),
+		"Unauthorized":  errorResponse("Missing or invalid bearer token"),
+		"NotFound":      errorResponse("Resource not found"),
+		"InternalError": errorResponse("Unexpected server error"),
+	}
+}
+
+func idSchema() *OpenAPISchema {
+	return &OpenAPISchema{Type: "string", Format: "uuid", ReadOnly: true}
+}
+
+func schemaRef(name string) *OpenAPISchema {
+	return &OpenAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func responseRef(name string) *OpenAPIResponse {
+	return &OpenAPIResponse{Ref: "#/components/responses/" + name}
+}
+
+func pathParams(path string) []string {
+	var params []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params = append(params, strings.Trim(segment, "{}"))
+		}
+	}
+	return params
+}
+
+// splitOneOf parses the comma separated value of a one_of validation rule.
+func splitOneOf(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,181 @@
+package hatmax
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func testTodoService() Service {
+	return Service{
+		Kind: "atom",
+		Auth: &AuthConfig{
+			Enabled:        true,
+			RequiredScopes: []string{"todos:read", "todos:write"},
+		},
+		Models: map[string]Model{
+			"Item": {
+				Fields: map[string]Field{
+					"text": {Type: "text", Validations: []ValidationRule{{Name: "required"}}},
+					"done": {Type: "bool", Default: false},
+				},
+				Options: &ModelOptions{Audit: true},
+			},
+			"Note": {
+				Fields: map[string]Field{
+					"body":     {Type: "text", Validations: []ValidationRule{{Name: "required"}, {Name: "max_length", Value: "280"}}},
+					"priority": {Type: "string", Validations: []ValidationRule{{Name: "one_of", Value: "low, normal,high"}}},
+					"contact":  {Type: "email"},
+				},
+			},
+		},
+		Aggregates: map[string]AggregateRoot{
+			"List": {
+				Fields: map[string]Field{
+					"name": {Type: "string", Validations: []ValidationRule{{Name: "required"}}},
+				},
+				Audit: true,
+				Children: map[string]ChildCollection{
+					"items": {Of: "Item"},
+				},
+			},
+		},
+		API: &APIConfig{
+			Handlers: []Handler{
+				{ID: "todo_lists_get", Route: "get /lists/{id}", Summary: "Fetch a list"},
+				{ID: "todo_unmounted", Route: "GET /nowhere"},
+			},
+		},
+	}
+}
+
+func TestHandlerParseRoute(t *testing.T) {
+	tests := []struct {
+		route      string
+		wantMethod string
+		wantPath   string
+	}{
+		{"GET /items", "GET", "/items"},
+		{"patch /items/{id}", "PATCH", "/items/{id}"},
+		{"/items", "", "/items"},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			h := Handler{Route: tt.route}
+			method, path := h.ParseRoute()
+			if method != tt.wantMethod || path != tt.wantPath {
+				t.Errorf("ParseRoute() = (%q, %q), want (%q, %q)", method, path, tt.wantMethod, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestServiceRoutes(t *testing.T) {
+	routes := ServiceRoutes(testTodoService())
+
+	byOperation := map[string]RouteSpec{}
+	for _, r := range routes {
+		byOperation[r.OperationID] = r
+	}
+
+	tests := []struct {
+		operationID string
+		method      string
+		path        string
+		status      int
+		handlerID   string
+	}{
+		{"CreateList", "POST", "/lists", http.StatusCreated, ""},
+		{"GetAllLists", "GET", "/lists", http.StatusOK, ""},
+		{"GetList", "GET", "/lists/{id}", http.StatusOK, "todo_lists_get"},
+		{"AddItemToList", "POST", "/lists/{id}/items", http.StatusCreated, ""},
+		{"UpdateItemInList", "PUT", "/lists/{id}/items/{childId}", http.StatusOK, ""},
+		{"RemoveItemFromList", "DELETE", "/lists/{id}/items/{childId}", http.StatusNoContent, ""},
+		{"CreateNote", "POST", "/notes", http.StatusCreated, ""},
+		{"DeleteNote", "DELETE", "/notes/{id}", http.StatusNoContent, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.operationID, func(t *testing.T) {
+			r, ok := byOperation[tt.operationID]
+			if !ok {
+				t.Fatalf("route %s not found", tt.operationID)
+			}
+			if r.Method != tt.method || r.Path != tt.path {
+				t.Errorf("route = %s %s, want %s %s", r.Method, r.Path, tt.method, tt.path)
+			}
+			if r.Status != tt.status {
+				t.Errorf("status = %d, want %d", r.Status, tt.status)
+			}
+			if r.HandlerID != tt.handlerID {
+				t.Errorf("handler id = %q, want %q", r.HandlerID, tt.handlerID)
+			}
+		})
+	}
+
+	if _, ok := byOperation["CreateItem"]; ok {
+		t.Error("child collection model should not get standalone routes")
+	}
+	if got := byOperation["GetList"].Summary; got != "Fetch a list" {
+		t.Errorf("declared summary not applied, got %q", got)
+	}
+}
+
+func TestBuildOpenAPIDocument(t *testing.T) {
+	doc, err := BuildOpenAPIDocument("todo", testTodoService())
+	if err != nil {
+		t.Fatalf("BuildOpenAPIDocument() error = %v", err)
+	}
+
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %s, want 3.1.0", doc.OpenAPI)
+	}
+
+	wantSecurity := []map[string][]string{{"bearerAuth": {"todos:read", "todos:write"}}}
+	if !reflect.DeepEqual(doc.Security, wantSecurity) {
+		t.Errorf("security = %v, want %v", doc.Security, wantSecurity)
+	}
+
+	note := doc.Components.Schemas["Note"]
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"required", note.Required, []string{"body"}},
+		{"enum", note.Properties["priority"].Enum, []string{"low", "normal", "high"}},
+		{"max length", *note.Properties["body"].MaxLength, 280},
+		{"email format", note.Properties["contact"].Format, "email"},
+		{"id read only", note.Properties["id"].ReadOnly, true},
+		{"standalone audit actor", doc.Components.Schemas["Item"].Properties["created_by"].Format, ""},
+		{"list children", doc.Components.Schemas["List"].Properties["items"].Items.Ref, "#/components/schemas/Item"},
+		{"input omits read only", doc.Components.Schemas["ListInput"].Properties["items"], (*OpenAPISchema)(nil)},
+		{"create status", doc.Paths["/notes"]["post"].Responses["201"] != nil, true},
+		{"delete no content", doc.Paths["/notes/{id}"]["delete"].Responses["204"].Content, map[string]OpenAPIMediaType(nil)},
+		{"unauthorized", doc.Paths["/lists"]["get"].Responses["401"].Ref, "#/components/responses/Unauthorized"},
+		{"handler id", doc.Paths["/lists/{id}"]["get"].HandlerID, "todo_lists_get"},
+		{"path params", len(doc.Paths["/lists/{id}/items/{childId}"]["put"].Parameters), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildOpenAPIDocumentMissingChildModel(t *testing.T) {
+	service := Service{
+		Aggregates: map[string]AggregateRoot{
+			"List": {Children: map[string]ChildCollection{"items": {Of: "Item"}}},
+		},
+	}
+
+	if _, err := BuildOpenAPIDocument("todo", service); err == nil {
+		t.Error("expected error for undeclared child model")
+	}
+}
@@ -0,0 +1,150 @@
+package hatmax
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RouteCatalogEntry mirrors core.RouteInfo, the shape served by /.well-known/routes.
+type RouteCatalogEntry struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	HandlerID   string   `json:"handler_id,omitempty"`
+	Summary     string   `json:"summary,omitempty"`
+	Auth        bool     `json:"auth"`
+	Scopes      []string `json:"scopes,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	ScopeType   string   `json:"scope_type,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Exposed     bool     `json:"exposed"`
+}
+
+// ServiceRouteCatalog lists the routes of one service in the monorepo catalog.
+type ServiceRouteCatalog struct {
+	Service  string              `json:"service"`
+	BasePath string              `json:"base_path,omitempty"`
+	Routes   []RouteCatalogEntry `json:"routes"`
+}
+
+// MonorepoRouteCatalog is the build time catalog of every generated service.
+type MonorepoRouteCatalog struct {
+	Services []ServiceRouteCatalog `json:"services"`
+}
+
+// BuildRouteCatalog returns the generated and virtual routes of a service.
+func BuildRouteCatalog(service Service) []RouteCatalogEntry {
+	auth := service.Auth != nil && service.Auth.Enabled
+	var scopes []string
+	if auth {
+		scopes, _ = service.Auth.Scopes()
+	}
+
+	entry := func(r RouteSpec, exposed bool) RouteCatalogEntry {
+		e := RouteCatalogEntry{
+			Method:    r.Method,
+			Path:      r.Path,
+			HandlerID: r.HandlerID,
+			Summary:   r.Summary,
+			Auth:      auth,
+			Scopes:    scopes,
+			Tags:      r.Tags,
+			Exposed:   exposed,
+		}
+		if auth {
+			e.Permissions = routePermissions(r, scopes)
+			e.ScopeType = r.ScopeType
+		}
+		return e
+	}
+
+	entries := []RouteCatalogEntry{}
+	for _, r := range ServiceRoutes(service) {
+		entries = append(entries, entry(r, true))
+	}
+	for _, r := range VirtualRoutes(service) {
+		entries = append(entries, entry(r, false))
+	}
+	return entries
+}
+
+// routePermissions lists the permissions core.Authorizer checks on a route: its
+// own permission and the required scopes that apply to its method.
+func routePermissions(r RouteSpec, requiredScopes []string) []string {
+	var permissions []string
+	add := func(p string) {
+		if p != "" && !contains(permissions, p) {
+			permissions = append(permissions, p)
+		}
+	}
+
+	add(r.Permission)
+	for _, scope := range requiredScopes {
+		switch {
+		case strings.HasSuffix(scope, ":read") && r.Method != http.MethodGet:
+		case strings.HasSuffix(scope, ":write") && r.Method == http.MethodGet:
+		default:
+			add(scope)
+		}
+	}
+	return permissions
+}
+
+// GenerateServiceRouteCatalog writes services/<service>/routes.json, embedded
+// by the service main and served by core.RouteCatalog.
+func GenerateServiceRouteCatalog(outputDir, serviceName string, service Service) error {
+	filePath := filepath.Join(outputDir, "services", serviceName, "routes.json")
+	if err := writeJSONFile(filePath, BuildRouteCatalog(service)); err != nil {
+		return fmt.Errorf("cannot write route catalog for service %s: %w", serviceName, err)
+	}
+	logCreated(filePath)
+	return nil
+}
+
+// GenerateMonorepoRouteCatalog writes routes.json at the monorepo root with the
+// routes of every spec generated service.
+func GenerateMonorepoRouteCatalog(outputDir string, config Config) error {
+	names := make([]string, 0, len(config.Services))
+	for name := range config.Services {
+		if isStaticService(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	catalog := MonorepoRouteCatalog{Services: []ServiceRouteCatalog{}}
+	for _, name := range names {
+		service := config.Services[name]
+		entry := ServiceRouteCatalog{
+			Service: name,
+			Routes:  BuildRouteCatalog(service),
+		}
+		if service.API != nil {
+			entry.BasePath = service.API.BasePath
+		}
+		catalog.Services = append(catalog.Services, entry)
+	}
+
+	filePath := filepath.Join(outputDir, "routes.json")
+	if err := writeJSONFile(filePath, catalog); err != nil {
+		return fmt.Errorf("cannot write monorepo route catalog: %w", err)
+	}
+	logCreated(filePath)
+	return nil
+}
+
+func writeJSONFile(filePath string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,132 @@
+package hatmax
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVirtualRoutes(t *testing.T) {
+	routes := VirtualRoutes(testTodoService())
+
+	if len(routes) != 1 {
+		t.Fatalf("VirtualRoutes() returned %d routes, want 1: %+v", len(routes), routes)
+	}
+	if got := routes[0]; got.Method != "GET" || got.Path != "/nowhere" || got.HandlerID != "todo_unmounted" {
+		t.Errorf("VirtualRoutes()[0] = %+v, want GET /nowhere todo_unmounted", got)
+	}
+
+	if routes := VirtualRoutes(Service{}); routes != nil {
+		t.Errorf("VirtualRoutes() without api = %+v, want nil", routes)
+	}
+}
+
+func TestBuildRouteCatalog(t *testing.T) {
+	entries := BuildRouteCatalog(testTodoService())
+
+	byKey := map[string]RouteCatalogEntry{}
+	for _, e := range entries {
+		byKey[e.Method+" "+e.Path] = e
+	}
+
+	get, ok := byKey["GET /lists/{id}"]
+	if !ok {
+		t.Fatal("GET /lists/{id} not in catalog")
+	}
+	if !get.Exposed || get.HandlerID != "todo_lists_get" || get.Summary != "Fetch a list" {
+		t.Errorf("GET /lists/{id} = %+v, want exposed todo_lists_get", get)
+	}
+	if !get.Auth || !reflect.DeepEqual(get.Scopes, []string{"todos:read", "todos:write"}) {
+		t.Errorf("GET /lists/{id} auth = %v %v, want required scopes", get.Auth, get.Scopes)
+	}
+
+	if !reflect.DeepEqual(get.Permissions, []string{"lists:read", "todos:read"}) || get.ScopeType != "list" {
+		t.Errorf("GET /lists/{id} permissions = %v on %q, want [lists:read todos:read] on list", get.Permissions, get.ScopeType)
+	}
+	if item := byKey["PUT /lists/{id}/items/{childId}"]; !reflect.DeepEqual(item.Permissions, []string{"lists:write", "todos:write"}) || item.ScopeType != "list" {
+		t.Errorf("PUT item permissions = %v on %q, want [lists:write todos:write] on list", item.Permissions, item.ScopeType)
+	}
+	if create := byKey["POST /notes"]; !reflect.DeepEqual(create.Permissions, []string{"notes:write", "todos:write"}) || create.ScopeType != "" {
+		t.Errorf("POST /notes permissions = %v on %q, want [notes:write todos:write] unscoped", create.Permissions, create.ScopeType)
+	}
+
+	virtual, ok := byKey["GET /nowhere"]
+	if !ok || virtual.Exposed {
+		t.Errorf("GET /nowhere = %+v, want listed and not exposed", virtual)
+	}
+
+	service := testTodoService()
+	service.Auth = nil
+	for _, e := range BuildRouteCatalog(service) {
+		if e.Auth || e.Scopes != nil || e.Permissions != nil {
+			t.Errorf("%s %s auth = %v %v, want public", e.Method, e.Path, e.Auth, e.Scopes)
+		}
+	}
+}
+
+func TestBuildRouteCatalogLegacyScopes(t *testing.T) {
+	service := testTodoService()
+	service.Auth.RequiredScopes = []string{"read:todos", "write:todos", "audit"}
+
+	scopes, legacy := service.Auth.Scopes()
+	if !reflect.DeepEqual(scopes, []string{"todos:read", "todos:write", "audit"}) || !reflect.DeepEqual(legacy, []string{"read:todos", "write:todos"}) {
+		t.Errorf("Scopes() = %v, %v, want resource first scopes and the two legacy ones", scopes, legacy)
+	}
+
+	byKey := map[string]RouteCatalogEntry{}
+	for _, e := range BuildRouteCatalog(service) {
+		byKey[e.Method+" "+e.Path] = e
+	}
+	if get := byKey["GET /lists/{id}"]; !reflect.DeepEqual(get.Permissions, []string{"lists:read", "todos:read", "audit"}) {
+		t.Errorf("GET /lists/{id} permissions = %v, want [lists:read todos:read audit]", get.Permissions)
+	}
+	if create := byKey["POST /notes"]; !reflect.DeepEqual(create.Permissions, []string{"notes:write", "todos:write", "audit"}) {
+		t.Errorf("POST /notes permissions = %v, want [notes:write todos:write audit]", create.Permissions)
+	}
+}
+
+func TestServiceRoutesPermissionOverride(t *testing.T) {
+	service := testTodoService()
+	service.API.Handlers[0].Permission = "view:lists"
+
+	for _, r := range ServiceRoutes(service) {
+		if r.Method == "GET" && r.Path == "/lists/{id}" && r.Permission != "view:lists" {
+			t.Errorf("GET /lists/{id} permission = %q, want view:lists", r.Permission)
+		}
+		if r.Method == "GET" && r.Path == "/lists" && r.Permission != "lists:read" {
+			t.Errorf("GET /lists permission = %q, want lists:read", r.Permission)
+		}
+	}
+}
+
+func TestGenerateMonorepoRouteCatalog(t *testing.T) {
+	outputDir := t.TempDir()
+	config := Config{
+		Services: map[string]Service{
+			"todo":  testTodoService(),
+			"authn": {Kind: "auth"},
+		},
+	}
+
+	if err := GenerateMonorepoRouteCatalog(outputDir, config); err != nil {
+		t.Fatalf("GenerateMonorepoRouteCatalog() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "routes.json"))
+	if err != nil {
+		t.Fatalf("cannot read routes.json: %v", err)
+	}
+
+	var catalog MonorepoRouteCatalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		t.Fatalf("cannot parse routes.json: %v", err)
+	}
+	if len(catalog.Services) != 1 || catalog.Services[0].Service != "todo" {
+		t.Fatalf("services = %+v, want only todo", catalog.Services)
+	}
+	if len(catalog.Services[0].Routes) != len(BuildRouteCatalog(testTodoService())) {
+		t.Errorf("todo routes = %d, want %d", len(catalog.Services[0].Routes), len(BuildRouteCatalog(testTodoService())))
+	}
+}
@@ -0,0 +1,192 @@
+package hatmax
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RouteSpec describes an HTTP route mounted by a generated service handler.
+type RouteSpec struct {
+	Method      string
+	Path        string
+	OperationID string // Name of the generated handler method
+	HandlerID   string // ID of the matching api.handlers entry, if any
+	Summary     string
+	Resource    string // Model or aggregate the route operates on
+	Parent      string // Aggregate name when Resource is a child collection item
+	Collection  string // Child collection key when Parent is set
+	Op          StandardOp
+	List        bool // Response data is a list of Resource
+	Status      int  // Success status code written by the handler
+	Tags        []string
+	Permission  string // Permission checked against authz when auth is enabled
+	ScopeType   string // Authz scope type of the first path parameter, if any
+}
+
+// ServiceRoutes returns the routes mounted by the handlers generated for a service,
+// in the same order they are registered. Declared api.handlers entries whose
+// method and path match a generated route contribute their ID and summary.
+func ServiceRoutes(service Service) []RouteSpec {
+	var routes []RouteSpec
+
+	for _, aggName := range sortedAggregateNames(service) {
+		agg := service.Aggregates[aggName]
+		plural := pluralize(aggName)
+		base := "/" + strings.ToLower(plural)
+		tags := []string{strings.ToLower(plural)}
+
+		routes = append(routes,
+			RouteSpec{Method: "POST", Path: base, OperationID: "Create" + aggName, Summary: "Create " + aggName, Resource: aggName, Op: OpCreate, Status: http.StatusCreated, Tags: tags},
+			RouteSpec{Method: "GET", Path: base, OperationID: "GetAll" + plural, Summary: "List " + plural, Resource: aggName, Op: OpList, List: true, Status: http.StatusOK, Tags: tags},
+			RouteSpec{Method: "GET", Path: base + "/{id}", OperationID: "Get" + aggName, Summary: "Get " + aggName, Resource: aggName, Op: OpGet, Status: http.StatusOK, Tags: tags},
+			RouteSpec{Method: "PUT", Path: base + "/{id}", OperationID: "Update" + aggName, Summary: "Update " + aggName, Resource: aggName, Op: OpUpdate, Status: http.StatusOK, Tags: tags},
+			RouteSpec{Method: "DELETE", Path: base + "/{id}", OperationID: "Delete" + aggName, Summary: "Delete " + aggName, Resource: aggName, Op: OpDelete, Status: http.StatusNoContent, Tags: tags},
+		)
+
+		for _, childKey := range sortedChildKeys(agg) {
+			child := agg.Children[childKey]
+			childBase := base + "/{id}/" + strings.ToLower(childKey)
+			routes = append(routes,
+				RouteSpec{Method: "POST", Path: childBase, OperationID: "Add" + child.Of + "To" + aggName, Summary: "Add " + child.Of + " to " + aggName, Resource: child.Of, Parent: aggName, Collection: childKey, Op: OpCreate, Status: http.StatusCreated, Tags: tags},
+				RouteSpec{Method: "PUT", Path: childBase + "/{childId}", OperationID: "Update" + child.Of + "In" + aggName, Summary: "Update " + child.Of + " in " + aggName, Resource: child.Of, Parent: aggName, Collection: childKey, Op: OpUpdate, Status: http.StatusOK, Tags: tags},
+				RouteSpec{Method: "DELETE", Path: childBase + "/{childId}", OperationID: "Remove" + child.Of + "From" + aggName, Summary: "Remove " + child.Of + " from " + aggName, Resource: child.Of, Parent: aggName, Collection: childKey, Op: OpDelete, Status: http.StatusNoContent, Tags: tags},
+			)
+		}
+	}
+
+	for _, modelName := range sortedModelNames(service) {
+		if isPartOfAggregate(modelName, service.Aggregates) {
+			continue
+		}
+		plural := pluralize(modelName)
+		base := "/" + strings.ToLower(plural)
+		tags := []string{strings.ToLower(plural)}
+
+		routes = append(routes,
+			RouteSpec{Method: "POST", Path: base, OperationID: "Create" + modelName, Summary: "Create " + modelName, Resource: modelName, Op: OpCreate, Status: http.StatusCreated, Tags: tags},
+			RouteSpec{Method: "GET", Path: base, OperationID: "List" + plural, Summary: "List " + plural, Resource: modelName, Op: OpList, List: true, Status: http.StatusOK, Tags: tags},
+			RouteSpec{Method: "GET", Path: base + "/{id}", OperationID: "Get" + modelName, Summary: "Get " + modelName, Resource: modelName, Op: OpGet, Status: http.StatusOK, Tags: tags},
+			RouteSpec{Method: "PUT", Path: base + "/{id}", OperationID: "Update" + modelName, Summary: "Update " + modelName, Resource: modelName, Op: OpUpdate, Status: http.StatusOK, Tags: tags},
+			RouteSpec{Method: "DELETE", Path: base + "/{id}", OperationID: "Delete" + modelName, Summary: "Delete " + modelName, Resource: modelName, Op: OpDelete, Status: http.StatusNoContent, Tags: tags},
+		)
+	}
+
+	for i := range routes {
+		owner := routes[i].Resource
+		if routes[i].Parent != "" {
+			owner = routes[i].Parent
+		}
+		setRouteAuthz(&routes[i], owner)
+	}
+
+	if service.API == nil {
+		return routes
+	}
+
+	for _, h := range service.API.Handlers {
+		method, path := h.ParseRoute()
+		for i := range routes {
+			if routes[i].Method != method || routes[i].Path != path {
+				continue
+			}
+			routes[i].HandlerID = h.ID
+			if h.Summary != "" {
+				routes[i].Summary = h.Summary
+			}
+			if h.Permission != "" {
+				routes[i].Permission = h.Permission
+			}
+		}
+	}
+
+	return routes
+}
+
+// VirtualRoutes returns the declared api.handlers entries that no generated
+// handler mounts. They are published, not exposed, by the route catalog.
+func VirtualRoutes(service Service) []RouteSpec {
+	if service.API == nil {
+		return nil
+	}
+
+	mounted := map[string]bool{}
+	for _, r := range ServiceRoutes(service) {
+		mounted[r.Method+" "+r.Path] = true
+	}
+
+	var routes []RouteSpec
+	for _, h := range service.API.Handlers {
+		method, path := h.ParseRoute()
+		if method == "" || path == "" || mounted[method+" "+path] {
+			continue
+		}
+		route := RouteSpec{
+			Method:    method,
+			Path:      path,
+			HandlerID: h.ID,
+			Summary:   h.Summary,
+			Resource:  h.Model,
+			Op:        h.Operation,
+		}
+		if h.Model != "" {
+			route.Tags = []string{strings.ToLower(pluralize(h.Model))}
+			setRouteAuthz(&route, h.Model)
+		}
+		if h.Permission != "" {
+			route.Permission = h.Permission
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// setRouteAuthz sets the default permission of a route on resource: <plural>:read
+// for GET and <plural>:write for other methods. Routes with path parameters are
+// scoped to the resource, identified by the first parameter.
+func setRouteAuthz(route *RouteSpec, resource string) {
+	action := "write"
+	if route.Method == http.MethodGet {
+		action = "read"
+	}
+	route.Permission = strings.ToLower(pluralize(resource)) + ":" + action
+	if strings.Contains(route.Path, "{") {
+		route.ScopeType = strings.ToLower(resource)
+	}
+}
+
+func sortedAggregateNames(service Service) []string {
+	names := make([]string, 0, len(service.Aggregates))
+	for name := range service.Aggregates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedModelNames(service Service) []string {
+	names := make([]string, 0, len(service.Models))
+	for name := range service.Models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedChildKeys(agg AggregateRoot) []string {
+	keys := make([]string, 0, len(agg.Children))
+	for key := range agg.Children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedFieldNames(fields map[string]Field) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,260 @@
+package hatmax
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ClientTS is the --clients value that enables the TypeScript client.
+const ClientTS = "ts"
+
+// TSClientGenerator renders a dependency free TypeScript module with the
+// types and a fetch based client of a generated service into clients/ts.
+type TSClientGenerator struct {
+	OutputDir   string // Monorepo root
+	ServiceName string
+	Service     *Service
+	TemplateFS  fs.FS
+	Tmpl        *template.Template
+}
+
+// TSClientTemplateData holds the data for the TypeScript client template.
+type TSClientTemplateData struct {
+	ServiceName string
+	ClientName  string
+	Enums       []TSEnumData
+	Interfaces  []TSInterfaceData
+	Methods     []TSMethodData
+}
+
+// TSEnumData describes a string union built from a one_of validation.
+type TSEnumData struct {
+	Name   string
+	Values []string
+}
+
+// TSInterfaceData describes a resource interface and its input variant.
+type TSInterfaceData struct {
+	Name   string
+	Fields []TSFieldData
+	Input  []TSFieldData
+}
+
+// TSFieldData describes a single interface property.
+type TSFieldData struct {
+	Name string
+	Type string
+}
+
+// TSMethodData describes a client method bound to a route.
+type TSMethodData struct {
+	Name       string
+	HTTPMethod string
+	Path       string
+	PathExpr   string
+	Params     []string
+	Input      string
+	Output     string
+	List       bool
+}
+
+func NewTSClientGenerator(outputDir, serviceName string, service *Service, templateFS fs.FS) (*TSClientGenerator, error) {
+	tmpl, err := template.ParseFS(templateFS, "assets/templates/client_ts.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse TypeScript client template: %w", err)
+	}
+
+	return &TSClientGenerator{
+		OutputDir:   outputDir,
+		ServiceName: serviceName,
+		Service:     service,
+		TemplateFS:  templateFS,
+		Tmpl:        tmpl,
+	}, nil
+}
+
+// Generate writes clients/ts/<service>.ts.
+func (g *TSClientGenerator) Generate() error {
+	src, err := g.Render()
+	if err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(g.OutputDir, "clients", "ts", g.ServiceName+".ts")
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return fmt.Errorf("cannot create directory for %s: %w", filePath, err)
+	}
+	if err := os.WriteFile(filePath, src, 0o644); err != nil {
+		return fmt.Errorf("cannot write %s: %w", filePath, err)
+	}
+	logCreated(filePath)
+
+	return nil
+}
+
+// Render returns the TypeScript module source.
+func (g *TSClientGenerator) Render() ([]byte, error) {
+	data, err := BuildTSClientTemplateData(g.ServiceName, *g.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := g.Tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("cannot render TypeScript client for service %s: %w", g.ServiceName, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// BuildTSClientTemplateData maps the service routes and schemas to TypeScript types and methods.
+func BuildTSClientTemplateData(serviceName string, service Service) (*TSClientTemplateData, error) {
+	data := &TSClientTemplateData{
+		ServiceName: serviceName,
+		ClientName:  capitalizeFirst(serviceName) + "Client",
+	}
+
+	for _, aggName := range sortedAggregateNames(service) {
+		agg := service.Aggregates[aggName]
+		iface := TSInterfaceData{Name: aggName}
+		iface.Fields = append(iface.Fields, TSFieldData{Name: "id", Type: "string"})
+		inputs := data.tsFields(aggName, agg.Fields)
+		iface.Fields = append(iface.Fields, inputs...)
+		iface.Input = inputs
+		if agg.VersionField != "" {
+			iface.Fields = append(iface.Fields, TSFieldData{Name: agg.VersionField, Type: "number"})
+		}
+		if agg.Audit {
+			iface.Fields = append(iface.Fields, tsAuditFields()...)
+		}
+
+		for _, childKey := range sortedChildKeys(agg) {
+			child := agg.Children[childKey]
+			if _, ok := service.Models[child.Of]; !ok {
+				return nil, fmt.Errorf("child model %s of aggregate %s not found in service models", child.Of, aggName)
+			}
+			iface.Fields = append(iface.Fields, TSFieldData{Name: toSnakeCase(childKey), Type: child.Of + "[]"})
+		}
+
+		data.Interfaces = append(data.Interfaces, iface)
+	}
+
+	for _, modelName := range sortedModelNames(service) {
+		model := service.Models[modelName]
+		iface := TSInterfaceData{Name: modelName}
+		iface.Fields = append(iface.Fields, TSFieldData{Name: "id", Type: "string"})
+		inputs := data.tsFields(modelName, model.Fields)
+		iface.Fields = append(iface.Fields, inputs...)
+		iface.Input = inputs
+		if model.Options != nil && model.Options.Audit {
+			iface.Fields = append(iface.Fields, tsAuditFields()...)
+		}
+		data.Interfaces = append(data.Interfaces, iface)
+	}
+
+	for _, route := range ServiceRoutes(service) {
+		method := TSMethodData{
+			Name:       lowerFirst(route.OperationID),
+			HTTPMethod: route.Method,
+			Path:       route.Path,
+			List:       route.List,
+		}
+
+		expr := route.Path
+		params := pathParams(route.Path)
+		for _, param := range params {
+			name := goParamName(param)
+			method.Params = append(method.Params, name)
+			expr = strings.Replace(expr, "{"+param+"}", "${encodeURIComponent("+name+")}", 1)
+		}
+		if len(params) > 0 {
+			method.PathExpr = "`" + expr + "`"
+		} else {
+			method.PathExpr = fmt.Sprintf("%q", route.Path)
+		}
+
+		if route.Op == OpCreate || route.Op == OpUpdate {
+			method.Input = route.Resource + "Input"
+		}
+		if route.Status != http.StatusNoContent {
+			method.Output = route.Resource
+		}
+
+		data.Methods = append(data.Methods, method)
+	}
+
+	return data, nil
+}
+
+// tsFields maps spec fields to interface properties, registering a string
+// union for every field restricted by one_of.
+func (d *TSClientTemplateData) tsFields(typeName string, fields map[string]Field) []TSFieldData {
+	var result []TSFieldData
+	for _, fieldName := range sortedFieldNames(fields) {
+		field := fields[fieldName]
+		tsType := tsType(field.Type)
+		for _, v := range field.Validations {
+			if v.Name != "one_of" {
+				continue
+			}
+			if values := splitOneOf(v.Value); len(values) > 0 {
+				enum := TSEnumData{Name: typeName + capitalizeFirst(fieldName), Values: values}
+				d.Enums = append(d.Enums, enum)
+				tsType = enum.Name
+			}
+		}
+		result = append(result, TSFieldData{Name: toSnakeCase(fieldName), Type: tsType})
+	}
+	return result
+}
+
+func tsAuditFields() []TSFieldData {
+	return []TSFieldData{
+		{Name: "created_at", Type: "string"},
+		{Name: "created_by", Type: "string"},
+		{Name: "updated_at", Type: "string"},
+		{Name: "updated_by", Type: "string"},
+	}
+}
+
+// tsType maps spec types to TypeScript types. UUIDs travel as strings.
+func tsType(specType string) string {
+	switch specType {
+	case "text", "string", "email", "uuid":
+		return "string"
+	case "bool":
+		return "boolean"
+	default:
+		return "unknown"
+	}
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// parseClients validates the values of the --clients flag.
+func parseClients(values []string) (map[string]bool, error) {
+	clients := map[string]bool{}
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			switch name {
+			case "":
+			case ClientTS:
+				clients[name] = true
+			default:
+				return nil, fmt.Errorf("unsupported client %q (supported: %s)", name, ClientTS)
+			}
+		}
+	}
+	return clients, nil
+}
@@ -0,0 +1,125 @@
+package hatmax
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestTSClientGolden(t *testing.T) {
+	service := testTodoService()
+	gen, err := NewTSClientGenerator(t.TempDir(), "todo", &service, os.DirFS(filepath.Join("..", "..")))
+	if err != nil {
+		t.Fatalf("NewTSClientGenerator() error = %v", err)
+	}
+
+	got, err := gen.Render()
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	golden := filepath.Join("testdata", "todo.ts.golden")
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatalf("cannot update golden file: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("cannot read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("TypeScript client does not match %s (run with -update to refresh)\n--- got ---\n%s", golden, got)
+	}
+}
+
+func TestTSClientGenerateWritesModule(t *testing.T) {
+	service := testTodoService()
+	outputDir := t.TempDir()
+	gen, err := NewTSClientGenerator(outputDir, "todo", &service, os.DirFS(filepath.Join("..", "..")))
+	if err != nil {
+		t.Fatalf("NewTSClientGenerator() error = %v", err)
+	}
+
+	if err := gen.Generate(); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "clients", "ts", "todo.ts")); err != nil {
+		t.Errorf("clients/ts/todo.ts not written: %v", err)
+	}
+}
+
+func TestBuildTSClientTemplateData(t *testing.T) {
+	data, err := BuildTSClientTemplateData("todo", testTodoService())
+	if err != nil {
+		t.Fatalf("BuildTSClientTemplateData() error = %v", err)
+	}
+
+	if data.ClientName != "TodoClient" {
+		t.Errorf("ClientName = %s, want TodoClient", data.ClientName)
+	}
+
+	if len(data.Enums) != 1 || data.Enums[0].Name != "NotePriority" {
+		t.Fatalf("Enums = %+v, want NotePriority", data.Enums)
+	}
+	if got := data.Enums[0].Values; len(got) != 3 || got[0] != "low" || got[2] != "high" {
+		t.Errorf("NotePriority values = %v, want [low normal high]", got)
+	}
+
+	methods := map[string]TSMethodData{}
+	for _, m := range data.Methods {
+		methods[m.Name] = m
+	}
+
+	tests := []struct {
+		name     string
+		wantPath string
+	}{
+		{"createList", `"/lists"`},
+		{"getList", "`/lists/${encodeURIComponent(id)}`"},
+		{"removeItemFromList", "`/lists/${encodeURIComponent(id)}/items/${encodeURIComponent(childID)}`"},
+	}
+
+	for _, tt := range tests {
+		m, ok := methods[tt.name]
+		if !ok {
+			t.Errorf("method %s not generated", tt.name)
+			continue
+		}
+		if m.PathExpr != tt.wantPath {
+			t.Errorf("%s PathExpr = %s, want %s", tt.name, m.PathExpr, tt.wantPath)
+		}
+	}
+}
+
+func TestParseClients(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    bool
+		wantErr bool
+	}{
+		{"none", nil, false, false},
+		{"ts", []string{"ts"}, true, false},
+		{"comma separated", []string{"TS, "}, true, false},
+		{"unsupported", []string{"ts,python"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients, err := parseClients(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseClients() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && clients[ClientTS] != tt.want {
+				t.Errorf("parseClients()[ts] = %v, want %v", clients[ClientTS], tt.want)
+			}
+		})
+	}
+}